@@ -0,0 +1,181 @@
+// Command burrowctl-bench runs the burrowctl load tests.
+//
+// Usage:
+//
+//	burrowctl-bench load [-workers 1,4,16,64] [-rows 1,100,1000,10000] [-json]
+//
+// Subcommands:
+//
+//	load   Throughput and latency percentiles of an in-process server over
+//	       worker counts and payload sizes, against the RabbitMQ and MySQL of
+//	       benchmarks/docker-compose.yml
+//
+// The micro-benchmarks of the query cache, SQL validator and response codec
+// are Go benchmarks in the benchmarks package: go test -bench . -benchmem ./benchmarks/
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lordbasex/burrowctl/benchmarks"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "micro":
+		fmt.Fprintln(os.Stderr, "burrowctl-bench: the micro-benchmarks are Go benchmarks; run: go test -run '^$' -bench . -benchmem ./benchmarks/")
+		os.Exit(2)
+	case "load":
+		os.Exit(load(os.Args[2:]))
+	case "-h", "-help", "--help", "help":
+		usage()
+	default:
+		fmt.Fprintf(os.Stderr, "burrowctl-bench: unknown command %q\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+}
+
+// usage prints the subcommands
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: burrowctl-bench <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	fmt.Fprintln(os.Stderr, "  load   Throughput and latency over worker counts and payload sizes (needs RabbitMQ and MySQL)")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run 'burrowctl-bench <command> -h' for the flags of a command.")
+	fmt.Fprintln(os.Stderr, "Micro-benchmarks: go test -run '^$' -bench . -benchmem ./benchmarks/")
+}
+
+// load runs the load test sweeps; it returns 1 when the run failed or any
+// request failed
+func load(args []string) int {
+	defaults := benchmarks.DefaultLoadConfig()
+	flags := flag.NewFlagSet("load", flag.ExitOnError)
+	amqpURL := flags.String("amqp", defaults.AMQPURL, "RabbitMQ URL")
+	mysqlDSN := flags.String("mysql", defaults.MySQLDSN, "MySQL DSN of the in-process server")
+	workers := flags.String("workers", joinInts(defaults.Workers), "Comma-separated server worker counts (the first is used for the payload sweep)")
+	rows := flags.String("rows", joinInts(defaults.PayloadRows), "Comma-separated result sizes in rows (the first is used for the workers sweep)")
+	concurrency := flags.Int("concurrency", defaults.Concurrency, "Client goroutines issuing queries")
+	duration := flags.Duration("duration", defaults.Duration, "Measured time of each point")
+	warmup := flags.Duration("warmup", defaults.Warmup, "Unmeasured time before each point")
+	clientDSN := flags.String("client-dsn", "", "Extra client DSN parameters, e.g. columnar=true")
+	verbose := flags.Bool("v", false, "Show server logs")
+	asJSON := flags.Bool("json", false, "Print results as JSON")
+	flags.Parse(args)
+
+	config := defaults
+	config.AMQPURL = *amqpURL
+	config.MySQLDSN = *mysqlDSN
+	config.Concurrency = *concurrency
+	config.Duration = *duration
+	config.Warmup = *warmup
+	config.ClientDSN = *clientDSN
+	var err error
+	if config.Workers, err = parseInts(*workers); err != nil {
+		fmt.Fprintf(os.Stderr, "burrowctl-bench: invalid -workers: %v\n", err)
+		return 2
+	}
+	if config.PayloadRows, err = parseInts(*rows); err != nil {
+		fmt.Fprintf(os.Stderr, "burrowctl-bench: invalid -rows: %v\n", err)
+		return 2
+	}
+
+	// The server logs every request; only progress lines are kept
+	if !*verbose {
+		log.SetOutput(progressWriter{os.Stderr})
+	}
+	results, err := benchmarks.RunLoad(context.Background(), config)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "burrowctl-bench: %v\n", err)
+		return 1
+	}
+
+	failed := false
+	for _, r := range results {
+		if r.Errors > 0 {
+			failed = true
+		}
+	}
+	if *asJSON {
+		if code := printJSON(results); code != 0 {
+			return code
+		}
+	} else {
+		fmt.Printf("%-8s %7s %7s %11s %9s %7s %10s %10s %10s %10s\n",
+			"SWEEP", "WORKERS", "ROWS", "CONCURRENCY", "REQ/S", "ERRORS", "P50", "P90", "P99", "MAX")
+		for _, r := range results {
+			fmt.Printf("%-8s %7d %7d %11d %9.1f %7d %10v %10v %10v %10v\n",
+				r.Sweep, r.Workers, r.PayloadRows, r.Concurrency, r.Throughput, r.Errors,
+				r.P50.Round(time.Microsecond), r.P90.Round(time.Microsecond), r.P99.Round(time.Microsecond), r.Max.Round(time.Microsecond))
+			if r.FirstError != "" {
+				fmt.Printf("         first error: %s\n", r.FirstError)
+			}
+		}
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// progressWriter passes the benchmark's own log lines through and drops
+// the rest
+type progressWriter struct {
+	w io.Writer
+}
+
+// Write implements io.Writer
+func (p progressWriter) Write(b []byte) (int, error) {
+	if strings.Contains(string(b), "[bench]") {
+		return p.w.Write(b)
+	}
+	return len(b), nil
+}
+
+// printJSON prints v as indented JSON
+func printJSON(v interface{}) int {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(v); err != nil {
+		fmt.Fprintf(os.Stderr, "burrowctl-bench: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// parseInts parses a comma-separated list of positive integers
+func parseInts(list string) ([]int, error) {
+	var values []int
+	for _, field := range strings.Split(list, ",") {
+		value, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || value <= 0 {
+			return nil, fmt.Errorf("%q is not a positive integer", field)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// joinInts formats values as a comma-separated list
+func joinInts(values []int) string {
+	fields := make([]string, len(values))
+	for i, value := range values {
+		fields[i] = strconv.Itoa(value)
+	}
+	return strings.Join(fields, ",")
+}
@@ -0,0 +1,214 @@
+package benchmarks
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+	"github.com/lordbasex/burrowctl/server"
+)
+
+// codecDevices numbers the in-memory buses of the decode benchmarks
+var codecDevices uint64
+
+// benchResponse returns a typed SQL result of rows rows, with values in the
+// form the server produces them from MySQL's text protocol
+func benchResponse(rows int) server.RPCResponse {
+	yes, no := true, false
+	resp := server.RPCResponse{
+		Columns: []string{"id", "name", "qty", "price", "created_at", "note"},
+		ColumnTypes: []server.ColumnType{
+			{Name: "id", DatabaseType: "INT", Nullable: &no},
+			{Name: "name", DatabaseType: "VARCHAR", Nullable: &no, Length: 64},
+			{Name: "qty", DatabaseType: "INT", Nullable: &no},
+			{Name: "price", DatabaseType: "DOUBLE", Nullable: &no},
+			{Name: "created_at", DatabaseType: "DATETIME", Nullable: &no},
+			{Name: "note", DatabaseType: "VARCHAR", Nullable: &yes, Length: 255},
+		},
+		Rows: make([][]interface{}, rows),
+	}
+	for i := range resp.Rows {
+		var note interface{}
+		if i%3 == 0 {
+			note = "restocked on " + strconv.Itoa(i%28+1) + " March"
+		}
+		resp.Rows[i] = []interface{}{
+			strconv.Itoa(i + 1),
+			"product-" + strconv.Itoa(i+1),
+			strconv.Itoa(i % 500),
+			strconv.FormatFloat(float64(i%1000)+0.99, 'f', -1, 64),
+			fmt.Sprintf("2024-03-%02d 10:15:00", i%28+1),
+			note,
+		}
+	}
+	return resp
+}
+
+// benchRequest returns the request of a native_types client, listing the
+// columnar capability when columnar is set
+func benchRequest(columnar bool) server.RPCRequest {
+	req := server.RPCRequest{Type: "sql", ColumnTypes: true}
+	if columnar {
+		req.Capabilities = []string{server.CapabilityColumnar}
+	}
+	return req
+}
+
+// codecSizes are the result sizes, in rows, of the codec benchmarks
+var codecSizes = []int{100, 1000}
+
+// BenchmarkEncode encodes typed SQL results on the server, in the row and
+// column-major layouts
+func BenchmarkEncode(b *testing.B) {
+	for _, rows := range codecSizes {
+		b.Run(fmt.Sprintf("rows-%d", rows), benchEncode(rows, false))
+		b.Run(fmt.Sprintf("columnar-%d", rows), benchEncode(rows, true))
+	}
+}
+
+// BenchmarkDecode decodes and scans typed SQL results on the client, in the
+// row and column-major layouts
+func BenchmarkDecode(b *testing.B) {
+	for _, rows := range codecSizes {
+		b.Run(fmt.Sprintf("rows-%d", rows), benchDecode(rows, false))
+		b.Run(fmt.Sprintf("columnar-%d", rows), benchDecode(rows, true))
+	}
+}
+
+// benchEncode encodes a typed SQL result of rows rows, in column-major
+// layout when columnar is set
+func benchEncode(rows int, columnar bool) func(b *testing.B) {
+	return func(b *testing.B) {
+		resp := benchResponse(rows)
+		req := benchRequest(columnar)
+		body, err := server.EncodeResponse(resp, req)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(body)))
+		b.ReportAllocs()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if _, err := server.EncodeResponse(resp, req); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// benchDecode queries a fake device answering with a typed SQL result of
+// rows rows over the in-memory transport, and scans every row, in
+// column-major layout when columnar is set. The time is mostly spent
+// decoding the response.
+func benchDecode(rows int, columnar bool) func(b *testing.B) {
+	return func(b *testing.B) {
+		resp := benchResponse(rows)
+		body, err := server.EncodeResponse(resp, benchRequest(columnar))
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		dsn, stop, err := startCodecDevice(resp)
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer stop()
+
+		db, err := sql.Open("rabbitsql", dsn+"&columnar="+strconv.FormatBool(columnar))
+		if err != nil {
+			b.Fatal(err)
+		}
+		defer db.Close()
+		if err := scanAll(db); err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(int64(len(body)))
+		b.ReportAllocs()
+
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			if err := scanAll(db); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+// scanAll queries the fake device and scans every row of the result
+func scanAll(db *sql.DB) error {
+	rows, err := db.Query("SELECT id, name, qty, price, created_at, note FROM products")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var (
+		id, qty         int64
+		name, createdAt string
+		price           float64
+		note            sql.NullString
+	)
+	for rows.Next() {
+		if err := rows.Scan(&id, &name, &qty, &price, &createdAt, &note); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// startCodecDevice starts a fake device on a private in-memory bus that
+// answers every SQL request with resp, encoded by the server's encoder for
+// what the request asked for. It returns the DSN of the device and a
+// function that stops it.
+func startCodecDevice(resp server.RPCResponse) (string, func(), error) {
+	deviceID := "bench-codec"
+	brokerURL := fmt.Sprintf("mem://burrowctl-bench-%d", atomic.AddUint64(&codecDevices, 1))
+	topology, err := client.NewTopology("", deviceID)
+	if err != nil {
+		return "", nil, err
+	}
+	transport, err := client.OpenTransport(brokerURL)
+	if err != nil {
+		return "", nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs, err := transport.Consume(ctx, topology.RPCQueue)
+	if err != nil {
+		cancel()
+		transport.Close()
+		return "", nil, err
+	}
+
+	go func() {
+		for msg := range msgs {
+			var req server.RPCRequest
+			if err := json.Unmarshal(msg.Body, &req); err != nil {
+				continue
+			}
+			answer := resp
+			if req.Type == "session" {
+				// Connections open their session at connect
+				answer = server.RPCResponse{Columns: []string{"sessionID", "heartbeats"}, Rows: [][]interface{}{{req.SessionID, false}}}
+			}
+			body, err := server.EncodeResponse(answer, req)
+			if err != nil {
+				body, _ = json.Marshal(server.RPCResponse{Error: err.Error()})
+			}
+			transport.Reply(ctx, msg, body)
+		}
+	}()
+
+	dsn := fmt.Sprintf("deviceID=%s&amqp_uri=%s&timeout=%s", deviceID, brokerURL, 10*time.Second)
+	stop := func() {
+		cancel()
+		transport.Close()
+	}
+	return dsn, stop, nil
+}
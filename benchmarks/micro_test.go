@@ -0,0 +1,107 @@
+package benchmarks
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/lordbasex/burrowctl/server"
+)
+
+// Queries the validator benchmarks check
+const (
+	selectQuery    = "SELECT id, name, price FROM products WHERE category_id = ? AND active = 1 ORDER BY name LIMIT 50"
+	joinQuery      = "SELECT o.id, o.created_at, c.name, SUM(i.qty * i.price) AS total FROM orders o JOIN customers c ON c.id = o.customer_id JOIN order_items i ON i.order_id = o.id WHERE o.created_at >= ? AND c.country IN (?, ?, ?) GROUP BY o.id, o.created_at, c.name HAVING total > ? ORDER BY total DESC LIMIT 100"
+	injectionQuery = "SELECT * FROM users WHERE name = '' OR 1=1 UNION SELECT username, password FROM admins --"
+)
+
+// TestMain silences the configuration the components log, so the benchmark
+// report stays readable
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// newBenchCache returns an enabled query cache large enough to hold every
+// key the cache benchmarks use
+func newBenchCache() *server.QueryCache {
+	return server.NewQueryCache(server.QueryCacheConfig{
+		MaxSize:         10000,
+		TTL:             time.Hour,
+		CleanupInterval: time.Hour,
+		Enabled:         true,
+	})
+}
+
+// BenchmarkCacheGetHit looks up a cached result
+func BenchmarkCacheGetHit(b *testing.B) {
+	cache := newBenchCache()
+	params := []interface{}{42}
+	cache.Set(selectQuery, params, benchResponse(10))
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := cache.Get(selectQuery, params); !ok {
+			b.Fatal("cache miss")
+		}
+	}
+}
+
+// BenchmarkCacheGetMiss looks up a query that is not cached
+func BenchmarkCacheGetMiss(b *testing.B) {
+	cache := newBenchCache()
+	cache.Set(selectQuery, []interface{}{42}, benchResponse(10))
+	params := []interface{}{43}
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Get(selectQuery, params)
+	}
+}
+
+// BenchmarkCacheSet stores results under a rotating set of keys, evicting
+// the least recently used once the cache is full
+func BenchmarkCacheSet(b *testing.B) {
+	cache := newBenchCache()
+	resp := benchResponse(10)
+	keys := make([][]interface{}, 20000)
+	for i := range keys {
+		keys[i] = []interface{}{i}
+	}
+	b.ReportAllocs()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Set(selectQuery, keys[i%len(keys)], resp)
+	}
+}
+
+// BenchmarkValidate validates simple, complex and malicious queries with
+// the default rules
+func BenchmarkValidate(b *testing.B) {
+	queries := []struct {
+		name  string
+		query string
+	}{
+		{"select", selectQuery},
+		{"join", joinQuery},
+		{"injection", injectionQuery},
+	}
+	for _, q := range queries {
+		b.Run(q.name, func(b *testing.B) {
+			config := server.DefaultSQLValidationConfig()
+			config.LogViolations = false
+			validator := server.NewSQLValidator(config)
+			b.ReportAllocs()
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				validator.ValidateQuery(q.query, nil)
+			}
+		})
+	}
+}
@@ -0,0 +1,333 @@
+package burrowctltest
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of request an Expectation matches
+const (
+	kindQuery       = "query"
+	kindExec        = "exec"
+	kindFunction    = "function"
+	kindCommand     = "command"
+	kindTransaction = "transaction"
+)
+
+// request is the part of the wire request the fake looks at
+type request struct {
+	Type      string              `json:"type"`
+	Query     string              `json:"query"`
+	Params    []json.RawMessage   `json:"params"`
+	Exec      bool                `json:"exec"`
+	Batch     [][]json.RawMessage `json:"batch"`
+	Command   string              `json:"command"`
+	SessionID string              `json:"sessionID"`
+}
+
+// opensSession reports whether req is the session open a connection sends
+// at connect
+func (r request) opensSession() bool {
+	if r.Type != "session" {
+		return false
+	}
+	var body struct {
+		Action string `json:"action"`
+	}
+	json.Unmarshal([]byte(r.Query), &body)
+	return body.Action == "open"
+}
+
+// kind returns the kind of expectation req can match
+func (r request) kind() string {
+	if r.Type != "sql" {
+		return r.Type
+	}
+	if r.Exec || len(r.Batch) > 0 {
+		return kindExec
+	}
+	return kindQuery
+}
+
+// String describes req in error messages
+func (r request) String() string {
+	switch r.Type {
+	case "transaction":
+		return fmt.Sprintf("transaction %s", r.Command)
+	case "function":
+		var call functionCall
+		json.Unmarshal([]byte(r.Query), &call)
+		return fmt.Sprintf("function %q", call.Name)
+	default:
+		return fmt.Sprintf("%s %q", r.kind(), r.Query)
+	}
+}
+
+// functionCall is the wire form of a function request
+type functionCall struct {
+	Name   string `json:"name"`
+	Params []struct {
+		Value json.RawMessage `json:"value"`
+	} `json:"params"`
+}
+
+// response is the wire form of a response
+type response struct {
+	Columns   []string        `json:"columns"`
+	Rows      [][]interface{} `json:"rows"`
+	Error     string          `json:"error"`
+	ErrorCode string          `json:"errorCode,omitempty"`
+	Result    *execResult     `json:"result,omitempty"`
+}
+
+// execResult is the wire form of the outcome of an Exec request
+type execResult struct {
+	RowsAffected int64 `json:"rowsAffected"`
+	LastInsertID int64 `json:"lastInsertId"`
+	Executions   int   `json:"executions"`
+}
+
+// QueryMatcher reports whether received SQL matches expected SQL
+type QueryMatcher func(expected, actual string) bool
+
+// QueryMatcherEqual matches SQL that is equal apart from whitespace
+func QueryMatcherEqual(expected, actual string) bool {
+	return strings.Join(strings.Fields(expected), " ") == strings.Join(strings.Fields(actual), " ")
+}
+
+// QueryMatcherRegexp treats the expected SQL as a regular expression
+func QueryMatcherRegexp(expected, actual string) bool {
+	re, err := regexp.Compile(expected)
+	return err == nil && re.MatchString(actual)
+}
+
+// Rows is a result set returned by an expectation
+type Rows struct {
+	columns []string
+	rows    [][]interface{}
+}
+
+// NewRows returns an empty result set with the given columns
+func NewRows(columns ...string) *Rows {
+	return &Rows{columns: columns}
+}
+
+// AddRow appends a row; it panics if the number of values does not match
+// the columns
+func (r *Rows) AddRow(values ...interface{}) *Rows {
+	if len(values) != len(r.columns) {
+		panic(fmt.Sprintf("burrowctltest: row has %d values for %d columns", len(values), len(r.columns)))
+	}
+	r.rows = append(r.rows, values)
+	return r
+}
+
+// Expectation is a request the fake device expects and the response it
+// answers with. Build it with the Server's Expect methods and chain the
+// With/Will methods.
+type Expectation struct {
+	kind     string
+	text     string        // SQL, function name, command line or transaction command
+	args     []interface{} // Arguments to compare (nil: any)
+	response response
+	delay    time.Duration
+
+	triggered bool
+}
+
+// ExpectQuery expects a SQL query returning rows. It answers with an empty
+// result set unless told otherwise.
+func (s *Server) ExpectQuery(query string) *Expectation {
+	return s.expect(&Expectation{kind: kindQuery, text: query})
+}
+
+// ExpectExec expects a SQL statement run with Exec (or BatchExec). It
+// answers with zero affected rows unless told otherwise.
+func (s *Server) ExpectExec(query string) *Expectation {
+	return s.expect(&Expectation{kind: kindExec, text: query, response: response{Result: &execResult{Executions: 1}}})
+}
+
+// ExpectFunction expects a call of the named function
+func (s *Server) ExpectFunction(name string) *Expectation {
+	return s.expect(&Expectation{kind: kindFunction, text: name, response: response{
+		Columns: []string{"result"},
+		Rows:    [][]interface{}{{"no output"}},
+	}})
+}
+
+// ExpectCommand expects the given system command line
+func (s *Server) ExpectCommand(command string) *Expectation {
+	return s.expect(&Expectation{kind: kindCommand, text: command, response: response{
+		Columns: []string{"output"},
+		Rows:    [][]interface{}{{""}},
+	}})
+}
+
+// ExpectBegin expects a transaction to start
+func (s *Server) ExpectBegin() *Expectation {
+	return s.expectTransaction("BEGIN")
+}
+
+// ExpectCommit expects a transaction to be committed
+func (s *Server) ExpectCommit() *Expectation {
+	return s.expectTransaction("COMMIT")
+}
+
+// ExpectRollback expects a transaction to be rolled back
+func (s *Server) ExpectRollback() *Expectation {
+	return s.expectTransaction("ROLLBACK")
+}
+
+// expectTransaction expects a transaction command
+func (s *Server) expectTransaction(command string) *Expectation {
+	return s.expect(&Expectation{kind: kindTransaction, text: command, response: response{
+		Columns: []string{"status"},
+		Rows:    [][]interface{}{{"ok"}},
+	}})
+}
+
+// WithArgs expects the SQL parameters, or the function parameter values,
+// to equal args once encoded. Batches are not compared.
+func (e *Expectation) WithArgs(args ...interface{}) *Expectation {
+	if args == nil {
+		args = []interface{}{}
+	}
+	e.args = args
+	return e
+}
+
+// WillReturnRows answers with rows
+func (e *Expectation) WillReturnRows(rows *Rows) *Expectation {
+	e.response = response{Columns: rows.columns, Rows: rows.rows}
+	return e
+}
+
+// WillReturnResult answers an Exec with the last insert ID and affected rows
+func (e *Expectation) WillReturnResult(lastInsertID, rowsAffected int64) *Expectation {
+	e.response = response{Result: &execResult{RowsAffected: rowsAffected, LastInsertID: lastInsertID, Executions: 1}}
+	return e
+}
+
+// WillReturnValue answers a function call with its return value. Structs,
+// maps and slices are sent as JSON, like the server does for structs.
+func (e *Expectation) WillReturnValue(value interface{}) *Expectation {
+	if value != nil {
+		switch reflect.TypeOf(value).Kind() {
+		case reflect.Struct, reflect.Map, reflect.Slice:
+			data, err := json.Marshal(value)
+			if err != nil {
+				panic(fmt.Sprintf("burrowctltest: cannot encode function result: %v", err))
+			}
+			value = string(data)
+		}
+	} else {
+		value = "null"
+	}
+	e.response = response{Columns: []string{"result"}, Rows: [][]interface{}{{value}}}
+	return e
+}
+
+// WillReturnOutput answers a command with its output, one row per line
+func (e *Expectation) WillReturnOutput(lines ...string) *Expectation {
+	rows := make([][]interface{}, 0, len(lines))
+	for _, line := range lines {
+		rows = append(rows, []interface{}{line})
+	}
+	e.response = response{Columns: []string{"output"}, Rows: rows}
+	return e
+}
+
+// WillReturnError answers with a server error
+func (e *Expectation) WillReturnError(message string) *Expectation {
+	return e.WillReturnErrorCode("", message)
+}
+
+// WillReturnErrorCode answers with a server error carrying a machine-readable
+// code (e.g. client.TxErrNotFound), for testing how the code is handled
+func (e *Expectation) WillReturnErrorCode(code, message string) *Expectation {
+	e.response = response{Error: message, ErrorCode: code}
+	return e
+}
+
+// WillDelayFor waits d before answering, to test timeouts
+func (e *Expectation) WillDelayFor(d time.Duration) *Expectation {
+	e.delay = d
+	return e
+}
+
+// String describes the expectation in error messages
+func (e *Expectation) String() string {
+	if e.kind == kindTransaction {
+		return "transaction " + e.text
+	}
+	if e.args != nil {
+		return fmt.Sprintf("%s %q with args %v", e.kind, e.text, e.args)
+	}
+	return fmt.Sprintf("%s %q", e.kind, e.text)
+}
+
+// matches returns why req does not match the expectation, or nil
+func (e *Expectation) matches(req request, matcher QueryMatcher) error {
+	if req.kind() != e.kind {
+		return fmt.Errorf("got a %s request", req.kind())
+	}
+
+	switch e.kind {
+	case kindTransaction:
+		if !strings.EqualFold(req.Command, e.text) {
+			return fmt.Errorf("got %s", req.Command)
+		}
+		return nil
+	case kindFunction:
+		var call functionCall
+		if err := json.Unmarshal([]byte(req.Query), &call); err != nil {
+			return fmt.Errorf("invalid function request: %v", err)
+		}
+		if call.Name != e.text {
+			return fmt.Errorf("got function %q", call.Name)
+		}
+		values := make([]json.RawMessage, len(call.Params))
+		for i, p := range call.Params {
+			values[i] = p.Value
+		}
+		return e.matchArgs(values)
+	case kindCommand:
+		if strings.TrimSpace(req.Query) != strings.TrimSpace(e.text) {
+			return fmt.Errorf("got command %q", req.Query)
+		}
+		return nil
+	default:
+		if !matcher(e.text, req.Query) {
+			return fmt.Errorf("got %q", req.Query)
+		}
+		if len(req.Batch) > 0 {
+			return nil
+		}
+		return e.matchArgs(req.Params)
+	}
+}
+
+// matchArgs compares the expected arguments with the received ones
+func (e *Expectation) matchArgs(received []json.RawMessage) error {
+	if e.args == nil {
+		return nil
+	}
+	if len(received) != len(e.args) {
+		return fmt.Errorf("got %d args, expected %d", len(received), len(e.args))
+	}
+	for i, arg := range e.args {
+		want, err := json.Marshal(arg)
+		if err != nil {
+			return fmt.Errorf("cannot encode expected arg %d: %v", i, err)
+		}
+		if !bytes.Equal(bytes.TrimSpace(received[i]), want) {
+			return fmt.Errorf("arg %d is %s, expected %s", i, received[i], want)
+		}
+	}
+	return nil
+}
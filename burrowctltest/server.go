@@ -0,0 +1,224 @@
+// Package burrowctltest provides a scriptable fake device for tests of code
+// that talks to burrowctl through the database/sql driver or BurrowClient.
+//
+// The fake answers real requests sent through a transport (the in-memory
+// one by default), so the driver, its serialization and its timeouts are
+// exercised as in production; only the device is scripted.
+//
+// Example:
+//
+//	fake, err := burrowctltest.NewServer("test-device")
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer fake.Close()
+//
+//	fake.ExpectQuery("SELECT name FROM users WHERE id = ?").
+//		WithArgs(42).
+//		WillReturnRows(burrowctltest.NewRows("name").AddRow("alice"))
+//	fake.ExpectExec("DELETE FROM sessions").WillReturnError("table is locked")
+//
+//	db, _ := sql.Open("rabbitsql", fake.DSN())
+//	// ... code under test ...
+//
+//	if err := fake.ExpectationsWereMet(); err != nil {
+//		t.Error(err)
+//	}
+package burrowctltest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+)
+
+// busCounter numbers the in-memory buses of servers created by NewServer
+var busCounter uint64
+
+// Server is a fake burrowctl device answering requests with scripted
+// responses. It is safe for concurrent use.
+type Server struct {
+	deviceID  string
+	brokerURL string
+	transport client.Transport
+	cancel    context.CancelFunc
+	wg        sync.WaitGroup
+
+	mutex      sync.Mutex
+	expected   []*Expectation
+	ordered    bool         // Requests must arrive in the order they were expected
+	matcher    QueryMatcher // Compares expected and received SQL
+	unexpected []string     // Requests no expectation matched
+}
+
+// NewServer starts a fake device on a private in-memory bus. Connect to it
+// with DSN.
+func NewServer(deviceID string) (*Server, error) {
+	bus := fmt.Sprintf("mem://burrowctltest-%d", atomic.AddUint64(&busCounter, 1))
+	return NewServerOn(bus, deviceID)
+}
+
+// NewServerOn starts a fake device on the broker at brokerURL, which must be
+// served by a client.Transport (mem://, nats://, ...), so tests can also
+// run against a real broker.
+func NewServerOn(brokerURL, deviceID string) (*Server, error) {
+	if client.IsAMQPURL(brokerURL) {
+		return nil, fmt.Errorf("burrowctltest needs a transport URL (mem://, nats://), not %s", brokerURL)
+	}
+	topology, err := client.NewTopology("", deviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	transport, err := client.OpenTransport(brokerURL)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	msgs, err := transport.Consume(ctx, topology.RPCQueue)
+	if err != nil {
+		cancel()
+		transport.Close()
+		return nil, err
+	}
+
+	s := &Server{
+		deviceID:  deviceID,
+		brokerURL: brokerURL,
+		transport: transport,
+		cancel:    cancel,
+		ordered:   true,
+		matcher:   QueryMatcherEqual,
+	}
+	s.wg.Add(1)
+	go s.serve(ctx, msgs)
+	return s, nil
+}
+
+// DSN returns a driver DSN connected to the fake device
+func (s *Server) DSN() string {
+	return "deviceID=" + s.deviceID + "&amqp_uri=" + s.brokerURL + "&timeout=5s"
+}
+
+// MatchExpectationsInOrder sets whether requests must arrive in the order
+// they were expected (the default) or may match any pending expectation
+func (s *Server) MatchExpectationsInOrder(ordered bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ordered = ordered
+}
+
+// SetQueryMatcher sets how expected SQL is compared with received SQL
+// (QueryMatcherEqual by default)
+func (s *Server) SetQueryMatcher(matcher QueryMatcher) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.matcher = matcher
+}
+
+// ExpectationsWereMet returns an error describing every expectation that
+// was not triggered and every request that was not expected
+func (s *Server) ExpectationsWereMet() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var problems []string
+	for _, e := range s.expected {
+		if !e.triggered {
+			problems = append(problems, "expected "+e.String()+" was not received")
+		}
+	}
+	problems = append(problems, s.unexpected...)
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("burrowctltest: %s", strings.Join(problems, "; "))
+}
+
+// Close stops the fake device
+func (s *Server) Close() error {
+	s.cancel()
+	s.wg.Wait()
+	return s.transport.Close()
+}
+
+// expect adds an expectation
+func (s *Server) expect(e *Expectation) *Expectation {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.expected = append(s.expected, e)
+	return e
+}
+
+// serve answers requests until ctx is done. Each request is answered on its
+// own goroutine so a delayed response does not hold up the others.
+func (s *Server) serve(ctx context.Context, msgs <-chan client.Message) {
+	defer s.wg.Done()
+	for msg := range msgs {
+		s.wg.Add(1)
+		go func(msg client.Message) {
+			defer s.wg.Done()
+			s.answer(ctx, msg)
+		}(msg)
+	}
+}
+
+// answer sends the scripted response to one request
+func (s *Server) answer(ctx context.Context, msg client.Message) {
+	var req request
+	resp := response{}
+	if err := json.Unmarshal(msg.Body, &req); err != nil {
+		resp.Error = fmt.Sprintf("burrowctltest: invalid request: %v", err)
+	} else if req.opensSession() {
+		// Connections open their session at connect; that is not scripted
+		resp = response{Columns: []string{"sessionID", "heartbeats"}, Rows: [][]interface{}{{req.SessionID, false}}}
+	} else if e, err := s.match(req); err != nil {
+		resp.Error = err.Error()
+	} else {
+		if e.delay > 0 {
+			select {
+			case <-time.After(e.delay):
+			case <-ctx.Done():
+				return
+			}
+		}
+		resp = e.response
+	}
+
+	body, _ := json.Marshal(resp)
+	s.transport.Reply(ctx, msg, body)
+}
+
+// match finds the expectation req triggers and marks it triggered
+func (s *Server) match(req request) (*Expectation, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, e := range s.expected {
+		if e.triggered {
+			continue
+		}
+		if err := e.matches(req, s.matcher); err != nil {
+			if s.ordered {
+				return nil, s.reject(req, fmt.Sprintf("next expectation is %s: %v", e, err))
+			}
+			continue
+		}
+		e.triggered = true
+		return e, nil
+	}
+	return nil, s.reject(req, "no expectation is pending")
+}
+
+// reject records an unexpected request and returns the error it is answered with
+func (s *Server) reject(req request, reason string) error {
+	problem := fmt.Sprintf("unexpected %s (%s)", req, reason)
+	s.unexpected = append(s.unexpected, problem)
+	return fmt.Errorf("burrowctltest: %s", problem)
+}
@@ -0,0 +1,111 @@
+package burrowctltest_test
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/lordbasex/burrowctl/burrowctltest"
+	_ "github.com/lordbasex/burrowctl/client"
+)
+
+// newFake starts a fake device and opens the driver on it; the expectations
+// are checked when the test ends
+func newFake(t *testing.T) (*burrowctltest.Server, *sql.DB) {
+	t.Helper()
+
+	fake, err := burrowctltest.NewServer("test-device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := sql.Open("rabbitsql", fake.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		fake.Close()
+	})
+	return fake, db
+}
+
+func TestQueryWithArgs(t *testing.T) {
+	fake, db := newFake(t)
+	fake.ExpectQuery("SELECT id, name FROM users WHERE id = ?").
+		WithArgs(42).
+		WillReturnRows(burrowctltest.NewRows("id", "name").AddRow(42, "alice"))
+
+	var id int
+	var name string
+	if err := db.QueryRow("SELECT id, name FROM users WHERE id = ?", 42).Scan(&id, &name); err != nil {
+		t.Fatal(err)
+	}
+	if id != 42 || name != "alice" {
+		t.Fatalf("got (%d, %q), expected (42, \"alice\")", id, name)
+	}
+	if err := fake.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestExec(t *testing.T) {
+	fake, db := newFake(t)
+	fake.ExpectExec("UPDATE users SET name = ? WHERE id = ?").
+		WithArgs("bob", 42).
+		WillReturnResult(0, 1)
+	fake.ExpectExec("DELETE FROM sessions").WillReturnError("table is locked")
+
+	result, err := db.Exec("UPDATE users SET name = ? WHERE id = ?", "bob", 42)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected != 1 {
+		t.Fatalf("rows affected = %d, %v; expected 1", affected, err)
+	}
+
+	if _, err := db.Exec("DELETE FROM sessions"); err == nil || !strings.Contains(err.Error(), "table is locked") {
+		t.Fatalf("expected the scripted error, got %v", err)
+	}
+	if err := fake.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransaction(t *testing.T) {
+	fake, db := newFake(t)
+	fake.ExpectBegin()
+	fake.ExpectExec("INSERT INTO orders (item) VALUES (?)").WithArgs("widget").WillReturnResult(7, 1)
+	fake.ExpectCommit()
+
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := tx.ExecContext(ctx, "INSERT INTO orders (item) VALUES (?)", "widget")
+	if err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
+	if id, err := result.LastInsertId(); err != nil || id != 7 {
+		t.Fatalf("last insert ID = %d, %v; expected 7", id, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := fake.ExpectationsWereMet(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUnexpectedRequest(t *testing.T) {
+	fake, db := newFake(t)
+
+	if _, err := db.Exec("DROP TABLE users"); err == nil {
+		t.Fatal("unexpected request was answered without an error")
+	}
+	if err := fake.ExpectationsWereMet(); err == nil || !strings.Contains(err.Error(), "DROP TABLE users") {
+		t.Fatalf("unexpected request not reported: %v", err)
+	}
+}
@@ -0,0 +1,337 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// aggregateItemPattern matches "FUNC(arg) [AS alias]" or "column [AS alias]"
+var aggregateItemPattern = regexp.MustCompile(`(?i)^(?:(SUM|COUNT|AVG|MIN|MAX)\(\s*(DISTINCT\s+)?([A-Za-z0-9_.*]+)\s*\)|([A-Za-z0-9_.]+))(?:\s+AS\s+([A-Za-z0-9_]+))?$`)
+
+// groupByPattern splits the GROUP BY clause off an aggregation spec
+var groupByPattern = regexp.MustCompile(`(?i)\s+GROUP\s+BY\s+`)
+
+// aggregateItem is one output column of an aggregation
+type aggregateItem struct {
+	function string // SUM, COUNT, AVG, MIN, MAX, or "" for a grouping column
+	distinct bool   // COUNT(DISTINCT column)
+	column   string // Input column, "*" for COUNT(*)
+	alias    string // Output column name
+	index    int    // Index of column in the input, -1 for "*"
+}
+
+// Aggregation is a parsed aggregation spec, see ParseAggregation
+type Aggregation struct {
+	items   []aggregateItem
+	groupBy []string
+}
+
+// ParseAggregation parses a small SQL-like aggregation spec applied to rows
+// merged from many devices: a comma-separated list of SUM, COUNT, AVG, MIN
+// and MAX over columns (COUNT(*) and COUNT(DISTINCT col) included), plain
+// grouping columns, optional "AS alias" names and an optional GROUP BY.
+// The device_id column added by Fleet.Query can be used like any other.
+//
+// Example:
+//
+//	agg, err := client.ParseAggregation("region, SUM(active) AS active, COUNT(DISTINCT device_id) AS devices GROUP BY region")
+func ParseAggregation(spec string) (*Aggregation, error) {
+	spec = strings.TrimSpace(spec)
+	agg := &Aggregation{}
+
+	if parts := groupByPattern.Split(spec, 2); len(parts) == 2 {
+		spec = parts[0]
+		for _, column := range strings.Split(parts[1], ",") {
+			column = strings.TrimSpace(column)
+			if column == "" {
+				return nil, fmt.Errorf("invalid aggregation: empty GROUP BY column")
+			}
+			agg.groupBy = append(agg.groupBy, column)
+		}
+	}
+
+	for _, item := range strings.Split(spec, ",") {
+		match := aggregateItemPattern.FindStringSubmatch(strings.TrimSpace(item))
+		if match == nil {
+			return nil, fmt.Errorf("invalid aggregation item '%s'", strings.TrimSpace(item))
+		}
+
+		parsed := aggregateItem{
+			function: strings.ToUpper(match[1]),
+			distinct: match[2] != "",
+			column:   match[3],
+			alias:    match[5],
+		}
+		if parsed.function == "" {
+			parsed.column = match[4]
+			if !agg.grouped(parsed.column) {
+				return nil, fmt.Errorf("invalid aggregation: column '%s' must appear in GROUP BY", parsed.column)
+			}
+		}
+		if parsed.column == "*" && (parsed.function != "COUNT" || parsed.distinct) {
+			return nil, fmt.Errorf("invalid aggregation: only COUNT accepts *")
+		}
+		if parsed.distinct && parsed.function != "COUNT" {
+			return nil, fmt.Errorf("invalid aggregation: DISTINCT is only supported in COUNT")
+		}
+		if parsed.alias == "" {
+			parsed.alias = strings.TrimSpace(item)
+		}
+		agg.items = append(agg.items, parsed)
+	}
+	return agg, nil
+}
+
+// grouped reports whether column is a GROUP BY column
+func (a *Aggregation) grouped(column string) bool {
+	for _, name := range a.groupBy {
+		if name == column {
+			return true
+		}
+	}
+	return false
+}
+
+// aggregateState accumulates one output value of a group
+type aggregateState struct {
+	count    int64
+	sum      float64
+	best     interface{} // MIN/MAX so far
+	distinct map[string]bool
+}
+
+// Apply reduces rows with the given columns into one row per group
+// (a single row without GROUP BY). NULLs are ignored by every function but
+// COUNT(*). Non-numeric values fail SUM and AVG; MIN and MAX compare numbers
+// numerically and anything else as text.
+func (a *Aggregation) Apply(columns []string, rows [][]interface{}) ([]string, [][]interface{}, error) {
+	index := make(map[string]int, len(columns))
+	for i, column := range columns {
+		index[column] = i
+	}
+
+	groupIndexes := make([]int, len(a.groupBy))
+	for i, column := range a.groupBy {
+		idx, ok := index[column]
+		if !ok {
+			return nil, nil, fmt.Errorf("aggregation: unknown column '%s'", column)
+		}
+		groupIndexes[i] = idx
+	}
+	items := make([]aggregateItem, len(a.items))
+	for i, item := range a.items {
+		item.index = -1
+		if item.column != "*" {
+			idx, ok := index[item.column]
+			if !ok {
+				return nil, nil, fmt.Errorf("aggregation: unknown column '%s'", item.column)
+			}
+			item.index = idx
+		}
+		items[i] = item
+	}
+
+	type group struct {
+		key    []interface{}
+		states []*aggregateState
+	}
+	var order []*group
+	groups := make(map[string]*group)
+
+	for _, row := range rows {
+		key := make([]interface{}, len(groupIndexes))
+		for i, idx := range groupIndexes {
+			key[i] = row[idx]
+		}
+		keyString := fmt.Sprintf("%#v", key)
+
+		g, ok := groups[keyString]
+		if !ok {
+			g = &group{key: key, states: make([]*aggregateState, len(items))}
+			for i := range g.states {
+				g.states[i] = &aggregateState{distinct: make(map[string]bool)}
+			}
+			groups[keyString] = g
+			order = append(order, g)
+		}
+
+		for i, item := range items {
+			if err := g.states[i].add(item, row); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+
+	// Without GROUP BY an empty input still yields one row (COUNT = 0)
+	if len(order) == 0 && len(a.groupBy) == 0 {
+		g := &group{states: make([]*aggregateState, len(items))}
+		for i := range g.states {
+			g.states[i] = &aggregateState{distinct: make(map[string]bool)}
+		}
+		order = append(order, g)
+	}
+
+	outColumns := make([]string, len(items))
+	for i, item := range items {
+		outColumns[i] = item.alias
+	}
+
+	outRows := make([][]interface{}, 0, len(order))
+	for _, g := range order {
+		row := make([]interface{}, len(items))
+		for i, item := range items {
+			if item.function == "" {
+				for k, column := range a.groupBy {
+					if column == item.column {
+						row[i] = g.key[k]
+					}
+				}
+				continue
+			}
+			row[i] = g.states[i].result(item)
+		}
+		outRows = append(outRows, row)
+	}
+	return outColumns, outRows, nil
+}
+
+// add folds one input row into the state
+func (s *aggregateState) add(item aggregateItem, row []interface{}) error {
+	if item.function == "" {
+		return nil
+	}
+	if item.index < 0 {
+		s.count++
+		return nil
+	}
+
+	value := row[item.index]
+	if value == nil {
+		return nil
+	}
+
+	switch item.function {
+	case "COUNT":
+		if item.distinct {
+			s.distinct[fmt.Sprintf("%#v", value)] = true
+		}
+		s.count++
+	case "SUM", "AVG":
+		number, ok := aggregateNumber(value)
+		if !ok {
+			return fmt.Errorf("aggregation: %s(%s): non-numeric value %v", item.function, item.column, value)
+		}
+		s.sum += number
+		s.count++
+	case "MIN", "MAX":
+		if s.best == nil || aggregateLess(value, s.best) == (item.function == "MIN") {
+			s.best = value
+		}
+	}
+	return nil
+}
+
+// result returns the final value of the state
+func (s *aggregateState) result(item aggregateItem) interface{} {
+	switch item.function {
+	case "COUNT":
+		if item.distinct {
+			return int64(len(s.distinct))
+		}
+		return s.count
+	case "SUM":
+		if s.count == 0 {
+			return nil
+		}
+		return s.sum
+	case "AVG":
+		if s.count == 0 {
+			return nil
+		}
+		return s.sum / float64(s.count)
+	default:
+		return s.best
+	}
+}
+
+// aggregateNumber converts a scanned value to float64
+func aggregateNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		f, err := strconv.ParseFloat(v, 64)
+		return f, err == nil
+	case []byte:
+		f, err := strconv.ParseFloat(string(v), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// aggregateLess compares numerically when both values are numbers, as text otherwise
+func aggregateLess(a, b interface{}) bool {
+	na, okA := aggregateNumber(a)
+	nb, okB := aggregateNumber(b)
+	if okA && okB {
+		return na < nb
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+// Aggregate reduces the merged rows of the fleet result with an aggregation
+// spec (see ParseAggregation). Failed devices contribute no rows.
+func (r *FleetResult) Aggregate(spec string) ([]string, [][]interface{}, error) {
+	agg, err := ParseAggregation(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	return agg.Apply(r.Columns, r.Rows)
+}
+
+// QueryAggregate runs query on every device and reduces the merged rows
+// with an aggregation spec, so fleet-wide figures are computed without
+// handing every device's rows to the caller. The FleetResult reports
+// per-device outcomes; its Rows hold the aggregated rows.
+//
+// Example:
+//
+//	result, err := fleet.QueryAggregate(ctx, deviceIDs,
+//		"SELECT status, COUNT(*) AS n FROM orders GROUP BY status",
+//		"status, SUM(n) AS total, COUNT(DISTINCT device_id) AS devices GROUP BY status")
+func (f *Fleet) QueryAggregate(ctx context.Context, deviceIDs []string, query, spec string, args ...interface{}) (*FleetResult, error) {
+	agg, err := ParseAggregation(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := f.Query(ctx, deviceIDs, query, args...)
+	if result == nil {
+		return nil, err
+	}
+
+	// Devices that all failed leave no columns to resolve the spec against
+	if result.Columns == nil {
+		result.Columns = []string{"device_id"}
+	}
+	columns, rows, aggErr := agg.Apply(result.Columns, result.Rows)
+	if aggErr != nil {
+		return result, aggErr
+	}
+	result.Columns, result.Rows = columns, rows
+	return result, err
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// PendingApproval is a request the device holds until an operator approves
+// or rejects it
+type PendingApproval struct {
+	ID              string    `json:"id"`
+	Principal       string    `json:"principal"`            // AMQP user that sent the request
+	OnBehalfOf      string    `json:"onBehalfOf,omitempty"` // End user the request runs for
+	ClientIP        string    `json:"clientIP"`
+	Query           string    `json:"query"`
+	Params          int       `json:"params"` // Number of parameters (values are not shown)
+	DetectedCommand string    `json:"detectedCommand"`
+	Risk            string    `json:"risk"`
+	Errors          []string  `json:"errors"` // Why the request needs approval
+	SubmittedAt     time.Time `json:"submittedAt"`
+	ExpiresAt       time.Time `json:"expiresAt"` // When the device rejects it if nobody decided
+}
+
+// approvalRequest is the body of an "APPROVAL:" request
+type approvalRequest struct {
+	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// PendingApprovals lists the requests waiting for an operator's approval,
+// oldest first
+func (bc *BurrowClient) PendingApprovals(ctx context.Context) ([]PendingApproval, error) {
+	rows, err := bc.approval(ctx, approvalRequest{Action: "list"})
+	if err != nil {
+		return nil, err
+	}
+	results, err := allRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := make([]PendingApproval, 0, len(results))
+	for _, row := range results {
+		approval := PendingApproval{
+			ID:              resultString(row, "id"),
+			Principal:       resultString(row, "principal"),
+			OnBehalfOf:      resultString(row, "on_behalf_of"),
+			ClientIP:        resultString(row, "client_ip"),
+			Query:           resultString(row, "query"),
+			Params:          int(resultInt(row, "params")),
+			DetectedCommand: resultString(row, "detected_command"),
+			Risk:            resultString(row, "risk"),
+		}
+		if err := json.Unmarshal([]byte(resultString(row, "errors")), &approval.Errors); err != nil {
+			return nil, fmt.Errorf("failed to parse approval errors: %w", err)
+		}
+		approval.SubmittedAt, _ = time.Parse(time.RFC3339, resultString(row, "submitted_at"))
+		approval.ExpiresAt, _ = time.Parse(time.RFC3339, resultString(row, "expires_at"))
+		pending = append(pending, approval)
+	}
+	return pending, nil
+}
+
+// ApproveRequest runs a held request; its result goes to the client that
+// sent it. The device refuses approvals from the identity that sent the
+// request, so a second operator must approve it.
+func (bc *BurrowClient) ApproveRequest(ctx context.Context, id string) error {
+	rows, err := bc.approval(ctx, approvalRequest{Action: "approve", ID: id})
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// RejectRequest answers a held request with an error carrying reason
+// instead of running it
+func (bc *BurrowClient) RejectRequest(ctx context.Context, id, reason string) error {
+	rows, err := bc.approval(ctx, approvalRequest{Action: "reject", ID: id, Reason: reason})
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
+
+// approval sends an "APPROVAL:" request
+func (bc *BurrowClient) approval(ctx context.Context, req approvalRequest) (*sql.Rows, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	return bc.db.QueryContext(ctx, "APPROVAL:"+string(body))
+}
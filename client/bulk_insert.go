@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// BulkInsertOptions tunes BulkInsert
+type BulkInsertOptions struct {
+	ChunkRows int                      // Rows sent per request (default 1000)
+	Progress  func(BulkInsertProgress) // Called after every chunk (optional)
+}
+
+// BulkInsertProgress reports the state of a BulkInsert after a chunk
+type BulkInsertProgress struct {
+	Chunk        int   // Chunks inserted so far, counting from 1
+	Chunks       int   // Total number of chunks
+	RowsInserted int64 // Rows inserted so far
+	TotalRows    int64 // Rows to insert
+	Statements   int   // INSERT statements the server used for this chunk
+}
+
+// bulkInsertRequest is the body of a "BULK:" request
+type bulkInsertRequest struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+// BulkInsert inserts rows into table in a single transaction. Every row
+// holds one value per column, in the order of columns.
+//
+// The rows travel in chunks of opts.ChunkRows; the server turns each chunk
+// into multi-row INSERT statements that fit its max_allowed_packet. All
+// chunks run in one server-side transaction: if any fails the transaction
+// is rolled back and no row is inserted. It returns the rows inserted.
+//
+// Example:
+//
+//	n, err := bc.BulkInsert(ctx, "readings", []string{"sensor", "value", "taken_at"}, rows,
+//		client.BulkInsertOptions{Progress: func(p client.BulkInsertProgress) {
+//			log.Printf("%d/%d rows", p.RowsInserted, p.TotalRows)
+//		}})
+func (bc *BurrowClient) BulkInsert(ctx context.Context, table string, columns []string, rows [][]interface{}, opts BulkInsertOptions) (int64, error) {
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("bulk insert needs at least one column")
+	}
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return 0, fmt.Errorf("bulk insert row %d has %d values for %d columns", i, len(row), len(columns))
+		}
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	if opts.ChunkRows <= 0 {
+		opts.ChunkRows = 1000
+	}
+
+	body, err := json.Marshal(bulkInsertRequest{Table: table, Columns: columns})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	tx, err := bc.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("bulk insert failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	progress := BulkInsertProgress{
+		Chunks:    (len(rows) + opts.ChunkRows - 1) / opts.ChunkRows,
+		TotalRows: int64(len(rows)),
+	}
+	for start := 0; start < len(rows); start += opts.ChunkRows {
+		end := start + opts.ChunkRows
+		if end > len(rows) {
+			end = len(rows)
+		}
+		args := make([]interface{}, 0, (end-start)*len(columns))
+		for _, row := range rows[start:end] {
+			args = append(args, row...)
+		}
+
+		result, err := tx.QueryContext(ctx, "BULK:"+string(body), args...)
+		if err != nil {
+			return 0, fmt.Errorf("bulk insert failed at row %d: %w", start, err)
+		}
+		row, err := singleRow(result)
+		if err != nil {
+			return 0, fmt.Errorf("bulk insert failed at row %d: %w", start, err)
+		}
+
+		progress.Chunk++
+		progress.RowsInserted += resultInt(row, "rows_affected")
+		progress.Statements = int(resultInt(row, "statements"))
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("bulk insert failed to commit: %w", err)
+	}
+	return progress.RowsInserted, nil
+}
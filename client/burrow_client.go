@@ -3,6 +3,7 @@
 package client
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -13,19 +14,26 @@ import (
 // BurrowClient provides an extended interface for burrowctl operations
 // with specialized methods for SQL queries, system commands, and function calls.
 type BurrowClient struct {
-	db *sql.DB
+	db     *sql.DB
+	config *DSNConfig // Kept for connections outside database/sql (event subscriptions)
 }
 
 // NewBurrowClient creates a new BurrowClient wrapping a standard sql.DB connection.
 // This provides a cleaner interface for different operation types while maintaining
 // compatibility with the existing database/sql driver.
 func NewBurrowClient(dsn string) (*BurrowClient, error) {
-	db, err := sql.Open("rabbitsql", dsn)
+	conf, err := parseDSN(dsn)
 	if err != nil {
-		return nil, fmt.Errorf("failed to open burrow connection: %w", err)
+		return nil, fmt.Errorf("failed to open burrow connection: DSN parsing failed: %w", err)
 	}
 
-	return &BurrowClient{db: db}, nil
+	return NewBurrowClientFromConnector(&Connector{config: conf}), nil
+}
+
+// NewBurrowClientFromConnector creates a BurrowClient whose connections are
+// opened by a Connector, for configurations built with NewConnector.
+func NewBurrowClientFromConnector(connector *Connector) *BurrowClient {
+	return &BurrowClient{db: sql.OpenDB(connector), config: connector.config}
 }
 
 // DB returns the underlying sql.DB instance for direct access to standard database operations.
@@ -141,6 +149,11 @@ type FunctionResult struct {
 // ExecFunction executes a custom function on the remote server.
 // This provides a cleaner interface than using db.Query("FUNCTION:...").
 func (bc *BurrowClient) ExecFunction(name string, params ...FunctionParam) (*FunctionResult, error) {
+	return bc.ExecFunctionContext(context.Background(), name, params...)
+}
+
+// ExecFunctionContext is like ExecFunction but honours ctx for cancellation and deadlines.
+func (bc *BurrowClient) ExecFunctionContext(ctx context.Context, name string, params ...FunctionParam) (*FunctionResult, error) {
 	start := time.Now()
 	
 	funcReq := FunctionRequest{
@@ -153,7 +166,7 @@ func (bc *BurrowClient) ExecFunction(name string, params ...FunctionParam) (*Fun
 		return nil, fmt.Errorf("failed to marshal function request: %w", err)
 	}
 
-	rows, err := bc.db.Query("FUNCTION:" + string(jsonData))
+	rows, err := bc.db.QueryContext(ctx, "FUNCTION:"+string(jsonData))
 	if err != nil {
 		return &FunctionResult{
 			Function:   name,
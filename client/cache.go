@@ -0,0 +1,68 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CacheInfo describes how the server's query cache handled a SQL result.
+// Request it with WithCacheInfo to forward it, e.g. as HTTP cache headers
+// from a REST gateway.
+type CacheInfo struct {
+	Cacheable bool          // The server caches this result; false for writes, transactions or a disabled cache
+	Hit       bool          // Served from the server's cache
+	Age       time.Duration // Time since the server produced the result
+	TTL       time.Duration // Time until the server's cached copy expires
+}
+
+// cacheInfoKey is the context key for the CacheInfo a query fills in.
+type cacheInfoKey struct{}
+
+// WithCacheInfo returns a context whose queries store the server's cache
+// metadata in info. The last query made with the context wins.
+//
+// Example:
+//
+//	var info client.CacheInfo
+//	rows, err := db.QueryContext(client.WithCacheInfo(r.Context(), &info), "SELECT * FROM products")
+//	...
+//	info.SetHTTPHeaders(w.Header())
+func WithCacheInfo(ctx context.Context, info *CacheInfo) context.Context {
+	return context.WithValue(ctx, cacheInfoKey{}, info)
+}
+
+// recordCacheInfo copies the response's cache metadata into the CacheInfo
+// requested through ctx, if any.
+func recordCacheInfo(ctx context.Context, resp RPCResponse) {
+	info, ok := ctx.Value(cacheInfoKey{}).(*CacheInfo)
+	if !ok || info == nil {
+		return
+	}
+	*info = CacheInfo{}
+	if resp.Cache != nil {
+		info.Cacheable = true
+		info.Hit = resp.Cache.Hit
+		info.Age = time.Duration(resp.Cache.AgeMs) * time.Millisecond
+		info.TTL = time.Duration(resp.Cache.TTLMs) * time.Millisecond
+	}
+}
+
+// SetHTTPHeaders sets Cache-Control, Age and X-Cache so downstream HTTP
+// caches and browsers keep the result no longer than the server does.
+// Results the server does not cache are marked no-store.
+func (ci CacheInfo) SetHTTPHeaders(header http.Header) {
+	if !ci.Cacheable {
+		header.Set("Cache-Control", "no-store")
+		return
+	}
+
+	header.Set("Cache-Control", "max-age="+strconv.FormatInt(int64(ci.TTL/time.Second), 10))
+	header.Set("Age", strconv.FormatInt(int64(ci.Age/time.Second), 10))
+	if ci.Hit {
+		header.Set("X-Cache", "HIT")
+	} else {
+		header.Set("X-Cache", "MISS")
+	}
+}
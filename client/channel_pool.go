@@ -0,0 +1,316 @@
+package client
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DefaultChannelPoolSize is the number of idle AMQP channels a connection
+// keeps for reuse when the DSN does not set channel_pool_size.
+const DefaultChannelPoolSize = 4
+
+// directReplyTo is RabbitMQ's pseudo-queue for replies sent straight to the
+// consumer on the requesting channel, without declaring a queue
+const directReplyTo = "amq.rabbitmq.reply-to"
+
+// pooledChannel is an AMQP channel kept open between requests. Its close and
+// return notifications are registered once, when the channel is opened, so
+// reusing it does not pile up listeners.
+type pooledChannel struct {
+	*amqp.Channel
+	conn     *amqp.Connection     // Connection the channel was opened on
+	lost     chan struct{}        // Closed when the channel is closed
+	closeErr *amqp.Error          // Why the broker closed the channel (nil if the client did); set before lost is closed
+	returns  chan amqp.Return     // Mandatory publishes the broker could not route
+	replies  <-chan amqp.Delivery // Direct reply-to responses (nil: use the connection's reply queue)
+}
+
+// openPooledChannel opens a channel on conn for the pool. With direct set,
+// the channel consumes the direct reply-to pseudo-queue; a broker that
+// refuses it gets a plain channel and unsupported is true.
+func openPooledChannel(conn *amqp.Connection, direct bool) (pc *pooledChannel, unsupported bool, err error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, false, err
+	}
+
+	var replies <-chan amqp.Delivery
+	if direct {
+		replies, err = ch.Consume(directReplyTo, "", true, false, false, false, nil)
+		if err != nil {
+			// The broker closes the channel when it refuses the consumer
+			unsupported = true
+			ch.Close()
+			if ch, err = conn.Channel(); err != nil {
+				return nil, true, err
+			}
+			replies = nil
+		}
+	}
+
+	pc = &pooledChannel{
+		Channel: ch,
+		conn:    conn,
+		lost:    make(chan struct{}),
+		returns: ch.NotifyReturn(make(chan amqp.Return, 4)),
+		replies: replies,
+	}
+	go pc.watch(ch.NotifyClose(make(chan *amqp.Error, 1)))
+	return pc, unsupported, nil
+}
+
+// watch records why the channel closed and closes lost. The library sends
+// at most one error and then closes closed.
+func (pc *pooledChannel) watch(closed <-chan *amqp.Error) {
+	for err := range closed {
+		pc.closeErr = err
+	}
+	close(pc.lost)
+}
+
+// healthy reports whether the channel is still open on conn
+func (pc *pooledChannel) healthy(conn *amqp.Connection) bool {
+	if pc.conn != conn || pc.IsClosed() {
+		return false
+	}
+	select {
+	case <-pc.lost:
+		return false
+	default:
+		return true
+	}
+}
+
+// drain discards returns and late responses of earlier requests
+func (pc *pooledChannel) drain(pending *pendingRequests) {
+	for {
+		select {
+		case <-pc.returns:
+		case msg := <-pc.replies:
+			pending.discard(msg)
+		default:
+			return
+		}
+	}
+}
+
+// acquireChannel returns an open channel on the current connection, reusing
+// an idle one from the pool when there is a healthy one. Give it back with
+// releaseChannel.
+func (cm *ConnectionManager) acquireChannel() (*pooledChannel, error) {
+	conn, err := cm.GetConnection()
+	if err != nil {
+		return nil, fmt.Errorf("no active connection: %v", err)
+	}
+
+	for {
+		select {
+		case pc := <-cm.channels:
+			if pc.healthy(conn) {
+				pc.drain(cm.pending)
+				atomic.AddInt64(&cm.channelsReused, 1)
+				return pc, nil
+			}
+			pc.Close()
+		default:
+			pc, unsupported, err := openPooledChannel(conn, atomic.LoadInt32(&cm.directReplies) == 1)
+			if unsupported && atomic.CompareAndSwapInt32(&cm.directReplies, 1, 0) {
+				cm.logf("Broker does not support direct reply-to, using a reply queue")
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to create RabbitMQ channel: %v", err)
+			}
+			atomic.AddInt64(&cm.channelsOpened, 1)
+			return pc, nil
+		}
+	}
+}
+
+// releaseChannel puts a channel back into the pool. Channels the broker
+// closed, channels of an old connection and channels beyond the pool size
+// are closed instead.
+func (cm *ConnectionManager) releaseChannel(pc *pooledChannel) {
+	conn, err := cm.GetConnection()
+	if err != nil || !pc.healthy(conn) {
+		pc.Close()
+		return
+	}
+	select {
+	case cm.channels <- pc:
+	default:
+		pc.Close()
+	}
+}
+
+// drainChannels closes every idle channel of the pool
+func (cm *ConnectionManager) drainChannels() {
+	for {
+		select {
+		case pc := <-cm.channels:
+			pc.Close()
+		default:
+			return
+		}
+	}
+}
+
+// replyQueue is the exclusive queue that receives the responses to every
+// request of a connection. One consumer hands each response to the request
+// waiting for its correlation ID; responses nobody waits for any more (the
+// request timed out) are discarded by the pending-request registry.
+type replyQueue struct {
+	name    string           // Server-named queue to put in ReplyTo
+	conn    *amqp.Connection // Connection the queue was declared on
+	ch      *amqp.Channel    // Channel consuming the queue
+	pending *pendingRequests // Requests waiting for a response
+
+	done chan struct{} // Closed when the consumer stops (channel or connection closed)
+}
+
+// newReplyQueue declares a reply queue on conn and starts consuming it
+func newReplyQueue(conn *amqp.Connection, pending *pendingRequests) (*replyQueue, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	msgs, err := ch.Consume(queue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	rq := &replyQueue{
+		name:    queue.Name,
+		conn:    conn,
+		ch:      ch,
+		pending: pending,
+		done:    make(chan struct{}),
+	}
+	go rq.dispatch(msgs)
+	return rq, nil
+}
+
+// dispatch hands every response to the request waiting for it
+func (rq *replyQueue) dispatch(msgs <-chan amqp.Delivery) {
+	defer close(rq.done)
+	for msg := range msgs {
+		rq.pending.dispatch(msg)
+	}
+}
+
+// alive reports whether the queue is still consumed on conn
+func (rq *replyQueue) alive(conn *amqp.Connection) bool {
+	if rq.conn != conn {
+		return false
+	}
+	select {
+	case <-rq.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// currentReplyQueue returns the reply queue of the current connection, declaring it
+// on first use and again after a reconnect or a channel failure.
+func (cm *ConnectionManager) currentReplyQueue() (*replyQueue, error) {
+	conn, err := cm.GetConnection()
+	if err != nil {
+		return nil, fmt.Errorf("no active connection: %v", err)
+	}
+
+	cm.replyMutex.Lock()
+	defer cm.replyMutex.Unlock()
+
+	if cm.replies != nil && cm.replies.alive(conn) {
+		return cm.replies, nil
+	}
+	if cm.replies != nil {
+		cm.replies.ch.Close()
+	}
+
+	replies, err := newReplyQueue(conn, cm.pending)
+	if err != nil {
+		cm.replies = nil
+		return nil, ExplainAMQPError(err, cm.connConfig.AMQPURL)
+	}
+	cm.replies = replies
+	cm.logf("Reply queue declared: %s", replies.name)
+	return replies, nil
+}
+
+// requestChannel is where a request is published and where its response,
+// the broker's refusal to route it, or the loss of the channel show up
+type requestChannel struct {
+	*amqp.Channel                      // Publishes the request
+	replyTo       string               // ReplyTo of the request
+	msgs          <-chan amqp.Delivery // Delivers the response (and, for a direct reply-to channel of its own, late ones of earlier requests)
+	returns       <-chan amqp.Return   // Delivers the request back if a mandatory publish could not be routed
+	lost          <-chan struct{}      // Closed when the channel is closed
+	closeErr      func() *amqp.Error   // Why the broker closed the channel, once lost is closed
+	done          <-chan struct{}      // Closed if the reply queue stops (nil for direct reply-to)
+	corrID        string               // Correlation ID of the request
+	pending       *pendingRequests     // Registry the request is recorded in
+	release       func()               // Gives the channel back
+}
+
+// accept reports whether msg, received on msgs, is for this request.
+// Responses to other requests are discarded.
+func (r *requestChannel) accept(msg amqp.Delivery) bool {
+	return r.pending.accept(r.corrID, msg)
+}
+
+// close stops waiting for the response and gives the channel back
+func (r *requestChannel) close() {
+	r.pending.forget(r.corrID)
+	r.release()
+}
+
+// openRequest records the request for corrID in the pending-request
+// registry and returns the channel to publish it on. With multiplexing,
+// every request shares the connection's channel and its single consumer;
+// otherwise the request borrows a channel from the pool, which receives the
+// response itself when it consumes direct reply-to, and the response
+// arrives on the connection's reply queue when it does not.
+func (cm *ConnectionManager) openRequest(corrID string) (*requestChannel, error) {
+	if cm.connConfig.Multiplex {
+		return cm.openMuxRequest(corrID)
+	}
+
+	pc, err := cm.acquireChannel()
+	if err != nil {
+		return nil, err
+	}
+	r := &requestChannel{
+		Channel:  pc.Channel,
+		returns:  pc.returns,
+		lost:     pc.lost,
+		closeErr: func() *amqp.Error { return pc.closeErr },
+		corrID:   corrID,
+		pending:  cm.pending,
+		release:  func() { cm.releaseChannel(pc) },
+	}
+	if pc.replies != nil {
+		cm.pending.register(corrID, false)
+		r.replyTo = directReplyTo
+		r.msgs = pc.replies
+		return r, nil
+	}
+
+	replies, err := cm.currentReplyQueue()
+	if err != nil {
+		cm.releaseChannel(pc)
+		return nil, fmt.Errorf("failed to declare reply queue: %w", err)
+	}
+	r.replyTo = replies.name
+	r.msgs = cm.pending.register(corrID, true).msgs
+	r.done = replies.done
+	return r, nil
+}
@@ -0,0 +1,70 @@
+package client
+
+import "database/sql/driver"
+
+// CapabilityColumnar is the request capability asking the server for SQL
+// results in column-major layout. Servers without it ignore the capability
+// and send rows, which are decoded as before.
+const CapabilityColumnar = "columnar"
+
+// rpcColumnar is the wire form of a result in column-major layout
+type rpcColumnar struct {
+	Count   int                 `json:"count"`
+	Columns []rpcColumnarValues `json:"columns"`
+}
+
+// rpcColumnarValues is the wire form of the values of one column: the array
+// named by Kind holds them, with zero values at the NULL rows in Nulls
+type rpcColumnarValues struct {
+	Kind   string        `json:"kind"` // "int", "float", "text" or "any"
+	Ints   []int64       `json:"ints,omitempty"`
+	Floats []float64     `json:"floats,omitempty"`
+	Texts  []string      `json:"texts,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+	Nulls  []int         `json:"nulls,omitempty"`
+}
+
+// rowCount returns the number of rows of a response in either layout
+func (resp RPCResponse) rowCount() int {
+	if resp.Columnar != nil {
+		return resp.Columnar.Count
+	}
+	return len(resp.Rows)
+}
+
+// nextColumnar fills dest with row r.pos of a columnar result. NULL rows are
+// found by walking each column's Nulls alongside the rows.
+func (r *Rows) nextColumnar(dest []driver.Value) {
+	if r.nullPos == nil {
+		r.nullPos = make([]int, len(r.columnar.Columns))
+	}
+
+	for i := range r.columnar.Columns {
+		if i >= len(dest) {
+			break
+		}
+		column := &r.columnar.Columns[i]
+		if n := r.nullPos[i]; n < len(column.Nulls) && column.Nulls[n] == r.pos {
+			r.nullPos[i]++
+			dest[i] = nil
+			continue
+		}
+
+		dbType := ""
+		if i < len(r.types) {
+			dbType = r.types[i].DatabaseType
+		}
+		switch {
+		case column.Kind == "int" && r.pos < len(column.Ints):
+			dest[i] = column.Ints[r.pos]
+		case column.Kind == "float" && r.pos < len(column.Floats):
+			dest[i] = column.Floats[r.pos]
+		case column.Kind == "text" && r.pos < len(column.Texts):
+			dest[i] = r.convertTypedValue(column.Texts[r.pos], dbType)
+		case r.pos < len(column.Values):
+			dest[i] = r.convertTypedValue(column.Values[r.pos], dbType)
+		default:
+			dest[i] = nil
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package client
 
 import (
+	"bytes"
 	"context"
 	"database/sql/driver"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,7 +30,9 @@ import (
 // - Heartbeat manager for connection monitoring
 type Conn struct {
 	deviceID       string             // Target device/server identifier
-	connMgr        *ConnectionManager // Connection manager with automatic reconnection
+	topology       Topology           // Queue and exchange names for the device
+	connMgr        *ConnectionManager // Connection manager with automatic reconnection (nil with a Transport)
+	transport      Transport          // Transport for non-RabbitMQ brokers (nil for amqp://)
 	config         *DSNConfig         // Parsed DSN configuration
 	currentTx      *Tx                // Current active transaction (if any)
 	transactionMux sync.RWMutex       // Mutex for transaction state
@@ -34,7 +40,9 @@ type Conn struct {
 	// Heartbeat management
 	heartbeatManager *HeartbeatManager // Heartbeat manager for connection monitoring
 	rpcActive        bool              // Whether RPC is currently active
+	sessionBound     bool              // The server tracks the session by this connection's heartbeats: keep them on
 	rpcMutex         sync.RWMutex      // Mutex for RPC state
+	pings            *pingResponder    // Answers server pings (nil unless the DSN sets server_pings)
 }
 
 // logf provides conditional debug logging based on the configuration.
@@ -45,10 +53,74 @@ type Conn struct {
 //   - args: Arguments for the format string
 func (c *Conn) logf(format string, args ...interface{}) {
 	if c.config != nil && c.config.Debug {
-		log.Printf("[client debug] "+format, args...)
+		log.Printf("[client debug] %s", Redact(fmt.Sprintf(format, args...)))
 	}
 }
 
+// loggedQuery returns a query as debug logs show it: with its literal
+// values masked when the DSN has redact_queries
+func (c *Conn) loggedQuery(query string) string {
+	if c.config != nil && c.config.RedactQueries {
+		return RedactQuery(query)
+	}
+	return query
+}
+
+// principal returns the AMQP user to send as the message user_id, which the
+// broker checks against the authenticated user so the server can rely on it
+// for access control and impersonation. It is empty when the connection
+// authenticates through a custom SASL mechanism, as the user is then unknown.
+func (c *Conn) principal() string {
+	if c.config.Username != "" {
+		return c.config.Username
+	}
+	if c.config.AMQPConfig != nil && len(c.config.AMQPConfig.SASL) > 0 {
+		return ""
+	}
+	return amqpUser(c.config.AMQPURL)
+}
+
+// deliveryMode returns the delivery mode requests are published with
+func (c *Conn) deliveryMode() uint8 {
+	if c.config.Persistent {
+		return amqp.Persistent
+	}
+	return amqp.Transient
+}
+
+// requestTTL returns how long a request may wait in the device queue, so a
+// request that sits there while the device is offline expires instead of
+// executing long after the client gave up. Without a DSN request_ttl the
+// remaining time until the ctx deadline is used; requests without a
+// deadline do not expire (0).
+func (c *Conn) requestTTL(ctx context.Context) time.Duration {
+	ttl := c.config.RequestTTL
+	if ttl < 0 {
+		return 0
+	}
+	if ttl == 0 {
+		deadline, ok := ctx.Deadline()
+		if !ok {
+			return 0
+		}
+		ttl = time.Until(deadline)
+	}
+	if ttl < time.Millisecond {
+		ttl = time.Millisecond
+	}
+	return ttl
+}
+
+// expiration returns the request TTL as an AMQP per-message expiration in
+// milliseconds (empty: no expiration)
+func (c *Conn) expiration(ctx context.Context) string {
+	ttl := c.requestTTL(ctx)
+	if ttl == 0 {
+		return ""
+	}
+	return strconv.FormatInt(ttl.Milliseconds(), 10)
+}
+
 // Prepare implements the driver.Conn interface and creates a prepared statement.
 // Prepared statements provide performance benefits and security through parameter binding.
 // The statement can be executed multiple times with different parameters.
@@ -60,7 +132,7 @@ func (c *Conn) logf(format string, args ...interface{}) {
 //   - driver.Stmt: Prepared statement ready for execution
 //   - error: Any error that occurred during statement preparation
 func (c *Conn) Prepare(query string) (driver.Stmt, error) {
-	c.logf("Preparing statement: %s", query)
+	c.logf("Preparing statement: %s", c.loggedQuery(query))
 
 	// Count parameter placeholders for validation
 	numInput := countPlaceholders(query)
@@ -72,6 +144,26 @@ func (c *Conn) Prepare(query string) (driver.Stmt, error) {
 		closed:   false,
 	}
 
+	// Register SQL statements on the server so executions only send the
+	// handle and the parameters. Servers that cannot keep statements get
+	// the full query on every execution, as with protocol version 1.
+	if cmdType, _ := parseCommand(query); cmdType == "sql" && !c.legacyProtocol() {
+		ctx, cancel := context.WithTimeout(context.Background(), c.config.Timeout)
+		defer cancel()
+
+		handle, err := c.prepareRemote(ctx, query)
+		if err != nil {
+			var validationErr *ValidationError
+			if errors.As(err, &validationErr) {
+				return nil, err
+			}
+			c.logf("Server-side prepare failed, sending the full query on each execution: %v", err)
+		} else {
+			stmt.handle = handle
+			c.logf("Statement registered on the server as %s", handle)
+		}
+	}
+
 	c.logf("Statement prepared with %d parameters", numInput)
 	return stmt, nil
 }
@@ -89,7 +181,13 @@ func (c *Conn) Close() error {
 	if c.heartbeatManager != nil {
 		c.heartbeatManager.Stop()
 	}
+	if c.pings != nil {
+		c.pings.Stop()
+	}
 
+	if c.transport != nil {
+		return c.transport.Close()
+	}
 	return c.connMgr.Close()
 }
 
@@ -105,7 +203,11 @@ func (c *Conn) Begin() (driver.Tx, error) {
 
 	// Check if there's already an active transaction
 	if c.currentTx != nil && c.currentTx.IsActive() {
-		return nil, fmt.Errorf("transaction already in progress")
+		return nil, &TxError{
+			Code:          TxErrInProgress,
+			TransactionID: c.currentTx.GetTransactionID(),
+			Message:       "transaction already in progress",
+		}
 	}
 
 	c.logf("Starting new transaction")
@@ -116,7 +218,8 @@ func (c *Conn) Begin() (driver.Tx, error) {
 	// Send BEGIN command to server
 	err := tx.executeTransactionCommand("BEGIN")
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin transaction: %v", err)
+		tx.cancel()
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 
 	c.currentTx = tx
@@ -135,7 +238,7 @@ func (c *Conn) Begin() (driver.Tx, error) {
 //   - driver.Rows: Result set from the query
 //   - error: Any error that occurred during query execution
 func (c *Conn) Query(query string, args []driver.Value) (driver.Rows, error) {
-	c.logf("Executing query: %s with %d parameters", query, len(args))
+	c.logf("Executing query: %s with %d parameters", c.loggedQuery(query), len(args))
 
 	// Convert driver.Value to driver.NamedValue for consistency
 	namedArgs := make([]driver.NamedValue, len(args))
@@ -163,7 +266,7 @@ func (c *Conn) Query(query string, args []driver.Value) (driver.Rows, error) {
 //   - driver.Rows: Result set from the query
 //   - error: Any error that occurred during query execution
 func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
-	c.logf("Executing query with context: %s with %d parameters", query, len(args))
+	c.logf("Executing query with context: %s with %d parameters", c.loggedQuery(query), len(args))
 
 	// Execute query through RPC with heartbeat activation
 	return c.queryRPCWithHeartbeat(ctx, query, args)
@@ -206,19 +309,54 @@ func getOutboundIP() string {
 //   - "SELECT * FROM users" → ("sql", "SELECT * FROM users")
 //   - "FUNCTION:{"name":"test"}" → ("function", "{"name":"test"}")
 //   - "COMMAND:ls -la" → ("command", "ls -la")
+//   - "JOB:{"kind":"command","command":"backup.sh"}" → ("job", "{...}")
+//   - "FILE.GET:{"path":"/var/log/app.log"}" → ("file.get", "{...}")
+//   - "LOG.TAIL:{"tailID":"...","unit":"nginx.service"}" → ("log.tail", "{...}")
+//   - "BULK:{"table":"events","columns":["a","b"]}" → ("bulk", "{...}")
+//   - "EXPORT:{"exportID":"...","query":"SELECT ..."}" → ("export", "{...}")
+//   - "CURSOR:{"query":"SELECT ...","pageSize":100}" → ("cursor", "{...}")
+//   - "SCRIPT:CREATE TABLE a (...); INSERT INTO a ..." → ("script", "CREATE TABLE ...")
+//   - "MIGRATE:{"action":"apply","migrations":[...]}" → ("migrate", "{...}")
+//   - "EXPLAIN:SELECT * FROM users WHERE id = ?" → ("explain", "SELECT ...")
+//   - "VALIDATE:DELETE FROM users; SELECT ..." → ("validate", "DELETE ...")
+//   - "APPROVAL:{"action":"approve","id":"apr_..."}" → ("approval", "{...}")
+//   - "PREPARE:SELECT * FROM users WHERE id = ?" → ("prepare", "SELECT ...")
+//   - "DEALLOCATE:stmt_..." → ("deallocate", "stmt_...")
 func parseCommand(query string) (cmdType string, actualQuery string) {
-	// Check for function call prefix
-	if len(query) > 9 && query[:9] == "FUNCTION:" {
-		return "function", query[9:]
-	}
-	// Check for system command prefix
-	if len(query) > 8 && query[:8] == "COMMAND:" {
-		return "command", query[8:]
+	for _, command := range commandPrefixes {
+		if len(query) > len(command.prefix) && strings.HasPrefix(query, command.prefix) {
+			return command.cmdType, query[len(command.prefix):]
+		}
 	}
 	// Default to SQL query
 	return "sql", query
 }
 
+// commandPrefixes are the query prefixes that select a request type other
+// than SQL
+var commandPrefixes = []struct {
+	prefix  string
+	cmdType string
+}{
+	{"FUNCTION:", "function"},
+	{"COMMAND:", "command"},
+	{"SESSION:", "session"},
+	{"JOB:", "job"},
+	{"FILE.GET:", "file.get"},
+	{"FILE.PUT:", "file.put"},
+	{"LOG.TAIL:", "log.tail"},
+	{"BULK:", "bulk"},
+	{"EXPORT:", "export"},
+	{"CURSOR:", "cursor"},
+	{"SCRIPT:", "script"},
+	{"MIGRATE:", "migrate"},
+	{"EXPLAIN:", "explain"},
+	{"VALIDATE:", "validate"},
+	{"APPROVAL:", "approval"},
+	{"PREPARE:", "prepare"},
+	{"DEALLOCATE:", "deallocate"},
+}
+
 // queryRPCWithHeartbeat executes RPC with heartbeat activation
 func (c *Conn) queryRPCWithHeartbeat(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
 	// Activate heartbeat at the start of RPC
@@ -250,42 +388,32 @@ func (c *Conn) deactivateHeartbeat() {
 
 	if c.rpcActive {
 		c.rpcActive = false
-		if c.heartbeatManager != nil {
+		if c.heartbeatManager != nil && !c.sessionBound {
 			c.heartbeatManager.DeactivateHeartbeat()
 		}
 		c.logf("RPC deactivated, heartbeat disabled")
 	}
 }
 
-// queryRPC sends a query to the server via RabbitMQ RPC using separate RPC queue
+// queryRPC sends a query to the server and reports it to the registered Metrics
 func (c *Conn) queryRPC(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
-	// Get current connection from connection manager
-	conn, err := c.connMgr.GetConnection()
-	if err != nil {
-		return nil, fmt.Errorf("no active connection: %v", err)
-	}
-
-	// Create RabbitMQ channel for this query
-	ch, err := conn.Channel()
-	if err != nil {
-		return nil, fmt.Errorf("failed to create RabbitMQ channel: %v", err)
-	}
-	defer ch.Close()
-	c.logf("RabbitMQ channel opened")
-
-	// Declare exclusive reply queue for receiving response
-	replyQueue, err := ch.QueueDeclare("", false, true, true, false, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to declare reply queue: %v", err)
-	}
-	c.logf("Reply queue declared: %s", replyQueue.Name)
+	start := time.Now()
+	var roundTrip time.Duration
+	rows, err := c.sendRPC(ctx, query, args, &roundTrip)
+	cmdType, _ := parseCommand(query)
+	observeRequest(ctx, c.deviceID, cmdType, start, roundTrip, err)
+	return rows, err
+}
 
+// sendRPC sends a query to the server via RabbitMQ RPC using separate RPC
+// queue; roundTrip receives the broker roundtrip time once a response arrives
+func (c *Conn) sendRPC(ctx context.Context, query string, args []driver.NamedValue, roundTrip *time.Duration) (driver.Rows, error) {
 	// Generate unique correlation ID for request-response matching
-	corrID := fmt.Sprintf("%d", time.Now().UnixNano())
+	corrID := newCorrelationID("q")
 
 	// Parse query to determine type and extract actual command
 	cmdType, actualQuery := parseCommand(query)
-	c.logf("Detected command type: %s, actual query: %s", cmdType, actualQuery)
+	c.logf("Detected command type: %s, actual query: %s", cmdType, c.loggedQuery(actualQuery))
 
 	// Build RPC request message
 	req := map[string]interface{}{
@@ -296,26 +424,210 @@ func (c *Conn) queryRPC(ctx context.Context, query string, args []driver.NamedVa
 		"clientIP": getOutboundIP(),   // Client IP for logging
 	}
 
+	// Options added after protocol version 1 are left out in compatibility
+	// mode, so the request looks exactly like one from an older client
+	if c.legacyProtocol() {
+		if feature, ok := v2RequestTypes[cmdType]; ok {
+			return nil, errRequiresV2(feature)
+		}
+	} else {
+		req["protocolVersion"] = c.config.ProtocolVersion
+
+		// Interim notifications arrive on the RabbitMQ reply queue only
+		if progressFunc(ctx) != nil && c.transport == nil {
+			req["progress"] = true
+		}
+
+		// Execute a server-side prepared statement by handle
+		if id, ok := statementIDFromContext(ctx); ok {
+			req["statementID"] = id
+			if cmdType == "sql" {
+				req["query"] = ""
+			}
+		}
+
+		// Ask for affected rows instead of a result set
+		if exec, ok := execFromContext(ctx); ok && cmdType == "sql" {
+			req["exec"] = true
+			if len(exec.batch) > 0 {
+				req["batch"] = exec.batch
+			}
+		}
+
+		// Identify the session whose settings the server applies
+		if c.config.SessionID != "" {
+			req["sessionID"] = c.config.SessionID
+		}
+
+		// Attach the request priority (context overrides the DSN default)
+		if priority, ok := priorityFromContext(ctx); ok {
+			req["priority"] = priority
+		} else if c.config.Priority != "" {
+			req["priority"] = c.config.Priority
+		}
+
+		// Attach the end user the request runs for (context overrides the DSN default)
+		onBehalfOf := c.config.OnBehalfOf
+		if user, ok := onBehalfOfFromContext(ctx); ok {
+			onBehalfOf = user
+		}
+		if onBehalfOf != "" {
+			req["onBehalfOf"] = onBehalfOf
+		}
+
+		// Label the request for correlation in the server's logs
+		if tag, ok := requestTagFromContext(ctx); ok {
+			req["tag"] = tag
+		}
+
+		// Present the client's token for the server to authenticate
+		token, err := c.token(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get token: %w", err)
+		}
+		if token != "" {
+			req["token"] = token
+		}
+
+		// Stamp the request so the server can reject replays of it
+		req["nonce"] = newNonce()
+		req["timestamp"] = time.Now().UnixMilli()
+
+		// Ask for column types to decode values by
+		if c.config.NativeTypes && cmdType == "sql" {
+			req["columnTypes"] = true
+
+			// Offer to take the rows column-major
+			if c.config.Columnar {
+				req["capabilities"] = []string{CapabilityColumnar}
+			}
+		}
+	}
+
 	// Include transaction information if we're in a transaction
 	c.transactionMux.RLock()
-	if c.currentTx != nil && c.currentTx.IsActive() {
-		req["transactionID"] = c.currentTx.GetTransactionID()
-		c.logf("Query executing in transaction: %s", c.currentTx.GetTransactionID())
-	}
+	activeTx := c.currentTx
 	c.transactionMux.RUnlock()
+	if activeTx != nil && activeTx.IsActive() {
+		req["transactionID"] = activeTx.GetTransactionID()
+		if !c.legacyProtocol() {
+			req["sequence"] = activeTx.nextSequence()
+		}
+		c.logf("Query executing in transaction: %s", activeTx.GetTransactionID())
+	} else {
+		activeTx = nil
+	}
 
 	// Serialize request to JSON
-	body, _ := json.Marshal(req)
+	body, err := c.marshalRequest(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to serialize request: %w", err)
+	}
 
+	// Send the request and wait for the response
 	startRT := time.Now()
+	var respBody []byte
+	if c.transport != nil {
+		respBody, err = c.requestTransport(ctx, corrID, body)
+	} else {
+		respBody, err = c.requestAMQP(ctx, corrID, body, activeTx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Response received
+	rt := time.Since(startRT)
+	*roundTrip = rt
+	c.logf("Roundtrip time: %v", rt)
+
+	// Parse server response; numbers stay exact until their column type is known
+	var resp RPCResponse
+	decoder := json.NewDecoder(bytes.NewReader(respBody))
+	decoder.UseNumber()
+	if err := decoder.Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to parse server response: %v", err)
+	}
+
+	// Rejected requests report the budget too
+	recordRateLimitInfo(ctx, resp)
+
+	// Check for server-side errors
+	if resp.Error != "" {
+		if resp.ErrorCode == ErrCodeRateLimited {
+			return nil, rateLimitError(resp)
+		}
+		if resp.ErrorCode == ErrCodeOverloaded {
+			return nil, overloadedError(resp)
+		}
+		if isTxCode(resp.ErrorCode) {
+			txErr := &TxError{Code: resp.ErrorCode, Message: resp.Error}
+			if activeTx != nil {
+				txErr.TransactionID = activeTx.GetTransactionID()
+				// The server lost the transaction: stop sending statements to it
+				if isTerminalTxCode(resp.ErrorCode) {
+					activeTx.markFailed()
+					c.clearFinishedTransaction()
+				}
+			}
+			return nil, txErr
+		}
+		if resp.ErrorCode == ErrCodeValidationFailed && resp.Validation != nil {
+			return nil, validationError(resp)
+		}
+		if isStatementCode(resp.ErrorCode) {
+			return nil, &statementError{code: resp.ErrorCode, message: resp.Error}
+		}
+		return nil, fmt.Errorf("server error: %s", resp.Error)
+	}
+
+	// Return successful result set
+	recordCacheInfo(ctx, resp)
+	recordTruncationInfo(ctx, resp)
+	recordCursorInfo(ctx, resp)
+	c.logf("Response received with %d rows", resp.rowCount())
+	if resp.Truncated {
+		c.logf("Result truncated by the server: %d of %d rows", resp.rowCount(), resp.TotalRows)
+	}
+	rows := &Rows{columns: resp.Columns, rows: resp.Rows, columnar: resp.Columnar, types: resp.ColumnTypes}
+	if c.config.ParseTime {
+		rows.loc = c.config.Location
+	}
+	if resp.Result != nil {
+		rows.result = &Result{affectedRows: resp.Result.RowsAffected, lastInsertID: resp.Result.LastInsertID}
+	}
+	return rows, nil
+}
+
+// requestAMQP publishes a request to the device RPC queue on a pooled
+// RabbitMQ channel and waits for the response body
+func (c *Conn) requestAMQP(ctx context.Context, corrID string, body []byte, activeTx *Tx) ([]byte, error) {
+	// Get the RabbitMQ channel to publish on, shared or from the pool
+	ch, err := c.connMgr.openRequest(corrID)
+	if err != nil {
+		return nil, err
+	}
+	defer ch.close()
+	c.logf("RabbitMQ channel acquired")
 	c.logf("Publishing query to device RPC queue '%s'", c.deviceID)
 
-	// Publish query to device-specific RPC queue (separate from heartbeat)
-	rpcQueueName := fmt.Sprintf("device_%s_rpc", c.deviceID)
-	err = ch.PublishWithContext(ctx, "", rpcQueueName, false, false, amqp.Publishing{
+	// Publish query to device-specific RPC queue (separate from heartbeat).
+	// Statements of a transaction go to the server instance holding it.
+	rpcQueueName := c.topology.RPCQueue
+	var returns <-chan amqp.Return
+	if activeTx != nil {
+		if instance := activeTx.serverInstance(); instance != "" {
+			rpcQueueName = c.topology.InstanceQueue(instance)
+			returns = ch.returns
+		}
+	}
+	err = ch.PublishWithContext(ctx, "", rpcQueueName, returns != nil, false, amqp.Publishing{
 		ContentType:   "application/json", // JSON content type
+		DeliveryMode:  c.deliveryMode(),   // Persistent when the DSN asks for it
+		Expiration:    c.expiration(ctx),  // Discarded by the broker if not consumed in time
 		CorrelationId: corrID,             // For matching request/response
-		ReplyTo:       replyQueue.Name,    // Where to send the response
+		ReplyTo:       ch.replyTo,         // Where to send the response
+		UserId:        c.principal(),      // Broker-validated identity of the client
 		Body:          body,               // Serialized request
 	})
 	if err != nil {
@@ -323,42 +635,60 @@ func (c *Conn) queryRPC(ctx context.Context, query string, args []driver.NamedVa
 	}
 	c.logf("Query published to RPC queue, waiting for response...")
 
-	// Start consuming from reply queue
-	msgs, err := ch.Consume(replyQueue.Name, "", true, true, false, false, nil)
-	if err != nil {
-		return nil, fmt.Errorf("failed to consume from reply queue: %v", err)
-	}
-
-	// Wait for response or timeout
-	select {
-	case <-ctx.Done():
-		// Context cancelled or timed out
-		return nil, fmt.Errorf("timeout (%v) waiting for device response from '%s'\nPlease check:\n- Server is running and responding\n- Device ID '%s' is correct\n- Database is accessible", c.config.Timeout, c.deviceID, c.deviceID)
-	case msg := <-msgs:
-		// Response received
-		rt := time.Since(startRT)
-		c.logf("RabbitMQ roundtrip time: %v", rt)
-
-		// Validate correlation ID to ensure response matches request
-		if msg.CorrelationId != corrID {
-			return nil, fmt.Errorf("correlation id mismatch: expected %s, got %s", corrID, msg.CorrelationId)
-		}
-
-		// Parse server response
-		var resp RPCResponse
-		if err := json.Unmarshal(msg.Body, &resp); err != nil {
-			return nil, fmt.Errorf("failed to parse server response: %v", err)
+	// Wait for response or timeout. The broker closes the channel instead of
+	// answering when the publish is refused (e.g. ACCESS_REFUSED in a tenant
+	// vhost), so report that immediately rather than waiting for the timeout.
+	for {
+		select {
+		case <-returns:
+			// The instance queue is gone, and with it the instance holding the transaction
+			activeTx.markFailed()
+			c.clearFinishedTransaction()
+			return nil, activeTx.instanceGoneError()
+		case <-ch.lost:
+			closeErr := ch.closeErr()
+			if closeErr == nil {
+				return nil, fmt.Errorf("RabbitMQ channel closed while waiting for device response")
+			}
+			return nil, fmt.Errorf("RabbitMQ closed the channel while querying device '%s': %w",
+				c.deviceID, ExplainAMQPError(closeErr, c.config.AMQPURL))
+		case <-ch.done:
+			return nil, fmt.Errorf("reply queue closed while waiting for device response")
+		case <-ctx.Done():
+			// Context cancelled or timed out
+			return nil, fmt.Errorf("timeout (%v) waiting for device response from '%s'\nPlease check:\n- Server is running and responding\n- Device ID '%s' is correct\n- Database is accessible", c.config.Timeout, c.deviceID, c.deviceID)
+		case msg := <-ch.msgs:
+			// Direct reply-to channels may still receive responses to
+			// earlier requests that timed out
+			if !ch.accept(msg) {
+				continue
+			}
+			if msg.Type == progressMessageType {
+				reportProgress(progressFunc(ctx), msg.Body)
+				continue
+			}
+			c.recordActivity()
+			return msg.Body, nil
 		}
+	}
+}
 
-		// Check for server-side errors
-		if resp.Error != "" {
-			return nil, fmt.Errorf("server error: %s", resp.Error)
+// requestTransport sends a request to the device RPC queue through the
+// Transport selected by the DSN and waits for the response body
+func (c *Conn) requestTransport(ctx context.Context, corrID string, body []byte) ([]byte, error) {
+	c.logf("Sending query to device RPC queue '%s'", c.topology.RPCQueue)
+	reply, err := c.transport.Request(ctx, c.topology.RPCQueue, Message{
+		CorrelationID: corrID,
+		Body:          body,
+		TTL:           c.requestTTL(ctx),
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, fmt.Errorf("timeout (%v) waiting for device response from '%s'\nPlease check:\n- Server is running and responding\n- Device ID '%s' is correct\n- Database is accessible", c.config.Timeout, c.deviceID, c.deviceID)
 		}
-
-		// Return successful result set
-		c.logf("Response received with %d rows", len(resp.Rows))
-		return &Rows{columns: resp.Columns, rows: resp.Rows}, nil
+		return nil, fmt.Errorf("failed to query device '%s': %w", c.deviceID, err)
 	}
+	return reply.Body, nil
 }
 
 // argsToSlice converts driver.NamedValue arguments to a plain interface{} slice.
@@ -391,17 +721,46 @@ func (c *Conn) clearFinishedTransaction() {
 
 // setupHeartbeat initializes the heartbeat manager
 func (c *Conn) setupHeartbeat() {
-	if c.config.HeartbeatEnabled {
+	// Transports keep their connections alive themselves
+	if c.config.HeartbeatEnabled && c.transport == nil {
 		c.heartbeatManager = NewHeartbeatManager(
 			c.connMgr,
 			c.deviceID,
 			getOutboundIP(),
 			c.config.HeartbeatConfig,
 		)
+		c.heartbeatManager.heartbeatQueue = c.topology.HeartbeatQueue
+		if c.legacyProtocol() {
+			c.heartbeatManager.clientID = "" // Version 1 pings carry no client ID
+		}
 		c.heartbeatManager.SetCallbacks(c.handleDisconnect, c.handleReconnect)
 	}
 }
 
+// setupServerPings starts answering server pings when the DSN asks for it
+func (c *Conn) setupServerPings() {
+	if !c.config.ServerPings || c.transport != nil || c.legacyProtocol() {
+		return
+	}
+	clientID := newClientID()
+	if c.heartbeatManager != nil {
+		clientID = c.heartbeatManager.clientID
+	}
+	pings, err := newPingResponder(c, clientID)
+	if err != nil {
+		c.logf("Server pings not answered: %v", err)
+		return
+	}
+	c.pings = pings
+}
+
+// recordActivity counts an RPC response as a heartbeat
+func (c *Conn) recordActivity() {
+	if c.heartbeatManager != nil {
+		c.heartbeatManager.RecordActivity()
+	}
+}
+
 // handleDisconnect callback for heartbeat manager
 func (c *Conn) handleDisconnect(err error) {
 	c.logf("Connection considered dead: %v", err)
@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql/driver"
+	"fmt"
+	"net/url"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Config is the programmatic form of a DSN, for NewConnector. Broker
+// secrets and TLS settings are given as values, so they can come from a
+// secret store instead of being embedded in a connection string.
+type Config struct {
+	DeviceID string // Target device (required)
+	URL      string // Broker URL, e.g. "amqps://broker.example.com:5671/"; credentials may be left out (required)
+	Username string // Broker user (overrides the one in URL)
+	Password string // Broker password (overrides the one in URL)
+
+	// TLSConfig is used for amqps:// connections (nil: system roots)
+	TLSConfig *tls.Config
+
+	// AMQPConfig is the base configuration connections are dialed with:
+	// heartbeat, SASL mechanisms, client properties, dialer, ... Username,
+	// Password and TLSConfig take precedence over its SASL and
+	// TLSClientConfig.
+	AMQPConfig *amqp.Config
+
+	// TokenSource supplies the token, such as a JWT, presented with every
+	// request; it supersedes the token option
+	TokenSource TokenSource
+
+	// Options holds every other setting in DSN syntax, e.g.
+	// "timeout=10s&namespace=prod.&parse_time=true"
+	Options string
+}
+
+// Connector implements the driver.Connector interface: it opens
+// connections with a configuration parsed once. Use it with sql.OpenDB.
+type Connector struct {
+	config *DSNConfig
+}
+
+// NewConnector returns a Connector for a programmatic configuration.
+//
+// Example:
+//
+//	connector, err := client.NewConnector(client.Config{
+//		DeviceID:  "my-device",
+//		URL:       "amqps://broker.example.com:5671/",
+//		Username:  "burrowctl",
+//		Password:  secrets.Get("rabbitmq-password"),
+//		TLSConfig: &tls.Config{RootCAs: pool},
+//		Options:   "timeout=10s",
+//	})
+//	db := sql.OpenDB(connector)
+func NewConnector(cfg Config) (*Connector, error) {
+	values, err := url.ParseQuery(cfg.Options)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options: %v", err)
+	}
+	if cfg.DeviceID != "" {
+		values.Set("deviceID", cfg.DeviceID)
+	}
+	if cfg.URL != "" {
+		values.Set("amqp_uri", cfg.URL)
+	}
+
+	conf, err := parseDSN(values.Encode())
+	if err != nil {
+		return nil, err
+	}
+	if !IsAMQPURL(conf.AMQPURL) && (cfg.Username != "" || cfg.Password != "" || cfg.TLSConfig != nil || cfg.AMQPConfig != nil) {
+		return nil, fmt.Errorf("credentials, TLS and AMQP settings only apply to RabbitMQ (amqp://, amqps://) connections")
+	}
+	if cfg.Username != "" {
+		conf.Username = cfg.Username
+	}
+	if cfg.Password != "" {
+		conf.Password = cfg.Password
+	}
+	conf.TLSConfig = cfg.TLSConfig
+	conf.AMQPConfig = cfg.AMQPConfig
+	if cfg.TokenSource != nil {
+		conf.TokenSource = cfg.TokenSource
+	}
+
+	return &Connector{config: conf}, nil
+}
+
+// Connect implements the driver.Connector interface and opens a connection
+func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return openConn(c.config)
+}
+
+// Driver implements the driver.Connector interface
+func (c *Connector) Driver() driver.Driver {
+	return &Driver{}
+}
+
+// amqpConfig returns the configuration RabbitMQ connections are dialed with
+func (conf *DSNConfig) amqpConfig() amqp.Config {
+	var config amqp.Config
+	if conf.AMQPConfig != nil {
+		config = *conf.AMQPConfig
+	}
+	if config.Locale == "" {
+		config.Locale = "en_US" // What amqp.Dial uses
+	}
+	if conf.Username != "" || conf.Password != "" {
+		username, password := conf.Username, conf.Password
+		if uri, err := amqp.ParseURI(conf.AMQPURL); err == nil {
+			if username == "" {
+				username = uri.Username
+			}
+			if password == "" {
+				password = uri.Password
+			}
+		}
+		config.SASL = []amqp.Authentication{&amqp.PlainAuth{Username: username, Password: password}}
+	}
+	if conf.TLSConfig != nil {
+		config.TLSClientConfig = conf.TLSConfig
+	}
+	return config
+}
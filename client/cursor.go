@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// cursorRequest is the body of a "CURSOR:" request
+type cursorRequest struct {
+	CursorID string `json:"cursorID,omitempty"`
+	Query    string `json:"query,omitempty"`
+	PageSize int    `json:"pageSize,omitempty"`
+	Close    bool   `json:"close,omitempty"`
+}
+
+// CursorPage is a page of a paginated result. Read its rows like any
+// *sql.Rows and close it; pass CursorID to FetchMore for the next page
+// unless Done.
+type CursorPage struct {
+	*sql.Rows
+	CursorID string // Server-side cursor the page was read from
+	Offset   int64  // Rows on the pages before this one
+	Done     bool   // Last page; the server has closed the cursor
+}
+
+// cursorInfoKey is the context key for the cursor metadata a query fills in
+type cursorInfoKey struct{}
+
+// recordCursorInfo copies the response's cursor metadata into the
+// CursorPage requested through ctx, if any.
+func recordCursorInfo(ctx context.Context, resp RPCResponse) {
+	page, ok := ctx.Value(cursorInfoKey{}).(*CursorPage)
+	if !ok || page == nil || resp.Cursor == nil {
+		return
+	}
+	page.CursorID = resp.Cursor.ID
+	page.Offset = resp.Cursor.Offset
+	page.Done = resp.Cursor.Done
+}
+
+// OpenCursor runs a SELECT on the device and returns the first pageSize
+// rows (0 for the server's default page size). The server keeps the result
+// set open, so following pages are read with FetchMore without LIMIT/OFFSET
+// queries that rescan the skipped rows. Cursors not fetched within the
+// server's idle timeout (default 1m) are closed; close abandoned ones with
+// CloseCursor.
+//
+// Example:
+//
+//	page, err := bc.OpenCursor(ctx, "SELECT id, name FROM customers ORDER BY id", 50)
+//	for err == nil {
+//		for page.Next() {
+//			page.Scan(&id, &name)
+//		}
+//		page.Close()
+//		if page.Done {
+//			break
+//		}
+//		page, err = bc.FetchMore(ctx, page.CursorID)
+//	}
+func (bc *BurrowClient) OpenCursor(ctx context.Context, query string, pageSize int, args ...interface{}) (*CursorPage, error) {
+	if pageSize < 0 {
+		return nil, fmt.Errorf("invalid page size: %d", pageSize)
+	}
+	return bc.cursor(ctx, cursorRequest{Query: query, PageSize: pageSize}, args...)
+}
+
+// FetchMore returns the next page of a cursor opened with OpenCursor
+func (bc *BurrowClient) FetchMore(ctx context.Context, cursorID string) (*CursorPage, error) {
+	return bc.cursor(ctx, cursorRequest{CursorID: cursorID})
+}
+
+// CloseCursor closes a cursor before its last page was fetched. Closing a
+// cursor that is already closed is not an error.
+func (bc *BurrowClient) CloseCursor(ctx context.Context, cursorID string) error {
+	if _, err := bc.rowRPC(ctx, "CURSOR:", cursorRequest{CursorID: cursorID, Close: true}); err != nil {
+		return fmt.Errorf("closing cursor failed: %w", err)
+	}
+	return nil
+}
+
+// cursor sends a "CURSOR:" request and returns the page it answers with
+func (bc *BurrowClient) cursor(ctx context.Context, req cursorRequest, args ...interface{}) (*CursorPage, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	page := &CursorPage{}
+	rows, err := bc.db.QueryContext(context.WithValue(ctx, cursorInfoKey{}, page), "CURSOR:"+string(body), args...)
+	if err != nil {
+		return nil, fmt.Errorf("cursor failed: %w", err)
+	}
+	if page.CursorID == "" {
+		rows.Close()
+		return nil, fmt.Errorf("cursor failed: the server did not return a cursor")
+	}
+	page.Rows = rows
+	return page, nil
+}
@@ -0,0 +1,317 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DiagnosticStatus is the outcome of one step of Diagnose
+type DiagnosticStatus string
+
+// Diagnostic step outcomes
+const (
+	DiagnosticOK      DiagnosticStatus = "ok"
+	DiagnosticWarning DiagnosticStatus = "warning" // Works, but something needs attention
+	DiagnosticFailed  DiagnosticStatus = "failed"
+	DiagnosticSkipped DiagnosticStatus = "skipped" // Not run because an earlier step failed
+)
+
+// Diagnostic steps, in the order Diagnose runs them
+const (
+	DiagnoseBroker    = "broker"     // TCP connection to the RabbitMQ host
+	DiagnoseAuth      = "auth"       // AMQP login and vhost access
+	DiagnoseQueues    = "queues"     // Device queues exist and a server consumes them
+	DiagnoseServer    = "server"     // Server answers a heartbeat ping
+	DiagnoseDatabase  = "database"   // Server runs a query on its database
+	DiagnoseLatency   = "latency"    // Round trip of a query request
+	DiagnoseClockSkew = "clock_skew" // Difference between the server and client clocks
+)
+
+// latencySamples is how many queries the latency step times
+const latencySamples = 3
+
+// maxClockSkew is the clock difference reported as a warning
+const maxClockSkew = 2 * time.Second
+
+// DiagnosticStep is the result of one check
+type DiagnosticStep struct {
+	Name     string           `json:"name"`
+	Status   DiagnosticStatus `json:"status"`
+	Detail   string           `json:"detail"`
+	Duration time.Duration    `json:"duration"`
+}
+
+// DiagnosticReport is returned by Diagnose
+type DiagnosticReport struct {
+	DeviceID  string           `json:"device_id"`
+	Broker    string           `json:"broker"` // host:port of RabbitMQ
+	VHost     string           `json:"vhost"`
+	RPCQueue  string           `json:"rpc_queue"`
+	Steps     []DiagnosticStep `json:"steps"`
+	Latency   time.Duration    `json:"latency"`    // Average round trip of a query (0 when not measured)
+	ClockSkew time.Duration    `json:"clock_skew"` // Server clock minus client clock (0 when not measured)
+}
+
+// OK reports whether no step failed
+func (r *DiagnosticReport) OK() bool {
+	return r.FirstFailure() == nil
+}
+
+// FirstFailure returns the first failed step, which is the broken hop, or nil
+func (r *DiagnosticReport) FirstFailure() *DiagnosticStep {
+	for i := range r.Steps {
+		if r.Steps[i].Status == DiagnosticFailed {
+			return &r.Steps[i]
+		}
+	}
+	return nil
+}
+
+// Diagnose checks every hop between the client and the device database, step
+// by step: broker reachability, authentication, the device queues, server
+// liveness, database health, round-trip latency and clock skew. Steps after
+// a failure are skipped, so the first failed step names the broken hop.
+//
+// Each step is limited by the DSN timeout. Diagnose does not return an error;
+// problems are reported in the steps.
+//
+// Example:
+//
+//	report := bc.Diagnose(ctx)
+//	if step := report.FirstFailure(); step != nil {
+//	    log.Printf("%s: %s", step.Name, step.Detail)
+//	}
+func (bc *BurrowClient) Diagnose(ctx context.Context) *DiagnosticReport {
+	report := &DiagnosticReport{}
+	failed := false
+	run := func(name string, check func(ctx context.Context) (DiagnosticStatus, string)) {
+		if failed {
+			report.Steps = append(report.Steps, DiagnosticStep{Name: name, Status: DiagnosticSkipped})
+			return
+		}
+		start := time.Now()
+		status, detail := check(ctx)
+		report.Steps = append(report.Steps, DiagnosticStep{Name: name, Status: status, Detail: detail, Duration: time.Since(start)})
+		failed = status == DiagnosticFailed
+	}
+
+	config := bc.config
+	topology, err := NewTopology(config.Namespace, config.DeviceID)
+	if err != nil {
+		report.Steps = append(report.Steps, DiagnosticStep{Name: DiagnoseBroker, Status: DiagnosticFailed, Detail: err.Error()})
+		return report
+	}
+	report.DeviceID = config.DeviceID
+	report.VHost = VHostOf(config.AMQPURL)
+	report.RPCQueue = topology.RPCQueue
+	report.Broker = brokerAddress(config.AMQPURL)
+
+	var conn *amqp.Connection
+	defer func() {
+		if conn != nil {
+			conn.Close()
+		}
+	}()
+	var pongTime time.Time // Server clock at the heartbeat pong
+	var pongRTT time.Duration
+
+	run(DiagnoseBroker, func(ctx context.Context) (DiagnosticStatus, string) {
+		dialer := net.Dialer{Timeout: config.Timeout}
+		tcp, err := dialer.DialContext(ctx, "tcp", report.Broker)
+		if err != nil {
+			return DiagnosticFailed, fmt.Sprintf("cannot reach RabbitMQ at %s: %v", report.Broker, err)
+		}
+		tcp.Close()
+		return DiagnosticOK, fmt.Sprintf("reached %s", report.Broker)
+	})
+
+	run(DiagnoseAuth, func(ctx context.Context) (DiagnosticStatus, string) {
+		dialConfig := config.amqpConfig()
+		dialConfig.Dial = amqp.DefaultDial(config.Timeout)
+		conn, err = amqp.DialConfig(config.AMQPURL, dialConfig)
+		if err != nil {
+			return DiagnosticFailed, ExplainAMQPError(err, config.AMQPURL).Error()
+		}
+		user := amqpUser(config.AMQPURL)
+		if config.Username != "" {
+			user = config.Username
+		}
+		return DiagnosticOK, fmt.Sprintf("logged in as '%s' on vhost '%s'", user, report.VHost)
+	})
+
+	run(DiagnoseQueues, func(ctx context.Context) (DiagnosticStatus, string) {
+		rpc, err := inspectQueue(conn, topology.RPCQueue)
+		if err != nil {
+			return DiagnosticFailed, err.Error()
+		}
+		if rpc.Consumers == 0 {
+			return DiagnosticFailed, fmt.Sprintf("queue %s exists but no server consumes it (%d requests waiting): is the server for device '%s' running?",
+				topology.RPCQueue, rpc.Messages, config.DeviceID)
+		}
+		if _, err := inspectQueue(conn, topology.HeartbeatQueue); err != nil {
+			return DiagnosticWarning, err.Error()
+		}
+		return DiagnosticOK, fmt.Sprintf("%s has %d consumer(s), %d requests waiting", topology.RPCQueue, rpc.Consumers, rpc.Messages)
+	})
+
+	run(DiagnoseServer, func(ctx context.Context) (DiagnosticStatus, string) {
+		pongTime, pongRTT, err = pingServer(ctx, conn, topology.HeartbeatQueue, config)
+		if err != nil {
+			// Requests may still work when the server runs with heartbeats disabled
+			return DiagnosticWarning, err.Error()
+		}
+		return DiagnosticOK, fmt.Sprintf("heartbeat answered in %s", pongRTT.Round(time.Millisecond))
+	})
+
+	run(DiagnoseDatabase, func(ctx context.Context) (DiagnosticStatus, string) {
+		ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+		var one int
+		if err := bc.db.QueryRowContext(ctx, "SELECT 1").Scan(&one); err != nil {
+			return DiagnosticFailed, fmt.Sprintf("server could not query its database: %v", err)
+		}
+		return DiagnosticOK, "SELECT 1 succeeded"
+	})
+
+	run(DiagnoseLatency, func(ctx context.Context) (DiagnosticStatus, string) {
+		var total time.Duration
+		for i := 0; i < latencySamples; i++ {
+			queryCtx, cancel := context.WithTimeout(ctx, config.Timeout)
+			start := time.Now()
+			var one int
+			err := bc.db.QueryRowContext(queryCtx, "SELECT 1").Scan(&one)
+			cancel()
+			if err != nil {
+				return DiagnosticFailed, err.Error()
+			}
+			total += time.Since(start)
+		}
+		report.Latency = total / latencySamples
+		if report.Latency > config.Timeout/2 {
+			return DiagnosticWarning, fmt.Sprintf("average round trip %s is more than half the %s timeout", report.Latency.Round(time.Millisecond), config.Timeout)
+		}
+		return DiagnosticOK, fmt.Sprintf("average round trip %s over %d queries", report.Latency.Round(time.Millisecond), latencySamples)
+	})
+
+	run(DiagnoseClockSkew, func(ctx context.Context) (DiagnosticStatus, string) {
+		if pongTime.IsZero() {
+			return DiagnosticSkipped, "no heartbeat answer to read the server clock from"
+		}
+		report.ClockSkew = pongTime.Sub(time.Now().Add(-pongRTT / 2))
+		skew := report.ClockSkew
+		if skew < 0 {
+			skew = -skew
+		}
+		if skew > maxClockSkew {
+			return DiagnosticWarning, fmt.Sprintf("server clock differs by %s: synchronize both clocks (NTP)", report.ClockSkew.Round(time.Millisecond))
+		}
+		return DiagnosticOK, fmt.Sprintf("server clock differs by %s", report.ClockSkew.Round(time.Millisecond))
+	})
+
+	return report
+}
+
+// brokerAddress returns the host:port an AMQP URL connects to
+func brokerAddress(amqpURL string) string {
+	u, err := url.Parse(amqpURL)
+	if err != nil {
+		return amqpURL
+	}
+	if u.Port() == "" {
+		return net.JoinHostPort(u.Hostname(), "5672")
+	}
+	return u.Host
+}
+
+// inspectQueue reads the state of a queue without creating it
+func inspectQueue(conn *amqp.Connection, name string) (amqp.Queue, error) {
+	// A failed passive declare closes the channel, so use one per queue
+	ch, err := conn.Channel()
+	if err != nil {
+		return amqp.Queue{}, err
+	}
+	defer ch.Close()
+
+	queue, err := ch.QueueDeclarePassive(name, false, false, false, false, nil)
+	if err != nil {
+		var amqpErr *amqp.Error
+		if errors.As(err, &amqpErr) && amqpErr.Code == amqp.NotFound {
+			return queue, fmt.Errorf("queue %s does not exist: the server has never started with this device ID and namespace", name)
+		}
+		return queue, fmt.Errorf("cannot inspect queue %s: %w", name, err)
+	}
+	return queue, nil
+}
+
+// pingServer sends a heartbeat ping and returns the server time in the pong
+// and the round trip
+func pingServer(ctx context.Context, conn *amqp.Connection, heartbeatQueue string, config *DSNConfig) (time.Time, time.Duration, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	defer ch.Close()
+
+	replyQueue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+	msgs, err := ch.Consume(replyQueue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	corrID := fmt.Sprintf("diagnose_%d", time.Now().UnixNano())
+	body, _ := json.Marshal(map[string]interface{}{
+		"type":      "heartbeat_ping",
+		"deviceID":  config.DeviceID,
+		"clientIP":  getOutboundIP(),
+		"timestamp": time.Now().Unix(),
+		"corrID":    corrID,
+	})
+	start := time.Now()
+	err = ch.PublishWithContext(ctx, "", heartbeatQueue, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: corrID,
+		ReplyTo:       replyQueue.Name,
+		Body:          body,
+	})
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	timer := time.NewTimer(config.Timeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return time.Time{}, 0, ctx.Err()
+		case <-timer.C:
+			return time.Time{}, 0, fmt.Errorf("no heartbeat answer within %s (the server may run with heartbeats disabled)", config.Timeout)
+		case msg := <-msgs:
+			if msg.CorrelationId != corrID {
+				continue
+			}
+			rtt := time.Since(start)
+			var pong struct {
+				Timestamp   int64 `json:"timestamp"`
+				TimestampMs int64 `json:"timestampMs"`
+			}
+			json.Unmarshal(msg.Body, &pong)
+			switch {
+			case pong.TimestampMs > 0:
+				return time.UnixMilli(pong.TimestampMs), rtt, nil
+			case pong.Timestamp > 0:
+				return time.Unix(pong.Timestamp, 0), rtt, nil
+			}
+			return time.Time{}, rtt, nil
+		}
+	}
+}
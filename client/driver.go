@@ -14,6 +14,7 @@
 package client
 
 import (
+	"crypto/tls"
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
@@ -22,6 +23,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
 )
 
 // Package initialization registers the driver with the database/sql package.
@@ -68,6 +71,25 @@ func (d *Driver) Open(dsn string) (driver.Conn, error) {
 	if err != nil {
 		return nil, fmt.Errorf("DSN parsing failed: %v", err)
 	}
+	return openConn(conf)
+}
+
+// OpenConnector implements the driver.DriverContext interface, so sql.Open
+// parses the DSN once instead of on every new connection
+func (d *Driver) OpenConnector(dsn string) (driver.Connector, error) {
+	conf, err := parseDSN(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("DSN parsing failed: %v", err)
+	}
+	return &Connector{config: conf}, nil
+}
+
+// openConn opens a connection with a parsed configuration
+func openConn(conf *DSNConfig) (driver.Conn, error) {
+	// Brokers other than RabbitMQ are reached through a registered Transport
+	if !IsAMQPURL(conf.AMQPURL) {
+		return openTransportConn(conf)
+	}
 
 	// Create connection manager with automatic reconnection
 	reconnectConfig := &ReconnectConfig{
@@ -79,42 +101,153 @@ func (d *Driver) Open(dsn string) (driver.Conn, error) {
 		ResetInterval:     conf.ReconnectResetInterval,
 	}
 
-	connMgr, err := NewConnectionManager(dsn, reconnectConfig)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create connection manager: %w", err)
-	}
+	connMgr := newConnectionManager(conf, reconnectConfig)
 
 	// Establish initial connection
 	if err := connMgr.Connect(); err != nil {
-		return nil, fmt.Errorf("RabbitMQ connection failed to '%s': %v\nPlease check:\n- RabbitMQ server is running\n- Credentials are correct\n- Network connectivity", conf.AMQPURL, err)
+		return nil, fmt.Errorf("RabbitMQ connection failed to '%s': %v\nPlease check:\n- RabbitMQ server is running\n- Credentials are correct\n- Network connectivity", RedactURL(conf.AMQPURL), Redact(err.Error()))
 	}
 
 	// Log successful connection if debug mode is enabled
 	if conf.Debug {
-		log.Printf("[client debug] Connected to RabbitMQ %s (deviceID=%s, timeout=%v)", conf.AMQPURL, conf.DeviceID, conf.Timeout)
+		log.Printf("[client debug] Connected to RabbitMQ %s (deviceID=%s, vhost=%s, timeout=%v)", RedactURL(conf.AMQPURL), conf.DeviceID, VHostOf(conf.AMQPURL), conf.Timeout)
+	}
+
+	// Derive queue and exchange names for the target device
+	topology, err := NewTopology(conf.Namespace, conf.DeviceID)
+	if err != nil {
+		connMgr.Close()
+		return nil, err
 	}
 
 	// Return a new connection instance
 	conn := &Conn{
 		deviceID: conf.DeviceID,
+		topology: topology,
 		connMgr:  connMgr,
 		config:   conf,
 	}
 
 	// Setup heartbeat manager if enabled
 	conn.setupHeartbeat()
+	conn.setupServerPings()
+
+	// Register the connection with its server-side session
+	conn.openSession()
 
 	return conn, nil
 }
 
+// openTransportConn opens a connection that sends requests through the
+// Transport registered for the scheme of conf.AMQPURL. Heartbeats and the
+// reconnection settings do not apply: the transport keeps its connection
+// alive itself.
+func openTransportConn(conf *DSNConfig) (driver.Conn, error) {
+	transport, err := OpenTransport(conf.AMQPURL)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Debug {
+		log.Printf("[client debug] Connected to %s (deviceID=%s, timeout=%v)", RedactURL(conf.AMQPURL), conf.DeviceID, conf.Timeout)
+	}
+
+	topology, err := NewTopology(conf.Namespace, conf.DeviceID)
+	if err != nil {
+		transport.Close()
+		return nil, err
+	}
+
+	conn := &Conn{
+		deviceID:  conf.DeviceID,
+		topology:  topology,
+		transport: transport,
+		config:    conf,
+	}
+	conn.openSession()
+	return conn, nil
+}
+
 // DSNConfig holds the parsed configuration from a Data Source Name.
 // It contains all necessary parameters for establishing and managing
 // the RabbitMQ connection and client behavior.
 type DSNConfig struct {
-	DeviceID string        // Unique identifier for the target device/server
-	AMQPURL  string        // RabbitMQ connection URL with credentials
-	Timeout  time.Duration // Maximum time to wait for query responses
-	Debug    bool          // Whether to enable debug logging
+	DeviceID   string        // Unique identifier for the target device/server
+	AMQPURL    string        // RabbitMQ connection URL with credentials
+	Timeout    time.Duration // Maximum time to wait for query responses
+	Debug      bool          // Whether to enable debug logging
+	Namespace  string        // Prefix applied to every queue and exchange name
+	VHost      string        // Virtual host override (empty = use the vhost in AMQPURL)
+	Priority   Priority      // Default request priority (overridable per query with WithPriority)
+	OnBehalfOf string        // Default end user requests run for (overridable per query with WithOnBehalfOf)
+	SessionID  string        // Session whose server-side settings apply (generated per DSN when empty)
+
+	// ChannelPoolSize is the number of idle AMQP channels kept for reuse
+	// (0 opens a channel per request)
+	ChannelPoolSize int
+
+	// DirectReplyTo receives responses through RabbitMQ's direct reply-to
+	// pseudo-queue instead of a declared reply queue
+	DirectReplyTo bool
+
+	// ServerPings answers pings from the server on a queue of the
+	// connection, so the server tracks it without client heartbeats
+	ServerPings bool
+
+	// Multiplex publishes every request of a connection on one shared AMQP
+	// channel, whose single consumer dispatches the responses by correlation
+	// ID, instead of a pooled channel per request in flight
+	Multiplex bool
+
+	// Persistent publishes requests as persistent messages, so requests
+	// waiting in durable device queues survive a broker restart
+	Persistent bool
+
+	// RequestTTL is how long a request may wait in the device queue before
+	// the broker discards it. Zero derives it from the request deadline;
+	// negative publishes requests without an expiration.
+	RequestTTL time.Duration
+
+	// ProtocolVersion is the wire protocol version to speak. Setting it to
+	// ProtocolV1 makes the client behave like older releases so mixed-version
+	// fleets can be verified before new wire features are enabled everywhere.
+	ProtocolVersion int
+
+	// NativeTypes asks the server for the column types of SQL results and
+	// decodes values by them (integers as int64, text as string, binary as
+	// []byte). When false, values are decoded by guessing from their JSON
+	// form, as older releases did: numeric-looking text becomes a number.
+	NativeTypes bool
+
+	// ParseTime decodes DATE, DATETIME and TIMESTAMP values into time.Time
+	// in Location, like the parseTime option of the MySQL driver. Needs
+	// NativeTypes; when false those values are strings.
+	ParseTime bool
+	Location  *time.Location
+
+	// Columnar asks the server for SQL results in column-major layout, whose
+	// values decode faster and compress better than rows. Needs NativeTypes;
+	// servers without the layout send rows instead.
+	Columnar bool
+
+	// RedactQueries masks the literal values of queries in debug logs
+	RedactQueries bool
+
+	// Broker credentials, which override the ones in AMQPURL
+	Username string
+	Password string
+
+	// Token is presented with every request for the server to authenticate,
+	// e.g. a JWT; TokenSource, set through NewConnector only, supersedes it
+	Token       string
+	TokenSource TokenSource
+
+	// SigningKey signs every request, with its nonce and timestamp, for
+	// servers with replay protection; it must match their replay signing key
+	SigningKey string
+
+	// Dial settings, set through NewConnector only
+	TLSConfig  *tls.Config  // TLS settings of amqps:// connections
+	AMQPConfig *amqp.Config // Base dial configuration (heartbeat, SASL, properties, ...)
 
 	// Heartbeat configuration
 	HeartbeatEnabled bool             // Whether heartbeat is enabled
@@ -138,11 +271,35 @@ type DSNConfig struct {
 //
 // Required parameters:
 //   - deviceID: Target device identifier
-//   - amqp_uri: RabbitMQ connection URL
+//   - amqp_uri: RabbitMQ connection URL, or the URL of a registered transport (e.g. nats://)
 //
 // Optional parameters:
 //   - timeout: Query timeout (default: 5s)
 //   - debug: Debug logging (default: false)
+//   - namespace: Queue/exchange name prefix, e.g. "prod.siteA." (default: none)
+//   - vhost: RabbitMQ virtual host, overrides the one in amqp_uri (default: none)
+//   - priority: Default request priority: high, normal or low (default: normal)
+//   - channel_pool_size: Idle AMQP channels kept for reuse, 0 disables reuse (default: 4)
+//   - direct_reply_to: Receive responses via amq.rabbitmq.reply-to (default: true)
+//   - multiplex: Share one AMQP channel and one response consumer between all requests of a connection (default: true)
+//   - heartbeat: Ping the server's heartbeat queue while requests are active or a session is bound (default: false)
+//   - heartbeat_interval: Time between pings while no responses arrive (default: 30s)
+//   - heartbeat_max_interval: Longest time between pings while responses prove liveness (default: 90s)
+//   - server_pings: Answer pings from servers running with -heartbeat-server-pings (default: false)
+//   - persistent: Publish requests as persistent messages (default: false)
+//   - request_ttl: Expire requests not consumed within this time, "off" to disable (default: the request deadline)
+//   - native_types: Decode SQL values by their column types, "false" for the old guessing (default: true)
+//   - parse_time: Decode DATE, DATETIME and TIMESTAMP values into time.Time (default: false)
+//   - columnar: Receive SQL results column-major, negotiated with the server (default: false)
+//   - loc: Time zone of parsed times, e.g. "Local" or "America/New_York" (default: UTC)
+//   - username, password: RabbitMQ credentials, overriding the ones in amqp_uri (default: none)
+//   - redact_queries: Mask literal values of queries in debug logs (default: false)
+//   - token: Token, such as a JWT, presented with every request (default: none)
+//   - signing_key: Key shared with servers that have replay protection, signing every request (default: none)
+//
+// Any value may be a secret reference, "env:NAME" or "file:/path" (see
+// ResolveSecret), and a <name>_file parameter reads <name> from a file,
+// e.g. password_file=/run/secrets/amqp.
 //
 // Parameters:
 //   - dsn: The Data Source Name string to parse
@@ -159,6 +316,11 @@ func parseDSN(dsn string) (*DSNConfig, error) {
 
 	values := u.Query()
 
+	// Resolve env: and file: secret references and <name>_file parameters
+	if err := resolveDSNSecrets(values); err != nil {
+		return nil, err
+	}
+
 	// Validate required parameters
 	deviceID := values.Get("deviceID")
 	if deviceID == "" {
@@ -170,9 +332,9 @@ func parseDSN(dsn string) (*DSNConfig, error) {
 		return nil, fmt.Errorf("missing required parameter 'amqp_uri' in DSN")
 	}
 
-	// Validate AMQP URI format
-	if len(amqpURI) < 7 || amqpURI[:7] != "amqp://" {
-		return nil, fmt.Errorf("invalid amqp_uri format: must start with 'amqp://'")
+	// Validate AMQP URI format; other schemes need a registered transport
+	if !IsAMQPURL(amqpURI) && !isTransportScheme(urlScheme(amqpURI)) {
+		return nil, fmt.Errorf("invalid amqp_uri format: must start with 'amqp://', 'amqps://' or a transport scheme (%s)", strings.Join(transportSchemes(), ", "))
 	}
 
 	// Parse optional timeout parameter
@@ -190,6 +352,119 @@ func parseDSN(dsn string) (*DSNConfig, error) {
 	debugStr := strings.ToLower(values.Get("debug"))
 	debug := debugStr == "true" || debugStr == "1"
 
+	// Parse optional namespace parameter
+	namespace := values.Get("namespace")
+	if err := ValidateNamespace(namespace); err != nil {
+		return nil, err
+	}
+
+	// Parse optional vhost parameter and apply it to the AMQP URL
+	vhost := values.Get("vhost")
+	if vhost != "" && !IsAMQPURL(amqpURI) {
+		return nil, fmt.Errorf("vhost only applies to RabbitMQ (amqp://) connections")
+	}
+	if vhost != "" {
+		amqpURI, err = ApplyVHost(amqpURI, vhost)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Parse optional query redaction in debug logs
+	redactStr := strings.ToLower(values.Get("redact_queries"))
+	redactQueries := redactStr == "true" || redactStr == "1"
+
+	// Parse optional broker credentials, which override the ones in amqp_uri
+	username, password := values.Get("username"), values.Get("password")
+	if (username != "" || password != "") && !IsAMQPURL(amqpURI) {
+		return nil, fmt.Errorf("username and password only apply to RabbitMQ (amqp://) connections")
+	}
+
+	// Parse optional default priority
+	var priority Priority // Empty: session setting or server default (normal)
+	if priorityStr := values.Get("priority"); priorityStr != "" {
+		priority, err = parsePriority(priorityStr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Parse optional default end user for on-behalf-of requests
+	onBehalfOf := values.Get("on_behalf_of")
+
+	// Parse optional token presented with every request
+	token := values.Get("token")
+
+	// Parse optional key signing requests for replay protection
+	signingKey := values.Get("signing_key")
+
+	// Parse optional session ID; connections opened with the same DSN share one by default
+	sessionID := values.Get("session_id")
+	if sessionID == "" {
+		sessionID = sessionIDFor(dsn)
+	}
+
+	// Parse optional wire protocol version (compatibility mode)
+	protocolVersion, err := parseProtocolVersion(values.Get("protocol_version"))
+	if err != nil {
+		return nil, err
+	}
+
+	// Parse optional channel pool size
+	channelPoolSize := DefaultChannelPoolSize
+	if poolSizeStr := values.Get("channel_pool_size"); poolSizeStr != "" {
+		channelPoolSize, err = strconv.Atoi(poolSizeStr)
+		if err != nil || channelPoolSize < 0 {
+			return nil, fmt.Errorf("invalid channel_pool_size '%s': must be a non-negative integer", poolSizeStr)
+		}
+	}
+
+	// Parse optional direct reply-to switch
+	directReplyTo := true // Default to enabled; brokers without it fall back to a reply queue
+	if directStr := strings.ToLower(values.Get("direct_reply_to")); directStr != "" {
+		directReplyTo = directStr == "true" || directStr == "1"
+	}
+
+	// Parse optional multiplexing switch
+	multiplex := true // Default to enabled; false borrows a pooled channel per request
+	if multiplexStr := strings.ToLower(values.Get("multiplex")); multiplexStr != "" {
+		multiplex = multiplexStr == "true" || multiplexStr == "1"
+	}
+
+	// Parse optional persistent delivery switch
+	persistentStr := strings.ToLower(values.Get("persistent"))
+	persistent := persistentStr == "true" || persistentStr == "1"
+
+	// Parse optional request TTL
+	var requestTTL time.Duration // Zero: derived from the request deadline
+	if ttlStr := strings.ToLower(values.Get("request_ttl")); ttlStr != "" {
+		if ttlStr == "off" || ttlStr == "0" {
+			requestTTL = -1
+		} else if requestTTL, err = time.ParseDuration(ttlStr); err != nil || requestTTL <= 0 {
+			return nil, fmt.Errorf("invalid request_ttl '%s': must be a positive duration or 'off' (example: '30s')", ttlStr)
+		}
+	}
+
+	// Parse optional native type decoding switch
+	nativeTypes := true // Default to enabled; "false" restores the old guessing
+	if nativeStr := strings.ToLower(values.Get("native_types")); nativeStr != "" {
+		nativeTypes = nativeStr == "true" || nativeStr == "1"
+	}
+
+	// Parse optional column-major result layout
+	columnarStr := strings.ToLower(values.Get("columnar"))
+	columnar := columnarStr == "true" || columnarStr == "1"
+
+	// Parse optional time decoding, with the semantics of the MySQL driver's parseTime and loc
+	parseTimeStr := strings.ToLower(values.Get("parse_time"))
+	parseTime := parseTimeStr == "true" || parseTimeStr == "1"
+	location := time.UTC
+	if locStr := values.Get("loc"); locStr != "" {
+		if location, err = time.LoadLocation(locStr); err != nil {
+			return nil, fmt.Errorf("invalid loc '%s': %v", locStr, err)
+		}
+	}
+
 	// Parse reconnection configuration
 	reconnectEnabled := true // Default to enabled
 	if reconnectStr := strings.ToLower(values.Get("reconnect_enabled")); reconnectStr != "" {
@@ -231,12 +506,61 @@ func parseDSN(dsn string) (*DSNConfig, error) {
 		}
 	}
 
+	// Parse heartbeat configuration
+	heartbeatStr := strings.ToLower(values.Get("heartbeat"))
+	heartbeatEnabled := heartbeatStr == "true" || heartbeatStr == "1"
+	heartbeatConfig := DefaultHeartbeatConfig()
+	if intervalStr := values.Get("heartbeat_interval"); intervalStr != "" {
+		interval, err := time.ParseDuration(intervalStr)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("invalid heartbeat_interval '%s': must be a positive duration", intervalStr)
+		}
+		heartbeatConfig.Interval = interval
+		if heartbeatConfig.MaxInterval < interval {
+			heartbeatConfig.MaxInterval = interval
+		}
+	}
+	if maxIntervalStr := values.Get("heartbeat_max_interval"); maxIntervalStr != "" {
+		maxInterval, err := time.ParseDuration(maxIntervalStr)
+		if err != nil || maxInterval < heartbeatConfig.Interval {
+			return nil, fmt.Errorf("invalid heartbeat_max_interval '%s': must be a duration of at least heartbeat_interval (%v)", maxIntervalStr, heartbeatConfig.Interval)
+		}
+		heartbeatConfig.MaxInterval = maxInterval
+	}
+
+	// Parse optional server ping answering
+	serverPingsStr := strings.ToLower(values.Get("server_pings"))
+	serverPings := serverPingsStr == "true" || serverPingsStr == "1"
+
 	// Create and return configuration
 	conf := &DSNConfig{
 		DeviceID:                   deviceID,
 		AMQPURL:                    amqpURI,
 		Timeout:                    timeout,
 		Debug:                      debug,
+		Namespace:                  namespace,
+		VHost:                      vhost,
+		Priority:                   priority,
+		OnBehalfOf:                 onBehalfOf,
+		SessionID:                  sessionID,
+		ProtocolVersion:            protocolVersion,
+		NativeTypes:                nativeTypes,
+		ParseTime:                  parseTime,
+		Location:                   location,
+		Columnar:                   columnar,
+		RedactQueries:              redactQueries,
+		Username:                   username,
+		Password:                   password,
+		Token:                      token,
+		SigningKey:                 signingKey,
+		ChannelPoolSize:            channelPoolSize,
+		DirectReplyTo:              directReplyTo,
+		Multiplex:                  multiplex,
+		HeartbeatEnabled:           heartbeatEnabled,
+		HeartbeatConfig:            heartbeatConfig,
+		ServerPings:                serverPings,
+		Persistent:                 persistent,
+		RequestTTL:                 requestTTL,
 		ReconnectEnabled:           reconnectEnabled,
 		ReconnectMaxAttempts:       reconnectMaxAttempts,
 		ReconnectInitialInterval:   reconnectInitialInterval,
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// subscriptionPattern matches event channels and topic wildcards ("*" for
+// one dot-separated segment, "#" for any number of segments).
+var subscriptionPattern = regexp.MustCompile(`^([A-Za-z0-9_:-]+|\*|#)(\.([A-Za-z0-9_:-]+|\*|#))*$`)
+
+// Event is a message the server pushed to an event channel
+type Event struct {
+	Channel   string          `json:"channel"`        // Channel the event was published on
+	DeviceID  string          `json:"deviceID"`       // Device that published it
+	Timestamp time.Time       `json:"timestamp"`      // Publication time on the server
+	Data      json.RawMessage `json:"data,omitempty"` // Event payload as published by the server
+}
+
+// Decode unmarshals the event payload into v
+func (e Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// Subscribe receives the events the device publishes on the given channels
+// (e.g. "alerts", "table:users:changed", or "table.#" with topic wildcards).
+// Events published while no subscription is active are not delivered.
+//
+// The subscription uses its own RabbitMQ connection. If that connection is
+// lost it is re-established following the DSN's reconnect settings; events
+// published in between are missed. The returned channel is closed when ctx
+// is done or reconnecting gives up.
+//
+// Example:
+//
+//	events, err := bc.Subscribe(ctx, "alerts")
+//	for event := range events {
+//		log.Printf("%s from %s: %s", event.Channel, event.DeviceID, event.Data)
+//	}
+func (bc *BurrowClient) Subscribe(ctx context.Context, channels ...string) (<-chan Event, error) {
+	if len(channels) == 0 {
+		return nil, fmt.Errorf("no event channels given")
+	}
+	for _, channel := range channels {
+		if !subscriptionPattern.MatchString(channel) {
+			return nil, fmt.Errorf("invalid event channel '%s'", channel)
+		}
+	}
+
+	config := bc.config
+	topology, err := NewTopology(config.Namespace, config.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &subscription{config: config, exchange: topology.EventsExchange, channels: channels}
+	deliveries, err := sub.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go sub.forward(ctx, deliveries, events)
+	return events, nil
+}
+
+// subscription is the AMQP side of a Subscribe call
+type subscription struct {
+	config   *DSNConfig
+	exchange string
+	channels []string
+	conn     *amqp.Connection
+}
+
+// connect dials the broker and binds an exclusive queue to every channel
+func (s *subscription) connect() (<-chan amqp.Delivery, error) {
+	conn, err := amqp.DialConfig(s.config.AMQPURL, s.config.amqpConfig())
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to RabbitMQ: %w", ExplainAMQPError(err, s.config.AMQPURL))
+	}
+
+	deliveries, err := s.bind(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	s.conn = conn
+	return deliveries, nil
+}
+
+// bind declares the exchange and a server-named queue bound to the channels
+func (s *subscription) bind(conn *amqp.Connection) (<-chan amqp.Delivery, error) {
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+
+	// Declared with the server's arguments so subscribing works before the
+	// device has started
+	if err := ch.ExchangeDeclare(s.exchange, "topic", false, false, false, false, nil); err != nil {
+		return nil, fmt.Errorf("failed to declare events exchange: %w", ExplainAMQPError(err, s.config.AMQPURL))
+	}
+
+	queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to declare subscription queue: %w", ExplainAMQPError(err, s.config.AMQPURL))
+	}
+	for _, channel := range s.channels {
+		if err := ch.QueueBind(queue.Name, channel, s.exchange, false, nil); err != nil {
+			return nil, fmt.Errorf("failed to subscribe to '%s': %w", channel, ExplainAMQPError(err, s.config.AMQPURL))
+		}
+	}
+	return ch.Consume(queue.Name, "", true, true, false, false, nil)
+}
+
+// forward decodes deliveries into events until ctx is done, reconnecting
+// when the connection drops
+func (s *subscription) forward(ctx context.Context, deliveries <-chan amqp.Delivery, events chan<- Event) {
+	defer close(events)
+	defer func() {
+		if s.conn != nil {
+			s.conn.Close()
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-deliveries:
+			if !ok {
+				if deliveries = s.reconnect(ctx); deliveries == nil {
+					return
+				}
+				continue
+			}
+
+			var event Event
+			if err := json.Unmarshal(msg.Body, &event); err != nil {
+				if s.config.Debug {
+					log.Printf("[client debug] Dropping malformed event: %v", err)
+				}
+				continue
+			}
+			select {
+			case events <- event:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}
+}
+
+// reconnect re-establishes the subscription with exponential backoff and
+// returns nil when reconnection is disabled, exhausted or ctx is done
+func (s *subscription) reconnect(ctx context.Context) <-chan amqp.Delivery {
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+	if !s.config.ReconnectEnabled {
+		log.Printf("[events] Subscription to %s lost", s.exchange)
+		return nil
+	}
+
+	interval := s.config.ReconnectInitialInterval
+	for attempt := 1; s.config.ReconnectMaxAttempts == 0 || attempt <= s.config.ReconnectMaxAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(interval):
+		}
+
+		deliveries, err := s.connect()
+		if err == nil {
+			log.Printf("[events] Subscription to %s restored after %d attempts", s.exchange, attempt)
+			return deliveries
+		}
+		if s.config.Debug {
+			log.Printf("[client debug] Event subscription reconnect attempt %d failed: %v", attempt, err)
+		}
+
+		interval = time.Duration(float64(interval) * s.config.ReconnectBackoffMultiplier)
+		if interval > s.config.ReconnectMaxInterval {
+			interval = s.config.ReconnectMaxInterval
+		}
+	}
+	log.Printf("[events] Subscription to %s lost: giving up after %d attempts", s.exchange, s.config.ReconnectMaxAttempts)
+	return nil
+}
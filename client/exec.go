@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+)
+
+// execKey is the context key for queries run with Exec semantics.
+type execKey struct{}
+
+// execRequest asks the server to execute a statement and report the affected
+// rows; batch holds the parameter sets of a BatchExec.
+type execRequest struct {
+	batch [][]interface{}
+}
+
+// withExec returns a context whose query runs with Exec semantics, once per
+// parameter set of batch when it is not empty.
+func withExec(ctx context.Context, batch [][]interface{}) context.Context {
+	return context.WithValue(ctx, execKey{}, &execRequest{batch: batch})
+}
+
+// execFromContext returns the Exec request stored in ctx, if any.
+func execFromContext(ctx context.Context) (*execRequest, bool) {
+	exec, ok := ctx.Value(execKey{}).(*execRequest)
+	return exec, ok
+}
+
+// execResult turns the response to an Exec request into a driver.Result.
+// Servers that predate Exec requests answer with rows only; their result
+// reports zero affected rows, as before.
+func execResult(rows driver.Rows) (driver.Result, error) {
+	defer rows.Close()
+	if r, ok := rows.(*Rows); ok && r.result != nil {
+		return r.result, nil
+	}
+	return &Result{}, nil
+}
+
+// ExecContext implements the driver.ExecerContext interface and executes a
+// statement that does not return rows, reporting the affected rows and last
+// insert ID. Non-SQL requests and protocol version 1 fall back to the
+// prepared statement path of database/sql.
+//
+// Parameters:
+//   - ctx: Context for cancellation and timeout control
+//   - query: SQL statement with parameter placeholders (?)
+//   - args: Query parameters to bind to placeholders
+//
+// Returns:
+//   - driver.Result: Affected rows and last insert ID
+//   - error: Any error that occurred during execution
+func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if cmdType, _ := parseCommand(query); cmdType != "sql" || c.legacyProtocol() {
+		return nil, driver.ErrSkip
+	}
+
+	c.logf("Executing statement with context: %s with %d parameters", c.loggedQuery(query), len(args))
+	rows, err := c.queryRPCWithHeartbeat(withExec(ctx, nil), query, args)
+	if err != nil {
+		return nil, err
+	}
+	return execResult(rows)
+}
+
+// batchExec runs query once per parameter set in a single round trip
+func (c *Conn) batchExec(ctx context.Context, query string, paramSets [][]interface{}) (driver.Result, error) {
+	if c.legacyProtocol() {
+		return nil, errRequiresV2("batch execution")
+	}
+	if cmdType, _ := parseCommand(query); cmdType != "sql" {
+		return nil, fmt.Errorf("batch execution only supports SQL statements")
+	}
+	if len(paramSets) == 0 {
+		return &Result{}, nil
+	}
+	paramSets, err := c.encodeParamSets(paramSets)
+	if err != nil {
+		return nil, err
+	}
+
+	c.logf("Executing batch of %d parameter sets: %s", len(paramSets), c.loggedQuery(query))
+	rows, err := c.queryRPCWithHeartbeat(withExec(ctx, paramSets), query, nil)
+	if err != nil {
+		return nil, err
+	}
+	return execResult(rows)
+}
+
+// BatchExec executes the prepared statement once per parameter set in a
+// single round trip. See BatchExecContext.
+func (s *Stmt) BatchExec(paramSets [][]interface{}) (driver.Result, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.conn.config.Timeout)
+	defer cancel()
+	return s.BatchExecContext(ctx, paramSets)
+}
+
+// BatchExecContext executes the prepared statement once per parameter set
+// in a single round trip. Outside a transaction the server applies every
+// parameter set or none; the result reports the total affected rows and the
+// last insert ID.
+func (s *Stmt) BatchExecContext(ctx context.Context, paramSets [][]interface{}) (driver.Result, error) {
+	if s.closed {
+		return nil, fmt.Errorf("statement is closed")
+	}
+	if s.conn.legacyProtocol() {
+		return nil, errRequiresV2("batch execution")
+	}
+	for i, params := range paramSets {
+		if len(params) != s.numInput {
+			return nil, fmt.Errorf("parameter set %d: expected %d parameters, got %d", i+1, s.numInput, len(params))
+		}
+	}
+	if len(paramSets) == 0 {
+		return &Result{}, nil
+	}
+	paramSets, err := s.conn.encodeParamSets(paramSets)
+	if err != nil {
+		return nil, err
+	}
+
+	s.conn.logf("Executing prepared statement batch of %d parameter sets", len(paramSets))
+	rows, err := s.run(withExec(ctx, paramSets), nil)
+	if err != nil {
+		return nil, err
+	}
+	return execResult(rows)
+}
+
+// BatchExec executes query once per parameter set in a single round trip.
+// The server runs the whole batch in one database transaction, so either
+// every parameter set is applied or none is. It returns the total affected
+// rows and the last insert ID.
+//
+// Example:
+//
+//	result, err := bc.BatchExec(ctx, "INSERT INTO readings (sensor, value) VALUES (?, ?)",
+//		[][]interface{}{{"t1", 21.5}, {"t2", 19.0}, {"t3", 22.1}})
+func (bc *BurrowClient) BatchExec(ctx context.Context, query string, paramSets [][]interface{}) (sql.Result, error) {
+	conn, err := bc.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	var result driver.Result
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection %T", driverConn)
+		}
+		result, err = c.batchExec(ctx, query, paramSets)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
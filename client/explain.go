@@ -0,0 +1,229 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// QueryPlan is the execution plan of a query, as returned by Explain
+type QueryPlan struct {
+	Format string                   // "json" (EXPLAIN FORMAT=JSON) or "traditional" (tabular EXPLAIN)
+	Cost   float64                  // Estimated cost of the whole query (0 if the database does not report it)
+	Tables []PlanTable              // Table accesses, in plan order
+	JSON   json.RawMessage          // The EXPLAIN FORMAT=JSON document (nil for the traditional format)
+	Rows   []map[string]interface{} // The traditional EXPLAIN rows (nil for the JSON format)
+}
+
+// PlanTable is the access to one table in a query plan
+type PlanTable struct {
+	Table        string   // Table name or alias
+	AccessType   string   // How rows are found: ALL (full scan), index, range, ref, eq_ref, const, ...
+	PossibleKeys []string // Indexes the optimizer considered
+	Key          string   // Index used (empty: none)
+	Rows         int64    // Estimated rows examined per scan
+	Filtered     float64  // Estimated percentage of those rows left by the table's condition
+	Condition    string   // Condition applied to the table's rows (JSON format only)
+	Extra        string   // Additional information (traditional format only)
+}
+
+// FullScans returns the table accesses that read the whole table
+func (p *QueryPlan) FullScans() []PlanTable {
+	var scans []PlanTable
+	for _, table := range p.Tables {
+		if strings.EqualFold(table.AccessType, "ALL") {
+			scans = append(scans, table)
+		}
+	}
+	return scans
+}
+
+// Explain returns the execution plan of query on the device without
+// running it. The server uses EXPLAIN FORMAT=JSON where the database
+// supports it and the traditional EXPLAIN otherwise; either way the access
+// to every table is parsed into Tables. The query must pass the server's
+// SQL validation, as if it were to run.
+//
+// Example:
+//
+//	plan, err := bc.Explain(ctx, "SELECT * FROM orders WHERE customer_id = ?", 42)
+//	for _, scan := range plan.FullScans() {
+//		log.Printf("full scan of %s (~%d rows)", scan.Table, scan.Rows)
+//	}
+func (bc *BurrowClient) Explain(ctx context.Context, query string, params ...interface{}) (*QueryPlan, error) {
+	rows, err := bc.db.QueryContext(ctx, "EXPLAIN:"+query, params...)
+	if err != nil {
+		return nil, err
+	}
+	result, err := singleRow(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &QueryPlan{Format: resultString(result, "format")}
+	document := resultString(result, "plan")
+	switch plan.Format {
+	case "json":
+		plan.JSON = json.RawMessage(document)
+		tree, err := decodeOrdered(json.NewDecoder(strings.NewReader(document)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse plan: %w", err)
+		}
+		walkPlan(tree, plan)
+	case "traditional":
+		if err := json.Unmarshal([]byte(document), &plan.Rows); err != nil {
+			return nil, fmt.Errorf("failed to parse plan: %w", err)
+		}
+		for _, row := range plan.Rows {
+			table := PlanTable{
+				Table:      planText(row["table"]),
+				AccessType: planText(row["type"]),
+				Key:        planText(row["key"]),
+				Rows:       int64(planNumber(row["rows"])),
+				Filtered:   planNumber(row["filtered"]),
+				Extra:      planText(row["Extra"]),
+			}
+			if keys := planText(row["possible_keys"]); keys != "" {
+				table.PossibleKeys = strings.Split(keys, ",")
+			}
+			plan.Tables = append(plan.Tables, table)
+		}
+	default:
+		return nil, fmt.Errorf("unknown plan format: %s", plan.Format)
+	}
+	return plan, nil
+}
+
+// planField is a member of a JSON object, kept in document order
+type planField struct {
+	key   string
+	value interface{}
+}
+
+// decodeOrdered decodes the next JSON value, returning objects as
+// []planField so the plan is walked in the order the database wrote it
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	dec.UseNumber()
+	token, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		var fields []planField
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, planField{key: fmt.Sprint(key), value: value})
+		}
+		_, err = dec.Token() // '}'
+		return fields, err
+	case json.Delim('['):
+		var values []interface{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+		}
+		_, err = dec.Token() // ']'
+		return values, err
+	}
+	return token, nil
+}
+
+// walkPlan collects the query cost and the table accesses of a JSON plan
+func walkPlan(node interface{}, plan *QueryPlan) {
+	switch v := node.(type) {
+	case []interface{}:
+		for _, value := range v {
+			walkPlan(value, plan)
+		}
+	case []planField:
+		for _, field := range v {
+			switch field.key {
+			case "cost_info":
+				if plan.Cost == 0 {
+					plan.Cost = planNumber(planLookup(field.value, "query_cost"))
+				}
+			case "table":
+				if fields, ok := field.value.([]planField); ok && planLookup(fields, "table_name") != nil {
+					plan.Tables = append(plan.Tables, planTable(fields))
+				}
+			}
+			walkPlan(field.value, plan)
+		}
+	}
+}
+
+// planTable reads a "table" object of a JSON plan
+func planTable(fields []planField) PlanTable {
+	table := PlanTable{
+		Table:      planText(planLookup(fields, "table_name")),
+		AccessType: planText(planLookup(fields, "access_type")),
+		Key:        planText(planLookup(fields, "key")),
+		Filtered:   planNumber(planLookup(fields, "filtered")),
+		Condition:  planText(planLookup(fields, "attached_condition")),
+	}
+	// MySQL reports rows_examined_per_scan, MariaDB rows
+	rows := planLookup(fields, "rows_examined_per_scan")
+	if rows == nil {
+		rows = planLookup(fields, "rows")
+	}
+	table.Rows = int64(planNumber(rows))
+	if keys, ok := planLookup(fields, "possible_keys").([]interface{}); ok {
+		for _, key := range keys {
+			table.PossibleKeys = append(table.PossibleKeys, planText(key))
+		}
+	}
+	return table
+}
+
+// planLookup returns the value of key in a JSON plan object, or nil
+func planLookup(node interface{}, key string) interface{} {
+	fields, _ := node.([]planField)
+	for _, field := range fields {
+		if field.key == key {
+			return field.value
+		}
+	}
+	return nil
+}
+
+// planText reads a text value of a plan
+func planText(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(value)
+}
+
+// planNumber reads a numeric value of a plan; MySQL writes some numbers,
+// such as costs and filtered, as strings
+func planNumber(value interface{}) float64 {
+	switch v := value.(type) {
+	case json.Number:
+		n, _ := v.Float64()
+		return n
+	case float64:
+		return v
+	case string:
+		n, _ := strconv.ParseFloat(v, 64)
+		return n
+	}
+	return 0
+}
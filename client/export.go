@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// ExportFormat is the output format of ExportToWriter
+type ExportFormat string
+
+// Export formats
+const (
+	ExportCSV    ExportFormat = "csv"    // Header line, then one line per row
+	ExportNDJSON ExportFormat = "ndjson" // One JSON object per row and line
+)
+
+// exportDataPrefix marks export chunks in responses
+const exportDataPrefix = "text:"
+
+// exportRequest is the body of an "EXPORT:" request
+type exportRequest struct {
+	ExportID string `json:"exportID"`
+	Query    string `json:"query,omitempty"`
+	Format   string `json:"format,omitempty"`
+	Cancel   bool   `json:"cancel,omitempty"`
+}
+
+// ExportToWriter runs a SELECT on the device and writes its result to w as
+// CSV or NDJSON. The server formats the rows and returns them in chunks, so
+// results of any size are exported without the per-row JSON of Query and
+// without holding the result in memory. It returns the rows written.
+//
+// Values are formatted as the server reads them; NULL is an empty CSV field
+// and null in NDJSON.
+//
+// Example:
+//
+//	f, _ := os.Create("orders.csv")
+//	defer f.Close()
+//	n, err := bc.ExportToWriter(ctx, "SELECT * FROM orders WHERE created_at > ?", f, client.ExportCSV, since)
+func (bc *BurrowClient) ExportToWriter(ctx context.Context, query string, w io.Writer, format ExportFormat, args ...interface{}) (int64, error) {
+	if format != ExportCSV && format != ExportNDJSON {
+		return 0, fmt.Errorf("unsupported export format: %s", format)
+	}
+
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return 0, fmt.Errorf("failed to generate export ID: %w", err)
+	}
+	id := "export-" + hex.EncodeToString(random)
+
+	body, err := json.Marshal(exportRequest{ExportID: id, Query: query, Format: string(format)})
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	rows, err := bc.db.QueryContext(ctx, "EXPORT:"+string(body), args...)
+	if err != nil {
+		return 0, fmt.Errorf("export failed: %w", err)
+	}
+	chunk, err := singleRow(rows)
+
+	var total int64
+	for {
+		if err != nil {
+			bc.cancelExport(id)
+			return total, fmt.Errorf("export failed: %w", err)
+		}
+
+		data := resultString(chunk, "data")
+		if !strings.HasPrefix(data, exportDataPrefix) {
+			bc.cancelExport(id)
+			return total, fmt.Errorf("export failed: malformed chunk")
+		}
+		if _, err := io.WriteString(w, strings.TrimPrefix(data, exportDataPrefix)); err != nil {
+			bc.cancelExport(id)
+			return total, err
+		}
+		total += resultInt(chunk, "rows")
+		if done, _ := chunk["done"].(bool); done {
+			return total, nil
+		}
+
+		chunk, err = bc.rowRPC(ctx, "EXPORT:", exportRequest{ExportID: id})
+	}
+}
+
+// cancelExport closes an unfinished export on the server; failures are
+// ignored since idle exports are closed anyway
+func (bc *BurrowClient) cancelExport(id string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	bc.rowRPC(ctx, "EXPORT:", exportRequest{ExportID: id, Cancel: true})
+}
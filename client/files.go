@@ -0,0 +1,252 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrChecksumMismatch is returned when a transferred file or chunk does not
+// match its SHA-256 checksum
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// Prefixes of checksums and chunk data in file transfer responses
+const (
+	checksumPrefix = "sha256:"
+	dataPrefix     = "base64:"
+)
+
+// fileRequest is the body of a "FILE.GET:" or "FILE.PUT:" request
+type fileRequest struct {
+	Path          string `json:"path"`
+	Offset        int64  `json:"offset"`
+	Length        int    `json:"length,omitempty"`
+	Data          []byte `json:"data,omitempty"`
+	ChunkChecksum string `json:"chunkChecksum,omitempty"`
+	UploadID      string `json:"uploadID,omitempty"`
+	Final         bool   `json:"final,omitempty"`
+	Checksum      string `json:"checksum,omitempty"`
+}
+
+// rowRPC sends a request body with a command prefix and returns its single
+// result row by column name
+func (bc *BurrowClient) rowRPC(ctx context.Context, prefix string, req interface{}) (map[string]interface{}, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	rows, err := bc.db.QueryContext(ctx, prefix+string(body))
+	if err != nil {
+		return nil, err
+	}
+	return singleRow(rows)
+}
+
+// singleRow reads the single result row of rows by column name and closes rows
+func singleRow(rows *sql.Rows) (map[string]interface{}, error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+		return nil, fmt.Errorf("server returned no result")
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]interface{}, len(columns))
+	for i, column := range columns {
+		result[column] = values[i]
+	}
+	return result, rows.Err()
+}
+
+// allRows reads every row of rows by column name and closes rows
+func allRows(rows *sql.Rows) ([]map[string]interface{}, error) {
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	var result []map[string]interface{}
+	for rows.Next() {
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+		row := make(map[string]interface{}, len(columns))
+		for i, column := range columns {
+			row[column] = values[i]
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+// resultInt reads an integer column of a rowRPC result
+func resultInt(result map[string]interface{}, column string) int64 {
+	switch v := result[column].(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	}
+	return 0
+}
+
+// resultString reads a text column of a rowRPC result
+func resultString(result map[string]interface{}, column string) string {
+	switch v := result[column].(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+// DownloadFile copies a file from the device to w in chunks, verifying every
+// chunk and the SHA-256 checksum of the whole file. The path must be
+// absolute and allowed by the server's file transfer configuration. If the
+// file changes during the download the checksum no longer matches and
+// ErrChecksumMismatch is returned; w then holds partial data.
+//
+// Example:
+//
+//	f, _ := os.Create("app.log")
+//	defer f.Close()
+//	n, err := bc.DownloadFile(ctx, "/var/log/myapp/app.log", f)
+func (bc *BurrowClient) DownloadFile(ctx context.Context, path string, w io.Writer) (int64, error) {
+	stat, err := bc.rowRPC(ctx, "FILE.GET:", fileRequest{Path: path})
+	if err != nil {
+		return 0, fmt.Errorf("download of %s failed: %w", path, err)
+	}
+	size := resultInt(stat, "size")
+	chunkSize := int(resultInt(stat, "chunk_size"))
+	if chunkSize <= 0 {
+		return 0, fmt.Errorf("download of %s failed: server reported no chunk size", path)
+	}
+
+	hasher := sha256.New()
+	var offset int64
+	for offset < size {
+		chunk, err := bc.rowRPC(ctx, "FILE.GET:", fileRequest{Path: path, Offset: offset, Length: chunkSize})
+		if err != nil {
+			return offset, fmt.Errorf("download of %s failed at offset %d: %w", path, offset, err)
+		}
+		data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(resultString(chunk, "data"), dataPrefix))
+		if err != nil {
+			return offset, fmt.Errorf("download of %s failed: invalid chunk data: %w", path, err)
+		}
+		if formatChecksum(sha256Sum(data)) != resultString(chunk, "chunk_checksum") {
+			return offset, fmt.Errorf("download of %s: chunk at offset %d: %w", path, offset, ErrChecksumMismatch)
+		}
+		if len(data) == 0 {
+			break // The file shrank since it was measured
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return offset, err
+		}
+		hasher.Write(data)
+		offset += int64(len(data))
+	}
+
+	if formatChecksum(hasher.Sum(nil)) != resultString(stat, "checksum") {
+		return offset, fmt.Errorf("download of %s: %w (file changed during transfer?)", path, ErrChecksumMismatch)
+	}
+	return offset, nil
+}
+
+// UploadFile copies r to a file on the device in chunks. The server writes
+// the chunks to a temporary file next to the target and only replaces the
+// target once the SHA-256 checksum of the whole upload matches, so readers
+// on the device never see a partial file. An existing file keeps its
+// permissions; new files are created with mode 0644.
+//
+// Example:
+//
+//	f, _ := os.Open("myapp.conf")
+//	defer f.Close()
+//	n, err := bc.UploadFile(ctx, "/etc/myapp/myapp.conf", f)
+func (bc *BurrowClient) UploadFile(ctx context.Context, path string, r io.Reader) (int64, error) {
+	// An empty first chunk opens the upload and tells the chunk size
+	opened, err := bc.rowRPC(ctx, "FILE.PUT:", fileRequest{Path: path})
+	if err != nil {
+		return 0, fmt.Errorf("upload to %s failed: %w", path, err)
+	}
+	uploadID := resultString(opened, "upload_id")
+	chunkSize := int(resultInt(opened, "chunk_size"))
+	if uploadID == "" || chunkSize <= 0 {
+		return 0, fmt.Errorf("upload to %s failed: server did not open the upload", path)
+	}
+
+	hasher := sha256.New()
+	buffer := make([]byte, chunkSize)
+	var offset int64
+	for {
+		n, readErr := io.ReadFull(r, buffer)
+		if readErr != nil && readErr != io.EOF && readErr != io.ErrUnexpectedEOF {
+			return offset, readErr
+		}
+		data := buffer[:n]
+		hasher.Write(data)
+		final := readErr != nil
+
+		req := fileRequest{
+			Path:          path,
+			Offset:        offset,
+			Data:          data,
+			ChunkChecksum: formatChecksum(sha256Sum(data)),
+			UploadID:      uploadID,
+			Final:         final,
+		}
+		if final {
+			req.Checksum = formatChecksum(hasher.Sum(nil))
+		}
+		if _, err := bc.rowRPC(ctx, "FILE.PUT:", req); err != nil {
+			return offset, fmt.Errorf("upload to %s failed at offset %d: %w", path, offset, err)
+		}
+		offset += int64(n)
+
+		if final {
+			return offset, nil
+		}
+	}
+}
+
+// sha256Sum returns the SHA-256 of data as a slice
+func sha256Sum(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// formatChecksum returns a SHA-256 sum as "sha256:<hex>"
+func formatChecksum(sum []byte) string {
+	return checksumPrefix + hex.EncodeToString(sum)
+}
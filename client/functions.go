@@ -0,0 +1,45 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// FunctionParamInfo describes one parameter of a server function
+type FunctionParamInfo struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"` // Go type expected by the server function
+	Description string `json:"description,omitempty"`
+}
+
+// FunctionInfo describes a function registered on the server
+type FunctionInfo struct {
+	Name        string              `json:"name"`
+	Namespace   string              `json:"namespace"` // "" for flat names
+	Description string              `json:"description,omitempty"`
+	Params      []FunctionParamInfo `json:"params"`
+	Returns     []string            `json:"returns"` // Go types of the return values
+}
+
+// ListFunctions discovers the functions registered on the server through the
+// built-in listFunctions function. A non-empty namespace (e.g. "system")
+// restricts the list to that namespace and its sub-namespaces.
+func (bc *BurrowClient) ListFunctions(ctx context.Context, namespace string) ([]FunctionInfo, error) {
+	result, err := bc.ExecFunctionContext(ctx, "listFunctions", StringParam(namespace))
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(result.Result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode function list: %w", err)
+	}
+	var catalog struct {
+		Functions []FunctionInfo `json:"functions"`
+	}
+	if err := json.Unmarshal(data, &catalog); err != nil {
+		return nil, fmt.Errorf("failed to decode function list: %w", err)
+	}
+	return catalog.Functions, nil
+}
@@ -2,6 +2,8 @@ package client
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -14,7 +16,8 @@ import (
 // HeartbeatConfig holds configuration for heartbeat and connection monitoring
 type HeartbeatConfig struct {
 	Enabled         bool          // Whether heartbeat is enabled
-	Interval        time.Duration // How often to send heartbeats
+	Interval        time.Duration // How often to send heartbeats while no RPC responses arrive
+	MaxInterval     time.Duration // Longest time between heartbeats while RPC responses prove liveness (<= Interval: always every Interval)
 	Timeout         time.Duration // How long to wait for heartbeat response
 	MaxMissedBeats  int           // Maximum missed heartbeats before considering connection dead
 	DisconnectDelay time.Duration // Delay before disconnecting after missed heartbeats
@@ -25,6 +28,7 @@ func DefaultHeartbeatConfig() *HeartbeatConfig {
 	return &HeartbeatConfig{
 		Enabled:         true,
 		Interval:        30 * time.Second, // Send heartbeat every 30 seconds
+		MaxInterval:     90 * time.Second, // Stretch to 90 seconds under RPC traffic
 		Timeout:         10 * time.Second, // Wait 10 seconds for response
 		MaxMissedBeats:  3,                // Allow 3 missed heartbeats
 		DisconnectDelay: 5 * time.Second,  // Wait 5 seconds before disconnecting
@@ -37,14 +41,20 @@ type HeartbeatManager struct {
 	connMgr  *ConnectionManager
 	deviceID string
 	clientIP string
+	clientID string // Per-process instance ID so the server can tell clients behind one IP apart
+
+	heartbeatQueue string // Server heartbeat queue (namespaced)
 
 	// State management
 	mutex         sync.RWMutex
-	isActive      bool      // Whether heartbeat is active
-	isRunning     bool      // Whether the goroutine is running
-	missedBeats   int       // Number of consecutive missed heartbeats
-	lastHeartbeat time.Time // Time of last heartbeat sent
-	lastResponse  time.Time // Time of last response received
+	isActive      bool          // Whether heartbeat is active
+	isRunning     bool          // Whether the goroutine is running
+	missedBeats   int           // Number of consecutive missed heartbeats
+	lastHeartbeat time.Time     // Time of last heartbeat sent
+	lastResponse  time.Time     // Time of last response received
+	lastActivity  time.Time     // Time of last RPC response received
+	interval      time.Duration // Current time between heartbeats
+	piggybacked   int64         // Heartbeats skipped because RPC responses proved liveness
 
 	// Channels for coordination
 	stopChan     chan struct{}
@@ -63,14 +73,26 @@ func NewHeartbeatManager(connMgr *ConnectionManager, deviceID, clientIP string,
 	}
 
 	return &HeartbeatManager{
-		config:       config,
-		connMgr:      connMgr,
-		deviceID:     deviceID,
-		clientIP:     clientIP,
-		stopChan:     make(chan struct{}),
-		activateChan: make(chan bool, 10),
-		responseChan: make(chan bool, 10),
+		config:         config,
+		connMgr:        connMgr,
+		deviceID:       deviceID,
+		clientIP:       clientIP,
+		clientID:       newClientID(),
+		heartbeatQueue: fmt.Sprintf("device_%s_heartbeat", deviceID),
+		interval:       config.Interval,
+		stopChan:       make(chan struct{}),
+		activateChan:   make(chan bool, 10),
+		responseChan:   make(chan bool, 10),
+	}
+}
+
+// newClientID returns a random identifier for this client instance.
+func newClientID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("client-%d", time.Now().UnixNano())
 	}
+	return "client-" + hex.EncodeToString(buf)
 }
 
 // ActivateHeartbeat activates the heartbeat (called when there's active RPC)
@@ -117,10 +139,26 @@ func (hm *HeartbeatManager) DeactivateHeartbeat() {
 	}
 }
 
-// heartbeatLoop sends heartbeats periodically
+// RecordActivity tells the manager an RPC response arrived. A response
+// proves the broker and the server are alive as well as a PONG does, so it
+// clears missed heartbeats and lets the next heartbeats be skipped.
+func (hm *HeartbeatManager) RecordActivity() {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+
+	hm.lastActivity = time.Now()
+	hm.missedBeats = 0
+}
+
+// heartbeatLoop sends heartbeats periodically. While RPC responses keep
+// arriving between two ticks, the heartbeat is skipped and the interval
+// doubles up to MaxInterval; a heartbeat is still sent once MaxInterval has
+// passed since the last one, so the server keeps tracking the client. The
+// interval falls back to Interval as soon as a tick sees no traffic.
 func (hm *HeartbeatManager) heartbeatLoop() {
-	ticker := time.NewTicker(hm.config.Interval)
-	defer ticker.Stop()
+	timer := time.NewTimer(hm.currentInterval())
+	defer timer.Stop()
+	lastTick := time.Now()
 
 	for {
 		select {
@@ -131,19 +169,49 @@ func (hm *HeartbeatManager) heartbeatLoop() {
 			hm.mutex.Lock()
 			hm.isActive = active
 			hm.mutex.Unlock()
-		case <-ticker.C:
-			// Only send heartbeat if active
-			hm.mutex.RLock()
-			shouldSend := hm.isActive
-			hm.mutex.RUnlock()
-
-			if shouldSend {
+		case <-timer.C:
+			// Only send heartbeat if active and not proven by RPC traffic
+			if hm.shouldSend(lastTick) {
 				hm.sendHeartbeat()
 			}
+			lastTick = time.Now()
+			timer.Reset(hm.currentInterval())
 		}
 	}
 }
 
+// shouldSend decides whether the tick sends a heartbeat and adapts the
+// interval to the RPC traffic seen since the previous tick
+func (hm *HeartbeatManager) shouldSend(lastTick time.Time) bool {
+	hm.mutex.Lock()
+	defer hm.mutex.Unlock()
+
+	if !hm.isActive {
+		return false
+	}
+	busy := hm.config.MaxInterval > hm.config.Interval && hm.lastActivity.After(lastTick)
+	if !busy {
+		hm.interval = hm.config.Interval
+		return true
+	}
+	if time.Since(hm.lastHeartbeat) >= hm.config.MaxInterval {
+		return true
+	}
+	hm.piggybacked++
+	hm.interval *= 2
+	if hm.interval > hm.config.MaxInterval {
+		hm.interval = hm.config.MaxInterval
+	}
+	return false
+}
+
+// currentInterval returns the time until the next tick
+func (hm *HeartbeatManager) currentInterval() time.Duration {
+	hm.mutex.RLock()
+	defer hm.mutex.RUnlock()
+	return hm.interval
+}
+
 // sendHeartbeat sends a heartbeat to the server using separate heartbeat queue
 func (hm *HeartbeatManager) sendHeartbeat() {
 	conn, err := hm.connMgr.GetConnection()
@@ -168,6 +236,9 @@ func (hm *HeartbeatManager) sendHeartbeat() {
 
 	// Generate unique correlation ID
 	corrID := fmt.Sprintf("heartbeat_%d", time.Now().UnixNano())
+	hm.mutex.Lock()
+	hm.lastHeartbeat = time.Now()
+	hm.mutex.Unlock()
 
 	// Build heartbeat request (PING)
 	ping := map[string]interface{}{
@@ -177,12 +248,14 @@ func (hm *HeartbeatManager) sendHeartbeat() {
 		"timestamp": time.Now().Unix(),
 		"corrID":    corrID,
 	}
+	if hm.clientID != "" {
+		ping["clientID"] = hm.clientID
+	}
 
 	body, _ := json.Marshal(ping)
 
 	// Send PING to separate heartbeat queue
-	heartbeatQueueName := fmt.Sprintf("device_%s_heartbeat", hm.deviceID)
-	err = ch.PublishWithContext(context.Background(), "", heartbeatQueueName, false, false, amqp.Publishing{
+	err = ch.PublishWithContext(context.Background(), "", hm.heartbeatQueue, false, false, amqp.Publishing{
 		ContentType:   "application/json",
 		CorrelationId: corrID,
 		ReplyTo:       replyQueue.Name,
@@ -233,8 +306,10 @@ func (hm *HeartbeatManager) handleMissedHeartbeat(reason string) {
 	defer hm.mutex.Unlock()
 
 	hm.missedBeats++
+	hm.interval = hm.config.Interval
 	log.Printf("[heartbeat] Missed heartbeat #%d: %s (device: %s)",
 		hm.missedBeats, reason, hm.deviceID)
+	observeHeartbeatMiss(hm.deviceID, reason)
 
 	if hm.missedBeats >= hm.config.MaxMissedBeats {
 		log.Printf("[heartbeat] Connection considered dead after %d missed heartbeats (device: %s)",
@@ -290,14 +365,20 @@ func (hm *HeartbeatManager) GetStats() HeartbeatStats {
 		MissedBeats:   hm.missedBeats,
 		LastHeartbeat: hm.lastHeartbeat,
 		LastResponse:  hm.lastResponse,
+		LastActivity:  hm.lastActivity,
+		Interval:      hm.interval,
+		Piggybacked:   hm.piggybacked,
 	}
 }
 
 // HeartbeatStats holds heartbeat monitoring statistics
 type HeartbeatStats struct {
-	IsActive      bool      // Whether heartbeat is active
-	IsRunning     bool      // Whether the goroutine is running
-	MissedBeats   int       // Number of consecutive missed heartbeats
-	LastHeartbeat time.Time // Time of last heartbeat sent
-	LastResponse  time.Time // Time of last response received
+	IsActive      bool          // Whether heartbeat is active
+	IsRunning     bool          // Whether the goroutine is running
+	MissedBeats   int           // Number of consecutive missed heartbeats
+	LastHeartbeat time.Time     // Time of last heartbeat sent
+	LastResponse  time.Time     // Time of last response received
+	LastActivity  time.Time     // Time of last RPC response, which counts as a heartbeat
+	Interval      time.Duration // Current time between heartbeats
+	Piggybacked   int64         // Heartbeats skipped because RPC responses proved liveness
 }
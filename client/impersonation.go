@@ -0,0 +1,40 @@
+package client
+
+import (
+	"context"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// onBehalfOfKey is the context key for the end user a request runs for.
+type onBehalfOfKey struct{}
+
+// WithOnBehalfOf returns a context that runs every query made with it on
+// behalf of the given end user, overriding the DSN default. The server checks
+// that the authenticated AMQP user may act for that user and records both in
+// its audit log.
+//
+// Example:
+//
+//	ctx := client.WithOnBehalfOf(r.Context(), session.UserName)
+//	db.ExecContext(ctx, "UPDATE orders SET status = ? WHERE id = ?", "cancelled", id)
+func WithOnBehalfOf(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, onBehalfOfKey{}, user)
+}
+
+// onBehalfOfFromContext returns the end user stored in ctx, if any.
+func onBehalfOfFromContext(ctx context.Context) (string, bool) {
+	user, ok := ctx.Value(onBehalfOfKey{}).(string)
+	return user, ok
+}
+
+// amqpUser returns the user name the client authenticates as. It is sent as
+// the message user_id, which RabbitMQ verifies against the connection, so the
+// server can trust it as the principal of on-behalf-of requests.
+func amqpUser(amqpURL string) string {
+	uri, err := amqp.ParseURI(amqpURL)
+	if err != nil {
+		return ""
+	}
+	return uri.Username
+}
@@ -0,0 +1,238 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// JobState is the lifecycle state of an asynchronous server job
+type JobState string
+
+const (
+	JobQueued    JobState = "queued"
+	JobRunning   JobState = "running"
+	JobSucceeded JobState = "succeeded"
+	JobFailed    JobState = "failed"
+	JobCancelled JobState = "cancelled"
+	JobUnknown   JobState = "unknown" // Reported by the server for IDs it does not know
+)
+
+// ErrJobNotFound is returned when the server does not know the job ID
+var ErrJobNotFound = errors.New("job not found")
+
+// JobStatus is the status of an asynchronous job as reported by the
+// server's getJobStatus function.
+type JobStatus struct {
+	ID         string      `json:"id"`
+	State      JobState    `json:"state"`
+	Progress   float64     `json:"progress"`          // Completion between 0 and 1
+	Message    string      `json:"message,omitempty"` // Last progress message
+	Result     interface{} `json:"result,omitempty"`  // Job result once succeeded
+	Error      string      `json:"error,omitempty"`   // Failure reason once failed
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+}
+
+// IsTerminal reports whether the job has finished and will not change again
+func (s JobStatus) IsTerminal() bool {
+	switch s.State {
+	case JobSucceeded, JobFailed, JobCancelled:
+		return true
+	}
+	return false
+}
+
+// JobError is returned by WaitForJob when the job failed or was cancelled
+type JobError struct {
+	Status JobStatus
+}
+
+func (e *JobError) Error() string {
+	if e.Status.Error != "" {
+		return fmt.Sprintf("job %s %s: %s", e.Status.ID, e.Status.State, e.Status.Error)
+	}
+	return fmt.Sprintf("job %s %s", e.Status.ID, e.Status.State)
+}
+
+// WaitOptions controls how WaitForJob polls for job status
+type WaitOptions struct {
+	InitialInterval time.Duration   // First polling interval (default 250ms)
+	MaxInterval     time.Duration   // Upper bound for the polling interval (default 10s)
+	Multiplier      float64         // Backoff factor applied after each poll (default 2)
+	OnProgress      func(JobStatus) // Called whenever state, progress or message changes
+}
+
+// DefaultWaitOptions returns the default polling configuration
+func DefaultWaitOptions() WaitOptions {
+	return WaitOptions{
+		InitialInterval: 250 * time.Millisecond,
+		MaxInterval:     10 * time.Second,
+		Multiplier:      2,
+	}
+}
+
+// jobRequest is the body of a "JOB:" request
+type jobRequest struct {
+	Kind    string          `json:"kind"`
+	Name    string          `json:"name,omitempty"`
+	Params  []FunctionParam `json:"params,omitempty"`
+	Command string          `json:"command,omitempty"`
+}
+
+// submitJob queues a job on the server and returns its ID.
+func (bc *BurrowClient) submitJob(ctx context.Context, req jobRequest) (string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal job request: %w", err)
+	}
+
+	rows, err := bc.db.QueryContext(ctx, "JOB:"+string(body))
+	if err != nil {
+		return "", fmt.Errorf("job submission failed: %w", err)
+	}
+	defer rows.Close()
+
+	var id string
+	if rows.Next() {
+		if err := rows.Scan(&id); err != nil {
+			return "", fmt.Errorf("failed to scan job ID: %w", err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if id == "" {
+		return "", fmt.Errorf("server returned no job ID")
+	}
+	return id, nil
+}
+
+// SubmitFunctionJob runs a registered server function as an asynchronous
+// job and returns its ID without waiting for the function to finish. Use it
+// for work that outlasts the RPC timeout, then follow the job with
+// GetJobStatus or WaitForJob.
+//
+// Example:
+//
+//	id, err := bc.SubmitFunctionJob(ctx, "reindexAll", client.StringParam("orders"))
+//	status, err := bc.WaitForJob(ctx, id, client.DefaultWaitOptions())
+func (bc *BurrowClient) SubmitFunctionJob(ctx context.Context, name string, params ...FunctionParam) (string, error) {
+	return bc.submitJob(ctx, jobRequest{Kind: "function", Name: name, Params: params})
+}
+
+// SubmitCommandJob runs a system command as an asynchronous job and returns
+// its ID. The job result is the command's output, one element per line.
+func (bc *BurrowClient) SubmitCommandJob(ctx context.Context, command string) (string, error) {
+	return bc.submitJob(ctx, jobRequest{Kind: "command", Command: command})
+}
+
+// CancelJob cancels a queued or running job. A running function cannot be
+// interrupted; its result is discarded when it returns.
+func (bc *BurrowClient) CancelJob(ctx context.Context, id string) error {
+	result, err := bc.ExecFunctionContext(ctx, "cancelJob", StringParam(id))
+	if err != nil {
+		return err
+	}
+	if result.Result != "success" {
+		return fmt.Errorf("failed to cancel job %s: %v", id, result.Result)
+	}
+	return nil
+}
+
+// GetJobStatus fetches the current status of an asynchronous job.
+func (bc *BurrowClient) GetJobStatus(ctx context.Context, id string) (*JobStatus, error) {
+	result, err := bc.ExecFunctionContext(ctx, "getJobStatus", StringParam(id))
+	if err != nil {
+		return nil, err
+	}
+
+	// The server returns the status as a JSON document, which ExecFunction
+	// has already decoded; round-trip it into the typed struct.
+	data, err := json.Marshal(result.Result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode job status: %w", err)
+	}
+	var status JobStatus
+	if err := json.Unmarshal(data, &status); err != nil {
+		return nil, fmt.Errorf("failed to decode job status: %w", err)
+	}
+
+	if status.State == "" || status.State == JobUnknown {
+		return nil, fmt.Errorf("%w: %s", ErrJobNotFound, id)
+	}
+	return &status, nil
+}
+
+// WaitForJob polls the job with exponential backoff until it reaches a
+// terminal state or ctx is done. The polling interval resets to
+// InitialInterval whenever the job reports progress, so active jobs are
+// followed closely while idle ones are polled less and less often.
+//
+// Parameters:
+//   - ctx: Bounds the total wait
+//   - id: Job ID returned when the job was submitted
+//   - opts: Polling configuration; zero fields take the defaults
+//
+// Returns:
+//   - *JobStatus: The final status (also returned alongside a JobError)
+//   - error: *JobError if the job failed or was cancelled, ErrJobNotFound,
+//     ctx.Err() on timeout, or a transport error
+func (bc *BurrowClient) WaitForJob(ctx context.Context, id string, opts WaitOptions) (*JobStatus, error) {
+	defaults := DefaultWaitOptions()
+	if opts.InitialInterval <= 0 {
+		opts.InitialInterval = defaults.InitialInterval
+	}
+	if opts.MaxInterval <= 0 {
+		opts.MaxInterval = defaults.MaxInterval
+	}
+	if opts.Multiplier < 1 {
+		opts.Multiplier = defaults.Multiplier
+	}
+
+	interval := opts.InitialInterval
+	var last *JobStatus
+
+	for {
+		status, err := bc.GetJobStatus(ctx, id)
+		if err != nil {
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				return last, ctxErr
+			}
+			return last, err
+		}
+
+		if last == nil || status.State != last.State || status.Progress != last.Progress || status.Message != last.Message {
+			if opts.OnProgress != nil {
+				opts.OnProgress(*status)
+			}
+			if last != nil {
+				interval = opts.InitialInterval
+			}
+		}
+		last = status
+
+		if status.IsTerminal() {
+			if status.State != JobSucceeded {
+				return status, &JobError{Status: *status}
+			}
+			return status, nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return last, ctx.Err()
+		case <-timer.C:
+		}
+
+		interval = time.Duration(float64(interval) * opts.Multiplier)
+		if interval > opts.MaxInterval {
+			interval = opts.MaxInterval
+		}
+	}
+}
@@ -0,0 +1,198 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// LogTailOptions selects what TailLog follows: a file or a journald unit
+type LogTailOptions struct {
+	Path  string // Absolute path of a log file on the device
+	Unit  string // journald unit (used when Path is empty)
+	Lines int    // Lines of history to receive first (capped by the server)
+}
+
+// LogLine is a line of a tailed log
+type LogLine struct {
+	Seq  int64     // Position of the line in the tail, counting from 1
+	Line string    // The line without its terminator
+	Time time.Time // When the server published the line
+}
+
+// logTailRequest is the body of a "LOG.TAIL:" request
+type logTailRequest struct {
+	TailID string `json:"tailID"`
+	Path   string `json:"path,omitempty"`
+	Unit   string `json:"unit,omitempty"`
+	Lines  int    `json:"lines,omitempty"`
+	Stop   bool   `json:"stop,omitempty"`
+}
+
+// logTailEvent is the payload of the events of a tail
+type logTailEvent struct {
+	Seq   int64    `json:"seq"`
+	Lines []string `json:"lines"`
+	Done  bool     `json:"done"`
+	Error string   `json:"error"`
+}
+
+// LogTail is a running TailLog. Read lines from Lines until it is closed,
+// then check Err.
+type LogTail struct {
+	bc     *BurrowClient
+	id     string
+	lines  chan LogLine
+	cancel context.CancelFunc
+
+	mutex sync.Mutex
+	err   error
+}
+
+// TailLog follows a log file or journald unit on the device, delivering its
+// lines until ctx is done or Stop is called. The path or unit must be
+// allowed by the server's log tail configuration.
+//
+// Lines travel as events (see Subscribe) over a connection of their own. The
+// client renews the tail's lease on the server while it runs, so a tail of
+// a client that disappears stops by itself. Lines published while the event
+// connection is being re-established are missed; Seq reveals the gap.
+//
+// Example:
+//
+//	tail, err := bc.TailLog(ctx, client.LogTailOptions{Unit: "nginx.service", Lines: 50})
+//	if err != nil {
+//		return err
+//	}
+//	for line := range tail.Lines() {
+//		fmt.Println(line.Line)
+//	}
+//	if err := tail.Err(); err != nil {
+//		log.Printf("tail ended: %v", err)
+//	}
+func (bc *BurrowClient) TailLog(ctx context.Context, opts LogTailOptions) (*LogTail, error) {
+	if opts.Path == "" && opts.Unit == "" {
+		return nil, fmt.Errorf("log tail needs a path or a unit")
+	}
+
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return nil, fmt.Errorf("failed to generate tail ID: %w", err)
+	}
+	id := "tail-" + hex.EncodeToString(random)
+
+	// Subscribe first so the first lines are not missed
+	tailCtx, cancel := context.WithCancel(ctx)
+	events, err := bc.Subscribe(tailCtx, "logtail:"+id)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	started, err := bc.rowRPC(ctx, "LOG.TAIL:", logTailRequest{TailID: id, Path: opts.Path, Unit: opts.Unit, Lines: opts.Lines})
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("log tail failed: %w", err)
+	}
+	lease := time.Duration(resultInt(started, "lease_ms")) * time.Millisecond
+	if lease <= 0 {
+		cancel()
+		return nil, fmt.Errorf("log tail failed: server reported no lease")
+	}
+
+	tail := &LogTail{bc: bc, id: id, lines: make(chan LogLine), cancel: cancel}
+	go tail.run(tailCtx, events, lease)
+	return tail, nil
+}
+
+// Lines returns the channel lines are delivered on; it is closed when the tail ends
+func (t *LogTail) Lines() <-chan LogLine {
+	return t.lines
+}
+
+// Err returns why the tail ended once Lines is closed, or nil if it was
+// stopped by the client
+func (t *LogTail) Err() error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.err
+}
+
+// Stop ends the tail
+func (t *LogTail) Stop() {
+	t.cancel()
+}
+
+// setErr records the first reason the tail ended
+func (t *LogTail) setErr(err error) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.err == nil {
+		t.err = err
+	}
+}
+
+// run delivers lines and renews the lease until the tail ends
+func (t *LogTail) run(ctx context.Context, events <-chan Event, lease time.Duration) {
+	defer close(t.lines)
+	defer t.cancel()
+
+	renew := time.NewTicker(lease / 3)
+	defer renew.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			t.stop()
+			return
+		case <-renew.C:
+			renewCtx, cancel := context.WithTimeout(ctx, lease/3)
+			_, err := t.bc.rowRPC(renewCtx, "LOG.TAIL:", logTailRequest{TailID: t.id})
+			cancel()
+			if err != nil && ctx.Err() == nil {
+				t.setErr(fmt.Errorf("log tail lease renewal failed: %w", err))
+				t.stop()
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				if ctx.Err() == nil {
+					t.setErr(errors.New("log tail event subscription lost"))
+				}
+				t.stop()
+				return
+			}
+
+			var payload logTailEvent
+			if err := event.Decode(&payload); err != nil {
+				continue
+			}
+			for i, line := range payload.Lines {
+				select {
+				case t.lines <- LogLine{Seq: payload.Seq + int64(i), Line: line, Time: event.Timestamp}:
+				case <-ctx.Done():
+					t.stop()
+					return
+				}
+			}
+			if payload.Done {
+				if payload.Error != "" {
+					t.setErr(fmt.Errorf("log tail ended on the device: %s", payload.Error))
+				}
+				return
+			}
+		}
+	}
+}
+
+// stop asks the server to end the tail; failures are ignored since the
+// lease ends it anyway
+func (t *LogTail) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	t.bc.rowRPC(ctx, "LOG.TAIL:", logTailRequest{TailID: t.id, Stop: true})
+}
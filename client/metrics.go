@@ -0,0 +1,172 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// RequestEvent describes one request sent to a device
+type RequestEvent struct {
+	DeviceID  string        // Device the request was sent to
+	Type      string        // Request type: "sql", "function", "command", "transaction", ...
+	Latency   time.Duration // Time from the call until the result was available
+	RoundTrip time.Duration // Time from publishing the request until the response arrived (0 if none did)
+	Timeout   bool          // The request's context deadline passed before the response arrived
+	Err       error         // nil on success
+}
+
+// ReconnectEvent describes one attempt to restore a lost broker connection
+type ReconnectEvent struct {
+	DeviceID string // Device the connection serves
+	Attempt  int    // Attempt number since the connection was lost
+	Err      error  // nil when the connection was restored
+}
+
+// Metrics receives measurements from the driver, so services embedding it
+// can monitor it. Register an implementation with SetMetrics. Methods are
+// called on the request path: they must be safe for concurrent use and
+// return quickly.
+type Metrics interface {
+	// RequestDone is called once per request, after the result is available
+	RequestDone(event RequestEvent)
+	// Retried is called when a request is sent again, e.g. because the
+	// server lost the prepared statement it named
+	Retried(deviceID, reason string)
+	// Reconnected is called after every reconnection attempt
+	Reconnected(event ReconnectEvent)
+	// HeartbeatMissed is called when a heartbeat got no answer
+	HeartbeatMissed(deviceID, reason string)
+}
+
+// DiscardMetrics is implemented by a Metrics that also wants to know about
+// responses the driver discarded because no request was waiting for them.
+// reason is DiscardLate for a response to a request that had already timed
+// out or been cancelled, DiscardUnknown for a correlation ID the connection
+// never sent.
+type DiscardMetrics interface {
+	ResponseDiscarded(deviceID, reason string)
+}
+
+// metricsHolder wraps the registered Metrics so atomic.Value always stores
+// the same type
+type metricsHolder struct {
+	metrics Metrics
+}
+
+var registeredMetrics atomic.Value // metricsHolder
+
+// SetMetrics registers m to receive the measurements of every connection
+// of the process; nil stops reporting.
+//
+// Example:
+//
+//	client.SetMetrics(client.NewExpvarMetrics("burrowctl"))
+func SetMetrics(m Metrics) {
+	registeredMetrics.Store(metricsHolder{metrics: m})
+}
+
+// currentMetrics returns the registered Metrics, or nil
+func currentMetrics() Metrics {
+	holder, _ := registeredMetrics.Load().(metricsHolder)
+	return holder.metrics
+}
+
+// observeRequest reports a finished request to the registered Metrics
+func observeRequest(ctx context.Context, deviceID, requestType string, start time.Time, roundTrip time.Duration, err error) {
+	metrics := currentMetrics()
+	if metrics == nil {
+		return
+	}
+	metrics.RequestDone(RequestEvent{
+		DeviceID:  deviceID,
+		Type:      requestType,
+		Latency:   time.Since(start),
+		RoundTrip: roundTrip,
+		Timeout:   err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded),
+		Err:       err,
+	})
+}
+
+// observeRetry reports a request sent again to the registered Metrics
+func observeRetry(deviceID, reason string) {
+	if metrics := currentMetrics(); metrics != nil {
+		metrics.Retried(deviceID, reason)
+	}
+}
+
+// observeReconnect reports a reconnection attempt to the registered Metrics
+func observeReconnect(deviceID string, attempt int, err error) {
+	if metrics := currentMetrics(); metrics != nil {
+		metrics.Reconnected(ReconnectEvent{DeviceID: deviceID, Attempt: attempt, Err: err})
+	}
+}
+
+// observeHeartbeatMiss reports a missed heartbeat to the registered Metrics
+func observeHeartbeatMiss(deviceID, reason string) {
+	if metrics := currentMetrics(); metrics != nil {
+		metrics.HeartbeatMissed(deviceID, reason)
+	}
+}
+
+// observeDiscard reports a discarded response to the registered Metrics, if
+// it implements DiscardMetrics
+func observeDiscard(deviceID, reason string) {
+	if metrics, ok := currentMetrics().(DiscardMetrics); ok {
+		metrics.ResponseDiscarded(deviceID, reason)
+	}
+}
+
+// ExpvarMetrics is a Metrics and DiscardMetrics that publishes counters with the expvar
+// package, so they are served on /debug/vars next to the Go runtime's.
+// Latencies are published as running totals in nanoseconds; divide by the
+// request count for the mean.
+type ExpvarMetrics struct {
+	vars *expvar.Map
+}
+
+// NewExpvarMetrics publishes the driver counters as the expvar map name.
+// Like expvar.Publish, it panics if name is already in use.
+func NewExpvarMetrics(name string) *ExpvarMetrics {
+	return &ExpvarMetrics{vars: expvar.NewMap(name)}
+}
+
+// RequestDone counts the request, its outcome and its latencies
+func (m *ExpvarMetrics) RequestDone(event RequestEvent) {
+	m.vars.Add("requests", 1)
+	m.vars.Add("requests_"+event.Type, 1)
+	m.vars.Add("latency_ns_total", int64(event.Latency))
+	m.vars.Add("roundtrip_ns_total", int64(event.RoundTrip))
+	if event.Err != nil {
+		m.vars.Add("errors", 1)
+	}
+	if event.Timeout {
+		m.vars.Add("timeouts", 1)
+	}
+}
+
+// Retried counts the retry
+func (m *ExpvarMetrics) Retried(deviceID, reason string) {
+	m.vars.Add("retries", 1)
+}
+
+// Reconnected counts the attempt and whether it failed
+func (m *ExpvarMetrics) Reconnected(event ReconnectEvent) {
+	m.vars.Add("reconnect_attempts", 1)
+	if event.Err != nil {
+		m.vars.Add("reconnect_failures", 1)
+	}
+}
+
+// HeartbeatMissed counts the missed heartbeat
+func (m *ExpvarMetrics) HeartbeatMissed(deviceID, reason string) {
+	m.vars.Add("heartbeat_misses", 1)
+}
+
+// ResponseDiscarded counts the discarded response and its reason
+func (m *ExpvarMetrics) ResponseDiscarded(deviceID, reason string) {
+	m.vars.Add("responses_discarded", 1)
+	m.vars.Add("responses_"+reason, 1)
+}
@@ -0,0 +1,196 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Status of a migration in a MigrationResult
+const (
+	MigrationApplied       = "applied"         // Applied, by this call or earlier
+	MigrationPending       = "pending"         // Not applied yet
+	MigrationModified      = "modified"        // Applied, but its up script changed since
+	MigrationWouldApply    = "would_apply"     // Dry run: would be applied
+	MigrationRolledBack    = "rolled_back"     // Rolled back by this call
+	MigrationWouldRollBack = "would_roll_back" // Dry run: would be rolled back
+	MigrationFailed        = "failed"          // Failed; later migrations were not run
+)
+
+// Migration is one schema change. Migrations apply in ascending Version
+// order, compared as strings: use fixed-width numbers or timestamps.
+type Migration struct {
+	Version string `json:"version"`
+	Name    string `json:"name"`
+	Up      string `json:"up"`   // SQL script applying the migration
+	Down    string `json:"down"` // SQL script undoing it (optional, needed to roll back)
+}
+
+// MigrateOptions tunes Migrate and RollbackMigrations
+type MigrateOptions struct {
+	DryRun bool   // Report what would run and validate it on the server, without changing anything
+	Target string // Migrate: last version to apply; RollbackMigrations: roll back every version after it ("0": all)
+	Steps  int    // RollbackMigrations without Target: migrations to roll back, newest first (default 1)
+}
+
+// MigrationResult is the state of one migration after a call
+type MigrationResult struct {
+	Version   string
+	Name      string
+	Status    string        // One of the Migration* statuses
+	AppliedAt time.Time     // When the migration was applied (zero if it is not)
+	Duration  time.Duration // Time the up or down script ran
+	Error     string        // Why the migration failed
+}
+
+// migrateRequest is the body of a "MIGRATE:" request
+type migrateRequest struct {
+	Action     string      `json:"action"`
+	Migrations []Migration `json:"migrations"`
+	DryRun     bool        `json:"dryRun,omitempty"`
+	Steps      int         `json:"steps,omitempty"`
+	Target     string      `json:"target,omitempty"`
+}
+
+// LoadMigrations reads migrations from the files of a directory, such as
+// os.DirFS("migrations") or an embed.FS. Files are named
+// <version>_<name>.up.sql and <version>_<name>.down.sql; a plain
+// <version>_<name>.sql is an up script without down script. Other files are
+// ignored.
+func LoadMigrations(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[string]*Migration)
+	for _, entry := range entries {
+		file := entry.Name()
+		if entry.IsDir() || path.Ext(file) != ".sql" {
+			continue
+		}
+		base := strings.TrimSuffix(file, ".sql")
+		down := strings.HasSuffix(base, ".down")
+		base = strings.TrimSuffix(strings.TrimSuffix(base, ".down"), ".up")
+
+		version, name, _ := strings.Cut(base, "_")
+		if version == "" {
+			return nil, fmt.Errorf("migration file %s has no version", file)
+		}
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		migration := byVersion[version]
+		if migration == nil {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		} else if migration.Name != name {
+			return nil, fmt.Errorf("migration version %s is used by %s and %s", version, migration.Name, name)
+		}
+		if down {
+			migration.Down = string(content)
+		} else if migration.Up != "" {
+			return nil, fmt.Errorf("migration %s has more than one up script", version)
+		} else {
+			migration.Up = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %s has no up script", migration.Version)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrate applies the migrations the device database has not applied yet,
+// oldest first, up to opts.Target. The server records applied migrations
+// in a schema_migrations table; each one runs in a transaction of its own
+// together with its record, and the run stops at the first failure, which
+// is returned as an error along with the results. Applying fails if an
+// applied migration's up script has changed since.
+//
+// MySQL commits implicitly around DDL statements (CREATE, ALTER, DROP,
+// ...): a migration that fails after one of them has partly run and is not
+// recorded, so keep each DDL statement in a migration of its own.
+//
+// Example:
+//
+//	migrations, err := client.LoadMigrations(os.DirFS("migrations"))
+//	results, err := bc.Migrate(ctx, migrations, client.MigrateOptions{DryRun: true})
+func (bc *BurrowClient) Migrate(ctx context.Context, migrations []Migration, opts MigrateOptions) ([]MigrationResult, error) {
+	return bc.migrate(ctx, migrateRequest{Action: "apply", Migrations: migrations, DryRun: opts.DryRun, Target: opts.Target})
+}
+
+// RollbackMigrations runs the down scripts of the newest applied
+// migrations, newest first: every one after opts.Target, or opts.Steps of
+// them. The server uses the down script recorded when the migration was
+// applied, or the one in migrations if none was.
+func (bc *BurrowClient) RollbackMigrations(ctx context.Context, migrations []Migration, opts MigrateOptions) ([]MigrationResult, error) {
+	return bc.migrate(ctx, migrateRequest{
+		Action:     "rollback",
+		Migrations: migrations,
+		DryRun:     opts.DryRun,
+		Steps:      opts.Steps,
+		Target:     opts.Target,
+	})
+}
+
+// MigrationStatus lists migrations and those only the device database
+// knows, oldest first, with whether each is applied
+func (bc *BurrowClient) MigrationStatus(ctx context.Context, migrations []Migration) ([]MigrationResult, error) {
+	return bc.migrate(ctx, migrateRequest{Action: "status", Migrations: migrations})
+}
+
+// migrate sends a "MIGRATE:" request and reads its result rows
+func (bc *BurrowClient) migrate(ctx context.Context, req migrateRequest) ([]MigrationResult, error) {
+	if req.Migrations == nil {
+		req.Migrations = []Migration{}
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	rows, err := bc.db.QueryContext(ctx, "MIGRATE:"+string(body))
+	if err != nil {
+		return nil, err
+	}
+	migrations, err := allRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []MigrationResult
+	for _, row := range migrations {
+		result := MigrationResult{
+			Version:  resultString(row, "version"),
+			Name:     resultString(row, "name"),
+			Status:   resultString(row, "status"),
+			Duration: time.Duration(resultInt(row, "duration_ms")) * time.Millisecond,
+			Error:    resultString(row, "error"),
+		}
+		if at := resultString(row, "applied_at"); at != "" {
+			result.AppliedAt, _ = time.Parse(time.RFC3339, at)
+		}
+		results = append(results, result)
+	}
+
+	for _, result := range results {
+		if result.Status == MigrationFailed {
+			return results, fmt.Errorf("migration %s failed: %s", result.Version, result.Error)
+		}
+	}
+	return results, nil
+}
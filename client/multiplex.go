@@ -0,0 +1,110 @@
+package client
+
+import (
+	"fmt"
+	"sync/atomic"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// currentMux returns the multiplexed channel of the current connection,
+// opening it on first use and again after a reconnect or a channel failure.
+// Every request of the connection is published on it, concurrently; a single
+// consumer goroutine reads the responses (through direct reply-to) and the
+// publishes the broker returned, and hands each to the waiting request by
+// correlation ID.
+func (cm *ConnectionManager) currentMux() (*pooledChannel, error) {
+	conn, err := cm.GetConnection()
+	if err != nil {
+		return nil, fmt.Errorf("no active connection: %v", err)
+	}
+
+	cm.muxMutex.Lock()
+	defer cm.muxMutex.Unlock()
+
+	if cm.mux != nil && cm.mux.healthy(conn) {
+		return cm.mux, nil
+	}
+	if cm.mux != nil {
+		cm.mux.Close()
+	}
+
+	pc, unsupported, err := openPooledChannel(conn, atomic.LoadInt32(&cm.directReplies) == 1)
+	if unsupported && atomic.CompareAndSwapInt32(&cm.directReplies, 1, 0) {
+		cm.logf("Broker does not support direct reply-to, using a reply queue")
+	}
+	if err != nil {
+		cm.mux = nil
+		return nil, fmt.Errorf("failed to create RabbitMQ channel: %v", err)
+	}
+	atomic.AddInt64(&cm.channelsOpened, 1)
+	cm.mux = pc
+	go cm.consumeMux(pc)
+	cm.logf("Multiplexed channel opened (direct reply-to: %v)", pc.replies != nil)
+	return pc, nil
+}
+
+// consumeMux dispatches the responses and returned publishes of a
+// multiplexed channel until it closes
+func (cm *ConnectionManager) consumeMux(pc *pooledChannel) {
+	replies, returns := pc.replies, (<-chan amqp.Return)(pc.returns)
+	for {
+		select {
+		case msg, ok := <-replies:
+			if !ok {
+				replies = nil
+				continue
+			}
+			cm.pending.dispatch(msg)
+		case ret, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			cm.pending.returned(ret)
+		case <-pc.lost:
+			return
+		}
+	}
+}
+
+// openMuxRequest records the request for corrID and returns the
+// multiplexed channel to publish it on
+func (cm *ConnectionManager) openMuxRequest(corrID string) (*requestChannel, error) {
+	pc, err := cm.currentMux()
+	if err != nil {
+		return nil, err
+	}
+	r := &requestChannel{
+		Channel:  pc.Channel,
+		lost:     pc.lost,
+		closeErr: func() *amqp.Error { return pc.closeErr },
+		corrID:   corrID,
+		pending:  cm.pending,
+		release:  func() {}, // The channel stays with the connection
+	}
+	if pc.replies != nil {
+		r.replyTo = directReplyTo
+	} else {
+		replies, err := cm.currentReplyQueue()
+		if err != nil {
+			return nil, fmt.Errorf("failed to declare reply queue: %w", err)
+		}
+		r.replyTo = replies.name
+		r.done = replies.done
+	}
+	w := cm.pending.register(corrID, true)
+	r.msgs = w.msgs
+	r.returns = w.returned
+	return r, nil
+}
+
+// closeMux closes the multiplexed channel, if one is open
+func (cm *ConnectionManager) closeMux() {
+	cm.muxMutex.Lock()
+	defer cm.muxMutex.Unlock()
+	if cm.mux != nil {
+		cm.mux.Close()
+		cm.mux = nil
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// maxAMQPNameLength is the longest queue or exchange name RabbitMQ accepts.
+const maxAMQPNameLength = 255
+
+// namespacePattern restricts namespaces to characters that are safe in AMQP
+// names and in RabbitMQ policy patterns.
+var namespacePattern = regexp.MustCompile(`^[A-Za-z0-9._:-]*$`)
+
+// Topology holds the RabbitMQ object names used for a single device. Both the
+// client and the server derive names from it so that they always agree.
+//
+// Every name is prefixed with the namespace, which allows several
+// environments (e.g. "prod.siteA." and "staging.") to share one cluster:
+//
+//	<namespace>device_<deviceID>_rpc
+//	<namespace>device_<deviceID>_heartbeat
+//	<namespace>device_<deviceID>_events
+//	<namespace>device_<deviceID>_cluster
+//	<namespace>device_<deviceID>_control
+//	<namespace>device_<deviceID>_dlx
+//	<namespace>device_<deviceID>_dlq
+//	<namespace>device_<deviceID>_rpc_instance_<instanceID>
+//	<namespace>burrowctl_telemetry (shared by every device of the namespace)
+type Topology struct {
+	Namespace       string // Prefix applied to every name (may be empty)
+	DeviceID        string // Device the names belong to
+	RPCQueue        string // Queue the server consumes RPC requests from
+	HeartbeatQueue  string // Queue the server consumes heartbeat PINGs from
+	EventsExchange  string // Exchange the server publishes device events to
+	ClusterExchange string // Exchange server instances sharing the RPC queue coordinate over
+	ControlQueue    string // Queue a starting server asks the running one to hand over on
+
+	TelemetryExchange string // Exchange the devices of the namespace publish telemetry to, routed by device ID
+
+	DeadLetterExchange string // Exchange expired and rejected requests are routed to
+	DeadLetterQueue    string // Queue keeping dead-lettered requests for inspection
+}
+
+// NewTopology validates the namespace and builds the names for deviceID.
+//
+// Parameters:
+//   - namespace: Name prefix, e.g. "prod.siteA." (empty for none)
+//   - deviceID: Target device identifier
+//
+// Returns:
+//   - Topology: The derived queue and exchange names
+//   - error: Validation error for an invalid namespace or an overlong name
+func NewTopology(namespace, deviceID string) (Topology, error) {
+	if err := ValidateNamespace(namespace); err != nil {
+		return Topology{}, err
+	}
+
+	base := namespace + "device_" + deviceID
+	topology := Topology{
+		Namespace:       namespace,
+		DeviceID:        deviceID,
+		RPCQueue:        base + "_rpc",
+		HeartbeatQueue:  base + "_heartbeat",
+		EventsExchange:  base + "_events",
+		ClusterExchange: base + "_cluster",
+		ControlQueue:    base + "_control",
+
+		TelemetryExchange: namespace + "burrowctl_telemetry",
+
+		DeadLetterExchange: base + "_dlx",
+		DeadLetterQueue:    base + "_dlq",
+	}
+
+	if len(topology.HeartbeatQueue) > maxAMQPNameLength {
+		return Topology{}, fmt.Errorf("queue name '%s' exceeds %d bytes; use a shorter namespace or device ID",
+			topology.HeartbeatQueue, maxAMQPNameLength)
+	}
+	return topology, nil
+}
+
+// InstanceQueue returns the queue a single server instance consumes when
+// several instances share the RPC queue. Requests of a transaction are sent
+// there because only the instance that began it holds it.
+func (t Topology) InstanceQueue(instanceID string) string {
+	return t.RPCQueue + "_instance_" + instanceID
+}
+
+// ValidateNamespace checks that a namespace only contains letters, digits,
+// '.', '_', ':' and '-'.
+func ValidateNamespace(namespace string) error {
+	if !namespacePattern.MatchString(namespace) {
+		return fmt.Errorf("invalid namespace '%s': only letters, digits, '.', '_', ':' and '-' are allowed", namespace)
+	}
+	return nil
+}
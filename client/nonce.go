@@ -0,0 +1,41 @@
+package client
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// newNonce returns a random single-use request ID. Sent with the time the
+// request was made, it lets the server reject requests captured and
+// published again.
+func newNonce() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// marshalRequest serializes a request. With a signing key in the DSN,
+// stamped requests also carry their signature: the hex HMAC-SHA256 of the
+// request serialized without it, so the nonce and timestamp cannot be
+// replaced in a copy of the request.
+func (c *Conn) marshalRequest(req map[string]interface{}) ([]byte, error) {
+	if _, stamped := req["nonce"]; !stamped || c.config.SigningKey == "" {
+		return json.Marshal(req)
+	}
+
+	unsigned, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	mac := hmac.New(sha256.New, []byte(c.config.SigningKey))
+	mac.Write(unsigned)
+	req["signature"] = hex.EncodeToString(mac.Sum(nil))
+	return json.Marshal(req)
+}
@@ -0,0 +1,39 @@
+package client
+
+import (
+	"fmt"
+	"time"
+)
+
+// ErrCodeOverloaded is the error code of requests the server shed because
+// its memory or CPU use was above its thresholds
+const ErrCodeOverloaded = "OVERLOADED"
+
+// OverloadedError is returned for low-priority requests (low priority,
+// batches, bulk transfers, exports, scripts, migrations, jobs) the server
+// shed under load. Retry after RetryAfter, or send the request with
+// WithPriority(ctx, PriorityHigh) if it cannot wait.
+type OverloadedError struct {
+	Message    string        // Server's error message
+	Reason     string        // Threshold exceeded: "memory" or "cpu"
+	MemoryMB   float64       // Server process RSS
+	CPUPercent float64       // Server process CPU use, in percent of all cores
+	RetryAfter time.Duration // Time until the server samples its load again
+}
+
+// Error implements the error interface.
+func (e *OverloadedError) Error() string {
+	return fmt.Sprintf("server error: %s", e.Message)
+}
+
+// overloadedError returns the error of a response shed under load
+func overloadedError(resp RPCResponse) error {
+	err := &OverloadedError{Message: resp.Error}
+	if resp.Overload != nil {
+		err.Reason = resp.Overload.Reason
+		err.MemoryMB = resp.Overload.MemoryMB
+		err.CPUPercent = resp.Overload.CPUPercent
+		err.RetryAfter = time.Duration(resp.Overload.RetryAfterMs) * time.Millisecond
+	}
+	return err
+}
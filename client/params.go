@@ -0,0 +1,66 @@
+package client
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// paramTimeFormat is how time.Time parameters are sent: MySQL's DATETIME
+// text format, which the server passes to the database as is
+const paramTimeFormat = "2006-01-02 15:04:05.999999"
+
+// CheckNamedValue implements the driver.NamedValueChecker interface, for
+// both the connection and its prepared statements. Parameters travel as
+// JSON, so values JSON does not carry faithfully are converted first:
+// time.Time becomes MySQL DATETIME text in the DSN's loc (what RFC 3339
+// would not match in a DATETIME column), and []byte becomes text. Valuers
+// and named types (sql.NullTime, custom ints, ...) are resolved by the
+// default converter of database/sql before that.
+func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
+	value, err := driver.DefaultParameterConverter.ConvertValue(nv.Value)
+	if err != nil {
+		return err
+	}
+	nv.Value, err = c.encodeParam(value)
+	return err
+}
+
+// encodeParam returns the form a parameter value is sent in
+func (c *Conn) encodeParam(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case time.Time:
+		if v.IsZero() {
+			return "0000-00-00", nil
+		}
+		loc := c.config.Location
+		if loc == nil {
+			loc = time.UTC
+		}
+		return v.In(loc).Format(paramTimeFormat), nil
+	case []byte:
+		if !utf8.Valid(v) {
+			return nil, fmt.Errorf("binary parameters are not supported: []byte values must be valid UTF-8 text")
+		}
+		return string(v), nil
+	}
+	return value, nil
+}
+
+// encodeParamSets converts the parameter sets of a batch like
+// CheckNamedValue converts single parameters; batches bypass database/sql
+func (c *Conn) encodeParamSets(paramSets [][]interface{}) ([][]interface{}, error) {
+	encoded := make([][]interface{}, len(paramSets))
+	for i, params := range paramSets {
+		encoded[i] = make([]interface{}, len(params))
+		for j, param := range params {
+			nv := driver.NamedValue{Ordinal: j + 1, Value: param}
+			if err := c.CheckNamedValue(&nv); err != nil {
+				return nil, fmt.Errorf("parameter set %d: parameter %d: %w", i+1, j+1, err)
+			}
+			encoded[i][j] = nv.Value
+		}
+	}
+	return encoded, nil
+}
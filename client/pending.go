@@ -0,0 +1,219 @@
+package client
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const (
+	// lateResponseRetention is how long the correlation ID of a request that
+	// gave up is remembered, so a response arriving after it is told apart
+	// from one nobody sent
+	lateResponseRetention = 10 * time.Minute
+
+	// maxExpiredRequests bounds the remembered correlation IDs; the oldest
+	// are forgotten first
+	maxExpiredRequests = 10000
+)
+
+// Reasons a response is discarded, as reported to DiscardMetrics
+const (
+	DiscardLate    = "late"    // Answers a request that already timed out or was cancelled
+	DiscardUnknown = "unknown" // Carries a correlation ID this connection never sent
+)
+
+var (
+	// correlationPrefix makes the correlation IDs of this process distinct
+	// from those of other processes sharing a reply queue or a broker
+	correlationPrefix = newCorrelationPrefix()
+
+	// correlationSeq numbers the correlation IDs of this process (atomic)
+	correlationSeq uint64
+)
+
+// newCorrelationPrefix returns a random token identifying this process
+func newCorrelationPrefix() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
+
+// newCorrelationID returns a correlation ID that is never handed out twice,
+// unlike timestamps, which collide between concurrent requests and clock
+// steps. kind tells the requests apart in logs, e.g. "q" or "tx".
+func newCorrelationID(kind string) string {
+	return fmt.Sprintf("%s_%s_%d", kind, correlationPrefix, atomic.AddUint64(&correlationSeq, 1))
+}
+
+// pendingRequests tracks the requests of a connection manager by correlation
+// ID while they wait for their response, and remembers for a while those
+// that gave up. A response that matches no waiting request is discarded
+// explicitly and counted as late or unknown, so that reusing a reply queue
+// or a direct reply-to channel never hands it to the next request.
+type pendingRequests struct {
+	mutex        sync.Mutex
+	waiting      map[string]*waiter   // Correlation ID -> request waiting for it
+	expired      map[string]time.Time // Correlation ID -> when its request gave up
+	expiredOrder []string             // Keys of expired, oldest first
+
+	late    int64 // Responses discarded because their request gave up (atomic)
+	unknown int64 // Responses discarded because nobody sent their correlation ID (atomic)
+
+	onDiscard func(msg amqp.Delivery, reason string) // Called for every discarded response
+}
+
+// waiter is a request waiting for its response
+type waiter struct {
+	msgs     chan amqp.Delivery // Delivers the response (nil: the request reads its own direct reply-to channel)
+	returned chan amqp.Return   // Delivers the request back if the broker could not route it on a shared channel
+}
+
+// newPendingRequests creates an empty registry
+func newPendingRequests(onDiscard func(msg amqp.Delivery, reason string)) *pendingRequests {
+	return &pendingRequests{
+		waiting:   make(map[string]*waiter),
+		expired:   make(map[string]time.Time),
+		onDiscard: onDiscard,
+	}
+}
+
+// register records a request before it is published. With queued set,
+// dispatch delivers the response on the waiter's msgs; otherwise the request
+// receives it on its own channel and checks it with accept.
+func (p *pendingRequests) register(corrID string, queued bool) *waiter {
+	w := &waiter{returned: make(chan amqp.Return, 1)}
+	if queued {
+		w.msgs = make(chan amqp.Delivery, 2) // An interim notification and the response
+	}
+	p.mutex.Lock()
+	p.waiting[corrID] = w
+	p.mutex.Unlock()
+	return w
+}
+
+// dispatch hands a response received on a reply queue to the request
+// waiting for it, and discards it when there is none. Interim notifications
+// are dropped while the request has not read the previous one, so the
+// response always finds room (the reply queue consumer is the only sender).
+func (p *pendingRequests) dispatch(msg amqp.Delivery) {
+	p.mutex.Lock()
+	w, ok := p.waiting[msg.CorrelationId]
+	if ok && w.msgs != nil && msg.Type != progressMessageType {
+		delete(p.waiting, msg.CorrelationId)
+	}
+	p.mutex.Unlock()
+
+	switch {
+	case !ok || w.msgs == nil:
+		p.discard(msg)
+	case msg.Type == progressMessageType:
+		if len(w.msgs) == 0 {
+			w.msgs <- msg
+		}
+	default:
+		w.msgs <- msg
+	}
+}
+
+// returned hands a publish the broker could not route back to the request
+// that made it, when several requests share the channel
+func (p *pendingRequests) returned(ret amqp.Return) {
+	p.mutex.Lock()
+	w, ok := p.waiting[ret.CorrelationId]
+	p.mutex.Unlock()
+	if ok {
+		select {
+		case w.returned <- ret:
+		default:
+		}
+	}
+}
+
+// accept reports whether msg, received on the direct reply-to channel of
+// the request for corrID, belongs to it. Responses of other requests are
+// discarded; the request's own response ends its registration.
+func (p *pendingRequests) accept(corrID string, msg amqp.Delivery) bool {
+	if msg.CorrelationId != corrID {
+		p.discard(msg)
+		return false
+	}
+	if msg.Type != progressMessageType {
+		p.mutex.Lock()
+		delete(p.waiting, corrID)
+		p.mutex.Unlock()
+	}
+	return true
+}
+
+// forget ends the registration of a request. One that is still waiting gave
+// up, so its correlation ID is remembered to recognize a late response.
+func (p *pendingRequests) forget(corrID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if _, ok := p.waiting[corrID]; !ok {
+		return
+	}
+	delete(p.waiting, corrID)
+	p.expired[corrID] = time.Now()
+	p.expiredOrder = append(p.expiredOrder, corrID)
+	p.prune()
+}
+
+// prune forgets expired correlation IDs past the retention or beyond the
+// bound; the caller holds the mutex
+func (p *pendingRequests) prune() {
+	cutoff := time.Now().Add(-lateResponseRetention)
+	n := 0
+	for n < len(p.expiredOrder) {
+		id := p.expiredOrder[n]
+		if len(p.expiredOrder)-n <= maxExpiredRequests && p.expired[id].After(cutoff) {
+			break
+		}
+		delete(p.expired, id)
+		n++
+	}
+	if n > 0 {
+		p.expiredOrder = append(p.expiredOrder[:0], p.expiredOrder[n:]...)
+	}
+}
+
+// discard drops a response no request is waiting for, counting it as late
+// when its request gave up and as unknown otherwise. Interim notifications
+// are dropped without counting.
+func (p *pendingRequests) discard(msg amqp.Delivery) {
+	if msg.Type == progressMessageType {
+		return
+	}
+	p.mutex.Lock()
+	_, late := p.expired[msg.CorrelationId]
+	p.mutex.Unlock()
+
+	reason := DiscardUnknown
+	if late {
+		reason = DiscardLate
+		atomic.AddInt64(&p.late, 1)
+	} else {
+		atomic.AddInt64(&p.unknown, 1)
+	}
+	if p.onDiscard != nil {
+		p.onDiscard(msg, reason)
+	}
+}
+
+// counts returns the number of waiting requests and of late and unknown
+// responses discarded so far
+func (p *pendingRequests) counts() (waiting int, late, unknown int64) {
+	p.mutex.Lock()
+	waiting = len(p.waiting)
+	p.mutex.Unlock()
+	return waiting, atomic.LoadInt64(&p.late), atomic.LoadInt64(&p.unknown)
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// Error codes of server-side prepared statements
+const (
+	errCodeStmtNotFound    = "STMT_NOT_FOUND"   // The server no longer has the statement
+	errCodeStmtUnsupported = "STMT_UNSUPPORTED" // The server cannot keep statements
+)
+
+// statementError is a server error about a prepared statement handle
+type statementError struct {
+	code    string
+	message string
+}
+
+// Error implements the error interface.
+func (e *statementError) Error() string {
+	return fmt.Sprintf("server error: %s", e.message)
+}
+
+// isStatementCode reports whether code is a prepared statement error code
+func isStatementCode(code string) bool {
+	return code == errCodeStmtNotFound || code == errCodeStmtUnsupported
+}
+
+// statementKey is the context key for the handle of the prepared statement
+// a query executes.
+type statementKey struct{}
+
+// withStatementID returns a context whose query executes the server-side
+// statement id instead of sending the SQL text.
+func withStatementID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, statementKey{}, id)
+}
+
+// statementIDFromContext returns the statement handle stored in ctx, if any.
+func statementIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(statementKey{}).(string)
+	return id, ok && id != ""
+}
+
+// prepareRemote registers query as a statement on the server and returns its
+// handle.
+func (c *Conn) prepareRemote(ctx context.Context, query string) (string, error) {
+	rows, err := c.queryRPC(ctx, "PREPARE:"+query, nil)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	result, ok := rows.(*Rows)
+	if !ok || len(result.rows) == 0 || len(result.rows[0]) == 0 {
+		return "", fmt.Errorf("empty response to PREPARE")
+	}
+	id, ok := result.rows[0][0].(string)
+	if !ok || id == "" {
+		return "", fmt.Errorf("invalid statement handle in response to PREPARE")
+	}
+	return id, nil
+}
+
+// deallocateRemote releases the server-side statement id.
+func (c *Conn) deallocateRemote(ctx context.Context, id string) error {
+	rows, err := c.queryRPC(withStatementID(ctx, id), "DEALLOCATE:"+id, nil)
+	if err != nil {
+		return err
+	}
+	return rows.Close()
+}
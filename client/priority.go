@@ -0,0 +1,46 @@
+package client
+
+import (
+	"context"
+	"fmt"
+)
+
+// Priority is the scheduling priority of a request. The server maps it onto
+// database-level controls (statement time limits, LOW_PRIORITY writes), so
+// low-priority bulk jobs cannot monopolize the device database.
+type Priority string
+
+const (
+	PriorityHigh   Priority = "high"   // Interactive requests, no extra limits
+	PriorityNormal Priority = "normal" // Default priority
+	PriorityLow    Priority = "low"    // Bulk/background jobs
+)
+
+// priorityKey is the context key for request priorities.
+type priorityKey struct{}
+
+// WithPriority returns a context that sends every query run with it at the
+// given priority, overriding the DSN default.
+//
+// Example:
+//
+//	ctx := client.WithPriority(context.Background(), client.PriorityLow)
+//	db.ExecContext(ctx, "DELETE FROM logs WHERE created < ?", cutoff)
+func WithPriority(ctx context.Context, priority Priority) context.Context {
+	return context.WithValue(ctx, priorityKey{}, priority)
+}
+
+// priorityFromContext returns the priority stored in ctx, if any.
+func priorityFromContext(ctx context.Context) (Priority, bool) {
+	priority, ok := ctx.Value(priorityKey{}).(Priority)
+	return priority, ok
+}
+
+// parsePriority validates a priority name.
+func parsePriority(value string) (Priority, error) {
+	switch Priority(value) {
+	case PriorityHigh, PriorityNormal, PriorityLow:
+		return Priority(value), nil
+	}
+	return "", fmt.Errorf("invalid priority '%s': must be 'high', 'normal' or 'low'", value)
+}
@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+// progressMessageType marks the server's interim notifications in the AMQP
+// Type property
+const progressMessageType = "progress"
+
+// Progress states reported to a ProgressFunc
+const (
+	ProgressQueued  = "queued"  // The request waits for a free worker on the server
+	ProgressRunning = "running" // The server is processing the request
+)
+
+// Progress is an interim notification about a request the server has not
+// answered yet
+type Progress struct {
+	State    string        // ProgressQueued or ProgressRunning
+	Position int           // Place in the server's queue (1 = next); queued only
+	Elapsed  time.Duration // Time the server has been processing the request; running only
+}
+
+// ProgressFunc receives the interim notifications of a request. It is called
+// on the goroutine waiting for the response and must return quickly.
+type ProgressFunc func(Progress)
+
+// progressKey is the context key for the ProgressFunc of a query
+type progressKey struct{}
+
+// WithProgress returns a context whose queries ask the server for interim
+// notifications: the request's place in the queue when every worker is busy,
+// and a "running" notification every few seconds (-progress-interval) while
+// it is processed. They tell a slow request from a stuck one. Servers with
+// progress notifications disabled and transports other than RabbitMQ send
+// none.
+//
+// Example:
+//
+//	ctx = client.WithProgress(ctx, func(p client.Progress) {
+//		if p.State == client.ProgressQueued {
+//			log.Printf("queued, position %d", p.Position)
+//		} else {
+//			log.Printf("still running after %v", p.Elapsed)
+//		}
+//	})
+//	rows, err := db.QueryContext(ctx, "SELECT ...")
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// progressFunc returns the ProgressFunc requested through ctx, if any
+func progressFunc(ctx context.Context) ProgressFunc {
+	fn, _ := ctx.Value(progressKey{}).(ProgressFunc)
+	return fn
+}
+
+// reportProgress decodes an interim notification and passes it to fn
+func reportProgress(fn ProgressFunc, body []byte) {
+	if fn == nil {
+		return
+	}
+	var notice struct {
+		State     string `json:"state"`
+		Position  int    `json:"position"`
+		ElapsedMs int64  `json:"elapsedMs"`
+	}
+	if err := json.Unmarshal(body, &notice); err != nil {
+		return
+	}
+	fn(Progress{
+		State:    notice.State,
+		Position: notice.Position,
+		Elapsed:  time.Duration(notice.ElapsedMs) * time.Millisecond,
+	})
+}
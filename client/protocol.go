@@ -0,0 +1,63 @@
+package client
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Wire protocol versions.
+//
+// Version 1 is the original request format: type, deviceID, query, params,
+// clientIP and transactionID. Version 2 adds the protocol version itself plus
+// request options (priority, on-behalf-of, session ID) and heartbeat client
+// IDs. Features that change the wire format must only be used when
+// Conn.legacyProtocol reports false.
+const (
+	ProtocolV1      = 1
+	ProtocolV2      = 2
+	ProtocolVersion = ProtocolV2 // Version spoken by this client by default
+)
+
+// v2RequestTypes maps the request types added after protocol version 1 to
+// the feature they implement, named in the error returned when the DSN asks
+// for compatibility mode
+var v2RequestTypes = map[string]string{
+	"session":    "session settings",
+	"job":        "async jobs",
+	"file.get":   "file transfer",
+	"file.put":   "file transfer",
+	"log.tail":   "log tail",
+	"bulk":       "bulk insert",
+	"export":     "export",
+	"cursor":     "cursors",
+	"script":     "scripts",
+	"migrate":    "migrations",
+	"explain":    "query plans",
+	"validate":   "query validation",
+	"approval":   "approvals",
+	"prepare":    "server-side prepared statements",
+	"deallocate": "server-side prepared statements",
+}
+
+// errRequiresV2 reports that feature cannot be used in compatibility mode
+func errRequiresV2(feature string) error {
+	return fmt.Errorf("%s: protocol version %d is required (DSN has protocol_version=%d)", feature, ProtocolV2, ProtocolV1)
+}
+
+// parseProtocolVersion validates the protocol_version DSN parameter.
+func parseProtocolVersion(value string) (int, error) {
+	if value == "" {
+		return ProtocolVersion, nil
+	}
+	version, err := strconv.Atoi(value)
+	if err != nil || version < ProtocolV1 || version > ProtocolVersion {
+		return 0, fmt.Errorf("invalid protocol_version '%s': must be between %d and %d", value, ProtocolV1, ProtocolVersion)
+	}
+	return version, nil
+}
+
+// legacyProtocol reports whether the connection is in compatibility mode
+// and must only send version 1 requests.
+func (c *Conn) legacyProtocol() bool {
+	return c.config.ProtocolVersion == ProtocolV1
+}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLegacyProtocolRejectsV2RequestTypes(t *testing.T) {
+	tests := []struct {
+		query   string
+		feature string
+	}{
+		{"SESSION:{}", "session settings"},
+		{"JOB:report", "async jobs"},
+		{"FILE.GET:/var/log/app.log", "file transfer"},
+		{"FILE.PUT:/tmp/upload", "file transfer"},
+		{"LOG.TAIL:app", "log tail"},
+		{"BULK:{}", "bulk insert"},
+		{"EXPORT:SELECT 1", "export"},
+		{"CURSOR:SELECT 1", "cursors"},
+		{"SCRIPT:SELECT 1", "scripts"},
+		{"MIGRATE:{}", "migrations"},
+		{"EXPLAIN:SELECT 1", "query plans"},
+		{"VALIDATE:SELECT 1", "query validation"},
+		{"APPROVAL:{}", "approvals"},
+		{"PREPARE:SELECT 1", "server-side prepared statements"},
+		{"DEALLOCATE:stmt1", "server-side prepared statements"},
+	}
+
+	// Rejected requests are never sent, so the connection needs no channel
+	c := &Conn{config: &DSNConfig{ProtocolVersion: ProtocolV1}}
+	for _, tt := range tests {
+		_, err := c.sendRPC(context.Background(), tt.query, nil, nil)
+		if err == nil || !strings.HasPrefix(err.Error(), tt.feature+": protocol version 2 is required") {
+			t.Errorf("%s: got %v, want the %s feature rejected", tt.query, err, tt.feature)
+		}
+	}
+}
+
+func TestV2RequestTypesCoverParsedTypes(t *testing.T) {
+	// Every request type parseCommand knows besides the version 1 ones must
+	// be rejected in compatibility mode, and only those
+	v1 := map[string]bool{"sql": true, "function": true, "command": true}
+	parsed := map[string]bool{}
+	for _, command := range commandPrefixes {
+		cmdType, query := parseCommand(command.prefix + "x")
+		if query != "x" {
+			t.Fatalf("%s: parsed as %q with query %q", command.prefix, cmdType, query)
+		}
+		parsed[cmdType] = true
+
+		if _, ok := v2RequestTypes[cmdType]; ok == v1[cmdType] {
+			t.Errorf("%s: request type %q in v2RequestTypes = %v", command.prefix, cmdType, ok)
+		}
+	}
+	for cmdType := range v2RequestTypes {
+		if !parsed[cmdType] {
+			t.Errorf("v2RequestTypes lists %q, which parseCommand never returns", cmdType)
+		}
+	}
+}
+
+func TestParseProtocolVersion(t *testing.T) {
+	tests := []struct {
+		value   string
+		version int
+		wantErr bool
+	}{
+		{"", ProtocolVersion, false},
+		{"1", ProtocolV1, false},
+		{"2", ProtocolV2, false},
+		{"0", 0, true},
+		{"3", 0, true},
+		{"v2", 0, true},
+	}
+
+	for _, tt := range tests {
+		version, err := parseProtocolVersion(tt.value)
+		if (err != nil) != tt.wantErr || version != tt.version {
+			t.Errorf("parseProtocolVersion(%q) = %d, %v", tt.value, version, err)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ErrCodeRateLimited is the error code of requests the server's rate limiter
+// rejected
+const ErrCodeRateLimited = "RATE_LIMITED"
+
+// RateLimitError is returned for requests rejected by the server's rate
+// limiter. Retry after RetryAfter.
+type RateLimitError struct {
+	Message    string        // Server's error message
+	RetryAfter time.Duration // Time until the server would allow the next request
+}
+
+// Error implements the error interface.
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("server error: %s (retry after %v)", e.Message, e.RetryAfter)
+}
+
+// RateLimitInfo is the client's rate limit budget on the server after a
+// request. Request it with WithRateLimitInfo to back off before being
+// rejected, or to forward it as HTTP headers from a REST gateway.
+type RateLimitInfo struct {
+	Known      bool          // The server reported a budget; false for servers without the metadata
+	Limit      int           // Requests the client can make in a burst
+	Remaining  int           // Requests the client can make right away
+	Reset      time.Duration // Time until the whole burst is available again
+	RetryAfter time.Duration // Time until the next request would be allowed (rejected requests only)
+}
+
+// rateLimitInfoKey is the context key for the RateLimitInfo a query fills in.
+type rateLimitInfoKey struct{}
+
+// WithRateLimitInfo returns a context whose queries store the client's rate
+// limit budget in info, rejected queries included. The last query made with
+// the context wins.
+//
+// Example:
+//
+//	var info client.RateLimitInfo
+//	rows, err := db.QueryContext(client.WithRateLimitInfo(ctx, &info), "SELECT * FROM products")
+//	...
+//	if info.Known && info.Remaining == 0 {
+//		time.Sleep(info.Reset)
+//	}
+func WithRateLimitInfo(ctx context.Context, info *RateLimitInfo) context.Context {
+	return context.WithValue(ctx, rateLimitInfoKey{}, info)
+}
+
+// recordRateLimitInfo copies the response's rate limit metadata into the
+// RateLimitInfo requested through ctx, if any.
+func recordRateLimitInfo(ctx context.Context, resp RPCResponse) {
+	info, ok := ctx.Value(rateLimitInfoKey{}).(*RateLimitInfo)
+	if !ok || info == nil {
+		return
+	}
+	*info = RateLimitInfo{}
+	if resp.RateLimit != nil {
+		info.Known = true
+		info.Limit = resp.RateLimit.Limit
+		info.Remaining = resp.RateLimit.Remaining
+		info.Reset = time.Duration(resp.RateLimit.ResetMs) * time.Millisecond
+		info.RetryAfter = time.Duration(resp.RateLimit.RetryAfterMs) * time.Millisecond
+	}
+}
+
+// rateLimitError returns the error of a response rejected by the rate limiter
+func rateLimitError(resp RPCResponse) error {
+	err := &RateLimitError{Message: resp.Error}
+	if resp.RateLimit != nil {
+		err.RetryAfter = time.Duration(resp.RateLimit.RetryAfterMs) * time.Millisecond
+	}
+	return err
+}
+
+// SetHTTPHeaders sets the RateLimit-Limit, RateLimit-Remaining and
+// RateLimit-Reset headers (seconds), and Retry-After for rejected requests.
+// Nothing is set when the server did not report a budget.
+func (ri RateLimitInfo) SetHTTPHeaders(header http.Header) {
+	if !ri.Known {
+		return
+	}
+
+	header.Set("RateLimit-Limit", strconv.Itoa(ri.Limit))
+	header.Set("RateLimit-Remaining", strconv.Itoa(ri.Remaining))
+	header.Set("RateLimit-Reset", strconv.FormatInt(int64((ri.Reset+time.Second-1)/time.Second), 10))
+	if ri.RetryAfter > 0 {
+		header.Set("Retry-After", strconv.FormatInt(int64((ri.RetryAfter+time.Second-1)/time.Second), 10))
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -36,7 +37,6 @@ func DefaultReconnectConfig() *ReconnectConfig {
 // It provides transparent reconnection with exponential backoff and connection health monitoring.
 type ConnectionManager struct {
 	config     *ReconnectConfig // Reconnection configuration
-	dsn        string           // Original DSN for reconnection
 	conn       *amqp.Connection // Current connection (nil if disconnected)
 	connConfig *DSNConfig       // Parsed DSN configuration
 
@@ -51,6 +51,17 @@ type ConnectionManager struct {
 	// Callbacks
 	onConnected    func()      // Called when connection is established
 	onDisconnected func(error) // Called when connection is lost
+
+	// Channel reuse
+	channels       chan *pooledChannel // Idle channels ready for the next request
+	channelsOpened int64               // Channels opened since start (atomic)
+	channelsReused int64               // Requests served by an idle channel (atomic)
+	directReplies  int32               // 1 while direct reply-to is used (atomic)
+	replyMutex     sync.Mutex          // Protects replies
+	replies        *replyQueue         // Persistent reply queue of the current connection
+	muxMutex       sync.Mutex          // Protects mux
+	mux            *pooledChannel      // Channel shared by every request when multiplexing
+	pending        *pendingRequests    // Requests waiting for a response, by correlation ID
 }
 
 // NewConnectionManager creates a new connection manager with the specified configuration.
@@ -73,14 +84,27 @@ func NewConnectionManager(dsn string, config *ReconnectConfig) (*ConnectionManag
 		return nil, fmt.Errorf("invalid DSN: %w", err)
 	}
 
+	return newConnectionManager(connConfig, config), nil
+}
+
+// newConnectionManager creates a connection manager for a parsed configuration
+func newConnectionManager(connConfig *DSNConfig, config *ReconnectConfig) *ConnectionManager {
+	if config == nil {
+		config = DefaultReconnectConfig()
+	}
+
 	cm := &ConnectionManager{
 		config:       config,
-		dsn:          dsn,
 		connConfig:   connConfig,
 		nextInterval: config.InitialInterval,
+		channels:     make(chan *pooledChannel, connConfig.ChannelPoolSize),
+	}
+	cm.pending = newPendingRequests(cm.discardedResponse)
+	if connConfig.DirectReplyTo {
+		cm.directReplies = 1
 	}
 
-	return cm, nil
+	return cm
 }
 
 // Connect establishes the initial connection with automatic reconnection if enabled.
@@ -96,8 +120,9 @@ func (cm *ConnectionManager) Connect() error {
 
 // doConnect performs the actual connection (must be called with mutex held).
 func (cm *ConnectionManager) doConnect() error {
-	conn, err := amqp.Dial(cm.connConfig.AMQPURL)
+	conn, err := amqp.DialConfig(cm.connConfig.AMQPURL, cm.connConfig.amqpConfig())
 	if err != nil {
+		err = ExplainAMQPError(err, cm.connConfig.AMQPURL)
 		cm.lastError = err
 		if cm.config.Enabled {
 			cm.logf("Connection failed, will retry: %v", err)
@@ -122,7 +147,7 @@ func (cm *ConnectionManager) doConnect() error {
 		go cm.onConnected()
 	}
 
-	cm.logf("Connected to RabbitMQ %s", cm.connConfig.AMQPURL)
+	cm.logf("Connected to RabbitMQ %s", RedactURL(cm.connConfig.AMQPURL))
 	return nil
 }
 
@@ -191,6 +216,7 @@ func (cm *ConnectionManager) reconnectLoop() {
 		cm.logf("Reconnection attempt %d/%d", cm.attempts, cm.config.MaxAttempts)
 
 		err := cm.doConnect()
+		observeReconnect(cm.connConfig.DeviceID, cm.attempts, err)
 		if err == nil {
 			cm.mutex.Unlock()
 			cm.logf("Reconnection successful after %d attempts", cm.attempts)
@@ -248,6 +274,8 @@ func (cm *ConnectionManager) Close() error {
 	defer cm.mutex.Unlock()
 
 	cm.isConnected = false // Prevent reconnection
+	cm.drainChannels()
+	cm.closeMux()
 
 	if cm.conn != nil {
 		err := cm.conn.Close()
@@ -284,13 +312,20 @@ func (cm *ConnectionManager) GetStats() ConnectionStats {
 		uptime = time.Since(cm.lastConnected)
 	}
 
+	pending, late, unknown := cm.pending.counts()
 	return ConnectionStats{
-		IsConnected:     cm.isConnected,
-		LastConnected:   cm.lastConnected,
-		Uptime:          uptime,
-		ReconnectCount:  cm.attempts,
-		LastError:       cm.lastError,
-		NextReconnectIn: cm.nextInterval,
+		IsConnected:      cm.isConnected,
+		LastConnected:    cm.lastConnected,
+		Uptime:           uptime,
+		ReconnectCount:   cm.attempts,
+		LastError:        cm.lastError,
+		NextReconnectIn:  cm.nextInterval,
+		IdleChannels:     len(cm.channels),
+		ChannelsOpened:   atomic.LoadInt64(&cm.channelsOpened),
+		ChannelsReused:   atomic.LoadInt64(&cm.channelsReused),
+		PendingRequests:  pending,
+		LateResponses:    late,
+		UnknownResponses: unknown,
 	}
 }
 
@@ -316,17 +351,30 @@ func (cm *ConnectionManager) Reconnect() error {
 
 // ConnectionStats contains statistics about the connection state.
 type ConnectionStats struct {
-	IsConnected     bool          // Whether currently connected
-	LastConnected   time.Time     // Time of last successful connection
-	Uptime          time.Duration // How long the current connection has been up
-	ReconnectCount  int           // Number of reconnection attempts
-	LastError       error         // Last connection error
-	NextReconnectIn time.Duration // Time until next reconnection attempt
+	IsConnected      bool          // Whether currently connected
+	LastConnected    time.Time     // Time of last successful connection
+	Uptime           time.Duration // How long the current connection has been up
+	ReconnectCount   int           // Number of reconnection attempts
+	LastError        error         // Last connection error
+	NextReconnectIn  time.Duration // Time until next reconnection attempt
+	IdleChannels     int           // Channels waiting in the pool
+	ChannelsOpened   int64         // Channels opened since start
+	ChannelsReused   int64         // Requests served by a pooled channel
+	PendingRequests  int           // Requests waiting for a response
+	LateResponses    int64         // Responses discarded because their request had timed out or been cancelled
+	UnknownResponses int64         // Responses discarded because their correlation ID was never sent
+}
+
+// discardedResponse logs and reports a response the pending-request
+// registry discarded
+func (cm *ConnectionManager) discardedResponse(msg amqp.Delivery, reason string) {
+	cm.logf("Discarded %s response with correlation ID %s", reason, msg.CorrelationId)
+	observeDiscard(cm.connConfig.DeviceID, reason)
 }
 
 // logf provides conditional debug logging for the connection manager.
 func (cm *ConnectionManager) logf(format string, args ...interface{}) {
 	if cm.connConfig != nil && cm.connConfig.Debug {
-		log.Printf("[reconnect] "+format, args...)
+		log.Printf("[reconnect] %s", Redact(fmt.Sprintf(format, args...)))
 	}
 }
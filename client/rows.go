@@ -1,10 +1,16 @@
 package client
 
 import (
+	"database/sql"
 	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
 	"fmt"
 	"io"
+	"reflect"
 	"strconv"
+	"strings"
+	"time"
 )
 
 // Rows implements the database/sql/driver.Rows interface for burrowctl query results.
@@ -20,9 +26,14 @@ import (
 // This implementation handles the conversion between JSON-serialized data
 // from the server and Go's database/sql driver value types.
 type Rows struct {
-	columns []string        // Column names from the query result
-	rows    [][]interface{} // Row data as received from server
-	pos     int             // Current position in the result set
+	columns  []string        // Column names from the query result
+	rows     [][]interface{} // Row data as received from server
+	columnar *rpcColumnar    // Row data in column-major layout, replacing rows (columnar=true only)
+	nullPos  []int           // Next entry of each columnar column's NULL list
+	types    []rpcColumnType // Column descriptors (nil: values are decoded by guessing)
+	loc      *time.Location  // Location dates are parsed in (nil: dates stay strings)
+	pos      int             // Current position in the result set
+	result   *Result         // Affected rows and last insert ID (Exec requests only)
 }
 
 // Columns implements the driver.Rows interface and returns the column names
@@ -49,13 +60,25 @@ func (r *Rows) Columns() []string {
 //   - error: io.EOF when no more rows are available, or any conversion error
 func (r *Rows) Next(dest []driver.Value) error {
 	// Check if we've reached the end of the result set
+	if r.columnar != nil {
+		if r.pos >= r.columnar.Count {
+			return io.EOF
+		}
+		r.nextColumnar(dest)
+		r.pos++
+		return nil
+	}
 	if r.pos >= len(r.rows) {
 		return io.EOF
 	}
 
 	// Convert and copy current row values to destination
 	for i, val := range r.rows[r.pos] {
-		dest[i] = r.convertValue(val)
+		if i < len(r.types) {
+			dest[i] = r.convertTypedValue(val, r.types[i].DatabaseType)
+		} else {
+			dest[i] = r.convertValue(val)
+		}
 	}
 
 	// Advance to next row
@@ -96,8 +119,14 @@ func (r *Rows) convertValue(val interface{}) driver.Value {
 		}
 		// Return as string if not a number
 		return v
+	case json.Number:
+		// Convert to int64 if it represents a whole number
+		if intVal, err := v.Int64(); err == nil {
+			return intVal
+		}
+		floatVal, _ := v.Float64()
+		return floatVal
 	case float64:
-		// JSON unmarshaling always returns float64 for numbers
 		// Convert to int64 if it represents a whole number
 		if v == float64(int64(v)) {
 			return int64(v)
@@ -112,6 +141,76 @@ func (r *Rows) convertValue(val interface{}) driver.Value {
 	}
 }
 
+// convertTypedValue converts a server response value by the database type
+// of its column: integers become int64 (unsigned values beyond its range
+// stay decimal text, which database/sql scans into uint64), floating point
+// numbers float64, binary data []byte, dates time.Time when the DSN has
+// parse_time, and DECIMAL and text values stay strings, so text that looks
+// like a number is not mangled and decimals keep their exact digits. NULL
+// is always nil, so sql.Null* types scan it as invalid.
+func (r *Rows) convertTypedValue(val interface{}, dbType string) driver.Value {
+	if val == nil {
+		return nil
+	}
+	text, isText := val.(string)
+	if number, ok := val.(json.Number); ok {
+		text, isText = number.String(), true
+	}
+
+	switch strings.TrimPrefix(strings.ToUpper(dbType), "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR":
+		if isText {
+			if intVal, err := strconv.ParseInt(text, 10, 64); err == nil {
+				return intVal
+			}
+			if _, err := strconv.ParseUint(text, 10, 64); err == nil {
+				return text
+			}
+		}
+	case "FLOAT", "DOUBLE", "REAL":
+		if isText {
+			if floatVal, err := strconv.ParseFloat(text, 64); err == nil {
+				return floatVal
+			}
+		}
+	case "DATE", "DATETIME", "TIMESTAMP":
+		if isText && r.loc != nil {
+			if t, err := parseDateTime(text, r.loc); err == nil {
+				return t
+			}
+		}
+		if isText {
+			return text
+		}
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		if isText {
+			if raw, err := base64.StdEncoding.DecodeString(text); err == nil {
+				return raw
+			}
+		}
+	default:
+		if isText {
+			return text
+		}
+	}
+
+	// Values the type does not account for are decoded by guessing
+	return r.convertValue(val)
+}
+
+// parseDateTime parses a MySQL DATE, DATETIME or TIMESTAMP value in loc.
+// Zero dates ("0000-00-00") become the zero time.Time, as with the MySQL
+// driver's parseTime.
+func parseDateTime(text string, loc *time.Location) (time.Time, error) {
+	if strings.HasPrefix(text, "0000-00-00") {
+		return time.Time{}, nil
+	}
+	if len(text) == len("2006-01-02") {
+		return time.ParseInLocation("2006-01-02", text, loc)
+	}
+	return time.ParseInLocation("2006-01-02 15:04:05.999999999", text, loc)
+}
+
 // Close implements the driver.Rows interface and cleans up any resources.
 // For the burrowctl client, no special cleanup is required as all data
 // is already in memory from the RPC response.
@@ -121,3 +220,120 @@ func (r *Rows) convertValue(val interface{}) driver.Value {
 func (r *Rows) Close() error {
 	return nil
 }
+
+// HasNextResultSet implements the driver.RowsNextResultSet interface. The
+// server returns the first result set of a query only, so there is never
+// another one: multi-statement queries are rejected by SQL validation, and
+// stored procedures yield the rows of their first SELECT.
+func (r *Rows) HasNextResultSet() bool {
+	return false
+}
+
+// NextResultSet implements the driver.RowsNextResultSet interface and
+// reports that there are no more result sets
+func (r *Rows) NextResultSet() error {
+	return io.EOF
+}
+
+// Scan types reported by ColumnTypeScanType
+var (
+	scanTypeInt64       = reflect.TypeOf(int64(0))
+	scanTypeUint64      = reflect.TypeOf(uint64(0))
+	scanTypeFloat64     = reflect.TypeOf(float64(0))
+	scanTypeString      = reflect.TypeOf("")
+	scanTypeBytes       = reflect.TypeOf([]byte(nil))
+	scanTypeTime        = reflect.TypeOf(time.Time{})
+	scanTypeNullInt64   = reflect.TypeOf(sql.NullInt64{})
+	scanTypeNullFloat64 = reflect.TypeOf(sql.NullFloat64{})
+	scanTypeNullString  = reflect.TypeOf(sql.NullString{})
+	scanTypeNullTime    = reflect.TypeOf(sql.NullTime{})
+	scanTypeAny         = reflect.TypeOf((*interface{})(nil)).Elem()
+)
+
+// columnType returns the descriptor of column index, or nil when the
+// server sent none (native_types=false, functions, commands, older servers)
+func (r *Rows) columnType(index int) *rpcColumnType {
+	if index < 0 || index >= len(r.types) {
+		return nil
+	}
+	return &r.types[index]
+}
+
+// ColumnTypeDatabaseTypeName implements driver.RowsColumnTypeDatabaseTypeName
+// and returns the database type of a column, e.g. "VARCHAR" or "UNSIGNED
+// BIGINT" (empty if unknown)
+func (r *Rows) ColumnTypeDatabaseTypeName(index int) string {
+	if column := r.columnType(index); column != nil {
+		return strings.ToUpper(column.DatabaseType)
+	}
+	return ""
+}
+
+// ColumnTypeNullable implements driver.RowsColumnTypeNullable
+func (r *Rows) ColumnTypeNullable(index int) (nullable, ok bool) {
+	if column := r.columnType(index); column != nil && column.Nullable != nil {
+		return *column.Nullable, true
+	}
+	return false, false
+}
+
+// ColumnTypeLength implements driver.RowsColumnTypeLength and returns the
+// maximum length of variable-length text and binary columns
+func (r *Rows) ColumnTypeLength(index int) (length int64, ok bool) {
+	column := r.columnType(index)
+	if column == nil || column.Length <= 0 {
+		return 0, false
+	}
+	switch r.ColumnTypeDatabaseTypeName(index) {
+	case "VARCHAR", "TEXT", "TINYTEXT", "MEDIUMTEXT", "LONGTEXT", "JSON",
+		"VARBINARY", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB":
+		return column.Length, true
+	}
+	return 0, false
+}
+
+// ColumnTypePrecisionScale implements driver.RowsColumnTypePrecisionScale
+// for DECIMAL columns
+func (r *Rows) ColumnTypePrecisionScale(index int) (precision, scale int64, ok bool) {
+	switch r.ColumnTypeDatabaseTypeName(index) {
+	case "DECIMAL", "NUMERIC", "UNSIGNED DECIMAL":
+		column := r.columnType(index)
+		return column.Precision, column.Scale, true
+	}
+	return 0, 0, false
+}
+
+// ColumnTypeScanType implements driver.RowsColumnTypeScanType and returns
+// the Go type values of a column scan into: the type Next produces, or its
+// sql.Null* counterpart for nullable columns. Columns without a descriptor
+// report interface{}.
+func (r *Rows) ColumnTypeScanType(index int) reflect.Type {
+	column := r.columnType(index)
+	if column == nil {
+		return scanTypeAny
+	}
+	nullable := column.Nullable == nil || *column.Nullable
+
+	pick := func(value, null reflect.Type) reflect.Type {
+		if nullable {
+			return null
+		}
+		return value
+	}
+	switch dbType := r.ColumnTypeDatabaseTypeName(index); strings.TrimPrefix(dbType, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR":
+		if dbType == "UNSIGNED BIGINT" {
+			return pick(scanTypeUint64, scanTypeNullInt64)
+		}
+		return pick(scanTypeInt64, scanTypeNullInt64)
+	case "FLOAT", "DOUBLE", "REAL":
+		return pick(scanTypeFloat64, scanTypeNullFloat64)
+	case "DATE", "DATETIME", "TIMESTAMP":
+		if r.loc != nil {
+			return pick(scanTypeTime, scanTypeNullTime)
+		}
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		return scanTypeBytes
+	}
+	return pick(scanTypeString, scanTypeNullString)
+}
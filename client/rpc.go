@@ -12,7 +12,73 @@ package client
 // This design enables uniform handling of diverse operation types while
 // maintaining compatibility with Go's database/sql interface expectations.
 type RPCResponse struct {
-	Columns []string        `json:"columns"` // Column names for the result table
-	Rows    [][]interface{} `json:"rows"`    // Data rows, each containing values for all columns
-	Error   string          `json:"error"`   // Error message if operation failed (empty on success)
+	Columns   []string        `json:"columns"`             // Column names for the result table
+	Rows      [][]interface{} `json:"rows"`                // Data rows, each containing values for all columns
+	Error     string          `json:"error"`               // Error message if operation failed (empty on success)
+	ErrorCode string          `json:"errorCode,omitempty"` // Machine-readable error code (e.g. TX_NOT_FOUND)
+	Cache     *rpcCacheInfo   `json:"cache,omitempty"`     // Server query cache metadata (cacheable SQL results only)
+	Instance  string          `json:"instance,omitempty"`  // Server instance that answered (cluster mode)
+
+	Validation *rpcValidation `json:"validation,omitempty"` // Why SQL validation blocked the query
+	Result     *rpcExecResult `json:"result,omitempty"`     // Affected rows and last insert ID of Exec requests
+
+	Truncated bool  `json:"truncated,omitempty"` // Rows were cut to the server's response limits
+	TotalRows int64 `json:"totalRows,omitempty"` // Rows the result had before truncation
+
+	ColumnTypes []rpcColumnType `json:"columnTypes,omitempty"` // Column descriptors of SQL results (native_types only)
+
+	Cursor *rpcCursorInfo `json:"cursor,omitempty"` // Page of a paginated result ("CURSOR:" requests)
+
+	RateLimit *rpcRateLimitInfo `json:"rateLimit,omitempty"` // Client's rate limit budget after the request
+
+	Overload *rpcOverloadInfo `json:"overload,omitempty"` // Why the request was shed under load
+
+	Columnar *rpcColumnar `json:"columnar,omitempty"` // Rows in column-major layout, replacing Rows (columnar=true only)
+}
+
+// rpcOverloadInfo is the wire form of why the server shed a request
+type rpcOverloadInfo struct {
+	Reason       string  `json:"reason"`
+	MemoryMB     float64 `json:"memoryMB"`
+	CPUPercent   float64 `json:"cpuPercent"`
+	RetryAfterMs int64   `json:"retryAfterMs"`
+}
+
+// rpcRateLimitInfo is the wire form of the client's rate limit budget
+type rpcRateLimitInfo struct {
+	Limit        int   `json:"limit"`
+	Remaining    int   `json:"remaining"`
+	ResetMs      int64 `json:"resetMs"`
+	RetryAfterMs int64 `json:"retryAfterMs,omitempty"`
+}
+
+// rpcCursorInfo is the wire form of the page of a paginated result
+type rpcCursorInfo struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"`
+	Done   bool   `json:"done"`
+}
+
+// rpcColumnType is the wire form of a column descriptor
+type rpcColumnType struct {
+	Name         string `json:"name"`
+	DatabaseType string `json:"dbType"`
+	Nullable     *bool  `json:"nullable,omitempty"`
+	Length       int64  `json:"length,omitempty"`
+	Precision    int64  `json:"precision,omitempty"`
+	Scale        int64  `json:"scale,omitempty"`
+}
+
+// rpcCacheInfo is the wire form of the server's query cache metadata
+type rpcCacheInfo struct {
+	Hit   bool  `json:"hit"`
+	AgeMs int64 `json:"ageMs"`
+	TTLMs int64 `json:"ttlMs"`
+}
+
+// rpcExecResult is the wire form of the outcome of an Exec request
+type rpcExecResult struct {
+	RowsAffected int64 `json:"rowsAffected"`
+	LastInsertID int64 `json:"lastInsertId"`
+	Executions   int   `json:"executions"`
 }
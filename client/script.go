@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Status of a statement in a ScriptResult
+const (
+	ScriptApplied    = "applied"     // Ran successfully
+	ScriptFailed     = "failed"      // Returned an error; the script stopped here
+	ScriptRolledBack = "rolled_back" // Ran successfully but was undone because a later statement failed
+	ScriptSkipped    = "skipped"     // Not run because an earlier statement failed
+)
+
+// ScriptStatement is the outcome of one statement of a script
+type ScriptStatement struct {
+	Number       int           // Position in the script, counting from 1
+	SQL          string        // Statement text (cut to 200 characters)
+	Status       string        // ScriptApplied, ScriptFailed, ScriptRolledBack or ScriptSkipped
+	RowsAffected int64         // Rows the statement changed
+	Duration     time.Duration // Time the statement ran
+	Error        string        // Database error of a failed statement
+}
+
+// ScriptResult is the outcome of ExecScript
+type ScriptResult struct {
+	Statements []ScriptStatement
+}
+
+// Failed returns the statement that failed, or nil if the script succeeded
+func (r *ScriptResult) Failed() *ScriptStatement {
+	for i := range r.Statements {
+		if r.Statements[i].Status == ScriptFailed {
+			return &r.Statements[i]
+		}
+	}
+	return nil
+}
+
+// ExecScript runs a SQL script — statements separated by ";", or by the
+// delimiter a DELIMITER line sets — on the device. The server validates
+// every statement before running any, then runs them in order in one
+// transaction that is committed only if all of them succeed.
+//
+// When a statement fails, ExecScript returns an error naming it together
+// with the result, whose statuses show what ran, what was rolled back and
+// what was skipped. MySQL commits implicitly around DDL statements (CREATE,
+// ALTER, DROP, ...), so a failure only rolls back the statements after the
+// last one that ran; keep DDL out of scripts that must be atomic.
+//
+// Example:
+//
+//	result, err := bc.ExecScript(ctx, `
+//		INSERT INTO settings (name, value) VALUES ('mode', 'eco');
+//		UPDATE devices SET mode = 'eco' WHERE site = 'north';
+//	`)
+func (bc *BurrowClient) ExecScript(ctx context.Context, script string) (*ScriptResult, error) {
+	rows, err := bc.db.QueryContext(ctx, "SCRIPT:"+script)
+	if err != nil {
+		return nil, err
+	}
+	statements, err := allRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ScriptResult{}
+	for _, row := range statements {
+		result.Statements = append(result.Statements, ScriptStatement{
+			Number:       int(resultInt(row, "statement")),
+			SQL:          resultString(row, "sql"),
+			Status:       resultString(row, "status"),
+			RowsAffected: resultInt(row, "rows_affected"),
+			Duration:     time.Duration(resultInt(row, "duration_ms")) * time.Millisecond,
+			Error:        resultString(row, "error"),
+		})
+	}
+
+	if failed := result.Failed(); failed != nil {
+		return result, fmt.Errorf("script failed at statement %d (%s): %s", failed.Number, failed.SQL, failed.Error)
+	}
+	return result, nil
+}
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ResolveSecret returns the value a secret reference points to, so
+// credentials need not be written into code, configuration files or
+// process listings:
+//
+//   - "env:NAME": the value of the environment variable NAME (which must be set)
+//   - "file:/path": the content of the file, without trailing newlines (e.g. Docker and Kubernetes secrets)
+//
+// Any other value is returned as is.
+func ResolveSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		resolved, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return resolved, nil
+	case strings.HasPrefix(value, "file:"):
+		return readSecretFile(strings.TrimPrefix(value, "file:"))
+	}
+	return value, nil
+}
+
+// readSecretFile returns the content of a secret file without trailing newlines
+func readSecretFile(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+// resolveDSNSecrets resolves the secret references of DSN parameters: every
+// value may be an env: or file: reference, and a <name>_file parameter
+// (e.g. password_file=/run/secrets/amqp) sets <name> from a file
+func resolveDSNSecrets(values url.Values) error {
+	for key, list := range values {
+		for i, value := range list {
+			resolved, err := ResolveSecret(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", key, err)
+			}
+			list[i] = resolved
+		}
+	}
+
+	for key, list := range values {
+		name, isFile := strings.CutSuffix(key, "_file")
+		if !isFile {
+			continue
+		}
+		if values.Has(name) {
+			return fmt.Errorf("both '%s' and '%s' given in DSN", name, key)
+		}
+		secret, err := readSecretFile(list[0])
+		if err != nil {
+			return fmt.Errorf("invalid %s: %v", key, err)
+		}
+		values.Set(name, secret)
+		values.Del(key)
+	}
+	return nil
+}
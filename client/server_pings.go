@@ -0,0 +1,149 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// pingResponder answers the server's pings on an exclusive queue of the
+// connection (DSN server_pings), so the server tracks the connection and
+// keeps its session without the connection sending heartbeats between
+// queries. The queue is registered with the session open; after a
+// reconnect the responder declares a new one and opens the session again.
+type pingResponder struct {
+	conn     *Conn
+	clientID string // Identity the server tracks the connection under
+	clientIP string
+
+	mutex sync.Mutex
+	queue string        // Current ping queue (empty while none is declared)
+	ch    *amqp.Channel // Channel consuming the queue
+
+	stop chan struct{}
+	once sync.Once
+}
+
+// newPingResponder declares the ping queue of c and starts answering pings
+func newPingResponder(c *Conn, clientID string) (*pingResponder, error) {
+	p := &pingResponder{
+		conn:     c,
+		clientID: clientID,
+		clientIP: getOutboundIP(),
+		stop:     make(chan struct{}),
+	}
+	pings, err := p.declare()
+	if err != nil {
+		return nil, err
+	}
+	go p.run(pings)
+	return p, nil
+}
+
+// declare declares a ping queue on the current connection and consumes it
+func (p *pingResponder) declare() (<-chan amqp.Delivery, error) {
+	conn, err := p.conn.connMgr.GetConnection()
+	if err != nil {
+		return nil, err
+	}
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, err
+	}
+	queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+	pings, err := ch.Consume(queue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	p.mutex.Lock()
+	p.queue, p.ch = queue.Name, ch
+	p.mutex.Unlock()
+	return pings, nil
+}
+
+// currentQueue returns the queue the server should ping
+func (p *pingResponder) currentQueue() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.queue
+}
+
+// run answers pings until the responder stops. When the queue goes away
+// with the broker connection, it declares a new one once the connection is
+// back and registers it by opening the session again.
+func (p *pingResponder) run(pings <-chan amqp.Delivery) {
+	backoff := time.Second
+	for {
+		for msg := range pings {
+			p.answer(msg)
+		}
+
+		p.mutex.Lock()
+		p.queue = ""
+		p.mutex.Unlock()
+
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-time.After(backoff):
+			}
+			var err error
+			if pings, err = p.declare(); err == nil {
+				backoff = time.Second
+				break
+			}
+			p.conn.logf("Ping queue not declared: %v", err)
+			if backoff *= 2; backoff > 30*time.Second {
+				backoff = 30 * time.Second
+			}
+		}
+		p.conn.logf("Ping queue declared again: %s", p.currentQueue())
+		p.conn.openSession()
+	}
+}
+
+// answer replies to one server ping
+func (p *pingResponder) answer(msg amqp.Delivery) {
+	if msg.ReplyTo == "" {
+		return
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"type":      "client_pong",
+		"clientID":  p.clientID,
+		"timestamp": time.Now().Unix(),
+	})
+
+	p.mutex.Lock()
+	ch := p.ch
+	p.mutex.Unlock()
+	err := ch.PublishWithContext(context.Background(), "", msg.ReplyTo, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: msg.CorrelationId,
+		Body:          body,
+	})
+	if err != nil {
+		p.conn.logf("Failed to answer server ping: %v", err)
+	}
+}
+
+// Stop stops answering pings and deletes the ping queue
+func (p *pingResponder) Stop() {
+	p.once.Do(func() {
+		close(p.stop)
+		p.mutex.Lock()
+		if p.ch != nil {
+			p.ch.Close()
+		}
+		p.mutex.Unlock()
+	})
+}
@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Session setting keys understood by the server. Other lowercase keys are
+// stored as-is and returned by SessionOptions.
+const (
+	SessionRowLimit = "row_limit" // Maximum rows returned per SQL query
+	SessionPriority = "priority"  // Default request priority (high, normal, low)
+	SessionLocale   = "locale"    // Client locale, e.g. "es_AR"
+)
+
+// sessionIDs holds one generated session ID per DSN, so every pooled
+// connection of a sql.DB shares the same server-side session settings.
+var sessionIDs sync.Map
+
+// sessionIDFor returns the session ID of dsn, generating it on first use.
+func sessionIDFor(dsn string) string {
+	id, _ := sessionIDs.LoadOrStore(dsn, newClientID())
+	return id.(string)
+}
+
+// sessionRequest is the body of a "SESSION:" request
+type sessionRequest struct {
+	Action   string `json:"action"`
+	Key      string `json:"key,omitempty"`
+	Value    string `json:"value,omitempty"`
+	ClientID string `json:"clientID,omitempty"`
+
+	ClientIP  string `json:"clientIP,omitempty"`
+	PingQueue string `json:"pingQueue,omitempty"`
+}
+
+// openSessionTimeout bounds the session open sent at connect, so an
+// unreachable device does not hold up the first query for long
+const openSessionTimeout = 5 * time.Second
+
+// openSession opens the connection's session on the server at connect and
+// binds the connection's heartbeats to it: the server keeps the session's
+// transactions, prepared statements and settings while a bound connection
+// sends heartbeats, so the heartbeat then stays on between queries. With
+// server_pings the connection registers its ping queue instead, and the
+// server keeps the session while the connection answers its pings. Servers
+// that do not know sessions are left alone.
+func (c *Conn) openSession() {
+	if c.legacyProtocol() || c.config.SessionID == "" {
+		return
+	}
+
+	req := sessionRequest{Action: "open"}
+	if c.heartbeatManager != nil {
+		req.ClientID = c.heartbeatManager.clientID
+	}
+	if c.pings != nil {
+		req.ClientID = c.pings.clientID
+		req.ClientIP = c.pings.clientIP
+		req.PingQueue = c.pings.currentQueue()
+	}
+	body, _ := json.Marshal(req)
+
+	timeout := c.config.Timeout
+	if timeout <= 0 || timeout > openSessionTimeout {
+		timeout = openSessionTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	rows, err := c.queryRPC(ctx, "SESSION:"+string(body), nil)
+	if err != nil {
+		c.logf("Session %s not opened: %v", c.config.SessionID, err)
+		return
+	}
+	defer rows.Close()
+
+	values := make([]driver.Value, len(rows.Columns()))
+	if rows.Next(values) != nil || len(values) < 2 {
+		return
+	}
+	serverPinged := false
+	if len(values) > 2 {
+		serverPinged, _ = values[2].(bool)
+	}
+	if c.pings != nil && !serverPinged {
+		// The server does not ping clients; the ping queue is of no use
+		c.pings.Stop()
+	}
+	if bound, _ := values[1].(bool); bound && !serverPinged && c.heartbeatManager != nil {
+		c.rpcMutex.Lock()
+		c.sessionBound = true
+		c.rpcMutex.Unlock()
+		c.heartbeatManager.ActivateHeartbeat()
+	}
+	c.logf("Session %s opened", c.config.SessionID)
+}
+
+// session sends a session request and returns the resulting settings.
+func (bc *BurrowClient) session(ctx context.Context, req sessionRequest) (map[string]string, error) {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal session request: %w", err)
+	}
+
+	rows, err := bc.db.QueryContext(ctx, "SESSION:"+string(body))
+	if err != nil {
+		return nil, fmt.Errorf("session %s failed: %w", req.Action, err)
+	}
+	defer rows.Close()
+
+	settings := make(map[string]string)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, fmt.Errorf("failed to scan session setting: %w", err)
+		}
+		settings[key] = value
+	}
+	return settings, rows.Err()
+}
+
+// SetSessionOption stores a setting that the server applies to every later
+// request of this client until the session has been idle for the server's
+// session TTL. An empty value removes the setting.
+//
+// Example:
+//
+//	bc.SetSessionOption(ctx, client.SessionRowLimit, "500")
+//	bc.SetSessionOption(ctx, client.SessionPriority, "low")
+func (bc *BurrowClient) SetSessionOption(ctx context.Context, key, value string) error {
+	_, err := bc.session(ctx, sessionRequest{Action: "set", Key: key, Value: value})
+	return err
+}
+
+// SessionOptions returns the settings currently stored for this client.
+func (bc *BurrowClient) SessionOptions(ctx context.Context) (map[string]string, error) {
+	return bc.session(ctx, sessionRequest{Action: "get"})
+}
+
+// ClearSession removes every setting stored for this client.
+func (bc *BurrowClient) ClearSession(ctx context.Context) error {
+	_, err := bc.session(ctx, sessionRequest{Action: "clear"})
+	return err
+}
+
+// CloseSession ends this client's session on the server: its open
+// transactions are rolled back, its prepared statements closed and its
+// settings removed. Later requests start a new, empty session.
+func (bc *BurrowClient) CloseSession(ctx context.Context) error {
+	_, err := bc.session(ctx, sessionRequest{Action: "close"})
+	return err
+}
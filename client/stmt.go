@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 )
 
@@ -14,11 +15,13 @@ import (
 // - Reference to the parent connection
 // - Original query string for execution
 // - Parameter count for validation
+// - Handle of the server-side statement, when the server keeps one
 // - Prepared statement lifecycle management
 type Stmt struct {
 	conn     *Conn  // Parent connection for execution
 	query    string // Original SQL query with placeholders
 	numInput int    // Number of placeholder parameters in the query
+	handle   string // Server-side statement handle (empty: the query is sent on every execution)
 	closed   bool   // Whether the statement has been closed
 }
 
@@ -26,13 +29,53 @@ type Stmt struct {
 // After closing, the statement cannot be executed again.
 //
 // Returns:
-//   - error: Always nil as no special cleanup is required for RabbitMQ statements
+//   - error: Always nil; failing to release the server-side statement only
+//     leaves it to the server's idle expiry
 func (s *Stmt) Close() error {
+	if s.closed {
+		return nil
+	}
 	s.closed = true
+
+	// Release the server-side statement
+	if s.handle != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), s.conn.config.Timeout)
+		defer cancel()
+		if err := s.conn.deallocateRemote(ctx, s.handle); err != nil {
+			s.conn.logf("Failed to release statement %s on the server: %v", s.handle, err)
+		}
+		s.handle = ""
+	}
+
 	s.conn.logf("Prepared statement closed: %s", s.query)
 	return nil
 }
 
+// run executes the statement, by handle when the server keeps it. A server
+// that lost the statement (idle expiry or restart) gets it prepared again;
+// if that fails the query is sent in full from then on.
+func (s *Stmt) run(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	if s.handle == "" {
+		return s.conn.queryRPC(ctx, s.query, args)
+	}
+
+	rows, err := s.conn.queryRPC(withStatementID(ctx, s.handle), s.query, args)
+	var stmtErr *statementError
+	if !errors.As(err, &stmtErr) || stmtErr.code != errCodeStmtNotFound {
+		return rows, err
+	}
+
+	s.conn.logf("Statement %s no longer on the server, preparing it again", s.handle)
+	observeRetry(s.conn.deviceID, "statement not found")
+	handle, err := s.conn.prepareRemote(ctx, s.query)
+	if err != nil {
+		s.handle = ""
+		return s.conn.queryRPC(ctx, s.query, args)
+	}
+	s.handle = handle
+	return s.conn.queryRPC(withStatementID(ctx, s.handle), s.query, args)
+}
+
 // NumInput implements the driver.Stmt interface and returns the number of
 // placeholder parameters in the prepared statement.
 //
@@ -49,7 +92,7 @@ func (s *Stmt) NumInput() int {
 //   - args: Parameter values to bind to the query placeholders
 //
 // Returns:
-//   - driver.Result: Execution result (typically showing affected rows)
+//   - driver.Result: Affected rows and last insert ID
 //   - error: Any error that occurred during execution
 func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
 	if s.closed {
@@ -73,16 +116,12 @@ func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), s.conn.config.Timeout)
 	defer cancel()
 
-	// Execute through existing RPC mechanism
-	rows, err := s.conn.queryRPC(ctx, s.query, named)
+	// Execute through existing RPC mechanism, asking for the affected rows
+	rows, err := s.run(withExec(ctx, nil), named)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	// For non-SELECT statements, return a simple result
-	// Note: In a real implementation, the server should return affected row counts
-	return &Result{}, nil
+	return execResult(rows)
 }
 
 // Query implements the driver.Stmt interface for executing prepared statements
@@ -117,7 +156,7 @@ func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
 	defer cancel()
 
 	// Execute through existing RPC mechanism
-	return s.conn.queryRPC(ctx, s.query, named)
+	return s.run(ctx, named)
 }
 
 // ExecContext implements the driver.StmtExecContext interface for context-aware
@@ -128,7 +167,7 @@ func (s *Stmt) Query(args []driver.Value) (driver.Rows, error) {
 //   - args: Parameter values to bind to the query placeholders
 //
 // Returns:
-//   - driver.Result: Execution result (typically showing affected rows)
+//   - driver.Result: Affected rows and last insert ID
 //   - error: Any error that occurred during execution
 func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
 	if s.closed {
@@ -142,15 +181,12 @@ func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (drive
 
 	s.conn.logf("Executing prepared statement (context) with %d parameters", len(args))
 
-	// Execute through existing RPC mechanism
-	rows, err := s.conn.queryRPC(ctx, s.query, args)
+	// Execute through existing RPC mechanism, asking for the affected rows
+	rows, err := s.run(withExec(ctx, nil), args)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
-	// For non-SELECT statements, return a simple result
-	return &Result{}, nil
+	return execResult(rows)
 }
 
 // QueryContext implements the driver.StmtQueryContext interface for context-aware
@@ -176,12 +212,12 @@ func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driv
 	s.conn.logf("Querying prepared statement (context) with %d parameters", len(args))
 
 	// Execute through existing RPC mechanism
-	return s.conn.queryRPC(ctx, s.query, args)
+	return s.run(ctx, args)
 }
 
-// Result implements the driver.Result interface for prepared statement execution results.
-// This is a simple implementation that would be enhanced with actual server-side
-// result metadata in a production system.
+// Result implements the driver.Result interface for statement execution results.
+// It holds the affected rows and last insert ID reported by the server; servers
+// that predate Exec requests report zero for both.
 type Result struct {
 	affectedRows int64
 	lastInsertID int64
@@ -191,7 +227,7 @@ type Result struct {
 // Returns the last insert ID for INSERT statements.
 //
 // Returns:
-//   - int64: Last insert ID (currently always 0)
+//   - int64: Last insert ID (0 if the statement generated none)
 //   - error: Always nil in this implementation
 func (r *Result) LastInsertId() (int64, error) {
 	return r.lastInsertID, nil
@@ -201,7 +237,7 @@ func (r *Result) LastInsertId() (int64, error) {
 // Returns the number of rows affected by the statement.
 //
 // Returns:
-//   - int64: Number of affected rows (currently always 0)
+//   - int64: Number of affected rows, summed over every parameter set of a batch
 //   - error: Always nil in this implementation
 func (r *Result) RowsAffected() (int64, error) {
 	return r.affectedRows, nil
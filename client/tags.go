@@ -0,0 +1,26 @@
+package client
+
+import "context"
+
+// requestTagKey is the context key for request tags.
+type requestTagKey struct{}
+
+// WithRequestTag returns a context that labels every request run with it.
+// The tag is a free-form string, such as a job or trace ID, that the server
+// writes to its logs, audit records and slow query log, so a request can be
+// followed across systems. BEGIN, COMMIT and ROLLBACK carry the tag of the
+// context the transaction was started with.
+//
+// Example:
+//
+//	ctx := client.WithRequestTag(context.Background(), "invoice-job-42")
+//	db.ExecContext(ctx, "UPDATE invoices SET sent = 1 WHERE id = ?", id)
+func WithRequestTag(ctx context.Context, tag string) context.Context {
+	return context.WithValue(ctx, requestTagKey{}, tag)
+}
+
+// requestTagFromContext returns the tag stored in ctx, if any.
+func requestTagFromContext(ctx context.Context) (string, bool) {
+	tag, ok := ctx.Value(requestTagKey{}).(string)
+	return tag, ok && tag != ""
+}
@@ -0,0 +1,127 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DeviceTelemetry is a snapshot of the resources of the host a device runs
+// on, as reported by a server with telemetry enabled. Values the device's
+// platform cannot provide are zero.
+type DeviceTelemetry struct {
+	DeviceID    string    `json:"device_id"`
+	Hostname    string    `json:"hostname"`
+	CollectedAt time.Time `json:"collected_at"`
+	Uptime      float64   `json:"uptime_seconds"` // Time since the server started
+
+	// CPU
+	NumCPU      int       `json:"num_cpu"`
+	CPUPercent  float64   `json:"cpu_percent"`            // Server process CPU use, in percent of all cores
+	LoadAverage []float64 `json:"load_average,omitempty"` // Host 1, 5 and 15 minute load (Linux)
+	Goroutines  int       `json:"goroutines"`
+
+	// Memory
+	MemoryMB          float64 `json:"memory_mb"`                      // Server process RSS
+	HostMemoryTotalMB float64 `json:"host_memory_total_mb,omitempty"` // Linux
+	HostMemoryFreeMB  float64 `json:"host_memory_free_mb,omitempty"`  // Available for new processes (Linux)
+
+	// Disk
+	DiskPath        string  `json:"disk_path"`
+	DiskTotalBytes  uint64  `json:"disk_total_bytes"`
+	DiskFreeBytes   uint64  `json:"disk_free_bytes"`
+	DiskUsedPercent float64 `json:"disk_used_percent"`
+	DiskError       string  `json:"disk_error,omitempty"`
+
+	// Database
+	DBUp        bool   `json:"db_up"`
+	DBSizeBytes int64  `json:"db_size_bytes"`
+	DBError     string `json:"db_error,omitempty"`
+
+	// Queues
+	QueueDepth      int    `json:"queue_depth"`     // Requests waiting in the RPC queue
+	QueueConsumers  int    `json:"queue_consumers"` // Server instances consuming it
+	QueueError      string `json:"queue_error,omitempty"`
+	WorkerQueued    int    `json:"worker_queued"` // Requests waiting for a server worker
+	WorkerQueueSize int    `json:"worker_queue_size"`
+}
+
+// GetDeviceTelemetry asks the device for a fresh telemetry snapshot through
+// the getDeviceTelemetry function, registered when the server runs with
+// telemetry enabled.
+func (bc *BurrowClient) GetDeviceTelemetry(ctx context.Context) (*DeviceTelemetry, error) {
+	result, err := bc.ExecFunctionContext(ctx, "getDeviceTelemetry")
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(result.Result)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode device telemetry: %w", err)
+	}
+	var telemetry DeviceTelemetry
+	if err := json.Unmarshal(data, &telemetry); err != nil {
+		return nil, fmt.Errorf("failed to decode device telemetry: %w", err)
+	}
+	return &telemetry, nil
+}
+
+// SubscribeTelemetry receives the telemetry the devices of the DSN's
+// namespace publish periodically. With no device IDs it receives every
+// device's reports, which is how a fleet dashboard follows all devices
+// through one subscription; topic wildcards are accepted as for Subscribe.
+// Reports published while no subscription is active are not delivered.
+//
+// The subscription uses its own RabbitMQ connection and reconnects like
+// Subscribe. The returned channel is closed when ctx is done or
+// reconnecting gives up.
+//
+// Example:
+//
+//	reports, err := bc.SubscribeTelemetry(ctx)
+//	for t := range reports {
+//		log.Printf("%s: cpu %.0f%%, disk %.0f%%, queue %d", t.DeviceID, t.CPUPercent, t.DiskUsedPercent, t.QueueDepth)
+//	}
+func (bc *BurrowClient) SubscribeTelemetry(ctx context.Context, deviceIDs ...string) (<-chan DeviceTelemetry, error) {
+	if len(deviceIDs) == 0 {
+		deviceIDs = []string{"#"}
+	}
+	for _, deviceID := range deviceIDs {
+		if !subscriptionPattern.MatchString(deviceID) {
+			return nil, fmt.Errorf("invalid device ID '%s'", deviceID)
+		}
+	}
+
+	config := bc.config
+	topology, err := NewTopology(config.Namespace, config.DeviceID)
+	if err != nil {
+		return nil, err
+	}
+
+	sub := &subscription{config: config, exchange: topology.TelemetryExchange, channels: deviceIDs}
+	deliveries, err := sub.connect()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event)
+	go sub.forward(ctx, deliveries, events)
+
+	reports := make(chan DeviceTelemetry)
+	go func() {
+		defer close(reports)
+		for event := range events {
+			var telemetry DeviceTelemetry
+			if err := event.Decode(&telemetry); err != nil {
+				continue
+			}
+			select {
+			case reports <- telemetry:
+			case <-ctx.Done():
+				// Let forward see ctx and close events
+			}
+		}
+	}()
+	return reports, nil
+}
@@ -0,0 +1,34 @@
+package client
+
+import "context"
+
+// TokenSource returns the token to present with a request, such as a JWT
+// issued by an auth service. It is called for every request, so it should
+// cache the token and only fetch a new one when it is about to expire.
+type TokenSource func(ctx context.Context) (string, error)
+
+// tokenKey is the context key for the token of a request.
+type tokenKey struct{}
+
+// WithToken returns a context whose queries present the given token to the
+// server, overriding the DSN token and the connector's TokenSource.
+//
+// Example:
+//
+//	ctx := client.WithToken(r.Context(), jwt)
+//	db.QueryContext(ctx, "SELECT * FROM orders WHERE customer_id = ?", id)
+func WithToken(ctx context.Context, token string) context.Context {
+	return context.WithValue(ctx, tokenKey{}, token)
+}
+
+// token returns the token to present with a request: the one of ctx, else
+// the TokenSource's, else the DSN's
+func (c *Conn) token(ctx context.Context) (string, error) {
+	if token, ok := ctx.Value(tokenKey{}).(string); ok {
+		return token, nil
+	}
+	if c.config.TokenSource != nil {
+		return c.config.TokenSource(ctx)
+	}
+	return c.config.Token, nil
+}
@@ -0,0 +1,117 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is a request or response carried by a Transport
+type Message struct {
+	CorrelationID string        // Matches a response to its request
+	ReplyTo       string        // Address the response is sent to
+	UserID        string        // Identity the broker verified for the publisher (empty if the transport has none)
+	Body          []byte        // Serialized request or response
+	TTL           time.Duration // Discard the request if it is not consumed in time (0 = never)
+}
+
+// Transport carries requests to a device and responses back. RabbitMQ
+// (amqp://) is built in with its own implementation, which supports
+// features the interface does not cover (instance queues, direct reply-to,
+// dead-lettering, ...). Other brokers plug in through Transport and are
+// selected by the scheme of the DSN's amqp_uri, e.g. nats://.
+//
+// Queue names are the names of Topology; a transport maps them to its own
+// addressing (subjects for NATS). Implementations must be safe for
+// concurrent use.
+type Transport interface {
+	// Publish sends msg to queue
+	Publish(ctx context.Context, queue string, msg Message) error
+	// Consume delivers the messages sent to queue until ctx is done or the
+	// transport is closed, then closes the channel. Consumers of the same
+	// queue share its messages.
+	Consume(ctx context.Context, queue string) (<-chan Message, error)
+	// Reply sends body as the response to request
+	Reply(ctx context.Context, request Message, body []byte) error
+	// Request publishes msg to queue and waits for its response
+	Request(ctx context.Context, queue string, msg Message) (Message, error)
+	// Close releases the connection to the broker
+	Close() error
+}
+
+// TransportOpener connects a Transport to the broker at rawURL
+type TransportOpener func(rawURL string) (Transport, error)
+
+var (
+	transportsMutex sync.RWMutex
+	transports      = make(map[string]TransportOpener)
+)
+
+// RegisterTransport makes a transport available for URLs with the given
+// scheme. It panics if the scheme is amqp, empty or already registered.
+func RegisterTransport(scheme string, open TransportOpener) {
+	transportsMutex.Lock()
+	defer transportsMutex.Unlock()
+
+	scheme = strings.ToLower(scheme)
+	if scheme == "" || scheme == "amqp" || scheme == "amqps" {
+		panic("burrowctl: cannot register a transport for scheme '" + scheme + "'")
+	}
+	if _, exists := transports[scheme]; exists {
+		panic("burrowctl: transport registered twice for scheme " + scheme)
+	}
+	transports[scheme] = open
+}
+
+// OpenTransport connects the transport registered for the scheme of rawURL
+func OpenTransport(rawURL string) (Transport, error) {
+	scheme := urlScheme(rawURL)
+	transportsMutex.RLock()
+	open, ok := transports[scheme]
+	transportsMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no transport registered for scheme '%s' (available: amqp, %s)", scheme, strings.Join(transportSchemes(), ", "))
+	}
+	return open(rawURL)
+}
+
+// IsAMQPURL reports whether rawURL is served by the built-in RabbitMQ
+// implementation rather than a registered Transport
+func IsAMQPURL(rawURL string) bool {
+	scheme := urlScheme(rawURL)
+	return scheme == "amqp" || scheme == "amqps"
+}
+
+// transportSchemes returns the registered schemes, sorted
+func transportSchemes() []string {
+	transportsMutex.RLock()
+	defer transportsMutex.RUnlock()
+
+	schemes := make([]string, 0, len(transports))
+	for scheme := range transports {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
+
+// isTransportScheme reports whether a transport is registered for scheme
+func isTransportScheme(scheme string) bool {
+	transportsMutex.RLock()
+	defer transportsMutex.RUnlock()
+	_, ok := transports[scheme]
+	return ok
+}
+
+// urlScheme returns the lower-case scheme of rawURL
+func urlScheme(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Scheme)
+}
@@ -0,0 +1,220 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// memoryQueueBuffer is the number of messages a memory queue holds before
+// Publish blocks
+const memoryQueueBuffer = 256
+
+func init() {
+	RegisterTransport("mem", OpenMemoryTransport)
+}
+
+// memoryBuses holds every in-process bus by name
+var (
+	memoryBusesMutex sync.Mutex
+	memoryBuses      = make(map[string]*memoryBus)
+)
+
+// memoryEntry is a message waiting in a memory queue
+type memoryEntry struct {
+	msg     Message
+	expires time.Time // Zero if the message does not expire
+}
+
+// memoryBus is the in-process broker shared by the transports opened on
+// the same URL
+type memoryBus struct {
+	mutex   sync.Mutex
+	queues  map[string]chan memoryEntry // Queue name -> waiting messages
+	inboxes map[string]chan Message     // Reply address -> request waiting for its response
+	inboxID uint64                      // Last inbox number handed out
+}
+
+// memoryBusFor returns the bus called name, creating it on first use
+func memoryBusFor(name string) *memoryBus {
+	memoryBusesMutex.Lock()
+	defer memoryBusesMutex.Unlock()
+
+	bus, ok := memoryBuses[name]
+	if !ok {
+		bus = &memoryBus{
+			queues:  make(map[string]chan memoryEntry),
+			inboxes: make(map[string]chan Message),
+		}
+		memoryBuses[name] = bus
+	}
+	return bus
+}
+
+// queue returns the named queue, creating it on first use
+func (b *memoryBus) queue(name string) chan memoryEntry {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	q, ok := b.queues[name]
+	if !ok {
+		q = make(chan memoryEntry, memoryQueueBuffer)
+		b.queues[name] = q
+	}
+	return q
+}
+
+// openInbox registers a reply address for one response
+func (b *memoryBus) openInbox() (string, chan Message) {
+	name := fmt.Sprintf("_INBOX.%d", atomic.AddUint64(&b.inboxID, 1))
+	inbox := make(chan Message, 1)
+	b.mutex.Lock()
+	b.inboxes[name] = inbox
+	b.mutex.Unlock()
+	return name, inbox
+}
+
+// closeInbox stops accepting the response sent to name
+func (b *memoryBus) closeInbox(name string) {
+	b.mutex.Lock()
+	delete(b.inboxes, name)
+	b.mutex.Unlock()
+}
+
+// MemoryTransport is a Transport that connects clients and servers of the
+// same process without a broker, for tests. Transports opened with the same
+// URL share one bus: mem://test on the server side and in the client's
+// amqp_uri wire a database/sql connection straight to a Handler.
+//
+// Queues behave like AMQP queues: messages wait until a consumer takes them,
+// consumers of one queue share its messages and expired messages are
+// dropped. A user in the URL (mem://alice@test) is stamped on every message
+// as the verified publisher identity, like RabbitMQ's user-id. Buses live
+// as long as the process, so tests that must not see each other's requests
+// use different bus names.
+type MemoryTransport struct {
+	bus       *memoryBus
+	userID    string        // Identity stamped on published messages
+	closed    chan struct{} // Closed by Close
+	closeOnce sync.Once
+}
+
+// OpenMemoryTransport joins the in-process bus named by the host and path of
+// rawURL
+func OpenMemoryTransport(rawURL string) (Transport, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid memory transport URL: %w", err)
+	}
+	if u.Host == "" && u.Path == "" {
+		return nil, fmt.Errorf("memory transport URL must name a bus, e.g. mem://test")
+	}
+	return &MemoryTransport{
+		bus:    memoryBusFor(u.Host + u.Path),
+		userID: u.User.Username(),
+		closed: make(chan struct{}),
+	}, nil
+}
+
+// Publish adds msg to queue, waiting while the queue is full
+func (t *MemoryTransport) Publish(ctx context.Context, queue string, msg Message) error {
+	msg.UserID = t.userID
+	entry := memoryEntry{msg: msg}
+	if msg.TTL > 0 {
+		entry.expires = time.Now().Add(msg.TTL)
+	}
+
+	select {
+	case t.bus.queue(queue) <- entry:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.closed:
+		return fmt.Errorf("memory transport is closed")
+	}
+}
+
+// Consume takes messages from queue, sharing them with its other consumers
+func (t *MemoryTransport) Consume(ctx context.Context, queue string) (<-chan Message, error) {
+	q := t.bus.queue(queue)
+	msgs := make(chan Message)
+	go func() {
+		defer close(msgs)
+		for {
+			var entry memoryEntry
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.closed:
+				return
+			case entry = <-q:
+			}
+			if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+				continue
+			}
+
+			select {
+			case msgs <- entry.msg:
+			case <-ctx.Done():
+				t.requeue(q, entry)
+				return
+			case <-t.closed:
+				t.requeue(q, entry)
+				return
+			}
+		}
+	}()
+	return msgs, nil
+}
+
+// requeue gives back a message a stopping consumer took but did not deliver
+func (t *MemoryTransport) requeue(q chan memoryEntry, entry memoryEntry) {
+	select {
+	case q <- entry:
+	default:
+	}
+}
+
+// Reply sends body to the inbox of request
+func (t *MemoryTransport) Reply(ctx context.Context, request Message, body []byte) error {
+	t.bus.mutex.Lock()
+	inbox, ok := t.bus.inboxes[request.ReplyTo]
+	delete(t.bus.inboxes, request.ReplyTo)
+	t.bus.mutex.Unlock()
+	if !ok {
+		return fmt.Errorf("reply inbox '%s' is gone", request.ReplyTo)
+	}
+
+	inbox <- Message{CorrelationID: request.CorrelationID, UserID: t.userID, Body: body}
+	return nil
+}
+
+// Request publishes msg to queue and waits for the response
+func (t *MemoryTransport) Request(ctx context.Context, queue string, msg Message) (Message, error) {
+	name, inbox := t.bus.openInbox()
+	defer t.bus.closeInbox(name)
+
+	msg.ReplyTo = name
+	if err := t.Publish(ctx, queue, msg); err != nil {
+		return Message{}, err
+	}
+
+	select {
+	case reply := <-inbox:
+		return reply, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	case <-t.closed:
+		return Message{}, fmt.Errorf("memory transport is closed")
+	}
+}
+
+// Close stops the consumers and pending requests of this transport. The
+// bus and its waiting messages stay for the other transports on it.
+func (t *MemoryTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
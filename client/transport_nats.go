@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/nats-io/nats.go"
+)
+
+// natsCorrelationHeader carries Message.CorrelationID in NATS headers
+const natsCorrelationHeader = "Correlation-Id"
+
+// natsQueueGroup is the queue group every consumer of a subject joins, so
+// server instances sharing a device split its requests like AMQP consumers
+// of one queue
+const natsQueueGroup = "burrowctl"
+
+// natsConsumeBuffer is the number of messages a consumer buffers
+const natsConsumeBuffer = 256
+
+func init() {
+	RegisterTransport("nats", OpenNATSTransport)
+}
+
+// NATSTransport is a Transport over core NATS. Queue names are used as
+// subjects, and requests use NATS request-reply with a private inbox.
+//
+// Core NATS does not store messages: a request published while no server
+// listens on the device fails at once with "no responders" instead of
+// waiting in a queue, so Message.TTL does not apply. NATS does not stamp a
+// verified publisher identity either, so Message.UserID is always empty and
+// on_behalf_of requests are refused by the server.
+type NATSTransport struct {
+	conn   *nats.Conn
+	closed chan struct{} // Closed once the connection is closed for good
+}
+
+// OpenNATSTransport connects to the NATS server at rawURL. The connection
+// reconnects on its own after a network failure.
+func OpenNATSTransport(rawURL string) (Transport, error) {
+	t := &NATSTransport{closed: make(chan struct{})}
+	conn, err := nats.Connect(rawURL,
+		nats.Name("burrowctl"),
+		nats.MaxReconnects(-1),
+		nats.ClosedHandler(func(*nats.Conn) { close(t.closed) }),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	t.conn = conn
+	return t, nil
+}
+
+// newNATSMsg converts msg to a NATS message for subject
+func newNATSMsg(subject string, msg Message) *nats.Msg {
+	natsMsg := nats.NewMsg(subject)
+	natsMsg.Reply = msg.ReplyTo
+	natsMsg.Data = msg.Body
+	if msg.CorrelationID != "" {
+		natsMsg.Header.Set(natsCorrelationHeader, msg.CorrelationID)
+	}
+	return natsMsg
+}
+
+// fromNATSMsg converts a NATS message to a Message
+func fromNATSMsg(natsMsg *nats.Msg) Message {
+	return Message{
+		CorrelationID: natsMsg.Header.Get(natsCorrelationHeader),
+		ReplyTo:       natsMsg.Reply,
+		Body:          natsMsg.Data,
+	}
+}
+
+// Publish sends msg to the subject queue
+func (t *NATSTransport) Publish(ctx context.Context, queue string, msg Message) error {
+	return t.conn.PublishMsg(newNATSMsg(queue, msg))
+}
+
+// Consume joins the queue group of the subject queue
+func (t *NATSTransport) Consume(ctx context.Context, queue string) (<-chan Message, error) {
+	natsMsgs := make(chan *nats.Msg, natsConsumeBuffer)
+	sub, err := t.conn.ChanQueueSubscribe(queue, natsQueueGroup, natsMsgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to subscribe to '%s': %w", queue, err)
+	}
+
+	msgs := make(chan Message)
+	go func() {
+		defer close(msgs)
+		defer sub.Unsubscribe()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-t.closed:
+				return
+			case natsMsg := <-natsMsgs:
+				select {
+				case msgs <- fromNATSMsg(natsMsg):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return msgs, nil
+}
+
+// Reply publishes body to the inbox of request
+func (t *NATSTransport) Reply(ctx context.Context, request Message, body []byte) error {
+	if request.ReplyTo == "" {
+		return fmt.Errorf("request %s has no reply subject", request.CorrelationID)
+	}
+	return t.conn.PublishMsg(newNATSMsg(request.ReplyTo, Message{
+		CorrelationID: request.CorrelationID,
+		Body:          body,
+	}))
+}
+
+// Request sends msg to the subject queue and waits for the response
+func (t *NATSTransport) Request(ctx context.Context, queue string, msg Message) (Message, error) {
+	msg.ReplyTo = ""
+	reply, err := t.conn.RequestMsgWithContext(ctx, newNATSMsg(queue, msg))
+	if err != nil {
+		if errors.Is(err, nats.ErrNoResponders) {
+			return Message{}, fmt.Errorf("no server is listening on '%s'", queue)
+		}
+		return Message{}, err
+	}
+	return fromNATSMsg(reply), nil
+}
+
+// Close closes the connection
+func (t *NATSTransport) Close() error {
+	t.conn.Close()
+	return nil
+}
@@ -0,0 +1,39 @@
+package client
+
+import "context"
+
+// TruncationInfo tells whether the server cut a result to its response size
+// limits (-max-response-rows, -max-response-bytes). Request it with
+// WithTruncationInfo.
+type TruncationInfo struct {
+	Truncated bool  // Rows were left out of the result
+	TotalRows int64 // Rows of the full result (a lower bound if the server's query timeout cut counting short)
+}
+
+// truncationInfoKey is the context key for the TruncationInfo a query fills in.
+type truncationInfoKey struct{}
+
+// WithTruncationInfo returns a context whose queries store in info whether
+// their result was truncated. The last query made with the context wins.
+//
+// Example:
+//
+//	var info client.TruncationInfo
+//	rows, err := db.QueryContext(client.WithTruncationInfo(ctx, &info), "SELECT * FROM events")
+//	...
+//	if info.Truncated {
+//		log.Printf("showing %d of %d events", shown, info.TotalRows)
+//	}
+func WithTruncationInfo(ctx context.Context, info *TruncationInfo) context.Context {
+	return context.WithValue(ctx, truncationInfoKey{}, info)
+}
+
+// recordTruncationInfo copies the response's truncation metadata into the
+// TruncationInfo requested through ctx, if any.
+func recordTruncationInfo(ctx context.Context, resp RPCResponse) {
+	info, ok := ctx.Value(truncationInfoKey{}).(*TruncationInfo)
+	if !ok || info == nil {
+		return
+	}
+	*info = TruncationInfo{Truncated: resp.Truncated, TotalRows: resp.TotalRows}
+}
@@ -3,6 +3,7 @@ package client
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
@@ -20,13 +21,15 @@ import (
 // - Provides timeout handling for transaction operations
 // - Supports nested transaction detection and prevention
 type Tx struct {
-	conn           *Conn           // Parent connection
-	transactionID  string          // Unique transaction identifier
-	state          TxState         // Current transaction state
-	startTime      time.Time       // When transaction began
-	mutex          sync.RWMutex    // Thread-safe state access
-	ctx            context.Context // Context for cancellation
-	cancel         context.CancelFunc
+	conn          *Conn           // Parent connection
+	transactionID string          // Unique transaction identifier
+	state         TxState         // Current transaction state
+	startTime     time.Time       // When transaction began
+	instance      string          // Server instance holding the transaction (cluster mode, set by BEGIN)
+	sequence      int64           // Number of the last statement sent (replay protection)
+	mutex         sync.RWMutex    // Thread-safe state access
+	ctx           context.Context // Context for cancellation
+	cancel        context.CancelFunc
 }
 
 // TxState represents the current state of a transaction
@@ -36,6 +39,7 @@ const (
 	TxActive TxState = iota
 	TxCommitted
 	TxRolledBack
+	TxFailed // The server no longer knows the transaction (expired, restarted, or COMMIT/ROLLBACK failed)
 )
 
 // String returns a string representation of the transaction state
@@ -47,6 +51,8 @@ func (ts TxState) String() string {
 		return "committed"
 	case TxRolledBack:
 		return "rolled_back"
+	case TxFailed:
+		return "failed"
 	default:
 		return "unknown"
 	}
@@ -80,66 +86,91 @@ func newTransaction(conn *Conn) *Tx {
 // It sends a COMMIT command to the server and marks the transaction as committed.
 //
 // Returns:
-//   - error: Any error that occurred during commit
+//   - error: A *TxError if the transaction is not active or the server rejected the COMMIT
 func (tx *Tx) Commit() error {
+	return tx.finish("COMMIT", TxCommitted)
+}
+
+// Rollback implements the driver.Tx interface and rolls back the transaction.
+// It sends a ROLLBACK command to the server and marks the transaction as rolled back.
+//
+// Returns:
+//   - error: A *TxError if the transaction is not active or the server rejected the ROLLBACK
+func (tx *Tx) Rollback() error {
+	return tx.finish("ROLLBACK", TxRolledBack)
+}
+
+// finish sends a terminal transaction command and applies the resulting state transition.
+// If the server reports that the transaction no longer exists, the transaction moves
+// to TxFailed so that the connection can start a new one.
+//
+// Parameters:
+//   - command: Transaction command to send ("COMMIT" or "ROLLBACK")
+//   - next: State to move to when the command succeeds
+//
+// Returns:
+//   - error: Any error that occurred during the command
+func (tx *Tx) finish(command string, next TxState) error {
+	err := tx.applyFinish(command, next)
+
+	// Clear transaction reference from connection. This must happen without
+	// holding tx.mutex because the connection inspects the transaction state.
+	tx.conn.clearFinishedTransaction()
+	return err
+}
+
+// applyFinish performs the state transition for finish under the transaction lock.
+func (tx *Tx) applyFinish(command string, next TxState) error {
 	tx.mutex.Lock()
 	defer tx.mutex.Unlock()
 
-	if tx.state != TxActive {
-		return fmt.Errorf("transaction is not active (state: %s)", tx.state)
+	if !tx.state.CanTransition(next) {
+		return terminalStateError(tx.transactionID, tx.state)
 	}
 
-	tx.conn.logf("Committing transaction: %s", tx.transactionID)
+	tx.conn.logf("Sending %s for transaction: %s", command, tx.transactionID)
 
-	// Send COMMIT command to server
-	err := tx.executeTransactionCommand("COMMIT")
+	err := tx.executeTransactionCommand(command)
 	if err != nil {
-		tx.conn.logf("Transaction commit failed: %s, error: %v", tx.transactionID, err)
-		return fmt.Errorf("failed to commit transaction: %v", err)
+		tx.conn.logf("Transaction %s failed: %s, error: %v", command, tx.transactionID, err)
+
+		var txErr *TxError
+		if errors.As(err, &txErr) && isTerminalTxCode(txErr.Code) {
+			tx.state = TxFailed
+			tx.cancel()
+		}
+		return err
 	}
 
-	tx.state = TxCommitted
+	tx.state = next
 	tx.cancel() // Cancel context to free resources
-	
+
 	duration := time.Since(tx.startTime)
-	tx.conn.logf("Transaction committed successfully: %s (duration: %v)", tx.transactionID, duration)
-	
-	// Clear transaction reference from connection
-	tx.conn.clearFinishedTransaction()
+	tx.conn.logf("Transaction %s completed: %s (duration: %v)", command, tx.transactionID, duration)
 	return nil
 }
 
-// Rollback implements the driver.Tx interface and rolls back the transaction.
-// It sends a ROLLBACK command to the server and marks the transaction as rolled back.
-//
-// Returns:
-//   - error: Any error that occurred during rollback
-func (tx *Tx) Rollback() error {
+// nextSequence numbers the next statement of the transaction, so the server
+// can recognise a statement the broker delivers twice and not run it again.
+func (tx *Tx) nextSequence() int64 {
 	tx.mutex.Lock()
 	defer tx.mutex.Unlock()
 
-	if tx.state != TxActive {
-		return fmt.Errorf("transaction is not active (state: %s)", tx.state)
-	}
+	tx.sequence++
+	return tx.sequence
+}
 
-	tx.conn.logf("Rolling back transaction: %s", tx.transactionID)
+// markFailed moves the transaction to TxFailed after the server reported that
+// it no longer exists. It is a no-op for transactions that are already finished.
+func (tx *Tx) markFailed() {
+	tx.mutex.Lock()
+	defer tx.mutex.Unlock()
 
-	// Send ROLLBACK command to server
-	err := tx.executeTransactionCommand("ROLLBACK")
-	if err != nil {
-		tx.conn.logf("Transaction rollback failed: %s, error: %v", tx.transactionID, err)
-		return fmt.Errorf("failed to rollback transaction: %v", err)
+	if tx.state.CanTransition(TxFailed) {
+		tx.state = TxFailed
+		tx.cancel()
+		tx.conn.logf("Transaction marked as failed: %s", tx.transactionID)
 	}
-
-	tx.state = TxRolledBack
-	tx.cancel() // Cancel context to free resources
-	
-	duration := time.Since(tx.startTime)
-	tx.conn.logf("Transaction rolled back successfully: %s (duration: %v)", tx.transactionID, duration)
-	
-	// Clear transaction reference from connection
-	tx.conn.clearFinishedTransaction()
-	return nil
 }
 
 // executeTransactionCommand sends a transaction command (BEGIN, COMMIT, ROLLBACK) to the server.
@@ -151,27 +182,8 @@ func (tx *Tx) Rollback() error {
 // Returns:
 //   - error: Any error that occurred during command execution
 func (tx *Tx) executeTransactionCommand(command string) error {
-	// Get current connection from connection manager
-	conn, err := tx.conn.connMgr.GetConnection()
-	if err != nil {
-		return fmt.Errorf("no active connection: %v", err)
-	}
-
-	// Create RabbitMQ channel for this transaction command
-	ch, err := conn.Channel()
-	if err != nil {
-		return fmt.Errorf("failed to create RabbitMQ channel: %v", err)
-	}
-	defer ch.Close()
-
-	// Declare exclusive reply queue for receiving response
-	replyQueue, err := ch.QueueDeclare("", false, true, true, false, nil)
-	if err != nil {
-		return fmt.Errorf("failed to declare reply queue: %v", err)
-	}
-
 	// Generate unique correlation ID for request-response matching
-	corrID := fmt.Sprintf("tx_%d", time.Now().UnixNano())
+	corrID := newCorrelationID("tx")
 
 	// Build transaction command request
 	req := map[string]interface{}{
@@ -181,56 +193,154 @@ func (tx *Tx) executeTransactionCommand(command string) error {
 		"command":       command,                 // Transaction command (BEGIN, COMMIT, ROLLBACK)
 		"clientIP":      getOutboundIP(),         // Client IP for logging
 	}
+	if !tx.conn.legacyProtocol() {
+		req["protocolVersion"] = tx.conn.config.ProtocolVersion
+		if tx.conn.config.OnBehalfOf != "" {
+			req["onBehalfOf"] = tx.conn.config.OnBehalfOf
+		}
+		if tag, ok := requestTagFromContext(tx.ctx); ok {
+			req["tag"] = tag
+		}
+		token, err := tx.conn.token(tx.ctx)
+		if err != nil {
+			return fmt.Errorf("failed to get token: %w", err)
+		}
+		if token != "" {
+			req["token"] = token
+		}
+		req["nonce"] = newNonce()
+		req["timestamp"] = time.Now().UnixMilli()
+		// The server rolls the transaction back if the session ends first
+		if tx.conn.config.SessionID != "" {
+			req["sessionID"] = tx.conn.config.SessionID
+		}
+	}
 
 	// Serialize request to JSON
-	body, _ := json.Marshal(req)
+	body, err := tx.conn.marshalRequest(req)
+	if err != nil {
+		return fmt.Errorf("failed to serialize transaction command: %w", err)
+	}
 
 	tx.conn.logf("Sending transaction command '%s' for transaction %s", command, tx.transactionID)
 
-	// Publish command to device-specific queue with RPC headers
-	err = ch.PublishWithContext(tx.ctx, "", tx.conn.deviceID, false, false, amqp.Publishing{
+	// Create timeout context for transaction command; the command expires
+	// in the queue when nobody waits for it any more
+	cmdCtx, cancel := context.WithTimeout(tx.ctx, 30*time.Second)
+	defer cancel()
+
+	// Send the command and wait for the response
+	start := time.Now()
+	var respBody []byte
+	if tx.conn.transport != nil {
+		respBody, err = tx.conn.requestTransport(cmdCtx, corrID, body)
+	} else {
+		respBody, err = tx.requestAMQP(cmdCtx, command, corrID, body)
+	}
+	if err != nil {
+		observeRequest(cmdCtx, tx.conn.deviceID, "transaction", start, 0, err)
+		return err
+	}
+	observeRequest(cmdCtx, tx.conn.deviceID, "transaction", start, time.Since(start), nil)
+
+	// Parse server response
+	var resp RPCResponse
+	if err := json.Unmarshal(respBody, &resp); err != nil {
+		return fmt.Errorf("failed to parse server response: %v", err)
+	}
+
+	// Check for server-side errors, preserving transaction error codes
+	if resp.Error != "" {
+		if isTxCode(resp.ErrorCode) {
+			return &TxError{Code: resp.ErrorCode, TransactionID: tx.transactionID, Message: resp.Error}
+		}
+		return fmt.Errorf("server error: %s", resp.Error)
+	}
+
+	if command == "BEGIN" {
+		tx.instance = resp.Instance
+	}
+	tx.conn.logf("Transaction command '%s' completed successfully for transaction %s", command, tx.transactionID)
+	return nil
+}
+
+// requestAMQP publishes a transaction command on a pooled RabbitMQ channel
+// and waits for the response body
+func (tx *Tx) requestAMQP(cmdCtx context.Context, command, corrID string, body []byte) ([]byte, error) {
+	// Get the RabbitMQ channel to publish on, shared or from the pool
+	ch, err := tx.conn.connMgr.openRequest(corrID)
+	if err != nil {
+		return nil, err
+	}
+	defer ch.close()
+
+	// Publish command to the device RPC queue with RPC headers. Once BEGIN
+	// named the server instance holding the transaction, commands go to that
+	// instance's queue; instance is only written by BEGIN, before the
+	// transaction is shared, so it is read here without the mutex.
+	rpcQueueName := tx.conn.topology.RPCQueue
+	var returns <-chan amqp.Return
+	if tx.instance != "" {
+		rpcQueueName = tx.conn.topology.InstanceQueue(tx.instance)
+		returns = ch.returns
+	}
+	err = ch.PublishWithContext(tx.ctx, "", rpcQueueName, returns != nil, false, amqp.Publishing{
 		ContentType:   "application/json",
+		DeliveryMode:  tx.conn.deliveryMode(),
+		Expiration:    tx.conn.expiration(cmdCtx),
 		CorrelationId: corrID,
-		ReplyTo:       replyQueue.Name,
+		ReplyTo:       ch.replyTo,
+		UserId:        tx.conn.principal(),
 		Body:          body,
 	})
 	if err != nil {
-		return fmt.Errorf("failed to publish transaction command: %v", err)
-	}
-
-	// Start consuming from reply queue
-	msgs, err := ch.Consume(replyQueue.Name, "", true, true, false, false, nil)
-	if err != nil {
-		return fmt.Errorf("failed to consume from reply queue: %v", err)
+		return nil, fmt.Errorf("failed to publish transaction command: %v", err)
 	}
 
-	// Create timeout context for transaction command
-	cmdCtx, cancel := context.WithTimeout(tx.ctx, 30*time.Second)
-	defer cancel()
-
 	// Wait for response or timeout
-	select {
-	case <-cmdCtx.Done():
-		return fmt.Errorf("timeout waiting for transaction command response")
-	case msg := <-msgs:
-		// Validate correlation ID
-		if msg.CorrelationId != corrID {
-			return fmt.Errorf("correlation id mismatch: expected %s, got %s", corrID, msg.CorrelationId)
-		}
-
-		// Parse server response
-		var resp RPCResponse
-		if err := json.Unmarshal(msg.Body, &resp); err != nil {
-			return fmt.Errorf("failed to parse server response: %v", err)
+	for {
+		select {
+		case <-cmdCtx.Done():
+			return nil, fmt.Errorf("timeout waiting for transaction command response")
+		case <-returns:
+			// The instance queue is gone, and with it the instance holding the transaction
+			return nil, tx.instanceGoneError()
+		case <-ch.lost:
+			closeErr := ch.closeErr()
+			if closeErr == nil {
+				return nil, fmt.Errorf("RabbitMQ channel closed while waiting for transaction command response")
+			}
+			return nil, fmt.Errorf("RabbitMQ closed the channel during transaction command '%s': %w",
+				command, ExplainAMQPError(closeErr, tx.conn.config.AMQPURL))
+		case <-ch.done:
+			return nil, fmt.Errorf("reply queue closed while waiting for transaction command response")
+		case msg := <-ch.msgs:
+			// Direct reply-to channels may still receive responses to
+			// earlier requests that timed out
+			if !ch.accept(msg) || msg.Type == progressMessageType {
+				continue
+			}
+			tx.conn.recordActivity()
+			return msg.Body, nil
 		}
+	}
+}
 
-		// Check for server-side errors
-		if resp.Error != "" {
-			return fmt.Errorf("server error: %s", resp.Error)
-		}
+// serverInstance returns the server instance holding the transaction, or ""
+// when the server does not run in cluster mode
+func (tx *Tx) serverInstance() string {
+	tx.mutex.RLock()
+	defer tx.mutex.RUnlock()
+	return tx.instance
+}
 
-		tx.conn.logf("Transaction command '%s' completed successfully for transaction %s", command, tx.transactionID)
-		return nil
+// instanceGoneError reports that the server instance holding the transaction
+// stopped, so the transaction was lost
+func (tx *Tx) instanceGoneError() error {
+	return &TxError{
+		Code:          TxErrNotFound,
+		TransactionID: tx.transactionID,
+		Message:       fmt.Sprintf("server instance %s that held the transaction is gone", tx.instance),
 	}
 }
 
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Transaction error codes reported by the server in RPCResponse.ErrorCode and
+// by the client itself for illegal local transitions. They mirror the codes
+// defined by the server package.
+const (
+	TxErrNotFound          = "TX_NOT_FOUND"
+	TxErrAlreadyExists     = "TX_ALREADY_EXISTS"
+	TxErrAlreadyCommitted  = "TX_ALREADY_COMMITTED"
+	TxErrAlreadyRolledBack = "TX_ALREADY_ROLLED_BACK"
+	TxErrExpired           = "TX_EXPIRED"
+	TxErrFailed            = "TX_FAILED"
+	TxErrBeginFailed       = "TX_BEGIN_FAILED"
+	TxErrCommitFailed      = "TX_COMMIT_FAILED"
+	TxErrRollbackFailed    = "TX_ROLLBACK_FAILED"
+	TxErrMissingID         = "TX_MISSING_ID"
+	TxErrInvalidCommand    = "TX_INVALID_COMMAND"
+	TxErrInvalidTransition = "TX_INVALID_TRANSITION"
+	TxErrInProgress        = "TX_IN_PROGRESS"
+)
+
+// TxError is returned for every rejected transaction operation, whether it was
+// rejected locally by the client state machine or remotely by the server.
+//
+// Use errors.As to inspect the code:
+//
+//	var txErr *client.TxError
+//	if errors.As(err, &txErr) && txErr.Code == client.TxErrExpired { ... }
+type TxError struct {
+	Code          string // One of the TxErr* codes
+	TransactionID string // Transaction the operation was addressed to
+	Message       string // Human readable description
+}
+
+// Error implements the error interface.
+func (e *TxError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// IsTxError reports whether err is a TxError with the given code.
+func IsTxError(err error, code string) bool {
+	var txErr *TxError
+	return errors.As(err, &txErr) && txErr.Code == code
+}
+
+// txTransitions lists every legal client-side state transition.
+var txTransitions = map[TxState]map[TxState]bool{
+	TxActive: {
+		TxCommitted:  true,
+		TxRolledBack: true,
+		TxFailed:     true,
+	},
+}
+
+// CanTransition reports whether a transaction may move from ts to next.
+func (ts TxState) CanTransition(next TxState) bool {
+	return txTransitions[ts][next]
+}
+
+// IsTerminal reports whether no further transitions are possible from ts.
+func (ts TxState) IsTerminal() bool {
+	return len(txTransitions[ts]) == 0
+}
+
+// terminalStateError returns the error for an operation attempted on a
+// transaction that already reached a terminal state.
+func terminalStateError(transactionID string, state TxState) *TxError {
+	code := TxErrInvalidTransition
+	switch state {
+	case TxCommitted:
+		code = TxErrAlreadyCommitted
+	case TxRolledBack:
+		code = TxErrAlreadyRolledBack
+	case TxFailed:
+		code = TxErrFailed
+	}
+	return &TxError{
+		Code:          code,
+		TransactionID: transactionID,
+		Message:       fmt.Sprintf("transaction %s is not active (state: %s)", transactionID, state),
+	}
+}
+
+// isTerminalTxCode reports whether a server error code means the server-side
+// transaction no longer exists, so the client must stop using it.
+func isTerminalTxCode(code string) bool {
+	switch code {
+	case TxErrNotFound, TxErrAlreadyCommitted, TxErrAlreadyRolledBack,
+		TxErrExpired, TxErrFailed, TxErrCommitFailed, TxErrRollbackFailed:
+		return true
+	}
+	return false
+}
+
+// isTxCode reports whether code belongs to the transaction protocol.
+func isTxCode(code string) bool {
+	return len(code) > 3 && code[:3] == "TX_"
+}
@@ -0,0 +1,155 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+var allTxStates = []TxState{TxActive, TxCommitted, TxRolledBack, TxFailed}
+
+func TestTxStateTransitions(t *testing.T) {
+	valid := map[TxState]map[TxState]bool{
+		TxActive: {
+			TxCommitted:  true,
+			TxRolledBack: true,
+			TxFailed:     true,
+		},
+	}
+
+	for _, from := range allTxStates {
+		for _, to := range allTxStates {
+			want := valid[from][to]
+			if got := from.CanTransition(to); got != want {
+				t.Errorf("%s -> %s: CanTransition = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestTxStateIsTerminal(t *testing.T) {
+	tests := []struct {
+		state    TxState
+		name     string
+		terminal bool
+	}{
+		{TxActive, "active", false},
+		{TxCommitted, "committed", true},
+		{TxRolledBack, "rolled_back", true},
+		{TxFailed, "failed", true},
+		{TxState(99), "unknown", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.state.String(); got != tt.name {
+			t.Errorf("String() = %q, want %q", got, tt.name)
+		}
+		if got := tt.state.IsTerminal(); got != tt.terminal {
+			t.Errorf("%s: IsTerminal = %v, want %v", tt.name, got, tt.terminal)
+		}
+	}
+}
+
+func TestFinishRejectedLocally(t *testing.T) {
+	tests := []struct {
+		state   TxState
+		command string
+		next    TxState
+		code    string
+	}{
+		{TxCommitted, "COMMIT", TxCommitted, TxErrAlreadyCommitted},
+		{TxCommitted, "ROLLBACK", TxRolledBack, TxErrAlreadyCommitted},
+		{TxRolledBack, "COMMIT", TxCommitted, TxErrAlreadyRolledBack},
+		{TxRolledBack, "ROLLBACK", TxRolledBack, TxErrAlreadyRolledBack},
+		{TxFailed, "COMMIT", TxCommitted, TxErrFailed},
+		{TxFailed, "ROLLBACK", TxRolledBack, TxErrFailed},
+	}
+
+	for _, tt := range tests {
+		// A terminal transaction is rejected before anything is sent, so no
+		// connection is needed
+		tx := &Tx{transactionID: "tx1", state: tt.state}
+		err := tx.applyFinish(tt.command, tt.next)
+
+		if !IsTxError(err, tt.code) {
+			t.Errorf("%s in state %s: got %v, want code %s", tt.command, tt.state, err, tt.code)
+		}
+		if tx.state != tt.state {
+			t.Errorf("%s in state %s: rejected command changed state to %s", tt.command, tt.state, tx.state)
+		}
+	}
+}
+
+func TestTerminalStateError(t *testing.T) {
+	tests := []struct {
+		state TxState
+		code  string
+	}{
+		{TxCommitted, TxErrAlreadyCommitted},
+		{TxRolledBack, TxErrAlreadyRolledBack},
+		{TxFailed, TxErrFailed},
+		{TxActive, TxErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		err := terminalStateError("tx1", tt.state)
+		if err.Code != tt.code {
+			t.Errorf("%s: code = %s, want %s", tt.state, err.Code, tt.code)
+		}
+		if err.TransactionID != "tx1" {
+			t.Errorf("%s: transaction ID = %q", tt.state, err.TransactionID)
+		}
+	}
+}
+
+func TestTxErrorCodes(t *testing.T) {
+	tests := []struct {
+		code     string
+		terminal bool // The server-side transaction is gone
+	}{
+		{TxErrNotFound, true},
+		{TxErrAlreadyExists, false},
+		{TxErrAlreadyCommitted, true},
+		{TxErrAlreadyRolledBack, true},
+		{TxErrExpired, true},
+		{TxErrFailed, true},
+		{TxErrBeginFailed, false},
+		{TxErrCommitFailed, true},
+		{TxErrRollbackFailed, true},
+		{TxErrMissingID, false},
+		{TxErrInvalidCommand, false},
+		{TxErrInvalidTransition, false},
+		{TxErrInProgress, false},
+	}
+
+	for _, tt := range tests {
+		if !isTxCode(tt.code) {
+			t.Errorf("%s: isTxCode = false", tt.code)
+		}
+		if got := isTerminalTxCode(tt.code); got != tt.terminal {
+			t.Errorf("%s: isTerminalTxCode = %v, want %v", tt.code, got, tt.terminal)
+		}
+
+		err := fmt.Errorf("commit: %w", &TxError{Code: tt.code, TransactionID: "tx1", Message: "rejected"})
+		if !IsTxError(err, tt.code) {
+			t.Errorf("%s: IsTxError does not see through wrapping", tt.code)
+		}
+		if IsTxError(err, "TX_OTHER") {
+			t.Errorf("%s: IsTxError matched another code", tt.code)
+		}
+
+		var txErr *TxError
+		if errors.As(err, &txErr); txErr.Error() != tt.code+": rejected" {
+			t.Errorf("%s: Error() = %q", tt.code, txErr.Error())
+		}
+	}
+
+	for _, code := range []string{"", "TX_", "TIMEOUT", "RATE_LIMITED"} {
+		if isTxCode(code) {
+			t.Errorf("%q: isTxCode = true", code)
+		}
+		if isTerminalTxCode(code) {
+			t.Errorf("%q: isTerminalTxCode = true", code)
+		}
+	}
+}
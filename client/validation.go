@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// ErrCodeValidationFailed is the error code of queries blocked by the
+// server's SQL validation.
+const ErrCodeValidationFailed = "VALIDATION_FAILED"
+
+// ValidationError is returned when the server's SQL validation blocks a
+// query. It carries the full validation result so tools can show which rule
+// fired.
+//
+// Use errors.As to inspect it:
+//
+//	var validationErr *client.ValidationError
+//	if errors.As(err, &validationErr) {
+//	    fmt.Println(validationErr.DetectedCommand, validationErr.Risk, validationErr.Errors)
+//	}
+type ValidationError struct {
+	Message         string   // Server error message ("SQL validation failed: ...")
+	Errors          []string // Rules the query violated
+	Warnings        []string // Non-blocking findings
+	DetectedCommand string   // Primary SQL command detected (e.g. "DROP")
+	Risk            string   // Assessed risk level: low, medium, high or critical
+}
+
+// Error implements the error interface.
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("server error: %s", e.Message)
+}
+
+// rpcValidation is the wire form of the validation result of a blocked query
+type rpcValidation struct {
+	Errors          []string `json:"errors"`
+	Warnings        []string `json:"warnings"`
+	DetectedCommand string   `json:"detectedCommand"`
+	Risk            string   `json:"risk"`
+}
+
+// validationError builds the error for a response blocked by SQL validation
+func validationError(resp RPCResponse) *ValidationError {
+	return &ValidationError{
+		Message:         resp.Error,
+		Errors:          resp.Validation.Errors,
+		Warnings:        resp.Validation.Warnings,
+		DetectedCommand: resp.Validation.DetectedCommand,
+		Risk:            resp.Validation.Risk,
+	}
+}
+
+// ValidationReport is the result of validating one statement with Validate
+// or ValidateScript
+type ValidationReport struct {
+	Statement       string   `json:"statement"`
+	Valid           bool     `json:"valid"`                    // Whether the statement would be allowed to run
+	Errors          []string `json:"errors"`                   // Rules the statement violates
+	Warnings        []string `json:"warnings"`                 // Non-blocking findings
+	DetectedCommand string   `json:"detectedCommand"`          // Primary SQL command detected (e.g. "SELECT")
+	Risk            string   `json:"risk"`                     // Assessed risk level: low, medium, high or critical
+	RewrittenQuery  string   `json:"rewrittenQuery,omitempty"` // What would run instead, with the default LIMIT added
+}
+
+// Validate runs query through the device's SQL validation without executing
+// it and reports whether it would be allowed, so CI pipelines can lint their
+// queries against the live policy. A query the policy rejects is not an
+// error: check the report's Valid field.
+//
+// Example:
+//
+//	report, err := bc.Validate(ctx, "DELETE FROM orders WHERE id = ?", 42)
+//	if err == nil && !report.Valid {
+//		log.Printf("%s (risk %s): %v", report.DetectedCommand, report.Risk, report.Errors)
+//	}
+func (bc *BurrowClient) Validate(ctx context.Context, query string, params ...interface{}) (*ValidationReport, error) {
+	reports, err := bc.validate(ctx, query, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(reports) != 1 {
+		return nil, fmt.Errorf("query holds %d statements; use ValidateScript", len(reports))
+	}
+	return &reports[0], nil
+}
+
+// ValidateScript validates every statement of a SQL script, split as the
+// server splits scripts, without executing any of them
+func (bc *BurrowClient) ValidateScript(ctx context.Context, script string) ([]ValidationReport, error) {
+	return bc.validate(ctx, script, nil)
+}
+
+// validate sends a "VALIDATE:" request and reads its result rows
+func (bc *BurrowClient) validate(ctx context.Context, query string, params []interface{}) ([]ValidationReport, error) {
+	rows, err := bc.db.QueryContext(ctx, "VALIDATE:"+query, params...)
+	if err != nil {
+		return nil, err
+	}
+	results, err := allRows(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	reports := make([]ValidationReport, 0, len(results))
+	for _, row := range results {
+		report := ValidationReport{
+			Statement:       resultString(row, "statement"),
+			DetectedCommand: resultString(row, "detected_command"),
+			Risk:            resultString(row, "risk"),
+			RewrittenQuery:  resultString(row, "rewritten_query"),
+		}
+		report.Valid, _ = row["valid"].(bool)
+		if err := json.Unmarshal([]byte(resultString(row, "errors")), &report.Errors); err != nil {
+			return nil, fmt.Errorf("failed to parse validation errors: %w", err)
+		}
+		if err := json.Unmarshal([]byte(resultString(row, "warnings")), &report.Warnings); err != nil {
+			return nil, fmt.Errorf("failed to parse validation warnings: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, nil
+}
@@ -0,0 +1,32 @@
+// Package clock abstracts the current time, so that expiry, timeout and
+// refill logic can run against a controlled clock in tests instead of the
+// system clock.
+package clock
+
+import "time"
+
+// Clock tells the current time
+type Clock interface {
+	Now() time.Time                  // Current time
+	Since(t time.Time) time.Duration // Time elapsed since t
+}
+
+// Real is the system clock
+var Real Clock = realClock{}
+
+// realClock reads the system clock
+type realClock struct{}
+
+// Now returns time.Now()
+func (realClock) Now() time.Time { return time.Now() }
+
+// Since returns time.Since(t)
+func (realClock) Since(t time.Time) time.Duration { return time.Since(t) }
+
+// OrReal returns c, or Real when c is nil
+func OrReal(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
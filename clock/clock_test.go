@@ -0,0 +1,31 @@
+package clock_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lordbasex/burrowctl/clock"
+	"github.com/lordbasex/burrowctl/clock/clocktest"
+)
+
+func TestOrReal(t *testing.T) {
+	if clock.OrReal(nil) != clock.Real {
+		t.Fatal("OrReal(nil) is not the real clock")
+	}
+
+	fake := clocktest.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	if clock.OrReal(fake) != clock.Clock(fake) {
+		t.Fatal("OrReal replaced a non-nil clock")
+	}
+}
+
+func TestReal(t *testing.T) {
+	before := time.Now()
+	now := clock.Real.Now()
+	if now.Before(before) || now.After(time.Now()) {
+		t.Fatalf("Real.Now() = %v, outside the system time around the call", now)
+	}
+	if elapsed := clock.Real.Since(before.Add(-time.Hour)); elapsed < time.Hour {
+		t.Fatalf("Real.Since an hour ago = %v", elapsed)
+	}
+}
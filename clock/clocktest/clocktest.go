@@ -0,0 +1,53 @@
+// Package clocktest provides a fake clock for tests of timing logic.
+//
+// Example:
+//
+//	fake := clocktest.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+//	cache := server.NewQueryCache(server.QueryCacheConfig{Enabled: true, TTL: time.Minute})
+//	cache.SetClock(fake)
+//	cache.Set(query, nil, response)
+//	fake.Advance(2 * time.Minute)
+//	_, found := cache.Get(query, nil) // expired
+package clocktest
+
+import (
+	"sync"
+	"time"
+)
+
+// Fake is a clock that only moves when told to. It is safe for concurrent use.
+type Fake struct {
+	mutex sync.Mutex
+	now   time.Time
+}
+
+// NewFake returns a fake clock set to start
+func NewFake(start time.Time) *Fake {
+	return &Fake{now: start}
+}
+
+// Now returns the time of the fake clock
+func (f *Fake) Now() time.Time {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.now
+}
+
+// Since returns the time elapsed on the fake clock since t
+func (f *Fake) Since(t time.Time) time.Duration {
+	return f.Now().Sub(t)
+}
+
+// Advance moves the fake clock forward by d
+func (f *Fake) Advance(d time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = f.now.Add(d)
+}
+
+// Set moves the fake clock to t
+func (f *Fake) Set(t time.Time) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.now = t
+}
@@ -0,0 +1,54 @@
+package clocktest_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lordbasex/burrowctl/clock/clocktest"
+)
+
+var start = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func TestFake(t *testing.T) {
+	fake := clocktest.NewFake(start)
+	if !fake.Now().Equal(start) {
+		t.Fatalf("Now() = %v, want %v", fake.Now(), start)
+	}
+
+	fake.Advance(90 * time.Second)
+	if !fake.Now().Equal(start.Add(90 * time.Second)) {
+		t.Fatalf("Now() after Advance = %v", fake.Now())
+	}
+	if since := fake.Since(start); since != 90*time.Second {
+		t.Fatalf("Since(start) = %v, want 1m30s", since)
+	}
+
+	// Set may move the clock backwards
+	earlier := start.Add(-time.Hour)
+	fake.Set(earlier)
+	if !fake.Now().Equal(earlier) || fake.Since(start) != -time.Hour {
+		t.Fatalf("Now() after Set = %v", fake.Now())
+	}
+}
+
+func TestFakeConcurrentAdvance(t *testing.T) {
+	fake := clocktest.NewFake(start)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				fake.Advance(time.Second)
+				fake.Since(start)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if since := fake.Since(start); since != 1000*time.Second {
+		t.Fatalf("clock advanced by %v, want 1000 advances of 1s", since)
+	}
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/token"
+	"strings"
+
+	"github.com/lordbasex/burrowctl/client"
+)
+
+// Spec is what the generated code gives access to
+type Spec struct {
+	Package   string
+	Tables    []Table
+	Functions []client.FunctionInfo
+}
+
+// Table is a table of the device database
+type Table struct {
+	Name    string
+	Columns []Column
+}
+
+// Column is a column of a table
+type Column struct {
+	Name       string
+	DataType   string // information_schema data_type, lower case
+	Nullable   bool
+	PrimaryKey bool
+}
+
+// initialisms are written in upper case in Go names
+var initialisms = map[string]bool{
+	"api": true, "cpu": true, "dns": true, "http": true, "id": true, "ip": true, "json": true,
+	"mac": true, "sql": true, "tcp": true, "ttl": true, "udp": true, "uri": true, "url": true,
+	"utc": true, "uuid": true, "xml": true,
+}
+
+// goName converts a SQL or function name to an exported Go name
+func goName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9')
+	}) {
+		if initialisms[strings.ToLower(word)] {
+			b.WriteString(strings.ToUpper(word))
+		} else {
+			b.WriteString(strings.ToUpper(word[:1]) + word[1:])
+		}
+	}
+	if b.Len() == 0 || b.String()[0] >= '0' && b.String()[0] <= '9' {
+		return "X" + b.String()
+	}
+	return b.String()
+}
+
+// paramName converts a parameter name to an unexported Go name
+func paramName(name string, index int) string {
+	exported := goName(name)
+	if name == "" || exported == "X" {
+		return fmt.Sprintf("arg%d", index+1)
+	}
+	lower := strings.ToLower(exported[:1]) + exported[1:]
+	if initialisms[strings.ToLower(exported)] {
+		lower = strings.ToLower(exported)
+	}
+	if token.Lookup(lower).IsKeyword() || lower == "ctx" || lower == "f" {
+		lower += "Arg"
+	}
+	return lower
+}
+
+// columnType returns the Go type a column is scanned into
+func columnType(column Column) string {
+	switch column.DataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint", "bit", "year":
+		if column.Nullable {
+			return "sql.NullInt64"
+		}
+		return "int64"
+	case "decimal", "numeric", "float", "double", "real":
+		if column.Nullable {
+			return "sql.NullFloat64"
+		}
+		return "float64"
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		return "[]byte" // nil for NULL
+	}
+	// Text, dates and times arrive as text
+	if column.Nullable {
+		return "sql.NullString"
+	}
+	return "string"
+}
+
+// paramTypes maps function parameter types to client parameter helpers
+var paramTypes = map[string]string{
+	"string":  "client.StringParam",
+	"int":     "client.IntParam",
+	"int64":   "client.Int64Param",
+	"float64": "client.Float64Param",
+	"bool":    "client.BoolParam",
+}
+
+// resultTypes are return types decoded into their own Go type
+var resultTypes = map[string]bool{
+	"string": true, "bool": true, "int": true, "int8": true, "int16": true, "int32": true, "int64": true,
+	"uint": true, "uint8": true, "uint16": true, "uint32": true, "uint64": true, "float32": true, "float64": true,
+}
+
+// Generate writes the Go code of a spec
+func Generate(spec Spec) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "// Code generated by burrowctl-gen; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&b, "// Package %s accesses a burrowctl device: its tables and its server functions.\n", spec.Package)
+	fmt.Fprintf(&b, "package %s\n\n", spec.Package)
+
+	b.WriteString("import (\n\"context\"\n\"database/sql\"\n")
+	if len(spec.Functions) > 0 {
+		b.WriteString("\"encoding/json\"\n\"errors\"\n\"fmt\"\n\n\"github.com/lordbasex/burrowctl/client\"\n")
+	}
+	b.WriteString(")\n\n")
+
+	b.WriteString(`// Querier runs queries; *sql.DB, *sql.Tx and *sql.Conn satisfy it
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+`)
+	for _, table := range spec.Tables {
+		generateTable(&b, table)
+	}
+	if len(spec.Functions) > 0 {
+		generateFunctions(&b, spec.Functions)
+	}
+
+	code, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("generated invalid code: %w", err)
+	}
+	return code, nil
+}
+
+// generateTable writes the row struct and query helpers of a table
+func generateTable(b *bytes.Buffer, table Table) {
+	name := goName(table.Name)
+	quoted := make([]string, len(table.Columns))
+	fields := make([]string, len(table.Columns))
+	seen := make(map[string]bool)
+
+	fmt.Fprintf(b, "// %s is a row of the %s table\ntype %s struct {\n", name, table.Name, name)
+	for i, column := range table.Columns {
+		field := goName(column.Name)
+		for seen[field] {
+			field += "_"
+		}
+		seen[field] = true
+		fields[i] = field
+		quoted[i] = "`" + column.Name + "`"
+		fmt.Fprintf(b, "%s %s `db:%q`\n", field, columnType(column), column.Name)
+	}
+	b.WriteString("}\n\n")
+
+	fmt.Fprintf(b, "// %sColumns lists the columns of the %s table in %s field order\n", name, table.Name, name)
+	fmt.Fprintf(b, "const %sColumns = %q\n\n", name, strings.Join(quoted, ", "))
+
+	fmt.Fprintf(b, `// Query%[1]s returns the rows of %[2]s matching where, a SQL condition with
+// ? placeholders for args (empty for every row)
+func Query%[1]s(ctx context.Context, q Querier, where string, args ...interface{}) ([]%[1]s, error) {
+	query := "SELECT " + %[1]sColumns + " FROM `+"`%[2]s`"+`"
+	if where != "" {
+		query += " WHERE " + where
+	}
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []%[1]s
+	for rows.Next() {
+		var row %[1]s
+		if err := rows.Scan(`, name, table.Name)
+	for i, field := range fields {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString("&row." + field)
+	}
+	b.WriteString(`); err != nil {
+			return nil, err
+		}
+		result = append(result, row)
+	}
+	return result, rows.Err()
+}
+
+`)
+
+	// A single-column primary key gets a lookup helper
+	var keys []int
+	for i, column := range table.Columns {
+		if column.PrimaryKey {
+			keys = append(keys, i)
+		}
+	}
+	if len(keys) != 1 {
+		return
+	}
+	key := table.Columns[keys[0]]
+	keyType := columnType(Column{DataType: key.DataType})
+	fmt.Fprintf(b, `// Get%[1]sBy%[2]s returns the %[3]s row with the given %[4]s, or sql.ErrNoRows
+func Get%[1]sBy%[2]s(ctx context.Context, q Querier, %[5]s %[6]s) (*%[1]s, error) {
+	rows, err := Query%[1]s(ctx, q, "`+"`%[4]s`"+` = ?", %[5]s)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, sql.ErrNoRows
+	}
+	return &rows[0], nil
+}
+
+`, name, fields[keys[0]], table.Name, key.Name, paramName(key.Name, 0), keyType)
+}
+
+// generateFunctions writes a wrapper per server function
+func generateFunctions(b *bytes.Buffer, functions []client.FunctionInfo) {
+	b.WriteString(`// Functions calls the functions registered on the device server
+type Functions struct {
+	q Querier
+}
+
+// NewFunctions returns wrappers of the device server functions; q is usually
+// the *sql.DB of a burrowctl client (BurrowClient.DB)
+func NewFunctions(q Querier) *Functions {
+	return &Functions{q: q}
+}
+
+// call runs a function and returns its result columns and values
+func (f *Functions) call(ctx context.Context, name string, params ...client.FunctionParam) ([]string, []interface{}, error) {
+	if params == nil {
+		params = []client.FunctionParam{}
+	}
+	body, err := json.Marshal(client.FunctionRequest{Name: name, Params: params})
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err := f.q.QueryContext(ctx, "FUNCTION:"+string(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("function %s returned no result", name)
+	}
+	if err := rows.Scan(pointers...); err != nil {
+		return nil, nil, err
+	}
+	return columns, values, rows.Err()
+}
+
+// callError turns the error result of a function into an error
+func callError(value interface{}) error {
+	if message, ok := value.(string); ok && message != "success" {
+		return errors.New(message)
+	}
+	return nil
+}
+
+// decode converts a function result to the Go type the function returns
+func decode[T any](value interface{}) (T, error) {
+	var out T
+	if s, ok := any(&out).(*string); ok {
+		*s = fmt.Sprint(value)
+		return out, nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return out, err
+	}
+	err = json.Unmarshal(data, &out)
+	return out, err
+}
+
+// decodeAny decodes results that the server sent as JSON text
+func decodeAny(value interface{}) interface{} {
+	if s, ok := value.(string); ok {
+		var decoded interface{}
+		if json.Unmarshal([]byte(s), &decoded) == nil {
+			return decoded
+		}
+	}
+	return value
+}
+
+`)
+
+	seen := make(map[string]bool)
+	for _, function := range functions {
+		generateFunction(b, function, seen)
+	}
+}
+
+// generateFunction writes the wrapper of a server function
+func generateFunction(b *bytes.Buffer, function client.FunctionInfo, seen map[string]bool) {
+	name := goName(function.Name)
+	for seen[name] {
+		name += "_"
+	}
+	seen[name] = true
+
+	var (
+		params []string
+		args   []string
+		used   = make(map[string]bool)
+	)
+	for i, param := range function.Params {
+		pname := paramName(param.Name, i)
+		for used[pname] {
+			pname += "_"
+		}
+		used[pname] = true
+		if helper, ok := paramTypes[param.Type]; ok {
+			params = append(params, pname+" "+param.Type)
+			args = append(args, fmt.Sprintf("%s(%s)", helper, pname))
+		} else {
+			params = append(params, pname+" interface{}")
+			args = append(args, fmt.Sprintf("client.JSONParam(%s)", pname))
+		}
+	}
+	call := fmt.Sprintf("f.call(ctx, %q", function.Name)
+	for _, arg := range args {
+		call += ", " + arg
+	}
+	call += ")"
+
+	description := function.Description
+	if description == "" {
+		description = "calls the " + function.Name + " server function"
+	} else {
+		description = "calls " + function.Name + ": " + description
+	}
+	fmt.Fprintf(b, "// %s %s\n", name, description)
+	for i, param := range function.Params {
+		if param.Description != "" {
+			fmt.Fprintf(b, "//   - %s: %s\n", strings.Fields(params[i])[0], param.Description)
+		}
+	}
+	signature := fmt.Sprintf("func (f *Functions) %s(%s)", name, strings.Join(append([]string{"ctx context.Context"}, params...), ", "))
+
+	returns := function.Returns
+	returnsError := len(returns) > 0 && returns[len(returns)-1] == "error"
+	values := returns
+	if returnsError {
+		values = returns[:len(returns)-1]
+	}
+
+	switch {
+	case len(values) == 0:
+		fmt.Fprintf(b, "%s error {\n", signature)
+		if returnsError {
+			fmt.Fprintf(b, "columns, values, err := %s\nif err != nil {\nreturn err\n}\n", call)
+			b.WriteString("if columns[0] == \"error\" {\nreturn callError(values[0])\n}\nreturn nil\n}\n\n")
+		} else {
+			fmt.Fprintf(b, "_, _, err := %s\nreturn err\n}\n\n", call)
+		}
+
+	case len(values) == 1:
+		goType := "interface{}"
+		if resultTypes[values[0]] {
+			goType = values[0]
+		}
+		fmt.Fprintf(b, "%s (%s, error) {\nvar zero %s\n", signature, goType, goType)
+		fmt.Fprintf(b, "_, values, err := %s\nif err != nil {\nreturn zero, err\n}\n", call)
+		if returnsError {
+			b.WriteString("if len(values) > 1 {\nif err := callError(values[1]); err != nil {\nreturn zero, err\n}\n}\n")
+		}
+		if goType == "interface{}" {
+			b.WriteString("return decodeAny(values[0]), nil\n}\n\n")
+		} else {
+			fmt.Fprintf(b, "return decode[%s](values[0])\n}\n\n", goType)
+		}
+
+	default:
+		fmt.Fprintf(b, "%s ([]interface{}, error) {\n", signature)
+		fmt.Fprintf(b, "_, values, err := %s\nif err != nil {\nreturn nil, err\n}\n", call)
+		if returnsError {
+			b.WriteString("if err := callError(values[len(values)-1]); err != nil {\nreturn nil, err\n}\nvalues = values[:len(values)-1]\n")
+		}
+		b.WriteString("for i := range values {\nvalues[i] = decodeAny(values[i])\n}\nreturn values, nil\n}\n\n")
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+)
+
+// approvals lists, approves or rejects the requests a device holds for an
+// operator's approval
+func approvals(args []string) int {
+	flags := flag.NewFlagSet("approvals", flag.ExitOnError)
+	dsn := flags.String("dsn", os.Getenv("BURROWCTL_DSN"), "burrowctl DSN of the device (env BURROWCTL_DSN)")
+	reason := flags.String("reason", "", "reject: why the request is rejected (sent to the client)")
+	asJSON := flags.Bool("json", false, "list: print the requests as JSON")
+	timeout := flags.Duration("timeout", 30*time.Second, "Timeout of the request")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: burrowctl approvals [flags] list|approve <id>|reject <id>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	action := flags.Arg(0)
+	if action == "" {
+		action = "list"
+	}
+	id := flags.Arg(1)
+	if *dsn == "" {
+		fmt.Fprintln(os.Stderr, "burrowctl approvals: -dsn is required")
+		return 2
+	}
+	if action != "list" && id == "" {
+		fmt.Fprintf(os.Stderr, "burrowctl approvals: %s needs the ID of a pending request\n", action)
+		return 2
+	}
+
+	bc, err := client.NewBurrowClient(*dsn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "burrowctl approvals: %v\n", err)
+		return 2
+	}
+	defer bc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	switch action {
+	case "list":
+		pending, err := bc.PendingApprovals(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "burrowctl approvals: %v\n", err)
+			return 1
+		}
+		if *asJSON {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			encoder.Encode(pending)
+			return 0
+		}
+		if len(pending) == 0 {
+			fmt.Println("No requests waiting for approval")
+			return 0
+		}
+		for _, request := range pending {
+			requester := request.Principal
+			if request.OnBehalfOf != "" {
+				requester = request.OnBehalfOf + " (via " + request.Principal + ")"
+			}
+			fmt.Printf("%s  %s from %s at %s, expires %s\n", request.ID, request.DetectedCommand, requester,
+				request.ClientIP, request.ExpiresAt.Local().Format(time.Kitchen))
+			fmt.Printf("    %s\n", request.Query)
+			fmt.Printf("    risk %s: %s\n", request.Risk, strings.Join(request.Errors, "; "))
+		}
+	case "approve":
+		if err := bc.ApproveRequest(ctx, id); err != nil {
+			fmt.Fprintf(os.Stderr, "burrowctl approvals: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Approved %s\n", id)
+	case "reject":
+		if err := bc.RejectRequest(ctx, id, *reason); err != nil {
+			fmt.Fprintf(os.Stderr, "burrowctl approvals: %v\n", err)
+			return 1
+		}
+		fmt.Printf("Rejected %s\n", id)
+	default:
+		fmt.Fprintf(os.Stderr, "burrowctl approvals: unknown action %q (list, approve or reject)\n", action)
+		return 2
+	}
+	return 0
+}
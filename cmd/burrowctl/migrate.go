@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+)
+
+// migrationSymbols marks each migration status in the text report
+var migrationSymbols = map[string]string{
+	client.MigrationApplied:       "✓",
+	client.MigrationPending:       "·",
+	client.MigrationModified:      "!",
+	client.MigrationWouldApply:    "+",
+	client.MigrationRolledBack:    "↩",
+	client.MigrationWouldRollBack: "-",
+	client.MigrationFailed:        "✗",
+}
+
+// migrate applies, rolls back or lists the migrations of a directory; it
+// returns 1 when a migration failed
+func migrate(args []string) int {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dsn := flags.String("dsn", os.Getenv("BURROWCTL_DSN"), "burrowctl DSN of the device (env BURROWCTL_DSN)")
+	dir := flags.String("dir", "migrations", "Directory of <version>_<name>.up.sql and .down.sql files")
+	dryRun := flags.Bool("dry-run", false, "Show and validate what would run without changing the database")
+	target := flags.String("target", "", "up: last version to apply; down: roll back every version after it (0 = all)")
+	steps := flags.Int("steps", 1, "down without -target: migrations to roll back")
+	asJSON := flags.Bool("json", false, "Print the results as JSON")
+	timeout := flags.Duration("timeout", 30*time.Minute, "Timeout of the whole run")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: burrowctl migrate [flags] up|down|status")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	action := flags.Arg(0)
+	if action == "" {
+		action = "status"
+	}
+	if *dsn == "" {
+		fmt.Fprintln(os.Stderr, "burrowctl migrate: -dsn is required")
+		return 2
+	}
+
+	migrations, err := client.LoadMigrations(os.DirFS(*dir))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "burrowctl migrate: %v\n", err)
+		return 2
+	}
+
+	bc, err := client.NewBurrowClient(*dsn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "burrowctl migrate: %v\n", err)
+		return 2
+	}
+	defer bc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	opts := client.MigrateOptions{DryRun: *dryRun, Target: *target, Steps: *steps}
+	var results []client.MigrationResult
+	switch action {
+	case "up":
+		results, err = bc.Migrate(ctx, migrations, opts)
+	case "down":
+		results, err = bc.RollbackMigrations(ctx, migrations, opts)
+	case "status":
+		results, err = bc.MigrationStatus(ctx, migrations)
+	default:
+		fmt.Fprintf(os.Stderr, "burrowctl migrate: unknown action %q (up, down or status)\n", action)
+		return 2
+	}
+	if err != nil && results == nil {
+		fmt.Fprintf(os.Stderr, "burrowctl migrate: %v\n", err)
+		return 1
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(results)
+	} else if len(results) == 0 {
+		fmt.Println("Nothing to do")
+	} else {
+		for _, result := range results {
+			line := fmt.Sprintf("  %s %-16s %-30s %s", migrationSymbols[result.Status], result.Version, result.Name, result.Status)
+			if result.Duration > 0 {
+				line += fmt.Sprintf(" (%v)", result.Duration)
+			}
+			if result.Error != "" {
+				line += ": " + result.Error
+			}
+			fmt.Println(line)
+		}
+	}
+
+	if err != nil {
+		return 1
+	}
+	return 0
+}
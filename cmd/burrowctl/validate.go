@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+)
+
+// validatedFile is the validation result of one input in the JSON report
+type validatedFile struct {
+	File       string                    `json:"file"`
+	Statements []client.ValidationReport `json:"statements"`
+}
+
+// validate lints SQL files or a query against the device's SQL validation
+// policy without running them; it returns 1 when a statement is rejected
+func validate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	dsn := flags.String("dsn", os.Getenv("BURROWCTL_DSN"), "burrowctl DSN of the device (env BURROWCTL_DSN)")
+	query := flags.String("e", "", "Statements to validate instead of files")
+	asJSON := flags.Bool("json", false, "Print the results as JSON")
+	timeout := flags.Duration("timeout", 2*time.Minute, "Timeout of the whole run")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: burrowctl validate [flags] [file.sql ...] (- reads standard input)")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *dsn == "" {
+		fmt.Fprintln(os.Stderr, "burrowctl validate: -dsn is required")
+		return 2
+	}
+	if (*query == "") == (flags.NArg() == 0) {
+		fmt.Fprintln(os.Stderr, "burrowctl validate: give either -e or SQL files")
+		return 2
+	}
+
+	inputs := map[string]string{}
+	names := flags.Args()
+	if *query != "" {
+		names = []string{"-e"}
+		inputs["-e"] = *query
+	}
+	for _, name := range flags.Args() {
+		var content []byte
+		var err error
+		if name == "-" {
+			content, err = io.ReadAll(os.Stdin)
+		} else {
+			content, err = os.ReadFile(name)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "burrowctl validate: %v\n", err)
+			return 2
+		}
+		inputs[name] = string(content)
+	}
+
+	bc, err := client.NewBurrowClient(*dsn)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "burrowctl validate: %v\n", err)
+		return 2
+	}
+	defer bc.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	var files []validatedFile
+	rejected := 0
+	for _, name := range names {
+		reports, err := bc.ValidateScript(ctx, inputs[name])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "burrowctl validate: %s: %v\n", name, err)
+			return 2
+		}
+		for _, report := range reports {
+			if !report.Valid {
+				rejected++
+			}
+		}
+		files = append(files, validatedFile{File: name, Statements: reports})
+	}
+
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(files)
+	} else {
+		total := 0
+		for _, file := range files {
+			for i, report := range file.Statements {
+				total++
+				symbol := "✓"
+				if !report.Valid {
+					symbol = "✗"
+				}
+				fmt.Printf("  %s %s:%d %-8s risk=%-8s %s\n", symbol, file.File, i+1, report.DetectedCommand, report.Risk, summarize(report.Statement))
+				for _, message := range report.Errors {
+					fmt.Printf("      error: %s\n", message)
+				}
+				for _, message := range report.Warnings {
+					fmt.Printf("      warning: %s\n", message)
+				}
+			}
+		}
+		fmt.Printf("\n%d statements, %d rejected\n", total, rejected)
+	}
+
+	if rejected > 0 {
+		return 1
+	}
+	return 0
+}
+
+// summarize returns the first line of a statement, shortened for the report
+func summarize(statement string) string {
+	line, _, cut := strings.Cut(statement, "\n")
+	if len(line) > 60 {
+		line, cut = line[:57], true
+	}
+	if cut {
+		line += "..."
+	}
+	return line
+}
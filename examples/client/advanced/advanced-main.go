@@ -468,9 +468,9 @@ func runLongQueryDemo(dsn string, queryDuration, disconnectAfter time.Duration,
 	fmt.Println("   • Monitor heartbeat statistics")
 	fmt.Println()
 	fmt.Println("💡 Server-side monitoring commands:")
-	fmt.Println("   • Check heartbeat stats: SELECT * FROM getHeartbeatStats()")
-	fmt.Println("   • Check active clients: SELECT * FROM getActiveClients()")
-	fmt.Println("   • Check system status: SELECT * FROM getSystemStatus()")
+	fmt.Println("   • Check heartbeat stats: FUNCTION:{\"name\":\"getHeartbeatStats\"}")
+	fmt.Println("   • Check active clients: FUNCTION:{\"name\":\"getActiveClients\"}")
+	fmt.Println("   • Check system status: FUNCTION:{\"name\":\"getSystemStatus\"}")
 }
 
 func printResults(rows *sql.Rows) {
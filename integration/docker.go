@@ -0,0 +1,149 @@
+//go:build integration
+
+// Package integration provides a Docker-based harness that exercises the client and
+// server end to end against real RabbitMQ and MySQL/MariaDB instances.
+//
+// The harness drives the docker CLI directly so it has no dependencies beyond the
+// standard library and the drivers already used by burrowctl. Every combination of
+// broker and database image in a Matrix is started in throwaway containers, an
+// in-process server.Handler is attached to it, and each Scenario runs as a subtest
+// through the regular database/sql client.
+//
+// Run the whole matrix with:
+//
+//	make test-integration
+//
+// or a reduced one with:
+//
+//	go test -tags=integration ./integration/... -args -brokers=rabbitmq:3.13-management -databases=mariadb:11
+//
+// Soak the reconnection paths under broker and database faults (see Soak) with:
+//
+//	make test-soak
+package integration
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Container is a running Docker container started by the harness.
+type Container struct {
+	ID    string // Docker container ID
+	Image string // Image the container was started from
+	Host  string // Host address the published ports are reachable on
+}
+
+// docker runs a docker CLI command and returns its trimmed stdout.
+func docker(ctx context.Context, args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, "docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("docker %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// runContainer starts a detached container publishing the given container ports
+// on random host ports.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - image: Docker image reference
+//   - env: Environment variables in KEY=VALUE form
+//   - ports: Container ports to publish (e.g. "5672/tcp")
+//
+// Returns:
+//   - *Container: The started container
+//   - error: Any error reported by docker
+func runContainer(ctx context.Context, image string, env []string, ports ...string) (*Container, error) {
+	args := []string{"run", "-d", "--rm", "--label", "burrowctl-integration=1"}
+	for _, e := range env {
+		args = append(args, "-e", e)
+	}
+	for _, p := range ports {
+		args = append(args, "-p", "127.0.0.1::"+p)
+	}
+	args = append(args, image)
+
+	id, err := docker(ctx, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Container{ID: id, Image: image, Host: "127.0.0.1"}, nil
+}
+
+// Port returns the host port a container port has been published on.
+func (c *Container) Port(ctx context.Context, containerPort string) (string, error) {
+	out, err := docker(ctx, "port", c.ID, containerPort)
+	if err != nil {
+		return "", err
+	}
+
+	// Output looks like "127.0.0.1:49153" (one line per binding)
+	line := strings.Split(out, "\n")[0]
+	_, port, err := net.SplitHostPort(strings.TrimSpace(line))
+	if err != nil {
+		return "", fmt.Errorf("unexpected docker port output %q: %v", out, err)
+	}
+	return port, nil
+}
+
+// Stop stops (and, because of --rm, removes) the container.
+func (c *Container) Stop(ctx context.Context) error {
+	_, err := docker(ctx, "stop", "-t", "2", c.ID)
+	return err
+}
+
+// Restart restarts the container, keeping its published ports.
+func (c *Container) Restart(ctx context.Context) error {
+	_, err := docker(ctx, "restart", "-t", "2", c.ID)
+	return err
+}
+
+// Crash kills the container's processes without a graceful shutdown and
+// starts it again, keeping its published ports.
+func (c *Container) Crash(ctx context.Context) error {
+	_, err := docker(ctx, "restart", "-t", "0", c.ID)
+	return err
+}
+
+// Pause freezes all processes in the container, simulating a network partition.
+func (c *Container) Pause(ctx context.Context) error {
+	_, err := docker(ctx, "pause", c.ID)
+	return err
+}
+
+// Unpause resumes a paused container.
+func (c *Container) Unpause(ctx context.Context) error {
+	_, err := docker(ctx, "unpause", c.ID)
+	return err
+}
+
+// waitFor polls check until it succeeds or the timeout expires.
+func waitFor(ctx context.Context, timeout time.Duration, what string, check func() error) error {
+	deadline := time.Now().Add(timeout)
+	var lastErr error
+
+	for time.Now().Before(deadline) {
+		if lastErr = check(); lastErr == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(500 * time.Millisecond):
+		}
+	}
+
+	return fmt.Errorf("timeout after %v waiting for %s: %v", timeout, what, lastErr)
+}
@@ -0,0 +1,271 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lordbasex/burrowctl/client"
+	"github.com/lordbasex/burrowctl/server"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Default credentials used for every container started by the harness.
+const (
+	brokerUser   = "burrowuser"
+	brokerPass   = "burrowpass123"
+	databaseName = "burrowdb"
+	databaseUser = "burrowuser"
+	databasePass = "burrowpass123"
+)
+
+// Matrix lists the broker and database images to combine.
+type Matrix struct {
+	Brokers   []string // RabbitMQ images (e.g. "rabbitmq:3.13-management")
+	Databases []string // MySQL/MariaDB images (e.g. "mysql:8.0", "mariadb:11")
+}
+
+// DefaultMatrix returns the versions burrowctl is expected to work with.
+func DefaultMatrix() Matrix {
+	return Matrix{
+		Brokers:   []string{"rabbitmq:3.12-management", "rabbitmq:3.13-management"},
+		Databases: []string{"mysql:8.0", "mariadb:10.11", "mariadb:11"},
+	}
+}
+
+// Environment is a running broker + database pair with a server attached.
+type Environment struct {
+	Broker   *Container // RabbitMQ container
+	Database *Container // MySQL/MariaDB container
+	AMQPURL  string     // Broker URL reachable from the host
+	MySQLDSN string     // Database DSN reachable from the host
+	DeviceID string     // Device ID the in-process server listens on
+
+	ExportChunkSize int // Export chunk size of the server, small so exports span many chunks
+
+	handler *server.Handler
+	cancel  context.CancelFunc
+	done    chan error
+}
+
+// StartEnvironment starts the containers for one matrix cell, waits until both
+// services accept connections, seeds the database and starts an in-process server.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - brokerImage: RabbitMQ image to run
+//   - databaseImage: MySQL or MariaDB image to run
+//
+// Returns:
+//   - *Environment: Ready-to-use environment; call Close when done
+//   - error: Any error that occurred while starting the environment
+func StartEnvironment(ctx context.Context, brokerImage, databaseImage string) (*Environment, error) {
+	env := &Environment{
+		DeviceID:        fmt.Sprintf("integration-%d", time.Now().UnixNano()),
+		ExportChunkSize: 4 * 1024,
+	}
+
+	var err error
+	env.Broker, err = runContainer(ctx, brokerImage, []string{
+		"RABBITMQ_DEFAULT_USER=" + brokerUser,
+		"RABBITMQ_DEFAULT_PASS=" + brokerPass,
+	}, "5672/tcp")
+	if err != nil {
+		return nil, fmt.Errorf("failed to start broker %s: %w", brokerImage, err)
+	}
+
+	env.Database, err = runContainer(ctx, databaseImage, []string{
+		"MYSQL_ROOT_PASSWORD=root",
+		"MARIADB_ROOT_PASSWORD=root",
+		"MYSQL_DATABASE=" + databaseName,
+		"MYSQL_USER=" + databaseUser,
+		"MYSQL_PASSWORD=" + databasePass,
+	}, "3306/tcp")
+	if err != nil {
+		env.Close(ctx)
+		return nil, fmt.Errorf("failed to start database %s: %w", databaseImage, err)
+	}
+
+	if err := env.resolveEndpoints(ctx); err != nil {
+		env.Close(ctx)
+		return nil, err
+	}
+
+	if err := env.waitReady(ctx); err != nil {
+		env.Close(ctx)
+		return nil, err
+	}
+
+	if err := env.seed(ctx); err != nil {
+		env.Close(ctx)
+		return nil, err
+	}
+
+	env.startServer()
+	return env, nil
+}
+
+// resolveEndpoints discovers the host ports Docker assigned to the containers.
+func (e *Environment) resolveEndpoints(ctx context.Context) error {
+	amqpPort, err := e.Broker.Port(ctx, "5672/tcp")
+	if err != nil {
+		return err
+	}
+	mysqlPort, err := e.Database.Port(ctx, "3306/tcp")
+	if err != nil {
+		return err
+	}
+
+	e.AMQPURL = fmt.Sprintf("amqp://%s:%s@%s:%s/", brokerUser, brokerPass, e.Broker.Host, amqpPort)
+	e.MySQLDSN = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s", databaseUser, databasePass, e.Database.Host, mysqlPort, databaseName)
+	return nil
+}
+
+// waitReady blocks until the broker and the database accept connections.
+func (e *Environment) waitReady(ctx context.Context) error {
+	if err := waitFor(ctx, 90*time.Second, "RabbitMQ", e.pingBroker); err != nil {
+		return err
+	}
+	return waitFor(ctx, 120*time.Second, "database", e.pingDatabase)
+}
+
+// pingBroker checks that an AMQP connection can be opened.
+func (e *Environment) pingBroker() error {
+	conn, err := amqp.Dial(e.AMQPURL)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+// pingDatabase checks that the database accepts queries.
+func (e *Environment) pingDatabase() error {
+	db, err := sql.Open("mysql", e.MySQLDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	return db.Ping()
+}
+
+// seed creates the fixture table used by the scenarios.
+func (e *Environment) seed(ctx context.Context) error {
+	db, err := sql.Open("mysql", e.MySQLDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	statements := []string{
+		"CREATE TABLE IF NOT EXISTS items (id INT PRIMARY KEY AUTO_INCREMENT, name VARCHAR(64) NOT NULL, qty INT NOT NULL DEFAULT 0, updated_at DATETIME NULL)",
+		"DELETE FROM items",
+		"INSERT INTO items (name, qty) VALUES ('alpha', 1), ('beta', 2), ('gamma', 3)",
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to seed database: %w", err)
+		}
+	}
+	return nil
+}
+
+// startServer attaches an in-process server to the environment.
+func (e *Environment) startServer() {
+	config := server.DefaultServerConfig()
+	config.DeviceID = e.DeviceID
+	config.AMQPURL = e.AMQPURL
+	config.MySQLDSN = e.MySQLDSN
+	config.MonitoringEnabled = false
+	config.CacheEnabled = false
+	config.ExportChunkSize = e.ExportChunkSize
+
+	handler, _, _ := server.NewServerFactory(config).CreateServer()
+	e.handler = handler
+
+	ctx, cancel := context.WithCancel(context.Background())
+	e.cancel = cancel
+	e.done = make(chan error, 1)
+
+	go func() {
+		e.done <- handler.Start(ctx)
+	}()
+
+	// Give the server time to declare its queues before clients publish
+	time.Sleep(2 * time.Second)
+}
+
+// RestartServer stops the in-process server and starts a fresh one, simulating
+// a device restart in the middle of client activity.
+func (e *Environment) RestartServer() {
+	e.stopServer()
+	e.startServer()
+}
+
+// ensureServer restarts the in-process server if it has exited, as a process
+// supervisor would after the server lost its broker connection.
+//
+// Returns:
+//   - bool: Whether the server was restarted
+func (e *Environment) ensureServer() bool {
+	select {
+	case err := <-e.done:
+		log.Printf("[integration] server exited (%v); restarting it", err)
+		e.cancel()
+		e.cancel = nil
+		e.startServer()
+		return true
+	default:
+		return false
+	}
+}
+
+// stopServer cancels the in-process server and waits for it to exit.
+func (e *Environment) stopServer() {
+	if e.cancel == nil {
+		return
+	}
+	e.cancel()
+	select {
+	case err := <-e.done:
+		if err != nil {
+			log.Printf("[integration] server exited with error: %v", err)
+		}
+	case <-time.After(15 * time.Second):
+		log.Printf("[integration] server did not stop within 15s")
+	}
+	e.cancel = nil
+}
+
+// ClientDSN returns a rabbitsql DSN for this environment with extra parameters appended.
+func (e *Environment) ClientDSN(extra string) string {
+	dsn := fmt.Sprintf("deviceID=%s&amqp_uri=%s&timeout=10s", e.DeviceID, e.AMQPURL)
+	if extra != "" {
+		dsn += "&" + extra
+	}
+	return dsn
+}
+
+// OpenClient opens a database/sql handle using the rabbitsql driver.
+func (e *Environment) OpenClient(extra string) (*sql.DB, error) {
+	return sql.Open("rabbitsql", e.ClientDSN(extra))
+}
+
+// Close stops the server and removes the containers.
+func (e *Environment) Close(ctx context.Context) {
+	e.stopServer()
+	if e.Broker != nil {
+		if err := e.Broker.Stop(ctx); err != nil {
+			log.Printf("[integration] failed to stop broker: %v", err)
+		}
+	}
+	if e.Database != nil {
+		if err := e.Database.Stop(ctx); err != nil {
+			log.Printf("[integration] failed to stop database: %v", err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"flag"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Matrix flags, passed after -args:
+//
+//	go test -tags=integration ./integration/... -args -brokers=rabbitmq:3.13-management -databases=mariadb:11
+var (
+	brokersFlag   = flag.String("brokers", strings.Join(DefaultMatrix().Brokers, ","), "Comma-separated RabbitMQ images")
+	databasesFlag = flag.String("databases", strings.Join(DefaultMatrix().Databases, ","), "Comma-separated MySQL/MariaDB images")
+)
+
+// scenarioTimeout bounds a single scenario in one matrix cell
+const scenarioTimeout = 3 * time.Minute
+
+// Scenario is a single end-to-end check run against an Environment.
+type Scenario struct {
+	Name string                                                    // Subtest name
+	Run  func(t *testing.T, ctx context.Context, env *Environment) // Fails t when the check does not hold
+}
+
+// MatrixFromFlags returns the images selected with -brokers and -databases.
+func MatrixFromFlags() Matrix {
+	return Matrix{
+		Brokers:   strings.Split(*brokersFlag, ","),
+		Databases: strings.Split(*databasesFlag, ","),
+	}
+}
+
+// RunMatrix runs every scenario against every broker/database combination
+// of MatrixFromFlags, as subtests named "<broker>+<database>/<scenario>", so
+// a cell or a scenario can be selected with -run. A cell whose environment
+// does not start fails without stopping the rest of the matrix; the whole
+// test is skipped when docker is not installed.
+func RunMatrix(t *testing.T, scenarios []Scenario) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not installed")
+	}
+
+	matrix := MatrixFromFlags()
+	for _, broker := range matrix.Brokers {
+		for _, database := range matrix.Databases {
+			t.Run(broker+"+"+database, func(t *testing.T) {
+				ctx := context.Background()
+				env, err := StartEnvironment(ctx, broker, database)
+				if err != nil {
+					t.Fatalf("setup failed: %v", err)
+				}
+				defer env.Close(ctx)
+
+				for _, scenario := range scenarios {
+					t.Run(scenario.Name, func(t *testing.T) {
+						sctx, cancel := context.WithTimeout(ctx, scenarioTimeout)
+						defer cancel()
+						scenario.Run(t, sctx, env)
+					})
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,182 @@
+//go:build integration
+
+// Package orm runs the sqlx and GORM scenarios of the integration harness.
+// It is a module of its own so that the ORMs are not dependencies of
+// burrowctl; run it from this directory with:
+//
+//	go test -tags=integration ./... -args -brokers=rabbitmq:3.13-management -databases=mariadb:11
+package orm
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lordbasex/burrowctl/integration"
+	gormmysql "gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// TestORM drives the bridge through sqlx and GORM, which rely on column type
+// metadata and parameter conversion, against every broker/database
+// combination.
+func TestORM(t *testing.T) {
+	integration.RunMatrix(t, []integration.Scenario{
+		{Name: "sqlx-struct-scan", Run: testSqlxStructScan},
+		{Name: "gorm-crud", Run: testGormCRUD},
+	})
+}
+
+// openClient opens a rabbitsql handle closed at the end of the test.
+func openClient(t *testing.T, env *integration.Environment, extra string) *sql.DB {
+	t.Helper()
+
+	db, err := env.OpenClient(extra)
+	if err != nil {
+		t.Fatalf("open client: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// item is a row of the fixture table.
+type item struct {
+	ID        int64      `db:"id" gorm:"primaryKey"`
+	Name      string     `db:"name"`
+	Qty       int        `db:"qty"`
+	UpdatedAt *time.Time `db:"updated_at"`
+}
+
+// TableName maps item to the fixture table for GORM.
+func (item) TableName() string {
+	return "items"
+}
+
+// testSqlxStructScan checks struct scans, named statements and the
+// column types sqlx sees.
+func testSqlxStructScan(t *testing.T, ctx context.Context, env *integration.Environment) {
+	db := sqlx.NewDb(openClient(t, env, "parse_time=true"), "rabbitsql")
+
+	var items []item
+	if err := db.SelectContext(ctx, &items, "SELECT id, name, qty, updated_at FROM items ORDER BY id"); err != nil {
+		t.Fatalf("select failed: %v", err)
+	}
+	if len(items) != 3 || items[1].Name != "beta" {
+		t.Fatalf("expected the 3 fixture items, got %+v", items)
+	}
+
+	rows, err := db.QueryxContext(ctx, "SELECT id, name, qty, updated_at FROM items LIMIT 1")
+	if err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	columns, err := rows.ColumnTypes()
+	rows.Close()
+	if err != nil {
+		t.Fatalf("column types failed: %v", err)
+	}
+	expected := []struct {
+		dbType   string
+		scanType reflect.Type
+	}{
+		{"INT", reflect.TypeOf(int64(0))},
+		{"VARCHAR", reflect.TypeOf("")},
+		{"INT", reflect.TypeOf(int64(0))},
+		{"DATETIME", reflect.TypeOf(sql.NullTime{})},
+	}
+	for i, column := range columns {
+		if column.DatabaseTypeName() != expected[i].dbType || column.ScanType() != expected[i].scanType {
+			t.Fatalf("column %s: expected %s/%v, got %s/%v", column.Name(),
+				expected[i].dbType, expected[i].scanType, column.DatabaseTypeName(), column.ScanType())
+		}
+	}
+
+	updatedAt := time.Date(2024, 3, 1, 12, 30, 15, 0, time.UTC)
+	result, err := db.NamedExecContext(ctx,
+		"INSERT INTO items (name, qty, updated_at) VALUES (:name, :qty, :updated_at)",
+		item{Name: "delta", Qty: 4, UpdatedAt: &updatedAt})
+	if err != nil {
+		t.Fatalf("named insert failed: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil || id == 0 {
+		t.Fatalf("expected an insert ID, got %d (%v)", id, err)
+	}
+	defer db.ExecContext(ctx, "DELETE FROM items WHERE id = ?", id)
+
+	var inserted item
+	if err := db.GetContext(ctx, &inserted, "SELECT id, name, qty, updated_at FROM items WHERE id = ?", id); err != nil {
+		t.Fatalf("get failed: %v", err)
+	}
+	if inserted.Name != "delta" || inserted.Qty != 4 || inserted.UpdatedAt == nil || !inserted.UpdatedAt.Equal(updatedAt) {
+		t.Fatalf("inserted item read back as %+v", inserted)
+	}
+}
+
+// testGormCRUD checks basic GORM operations, including its implicit
+// transactions and automatic timestamps.
+func testGormCRUD(t *testing.T, ctx context.Context, env *integration.Environment) {
+	sqlDB := openClient(t, env, "parse_time=true")
+
+	db, err := gorm.Open(gormmysql.New(gormmysql.Config{Conn: sqlDB, SkipInitializeWithVersion: true}),
+		&gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("gorm open failed: %v", err)
+	}
+	db = db.WithContext(ctx)
+
+	created := item{Name: "epsilon", Qty: 5}
+	if err := db.Create(&created).Error; err != nil {
+		t.Fatalf("create failed: %v", err)
+	}
+	if created.ID == 0 {
+		t.Fatal("create did not set the ID")
+	}
+	defer db.Delete(&item{}, created.ID)
+
+	var found item
+	if err := db.First(&found, created.ID).Error; err != nil {
+		t.Fatalf("first failed: %v", err)
+	}
+	if found.Name != "epsilon" || found.Qty != 5 {
+		t.Fatalf("created item read back as %+v", found)
+	}
+
+	if err := db.Model(&found).Update("qty", 6).Error; err != nil {
+		t.Fatalf("update failed: %v", err)
+	}
+	var updated []item
+	if err := db.Where("name = ? AND qty = ?", "epsilon", 6).Find(&updated).Error; err != nil {
+		t.Fatalf("find failed: %v", err)
+	}
+	if len(updated) != 1 || updated[0].UpdatedAt == nil {
+		t.Fatalf("expected the updated item with a timestamp, got %+v", updated)
+	}
+
+	if err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item{Name: "zeta"}).Error; err != nil {
+			return err
+		}
+		return errors.New("roll back")
+	}); err == nil || err.Error() != "roll back" {
+		t.Fatalf("expected the transaction to roll back, got %v", err)
+	}
+	var count int64
+	if err := db.Model(&item{}).Where("name = ?", "zeta").Count(&count).Error; err != nil {
+		t.Fatalf("count failed: %v", err)
+	}
+	if count != 0 {
+		t.Fatalf("rolled back item was stored (%d rows)", count)
+	}
+
+	if err := db.Delete(&found).Error; err != nil {
+		t.Fatalf("delete failed: %v", err)
+	}
+	if err := db.First(&item{}, created.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("expected the deleted item to be gone, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+//go:build integration
+
+package integration
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+)
+
+// TestMatrix runs the end-to-end scenarios against every broker/database
+// combination. Select a cell or a scenario with -run, e.g.
+//
+//	go test -tags=integration ./integration/... -run 'TestMatrix/.*mariadb:11/streaming'
+func TestMatrix(t *testing.T) {
+	RunMatrix(t, []Scenario{
+		{Name: "sql-roundtrip", Run: testSQLRoundTrip},
+		{Name: "query-timeout", Run: testQueryTimeout},
+		{Name: "transaction-commit", Run: testTransactionCommit},
+		{Name: "transaction-rollback", Run: testTransactionRollback},
+		{Name: "transaction-server-restart", Run: testTransactionServerRestart},
+		{Name: "streaming", Run: testStreaming},
+		{Name: "broker-reconnect", Run: testBrokerReconnect},
+	})
+}
+
+// openClient opens a rabbitsql handle closed at the end of the test.
+func openClient(t *testing.T, env *Environment, extra string) *sql.DB {
+	t.Helper()
+
+	db, err := env.OpenClient(extra)
+	if err != nil {
+		t.Fatalf("open client: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// testSQLRoundTrip checks a parameterized SELECT over the bridge.
+func testSQLRoundTrip(t *testing.T, ctx context.Context, env *Environment) {
+	db := openClient(t, env, "")
+
+	var name string
+	if err := db.QueryRowContext(ctx, "SELECT name FROM items WHERE id = ?", 2).Scan(&name); err != nil {
+		t.Fatalf("query failed: %v", err)
+	}
+	if name != "beta" {
+		t.Fatalf("expected 'beta', got %q", name)
+	}
+}
+
+// testQueryTimeout checks that a slow request surfaces a client timeout.
+func testQueryTimeout(t *testing.T, ctx context.Context, env *Environment) {
+	db := openClient(t, env, "")
+
+	qctx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	// SLEEP() in SQL is rejected by the injection patterns, so use a slow command instead
+	_, err := db.QueryContext(qctx, "COMMAND:sleep 3")
+	if err == nil {
+		t.Fatal("expected timeout error, got nil")
+	}
+	if !strings.Contains(err.Error(), "timeout") {
+		t.Fatalf("expected timeout error, got %v", err)
+	}
+}
+
+// testTransactionCommit checks that committed writes are visible afterwards.
+func testTransactionCommit(t *testing.T, ctx context.Context, env *Environment) {
+	db := openClient(t, env, "")
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE items SET qty = qty + 10 WHERE name = ?", "alpha"); err != nil {
+		tx.Rollback()
+		t.Fatalf("update failed: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("commit failed: %v", err)
+	}
+
+	var qty int
+	if err := db.QueryRowContext(ctx, "SELECT qty FROM items WHERE name = ?", "alpha").Scan(&qty); err != nil {
+		t.Fatal(err)
+	}
+	if qty != 11 {
+		t.Fatalf("expected qty 11 after commit, got %d", qty)
+	}
+}
+
+// testTransactionRollback checks that rolled back writes are discarded.
+func testTransactionRollback(t *testing.T, ctx context.Context, env *Environment) {
+	db := openClient(t, env, "")
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE items SET qty = 999 WHERE name = ?", "gamma"); err != nil {
+		tx.Rollback()
+		t.Fatalf("update failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("rollback failed: %v", err)
+	}
+
+	var qty int
+	if err := db.QueryRowContext(ctx, "SELECT qty FROM items WHERE name = ?", "gamma").Scan(&qty); err != nil {
+		t.Fatal(err)
+	}
+	if qty != 3 {
+		t.Fatalf("expected qty 3 after rollback, got %d", qty)
+	}
+}
+
+// testTransactionServerRestart checks that a server restart mid-transaction
+// is reported as TX_NOT_FOUND and that the connection remains usable.
+func testTransactionServerRestart(t *testing.T, ctx context.Context, env *Environment) {
+	db := openClient(t, env, "")
+	db.SetMaxOpenConns(1)
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin failed: %v", err)
+	}
+
+	env.RestartServer()
+
+	err = tx.Commit()
+	if !client.IsTxError(err, client.TxErrNotFound) {
+		t.Fatalf("expected %s after server restart, got %v", client.TxErrNotFound, err)
+	}
+
+	// The pooled connection must accept a new transaction afterwards
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("begin after restart failed: %v", err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatalf("rollback after restart failed: %v", err)
+	}
+}
+
+// streamingRows is the size of the streaming fixture: enough rows for the
+// export to span many chunks and the cursor many pages.
+const streamingRows = 2000
+
+// testStreaming checks the results read piece by piece: an export spanning
+// many chunks and a cursor read page by page must return every row once and
+// in order.
+func testStreaming(t *testing.T, ctx context.Context, env *Environment) {
+	seedStreaming(t, ctx, env)
+
+	bc, err := client.NewBurrowClient(env.ClientDSN(""))
+	if err != nil {
+		t.Fatalf("open client: %v", err)
+	}
+	defer bc.Close()
+
+	var out bytes.Buffer
+	n, err := bc.ExportToWriter(ctx, "SELECT id, token FROM streaming_rows ORDER BY id", &out, client.ExportCSV)
+	if err != nil {
+		t.Fatalf("export failed: %v", err)
+	}
+	if n != streamingRows {
+		t.Fatalf("export wrote %d rows, expected %d", n, streamingRows)
+	}
+	if out.Len() <= env.ExportChunkSize {
+		t.Fatalf("export output of %d bytes fit in one %d byte chunk", out.Len(), env.ExportChunkSize)
+	}
+	lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+	if len(lines) != streamingRows+1 || lines[0] != "id,token" {
+		t.Fatalf("export returned %d lines starting with %q", len(lines), lines[0])
+	}
+	for i, line := range lines[1:] {
+		if expected := fmt.Sprintf("%d,%s", i+1, streamingToken(i+1)); line != expected {
+			t.Fatalf("export line %d is %q, expected %q", i+1, line, expected)
+		}
+	}
+
+	const pageSize = 150
+	page, err := bc.OpenCursor(ctx, "SELECT id, token FROM streaming_rows ORDER BY id", pageSize)
+	if err != nil {
+		t.Fatalf("open cursor failed: %v", err)
+	}
+	next, pages := 1, 0
+	for {
+		pages++
+		for page.Next() {
+			var id int
+			var token string
+			if err := page.Scan(&id, &token); err != nil {
+				t.Fatalf("scan failed: %v", err)
+			}
+			if id != next || token != streamingToken(id) {
+				t.Fatalf("page %d returned row %d/%q, expected row %d", pages, id, token, next)
+			}
+			next++
+		}
+		if err := page.Err(); err != nil {
+			t.Fatalf("page %d failed: %v", pages, err)
+		}
+		page.Close()
+		if page.Done {
+			break
+		}
+		if page, err = bc.FetchMore(ctx, page.CursorID); err != nil {
+			t.Fatalf("fetch of page %d failed: %v", pages+1, err)
+		}
+	}
+	if next-1 != streamingRows {
+		t.Fatalf("cursor returned %d rows, expected %d", next-1, streamingRows)
+	}
+	if expected := (streamingRows + pageSize - 1) / pageSize; pages != expected {
+		t.Fatalf("cursor returned %d pages, expected %d", pages, expected)
+	}
+}
+
+// seedStreaming creates the streaming fixture directly in the database.
+func seedStreaming(t *testing.T, ctx context.Context, env *Environment) {
+	t.Helper()
+
+	db, err := sql.Open("mysql", env.MySQLDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	statements := []string{
+		"CREATE TABLE IF NOT EXISTS streaming_rows (id INT PRIMARY KEY, token VARCHAR(64) NOT NULL)",
+		"DELETE FROM streaming_rows",
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			t.Fatalf("seed failed: %v", err)
+		}
+	}
+
+	values := make([]string, 0, streamingRows)
+	args := make([]interface{}, 0, 2*streamingRows)
+	for id := 1; id <= streamingRows; id++ {
+		values = append(values, "(?, ?)")
+		args = append(args, id, streamingToken(id))
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO streaming_rows (id, token) VALUES "+strings.Join(values, ", "), args...); err != nil {
+		t.Fatalf("seed failed: %v", err)
+	}
+}
+
+// streamingToken is the token of streaming fixture row id
+func streamingToken(id int) string {
+	return fmt.Sprintf("token-%06d", id)
+}
+
+// testBrokerReconnect restarts RabbitMQ and checks the client recovers.
+func testBrokerReconnect(t *testing.T, ctx context.Context, env *Environment) {
+	db := openClient(t, env, "reconnect_initial_interval=500ms&reconnect_max_attempts=0")
+	db.SetMaxOpenConns(1)
+
+	if err := db.PingContext(ctx); err != nil {
+		t.Fatalf("initial ping failed: %v", err)
+	}
+
+	if err := env.Broker.Restart(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := waitFor(ctx, 60*time.Second, "RabbitMQ after restart", env.pingBroker); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server's own connection died with the broker; bring it back too
+	env.RestartServer()
+
+	err := waitFor(ctx, 60*time.Second, "client reconnection", func() error {
+		var n int
+		err := db.QueryRowContext(ctx, "SELECT COUNT(*) FROM items").Scan(&n)
+		if err == nil && n == 0 {
+			return errors.New("unexpected empty result")
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,464 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Faults the soak test injects, in the order they are cycled through.
+const (
+	FaultBrokerRestart     = "broker-restart"     // Graceful RabbitMQ restart
+	FaultBrokerCrash       = "broker-crash"       // RabbitMQ killed and started again
+	FaultBrokerPartition   = "broker-partition"   // RabbitMQ unreachable for PartitionDuration
+	FaultDatabaseRestart   = "database-restart"   // Graceful MySQL restart
+	FaultDatabaseCrash     = "database-crash"     // MySQL killed and started again
+	FaultDatabasePartition = "database-partition" // MySQL unreachable for PartitionDuration
+)
+
+// SoakConfig describes a soak test run.
+type SoakConfig struct {
+	Duration          time.Duration // Total run time; faults stop being injected after it
+	Clients           int           // Client goroutines running traffic, each with its own connection pool
+	FaultInterval     time.Duration // Quiet time between recovering from a fault and injecting the next
+	Faults            []string      // Faults to cycle through
+	PartitionDuration time.Duration // How long partition faults last
+	RecoveryTimeout   time.Duration // How long every client has to succeed again after a fault
+	ClientTimeout     time.Duration // Client request timeout (DSN timeout)
+}
+
+// DefaultSoakConfig returns a ten-minute run cycling through every fault.
+func DefaultSoakConfig() SoakConfig {
+	return SoakConfig{
+		Duration:      10 * time.Minute,
+		Clients:       8,
+		FaultInterval: 20 * time.Second,
+		Faults: []string{
+			FaultBrokerRestart, FaultDatabaseRestart, FaultBrokerPartition,
+			FaultDatabaseCrash, FaultBrokerCrash, FaultDatabasePartition,
+		},
+		PartitionDuration: 15 * time.Second,
+		RecoveryTimeout:   90 * time.Second,
+		ClientTimeout:     5 * time.Second,
+	}
+}
+
+// FaultRecord is one injected fault and how long the clients took to recover.
+type FaultRecord struct {
+	Fault     string        // Fault name
+	Injected  time.Time     // When the fault started
+	Recovered time.Duration // Time from the end of the fault until every client succeeded again (0 if it never did)
+	Err       error         // Why injecting or recovering failed
+}
+
+// SoakReport is the outcome of a soak test.
+type SoakReport struct {
+	Faults []FaultRecord
+
+	Reads            int64 // Read requests completed (successfully or not)
+	Writes           int64 // Write requests completed (successfully or not)
+	Failed           int64 // Requests that failed while a fault was in progress (expected)
+	UnexpectedErrors int64 // Requests that failed outside any fault
+	Mismatched       int64 // Responses that answered another request
+	Hung             int64 // Requests that outlived the client timeout by more than the grace period
+
+	WritesSucceeded int64 // Counter increments the client saw succeed
+	WritesAttempted int64 // Counter increments sent, including failed ones
+	WritesApplied   int64 // Counter increments found in the database at the end
+
+	Problems []string // First examples of each kind of violation
+}
+
+// Err returns an error describing the violations, or nil when the run kept
+// every guarantee: no mismatched, hung or lost responses, no errors outside
+// faults, no lost or duplicated writes, and recovery after every fault.
+func (r SoakReport) Err() error {
+	var problems []string
+	if r.Mismatched > 0 {
+		problems = append(problems, fmt.Sprintf("%d mismatched responses", r.Mismatched))
+	}
+	if r.Hung > 0 {
+		problems = append(problems, fmt.Sprintf("%d hung requests", r.Hung))
+	}
+	if r.UnexpectedErrors > 0 {
+		problems = append(problems, fmt.Sprintf("%d errors outside faults", r.UnexpectedErrors))
+	}
+	if r.WritesApplied < r.WritesSucceeded {
+		problems = append(problems, fmt.Sprintf("%d acknowledged writes lost", r.WritesSucceeded-r.WritesApplied))
+	}
+	if r.WritesApplied > r.WritesAttempted {
+		problems = append(problems, fmt.Sprintf("%d writes applied twice", r.WritesApplied-r.WritesAttempted))
+	}
+	for _, f := range r.Faults {
+		if f.Err != nil {
+			problems = append(problems, fmt.Sprintf("%s at %s: %v", f.Fault, f.Injected.Format("15:04:05"), f.Err))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	if len(r.Problems) > 0 {
+		problems = append(problems, "examples: "+strings.Join(r.Problems, "; "))
+	}
+	return errors.New(strings.Join(problems, ", "))
+}
+
+// hangGrace is how much longer than the client timeout a request may take
+// before it counts as hung
+const hangGrace = 5 * time.Second
+
+// maxProblemExamples bounds the violation examples kept in the report
+const maxProblemExamples = 10
+
+// soakRows is the number of rows of the read fixture
+const soakRows = 100
+
+// soak is the state shared by the clients and the fault injector of a run.
+type soak struct {
+	env    *Environment
+	config SoakConfig
+	report SoakReport
+
+	mutex       sync.Mutex
+	windows     []faultWindow // Faults injected so far; the last one may still be open
+	lastSuccess []time.Time   // Start time of each client's latest successful request
+}
+
+// faultWindow is the time from injecting a fault until every client
+// recovered from it. Requests overlapping it may fail.
+type faultWindow struct {
+	start, end time.Time // end is zero while the fault is in progress
+}
+
+// Soak runs client traffic against env while repeatedly injecting faults
+// into the broker and the database, then checks that no response was lost,
+// hung or delivered to the wrong request, that writes were neither lost nor
+// applied twice, and that every client recovered after every fault.
+//
+// The server has no reconnection loop of its own: when its broker
+// connection drops it exits, and the harness restarts it as a process
+// supervisor would.
+//
+// Parameters:
+//   - ctx: Context for cancellation
+//   - env: Running environment whose containers the faults are injected into
+//   - config: Run length, traffic and faults
+//
+// Returns:
+//   - SoakReport: Traffic counters, faults and violations; see SoakReport.Err
+//   - error: Any error setting up the run
+func Soak(ctx context.Context, env *Environment, config SoakConfig) (SoakReport, error) {
+	if config.Clients <= 0 {
+		config.Clients = 1
+	}
+	s := &soak{env: env, config: config, lastSuccess: make([]time.Time, config.Clients)}
+	if err := s.seed(ctx); err != nil {
+		return s.report, err
+	}
+
+	trafficCtx, stopTraffic := context.WithCancel(ctx)
+	var wg sync.WaitGroup
+	for c := 0; c < config.Clients; c++ {
+		db, err := env.OpenClient(fmt.Sprintf("timeout=%s&reconnect_initial_interval=500ms&reconnect_max_interval=5s&reconnect_max_attempts=0",
+			config.ClientTimeout))
+		if err != nil {
+			stopTraffic()
+			wg.Wait()
+			return s.report, err
+		}
+		wg.Add(1)
+		go func(client int, db *sql.DB) {
+			defer wg.Done()
+			defer db.Close()
+			s.runClient(trafficCtx, client, db)
+		}(c, db)
+	}
+
+	// Let the clients warm up, then inject faults until the time is up
+	deadline := time.Now().Add(config.Duration)
+	sleepCtx(ctx, config.FaultInterval)
+	for i := 0; ctx.Err() == nil && time.Now().Before(deadline) && len(config.Faults) > 0; i++ {
+		fault := config.Faults[i%len(config.Faults)]
+		s.report.Faults = append(s.report.Faults, s.inject(ctx, fault))
+		sleepCtx(ctx, config.FaultInterval)
+	}
+
+	stopTraffic()
+	wg.Wait()
+
+	applied, err := s.appliedWrites(ctx)
+	if err != nil {
+		return s.report, err
+	}
+	s.report.WritesApplied = applied
+	return s.report, nil
+}
+
+// seed creates the read fixture and one write counter per client.
+func (s *soak) seed(ctx context.Context) error {
+	db, err := sql.Open("mysql", s.env.MySQLDSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	statements := []string{
+		"CREATE TABLE IF NOT EXISTS soak_rows (id INT PRIMARY KEY, token VARCHAR(64) NOT NULL)",
+		"CREATE TABLE IF NOT EXISTS soak_counters (client_id INT PRIMARY KEY, n INT NOT NULL DEFAULT 0)",
+		"DELETE FROM soak_rows",
+		"DELETE FROM soak_counters",
+	}
+	for _, stmt := range statements {
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to seed soak tables: %w", err)
+		}
+	}
+	for id := 1; id <= soakRows; id++ {
+		if _, err := db.ExecContext(ctx, "INSERT INTO soak_rows (id, token) VALUES (?, ?)", id, soakToken(id)); err != nil {
+			return fmt.Errorf("failed to seed soak_rows: %w", err)
+		}
+	}
+	for c := 0; c < s.config.Clients; c++ {
+		if _, err := db.ExecContext(ctx, "INSERT INTO soak_counters (client_id, n) VALUES (?, 0)", c); err != nil {
+			return fmt.Errorf("failed to seed soak_counters: %w", err)
+		}
+	}
+	return nil
+}
+
+// soakToken is the token of fixture row id
+func soakToken(id int) string {
+	return fmt.Sprintf("token-%d-%d", id, id*7919%1000)
+}
+
+// runClient alternates reads and counter increments until ctx is done.
+// Every read carries a unique probe value the response must echo, so a
+// response delivered to the wrong request is caught.
+func (s *soak) runClient(ctx context.Context, client int, db *sql.DB) {
+	for seq := 0; ctx.Err() == nil; seq++ {
+		start := time.Now()
+		var err error
+		if seq%4 == 3 {
+			atomic.AddInt64(&s.report.WritesAttempted, 1)
+			if err = s.write(client, db); err == nil {
+				atomic.AddInt64(&s.report.WritesSucceeded, 1)
+			}
+			atomic.AddInt64(&s.report.Writes, 1)
+		} else {
+			err = s.read(client, seq, db)
+			atomic.AddInt64(&s.report.Reads, 1)
+		}
+		s.record(client, start, err)
+
+		if err != nil {
+			// Do not spin while the fault lasts
+			sleepCtx(ctx, 200*time.Millisecond)
+		}
+	}
+}
+
+// errMismatch marks a response that answered another request
+var errMismatch = errors.New("mismatched response")
+
+// read fetches a fixture row together with a probe value and checks both
+// came back unchanged.
+func (s *soak) read(client, seq int, db *sql.DB) error {
+	id := (client*31+seq)%soakRows + 1
+	probe := fmt.Sprintf("c%d-%d", client, seq)
+
+	var gotID int
+	var token, echoed string
+	err := db.QueryRow("SELECT id, token, ? AS probe FROM soak_rows WHERE id = ?", probe, id).Scan(&gotID, &token, &echoed)
+	if err != nil {
+		return err
+	}
+	if gotID != id || token != soakToken(id) || echoed != probe {
+		return fmt.Errorf("%w: asked for row %d with probe %s, got row %d token %s probe %s",
+			errMismatch, id, probe, gotID, token, echoed)
+	}
+	return nil
+}
+
+// write increments the client's counter.
+func (s *soak) write(client int, db *sql.DB) error {
+	result, err := db.Exec("UPDATE soak_counters SET n = n + 1 WHERE client_id = ?", client)
+	if err != nil {
+		return err
+	}
+	if n, err := result.RowsAffected(); err == nil && n != 1 {
+		return fmt.Errorf("%w: counter update of client %d affected %d rows", errMismatch, client, n)
+	}
+	return nil
+}
+
+// record classifies the outcome of a request that started at start.
+func (s *soak) record(client int, start time.Time, err error) {
+	end := time.Now()
+	if end.Sub(start) > s.config.ClientTimeout+hangGrace {
+		atomic.AddInt64(&s.report.Hung, 1)
+		s.problem(fmt.Sprintf("client %d request took %v", client, end.Sub(start).Round(time.Millisecond)))
+	}
+
+	switch {
+	case err == nil:
+		s.mutex.Lock()
+		if start.After(s.lastSuccess[client]) {
+			s.lastSuccess[client] = start
+		}
+		s.mutex.Unlock()
+	case errors.Is(err, errMismatch):
+		atomic.AddInt64(&s.report.Mismatched, 1)
+		s.problem(err.Error())
+	case s.duringFault(start, end):
+		atomic.AddInt64(&s.report.Failed, 1)
+	default:
+		atomic.AddInt64(&s.report.UnexpectedErrors, 1)
+		s.problem(fmt.Sprintf("client %d: %v", client, err))
+	}
+}
+
+// duringFault reports whether a request running from start to end
+// overlapped a fault window.
+func (s *soak) duringFault(start, end time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for _, w := range s.windows {
+		if !start.After(w.end) || w.end.IsZero() {
+			if !end.Before(w.start) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// problem keeps an example of a violation.
+func (s *soak) problem(text string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if len(s.report.Problems) < maxProblemExamples {
+		s.report.Problems = append(s.report.Problems, text)
+	}
+}
+
+// inject applies a fault, undoes it and waits for every client to recover.
+func (s *soak) inject(ctx context.Context, fault string) FaultRecord {
+	record := FaultRecord{Fault: fault, Injected: time.Now()}
+	s.mutex.Lock()
+	s.windows = append(s.windows, faultWindow{start: record.Injected})
+	s.mutex.Unlock()
+	log.Printf("[soak] injecting %s", fault)
+
+	defer func() {
+		// Close the window whether or not the clients recovered
+		s.mutex.Lock()
+		s.windows[len(s.windows)-1].end = time.Now()
+		s.mutex.Unlock()
+	}()
+
+	if record.Err = s.applyFault(ctx, fault); record.Err != nil {
+		return record
+	}
+	faultEnd := time.Now()
+
+	// Wait until every client succeeded with a request sent after the fault
+	record.Err = waitFor(ctx, s.config.RecoveryTimeout, "every client to recover from "+fault, func() error {
+		s.env.ensureServer()
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		for client, last := range s.lastSuccess {
+			if !last.After(faultEnd) {
+				return fmt.Errorf("client %d has not succeeded since", client)
+			}
+		}
+		return nil
+	})
+	if record.Err == nil {
+		record.Recovered = time.Since(faultEnd)
+		log.Printf("[soak] recovered from %s in %v", fault, record.Recovered.Round(time.Millisecond))
+	}
+	return record
+}
+
+// applyFault injects fault and returns once the failed component is back.
+func (s *soak) applyFault(ctx context.Context, fault string) error {
+	env := s.env
+	switch fault {
+	case FaultBrokerRestart, FaultBrokerCrash:
+		restart := env.Broker.Restart
+		if fault == FaultBrokerCrash {
+			restart = env.Broker.Crash
+		}
+		if err := restart(ctx); err != nil {
+			return err
+		}
+		if err := waitFor(ctx, 90*time.Second, "RabbitMQ after "+fault, env.pingBroker); err != nil {
+			return err
+		}
+		// The server's own connection died with the broker
+		env.RestartServer()
+	case FaultBrokerPartition:
+		if err := env.Broker.Pause(ctx); err != nil {
+			return err
+		}
+		sleepCtx(ctx, s.config.PartitionDuration)
+		if err := env.Broker.Unpause(ctx); err != nil {
+			return err
+		}
+		if err := waitFor(ctx, 90*time.Second, "RabbitMQ after "+fault, env.pingBroker); err != nil {
+			return err
+		}
+	case FaultDatabaseRestart, FaultDatabaseCrash:
+		restart := env.Database.Restart
+		if fault == FaultDatabaseCrash {
+			restart = env.Database.Crash
+		}
+		if err := restart(ctx); err != nil {
+			return err
+		}
+		return waitFor(ctx, 120*time.Second, "database after "+fault, env.pingDatabase)
+	case FaultDatabasePartition:
+		if err := env.Database.Pause(ctx); err != nil {
+			return err
+		}
+		sleepCtx(ctx, s.config.PartitionDuration)
+		if err := env.Database.Unpause(ctx); err != nil {
+			return err
+		}
+		return waitFor(ctx, 120*time.Second, "database after "+fault, env.pingDatabase)
+	default:
+		return fmt.Errorf("unknown fault %q", fault)
+	}
+	return nil
+}
+
+// appliedWrites sums the counters, read directly from the database.
+func (s *soak) appliedWrites(ctx context.Context) (int64, error) {
+	db, err := sql.Open("mysql", s.env.MySQLDSN)
+	if err != nil {
+		return 0, err
+	}
+	defer db.Close()
+
+	var applied int64
+	err = waitFor(ctx, 60*time.Second, "database to count writes", func() error {
+		return db.QueryRowContext(ctx, "SELECT COALESCE(SUM(n), 0) FROM soak_counters").Scan(&applied)
+	})
+	return applied, err
+}
+
+// sleepCtx sleeps for d or until ctx is done.
+func sleepCtx(ctx context.Context, d time.Duration) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(d):
+	}
+}
@@ -0,0 +1,75 @@
+//go:build integration
+
+package integration
+
+import (
+	"context"
+	"flag"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Soak flags, passed after -args. The soak test only runs with -soak:
+//
+//	go test -tags=integration ./integration/... -run TestSoak -timeout 30m -args -soak -duration=5m
+var (
+	soakFlag      = flag.Bool("soak", false, "Run the soak test")
+	soakBroker    = flag.String("broker", "rabbitmq:3.13-management", "RabbitMQ image of the soak test")
+	soakDatabase  = flag.String("database", "mariadb:11", "MySQL/MariaDB image of the soak test")
+	soakDuration  = flag.Duration("duration", DefaultSoakConfig().Duration, "How long to keep injecting faults")
+	soakClients   = flag.Int("clients", DefaultSoakConfig().Clients, "Client goroutines running traffic")
+	soakInterval  = flag.Duration("fault-interval", DefaultSoakConfig().FaultInterval, "Quiet time between faults")
+	soakPartition = flag.Duration("partition", DefaultSoakConfig().PartitionDuration, "How long partition faults last")
+	soakRecovery  = flag.Duration("recovery-timeout", DefaultSoakConfig().RecoveryTimeout, "How long clients have to recover after a fault")
+	soakFaults    = flag.String("faults", strings.Join(DefaultSoakConfig().Faults, ","), "Comma-separated faults to cycle through")
+)
+
+// TestSoak runs client traffic while repeatedly restarting, killing and
+// partitioning the broker and the database, and fails if any response was
+// lost or mixed up or the clients did not recover.
+func TestSoak(t *testing.T) {
+	if !*soakFlag {
+		t.Skip("soak test disabled; run with -args -soak")
+	}
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("docker is not installed")
+	}
+
+	config := DefaultSoakConfig()
+	config.Duration = *soakDuration
+	config.Clients = *soakClients
+	config.FaultInterval = *soakInterval
+	config.PartitionDuration = *soakPartition
+	config.RecoveryTimeout = *soakRecovery
+	config.Faults = strings.Split(*soakFaults, ",")
+
+	ctx := context.Background()
+	env, err := StartEnvironment(ctx, *soakBroker, *soakDatabase)
+	if err != nil {
+		t.Fatalf("setup failed: %v", err)
+	}
+	defer env.Close(ctx)
+
+	report, err := Soak(ctx, env, config)
+	if err != nil {
+		t.Fatalf("soak failed: %v", err)
+	}
+
+	for _, f := range report.Faults {
+		if f.Err != nil {
+			t.Logf("FAIL %-20s %s  %v", f.Fault, f.Injected.Format("15:04:05"), f.Err)
+			continue
+		}
+		t.Logf("PASS %-20s %s  recovered in %v", f.Fault, f.Injected.Format("15:04:05"), f.Recovered.Round(time.Millisecond))
+	}
+	t.Logf("reads %d, writes %d, failed during faults %d, unexpected errors %d, mismatched %d, hung %d",
+		report.Reads, report.Writes, report.Failed, report.UnexpectedErrors, report.Mismatched, report.Hung)
+	t.Logf("writes: %d acknowledged, %d applied, %d attempted",
+		report.WritesSucceeded, report.WritesApplied, report.WritesAttempted)
+
+	if err := report.Err(); err != nil {
+		t.Fatal(err)
+	}
+}
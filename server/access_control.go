@@ -0,0 +1,208 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+)
+
+// ErrAccessDenied is the RPCResponse.ErrorCode of requests whose type the
+// access control policy does not grant to the client
+const ErrAccessDenied = "ACCESS_DENIED"
+
+// AccessRole allows a set of authenticated principals to send the request
+// types matching RequestTypes.
+type AccessRole struct {
+	Name         string   `json:"name"`                // Role name recorded in logs
+	Principals   []string `json:"principals"`          // Glob patterns of AMQP users (validated user_id) holding the role
+	RequestTypes []string `json:"request_types"`       // Glob patterns of request types the role may send ("*" for any)
+	Functions    []string `json:"functions,omitempty"` // Glob patterns of the functions it may call (empty for any)
+}
+
+// AccessControlConfig maps client identities to roles. As for
+// impersonation, the principal is the user_id property of the AMQP message,
+// which RabbitMQ checks against the authenticated user. Heartbeats and
+// session requests are always allowed.
+type AccessControlConfig struct {
+	Enabled      bool         `json:"enabled"`                 // Enforce the policy
+	Roles        []AccessRole `json:"roles"`                   // Roles granting request types
+	DefaultRoles []string     `json:"default_roles,omitempty"` // Roles of principals no role lists, including clients without user_id
+}
+
+// DefaultAccessControlConfig returns a disabled access control configuration
+func DefaultAccessControlConfig() AccessControlConfig {
+	return AccessControlConfig{Enabled: false}
+}
+
+// LoadAccessControlConfig reads an access control policy from a JSON file.
+//
+// Example:
+//
+//	{
+//	  "enabled": true,
+//	  "roles": [
+//	    {"name": "metrics", "principals": ["metrics-*"], "request_types": ["function"], "functions": ["get*"]},
+//	    {"name": "operator", "principals": ["ops"], "request_types": ["command", "function", "log.tail"]},
+//	    {"name": "app", "principals": ["app-svc"], "request_types": ["sql", "transaction", "prepare", "deallocate"]}
+//	  ]
+//	}
+func LoadAccessControlConfig(filename string) (AccessControlConfig, error) {
+	config := DefaultAccessControlConfig()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return config, fmt.Errorf("failed to read access control config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse access control config %s: %w", filename, err)
+	}
+	return config, config.Validate()
+}
+
+// Validate checks every role, pattern and default role
+func (ac AccessControlConfig) Validate() error {
+	names := make(map[string]bool)
+	for i, role := range ac.Roles {
+		if role.Name == "" {
+			return fmt.Errorf("access role %d: name is required", i)
+		}
+		if names[role.Name] {
+			return fmt.Errorf("access role %s is defined twice", role.Name)
+		}
+		names[role.Name] = true
+		if len(role.RequestTypes) == 0 {
+			return fmt.Errorf("access role %s: at least one request type is required", role.Name)
+		}
+		patterns := append(append(append([]string{}, role.Principals...), role.RequestTypes...), role.Functions...)
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("access role %s: invalid pattern %q", role.Name, pattern)
+			}
+		}
+	}
+	for _, name := range ac.DefaultRoles {
+		if !names[name] {
+			return fmt.Errorf("default access role %s is not defined", name)
+		}
+	}
+	return nil
+}
+
+// rolesOf returns the roles of principal
+func (ac AccessControlConfig) rolesOf(principal string) []AccessRole {
+	var roles []AccessRole
+	if principal != "" {
+		for _, role := range ac.Roles {
+			if matchAny(role.Principals, principal) {
+				roles = append(roles, role)
+			}
+		}
+	}
+	if len(roles) > 0 {
+		return roles
+	}
+	for _, role := range ac.Roles {
+		if contains(ac.DefaultRoles, role.Name) {
+			roles = append(roles, role)
+		}
+	}
+	return roles
+}
+
+// Authorize checks whether principal may send a request of requestType and
+// returns the role that grants it. function is the function a "function"
+// request calls, checked against the role's Functions.
+func (ac AccessControlConfig) Authorize(principal, requestType, function string) (string, error) {
+	if !ac.Enabled || requestType == "heartbeat_ping" || requestType == "session" {
+		return "", nil
+	}
+
+	roles := ac.rolesOf(principal)
+	if len(roles) == 0 {
+		if principal == "" {
+			return "", fmt.Errorf("requests need an authenticated principal (publish with the AMQP user_id property)")
+		}
+		return "", fmt.Errorf("principal '%s' has no role", principal)
+	}
+	return authorizeRoles(roles, "principal '"+principal+"'", requestType, function)
+}
+
+// AuthorizeRole checks whether the named role, such as the role claim of a
+// client token, may send a request of requestType
+func (ac AccessControlConfig) AuthorizeRole(name, requestType, function string) (string, error) {
+	if !ac.Enabled || requestType == "heartbeat_ping" || requestType == "session" {
+		return "", nil
+	}
+
+	for _, role := range ac.Roles {
+		if role.Name == name {
+			return authorizeRoles([]AccessRole{role}, "role '"+name+"'", requestType, function)
+		}
+	}
+	return "", fmt.Errorf("role '%s' is not defined", name)
+}
+
+// authorizeRoles returns the first of roles granting requestType and
+// function to who
+func authorizeRoles(roles []AccessRole, who, requestType, function string) (string, error) {
+	for _, role := range roles {
+		if !matchAny(role.RequestTypes, requestType) {
+			continue
+		}
+		if requestType == "function" && len(role.Functions) > 0 && !matchAny(role.Functions, function) {
+			continue
+		}
+		return role.Name, nil
+	}
+	if requestType == "function" {
+		return "", fmt.Errorf("%s may not call function '%s'", who, function)
+	}
+	return "", fmt.Errorf("%s may not send %s requests", who, requestType)
+}
+
+// SetAccessControlConfig installs the request type access control policy
+func (h *Handler) SetAccessControlConfig(config AccessControlConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	h.accessControl = config
+	log.Printf("[server] Access control configured: %d roles, enabled=%v", len(config.Roles), config.Enabled)
+	return nil
+}
+
+// authorizeRequestType verifies that the principal of a request, or the
+// role of its token when it has one, grants its type. Jobs are checked as
+// the function or command they run.
+func (h *Handler) authorizeRequestType(principal string, claims *TokenClaims, req RPCRequest) error {
+	if !h.accessControl.Enabled {
+		return nil
+	}
+
+	requestType, function := req.Type, ""
+	switch req.Type {
+	case "function":
+		var funcReq FunctionRequest
+		if err := json.Unmarshal([]byte(req.Query), &funcReq); err == nil {
+			function = funcReq.Name
+		}
+	case "job":
+		var jobReq JobRequest
+		if err := json.Unmarshal([]byte(req.Query), &jobReq); err == nil && jobReq.Kind != "" {
+			requestType, function = jobReq.Kind, jobReq.Name
+		}
+	}
+
+	var err error
+	if claims != nil && claims.Role != "" {
+		_, err = h.accessControl.AuthorizeRole(claims.Role, requestType, function)
+	} else {
+		_, err = h.accessControl.Authorize(principal, requestType, function)
+	}
+	if err != nil {
+		log.Printf("[server] Access denied: principal=%q type=%s ip=%s: %v", principal, req.Type, req.ClientIP, err)
+		return err
+	}
+	return nil
+}
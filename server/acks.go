@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Acknowledgement modes accepted by AckConfig.Mode
+const (
+	AckModeAuto   = "auto"   // Requests are acknowledged when the broker delivers them
+	AckModeManual = "manual" // Requests are acknowledged once processed
+)
+
+// Redelivery policies accepted by AckConfig.Redelivery
+const (
+	RedeliveryReject  = "reject"  // Answer with ErrRedelivered instead of running the write again
+	RedeliveryExecute = "execute" // Run the write again
+)
+
+// ErrRedelivered is the error code of a redelivered write that was not run
+// again because its first attempt may already have been applied
+const ErrRedelivered = "REDELIVERED"
+
+// deliveriesNamespace is the Storage namespace of processed deliveries
+const deliveriesNamespace = "deliveries"
+
+// AckConfig controls when RPC requests are acknowledged to the broker.
+//
+// With auto-ack (the default, as in earlier releases) a request is removed
+// from the queue as soon as it is delivered, so a crash mid-processing loses
+// it. With manual ack it is acknowledged once processed: requests that were
+// being processed when the server or its connection died are redelivered.
+// A redelivered write may already have been applied, so writes are tracked
+// in the storage and redeliveries are answered with the first response, or
+// handled according to Redelivery while the first attempt's outcome is
+// unknown. Only a persistent storage backend keeps that record across
+// server restarts.
+type AckConfig struct {
+	Mode         string        // "auto" (default) or "manual"
+	Requeue      bool          // Requeue requests whose processing failed; otherwise reject them (to the dead-letter queue, if any)
+	Redelivery   string        // Redelivered write with unknown outcome: "reject" (default) or "execute"
+	DedupeWindow time.Duration // How long write responses are kept to answer redeliveries
+}
+
+// DefaultAckConfig returns the default acknowledgement configuration
+func DefaultAckConfig() AckConfig {
+	return AckConfig{
+		Mode:         AckModeAuto,
+		Requeue:      true,
+		Redelivery:   RedeliveryReject,
+		DedupeWindow: 10 * time.Minute,
+	}
+}
+
+// manual reports whether requests are acknowledged once processed
+func (ac AckConfig) manual() bool {
+	return ac.Mode == AckModeManual
+}
+
+// SetAckConfig sets when RPC requests are acknowledged. It must be called
+// before Start.
+func (h *Handler) SetAckConfig(config AckConfig) error {
+	switch config.Mode {
+	case "":
+		config.Mode = AckModeAuto
+	case AckModeAuto, AckModeManual:
+	default:
+		return fmt.Errorf("invalid ack mode '%s': must be %s or %s", config.Mode, AckModeAuto, AckModeManual)
+	}
+	switch config.Redelivery {
+	case "":
+		config.Redelivery = RedeliveryReject
+	case RedeliveryReject, RedeliveryExecute:
+	default:
+		return fmt.Errorf("invalid redelivery policy '%s': must be %s or %s", config.Redelivery, RedeliveryReject, RedeliveryExecute)
+	}
+	if config.DedupeWindow <= 0 {
+		config.DedupeWindow = DefaultAckConfig().DedupeWindow
+	}
+
+	h.ackConfig = config
+	log.Printf("[server] Ack mode: %s (requeue=%v redelivery=%s dedupe window=%s)",
+		config.Mode, config.Requeue, config.Redelivery, config.DedupeWindow)
+	return nil
+}
+
+// deliveryRecord is what the storage keeps about a write request
+type deliveryRecord struct {
+	Done     bool         `json:"done"`               // A response was sent
+	Response *RPCResponse `json:"response,omitempty"` // Response sent for the first delivery
+}
+
+// isWriteRequest reports whether running req twice could apply a change twice
+func isWriteRequest(req RPCRequest) bool {
+	switch req.Type {
+	case "sql":
+		return req.Exec || len(req.Batch) > 0 || !isReadOnlyQuery(req.Query)
+	case "function", "command", "bulk", "job", "file.put", "approval":
+		return true
+	default:
+		return false
+	}
+}
+
+// deliveryStorage returns the storage processed deliveries are kept in
+func (h *Handler) deliveryStorage() Storage {
+	if h.storage != nil {
+		return h.storage
+	}
+	return h.deliveryFallback
+}
+
+// deliveryKey identifies a request across redeliveries. Correlation IDs are
+// only unique per client, so the reply address is part of the key.
+func deliveryKey(msg amqp.Delivery) string {
+	return msg.ReplyTo + "/" + msg.CorrelationId
+}
+
+// claimDelivery records a write request before it runs, so a redelivered
+// copy is not run again. It returns true when msg was a redelivery and has
+// been answered.
+func (h *Handler) claimDelivery(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) bool {
+	ctx := context.Background()
+	storage := h.deliveryStorage()
+	key := deliveryKey(msg)
+
+	if msg.Redelivered {
+		value, found, err := storage.Get(ctx, deliveriesNamespace, key)
+		if err != nil {
+			log.Printf("[server] Failed to look up redelivered request %s: %v", msg.CorrelationId, err)
+		}
+		var record deliveryRecord
+		if found && json.Unmarshal(value, &record) == nil {
+			if record.Done && record.Response != nil {
+				log.Printf("[server] Redelivered request %s answered with its first response", msg.CorrelationId)
+				h.respond(ch, msg.ReplyTo, msg.CorrelationId, *record.Response)
+				return true
+			}
+			if h.ackConfig.Redelivery == RedeliveryReject {
+				log.Printf("[server] Redelivered request %s not executed again: first attempt was interrupted", msg.CorrelationId)
+				h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+					Error:     "request was redelivered after an interrupted attempt and may already have been applied; not executed again",
+					ErrorCode: ErrRedelivered,
+				})
+				return true
+			}
+			log.Printf("[server] Executing redelivered request %s again", msg.CorrelationId)
+		}
+	}
+
+	value, _ := json.Marshal(deliveryRecord{})
+	if err := storage.Put(ctx, deliveriesNamespace, key, value, h.ackConfig.DedupeWindow); err != nil {
+		log.Printf("[server] Failed to record request %s: %v", msg.CorrelationId, err)
+		return false
+	}
+	h.deliveries.Store(msg.CorrelationId, key)
+	return false
+}
+
+// recordDeliveryReply keeps the response to a tracked write request
+func (h *Handler) recordDeliveryReply(corrID string, resp RPCResponse) {
+	value, ok := h.deliveries.LoadAndDelete(corrID)
+	if !ok {
+		return
+	}
+	record, _ := json.Marshal(deliveryRecord{Done: true, Response: &resp})
+	if err := h.deliveryStorage().Put(context.Background(), deliveriesNamespace, value.(string), record, h.ackConfig.DedupeWindow); err != nil {
+		log.Printf("[server] Failed to record response to request %s: %v", corrID, err)
+	}
+}
+
+// finishDelivery forgets a tracked request that ended without a response.
+// Its record stays unfinished, so a redelivery is handled as interrupted.
+func (h *Handler) finishDelivery(corrID string) {
+	h.deliveries.Delete(corrID)
+}
+
+// settle acknowledges a processed request, or rejects one whose processing
+// failed. Rejected requests are requeued when configured, except ones that
+// already failed after a redelivery, so a request that crashes the handler
+// is not retried forever.
+func settle(msg amqp.Delivery, failed, requeue bool) {
+	if !failed {
+		msg.Ack(false)
+		return
+	}
+	msg.Nack(false, requeue && !msg.Redelivered)
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ParseCacheTTLOverrides parses semicolon-separated query=ttl pairs, such as
+// "SELECT * FROM settings WHERE id = 1=1h; SELECT COUNT(*) FROM events=0".
+// Queries are reduced to their fingerprint, so the literals in them do not
+// matter; the TTL follows the last "=" of each pair. A TTL of 0 keeps the
+// query out of the cache.
+func ParseCacheTTLOverrides(spec string) (map[string]time.Duration, error) {
+	overrides := make(map[string]time.Duration)
+	for _, pair := range strings.Split(spec, ";") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		separator := strings.LastIndex(pair, "=")
+		if separator <= 0 {
+			return nil, fmt.Errorf("invalid cache TTL override %q: expected query=ttl", pair)
+		}
+		value := strings.TrimSpace(pair[separator+1:])
+		ttl, err := time.ParseDuration(value)
+		if err != nil || ttl < 0 {
+			return nil, fmt.Errorf("invalid cache TTL override %q: %q is not a duration", pair, value)
+		}
+		overrides[queryFingerprint(pair[:separator])] = ttl
+	}
+	return overrides, nil
+}
+
+// Admit decides whether the result of a read-only query with the given
+// fingerprint is stored, and for how long. A TTL override decides on its
+// own; otherwise adaptive caching requires the fingerprint's statistics to
+// reach the configured executions and average latency.
+func (qc *QueryCache) Admit(fingerprint string, stats StatementStats, seen bool) (time.Duration, bool) {
+	config := qc.currentConfig()
+	if ttl, ok := config.TTLOverrides[fingerprint]; ok {
+		if ttl <= 0 {
+			qc.recordSkip()
+			return 0, false
+		}
+		return ttl, true
+	}
+	if !config.Adaptive {
+		return config.TTL, true
+	}
+
+	if !seen || stats.Count < config.AdaptiveMinExecutions ||
+		stats.TotalTime < config.AdaptiveMinLatency*time.Duration(stats.Count) {
+		qc.recordSkip()
+		return 0, false
+	}
+	return config.TTL, true
+}
+
+// cachePolicy returns whether the result of a read-only query is worth
+// caching, and its time to live
+func (h *Handler) cachePolicy(query string) (time.Duration, bool) {
+	if !h.queryCache.Enabled() {
+		return 0, false
+	}
+	fingerprint := queryFingerprint(query)
+	stats, seen := h.queryStats.Lookup(fingerprint)
+	return h.queryCache.Admit(fingerprint, stats, seen)
+}
@@ -0,0 +1,286 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+)
+
+// Alert severities
+const (
+	SeverityWarning  = "warning"
+	SeverityCritical = "critical"
+)
+
+// Alert states
+const (
+	AlertFiring   = "firing"
+	AlertResolved = "resolved"
+)
+
+// AlertThreshold holds the levels at which a metric raises a warning and a
+// critical alert (0 disables a level)
+type AlertThreshold struct {
+	Warning  float64
+	Critical float64
+}
+
+// AlertConfig holds configuration for monitoring alert notifications
+type AlertConfig struct {
+	WebhookURLs []string      // Endpoints every alert is POSTed to (none: alerts are only logged)
+	Timeout     time.Duration // Time a webhook may take to answer
+
+	InjectionRate   AlertThreshold // Percent of validated queries that were SQL injection attempts
+	BlockRate       AlertThreshold // Percent of validated queries blocked by validation
+	QueueSaturation AlertThreshold // Percent of the worker queue in use (100 when requests were rejected)
+
+	// Hysteresis is how far, in percent of a level, a metric must fall back
+	// below it before the alert drops that level, so a metric hovering
+	// around a threshold does not fire and resolve at every interval
+	Hysteresis float64
+}
+
+// DefaultAlertConfig returns the default alert configuration: alerts are
+// logged, no webhook is called
+func DefaultAlertConfig() AlertConfig {
+	return AlertConfig{
+		Timeout:         10 * time.Second,
+		InjectionRate:   AlertThreshold{Warning: 1, Critical: 5},
+		BlockRate:       AlertThreshold{Warning: 30, Critical: 60},
+		QueueSaturation: AlertThreshold{Warning: 90, Critical: 100},
+		Hysteresis:      10,
+	}
+}
+
+// validate checks that the levels are not negative, that warnings come
+// before critical levels and that the hysteresis is a percentage
+func (ac AlertConfig) validate() error {
+	thresholds := map[string]AlertThreshold{
+		"injection_rate":   ac.InjectionRate,
+		"block_rate":       ac.BlockRate,
+		"queue_saturation": ac.QueueSaturation,
+	}
+	for name, threshold := range thresholds {
+		if threshold.Warning < 0 || threshold.Critical < 0 {
+			return fmt.Errorf("%s: alert levels must not be negative", name)
+		}
+		if threshold.Warning > 0 && threshold.Critical > 0 && threshold.Warning > threshold.Critical {
+			return fmt.Errorf("%s: warning level %.2f is above critical level %.2f", name, threshold.Warning, threshold.Critical)
+		}
+	}
+	if ac.Hysteresis < 0 || ac.Hysteresis >= 100 {
+		return fmt.Errorf("alert hysteresis must be between 0 and 100 percent, got %.2f", ac.Hysteresis)
+	}
+	return nil
+}
+
+// Alert is the document POSTed to the webhooks when a monitored metric
+// crosses its threshold and again when it recovers. Text carries a one-line
+// summary, so Slack and compatible incoming webhooks display it as is.
+type Alert struct {
+	Alert     string    `json:"alert"`    // Metric: injection_rate, block_rate, queue_saturation or db_down
+	Status    string    `json:"status"`   // "firing" or "resolved"
+	Severity  string    `json:"severity"` // "warning" or "critical"
+	DeviceID  string    `json:"device_id"`
+	Hostname  string    `json:"hostname"`
+	Value     float64   `json:"value"`     // Value of the metric when the alert changed state
+	Threshold float64   `json:"threshold"` // Level of the severity
+	Message   string    `json:"message"`
+	Text      string    `json:"text"`
+	StartsAt  time.Time `json:"starts_at"` // When the alert started firing
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AlertNotifier tracks which alerts are firing and notifies the webhooks of
+// every change, so an ongoing breach is reported once rather than at every
+// monitoring interval
+type AlertNotifier struct {
+	config   AlertConfig
+	deviceID string
+	hostname string
+	client   *http.Client
+
+	mutex  sync.Mutex
+	firing map[string]Alert // Firing alerts by metric
+	sent   int64            // Webhook deliveries that succeeded
+	failed int64            // Webhook deliveries that failed
+}
+
+// NewAlertNotifier creates an alert notifier for deviceID
+func NewAlertNotifier(deviceID string, config AlertConfig) *AlertNotifier {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultAlertConfig().Timeout
+	}
+	hostname, _ := os.Hostname()
+	return &AlertNotifier{
+		config:   config,
+		deviceID: deviceID,
+		hostname: hostname,
+		client:   &http.Client{Timeout: config.Timeout},
+		firing:   make(map[string]Alert),
+	}
+}
+
+// level returns the severity a metric is at, or "" when it is under both
+// levels. A level already reached is kept until the value falls below it by
+// the hysteresis.
+func (an *AlertNotifier) level(value float64, threshold AlertThreshold, current string) (string, float64) {
+	margin := 1 - an.config.Hysteresis/100
+	reached := func(level float64, held bool) bool {
+		if level <= 0 {
+			return false
+		}
+		return value >= level || (held && value >= level*margin)
+	}
+
+	if reached(threshold.Critical, current == SeverityCritical) {
+		return SeverityCritical, threshold.Critical
+	}
+	if reached(threshold.Warning, current != "") {
+		return SeverityWarning, threshold.Warning
+	}
+	return "", 0
+}
+
+// observe records the latest value of a metric. An alert fires when the
+// metric reaches the warning or critical level, changes severity when it
+// crosses the other and resolves when it is back under both; the webhooks
+// are notified of these changes only.
+func (an *AlertNotifier) observe(name string, value float64, threshold AlertThreshold, message string) {
+	now := time.Now()
+
+	alert := Alert{
+		Alert:     name,
+		Status:    AlertFiring,
+		DeviceID:  an.deviceID,
+		Hostname:  an.hostname,
+		Value:     value,
+		Message:   message,
+		StartsAt:  now,
+		Timestamp: now,
+	}
+
+	an.mutex.Lock()
+	current, firing := an.firing[name]
+	severity, level := an.level(value, threshold, current.Severity)
+	switch {
+	case severity == current.Severity:
+		an.mutex.Unlock()
+		return
+	case severity != "":
+		if firing {
+			alert.StartsAt = current.StartsAt
+		}
+		alert.Severity = severity
+		alert.Threshold = level
+		alert.Text = alertText(alert)
+		an.firing[name] = alert
+	default:
+		alert.Status = AlertResolved
+		alert.Severity = current.Severity
+		alert.Threshold = current.Threshold
+		alert.StartsAt = current.StartsAt
+		alert.Text = alertText(alert)
+		delete(an.firing, name)
+	}
+	an.mutex.Unlock()
+
+	log.Printf("[monitoring] %s", alert.Text)
+	if len(an.config.WebhookURLs) > 0 {
+		go an.deliver(alert)
+	}
+}
+
+// alertText formats the one-line summary of an alert
+func alertText(alert Alert) string {
+	if alert.Status == AlertResolved {
+		return fmt.Sprintf("RESOLVED %s on %s: %s (after %v)",
+			alert.Alert, alert.DeviceID, alert.Message, alert.Timestamp.Sub(alert.StartsAt).Round(time.Second))
+	}
+	return fmt.Sprintf("%s %s on %s: %s", strings.ToUpper(alert.Severity), alert.Alert, alert.DeviceID, alert.Message)
+}
+
+// deliver POSTs an alert to every webhook
+func (an *AlertNotifier) deliver(alert Alert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		log.Printf("[monitoring] Failed to marshal alert: %v", err)
+		return
+	}
+
+	for _, url := range an.config.WebhookURLs {
+		err := an.post(url, body)
+
+		an.mutex.Lock()
+		if err != nil {
+			an.failed++
+		} else {
+			an.sent++
+		}
+		an.mutex.Unlock()
+
+		if err != nil {
+			log.Printf("[monitoring] Failed to notify %s of alert %s: %v", client.RedactURL(url), alert.Alert, err)
+		}
+	}
+}
+
+// post sends one alert document to a webhook
+func (an *AlertNotifier) post(url string, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), an.config.Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := an.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// AlertStats lists the firing alerts and the webhook delivery counters
+type AlertStats struct {
+	Firing   []Alert `json:"firing"` // Oldest first
+	Webhooks int     `json:"webhooks"`
+	Sent     int64   `json:"sent"`
+	Failed   int64   `json:"failed"`
+}
+
+// GetStats returns the firing alerts and the webhook delivery counters
+func (an *AlertNotifier) GetStats() AlertStats {
+	an.mutex.Lock()
+	defer an.mutex.Unlock()
+
+	stats := AlertStats{
+		Firing:   make([]Alert, 0, len(an.firing)),
+		Webhooks: len(an.config.WebhookURLs),
+		Sent:     an.sent,
+		Failed:   an.failed,
+	}
+	for _, alert := range an.firing {
+		stats.Firing = append(stats.Firing, alert)
+	}
+	sort.Slice(stats.Firing, func(i, j int) bool {
+		return stats.Firing[i].StartsAt.Before(stats.Firing[j].StartsAt)
+	})
+	return stats
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Approval error codes sent in RPCResponse.ErrorCode
+const (
+	ErrApprovalRejected = "APPROVAL_REJECTED" // An operator rejected the held request, or too many were held
+	ErrApprovalTimeout  = "APPROVAL_TIMEOUT"  // Nobody approved the held request in time
+	ErrApprovalDenied   = "APPROVAL_DENIED"   // The operator may not approve the request
+)
+
+// ApprovalConfig holds configuration for requests held for approval
+type ApprovalConfig struct {
+	Timeout    time.Duration // How long a held request waits for a decision before it is rejected
+	MaxPending int           // Most requests held at once; more are rejected right away
+	// Refuse approvals from the identity that sent the request, so every held
+	// request needs a second operator
+	RequireSecondOperator bool
+}
+
+// DefaultApprovalConfig returns the default approval configuration
+func DefaultApprovalConfig() ApprovalConfig {
+	return ApprovalConfig{
+		Timeout:               10 * time.Minute,
+		MaxPending:            100,
+		RequireSecondOperator: true,
+	}
+}
+
+// PendingRequest is a request held until an operator approves or rejects it
+type PendingRequest struct {
+	ID              string    `json:"id"`
+	Principal       string    `json:"principal"` // AMQP user that sent the request
+	OnBehalfOf      string    `json:"onBehalfOf,omitempty"`
+	ClientIP        string    `json:"clientIP"`
+	Query           string    `json:"query"`
+	Params          int       `json:"params"` // Number of parameters (values are not shown)
+	DetectedCommand string    `json:"detectedCommand"`
+	Risk            string    `json:"risk"`
+	Errors          []string  `json:"errors"` // Validation findings, including the approval requirement
+	SubmittedAt     time.Time `json:"submittedAt"`
+	ExpiresAt       time.Time `json:"expiresAt"`
+}
+
+// requester returns the identity that sent a pending request: the end user
+// it runs for, or the AMQP user
+func (p PendingRequest) requester() string {
+	if p.OnBehalfOf != "" {
+		return p.OnBehalfOf
+	}
+	return p.Principal
+}
+
+// heldRequest is a pending request with what runs once it is decided
+type heldRequest struct {
+	info   PendingRequest
+	run    func()                 // Executes the request
+	reject func(resp RPCResponse) // Answers the client without executing it
+	timer  *time.Timer            // Rejects the request when the timeout passes
+}
+
+// ApprovalQueue holds requests until an operator approves or rejects them
+// with an "approval" request
+type ApprovalQueue struct {
+	config  ApprovalConfig
+	pending map[string]*heldRequest
+	mutex   sync.Mutex
+}
+
+// NewApprovalQueue creates an empty approval queue
+func NewApprovalQueue(config ApprovalConfig) *ApprovalQueue {
+	return &ApprovalQueue{config: config, pending: make(map[string]*heldRequest)}
+}
+
+// newApprovalID returns a random pending request identifier
+func newApprovalID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("apr_%d", time.Now().UnixNano())
+	}
+	return "apr_" + hex.EncodeToString(buf)
+}
+
+// SetConfig replaces the configuration; requests already held keep their
+// expiry
+func (q *ApprovalQueue) SetConfig(config ApprovalConfig) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.config = config
+}
+
+// Hold parks a request until it is approved, rejected or times out. run
+// executes it once approved; reject answers the client otherwise.
+func (q *ApprovalQueue) Hold(info PendingRequest, run func(), reject func(resp RPCResponse)) (string, error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if q.config.MaxPending > 0 && len(q.pending) >= q.config.MaxPending {
+		return "", fmt.Errorf("%d requests are already waiting for approval", len(q.pending))
+	}
+
+	info.ID = newApprovalID()
+	info.SubmittedAt = time.Now()
+	info.ExpiresAt = info.SubmittedAt.Add(q.config.Timeout)
+	held := &heldRequest{info: info, run: run, reject: reject}
+	held.timer = time.AfterFunc(q.config.Timeout, func() {
+		if held := q.take(info.ID); held != nil {
+			log.Printf("[server] Request %s expired without approval", info.ID)
+			held.reject(RPCResponse{
+				Error:     fmt.Sprintf("request %s was not approved within %v", info.ID, q.config.Timeout),
+				ErrorCode: ErrApprovalTimeout,
+			})
+		}
+	})
+	q.pending[info.ID] = held
+	return info.ID, nil
+}
+
+// take removes a held request, or returns nil if it is no longer held
+func (q *ApprovalQueue) take(id string) *heldRequest {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	held := q.pending[id]
+	if held != nil {
+		delete(q.pending, id)
+		held.timer.Stop()
+	}
+	return held
+}
+
+// List returns the held requests, oldest first
+func (q *ApprovalQueue) List() []PendingRequest {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	requests := make([]PendingRequest, 0, len(q.pending))
+	for _, held := range q.pending {
+		requests = append(requests, held.info)
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].SubmittedAt.Before(requests[j].SubmittedAt) })
+	return requests
+}
+
+// Approve executes a held request on behalf of approver; its response goes
+// to the client that sent it. With RequireSecondOperator the approver must
+// be known and differ from the requester.
+func (q *ApprovalQueue) Approve(id, approver string) (PendingRequest, error) {
+	q.mutex.Lock()
+	held := q.pending[id]
+	secondOperator := q.config.RequireSecondOperator
+	q.mutex.Unlock()
+	if held == nil {
+		return PendingRequest{}, fmt.Errorf("no request %s is waiting for approval", id)
+	}
+	if secondOperator {
+		if approver == "" {
+			return held.info, &approvalError{"the approver's identity is unknown; a second operator must approve"}
+		}
+		if approver == held.info.requester() {
+			return held.info, &approvalError{fmt.Sprintf("%s sent request %s and cannot approve it; a second operator must", approver, id)}
+		}
+	}
+
+	if held = q.take(id); held == nil {
+		return PendingRequest{}, fmt.Errorf("no request %s is waiting for approval", id)
+	}
+	go held.run()
+	return held.info, nil
+}
+
+// approvalError reports an approval the operator may not give
+type approvalError struct {
+	message string
+}
+
+func (e *approvalError) Error() string {
+	return e.message
+}
+
+// Reject answers a held request with an error instead of executing it. Any
+// operator, the requester included, may reject a request.
+func (q *ApprovalQueue) Reject(id, reason string) (PendingRequest, error) {
+	held := q.take(id)
+	if held == nil {
+		return PendingRequest{}, fmt.Errorf("no request %s is waiting for approval", id)
+	}
+	message := fmt.Sprintf("request %s was rejected by an operator", id)
+	if reason != "" {
+		message += ": " + reason
+	}
+	held.reject(RPCResponse{Error: message, ErrorCode: ErrApprovalRejected})
+	return held.info, nil
+}
+
+// SetApprovalConfig configures requests held for approval
+func (h *Handler) SetApprovalConfig(config ApprovalConfig) {
+	h.approvals.SetConfig(config)
+	log.Printf("[server] Approval configuration updated: timeout=%v max_pending=%d second_operator=%v",
+		config.Timeout, config.MaxPending, config.RequireSecondOperator)
+}
+
+// approvalRequest is the body of an "approval" request
+type approvalRequest struct {
+	Action string `json:"action"` // list, approve or reject
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// operatorIdentity returns who sent a request: the end user it runs for, or
+// the AMQP user
+func operatorIdentity(msg amqp.Delivery, req RPCRequest) string {
+	if req.OnBehalfOf != "" {
+		return req.OnBehalfOf
+	}
+	return msg.UserId
+}
+
+// holdForApproval parks a request that requires an operator's approval; run
+// executes it once approved. The hold and its outcome are audited.
+func (h *Handler) holdForApproval(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest, result ValidationResult, run func()) {
+	info := PendingRequest{
+		Principal:       msg.UserId,
+		OnBehalfOf:      req.OnBehalfOf,
+		ClientIP:        req.ClientIP,
+		Query:           req.Query,
+		Params:          len(req.Params),
+		DetectedCommand: result.DetectedCommand,
+		Risk:            result.Risk.String(),
+		Errors:          result.Errors,
+	}
+	reject := func(resp RPCResponse) {
+		if resp.ErrorCode == ErrApprovalTimeout {
+			h.auditApproval("expire", info, "", resp.Error)
+		}
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, resp)
+	}
+	execute := func() {
+		// The original audit record was written when the request was held
+		record := h.beginAudit(msg.CorrelationId, msg.UserId, req, time.Now())
+		defer h.finishAudit(msg.CorrelationId, record)
+		run()
+	}
+
+	id, err := h.approvals.Hold(info, execute, reject)
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error:     fmt.Sprintf("approval required: %v", err),
+			ErrorCode: ErrApprovalRejected,
+		})
+		return
+	}
+	info.ID = id
+
+	// The request is answered after its audit record is written
+	if value, ok := h.auditInFlight.Load(msg.CorrelationId); ok {
+		value.(*AuditRecord).Outcome = "pending_approval"
+	}
+	h.auditApproval("hold", info, info.requester(), strings.Join(result.Errors, "; "))
+	log.Printf("[server] Request %s from %s held for approval (risk: %s): %s",
+		id, req.ClientIP, result.Risk, h.loggedQuery(req.Query, 50))
+}
+
+// auditApproval writes an audit record for a step of the approval of a held
+// request: hold, approve, reject or expire
+func (h *Handler) auditApproval(action string, info PendingRequest, operator, detail string) {
+	if h.auditLogger == nil {
+		return
+	}
+	record := AuditRecord{
+		Timestamp: time.Now(),
+		DeviceID:  h.deviceID,
+		ClientIP:  info.ClientIP,
+		Principal: operator,
+		Type:      "approval",
+		Query:     fmt.Sprintf("%s %s: %s", action, info.ID, normalizeQuery(info.Query)),
+		Outcome:   action,
+		Error:     detail,
+	}
+	if err := h.auditLogger.Log(record); err != nil {
+		log.Printf("[server] Failed to write audit record: %v", err)
+	}
+}
+
+// handleApproval lists the requests waiting for approval, or approves or
+// rejects one of them. Approvals need a second operator: the identity that
+// sent a held request cannot approve it.
+func (h *Handler) handleApproval(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	var approval approvalRequest
+	if err := json.Unmarshal([]byte(req.Query), &approval); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("invalid approval request: %v", err)})
+		return
+	}
+	operator := operatorIdentity(msg, req)
+
+	switch approval.Action {
+	case "list":
+		pending := h.approvals.List()
+		rows := make([][]interface{}, 0, len(pending))
+		for _, info := range pending {
+			findings, _ := json.Marshal(nonNil(info.Errors))
+			rows = append(rows, []interface{}{
+				info.ID, info.Principal, info.OnBehalfOf, info.ClientIP, info.Query, info.Params,
+				info.DetectedCommand, info.Risk, string(findings),
+				info.SubmittedAt.UTC().Format(time.RFC3339), info.ExpiresAt.UTC().Format(time.RFC3339),
+			})
+		}
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Columns: []string{"id", "principal", "on_behalf_of", "client_ip", "query", "params",
+				"detected_command", "risk", "errors", "submitted_at", "expires_at"},
+			Rows: rows,
+		})
+
+	case "approve":
+		info, err := h.approvals.Approve(approval.ID, operator)
+		if err != nil {
+			resp := RPCResponse{Error: fmt.Sprintf("approval failed: %v", err)}
+			var denied *approvalError
+			if errors.As(err, &denied) {
+				resp.ErrorCode = ErrApprovalDenied
+				h.auditApproval("deny", info, operator, err.Error())
+			}
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, resp)
+			return
+		}
+		h.auditApproval("approve", info, operator, approval.Reason)
+		log.Printf("[server] Request %s approved by %s", approval.ID, operator)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Columns: []string{"id", "status"},
+			Rows:    [][]interface{}{{approval.ID, "approved"}},
+		})
+
+	case "reject":
+		info, err := h.approvals.Reject(approval.ID, approval.Reason)
+		if err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("rejection failed: %v", err)})
+			return
+		}
+		h.auditApproval("reject", info, operator, approval.Reason)
+		log.Printf("[server] Request %s rejected by %s: %s", approval.ID, operator, approval.Reason)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Columns: []string{"id", "status"},
+			Rows:    [][]interface{}{{approval.ID, "rejected"}},
+		})
+
+	default:
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error: fmt.Sprintf("unknown approval action %q (list, approve or reject)", approval.Action),
+		})
+	}
+}
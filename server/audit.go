@@ -0,0 +1,367 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditRecord describes a single processed request for compliance logging.
+type AuditRecord struct {
+	Timestamp     time.Time     `json:"timestamp"`                // When the request was received
+	DeviceID      string        `json:"device_id"`                // Device that processed the request
+	ClientIP      string        `json:"client_ip"`                // Client reported IP address
+	Principal     string        `json:"principal,omitempty"`      // Authenticated AMQP user (message user_id)
+	OnBehalfOf    string        `json:"on_behalf_of,omitempty"`   // End user the request ran for
+	Type          string        `json:"type"`                     // Request type (sql, function, command, transaction)
+	Query         string        `json:"query"`                    // Normalized query, function call or command
+	Params        []interface{} `json:"params,omitempty"`         // Query parameters (possibly redacted)
+	TransactionID string        `json:"transaction_id,omitempty"` // Transaction the request belonged to
+	Priority      string        `json:"priority,omitempty"`       // Request priority
+	Tag           string        `json:"tag,omitempty"`            // Client label for cross-system correlation
+	Duration      time.Duration `json:"duration_ns"`              // Processing time
+	RowCount      int           `json:"row_count"`                // Number of rows returned
+	Outcome       string        `json:"outcome"`                  // "success" or "error"
+	Error         string        `json:"error,omitempty"`          // Error message when Outcome is "error"
+}
+
+// AuditLogger receives an AuditRecord for every processed request.
+// Implementations must be safe for concurrent use.
+type AuditLogger interface {
+	Log(record AuditRecord) error
+	Close() error
+}
+
+// AuditConfig holds configuration for the audit log subsystem.
+type AuditConfig struct {
+	Enabled      bool          // Whether auditing is enabled
+	Backend      string        // "file", "syslog", "db" or "storage"
+	FilePath     string        // Output file for the "file" backend ("-" for stdout)
+	SyslogTag    string        // Tag for the "syslog" backend
+	Table        string        // Table name for the "db" backend
+	RedactParams bool          // Replace parameter values with a placeholder
+	Retention    time.Duration // How long the "storage" backend keeps records (0 = forever)
+}
+
+// DefaultAuditConfig returns a disabled audit configuration with sensible defaults.
+func DefaultAuditConfig() AuditConfig {
+	return AuditConfig{
+		Enabled:      false,
+		Backend:      "file",
+		FilePath:     "burrowctl-audit.log",
+		SyslogTag:    "burrowctl",
+		Table:        "burrowctl_audit",
+		RedactParams: true,
+		Retention:    7 * 24 * time.Hour,
+	}
+}
+
+// redactedValue replaces parameter values when AuditConfig.RedactParams is set.
+const redactedValue = "[REDACTED]"
+
+// NewAuditLogger creates the AuditLogger selected by config.Backend.
+//
+// Parameters:
+//   - config: Audit configuration
+//   - mysqlDSN: Database DSN used by the "db" backend
+//
+// Returns:
+//   - AuditLogger: The configured logger
+//   - error: Any error that occurred while opening the backend
+func NewAuditLogger(config AuditConfig, mysqlDSN string) (AuditLogger, error) {
+	var (
+		logger AuditLogger
+		err    error
+	)
+
+	switch config.Backend {
+	case "", "file":
+		var fileLogger *FileAuditLogger
+		fileLogger, err = NewFileAuditLogger(config.FilePath)
+		logger = fileLogger
+	case "syslog":
+		var syslogLogger *SyslogAuditLogger
+		syslogLogger, err = NewSyslogAuditLogger(config.SyslogTag)
+		logger = syslogLogger
+	case "db":
+		var dbLogger *DBAuditLogger
+		dbLogger, err = NewDBAuditLogger(mysqlDSN, config.Table)
+		logger = dbLogger
+	default:
+		err = fmt.Errorf("unknown audit backend: %s", config.Backend)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+	return logger, nil
+}
+
+// FileAuditLogger writes one JSON document per line to a file.
+type FileAuditLogger struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// NewFileAuditLogger opens (or creates) path in append mode. Use "-" for stdout.
+func NewFileAuditLogger(path string) (*FileAuditLogger, error) {
+	if path == "-" {
+		return &FileAuditLogger{file: os.Stdout}, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit log %s: %w", path, err)
+	}
+	return &FileAuditLogger{file: file}, nil
+}
+
+// Log appends the record as a JSON line.
+func (l *FileAuditLogger) Log(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	_, err = l.file.Write(append(line, '\n'))
+	return err
+}
+
+// Close closes the underlying file.
+func (l *FileAuditLogger) Close() error {
+	if l.file == os.Stdout {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// DBAuditLogger stores audit records in a database table.
+type DBAuditLogger struct {
+	db    *sql.DB
+	table string
+}
+
+// NewDBAuditLogger opens a dedicated connection and creates the audit table if needed.
+func NewDBAuditLogger(mysqlDSN, table string) (*DBAuditLogger, error) {
+	if !identifierPattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid audit table name: %q", table)
+	}
+
+	db, err := sql.Open("mysql", mysqlDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit database: %w", err)
+	}
+	db.SetMaxOpenConns(2)
+	name := table
+	table = quoteIdentifier(table)
+
+	_, err = db.Exec(fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+		id BIGINT AUTO_INCREMENT PRIMARY KEY,
+		ts DATETIME(6) NOT NULL,
+		device_id VARCHAR(255) NOT NULL,
+		client_ip VARCHAR(64) NOT NULL,
+		principal VARCHAR(255) NULL,
+		on_behalf_of VARCHAR(255) NULL,
+		type VARCHAR(32) NOT NULL,
+		query TEXT NOT NULL,
+		params TEXT NULL,
+		transaction_id VARCHAR(128) NULL,
+		tag VARCHAR(128) NULL,
+		duration_ms DOUBLE NOT NULL,
+		row_count INT NOT NULL,
+		outcome VARCHAR(16) NOT NULL,
+		error TEXT NULL,
+		INDEX idx_ts (ts)
+	)`, table))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create audit table %s: %w", table, err)
+	}
+
+	// Tables created by earlier releases lack the tag column
+	var columns int
+	err = db.QueryRow(`SELECT COUNT(*) FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ? AND COLUMN_NAME = 'tag'`, name).Scan(&columns)
+	if err == nil && columns == 0 {
+		_, err = db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN tag VARCHAR(128) NULL AFTER transaction_id", table))
+	}
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to upgrade audit table %s: %w", table, err)
+	}
+
+	return &DBAuditLogger{db: db, table: table}, nil
+}
+
+// Log inserts the record into the audit table.
+func (l *DBAuditLogger) Log(record AuditRecord) error {
+	params, _ := json.Marshal(record.Params)
+
+	_, err := l.db.Exec(fmt.Sprintf(`INSERT INTO %s
+		(ts, device_id, client_ip, principal, on_behalf_of, type, query, params, transaction_id, tag, duration_ms, row_count, outcome, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, l.table),
+		record.Timestamp, record.DeviceID, record.ClientIP, record.Principal, record.OnBehalfOf,
+		record.Type, record.Query, string(params),
+		record.TransactionID, record.Tag, float64(record.Duration)/float64(time.Millisecond), record.RowCount,
+		record.Outcome, record.Error)
+	return err
+}
+
+// Close closes the dedicated database connection.
+func (l *DBAuditLogger) Close() error {
+	return l.db.Close()
+}
+
+// auditStorageNamespace is the Storage namespace of audit records
+const auditStorageNamespace = "audit"
+
+// StorageAuditLogger stores audit records as JSON in the shared Storage,
+// keyed by timestamp so List returns them in chronological order.
+type StorageAuditLogger struct {
+	storage   Storage
+	retention time.Duration
+	sequence  uint64
+	mutex     sync.Mutex
+}
+
+// NewStorageAuditLogger creates an audit logger writing to storage
+func NewStorageAuditLogger(storage Storage, retention time.Duration) *StorageAuditLogger {
+	return &StorageAuditLogger{storage: storage, retention: retention}
+}
+
+// Log stores the record until the retention period ends.
+func (l *StorageAuditLogger) Log(record AuditRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	l.sequence++
+	key := fmt.Sprintf("%s-%06d", record.Timestamp.UTC().Format("20060102T150405.000000000Z"), l.sequence%1000000)
+	l.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return l.storage.Put(ctx, auditStorageNamespace, key, value, l.retention)
+}
+
+// Close is a no-op; the storage is closed by the handler.
+func (l *StorageAuditLogger) Close() error {
+	return nil
+}
+
+// SetAuditLogger installs the logger that receives an AuditRecord for every request.
+// Pass nil to disable auditing.
+func (h *Handler) SetAuditLogger(logger AuditLogger) {
+	h.auditLogger = logger
+	if logger != nil {
+		log.Printf("[server] Audit logger configured: %T", logger)
+	}
+}
+
+// SetAuditConfig creates and installs an AuditLogger from configuration.
+func (h *Handler) SetAuditConfig(config AuditConfig) error {
+	if !config.Enabled {
+		h.auditLogger = nil
+		return nil
+	}
+
+	var logger AuditLogger
+	if config.Backend == "storage" {
+		if h.storage == nil {
+			return fmt.Errorf("the storage audit backend needs a configured storage")
+		}
+		logger = NewStorageAuditLogger(h.storage, config.Retention)
+	} else {
+		var err error
+		if logger, err = NewAuditLogger(config, h.mysqlDSN); err != nil {
+			return err
+		}
+	}
+
+	h.auditLogger = logger
+	h.auditRedactParams = config.RedactParams
+	log.Printf("[server] Audit logging enabled: backend=%s redact=%v", config.Backend, config.RedactParams)
+	return nil
+}
+
+// beginAudit starts tracking a request so its outcome can be audited once the
+// response is sent. It returns nil when auditing is disabled.
+func (h *Handler) beginAudit(corrID, principal string, req RPCRequest, start time.Time) *AuditRecord {
+	if h.auditLogger == nil {
+		return nil
+	}
+
+	record := &AuditRecord{
+		Timestamp:     start,
+		DeviceID:      h.deviceID,
+		ClientIP:      req.ClientIP,
+		Principal:     principal,
+		OnBehalfOf:    req.OnBehalfOf,
+		Type:          req.Type,
+		Query:         normalizeQuery(req.Query),
+		TransactionID: req.TransactionID,
+		Priority:      req.Priority,
+		Tag:           req.Tag,
+	}
+	if req.Type == "transaction" {
+		record.Query = req.Command
+	}
+	if req.Type == "file.get" || req.Type == "file.put" {
+		record.Query = fileAuditQuery(req)
+	}
+
+	record.Params = req.Params
+	if h.auditRedactParams && len(req.Params) > 0 {
+		record.Params = make([]interface{}, len(req.Params))
+		for i := range record.Params {
+			record.Params[i] = redactedValue
+		}
+	}
+
+	h.auditInFlight.Store(corrID, record)
+	return record
+}
+
+// recordAuditResponse attaches the outcome of a response to the in-flight audit record.
+func (h *Handler) recordAuditResponse(corrID string, resp *RPCResponse) {
+	value, ok := h.auditInFlight.Load(corrID)
+	if !ok {
+		return
+	}
+
+	record := value.(*AuditRecord)
+	record.RowCount = resp.rowCount()
+	if resp.Error != "" {
+		record.Outcome = "error"
+		record.Error = resp.Error
+	} else {
+		record.Outcome = "success"
+	}
+}
+
+// finishAudit writes the audit record for a completed request.
+func (h *Handler) finishAudit(corrID string, record *AuditRecord) {
+	if record == nil {
+		return
+	}
+	h.auditInFlight.Delete(corrID)
+
+	record.Duration = time.Since(record.Timestamp)
+	if record.Outcome == "" {
+		record.Outcome = "no_response"
+	}
+
+	if err := h.auditLogger.Log(*record); err != nil {
+		log.Printf("[server] Failed to write audit record: %v", err)
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !windows && !plan9
+
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/syslog"
+)
+
+// SyslogAuditLogger sends audit records to the local syslog daemon as JSON.
+type SyslogAuditLogger struct {
+	writer *syslog.Writer
+}
+
+// NewSyslogAuditLogger connects to the local syslog daemon using the given tag.
+func NewSyslogAuditLogger(tag string) (*SyslogAuditLogger, error) {
+	writer, err := syslog.New(syslog.LOG_INFO|syslog.LOG_AUTHPRIV, tag)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to syslog: %w", err)
+	}
+	return &SyslogAuditLogger{writer: writer}, nil
+}
+
+// Log writes the record at info level, or warning level for failed requests.
+func (l *SyslogAuditLogger) Log(record AuditRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	if record.Outcome == "error" {
+		return l.writer.Warning(string(line))
+	}
+	return l.writer.Info(string(line))
+}
+
+// Close closes the syslog connection.
+func (l *SyslogAuditLogger) Close() error {
+	return l.writer.Close()
+}
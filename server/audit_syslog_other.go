@@ -0,0 +1,19 @@
+//go:build windows || plan9
+
+package server
+
+import "errors"
+
+// SyslogAuditLogger is not available on this platform.
+type SyslogAuditLogger struct{}
+
+// NewSyslogAuditLogger always fails on platforms without syslog.
+func NewSyslogAuditLogger(tag string) (*SyslogAuditLogger, error) {
+	return nil, errors.New("syslog audit backend is not supported on this platform")
+}
+
+// Log implements AuditLogger.
+func (l *SyslogAuditLogger) Log(record AuditRecord) error { return nil }
+
+// Close implements AuditLogger.
+func (l *SyslogAuditLogger) Close() error { return nil }
@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// BulkInsertRequest is the query of a "bulk" request. The row values travel
+// as the request parameters, row after row.
+type BulkInsertRequest struct {
+	Table   string   `json:"table"`
+	Columns []string `json:"columns"`
+}
+
+// Limits of a single multi-row INSERT statement
+const (
+	maxPlaceholders       = 65535           // MySQL limit of prepared statement parameters
+	defaultAllowedPacket  = 4 * 1024 * 1024 // max_allowed_packet assumed when it cannot be read
+	bulkInsertTimeout     = 60 * time.Second
+	bulkPacketHeadroomPct = 75 // Share of max_allowed_packet a statement may use
+)
+
+// maxAllowedPacket returns the server's max_allowed_packet, read once
+func (h *Handler) maxAllowedPacket(ctx context.Context, db *sql.DB) int64 {
+	if packet := atomic.LoadInt64(&h.allowedPacket); packet > 0 {
+		return packet
+	}
+
+	var packet int64
+	if err := db.QueryRowContext(ctx, "SELECT @@max_allowed_packet").Scan(&packet); err != nil || packet <= 0 {
+		log.Printf("[server] Failed to read max_allowed_packet, assuming %d bytes: %v", defaultAllowedPacket, err)
+		return defaultAllowedPacket
+	}
+	atomic.StoreInt64(&h.allowedPacket, packet)
+	return packet
+}
+
+// bulkValueSize estimates the bytes a parameter takes in an execute packet
+func bulkValueSize(value interface{}) int {
+	switch v := value.(type) {
+	case nil:
+		return 1
+	case string:
+		return len(v) + 9
+	case []byte:
+		return len(v) + 9
+	}
+	return 9
+}
+
+// bulkStatements splits rows into multi-row INSERT statements that fit in
+// the given packet size and the placeholder limit. It returns the number of
+// rows of each statement.
+func bulkStatements(columns int, params []interface{}, prefixLen int, packet int64) []int {
+	budget := packet * bulkPacketHeadroomPct / 100
+	rowPlaceholders := 2*columns + 2 // "(?,?)," per row
+	maxRows := maxPlaceholders / columns
+
+	var (
+		chunks []int
+		rows   int
+		size   = int64(prefixLen)
+	)
+	for start := 0; start < len(params); start += columns {
+		rowSize := int64(rowPlaceholders)
+		for _, value := range params[start : start+columns] {
+			rowSize += int64(bulkValueSize(value))
+		}
+		if rows > 0 && (size+rowSize > budget || rows >= maxRows) {
+			chunks = append(chunks, rows)
+			rows, size = 0, int64(prefixLen)
+		}
+		rows++
+		size += rowSize
+	}
+	if rows > 0 {
+		chunks = append(chunks, rows)
+	}
+	return chunks
+}
+
+// handleBulkInsert inserts the rows of a "bulk" request with multi-row
+// INSERT statements. The statements run in the request's transaction, or in
+// a transaction of their own, so the request inserts all of its rows or none.
+func (h *Handler) handleBulkInsert(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	var bulk BulkInsertRequest
+	if err := json.Unmarshal([]byte(req.Query), &bulk); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("invalid bulk insert request: %v", err)})
+		return
+	}
+
+	if !identifierPattern.MatchString(bulk.Table) {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("invalid table name: %s", bulk.Table)})
+		return
+	}
+	if len(bulk.Columns) == 0 {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "bulk insert needs at least one column"})
+		return
+	}
+	quoted := make([]string, len(bulk.Columns))
+	for i, column := range bulk.Columns {
+		if !identifierPattern.MatchString(column) || strings.Contains(column, ".") {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("invalid column name: %s", column)})
+			return
+		}
+		quoted[i] = quoteIdentifier(column)
+	}
+	if len(req.Params) == 0 || len(req.Params)%len(bulk.Columns) != 0 {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error: fmt.Sprintf("bulk insert has %d values, not a multiple of its %d columns", len(req.Params), len(bulk.Columns)),
+		})
+		return
+	}
+
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdentifier(bulk.Table), strings.Join(quoted, ", "))
+	rowPlaceholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(bulk.Columns)), ", ") + ")"
+
+	// Validate a single-row statement: the policy applies to the shape of the
+	// statement, while its length grows with the rows
+	validationResult := h.sqlValidator.ValidateQuery(prefix+rowPlaceholders, req.Params[:len(bulk.Columns)])
+	if !validationResult.Valid {
+		log.Printf("[server] SQL validation blocked bulk insert into %s from %s (risk: %s)",
+			bulk.Table, req.ClientIP, validationResult.Risk)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, validationFailedResponse(validationResult))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), bulkInsertTimeout)
+	defer cancel()
+
+	db, release, err := h.acquireDB()
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+		return
+	}
+	defer release()
+
+	var tx *sql.Tx
+	if req.TransactionID != "" {
+		transaction, lookupErr := h.transactionManager.LookupTransaction(req.TransactionID)
+		if lookupErr != nil {
+			h.respondError(ch, msg, lookupErr)
+			return
+		}
+		tx = transaction.Tx
+	} else {
+		if tx, err = db.BeginTx(ctx, nil); err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+			return
+		}
+		defer tx.Rollback()
+	}
+
+	start := time.Now()
+	statements := bulkStatements(len(bulk.Columns), req.Params, len(prefix), h.maxAllowedPacket(ctx, db))
+	var inserted int64
+	offset := 0
+	for _, rows := range statements {
+		placeholders := strings.TrimSuffix(strings.Repeat(rowPlaceholders+", ", rows), ", ")
+		params := req.Params[offset : offset+rows*len(bulk.Columns)]
+		result, err := tx.ExecContext(ctx, prefix+placeholders, params...)
+		if err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+				Error: fmt.Sprintf("bulk insert failed after %d rows: %v", inserted, err),
+			})
+			return
+		}
+		affected, _ := result.RowsAffected()
+		inserted += affected
+		offset += len(params)
+	}
+
+	if req.TransactionID == "" {
+		if err := tx.Commit(); err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("bulk insert commit failed: %v", err)})
+			return
+		}
+	}
+
+	log.Printf("[server] Bulk insert into %s: %d rows in %d statements (%v)", bulk.Table, inserted, len(statements), time.Since(start))
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"rows_affected", "statements"},
+		Rows:    [][]interface{}{{inserted, len(statements)}},
+	})
+}
@@ -0,0 +1,372 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CDC operations captured by triggers
+var cdcOperations = map[string]string{
+	"insert": "INSERT",
+	"update": "UPDATE",
+	"delete": "DELETE",
+}
+
+// CDCTable declares a table whose row changes are published
+type CDCTable struct {
+	Table      string   `json:"table"`      // Table to watch (optionally schema.table)
+	Columns    []string `json:"columns"`    // Columns included in change events, e.g. the primary key
+	Operations []string `json:"operations"` // "insert", "update" and/or "delete" (default all)
+}
+
+// CDCConfig holds configuration for change data capture
+type CDCConfig struct {
+	Enabled         bool       `json:"enabled"`          // Whether changes are captured and published
+	Tables          []CDCTable `json:"tables"`           // Watched tables
+	ChangelogTable  string     `json:"changelog_table"`  // Table the triggers write changes to
+	InstallTriggers bool       `json:"install_triggers"` // Create the changelog table and triggers at startup
+	PollInterval    Duration   `json:"poll_interval"`    // How often the changelog is read
+	BatchSize       int        `json:"batch_size"`       // Changes published per poll
+}
+
+// DefaultCDCConfig returns a disabled change data capture configuration
+func DefaultCDCConfig() CDCConfig {
+	return CDCConfig{
+		Enabled:         false,
+		ChangelogTable:  "burrowctl_changes",
+		InstallTriggers: true,
+		PollInterval:    Duration(1 * time.Second),
+		BatchSize:       500,
+	}
+}
+
+// LoadCDCConfig reads a change data capture configuration from a JSON file.
+//
+// Example:
+//
+//	{
+//	  "enabled": true,
+//	  "poll_interval": "500ms",
+//	  "tables": [
+//	    {"table": "users", "columns": ["id", "email"]},
+//	    {"table": "orders", "columns": ["id", "status"], "operations": ["insert", "update"]}
+//	  ]
+//	}
+func LoadCDCConfig(path string) (CDCConfig, error) {
+	config := DefaultCDCConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read CDC config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse CDC config %s: %w", path, err)
+	}
+	return config, config.Validate()
+}
+
+// cdcChannel returns the event channel changes of table are published on
+func cdcChannel(table string) string {
+	return "table:" + table + ":changed"
+}
+
+// cdcTriggerName returns the name of the trigger capturing op on table
+func cdcTriggerName(table, op string) string {
+	return "burrowctl_cdc_" + strings.ReplaceAll(table, ".", "_") + "_" + op
+}
+
+// Validate checks tables, columns and operations
+func (cc CDCConfig) Validate() error {
+	if !identifierPattern.MatchString(cc.ChangelogTable) {
+		return fmt.Errorf("CDC: invalid changelog table %q", cc.ChangelogTable)
+	}
+	for i, table := range cc.Tables {
+		if !identifierPattern.MatchString(table.Table) || !eventChannelPattern.MatchString(cdcChannel(table.Table)) {
+			return fmt.Errorf("CDC table %d: invalid table name %q", i, table.Table)
+		}
+		if len(table.Columns) == 0 {
+			return fmt.Errorf("CDC table %s: at least one column is required", table.Table)
+		}
+		for _, column := range table.Columns {
+			if !identifierPattern.MatchString(column) || strings.Contains(column, ".") {
+				return fmt.Errorf("CDC table %s: invalid column %q", table.Table, column)
+			}
+		}
+		for _, op := range table.Operations {
+			if _, ok := cdcOperations[op]; !ok {
+				return fmt.Errorf("CDC table %s: unknown operation %q", table.Table, op)
+			}
+		}
+		if name := cdcTriggerName(table.Table, "delete"); len(name) > 64 {
+			return fmt.Errorf("CDC table %s: trigger name %s exceeds 64 characters", table.Table, name)
+		}
+	}
+	return nil
+}
+
+// CDCChange is the data of a row-change event
+type CDCChange struct {
+	ID        int64           `json:"id"`        // Position in the changelog
+	Table     string          `json:"table"`     // Changed table
+	Operation string          `json:"operation"` // "insert", "update" or "delete"
+	Row       json.RawMessage `json:"row"`       // Configured columns (old values for deletes)
+	ChangedAt time.Time       `json:"changedAt"`
+}
+
+// CDCStatus reports the state of change data capture
+type CDCStatus struct {
+	Enabled      bool      `json:"enabled"`
+	Ready        bool      `json:"ready"` // Changelog and triggers are in place
+	Tables       []string  `json:"tables"`
+	LastChangeID int64     `json:"last_change_id"`
+	Published    int64     `json:"published"`
+	LastPoll     time.Time `json:"last_poll"`
+	LastError    string    `json:"last_error,omitempty"`
+	LastErrorAt  time.Time `json:"last_error_at,omitempty"`
+}
+
+// CDCManager captures row changes with triggers that write to a changelog
+// table and publishes them as "table:<name>:changed" events. Changes are
+// read in order and removed from the changelog once published.
+type CDCManager struct {
+	handler *Handler
+	config  CDCConfig
+
+	mutex  sync.Mutex
+	status CDCStatus
+}
+
+// NewCDCManager creates a new change data capture manager
+func NewCDCManager(handler *Handler, config CDCConfig) *CDCManager {
+	defaults := DefaultCDCConfig()
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+
+	tables := make([]string, 0, len(config.Tables))
+	for _, table := range config.Tables {
+		tables = append(tables, table.Table)
+	}
+	return &CDCManager{
+		handler: handler,
+		config:  config,
+		status:  CDCStatus{Enabled: config.Enabled, Tables: tables},
+	}
+}
+
+// run sets up the triggers and publishes changes until ctx is cancelled
+func (cm *CDCManager) run(ctx context.Context) {
+	if !cm.config.Enabled || len(cm.config.Tables) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(cm.config.PollInterval))
+	defer ticker.Stop()
+
+	log.Printf("[cdc] Started for %d tables (poll every %v)", len(cm.config.Tables), time.Duration(cm.config.PollInterval))
+
+	ready := false
+	for {
+		if !ready {
+			if err := cm.setup(ctx); err != nil {
+				cm.recordError(err)
+				log.Printf("[cdc] Setup failed, retrying: %v", err)
+			} else {
+				ready = true
+			}
+		} else if err := cm.poll(ctx); err != nil {
+			cm.recordError(err)
+			log.Printf("[cdc] Poll failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// setup creates the changelog table and triggers, then skips the changes
+// made while the server was down since nobody can be subscribed to them
+func (cm *CDCManager) setup(ctx context.Context) error {
+	db, release, err := cm.handler.acquireDB()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	changelog := quoteIdentifier(cm.config.ChangelogTable)
+	if cm.config.InstallTriggers {
+		statements := []string{fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s ("+
+			"id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY, "+
+			"table_name VARCHAR(128) NOT NULL, "+
+			"op VARCHAR(6) NOT NULL, "+
+			"row_data TEXT NULL, "+
+			"changed_at TIMESTAMP(6) NOT NULL DEFAULT CURRENT_TIMESTAMP(6))", changelog)}
+		for _, table := range cm.config.Tables {
+			statements = append(statements, cm.triggerStatements(table)...)
+		}
+		for _, statement := range statements {
+			if _, err := db.ExecContext(ctx, statement); err != nil {
+				return fmt.Errorf("%w (statement: %s)", err, truncateQuery(statement, 120))
+			}
+		}
+	}
+
+	var lastID sql.NullInt64
+	if err := db.QueryRowContext(ctx, "SELECT MAX(id) FROM "+changelog).Scan(&lastID); err != nil {
+		return err
+	}
+	if lastID.Valid {
+		if _, err := db.ExecContext(ctx, "DELETE FROM "+changelog+" WHERE id <= ?", lastID.Int64); err != nil {
+			return err
+		}
+	}
+
+	cm.mutex.Lock()
+	cm.status.Ready = true
+	cm.status.LastChangeID = lastID.Int64
+	cm.mutex.Unlock()
+
+	log.Printf("[cdc] Capturing changes of %d tables into %s", len(cm.config.Tables), cm.config.ChangelogTable)
+	return nil
+}
+
+// triggerStatements returns the statements (re)creating the triggers of a table
+func (cm *CDCManager) triggerStatements(table CDCTable) []string {
+	operations := table.Operations
+	if len(operations) == 0 {
+		operations = []string{"insert", "update", "delete"}
+	}
+
+	var statements []string
+	for _, op := range operations {
+		row := "NEW"
+		if op == "delete" {
+			row = "OLD"
+		}
+		pairs := make([]string, 0, len(table.Columns))
+		for _, column := range table.Columns {
+			pairs = append(pairs, fmt.Sprintf("'%s', %s.`%s`", column, row, column))
+		}
+
+		name := "`" + cdcTriggerName(table.Table, op) + "`"
+		statements = append(statements,
+			"DROP TRIGGER IF EXISTS "+name,
+			fmt.Sprintf("CREATE TRIGGER %s AFTER %s ON %s FOR EACH ROW "+
+				"INSERT INTO %s (table_name, op, row_data) VALUES ('%s', '%s', JSON_OBJECT(%s))",
+				name, cdcOperations[op], quoteIdentifier(table.Table),
+				quoteIdentifier(cm.config.ChangelogTable), table.Table, op, strings.Join(pairs, ", ")))
+	}
+	return statements
+}
+
+// poll publishes the next batch of changes and removes them from the changelog
+func (cm *CDCManager) poll(ctx context.Context) error {
+	db, release, err := cm.handler.acquireDB()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	cm.mutex.Lock()
+	lastID := cm.status.LastChangeID
+	cm.status.LastPoll = time.Now()
+	cm.mutex.Unlock()
+
+	changelog := quoteIdentifier(cm.config.ChangelogTable)
+	rows, err := db.QueryContext(ctx, "SELECT id, table_name, op, row_data, UNIX_TIMESTAMP(changed_at) FROM "+
+		changelog+" WHERE id > ? ORDER BY id LIMIT ?", lastID, cm.config.BatchSize)
+	if err != nil {
+		return err
+	}
+
+	var changes []CDCChange
+	for rows.Next() {
+		var change CDCChange
+		var row sql.NullString
+		var changedAt float64
+		if err := rows.Scan(&change.ID, &change.Table, &change.Operation, &row, &changedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		change.Row = json.RawMessage("null")
+		if row.Valid {
+			change.Row = json.RawMessage(row.String)
+		}
+		change.ChangedAt = time.Unix(0, int64(changedAt*float64(time.Second)))
+		changes = append(changes, change)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	published := 0
+	for _, change := range changes {
+		if err := cm.handler.PublishEvent(cdcChannel(change.Table), change); err != nil {
+			break
+		}
+		published++
+	}
+	if published == 0 {
+		if len(changes) > 0 {
+			return fmt.Errorf("failed to publish %d changes", len(changes))
+		}
+		return nil
+	}
+
+	lastID = changes[published-1].ID
+	if _, err := db.ExecContext(ctx, "DELETE FROM "+changelog+" WHERE id <= ?", lastID); err != nil {
+		return err
+	}
+
+	cm.mutex.Lock()
+	cm.status.LastChangeID = lastID
+	cm.status.Published += int64(published)
+	cm.mutex.Unlock()
+	return nil
+}
+
+// recordError stores the last error for getCDCStatus
+func (cm *CDCManager) recordError(err error) {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	cm.status.LastError = err.Error()
+	cm.status.LastErrorAt = time.Now()
+}
+
+// Status returns a snapshot of the capture state
+func (cm *CDCManager) Status() CDCStatus {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+	return cm.status
+}
+
+// SetCDCConfig configures change data capture and registers the
+// getCDCStatus function.
+func (h *Handler) SetCDCConfig(config CDCConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	h.cdc = NewCDCManager(h, config)
+
+	h.RegisterFunctionWithMetadata("getCDCStatus", func() CDCStatus {
+		return h.cdc.Status()
+	}, FunctionMetadata{Description: "Returns the change data capture position and counters"})
+
+	log.Printf("[server] CDC configured: %d tables, enabled=%v", len(config.Tables), config.Enabled)
+	return nil
+}
@@ -0,0 +1,177 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// directReplyTo is RabbitMQ's pseudo-queue for answers sent straight to the
+// consumer on the publishing channel
+const directReplyTo = "amq.rabbitmq.reply-to"
+
+// RegisterPingQueue records the queue a client answers server pings on, so
+// the server keeps track of it even when it sends no PINGs of its own. It
+// reports whether the client will be pinged: server pings must be enabled
+// and the client must identify itself.
+func (shm *ServerHeartbeatManager) RegisterPingQueue(clientID, clientIP, pingQueue string) bool {
+	if !shm.config.Enabled || !shm.config.ServerPings || clientID == "" || pingQueue == "" {
+		return false
+	}
+
+	shm.mutex.Lock()
+	client := shm.clients.touch(clientID, func() *ClientHeartbeatInfo {
+		return &ClientHeartbeatInfo{
+			ClientID: clientID,
+			DeviceID: shm.deviceID,
+		}
+	})
+	if clientIP != "" {
+		client.ClientIP = clientIP
+	}
+	client.PingQueue = pingQueue
+	client.MissedPings = 0
+	client.LastSeen = shm.clock.Now()
+	client.IsActive = true
+	shm.mutex.Unlock()
+
+	log.Printf("[server-heartbeat] Client %s (%s) registered for server pings on %s", clientID, clientIP, pingQueue)
+	return true
+}
+
+// runPings pings the registered clients every PingInterval on a channel of
+// conn and records their answers, until ctx is done, the manager stops or
+// the channel closes. Answers come back through direct reply-to; pings the
+// broker returns because the client's queue is gone end the client's pings
+// at once.
+func (shm *ServerHeartbeatManager) runPings(ctx context.Context, conn *amqp.Connection) error {
+	ch, err := conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	pongs, err := ch.Consume(directReplyTo, "", true, false, false, false, nil)
+	if err != nil {
+		return err
+	}
+	returns := ch.NotifyReturn(make(chan amqp.Return, 16))
+
+	interval := shm.config.PingInterval
+	if interval <= 0 {
+		interval = DefaultServerHeartbeatConfig().PingInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	log.Printf("[server-heartbeat] Pinging registered clients every %v", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-shm.stopChan:
+			return nil
+		case pong, ok := <-pongs:
+			if !ok {
+				return nil
+			}
+			shm.handleClientPong(pong.CorrelationId)
+		case ret, ok := <-returns:
+			if !ok {
+				return nil
+			}
+			shm.dropPingQueue(ret.CorrelationId, "ping queue is gone")
+		case <-ticker.C:
+			shm.pingClients(ctx, ch)
+		}
+	}
+}
+
+// pingClients sends a ping to every registered client. Clients that left
+// MaxMissedPings pings unanswered are no longer pinged; their record ages
+// out like that of a client whose PINGs stopped.
+func (shm *ServerHeartbeatManager) pingClients(ctx context.Context, ch *amqp.Channel) {
+	type target struct{ identity, queue string }
+	var targets []target
+	var gone []string
+
+	shm.mutex.Lock()
+	shm.clients.each(func(client *ClientHeartbeatInfo) {
+		if client.PingQueue == "" {
+			return
+		}
+		if shm.config.MaxMissedPings > 0 && client.MissedPings >= shm.config.MaxMissedPings {
+			gone = append(gone, client.identity())
+			return
+		}
+		client.MissedPings++
+		targets = append(targets, target{client.identity(), client.PingQueue})
+	})
+	shm.mutex.Unlock()
+
+	for _, identity := range gone {
+		shm.dropPingQueue(identity, "pings unanswered")
+	}
+
+	now := shm.clock.Now()
+	body, _ := json.Marshal(map[string]interface{}{
+		"type":        "server_ping",
+		"deviceID":    shm.deviceID,
+		"timestamp":   now.Unix(),
+		"timestampMs": now.UnixMilli(),
+	})
+	for _, t := range targets {
+		err := ch.PublishWithContext(ctx, "", t.queue, true, false, amqp.Publishing{
+			ContentType:   "application/json",
+			CorrelationId: t.identity,
+			ReplyTo:       directReplyTo,
+			Expiration:    durationMillis(shm.config.PingInterval),
+			Body:          body,
+		})
+		if err != nil {
+			log.Printf("[server-heartbeat] Failed to ping client %s: %v", t.identity, err)
+		}
+	}
+}
+
+// handleClientPong records a client's answer to a server ping
+func (shm *ServerHeartbeatManager) handleClientPong(identity string) {
+	shm.mutex.Lock()
+	defer shm.mutex.Unlock()
+
+	if shm.clients.get(identity) == nil {
+		return
+	}
+	// Touch keeps the records ordered by when they were last seen
+	client := shm.clients.touch(identity, nil)
+	client.LastSeen = shm.clock.Now()
+	client.MissedPings = 0
+	client.IsActive = true
+	shm.totalPongs++
+}
+
+// dropPingQueue stops pinging a client
+func (shm *ServerHeartbeatManager) dropPingQueue(identity, reason string) {
+	shm.mutex.Lock()
+	client := shm.clients.get(identity)
+	if client == nil || client.PingQueue == "" {
+		shm.mutex.Unlock()
+		return
+	}
+	client.PingQueue = ""
+	shm.mutex.Unlock()
+
+	log.Printf("[server-heartbeat] Stopped pinging client %s: %s", identity, reason)
+}
+
+// durationMillis formats d as an AMQP expiration in milliseconds
+func durationMillis(d time.Duration) string {
+	if d < time.Millisecond {
+		d = time.Millisecond
+	}
+	return strconv.FormatInt(d.Milliseconds(), 10)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lordbasex/burrowctl/clock/clocktest"
+)
+
+func TestHeartbeatExpiry(t *testing.T) {
+	fake := clocktest.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	config := DefaultServerHeartbeatConfig()
+	config.MaxClientAge = time.Minute
+	shm := NewServerHeartbeatManager("device-1", config)
+	shm.SetClock(fake)
+
+	shm.recordPing("client-1", "10.0.0.1")
+	fake.Advance(time.Minute)
+	if !shm.IsClientActive("client-1") {
+		t.Fatal("client inactive at exactly the max client age")
+	}
+
+	// A new PING restarts the age
+	shm.recordPing("client-1", "10.0.0.1")
+	fake.Advance(59 * time.Second)
+	if !shm.IsClientActive("client-1") {
+		t.Fatal("client inactive within the max client age of its last PING")
+	}
+
+	fake.Advance(2 * time.Second)
+	if shm.IsClientActive("client-1") {
+		t.Fatal("client still active past the max client age")
+	}
+	if stats := shm.GetStats(); stats.ActiveClients != 0 || stats.TotalClients != 1 {
+		t.Fatalf("expired client counted: active=%d total=%d", stats.ActiveClients, stats.TotalClients)
+	}
+
+	shm.cleanupStaleConnections()
+	if stats := shm.GetStats(); stats.TotalClients != 0 || stats.Expirations != 1 {
+		t.Fatalf("cleanup left total=%d expirations=%d", stats.TotalClients, stats.Expirations)
+	}
+}
+
+func TestSchedulerRunsDueTasks(t *testing.T) {
+	fake := clocktest.NewFake(time.Date(2024, 1, 1, 10, 7, 30, 0, time.UTC))
+	h := NewHandler("scheduler-test", "", "", "open", nil)
+	t.Cleanup(func() { h.rateLimiter.Stop() })
+	h.SetClock(fake)
+
+	release := make(chan struct{})
+	h.RegisterFunction("rollup", func() string {
+		<-release
+		return "done"
+	})
+	err := h.SetSchedulerConfig(SchedulerConfig{Tasks: []ScheduledTask{
+		{Name: "rollup", Schedule: "*/15 * * * *", Function: "rollup"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := h.scheduler
+	ctx := context.Background()
+
+	assertNextRun(t, s, time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC))
+
+	// Not due yet
+	fake.Advance(7 * time.Minute)
+	s.startDue(ctx, fake.Now())
+	if status := s.Status("rollup")[0]; status.Running || len(status.History) != 0 {
+		t.Fatalf("task started before it was due: %+v", status)
+	}
+
+	fake.Set(time.Date(2024, 1, 1, 10, 15, 0, 0, time.UTC))
+	s.startDue(ctx, fake.Now())
+	assertNextRun(t, s, time.Date(2024, 1, 1, 10, 30, 0, 0, time.UTC))
+	if !s.Status("rollup")[0].Running {
+		t.Fatal("due task was not started")
+	}
+
+	// Still running at the next occurrence: skipped
+	fake.Advance(15 * time.Minute)
+	s.startDue(ctx, fake.Now())
+	status := s.Status("rollup")[0]
+	if len(status.History) != 1 || status.History[0].Status != "skipped" || !status.History[0].StartedAt.Equal(fake.Now()) {
+		t.Fatalf("overlapping occurrence not recorded as skipped: %+v", status.History)
+	}
+	assertNextRun(t, s, time.Date(2024, 1, 1, 10, 45, 0, 0, time.UTC))
+
+	fake.Advance(90 * time.Second)
+	close(release)
+	deadline := time.Now().Add(5 * time.Second)
+	for s.Status("rollup")[0].Running {
+		if time.Now().After(deadline) {
+			t.Fatal("task did not finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	run := s.Status("rollup")[0].History[0]
+	if run.Status != "succeeded" || run.Trigger != "schedule" {
+		t.Fatalf("unexpected run %+v", run)
+	}
+	if !run.FinishedAt.Equal(fake.Now()) {
+		t.Fatalf("run finished at %v, expected the fake clock time %v", run.FinishedAt, fake.Now())
+	}
+}
+
+func assertNextRun(t *testing.T, s *Scheduler, expected time.Time) {
+	t.Helper()
+
+	if next := s.Status("rollup")[0].NextRun; !next.Equal(expected) {
+		t.Fatalf("next run at %v, expected %v", next, expected)
+	}
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// instanceIDPattern restricts instance IDs to characters safe in queue names
+var instanceIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ClusterConfig holds configuration for running several server instances
+// (active/active) on the same device queue.
+type ClusterConfig struct {
+	Enabled        bool          // Whether this instance shares the RPC queue with others
+	InstanceID     string        // Unique name of this instance (default: <hostname>-<pid>)
+	MaxPrefetch    int           // Requests in flight to a fully healthy instance (default 20)
+	HealthInterval time.Duration // How often health is measured and announced to peers (default 5s)
+}
+
+// DefaultClusterConfig returns a disabled cluster configuration
+func DefaultClusterConfig() ClusterConfig {
+	return ClusterConfig{
+		Enabled:        false,
+		MaxPrefetch:    20,
+		HealthInterval: 5 * time.Second,
+	}
+}
+
+// ClusterPeer is another instance seen on the cluster exchange
+type ClusterPeer struct {
+	InstanceID string    `json:"instance_id"`
+	Health     float64   `json:"health"`
+	Prefetch   int       `json:"prefetch"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+// ClusterStatus is returned by the getClusterStatus function
+type ClusterStatus struct {
+	InstanceID string        `json:"instance_id"`
+	Health     float64       `json:"health"`   // Between 0 (unusable) and 1 (fully healthy)
+	Prefetch   int           `json:"prefetch"` // Requests currently allowed in flight to this instance
+	Peers      []ClusterPeer `json:"peers"`
+}
+
+// clusterMessage is exchanged between instances on the cluster exchange
+type clusterMessage struct {
+	Type     string  `json:"type"` // "status" or "cache_clear"
+	Instance string  `json:"instance"`
+	Health   float64 `json:"health,omitempty"`
+	Prefetch int     `json:"prefetch,omitempty"`
+}
+
+// ClusterManager lets several server instances consume one device queue.
+//
+// RabbitMQ spreads requests over the instances; each one limits its
+// unacknowledged deliveries (prefetch) according to its health, so a slow
+// or failing instance receives less work. Transactions stay on the
+// instance that began it: responses name the instance and clients send
+// the rest of the transaction to that instance's own queue. Instances
+// announce their health and cache clears to each other over a fanout
+// exchange.
+type ClusterManager struct {
+	handler *Handler
+	config  ClusterConfig
+
+	rpcChannel     *amqp.Channel // Channel the RPC queue is consumed on (its QoS is adjusted)
+	exchange       string        // Fanout exchange shared by the instances
+	clusterChannel *amqp.Channel // Channel for the cluster exchange
+	publishMutex   sync.Mutex    // Serializes publishes on clusterChannel
+
+	mutex    sync.Mutex
+	health   float64
+	prefetch int
+	peers    map[string]ClusterPeer
+}
+
+// NewClusterManager creates a cluster manager; config must be valid
+func NewClusterManager(handler *Handler, config ClusterConfig) *ClusterManager {
+	defaults := DefaultClusterConfig()
+	if config.InstanceID == "" {
+		hostname, _ := os.Hostname()
+		config.InstanceID = instanceIDPattern.FindString(fmt.Sprintf("%s-%d", hostname, os.Getpid()))
+	}
+	if config.MaxPrefetch <= 0 {
+		config.MaxPrefetch = defaults.MaxPrefetch
+	}
+	if config.HealthInterval <= 0 {
+		config.HealthInterval = defaults.HealthInterval
+	}
+
+	return &ClusterManager{
+		handler:  handler,
+		config:   config,
+		health:   1,
+		prefetch: config.MaxPrefetch,
+		peers:    make(map[string]ClusterPeer),
+	}
+}
+
+// setup limits in-flight requests on the RPC channel, declares this
+// instance's queue and joins the cluster exchange. It returns the
+// deliveries of the instance queue.
+func (cm *ClusterManager) setup(conn *amqp.Connection, rpcChannel *amqp.Channel, topology client.Topology) (<-chan amqp.Delivery, error) {
+	// Global QoS so the limit can be changed while consuming
+	if err := rpcChannel.Qos(cm.config.MaxPrefetch, 0, true); err != nil {
+		return nil, fmt.Errorf("failed to set prefetch: %w", err)
+	}
+	cm.rpcChannel = rpcChannel
+
+	instanceQueue := topology.InstanceQueue(cm.config.InstanceID)
+	if _, err := rpcChannel.QueueDeclare(instanceQueue, false, true, true, false, nil); err != nil {
+		return nil, fmt.Errorf("failed to declare instance queue: %w", client.ExplainAMQPError(err, cm.handler.amqpURL))
+	}
+	instanceMsgs, err := rpcChannel.Consume(instanceQueue, "", true, true, false, false, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open cluster channel: %w", err)
+	}
+	if err := ch.ExchangeDeclare(topology.ClusterExchange, "fanout", false, false, false, false, nil); err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to declare cluster exchange: %w", client.ExplainAMQPError(err, cm.handler.amqpURL))
+	}
+	queue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err == nil {
+		err = ch.QueueBind(queue.Name, "", topology.ClusterExchange, false, nil)
+	}
+	var clusterMsgs <-chan amqp.Delivery
+	if err == nil {
+		clusterMsgs, err = ch.Consume(queue.Name, "", true, true, false, false, nil)
+	}
+	if err != nil {
+		ch.Close()
+		return nil, fmt.Errorf("failed to join cluster exchange: %w", client.ExplainAMQPError(err, cm.handler.amqpURL))
+	}
+
+	cm.publishMutex.Lock()
+	cm.exchange = topology.ClusterExchange
+	cm.clusterChannel = ch
+	cm.publishMutex.Unlock()
+	go cm.receive(clusterMsgs)
+
+	log.Printf("[cluster] Instance %s joined %s (instance queue %s, max prefetch %d)",
+		cm.config.InstanceID, topology.RPCQueue, instanceQueue, cm.config.MaxPrefetch)
+	return instanceMsgs, nil
+}
+
+// close leaves the cluster exchange
+func (cm *ClusterManager) close() {
+	cm.publishMutex.Lock()
+	defer cm.publishMutex.Unlock()
+	if cm.clusterChannel != nil {
+		cm.clusterChannel.Close()
+		cm.clusterChannel = nil
+	}
+}
+
+// run measures health, adjusts the prefetch and announces it until ctx is cancelled
+func (cm *ClusterManager) run(ctx context.Context) {
+	ticker := time.NewTicker(cm.config.HealthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		health := cm.measureHealth(ctx)
+		prefetch := int(math.Round(float64(cm.config.MaxPrefetch) * health))
+		if prefetch < 1 {
+			prefetch = 1 // A prefetch of 0 would mean unlimited
+		}
+
+		cm.mutex.Lock()
+		changed := prefetch != cm.prefetch
+		cm.health, cm.prefetch = health, prefetch
+		cutoff := time.Now().Add(-3 * cm.config.HealthInterval)
+		for id, peer := range cm.peers {
+			if peer.LastSeen.Before(cutoff) {
+				delete(cm.peers, id)
+				log.Printf("[cluster] Peer %s left", id)
+			}
+		}
+		cm.mutex.Unlock()
+
+		if changed {
+			if err := cm.rpcChannel.Qos(prefetch, 0, true); err != nil {
+				log.Printf("[cluster] Failed to set prefetch to %d: %v", prefetch, err)
+			} else {
+				log.Printf("[cluster] Health %.2f: prefetch set to %d", health, prefetch)
+			}
+		}
+		cm.broadcast(clusterMessage{Type: "status", Health: health, Prefetch: prefetch})
+	}
+}
+
+// measureHealth scores the instance between 0 and 1 from database latency
+// and worker pool backlog
+func (cm *ClusterManager) measureHealth(ctx context.Context) float64 {
+	health := 1.0
+
+	if db := cm.handler.db; db != nil {
+		pingCtx, cancel := context.WithTimeout(ctx, 2*time.Second)
+		start := time.Now()
+		err := db.PingContext(pingCtx)
+		cancel()
+		latency := time.Since(start)
+
+		switch {
+		case err != nil:
+			return 0
+		case latency > time.Second:
+			health = 0.1
+		case latency > 50*time.Millisecond:
+			// Linear from 1 at 50ms down to 0.1 at 1s
+			health = 1 - 0.9*float64(latency-50*time.Millisecond)/float64(950*time.Millisecond)
+		}
+	}
+
+	if stats := cm.handler.workerPool.GetStats(); stats.QueueSize > 0 {
+		health *= 1 - float64(stats.QueuedTasks)/float64(stats.QueueSize)
+	}
+	return health
+}
+
+// broadcast publishes a message to every instance
+func (cm *ClusterManager) broadcast(message clusterMessage) {
+	message.Instance = cm.config.InstanceID
+	body, err := json.Marshal(message)
+	if err != nil {
+		return
+	}
+
+	cm.publishMutex.Lock()
+	defer cm.publishMutex.Unlock()
+	if cm.clusterChannel == nil {
+		return
+	}
+	if err := cm.clusterChannel.Publish(cm.exchange, "", false, false, amqp.Publishing{
+		ContentType: "application/json",
+		Timestamp:   time.Now(),
+		Body:        body,
+	}); err != nil {
+		log.Printf("[cluster] Failed to publish %s: %v", message.Type, err)
+	}
+}
+
+// receive handles messages from other instances
+func (cm *ClusterManager) receive(deliveries <-chan amqp.Delivery) {
+	for msg := range deliveries {
+		var message clusterMessage
+		if err := json.Unmarshal(msg.Body, &message); err != nil || message.Instance == cm.config.InstanceID {
+			continue
+		}
+
+		switch message.Type {
+		case "status":
+			cm.mutex.Lock()
+			if _, known := cm.peers[message.Instance]; !known {
+				log.Printf("[cluster] Peer %s joined", message.Instance)
+			}
+			cm.peers[message.Instance] = ClusterPeer{
+				InstanceID: message.Instance,
+				Health:     message.Health,
+				Prefetch:   message.Prefetch,
+				LastSeen:   time.Now(),
+			}
+			cm.mutex.Unlock()
+		case "cache_clear":
+			cm.handler.queryCache.Clear()
+			log.Printf("[cluster] Query cache cleared by %s", message.Instance)
+		}
+	}
+}
+
+// Status returns this instance's health and the peers seen recently
+func (cm *ClusterManager) Status() ClusterStatus {
+	cm.mutex.Lock()
+	defer cm.mutex.Unlock()
+
+	status := ClusterStatus{
+		InstanceID: cm.config.InstanceID,
+		Health:     cm.health,
+		Prefetch:   cm.prefetch,
+		Peers:      make([]ClusterPeer, 0, len(cm.peers)),
+	}
+	for _, peer := range cm.peers {
+		status.Peers = append(status.Peers, peer)
+	}
+	sort.Slice(status.Peers, func(i, j int) bool { return status.Peers[i].InstanceID < status.Peers[j].InstanceID })
+	return status
+}
+
+// SetClusterConfig lets this server share its device queue with other
+// instances and registers the getClusterStatus function. Every instance
+// needs a distinct InstanceID.
+func (h *Handler) SetClusterConfig(config ClusterConfig) error {
+	if !config.Enabled {
+		h.cluster = nil
+		return nil
+	}
+	if config.InstanceID != "" && !instanceIDPattern.MatchString(config.InstanceID) {
+		return fmt.Errorf("invalid instance ID %q: use up to 64 letters, digits, '.', '_' or '-'", config.InstanceID)
+	}
+
+	h.cluster = NewClusterManager(h, config)
+
+	h.RegisterFunctionWithMetadata("getClusterStatus", func() ClusterStatus {
+		return h.cluster.Status()
+	}, FunctionMetadata{Description: "Returns this instance's health, prefetch and the other instances sharing the device queue"})
+
+	log.Printf("[server] Cluster mode enabled: instance %s", h.cluster.config.InstanceID)
+	return nil
+}
@@ -0,0 +1,96 @@
+package server
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"strings"
+)
+
+// ColumnType describes a column of a SQL result, so clients can decode its
+// values into native types instead of guessing from their JSON form
+type ColumnType struct {
+	Name         string `json:"name"`
+	DatabaseType string `json:"dbType"`              // Database type name, e.g. "VARCHAR", "UNSIGNED BIGINT", "DECIMAL"
+	Nullable     *bool  `json:"nullable,omitempty"`  // Whether the column may hold NULL (absent if the driver cannot tell)
+	Length       int64  `json:"length,omitempty"`    // Maximum length of variable-length text and binary columns
+	Precision    int64  `json:"precision,omitempty"` // Total digits of DECIMAL columns
+	Scale        int64  `json:"scale,omitempty"`     // Digits after the decimal point of DECIMAL columns
+}
+
+// describeColumns returns the descriptors of a result's columns
+func describeColumns(colTypes []*sql.ColumnType) []ColumnType {
+	descriptors := make([]ColumnType, len(colTypes))
+	for i, colType := range colTypes {
+		descriptors[i] = ColumnType{Name: colType.Name(), DatabaseType: colType.DatabaseTypeName()}
+		if nullable, ok := colType.Nullable(); ok {
+			descriptors[i].Nullable = &nullable
+		}
+		if length, ok := colType.Length(); ok {
+			descriptors[i].Length = length
+		}
+		if precision, scale, ok := colType.DecimalSize(); ok {
+			descriptors[i].Precision, descriptors[i].Scale = precision, scale
+		}
+	}
+	return descriptors
+}
+
+// isBinaryType reports whether values of a database type are raw bytes,
+// which travel base64-encoded in typed responses
+func isBinaryType(dbType string) bool {
+	switch strings.ToUpper(dbType) {
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		return true
+	}
+	return false
+}
+
+// encodeBinaryValue returns the typed form of a binary column value
+func encodeBinaryValue(val interface{}) interface{} {
+	if b, ok := val.([]byte); ok {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return val
+}
+
+// responseFor adapts a SQL response to what the request asked for. Results
+// are built, and cached, in typed form; clients that did not ask for column
+// types get the original encoding, with binary values as plain strings, and
+// clients with the columnar capability get the rows column-major.
+func responseFor(resp RPCResponse, req RPCRequest) RPCResponse {
+	if req.ColumnTypes {
+		if req.hasCapability(CapabilityColumnar) {
+			return toColumnar(resp)
+		}
+		return resp
+	}
+	if resp.ColumnTypes == nil {
+		return resp
+	}
+
+	var binary []int
+	for i, column := range resp.ColumnTypes {
+		if isBinaryType(column.DatabaseType) {
+			binary = append(binary, i)
+		}
+	}
+	resp.ColumnTypes = nil
+	if len(binary) == 0 {
+		return resp
+	}
+
+	// Copy the rows: cached responses are shared
+	rows := make([][]interface{}, len(resp.Rows))
+	for r, row := range resp.Rows {
+		rows[r] = append([]interface{}(nil), row...)
+		for _, i := range binary {
+			if encoded, ok := rows[r][i].(string); ok {
+				if raw, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+					rows[r][i] = string(raw)
+				}
+			}
+		}
+	}
+	resp.Rows = rows
+	return resp
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// CapabilityColumnar is the capability clients list to receive SQL results
+// in column-major layout (RPCResponse.Columnar) instead of Rows
+const CapabilityColumnar = "columnar"
+
+// Kinds of the value arrays of a columnar result
+const (
+	ColumnKindInt   = "int"   // Ints: integer columns whose values all fit in int64
+	ColumnKindFloat = "float" // Floats: FLOAT, DOUBLE and REAL columns
+	ColumnKindText  = "text"  // Texts: every other column whose values are all strings
+	ColumnKindAny   = "any"   // Values: columns with mixed values
+)
+
+// ColumnarRows is the column-major layout of a SQL result. Values of a
+// column share one type, so they decode without per-value type switches,
+// and runs of similar values compress better than interleaved rows.
+type ColumnarRows struct {
+	Count   int            `json:"count"`   // Number of rows
+	Columns []ColumnValues `json:"columns"` // Values of each column, in the order of RPCResponse.Columns
+}
+
+// ColumnValues holds the values of one column in the array matching Kind.
+// NULL rows are listed in Nulls and hold a zero value in the array.
+type ColumnValues struct {
+	Kind   string        `json:"kind"`
+	Ints   []int64       `json:"ints,omitempty"`
+	Floats []float64     `json:"floats,omitempty"`
+	Texts  []string      `json:"texts,omitempty"`
+	Values []interface{} `json:"values,omitempty"`
+	Nulls  []int         `json:"nulls,omitempty"` // Rows whose value is NULL, ascending
+}
+
+// hasCapability reports whether the client listed capability in its request
+func (req RPCRequest) hasCapability(capability string) bool {
+	for _, c := range req.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// rowCount returns the number of rows of a response in either layout
+func (resp RPCResponse) rowCount() int {
+	if resp.Columnar != nil {
+		return resp.Columnar.Count
+	}
+	return len(resp.Rows)
+}
+
+// toColumnar returns resp with its rows in column-major layout. Only typed
+// SQL results are converted: the column kinds come from their descriptors.
+func toColumnar(resp RPCResponse) RPCResponse {
+	if resp.ColumnTypes == nil || resp.Rows == nil {
+		return resp
+	}
+
+	columnar := &ColumnarRows{Count: len(resp.Rows), Columns: make([]ColumnValues, len(resp.Columns))}
+	for i := range columnar.Columns {
+		dbType := ""
+		if i < len(resp.ColumnTypes) {
+			dbType = resp.ColumnTypes[i].DatabaseType
+		}
+		columnar.Columns[i] = columnValues(resp.Rows, i, dbType)
+	}
+	resp.Columnar = columnar
+	resp.Rows = nil
+	return resp
+}
+
+// columnValues gathers column i of rows into the array of its kind
+func columnValues(rows [][]interface{}, i int, dbType string) ColumnValues {
+	column := ColumnValues{Kind: columnKind(rows, i, dbType)}
+	n := len(rows)
+	switch column.Kind {
+	case ColumnKindInt:
+		column.Ints = make([]int64, n)
+	case ColumnKindFloat:
+		column.Floats = make([]float64, n)
+	case ColumnKindText:
+		column.Texts = make([]string, n)
+	default:
+		column.Values = make([]interface{}, n)
+	}
+
+	for r, row := range rows {
+		var value interface{}
+		if i < len(row) {
+			value = row[i]
+		}
+		if value == nil {
+			column.Nulls = append(column.Nulls, r)
+			continue
+		}
+		switch column.Kind {
+		case ColumnKindInt:
+			column.Ints[r], _ = intValue(value)
+		case ColumnKindFloat:
+			column.Floats[r], _ = floatValue(value)
+		case ColumnKindText:
+			column.Texts[r] = value.(string)
+		default:
+			column.Values[r] = value
+		}
+	}
+	return column
+}
+
+// columnKind picks the value array for column i: the one its database type
+// calls for if every value converts to it, else text if every value is a
+// string, else mixed values
+func columnKind(rows [][]interface{}, i int, dbType string) string {
+	fits := func(ok func(interface{}) bool) bool {
+		for _, row := range rows {
+			if i < len(row) && row[i] != nil && !ok(row[i]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	switch strings.TrimPrefix(strings.ToUpper(dbType), "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "INTEGER", "BIGINT", "YEAR":
+		if fits(func(v interface{}) bool { _, ok := intValue(v); return ok }) {
+			return ColumnKindInt
+		}
+	case "FLOAT", "DOUBLE", "REAL":
+		if fits(func(v interface{}) bool { _, ok := floatValue(v); return ok }) {
+			return ColumnKindFloat
+		}
+	}
+	if fits(func(v interface{}) bool { _, ok := v.(string); return ok }) {
+		return ColumnKindText
+	}
+	return ColumnKindAny
+}
+
+// intValue converts a result value of an integer column to int64
+func intValue(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case string:
+		n, err := strconv.ParseInt(v, 10, 64)
+		return n, err == nil
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	}
+	return 0, false
+}
+
+// floatValue converts a result value of a floating point column to float64.
+// Infinities and NaN, which JSON cannot carry, do not convert.
+func floatValue(value interface{}) (float64, bool) {
+	var f float64
+	switch v := value.(type) {
+	case string:
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return 0, false
+		}
+		f = parsed
+	case float32:
+		// Widen through the shortest decimal form, so 1.1 stays 1.1
+		f, _ = strconv.ParseFloat(strconv.FormatFloat(float64(v), 'g', -1, 32), 64)
+	case float64:
+		f = v
+	default:
+		return 0, false
+	}
+	return f, !math.IsInf(f, 0) && !math.IsNaN(f)
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// durationType is used to decode durations written as strings ("30s", "5m")
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// ApplyConfigFile overlays the JSON configuration file at path onto config.
+// Keys use the snake_case names of the ServerConfig fields (see the json tags);
+// keys that are absent leave the current value untouched. Durations are
+// written as Go duration strings ("15m") or as a number of seconds. Only JSON
+// is supported: files without a .json extension are rejected rather than
+// misread.
+//
+// Example:
+//
+//	{
+//	  "cache_ttl": "10m",
+//	  "rate_limit": 50,
+//	  "strict_mode": true
+//	}
+func ApplyConfigFile(config *ServerConfig, path string) error {
+	if ext := filepath.Ext(path); !strings.EqualFold(ext, ".json") {
+		return fmt.Errorf("config file %s: unsupported format '%s': only JSON files (.json) are supported", path, ext)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	var values map[string]json.RawMessage
+	if err := json.Unmarshal(data, &values); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+
+	fields := configFields()
+	target := reflect.ValueOf(config).Elem()
+	for key, raw := range values {
+		index, ok := fields[key]
+		if !ok {
+			return fmt.Errorf("config file %s: unknown key '%s'", path, key)
+		}
+
+		field := target.Field(index)
+		if field.Type() == durationType {
+			var d Duration
+			if err := json.Unmarshal(raw, &d); err != nil {
+				return fmt.Errorf("config file %s: %s: %v", path, key, err)
+			}
+			field.SetInt(int64(d))
+			continue
+		}
+		if err := json.Unmarshal(raw, field.Addr().Interface()); err != nil {
+			return fmt.Errorf("config file %s: %s: %v", path, key, err)
+		}
+	}
+	return nil
+}
+
+// configFields maps json names to ServerConfig field indexes
+func configFields() map[string]int {
+	t := reflect.TypeOf(ServerConfig{})
+	fields := make(map[string]int, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			fields[name] = i
+		}
+	}
+	return fields
+}
+
+// changedConfigFields returns the json names of the fields that differ
+func changedConfigFields(old, updated *ServerConfig) []string {
+	oldValue := reflect.ValueOf(old).Elem()
+	newValue := reflect.ValueOf(updated).Elem()
+
+	var changed []string
+	for name, index := range configFields() {
+		if !reflect.DeepEqual(oldValue.Field(index).Interface(), newValue.Field(index).Interface()) {
+			changed = append(changed, name)
+		}
+	}
+	return changed
+}
+
+// ConfigReloader re-reads the configuration file and applies changed values
+// to a running Handler through its Set*Config methods. Cache, SQL validation,
+// rate limiting, slow query and priority settings are applied live; any other
+// change is reported as requiring a restart.
+type ConfigReloader struct {
+	handler  *Handler
+	path     string
+	interval time.Duration
+
+	mutex   sync.Mutex
+	current *ServerConfig
+	modTime time.Time
+}
+
+// NewConfigReloader creates a reloader for a handler started with config.
+// An interval of 0 disables file polling; SIGHUP always triggers a reload.
+func NewConfigReloader(handler *Handler, config *ServerConfig, path string, interval time.Duration) *ConfigReloader {
+	current := *config
+	reloader := &ConfigReloader{
+		handler:  handler,
+		path:     path,
+		interval: interval,
+		current:  &current,
+	}
+	if info, err := os.Stat(path); err == nil {
+		reloader.modTime = info.ModTime()
+	}
+	return reloader
+}
+
+// Start watches the file and SIGHUP until ctx is cancelled
+func (cr *ConfigReloader) Start(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	var tick <-chan time.Time
+	if cr.interval > 0 {
+		ticker := time.NewTicker(cr.interval)
+		tick = ticker.C
+		defer ticker.Stop()
+	}
+
+	go func() {
+		<-ctx.Done()
+		signal.Stop(hup)
+	}()
+
+	log.Printf("[config] Watching %s for changes (send SIGHUP to reload immediately)", cr.path)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			log.Printf("[config] SIGHUP received, reloading %s", cr.path)
+			if err := cr.Reload(); err != nil {
+				log.Printf("[config] Reload failed: %v", err)
+			}
+		case <-tick:
+			info, err := os.Stat(cr.path)
+			if err != nil || !info.ModTime().After(cr.modTime) {
+				continue
+			}
+			log.Printf("[config] %s changed, reloading", cr.path)
+			if err := cr.Reload(); err != nil {
+				log.Printf("[config] Reload failed: %v", err)
+			}
+		}
+	}
+}
+
+// Reload reads the file and applies every changed value that can be changed
+// at runtime. The running configuration is left untouched if the file is invalid.
+func (cr *ConfigReloader) Reload() error {
+	cr.mutex.Lock()
+	defer cr.mutex.Unlock()
+
+	if info, err := os.Stat(cr.path); err == nil {
+		cr.modTime = info.ModTime()
+	}
+
+	updated := *cr.current
+	if err := ApplyConfigFile(&updated, cr.path); err != nil {
+		return err
+	}
+	if err := ValidateValidationPatterns(updated.ValidationRules); err != nil {
+		return err
+	}
+	if _, err := ParseRiskActions(updated.RiskActions); err != nil {
+		return err
+	}
+	if _, err := ParseCacheTTLOverrides(updated.CacheTTLOverrides); err != nil {
+		return err
+	}
+	if err := ValidateRateLimitMode(updated.RateLimitMode); err != nil {
+		return err
+	}
+
+	changed := changedConfigFields(cr.current, &updated)
+	if len(changed) == 0 {
+		log.Printf("[config] No changes in %s", cr.path)
+		return nil
+	}
+
+	applied := make(map[string]bool)
+	section := func(prefixes ...string) bool {
+		found := false
+		for _, name := range changed {
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(name, prefix) {
+					applied[name] = true
+					found = true
+				}
+			}
+		}
+		return found
+	}
+
+	if section("cache_") {
+		cr.handler.SetCacheConfig(updated.ToQueryCacheConfig())
+	}
+	if section("validation_enabled", "validation_rules", "require_parameters", "risk_actions", "approve_", "strict_mode", "allow_", "max_query_length", "log_violations", "default_limit") {
+		cr.handler.SetSQLValidationConfig(updated.ToSQLValidationConfig())
+	}
+	if section("approval_") {
+		cr.handler.SetApprovalConfig(updated.ToApprovalConfig())
+	}
+	if section("rate_limit", "burst_size") {
+		cr.handler.SetRateLimiterConfig(updated.ToRateLimiterConfig())
+	}
+	if section("max_concurrent_queries", "query_wait_timeout") {
+		cr.handler.SetQueryLimiterConfig(updated.ToQueryLimiterConfig())
+	}
+	if section("overload_") {
+		cr.handler.SetLoadSheddingConfig(updated.ToLoadSheddingConfig())
+	}
+	if section("slow_query_") {
+		cr.handler.SetSlowQueryConfig(updated.ToSlowQueryConfig())
+	}
+	if section("query_stats") {
+		cr.handler.SetQueryStatsConfig(updated.ToQueryStatsConfig())
+	}
+	if section("priority_") {
+		cr.handler.SetPriorityConfig(updated.ToPriorityConfig())
+	}
+	if section("progress_") {
+		cr.handler.SetProgressConfig(updated.ToProgressConfig())
+	}
+
+	for _, name := range changed {
+		if !applied[name] {
+			log.Printf("[config] '%s' changed but requires a restart to take effect", name)
+		}
+	}
+
+	cr.current = &updated
+	log.Printf("[config] Reloaded %s (%d changed values)", cr.path, len(changed))
+	return nil
+}
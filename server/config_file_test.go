@@ -0,0 +1,68 @@
+package server
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyConfigFile(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	config := DefaultServerConfig()
+	path := write("server.json", `{"cache_ttl": "10m", "rate_limit": 50, "strict_mode": true}`)
+	if err := ApplyConfigFile(config, path); err != nil {
+		t.Fatal(err)
+	}
+	if config.CacheTTL != 10*time.Minute || config.RateLimit != 50 || !config.StrictMode {
+		t.Fatalf("values not applied: cache_ttl=%v rate_limit=%d strict_mode=%v", config.CacheTTL, config.RateLimit, config.StrictMode)
+	}
+
+	for _, name := range []string{"server.yaml", "server.yml", "server.toml", "server"} {
+		path := write(name, `{"rate_limit": 1}`)
+		err := ApplyConfigFile(config, path)
+		if err == nil || !strings.Contains(err.Error(), "only JSON files") {
+			t.Errorf("%s: expected the format to be rejected, got %v", name, err)
+		}
+	}
+	if config.RateLimit != 50 {
+		t.Fatalf("rejected file changed rate_limit to %d", config.RateLimit)
+	}
+}
+
+func TestReloadDefaultLimit(t *testing.T) {
+	h := newReloadTestHandler(t)
+	config := DefaultServerConfig()
+	h.SetSQLValidationConfig(config.ToSQLValidationConfig())
+
+	path := filepath.Join(t.TempDir(), "server.json")
+	if err := os.WriteFile(path, []byte(`{"default_limit": 50}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	log.SetOutput(&logs)
+	defer log.SetOutput(os.Stderr)
+	if err := NewConfigReloader(h, config, path, 0).Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Contains(logs.String(), "requires a restart") {
+		t.Fatalf("default_limit reported as requiring a restart:\n%s", logs.String())
+	}
+	result := h.sqlValidator.ValidateQuery("SELECT * FROM items", nil)
+	if result.RewrittenQuery != "SELECT * FROM items\nLIMIT 50" {
+		t.Fatalf("reloaded default limit not applied, rewritten query is %q", result.RewrittenQuery)
+	}
+}
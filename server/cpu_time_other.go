@@ -0,0 +1,11 @@
+//go:build windows || plan9
+
+package server
+
+import "time"
+
+// processCPUTime is not available on this platform; CPU thresholds are
+// ignored.
+func processCPUTime() (time.Duration, bool) {
+	return 0, false
+}
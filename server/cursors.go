@@ -0,0 +1,321 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// CursorConfig holds configuration for paginated result sets
+type CursorConfig struct {
+	MaxCursors      int           // Cursors open at the same time
+	DefaultPageSize int           // Rows per page when the client does not ask for a size
+	MaxPageSize     int           // Largest page a client may ask for
+	IdleTimeout     time.Duration // Cursors not fetched for this long are closed
+}
+
+// DefaultCursorConfig returns the default cursor configuration
+func DefaultCursorConfig() CursorConfig {
+	return CursorConfig{
+		MaxCursors:      16,
+		DefaultPageSize: 100,
+		MaxPageSize:     5000,
+		IdleTimeout:     time.Minute,
+	}
+}
+
+// CursorRequest is the query of a "cursor" request. The first request
+// carries the SELECT (its parameters are the request parameters) and the
+// page size; the following ones only the cursor ID returned with the first
+// page.
+type CursorRequest struct {
+	CursorID string `json:"cursorID,omitempty"`
+	Query    string `json:"query,omitempty"`
+	PageSize int    `json:"pageSize,omitempty"`
+	Close    bool   `json:"close,omitempty"`
+}
+
+// CursorInfo describes the page of a paginated result in RPCResponse
+type CursorInfo struct {
+	ID     string `json:"id"`
+	Offset int64  `json:"offset"` // Rows returned before this page
+	Done   bool   `json:"done"`   // Last page; the cursor is closed
+}
+
+// cursor is an open result set read page by page
+type cursor struct {
+	mutex       sync.Mutex // Serializes fetches
+	rows        *sql.Rows
+	columns     []string
+	columnTypes []ColumnType
+	scanner     *rowScanner
+	pageSize    int
+	next        []interface{} // Row read ahead to tell whether a page is the last one
+	offset      int64
+	lastUsed    time.Time
+	cancel      context.CancelFunc
+	release     func()
+}
+
+// CursorManager keeps the result sets of paginated queries open between
+// requests, so clients page through large tables without LIMIT/OFFSET
+// queries that rescan the skipped rows.
+type CursorManager struct {
+	config CursorConfig
+
+	mutex   sync.Mutex
+	cursors map[string]*cursor
+}
+
+// NewCursorManager creates a cursor manager
+func NewCursorManager(config CursorConfig) *CursorManager {
+	defaults := DefaultCursorConfig()
+	if config.MaxCursors <= 0 {
+		config.MaxCursors = defaults.MaxCursors
+	}
+	if config.DefaultPageSize <= 0 {
+		config.DefaultPageSize = defaults.DefaultPageSize
+	}
+	if config.MaxPageSize <= 0 {
+		config.MaxPageSize = defaults.MaxPageSize
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+	return &CursorManager{config: config, cursors: make(map[string]*cursor)}
+}
+
+// newCursorID returns a random cursor identifier
+func newCursorID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("cur_%d", time.Now().UnixNano())
+	}
+	return "cur_" + hex.EncodeToString(buf)
+}
+
+// run closes idle cursors until ctx is done
+func (cm *CursorManager) run(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			cm.mutex.Lock()
+			for id, c := range cm.cursors {
+				c.close()
+				delete(cm.cursors, id)
+			}
+			cm.mutex.Unlock()
+			return
+		case <-ticker.C:
+			cm.mutex.Lock()
+			for id, c := range cm.cursors {
+				if c.mutex.TryLock() {
+					if time.Since(c.lastUsed) > cm.config.IdleTimeout {
+						log.Printf("[server] Closing idle cursor %s after %d rows", id, c.offset)
+						c.close()
+						delete(cm.cursors, id)
+					}
+					c.mutex.Unlock()
+				}
+			}
+			cm.mutex.Unlock()
+		}
+	}
+}
+
+// close releases the result set and connection of a cursor
+func (c *cursor) close() {
+	c.rows.Close()
+	c.cancel()
+	c.release()
+}
+
+// open runs the query of a new cursor and returns its ID
+func (cm *CursorManager) open(h *Handler, query string, params []interface{}, pageSize int) (string, error) {
+	if pageSize <= 0 {
+		pageSize = cm.config.DefaultPageSize
+	}
+	if pageSize > cm.config.MaxPageSize {
+		return "", fmt.Errorf("page size %d exceeds the maximum of %d", pageSize, cm.config.MaxPageSize)
+	}
+	cm.mutex.Lock()
+	if len(cm.cursors) >= cm.config.MaxCursors {
+		cm.mutex.Unlock()
+		return "", fmt.Errorf("too many cursors open (max %d)", cm.config.MaxCursors)
+	}
+	cm.mutex.Unlock()
+
+	db, release, err := h.acquireDB()
+	if err != nil {
+		return "", err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := db.QueryContext(ctx, query, params...)
+	if err != nil {
+		cancel()
+		release()
+		return "", err
+	}
+	columns, err := rows.Columns()
+	if err == nil {
+		var colTypes []*sql.ColumnType
+		if colTypes, err = rows.ColumnTypes(); err == nil {
+			c := &cursor{
+				rows: rows, columns: columns, columnTypes: describeColumns(colTypes),
+				pageSize: pageSize, lastUsed: time.Now(), cancel: cancel, release: release,
+			}
+			binary := make([]bool, len(c.columnTypes))
+			for i, column := range c.columnTypes {
+				binary[i] = isBinaryType(column.DatabaseType)
+			}
+			c.scanner = newRowScanner(h, colTypes, binary)
+			id := newCursorID()
+			cm.mutex.Lock()
+			cm.cursors[id] = c
+			cm.mutex.Unlock()
+			return id, nil
+		}
+	}
+	rows.Close()
+	cancel()
+	release()
+	return "", err
+}
+
+// fetch returns the next page of a cursor. The cursor is closed after its
+// last page.
+func (cm *CursorManager) fetch(id string) (RPCResponse, error) {
+	cm.mutex.Lock()
+	c, ok := cm.cursors[id]
+	cm.mutex.Unlock()
+	if !ok {
+		return RPCResponse{}, fmt.Errorf("cursor %s not found (finished or idle for more than %v)", id, cm.config.IdleTimeout)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.lastUsed = time.Now()
+
+	info := &CursorInfo{ID: id, Offset: c.offset}
+	page, done, err := c.read()
+	if done || err != nil {
+		cm.remove(id)
+	}
+	if err != nil {
+		return RPCResponse{}, err
+	}
+	info.Done = done
+	return RPCResponse{Columns: c.columns, ColumnTypes: c.columnTypes, Rows: page, Cursor: info}, nil
+}
+
+// remove closes a cursor and forgets it
+func (cm *CursorManager) remove(id string) {
+	cm.mutex.Lock()
+	c, ok := cm.cursors[id]
+	delete(cm.cursors, id)
+	cm.mutex.Unlock()
+	if ok {
+		c.close()
+	}
+}
+
+// read returns up to a page of rows and whether the result set ended. A row
+// is read ahead, so the last page is reported as such even when it is full.
+func (c *cursor) read() ([][]interface{}, bool, error) {
+	page := make([][]interface{}, 0, c.pageSize)
+	if c.next != nil {
+		page = append(page, c.next)
+		c.next = nil
+	}
+	for len(page) <= c.pageSize {
+		if !c.rows.Next() {
+			if err := c.rows.Err(); err != nil {
+				return nil, false, err
+			}
+			c.offset += int64(len(page))
+			return page, true, nil
+		}
+
+		row, err := c.scanner.scan(c.rows)
+		if err != nil {
+			return nil, false, err
+		}
+		page = append(page, row)
+	}
+
+	// The row past the page starts the next one
+	c.next = page[c.pageSize]
+	page = page[:c.pageSize]
+	c.offset += int64(len(page))
+	return page, false, nil
+}
+
+// SetCursorConfig configures paginated result sets
+func (h *Handler) SetCursorConfig(config CursorConfig) {
+	h.cursors = NewCursorManager(config)
+	log.Printf("[server] Cursors configured: max=%d page_size=%d max_page_size=%d idle_timeout=%v",
+		h.cursors.config.MaxCursors, h.cursors.config.DefaultPageSize, h.cursors.config.MaxPageSize, h.cursors.config.IdleTimeout)
+}
+
+// handleCursor opens a cursor and returns its first page, returns the next
+// page of an open cursor, or closes one
+func (h *Handler) handleCursor(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	var cursorReq CursorRequest
+	if err := json.Unmarshal([]byte(req.Query), &cursorReq); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("invalid cursor request: %v", err)})
+		return
+	}
+
+	if cursorReq.Close {
+		h.cursors.remove(cursorReq.CursorID)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Columns: []string{"cursorID", "closed"},
+			Rows:    [][]interface{}{{cursorReq.CursorID, true}},
+		})
+		return
+	}
+
+	if cursorReq.Query != "" {
+		if !isReadOnlyQuery(cursorReq.Query) {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "only SELECT queries can be paginated"})
+			return
+		}
+
+		validationResult := h.sqlValidator.ValidateStreamingQuery(cursorReq.Query, req.Params)
+		if !validationResult.Valid {
+			log.Printf("[server] SQL validation blocked cursor from %s: %s (risk: %s)",
+				req.ClientIP, h.loggedQuery(cursorReq.Query, 50), validationResult.Risk)
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, validationFailedResponse(validationResult))
+			return
+		}
+
+		id, err := h.cursors.open(h, cursorReq.Query, req.Params, cursorReq.PageSize)
+		if err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("cursor failed: %v", err)})
+			return
+		}
+		cursorReq.CursorID = id
+		log.Printf("[server] Cursor %s opened: %s", id, h.loggedQuery(cursorReq.Query, 50))
+	} else if cursorReq.CursorID == "" {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "cursor request without query or cursorID"})
+		return
+	}
+
+	response, err := h.cursors.fetch(cursorReq.CursorID)
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("cursor failed: %v", err)})
+		return
+	}
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, responseFor(response, req))
+}
@@ -0,0 +1,36 @@
+package server
+
+// ddlCommands are the schema-changing commands ApproveDDL holds
+var ddlCommands = map[string]bool{
+	"CREATE":   true,
+	"ALTER":    true,
+	"DROP":     true,
+	"TRUNCATE": true,
+	"RENAME":   true,
+}
+
+// isUnboundedWrite reports whether query is a DELETE or UPDATE without a
+// WHERE clause of its own, which changes every row of its tables
+func isUnboundedWrite(query, command string) bool {
+	if command != "DELETE" && command != "UPDATE" {
+		return false
+	}
+	for _, word := range topLevelWords(query) {
+		if word == "WHERE" {
+			return false
+		}
+	}
+	return true
+}
+
+// approvalReason returns why query needs an operator's approval regardless
+// of its risk level, or "" if it does not
+func (v *SQLValidator) approvalReason(query, command string) string {
+	if v.config.ApproveDDL && ddlCommands[command] {
+		return command + " statements require an operator's approval"
+	}
+	if v.config.ApproveUnboundedWrites && isUnboundedWrite(query, command) {
+		return command + " without WHERE requires an operator's approval"
+	}
+	return ""
+}
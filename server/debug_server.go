@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+	"strconv"
+	"time"
+)
+
+// DebugConfig configures the HTTP listener used for live troubleshooting.
+//
+// The endpoints expose internals (queries in flight, client addresses,
+// profiles) and are not authenticated: bind the listener to localhost or a
+// management network.
+type DebugConfig struct {
+	Addr  string // Listen address, e.g. "127.0.0.1:6060" (empty = disabled)
+	Pprof bool   // Serve the Go profiler under /debug/pprof/
+}
+
+// DefaultDebugConfig returns the default debug configuration (disabled)
+func DefaultDebugConfig() DebugConfig {
+	return DebugConfig{Pprof: true}
+}
+
+// DebugState is the snapshot of server internals served on /debug/state
+type DebugState struct {
+	DeviceID     string               `json:"device_id"`
+	Time         time.Time            `json:"time"`
+	Goroutines   int                  `json:"goroutines"`
+	HeapBytes    uint64               `json:"heap_bytes"`
+	WorkerPool   WorkerPoolStats      `json:"worker_pool"`
+	Cache        CacheStats           `json:"cache"`
+	RateLimiter  RateLimiterStats     `json:"rate_limiter"`
+	QueryLimiter QueryLimiterStats    `json:"query_limiter"`
+	Resources    ResourceStats        `json:"resources"`
+	Validation   ValidationStats      `json:"validation"`
+	Transactions []TransactionInfo    `json:"transactions"`
+	Sessions     int                  `json:"sessions"`
+	Heartbeat    ServerHeartbeatStats `json:"heartbeat"`
+	Responses    ResponseStats        `json:"responses"`
+}
+
+// SetDebugConfig sets the debug listener, started with the server
+func (h *Handler) SetDebugConfig(config DebugConfig) {
+	h.debugConfig = config
+	if config.Addr != "" {
+		log.Printf("[server] Debug endpoint configured on %s (pprof=%v)", config.Addr, config.Pprof)
+	}
+}
+
+// GetDebugState returns a snapshot of the worker pool, cache, rate limiter,
+// transaction and heartbeat internals
+func (h *Handler) GetDebugState() DebugState {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+
+	return DebugState{
+		DeviceID:     h.deviceID,
+		Time:         time.Now(),
+		Goroutines:   runtime.NumGoroutine(),
+		HeapBytes:    mem.HeapAlloc,
+		WorkerPool:   h.GetWorkerPoolStats(),
+		Cache:        h.GetCacheStats(),
+		RateLimiter:  h.GetRateLimiterStats(),
+		QueryLimiter: h.GetQueryLimiterStats(),
+		Resources:    h.GetResourceStats(),
+		Validation:   h.GetSQLValidationStats(),
+		Transactions: h.GetActiveTransactions(),
+		Sessions:     h.sessions.Len(),
+		Heartbeat:    h.GetHeartbeatStats(),
+		Responses:    h.GetResponseStats(),
+	}
+}
+
+// startDebugServer starts serving the debug endpoints. The returned
+// function shuts the listener down.
+func (h *Handler) startDebugServer() (func(), error) {
+	listener, err := net.Listen("tcp", h.debugConfig.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on debug address %s: %w", h.debugConfig.Addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/state", h.serveDebugState)
+	mux.HandleFunc("/debug/queries", h.serveQueryStats)
+	mux.HandleFunc("/metrics", h.serveMetrics)
+	if h.debugConfig.Pprof {
+		mux.HandleFunc("/debug/pprof/", pprof.Index)
+		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+		mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+		mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	}
+
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("[debug] Debug endpoint stopped: %v", err)
+		}
+	}()
+	log.Printf("[debug] Serving debug endpoints on http://%s/debug/state", listener.Addr())
+	return func() { server.Close() }, nil
+}
+
+// serveDebugState writes the debug state as JSON
+func (h *Handler) serveDebugState(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(h.GetDebugState()); err != nil {
+		log.Printf("[debug] Failed to write debug state: %v", err)
+	}
+}
+
+// serveQueryStats writes the statement statistics as JSON; ?limit=N keeps
+// the N fingerprints with the most total execution time
+func (h *Handler) serveQueryStats(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			http.Error(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(h.GetQueryStats(limit)); err != nil {
+		log.Printf("[debug] Failed to write query statistics: %v", err)
+	}
+}
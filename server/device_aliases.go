@@ -0,0 +1,201 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// DeviceAliasStats counts the requests received under one device ID
+type DeviceAliasStats struct {
+	DeviceID      string    `json:"device_id"`
+	RPCQueue      string    `json:"rpc_queue"`
+	Requests      int64     `json:"requests"`
+	Heartbeats    int64     `json:"heartbeats"`
+	LastRequest   time.Time `json:"last_request"`   // Zero until the first request
+	LastHeartbeat time.Time `json:"last_heartbeat"` // Zero until the first heartbeat
+}
+
+// DeviceAliasReport is returned by the getDeviceAliasStats function
+type DeviceAliasReport struct {
+	Primary DeviceAliasStats   `json:"primary"` // Traffic under the server's device ID
+	Aliases []DeviceAliasStats `json:"aliases"` // Traffic under each alias, sorted by device ID
+}
+
+// aliasDelivery is a delivery received on the queue of an alias
+type aliasDelivery struct {
+	alias string
+	msg   amqp.Delivery
+}
+
+// DeviceAliases lets a server answer under additional device IDs, which is
+// how a device is renamed without breaking its clients: the server consumes
+// the queues of the old ID (the alias) beside its own, so clients can be
+// moved to the new ID one by one. The request counts show when the old name
+// no longer receives traffic and the alias can be removed.
+type DeviceAliases struct {
+	handler *Handler
+	aliases []string
+
+	mutex sync.Mutex
+	stats map[string]*DeviceAliasStats // Keyed by device ID, the primary one included
+}
+
+// NewDeviceAliases creates the aliases of a handler
+func NewDeviceAliases(handler *Handler, aliases []string) *DeviceAliases {
+	return &DeviceAliases{
+		handler: handler,
+		aliases: aliases,
+		stats:   make(map[string]*DeviceAliasStats),
+	}
+}
+
+// consumerTags returns the consumer tags of the alias queues
+func (da *DeviceAliases) consumerTags() []string {
+	tags := make([]string, 0, 2*len(da.aliases))
+	for _, alias := range da.aliases {
+		tags = append(tags, rpcConsumerTag+"."+alias, heartbeatConsumerTag+"."+alias)
+	}
+	return tags
+}
+
+// setup declares and consumes the RPC and heartbeat queues of every alias.
+// Deliveries of all aliases are merged into the returned channels, which are
+// closed once every consumer of their kind is closed. RPC deliveries must be
+// acknowledged when manualAck is set.
+func (da *DeviceAliases) setup(ch *amqp.Channel, clustered, manualAck bool) (<-chan aliasDelivery, <-chan aliasDelivery, error) {
+	var rpcConsumers, heartbeatConsumers []aliasConsumer
+	for _, alias := range da.aliases {
+		topology, err := client.NewTopology(da.handler.namespace, alias)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, err := da.handler.declareDeviceQueues(ch, topology); err != nil {
+			return nil, nil, fmt.Errorf("alias '%s': %w", alias, err)
+		}
+
+		rpcMsgs, err := ch.Consume(topology.RPCQueue, rpcConsumerTag+"."+alias, !manualAck, !clustered, false, false, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		heartbeatMsgs, err := ch.Consume(topology.HeartbeatQueue, heartbeatConsumerTag+"."+alias, true, !clustered, false, false, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		rpcConsumers = append(rpcConsumers, aliasConsumer{alias, rpcMsgs})
+		heartbeatConsumers = append(heartbeatConsumers, aliasConsumer{alias, heartbeatMsgs})
+
+		da.mutex.Lock()
+		da.stats[alias] = &DeviceAliasStats{DeviceID: alias, RPCQueue: topology.RPCQueue}
+		da.mutex.Unlock()
+		log.Printf("[server] Listening on alias queues %s and %s", topology.RPCQueue, topology.HeartbeatQueue)
+	}
+	return mergeAliasConsumers(rpcConsumers), mergeAliasConsumers(heartbeatConsumers), nil
+}
+
+// aliasConsumer is the delivery channel of one alias queue
+type aliasConsumer struct {
+	alias      string
+	deliveries <-chan amqp.Delivery
+}
+
+// mergeAliasConsumers forwards the deliveries of several consumers to one
+// channel, closed when all of them are closed
+func mergeAliasConsumers(consumers []aliasConsumer) <-chan aliasDelivery {
+	merged := make(chan aliasDelivery)
+	var wg sync.WaitGroup
+	for _, consumer := range consumers {
+		wg.Add(1)
+		go func(consumer aliasConsumer) {
+			defer wg.Done()
+			for msg := range consumer.deliveries {
+				merged <- aliasDelivery{alias: consumer.alias, msg: msg}
+			}
+		}(consumer)
+	}
+	go func() {
+		wg.Wait()
+		close(merged)
+	}()
+	return merged
+}
+
+// record counts a request or heartbeat received under deviceID
+func (da *DeviceAliases) record(deviceID string, heartbeat bool) {
+	da.mutex.Lock()
+	defer da.mutex.Unlock()
+
+	stats, exists := da.stats[deviceID]
+	if !exists {
+		stats = &DeviceAliasStats{DeviceID: deviceID, RPCQueue: da.handler.rpcQueueName}
+		da.stats[deviceID] = stats
+	}
+	now := time.Now()
+	if heartbeat {
+		stats.Heartbeats++
+		stats.LastHeartbeat = now
+	} else {
+		stats.Requests++
+		stats.LastRequest = now
+	}
+}
+
+// Report returns the traffic received under the device ID and each alias
+func (da *DeviceAliases) Report() DeviceAliasReport {
+	da.mutex.Lock()
+	defer da.mutex.Unlock()
+
+	report := DeviceAliasReport{
+		Primary: DeviceAliasStats{DeviceID: da.handler.deviceID, RPCQueue: da.handler.rpcQueueName},
+		Aliases: make([]DeviceAliasStats, 0, len(da.aliases)),
+	}
+	if stats, exists := da.stats[da.handler.deviceID]; exists {
+		report.Primary = *stats
+	}
+	for _, alias := range da.aliases {
+		stats := DeviceAliasStats{DeviceID: alias}
+		if recorded, exists := da.stats[alias]; exists {
+			stats = *recorded
+		}
+		report.Aliases = append(report.Aliases, stats)
+	}
+	sort.Slice(report.Aliases, func(i, j int) bool { return report.Aliases[i].DeviceID < report.Aliases[j].DeviceID })
+	return report
+}
+
+// SetDeviceAliases makes the server also answer under the given device IDs,
+// typically the old ID of a renamed device, and registers the
+// getDeviceAliasStats function. Call before starting the server; an empty
+// list disables aliases.
+func (h *Handler) SetDeviceAliases(aliases []string) error {
+	if len(aliases) == 0 {
+		h.deviceAliases = nil
+		return nil
+	}
+
+	seen := make(map[string]bool, len(aliases))
+	for _, alias := range aliases {
+		if alias == "" || alias == h.deviceID || seen[alias] {
+			return fmt.Errorf("invalid device alias %q: aliases must be distinct and differ from the device ID", alias)
+		}
+		if _, err := client.NewTopology(h.namespace, alias); err != nil {
+			return fmt.Errorf("invalid device alias %q: %w", alias, err)
+		}
+		seen[alias] = true
+	}
+
+	h.deviceAliases = NewDeviceAliases(h, aliases)
+
+	h.RegisterFunctionWithMetadata("getDeviceAliasStats", func() DeviceAliasReport {
+		return h.deviceAliases.Report()
+	}, FunctionMetadata{Description: "Returns the requests received under the device ID and under each alias, to tell when an old name can be retired"})
+
+	log.Printf("[server] Device aliases configured: %s", strings.Join(aliases, ", "))
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd
+
+package server
+
+import "fmt"
+
+// diskUsage is not available on this platform; disk usage is reported as an
+// error.
+func diskUsage(path string) (total, free uint64, err error) {
+	return 0, 0, fmt.Errorf("disk usage is not supported on this platform")
+}
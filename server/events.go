@@ -0,0 +1,111 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// eventChannelPattern matches event channel names such as "alerts" or
+// "table:users:changed". Dots separate topic segments, so subscribers can
+// also bind with "*" and "#" wildcards.
+var eventChannelPattern = regexp.MustCompile(`^[A-Za-z0-9_:-]+(\.[A-Za-z0-9_:-]+)*$`)
+
+// Event is a message pushed to the subscribers of a channel
+type Event struct {
+	Channel   string      `json:"channel"`
+	DeviceID  string      `json:"deviceID"`
+	Timestamp time.Time   `json:"timestamp"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// setupEvents declares the device's events exchange and opens the channel
+// events are published on. Events are routed by channel name through a topic
+// exchange; each client subscription binds its own exclusive queue.
+func (h *Handler) setupEvents() error {
+	ch, err := h.conn.Channel()
+	if err != nil {
+		return fmt.Errorf("failed to open events channel: %w", err)
+	}
+
+	err = ch.ExchangeDeclare(
+		h.eventsExchangeName, // name - events exchange for this device
+		"topic",              // kind - route by channel name
+		false,                // durable - non-persistent like the device queues
+		false,                // auto-deleted - keep while no one subscribes
+		false,                // internal
+		false,                // no-wait
+		nil,                  // arguments
+	)
+	if err != nil {
+		ch.Close()
+		return fmt.Errorf("failed to declare events exchange: %w", client.ExplainAMQPError(err, h.amqpURL))
+	}
+
+	// Telemetry reports go out on the same channel
+	if h.telemetry != nil {
+		if err := h.declareTelemetryExchange(ch); err != nil {
+			ch.Close()
+			return err
+		}
+	}
+
+	h.eventsMutex.Lock()
+	h.eventsChannel = ch
+	h.eventsMutex.Unlock()
+	return nil
+}
+
+// closeEvents closes the events channel
+func (h *Handler) closeEvents() {
+	h.eventsMutex.Lock()
+	defer h.eventsMutex.Unlock()
+	if h.eventsChannel != nil {
+		h.eventsChannel.Close()
+		h.eventsChannel = nil
+	}
+}
+
+// PublishEvent pushes data to every client subscribed to channel. Events are
+// not stored: clients that are not subscribed when it is published miss it.
+//
+// Example:
+//
+//	handler.PublishEvent("alerts", map[string]interface{}{"level": "warning", "message": "disk 90% full"})
+//	handler.PublishEvent("table:users:changed", map[string]interface{}{"id": 42, "op": "update"})
+func (h *Handler) PublishEvent(channel string, data interface{}) error {
+	if !eventChannelPattern.MatchString(channel) {
+		return fmt.Errorf("invalid event channel '%s'", channel)
+	}
+
+	body, err := json.Marshal(Event{
+		Channel:   channel,
+		DeviceID:  h.deviceID,
+		Timestamp: time.Now(),
+		Data:      data,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	h.eventsMutex.Lock()
+	defer h.eventsMutex.Unlock()
+	if h.eventsChannel == nil {
+		return fmt.Errorf("server is not running")
+	}
+	return h.eventsChannel.Publish(
+		h.eventsExchangeName, // exchange
+		channel,              // routing key
+		false,                // mandatory - no subscribers is not an error
+		false,                // immediate
+		amqp.Publishing{
+			ContentType: "application/json",
+			Timestamp:   time.Now(),
+			Body:        body,
+		},
+	)
+}
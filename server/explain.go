@@ -0,0 +1,66 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// explainTimeout bounds an "explain" request; EXPLAIN does not run the query
+const explainTimeout = 10 * time.Second
+
+// handleExplain returns the execution plan of the query of an "explain"
+// request without running it. The plan is EXPLAIN FORMAT=JSON where the
+// database supports it, otherwise the rows of the traditional EXPLAIN
+// encoded as a JSON array. The query must pass SQL validation, as if it
+// were to run.
+func (h *Handler) handleExplain(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	if !explainable(req.Query) {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error: "only SELECT, INSERT, UPDATE, DELETE, REPLACE, TABLE and WITH statements can be explained",
+		})
+		return
+	}
+
+	validationResult := h.sqlValidator.ValidateQuery(req.Query, req.Params)
+	if !validationResult.Valid {
+		log.Printf("[server] SQL validation blocked explain from %s (risk: %s)", req.ClientIP, validationResult.Risk)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, validationFailedResponse(validationResult))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), explainTimeout)
+	defer cancel()
+
+	db, release, err := h.acquireDB()
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+		return
+	}
+	defer release()
+
+	format := "json"
+	var plan string
+	if jsonErr := db.QueryRowContext(ctx, "EXPLAIN FORMAT=JSON "+req.Query, req.Params...).Scan(&plan); jsonErr != nil {
+		rows, err := explainQuery(ctx, db, req.Query, req.Params)
+		if err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("explain failed: %v", err)})
+			return
+		}
+		encoded, err := json.Marshal(rows)
+		if err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("explain failed: %v", err)})
+			return
+		}
+		format, plan = "traditional", string(encoded)
+	}
+
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"format", "plan"},
+		Rows:    [][]interface{}{{format, plan}},
+	})
+}
@@ -0,0 +1,330 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ExportConfig holds configuration for export requests
+type ExportConfig struct {
+	MaxExports  int           // Exports open at the same time
+	ChunkSize   int           // Bytes of output returned per request
+	IdleTimeout time.Duration // Exports not fetched for this long are closed
+}
+
+// DefaultExportConfig returns the default export configuration
+func DefaultExportConfig() ExportConfig {
+	return ExportConfig{
+		MaxExports:  4,
+		ChunkSize:   256 * 1024,
+		IdleTimeout: time.Minute,
+	}
+}
+
+// ExportRequest is the query of an "export" request. The first request of
+// an export carries the SELECT (its parameters are the request parameters)
+// and the format; the following ones only the export ID.
+type ExportRequest struct {
+	ExportID string `json:"exportID"`
+	Query    string `json:"query,omitempty"`
+	Format   string `json:"format,omitempty"` // "csv" (default) or "ndjson"
+	Cancel   bool   `json:"cancel,omitempty"`
+}
+
+// exportDataPrefix marks export chunks so clients never mistake them for numbers
+const exportDataPrefix = "text:"
+
+// export is an open export cursor
+type export struct {
+	mutex    sync.Mutex // Serializes fetches
+	rows     *sql.Rows
+	columns  []string
+	colTypes []*sql.ColumnType
+	format   string
+	header   bool // CSV header still to be written
+	total    int64
+	lastUsed time.Time
+	cancel   context.CancelFunc
+	release  func()
+}
+
+// ExportManager keeps the cursors of running exports. Each request returns
+// the next chunk of output, so a result of any size is exported without
+// holding it in memory or converting it to the per-row JSON of SQL
+// responses.
+type ExportManager struct {
+	config ExportConfig
+
+	mutex   sync.Mutex
+	exports map[string]*export
+}
+
+// NewExportManager creates an export manager
+func NewExportManager(config ExportConfig) *ExportManager {
+	defaults := DefaultExportConfig()
+	if config.MaxExports <= 0 {
+		config.MaxExports = defaults.MaxExports
+	}
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = defaults.ChunkSize
+	}
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+	return &ExportManager{config: config, exports: make(map[string]*export)}
+}
+
+// run closes idle exports until ctx is done
+func (em *ExportManager) run(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			em.mutex.Lock()
+			for id, e := range em.exports {
+				e.close()
+				delete(em.exports, id)
+			}
+			em.mutex.Unlock()
+			return
+		case <-ticker.C:
+			em.mutex.Lock()
+			for id, e := range em.exports {
+				if e.mutex.TryLock() {
+					if time.Since(e.lastUsed) > em.config.IdleTimeout {
+						log.Printf("[server] Closing idle export %s after %d rows", id, e.total)
+						e.close()
+						delete(em.exports, id)
+					}
+					e.mutex.Unlock()
+				}
+			}
+			em.mutex.Unlock()
+		}
+	}
+}
+
+// close releases the cursor and connection of an export
+func (e *export) close() {
+	e.rows.Close()
+	e.cancel()
+	e.release()
+}
+
+// start runs the query of a new export
+func (em *ExportManager) start(h *Handler, id string, req ExportRequest, params []interface{}) error {
+	em.mutex.Lock()
+	if _, exists := em.exports[id]; exists {
+		em.mutex.Unlock()
+		return fmt.Errorf("export %s already exists", id)
+	}
+	if len(em.exports) >= em.config.MaxExports {
+		em.mutex.Unlock()
+		return fmt.Errorf("too many exports in progress (max %d)", em.config.MaxExports)
+	}
+	em.mutex.Unlock()
+
+	db, release, err := h.acquireDB()
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	rows, err := db.QueryContext(ctx, req.Query, params...)
+	if err != nil {
+		cancel()
+		release()
+		return err
+	}
+	columns, err := rows.Columns()
+	if err == nil {
+		var colTypes []*sql.ColumnType
+		if colTypes, err = rows.ColumnTypes(); err == nil {
+			e := &export{
+				rows: rows, columns: columns, colTypes: colTypes, format: req.Format, header: req.Format == "csv",
+				lastUsed: time.Now(), cancel: cancel, release: release,
+			}
+			em.mutex.Lock()
+			em.exports[id] = e
+			em.mutex.Unlock()
+			return nil
+		}
+	}
+	rows.Close()
+	cancel()
+	release()
+	return err
+}
+
+// next returns the next chunk of an export and whether it is the last one.
+// The export is closed after its last chunk.
+func (em *ExportManager) next(h *Handler, id string) (string, int, bool, error) {
+	em.mutex.Lock()
+	e, ok := em.exports[id]
+	em.mutex.Unlock()
+	if !ok {
+		return "", 0, false, fmt.Errorf("export %s not found (finished or idle for more than %v)", id, em.config.IdleTimeout)
+	}
+
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.lastUsed = time.Now()
+
+	chunk, count, done, err := e.read(h, em.config.ChunkSize)
+	if done || err != nil {
+		em.remove(id)
+	}
+	return chunk, count, done, err
+}
+
+// remove closes an export and forgets it
+func (em *ExportManager) remove(id string) {
+	em.mutex.Lock()
+	e, ok := em.exports[id]
+	delete(em.exports, id)
+	em.mutex.Unlock()
+	if ok {
+		e.close()
+	}
+}
+
+// read formats rows until the chunk reaches size bytes or the rows end
+func (e *export) read(h *Handler, size int) (string, int, bool, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if e.header {
+		writer.Write(e.columns)
+		e.header = false
+	}
+
+	count := 0
+	values := make([]interface{}, len(e.columns))
+	for buf.Len() < size {
+		if !e.rows.Next() {
+			writer.Flush()
+			if err := e.rows.Err(); err != nil {
+				return "", count, false, err
+			}
+			return buf.String(), count, true, nil
+		}
+
+		scanDest := make([]interface{}, len(e.columns))
+		for i := range scanDest {
+			scanDest[i] = &values[i]
+		}
+		if err := e.rows.Scan(scanDest...); err != nil {
+			return "", count, false, err
+		}
+		for i := range values {
+			values[i] = h.convertDatabaseValue(values[i], e.colTypes[i])
+		}
+
+		if e.format == "ndjson" {
+			buf.WriteByte('{')
+			for i, column := range e.columns {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				key, _ := json.Marshal(column)
+				value, err := json.Marshal(values[i])
+				if err != nil {
+					value, _ = json.Marshal(fmt.Sprint(values[i]))
+				}
+				buf.Write(key)
+				buf.WriteByte(':')
+				buf.Write(value)
+			}
+			buf.WriteString("}\n")
+		} else {
+			record := make([]string, len(values))
+			for i, value := range values {
+				if value != nil {
+					record[i] = fmt.Sprint(value)
+				}
+			}
+			writer.Write(record)
+			writer.Flush()
+		}
+		count++
+		e.total++
+	}
+	writer.Flush()
+	return buf.String(), count, false, writer.Error()
+}
+
+// SetExportConfig configures export requests
+func (h *Handler) SetExportConfig(config ExportConfig) {
+	h.exports = NewExportManager(config)
+	log.Printf("[server] Exports configured: max=%d chunk=%d bytes idle_timeout=%v",
+		h.exports.config.MaxExports, h.exports.config.ChunkSize, h.exports.config.IdleTimeout)
+}
+
+// handleExport starts an export or returns its next chunk
+func (h *Handler) handleExport(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	var exportReq ExportRequest
+	if err := json.Unmarshal([]byte(req.Query), &exportReq); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("invalid export request: %v", err)})
+		return
+	}
+	if exportReq.ExportID == "" {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "export request without exportID"})
+		return
+	}
+
+	if exportReq.Cancel {
+		h.exports.remove(exportReq.ExportID)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Columns: []string{"exportID", "cancelled"},
+			Rows:    [][]interface{}{{exportReq.ExportID, true}},
+		})
+		return
+	}
+
+	if exportReq.Query != "" {
+		if exportReq.Format == "" {
+			exportReq.Format = "csv"
+		}
+		if exportReq.Format != "csv" && exportReq.Format != "ndjson" {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("unsupported export format: %s", exportReq.Format)})
+			return
+		}
+		if !isReadOnlyQuery(exportReq.Query) {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "only SELECT queries can be exported"})
+			return
+		}
+
+		validationResult := h.sqlValidator.ValidateStreamingQuery(exportReq.Query, req.Params)
+		if !validationResult.Valid {
+			log.Printf("[server] SQL validation blocked export from %s: %s (risk: %s)",
+				req.ClientIP, h.loggedQuery(exportReq.Query, 50), validationResult.Risk)
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, validationFailedResponse(validationResult))
+			return
+		}
+
+		if err := h.exports.start(h, exportReq.ExportID, exportReq, req.Params); err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("export failed: %v", err)})
+			return
+		}
+		log.Printf("[server] Export %s started (%s): %s", exportReq.ExportID, exportReq.Format, h.loggedQuery(exportReq.Query, 50))
+	}
+
+	chunk, count, done, err := h.exports.next(h, exportReq.ExportID)
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("export failed: %v", err)})
+		return
+	}
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"data", "rows", "done"},
+		Rows:    [][]interface{}{{exportDataPrefix + chunk, count, done}},
+	})
+}
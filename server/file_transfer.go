@@ -0,0 +1,464 @@
+package server
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// FileTransferConfig holds configuration for the file.get and file.put
+// request types
+type FileTransferConfig struct {
+	Enabled       bool     `json:"enabled"`        // Whether file transfers are accepted
+	GetPaths      []string `json:"get_paths"`      // Directories or glob patterns clients may download from
+	PutPaths      []string `json:"put_paths"`      // Directories or glob patterns clients may upload to
+	MaxFileSize   int64    `json:"max_file_size"`  // Largest file transferred in either direction, in bytes
+	ChunkSize     int      `json:"chunk_size"`     // Largest chunk per request, in bytes
+	UploadTimeout Duration `json:"upload_timeout"` // Unfinished uploads idle this long are discarded
+}
+
+// DefaultFileTransferConfig returns a disabled file transfer configuration
+func DefaultFileTransferConfig() FileTransferConfig {
+	return FileTransferConfig{
+		Enabled:       false,
+		MaxFileSize:   100 << 20,
+		ChunkSize:     256 << 10,
+		UploadTimeout: Duration(10 * time.Minute),
+	}
+}
+
+// LoadFileTransferConfig reads a file transfer configuration from a JSON file.
+//
+// Example:
+//
+//	{
+//	  "enabled": true,
+//	  "get_paths": ["/var/log/myapp", "/etc/myapp/*.conf"],
+//	  "put_paths": ["/etc/myapp/*.conf"],
+//	  "max_file_size": 52428800
+//	}
+func LoadFileTransferConfig(path string) (FileTransferConfig, error) {
+	config := DefaultFileTransferConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read file transfer config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse file transfer config %s: %w", path, err)
+	}
+	return config, config.Validate()
+}
+
+// Validate checks the allowlists and limits
+func (fc FileTransferConfig) Validate() error {
+	for _, paths := range [][]string{fc.GetPaths, fc.PutPaths} {
+		for _, path := range paths {
+			if !filepath.IsAbs(path) {
+				return fmt.Errorf("file transfer path %q must be absolute", path)
+			}
+			if _, err := filepath.Match(path, ""); err != nil {
+				return fmt.Errorf("file transfer path %q: %w", path, err)
+			}
+		}
+	}
+	if fc.MaxFileSize < 0 || fc.ChunkSize < 0 {
+		return fmt.Errorf("file transfer limits must not be negative")
+	}
+	return nil
+}
+
+// FileRequest is the body of a file.get or file.put request.
+//
+// A download starts with a request without Length, answered with the size
+// and SHA-256 checksum of the file and the largest chunk served, followed by
+// one request per chunk. An upload sends the chunks in order: the first one
+// (which may be empty) opens the upload and returns its ID and the largest
+// chunk accepted; the one with Final set carries the checksum of the whole
+// file, which is verified before the file replaces the target atomically.
+type FileRequest struct {
+	Path          string `json:"path"`                    // Absolute path on the device
+	Offset        int64  `json:"offset"`                  // Position of the chunk in the file
+	Length        int    `json:"length,omitempty"`        // file.get: bytes to read (0 = size and checksum only)
+	Data          []byte `json:"data,omitempty"`          // file.put: chunk contents
+	ChunkChecksum string `json:"chunkChecksum,omitempty"` // file.put: "sha256:<hex>" of Data
+	UploadID      string `json:"uploadID,omitempty"`      // file.put: upload the chunk belongs to (empty for the first)
+	Final         bool   `json:"final,omitempty"`         // file.put: last chunk
+	Checksum      string `json:"checksum,omitempty"`      // file.put: "sha256:<hex>" of the whole file, with Final
+}
+
+// fileUpload is an upload in progress
+type fileUpload struct {
+	path         string    // Resolved target path
+	temp         *os.File  // Temporary file in the target directory
+	written      int64     // Bytes received so far
+	hash         hash.Hash // Running SHA-256 of the received bytes
+	lastActivity time.Time
+}
+
+// FileTransferManager serves chunked downloads and uploads of allowlisted
+// files through the broker.
+type FileTransferManager struct {
+	config   FileTransferConfig
+	getPaths []string
+	putPaths []string
+
+	mutex   sync.Mutex
+	uploads map[string]*fileUpload
+}
+
+// NewFileTransferManager creates a file transfer manager; config must be valid
+func NewFileTransferManager(config FileTransferConfig) *FileTransferManager {
+	defaults := DefaultFileTransferConfig()
+	if config.MaxFileSize <= 0 {
+		config.MaxFileSize = defaults.MaxFileSize
+	}
+	if config.ChunkSize <= 0 {
+		config.ChunkSize = defaults.ChunkSize
+	}
+	if config.UploadTimeout <= 0 {
+		config.UploadTimeout = defaults.UploadTimeout
+	}
+
+	return &FileTransferManager{
+		config:   config,
+		getPaths: resolveAllowedPaths(config.GetPaths),
+		putPaths: resolveAllowedPaths(config.PutPaths),
+		uploads:  make(map[string]*fileUpload),
+	}
+}
+
+// resolveAllowedPaths resolves symlinks in allowlist entries so they match
+// resolved request paths
+func resolveAllowedPaths(paths []string) []string {
+	resolved := make([]string, 0, len(paths))
+	for _, path := range paths {
+		path = filepath.Clean(path)
+		if !strings.ContainsAny(path, "*?[") {
+			if real, err := filepath.EvalSymlinks(path); err == nil {
+				path = real
+			}
+		} else if dir := filepath.Dir(path); !strings.ContainsAny(dir, "*?[") {
+			if real, err := filepath.EvalSymlinks(dir); err == nil {
+				path = filepath.Join(real, filepath.Base(path))
+			}
+		}
+		resolved = append(resolved, path)
+	}
+	return resolved
+}
+
+// resolvePath cleans path and resolves symlinks, so a link inside an
+// allowed directory cannot reach a file outside of it. A missing file is
+// resolved through its directory.
+func resolvePath(path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("path %q must be absolute", path)
+	}
+	path = filepath.Clean(path)
+
+	if real, err := filepath.EvalSymlinks(path); err == nil {
+		return real, nil
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return "", fmt.Errorf("directory of %s: %w", path, err)
+	}
+	return filepath.Join(dir, filepath.Base(path)), nil
+}
+
+// pathAllowed reports whether path is below an allowed directory or
+// matches an allowed glob pattern
+func pathAllowed(path string, allowed []string) bool {
+	for _, entry := range allowed {
+		if strings.ContainsAny(entry, "*?[") {
+			if ok, _ := filepath.Match(entry, path); ok {
+				return true
+			}
+			continue
+		}
+		if rel, err := filepath.Rel(entry, path); err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+// Values in file transfer responses carry a prefix so the client driver,
+// which turns numeric-looking strings into numbers, leaves them intact
+const (
+	checksumPrefix = "sha256:"
+	dataPrefix     = "base64:"
+)
+
+// formatChecksum returns a SHA-256 sum as "sha256:<hex>"
+func formatChecksum(sum []byte) string {
+	return checksumPrefix + hex.EncodeToString(sum)
+}
+
+// checksum returns the SHA-256 of data as "sha256:<hex>"
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return formatChecksum(sum[:])
+}
+
+// Get serves a download request. Without Length it returns the file's size,
+// modification time and checksum; otherwise the requested chunk.
+func (fm *FileTransferManager) Get(req FileRequest) (RPCResponse, error) {
+	path, err := resolvePath(req.Path)
+	if err != nil {
+		return RPCResponse{}, err
+	}
+	if !pathAllowed(path, fm.getPaths) {
+		return RPCResponse{}, fmt.Errorf("download of %s is not allowed", req.Path)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return RPCResponse{}, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return RPCResponse{}, err
+	}
+	if !info.Mode().IsRegular() {
+		return RPCResponse{}, fmt.Errorf("%s is not a regular file", req.Path)
+	}
+	if info.Size() > fm.config.MaxFileSize {
+		return RPCResponse{}, fmt.Errorf("%s is %d bytes, larger than the %d byte limit", req.Path, info.Size(), fm.config.MaxFileSize)
+	}
+
+	if req.Length <= 0 {
+		hasher := sha256.New()
+		if _, err := io.Copy(hasher, file); err != nil {
+			return RPCResponse{}, err
+		}
+		return RPCResponse{
+			Columns: []string{"path", "size", "mod_time", "checksum", "chunk_size"},
+			Rows:    [][]interface{}{{req.Path, info.Size(), info.ModTime(), formatChecksum(hasher.Sum(nil)), fm.config.ChunkSize}},
+		}, nil
+	}
+
+	length := req.Length
+	if length > fm.config.ChunkSize {
+		length = fm.config.ChunkSize
+	}
+	if req.Offset < 0 {
+		return RPCResponse{}, fmt.Errorf("invalid offset %d", req.Offset)
+	}
+	data := make([]byte, length)
+	n, err := file.ReadAt(data, req.Offset)
+	if err != nil && err != io.EOF {
+		return RPCResponse{}, err
+	}
+	data = data[:n]
+	eof := req.Offset+int64(n) >= info.Size()
+
+	return RPCResponse{
+		Columns: []string{"offset", "data", "chunk_checksum", "eof"},
+		Rows:    [][]interface{}{{req.Offset, dataPrefix + base64.StdEncoding.EncodeToString(data), checksum(data), eof}},
+	}, nil
+}
+
+// Put stores an upload chunk and, on the final chunk, verifies the checksum
+// and moves the file into place.
+func (fm *FileTransferManager) Put(req FileRequest) (RPCResponse, error) {
+	fm.purgeStaleUploads()
+
+	if req.ChunkChecksum != "" && checksum(req.Data) != req.ChunkChecksum {
+		return RPCResponse{}, fmt.Errorf("chunk checksum mismatch at offset %d", req.Offset)
+	}
+	if len(req.Data) > fm.config.ChunkSize {
+		return RPCResponse{}, fmt.Errorf("chunk of %d bytes exceeds the %d byte limit", len(req.Data), fm.config.ChunkSize)
+	}
+
+	upload, err := fm.upload(&req)
+	if err != nil {
+		return RPCResponse{}, err
+	}
+
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	if req.Offset != upload.written {
+		return RPCResponse{}, fmt.Errorf("expected chunk at offset %d, got %d", upload.written, req.Offset)
+	}
+	if upload.written+int64(len(req.Data)) > fm.config.MaxFileSize {
+		fm.abortUpload(req.UploadID, upload)
+		return RPCResponse{}, fmt.Errorf("upload exceeds the %d byte limit", fm.config.MaxFileSize)
+	}
+	if _, err := upload.temp.Write(req.Data); err != nil {
+		fm.abortUpload(req.UploadID, upload)
+		return RPCResponse{}, err
+	}
+	upload.hash.Write(req.Data)
+	upload.written += int64(len(req.Data))
+	upload.lastActivity = time.Now()
+
+	sum := formatChecksum(upload.hash.Sum(nil))
+	if !req.Final {
+		return RPCResponse{
+			Columns: []string{"upload_id", "size", "checksum", "done", "chunk_size"},
+			Rows:    [][]interface{}{{req.UploadID, upload.written, sum, false, fm.config.ChunkSize}},
+		}, nil
+	}
+
+	defer fm.abortUpload(req.UploadID, upload)
+	if req.Checksum != "" && req.Checksum != sum {
+		return RPCResponse{}, fmt.Errorf("checksum mismatch: received %s, expected %s", sum, req.Checksum)
+	}
+	if err := upload.temp.Sync(); err != nil {
+		return RPCResponse{}, err
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(upload.path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := upload.temp.Chmod(mode); err != nil {
+		return RPCResponse{}, err
+	}
+	if err := os.Rename(upload.temp.Name(), upload.path); err != nil {
+		return RPCResponse{}, err
+	}
+
+	log.Printf("[server] Received %s (%d bytes, %s)", upload.path, upload.written, sum)
+	return RPCResponse{
+		Columns: []string{"upload_id", "size", "checksum", "done", "chunk_size"},
+		Rows:    [][]interface{}{{req.UploadID, upload.written, sum, true, fm.config.ChunkSize}},
+	}, nil
+}
+
+// upload returns the upload a chunk belongs to, opening a new one for the
+// first chunk (req.UploadID is set to its ID)
+func (fm *FileTransferManager) upload(req *FileRequest) (*fileUpload, error) {
+	if req.UploadID != "" {
+		fm.mutex.Lock()
+		defer fm.mutex.Unlock()
+		upload, ok := fm.uploads[req.UploadID]
+		if !ok {
+			return nil, fmt.Errorf("unknown or expired upload %s", req.UploadID)
+		}
+		return upload, nil
+	}
+
+	if req.Offset != 0 {
+		return nil, fmt.Errorf("the first chunk of an upload must start at offset 0")
+	}
+	path, err := resolvePath(req.Path)
+	if err != nil {
+		return nil, err
+	}
+	if !pathAllowed(path, fm.putPaths) {
+		return nil, fmt.Errorf("upload to %s is not allowed", req.Path)
+	}
+	if info, err := os.Stat(path); err == nil && !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("%s is not a regular file", req.Path)
+	}
+
+	// The temporary file lives next to the target so the final rename is atomic
+	temp, err := os.CreateTemp(filepath.Dir(path), ".burrowctl-upload-*")
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+	req.UploadID = "upload-" + hex.EncodeToString(id)
+
+	upload := &fileUpload{path: path, temp: temp, hash: sha256.New(), lastActivity: time.Now()}
+	fm.mutex.Lock()
+	fm.uploads[req.UploadID] = upload
+	fm.mutex.Unlock()
+	return upload, nil
+}
+
+// abortUpload forgets an upload and removes its temporary file (a no-op
+// after a successful rename); the caller must hold the mutex
+func (fm *FileTransferManager) abortUpload(id string, upload *fileUpload) {
+	delete(fm.uploads, id)
+	upload.temp.Close()
+	os.Remove(upload.temp.Name())
+}
+
+// purgeStaleUploads discards uploads idle for longer than UploadTimeout
+func (fm *FileTransferManager) purgeStaleUploads() {
+	fm.mutex.Lock()
+	defer fm.mutex.Unlock()
+
+	cutoff := time.Now().Add(-time.Duration(fm.config.UploadTimeout))
+	for id, upload := range fm.uploads {
+		if upload.lastActivity.Before(cutoff) {
+			log.Printf("[server] Discarding stale upload %s to %s after %d bytes", id, upload.path, upload.written)
+			fm.abortUpload(id, upload)
+		}
+	}
+}
+
+// SetFileTransferConfig enables the file.get and file.put request types
+func (h *Handler) SetFileTransferConfig(config FileTransferConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if !config.Enabled {
+		h.fileTransfer = nil
+		return nil
+	}
+
+	h.fileTransfer = NewFileTransferManager(config)
+	log.Printf("[server] File transfer enabled: %d download paths, %d upload paths, max %d bytes",
+		len(config.GetPaths), len(config.PutPaths), h.fileTransfer.config.MaxFileSize)
+	return nil
+}
+
+// handleFileTransfer serves file.get and file.put requests
+func (h *Handler) handleFileTransfer(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	if h.fileTransfer == nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "file transfer is not enabled on this device"})
+		return
+	}
+
+	var fileReq FileRequest
+	if err := json.Unmarshal([]byte(req.Query), &fileReq); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("invalid file request: %v", err)})
+		return
+	}
+
+	var (
+		resp RPCResponse
+		err  error
+	)
+	if req.Type == "file.get" {
+		resp, err = h.fileTransfer.Get(fileReq)
+	} else {
+		resp, err = h.fileTransfer.Put(fileReq)
+	}
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("%s failed: %v", req.Type, err)})
+		return
+	}
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, resp)
+}
+
+// fileAuditQuery describes a file request for the audit log without its data
+func fileAuditQuery(req RPCRequest) string {
+	var fileReq FileRequest
+	if err := json.Unmarshal([]byte(req.Query), &fileReq); err != nil {
+		return req.Type
+	}
+	return fmt.Sprintf("%s %s @%d", req.Type, fileReq.Path, fileReq.Offset)
+}
@@ -0,0 +1,267 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// functionNamePattern matches flat ("getStatus") and namespaced ("system.df", "app.jobs.reindex") names
+var functionNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*(\.[A-Za-z_][A-Za-z0-9_-]*)*$`)
+
+// FunctionParamInfo describes one parameter of a registered function
+type FunctionParamInfo struct {
+	Name        string `json:"name"`                  // Parameter name shown to clients
+	Type        string `json:"type"`                  // Go type expected by the function (taken from the signature when empty)
+	Description string `json:"description,omitempty"` // What the parameter means
+}
+
+// FunctionMetadata documents a registered function for discovery through listFunctions
+type FunctionMetadata struct {
+	Description string              // One-line summary of what the function does
+	Params      []FunctionParamInfo // Parameters in call order
+}
+
+// FunctionInfo is the discovery entry of a registered function
+type FunctionInfo struct {
+	Name        string              `json:"name"`                  // Full name used to call the function
+	Namespace   string              `json:"namespace"`             // Name up to the last dot ("" for flat names)
+	Description string              `json:"description,omitempty"` // Description from FunctionMetadata
+	Params      []FunctionParamInfo `json:"params"`                // Parameters in call order
+	Returns     []string            `json:"returns"`               // Go types of the return values
+}
+
+// FunctionCatalog is the result of the built-in listFunctions function
+type FunctionCatalog struct {
+	DeviceID  string         `json:"device_id"`
+	Functions []FunctionInfo `json:"functions"`
+}
+
+// functionNamespace returns the namespace part of a function name
+func functionNamespace(name string) string {
+	if i := strings.LastIndex(name, "."); i >= 0 {
+		return name[:i]
+	}
+	return ""
+}
+
+// validateFunction checks the name and that function is actually a function
+func validateFunction(name string, function interface{}) error {
+	if !functionNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid function name '%s' (use letters, digits, '_' and '-', with '.' separating namespaces)", name)
+	}
+	if function == nil || reflect.TypeOf(function).Kind() != reflect.Func {
+		return fmt.Errorf("'%s' is not a function", name)
+	}
+	return nil
+}
+
+// RegisterFunctionWithMetadata registers a function together with its
+// description and parameter documentation, which clients can discover through
+// the built-in listFunctions function. Parameter types left empty are filled
+// in from the function signature.
+//
+// Parameters:
+//   - name: Function name, optionally namespaced with dots (e.g. "system.df")
+//   - function: The actual function to register
+//   - metadata: Description and parameter documentation
+func (h *Handler) RegisterFunctionWithMetadata(name string, function interface{}, metadata FunctionMetadata) {
+	if err := validateFunction(name, function); err != nil {
+		log.Printf("[server] Function not registered: %v", err)
+		return
+	}
+
+	funcType := reflect.TypeOf(function)
+	if len(metadata.Params) > 0 && len(metadata.Params) != funcType.NumIn() {
+		log.Printf("[server] Function '%s' not registered: metadata describes %d parameters, function takes %d",
+			name, len(metadata.Params), funcType.NumIn())
+		return
+	}
+
+	params := make([]FunctionParamInfo, len(metadata.Params))
+	copy(params, metadata.Params)
+	for i := range params {
+		if params[i].Type == "" {
+			params[i].Type = funcType.In(i).String()
+		}
+	}
+	metadata.Params = params
+
+	h.RegisterFunction(name, function)
+	if h.functionMetadata == nil {
+		h.functionMetadata = make(map[string]FunctionMetadata)
+	}
+	h.functionMetadata[name] = metadata
+}
+
+// ListFunctions returns the discovery information of every registered
+// function, sorted by name. A non-empty namespace restricts the list to that
+// namespace and its sub-namespaces.
+func (h *Handler) ListFunctions(namespace string) []FunctionInfo {
+	functions := make([]FunctionInfo, 0, len(h.functionRegistry))
+	for name, function := range h.functionRegistry {
+		ns := functionNamespace(name)
+		if namespace != "" && ns != namespace && !strings.HasPrefix(ns, namespace+".") {
+			continue
+		}
+
+		funcType := reflect.TypeOf(function)
+		metadata := h.functionMetadata[name]
+		info := FunctionInfo{
+			Name:        name,
+			Namespace:   ns,
+			Description: metadata.Description,
+			Params:      metadata.Params,
+			Returns:     make([]string, funcType.NumOut()),
+		}
+		if len(info.Params) == 0 {
+			info.Params = make([]FunctionParamInfo, funcType.NumIn())
+			for i := range info.Params {
+				info.Params[i] = FunctionParamInfo{Name: fmt.Sprintf("arg%d", i+1), Type: funcType.In(i).String()}
+			}
+		}
+		for i := range info.Returns {
+			info.Returns[i] = funcType.Out(i).String()
+		}
+		functions = append(functions, info)
+	}
+
+	sort.Slice(functions, func(i, j int) bool { return functions[i].Name < functions[j].Name })
+	return functions
+}
+
+// registerBuiltinFunctions registers the functions every handler provides
+func (h *Handler) registerBuiltinFunctions() {
+	h.RegisterFunctionWithMetadata("listFunctions", func(namespace string) FunctionCatalog {
+		return FunctionCatalog{DeviceID: h.deviceID, Functions: h.ListFunctions(namespace)}
+	}, FunctionMetadata{
+		Description: "Lists the callable functions with their parameters and return types",
+		Params: []FunctionParamInfo{
+			{Name: "namespace", Description: "Only list functions in this namespace (empty for all)"},
+		},
+	})
+	h.RegisterFunctionWithMetadata("getJobStatus", func(id string) JobStatus {
+		status, _ := h.jobs.Status(id)
+		return status
+	}, FunctionMetadata{
+		Description: "Returns the state, progress and result of an asynchronous job",
+		Params:      []FunctionParamInfo{{Name: "id", Description: "Job ID returned when the job was submitted"}},
+	})
+	h.RegisterFunctionWithMetadata("cancelJob", func(id string) error {
+		return h.jobs.Cancel(id)
+	}, FunctionMetadata{
+		Description: "Cancels a queued or running asynchronous job",
+		Params:      []FunctionParamInfo{{Name: "id", Description: "Job ID returned when the job was submitted"}},
+	})
+}
+
+// Function execution error codes sent in RPCResponse.ErrorCode
+const (
+	ErrFunctionPanic   = "FUNCTION_PANIC"   // The function panicked; the panic was recovered
+	ErrFunctionTimeout = "FUNCTION_TIMEOUT" // The function did not return before the request deadline
+)
+
+// FunctionPanicError reports a panic recovered while executing a registered function
+type FunctionPanicError struct {
+	Function string      // Name of the function that panicked
+	Value    interface{} // Value passed to panic
+	Stack    string      // Stack trace of the panicking goroutine (logged, not sent to clients)
+}
+
+func (e *FunctionPanicError) Error() string {
+	return fmt.Sprintf("function '%s' panicked: %v", e.Function, e.Value)
+}
+
+// FunctionStats holds execution counters for a registered function
+type FunctionStats struct {
+	Calls       int64     `json:"calls"`
+	Panics      int64     `json:"panics"`
+	Timeouts    int64     `json:"timeouts"`
+	LastPanic   string    `json:"last_panic,omitempty"`
+	LastPanicAt time.Time `json:"last_panic_at,omitempty"`
+}
+
+// functionStatsRegistry tracks FunctionStats by function name
+type functionStatsRegistry struct {
+	mutex sync.Mutex
+	stats map[string]*FunctionStats
+}
+
+// newFunctionStatsRegistry creates an empty registry
+func newFunctionStatsRegistry() *functionStatsRegistry {
+	return &functionStatsRegistry{stats: make(map[string]*FunctionStats)}
+}
+
+// update applies fn to the stats of name under the lock
+func (r *functionStatsRegistry) update(name string, fn func(*FunctionStats)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	stats, ok := r.stats[name]
+	if !ok {
+		stats = &FunctionStats{}
+		r.stats[name] = stats
+	}
+	fn(stats)
+}
+
+// snapshot returns a copy of all stats
+func (r *functionStatsRegistry) snapshot() map[string]FunctionStats {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	result := make(map[string]FunctionStats, len(r.stats))
+	for name, stats := range r.stats {
+		result[name] = *stats
+	}
+	return result
+}
+
+// GetFunctionStats returns call, panic and timeout counters per function
+func (h *Handler) GetFunctionStats() map[string]FunctionStats {
+	return h.functionStats.snapshot()
+}
+
+// callFunction invokes a registered function in its own goroutine so a panic
+// is converted into a FunctionPanicError and a function that outlives ctx
+// cannot hold the worker beyond the request deadline. A timed-out function
+// keeps running in the background until it returns.
+func (h *Handler) callFunction(ctx context.Context, name string, funcValue reflect.Value, params []reflect.Value) ([]reflect.Value, error) {
+	type callResult struct {
+		values []reflect.Value
+		err    error
+	}
+	done := make(chan callResult, 1)
+
+	h.functionStats.update(name, func(s *FunctionStats) { s.Calls++ })
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				panicErr := &FunctionPanicError{Function: name, Value: r, Stack: string(debug.Stack())}
+				log.Printf("[server] %v\n%s", panicErr, panicErr.Stack)
+				h.functionStats.update(name, func(s *FunctionStats) {
+					s.Panics++
+					s.LastPanic = fmt.Sprintf("%v", r)
+					s.LastPanicAt = time.Now()
+				})
+				done <- callResult{err: panicErr}
+			}
+		}()
+		done <- callResult{values: funcValue.Call(params)}
+	}()
+
+	select {
+	case result := <-done:
+		return result.values, result.err
+	case <-ctx.Done():
+		h.functionStats.update(name, func(s *FunctionStats) { s.Timeouts++ })
+		log.Printf("[server] Function '%s' did not return before the deadline; it keeps running in the background", name)
+		return nil, fmt.Errorf("function '%s' timed out: %w", name, ctx.Err())
+	}
+}
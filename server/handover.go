@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// HandoverConfig holds configuration for rolling upgrades.
+//
+// A server that starts while another instance consumes the device queue asks
+// it, over the device's control queue, to hand the queue over: the running
+// instance stops consuming, so new requests wait in the queue, finishes the
+// requests it already received, answers, and shuts down. The new instance
+// then takes over the queue, and no request is dropped.
+type HandoverConfig struct {
+	Enabled bool          // Ask a running instance to hand over, and hand over when asked
+	Timeout time.Duration // How long the running instance may take to drain
+}
+
+// DefaultHandoverConfig returns the default handover configuration
+func DefaultHandoverConfig() HandoverConfig {
+	return HandoverConfig{
+		Enabled: true,
+		Timeout: 30 * time.Second,
+	}
+}
+
+// handoverMessage is exchanged on the control queue
+type handoverMessage struct {
+	Type     string `json:"type"`               // "handover" (request) or "drained" (response)
+	From     string `json:"from"`               // Host and PID of the sender
+	Pending  int    `json:"pending,omitempty"`  // Requests that were still running when consuming stopped
+	Rollback int    `json:"rollback,omitempty"` // Open transactions rolled back
+}
+
+// Consumer tags, so consumers can be cancelled during a handover
+const (
+	rpcConsumerTag       = "burrowctl-rpc"
+	heartbeatConsumerTag = "burrowctl-heartbeat"
+	controlConsumerTag   = "burrowctl-control"
+)
+
+// SetHandoverConfig configures rolling upgrade handovers
+func (h *Handler) SetHandoverConfig(config HandoverConfig) {
+	if config.Timeout <= 0 {
+		config.Timeout = DefaultHandoverConfig().Timeout
+	}
+	h.handover = config
+}
+
+// handoverIdentity returns the host and PID of this process
+func handoverIdentity() string {
+	hostname, _ := os.Hostname()
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
+
+// amqpUser returns the user name in the AMQP URL
+func (h *Handler) amqpUser() string {
+	parsed, err := url.Parse(h.amqpURL)
+	if err != nil || parsed.User == nil {
+		return ""
+	}
+	return parsed.User.Username()
+}
+
+// requestHandover asks the instance consuming the device queue to hand it
+// over and waits until it has drained. It returns an error when no answer
+// arrives, e.g. because the running instance predates handovers.
+func (h *Handler) requestHandover(ctx context.Context, controlQueue string) error {
+	ch, err := h.conn.Channel()
+	if err != nil {
+		return err
+	}
+	defer ch.Close()
+
+	replyQueue, err := ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return fmt.Errorf("failed to declare handover reply queue: %w", client.ExplainAMQPError(err, h.amqpURL))
+	}
+	replies, err := ch.Consume(replyQueue.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	body, _ := json.Marshal(handoverMessage{Type: "handover", From: handoverIdentity()})
+	corrID := fmt.Sprintf("handover_%d", time.Now().UnixNano())
+	err = ch.PublishWithContext(ctx, "", controlQueue, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: corrID,
+		ReplyTo:       replyQueue.Name,
+		UserId:        h.amqpUser(), // Verified by the broker, checked by the running instance
+		Body:          body,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to request handover: %w", err)
+	}
+	log.Printf("[server] Another instance is consuming %s: requesting handover", h.rpcQueueName)
+
+	// Leave the running instance its drain timeout, plus time to answer
+	timeout := time.NewTimer(h.handover.Timeout + 10*time.Second)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return fmt.Errorf("no handover answer within %s", h.handover.Timeout+10*time.Second)
+		case msg := <-replies:
+			if msg.CorrelationId != corrID {
+				continue
+			}
+			var reply handoverMessage
+			json.Unmarshal(msg.Body, &reply)
+			log.Printf("[server] Instance %s handed over after finishing %d requests (%d open transactions rolled back)",
+				reply.From, reply.Pending, reply.Rollback)
+			return nil
+		}
+	}
+}
+
+// acceptHandover checks a handover request and stops consuming the device
+// queues. It returns false when the request is refused.
+func (h *Handler) acceptHandover(ch *amqp.Channel, msg amqp.Delivery) bool {
+	var request handoverMessage
+	if err := json.Unmarshal(msg.Body, &request); err != nil || request.Type != "handover" {
+		log.Printf("[server] Ignoring malformed control message")
+		return false
+	}
+	// Only another server with the same credentials may take over
+	if user := h.amqpUser(); user != "" && msg.UserId != user {
+		log.Printf("[server] Refusing handover to %s: message user '%s' is not '%s'", request.From, msg.UserId, user)
+		return false
+	}
+
+	log.Printf("[server] Handing over to %s: draining (timeout %s)", request.From, h.handover.Timeout)
+	tags := []string{rpcConsumerTag, heartbeatConsumerTag, controlConsumerTag}
+	if h.deviceAliases != nil {
+		tags = append(tags, h.deviceAliases.consumerTags()...)
+	}
+	for _, tag := range tags {
+		if err := ch.Cancel(tag, false); err != nil {
+			log.Printf("[server] Failed to cancel consumer %s: %v", tag, err)
+		}
+	}
+	return true
+}
+
+// drainForHandover waits for received requests to finish, rolls back
+// transactions that are still open (their next statements go to the new
+// instance) and answers the handover request. It must run once every
+// received request was submitted to the worker pool; done is closed
+// afterwards.
+func (h *Handler) drainForHandover(ch *amqp.Channel, msg amqp.Delivery, done chan<- struct{}) {
+	defer close(done)
+
+	stats := h.workerPool.GetStats()
+	pending := stats.QueuedTasks + stats.ActiveTasks + stats.DelayedTasks
+	deadline := time.Now().Add(h.handover.Timeout)
+	for time.Now().Before(deadline) {
+		stats := h.workerPool.GetStats()
+		if stats.QueuedTasks == 0 && stats.ActiveTasks == 0 && stats.DelayedTasks == 0 {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if stats := h.workerPool.GetStats(); stats.QueuedTasks+stats.ActiveTasks+stats.DelayedTasks > 0 {
+		log.Printf("[server] Drain timeout: %d requests still running", stats.QueuedTasks+stats.ActiveTasks+stats.DelayedTasks)
+	}
+
+	rolledBack := 0
+	for _, id := range h.transactionManager.ActiveTransactionIDs() {
+		if err := h.transactionManager.RollbackTransaction(id); err == nil {
+			rolledBack++
+		}
+	}
+	if rolledBack > 0 {
+		log.Printf("[server] Rolled back %d open transactions before handover", rolledBack)
+	}
+
+	body, _ := json.Marshal(handoverMessage{Type: "drained", From: handoverIdentity(), Pending: pending, Rollback: rolledBack})
+	if err := ch.PublishWithContext(context.Background(), "", msg.ReplyTo, false, false, amqp.Publishing{
+		ContentType:   "application/json",
+		CorrelationId: msg.CorrelationId,
+		Body:          body,
+	}); err != nil {
+		log.Printf("[server] Failed to answer handover request: %v", err)
+	}
+}
@@ -1,12 +1,12 @@
 package server
 
 import (
-	"context"
 	"encoding/json"
 	"log"
 	"sync"
 	"time"
 
+	"github.com/lordbasex/burrowctl/clock"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -16,6 +16,10 @@ type ServerHeartbeatConfig struct {
 	ResponseTimeout time.Duration // How long to wait before responding to heartbeat
 	CleanupInterval time.Duration // How often to cleanup stale client connections
 	MaxClientAge    time.Duration // Maximum age of client connection before cleanup
+	MaxClients      int           // Maximum number of tracked client records (0 = unbounded)
+	ServerPings     bool          // Ping the clients that register a ping queue, besides taking their PINGs
+	PingInterval    time.Duration // How often registered clients are pinged
+	MaxMissedPings  int           // Unanswered pings after which the server stops pinging a client
 }
 
 // DefaultServerHeartbeatConfig returns sensible default server heartbeat configuration
@@ -25,18 +29,41 @@ func DefaultServerHeartbeatConfig() *ServerHeartbeatConfig {
 		ResponseTimeout: 100 * time.Millisecond, // Quick response
 		CleanupInterval: 2 * time.Minute,        // Cleanup every 2 minutes
 		MaxClientAge:    3 * time.Minute,        // Remove clients older than 3 minutes
+		MaxClients:      10000,                  // Bound memory under client churn
+		PingInterval:    30 * time.Second,       // Ping registered clients every 30 seconds
+		MaxMissedPings:  3,                      // Give up on a client after 3 unanswered pings
 	}
 }
 
 // ClientHeartbeatInfo tracks client connection state
 type ClientHeartbeatInfo struct {
+	ClientID  string    // Client instance identifier (empty for older clients)
 	DeviceID  string    // Device identifier
 	ClientIP  string    // Client IP address
 	LastPing  time.Time // Last time client sent PING
 	LastPong  time.Time // Last time server sent PONG
+	LastSeen  time.Time // Last PING from the client or answer to a server ping
 	IsActive  bool      // Whether connection is considered active
 	PingCount int       // Number of PINGs received
 	RPCActive bool      // Whether RPC is active for this client
+
+	PingQueue        string // Queue the server pings the client on (empty: the client is not pinged)
+	MissedPings      int    // Server pings sent since the client last answered
+	OpenTransactions int    // Open transactions of the sessions the client is bound to (set by Handler.GetActiveClients)
+}
+
+// identity returns the key a client record is tracked under: the client
+// instance ID when the client sends one, otherwise its IP address.
+func (c *ClientHeartbeatInfo) identity() string {
+	return clientIdentity(c.ClientID, c.ClientIP)
+}
+
+// clientIdentity builds the tracking key for a client.
+func clientIdentity(clientID, clientIP string) string {
+	if clientID != "" {
+		return clientID
+	}
+	return clientIP
 }
 
 // ServerHeartbeatManager handles server-side heartbeat processing with separate queues
@@ -45,11 +72,16 @@ type ServerHeartbeatManager struct {
 	deviceID string
 
 	// Client tracking
-	mutex   sync.RWMutex
-	clients map[string]*ClientHeartbeatInfo // clientIP -> connection info
+	mutex      sync.RWMutex
+	clients    *clientRecordLRU // identity -> connection info, bounded by MaxClients
+	totalPings int64            // PINGs received since start, including evicted clients
+	totalPongs int64            // Answers to server pings received since start
 
 	// Cleanup
 	stopChan chan struct{}
+
+	// Time source for client expiry (clock.Real unless replaced)
+	clock clock.Clock
 }
 
 // NewServerHeartbeatManager creates a new server heartbeat manager
@@ -61,11 +93,19 @@ func NewServerHeartbeatManager(deviceID string, config *ServerHeartbeatConfig) *
 	return &ServerHeartbeatManager{
 		config:   config,
 		deviceID: deviceID,
-		clients:  make(map[string]*ClientHeartbeatInfo),
+		clients:  newClientRecordLRU(config.MaxClients),
 		stopChan: make(chan struct{}),
+		clock:    clock.Real,
 	}
 }
 
+// SetClock replaces the time source used for client expiry (for tests)
+func (shm *ServerHeartbeatManager) SetClock(c clock.Clock) {
+	shm.mutex.Lock()
+	defer shm.mutex.Unlock()
+	shm.clock = clock.OrReal(c)
+}
+
 // Start begins server heartbeat management
 func (shm *ServerHeartbeatManager) Start() {
 	if !shm.config.Enabled {
@@ -82,8 +122,9 @@ func (shm *ServerHeartbeatManager) Stop() {
 	log.Printf("[server-heartbeat] Stopped heartbeat management for device %s", shm.deviceID)
 }
 
-// HandleHeartbeatPing processes a heartbeat PING request from a client
-func (shm *ServerHeartbeatManager) HandleHeartbeatPing(ch *amqp.Channel, msg amqp.Delivery) {
+// HandleHeartbeatPing processes a heartbeat PING request from a client and
+// answers it with a PONG sent through reply
+func (shm *ServerHeartbeatManager) HandleHeartbeatPing(msg amqp.Delivery, reply func(replyTo string, publishing amqp.Publishing)) {
 	if !shm.config.Enabled {
 		return
 	}
@@ -94,9 +135,10 @@ func (shm *ServerHeartbeatManager) HandleHeartbeatPing(ch *amqp.Channel, msg amq
 		return
 	}
 
-	deviceID := ping["deviceID"].(string)
-	clientIP := ping["clientIP"].(string)
-	corrID := ping["corrID"].(string)
+	deviceID, _ := ping["deviceID"].(string)
+	clientIP, _ := ping["clientIP"].(string)
+	clientID, _ := ping["clientID"].(string)
+	corrID, _ := ping["corrID"].(string)
 
 	// Verify this server handles this device
 	if deviceID != shm.deviceID {
@@ -105,55 +147,70 @@ func (shm *ServerHeartbeatManager) HandleHeartbeatPing(ch *amqp.Channel, msg amq
 		return
 	}
 
-	// Update client connection info
+	pingCount := shm.recordPing(clientID, clientIP)
+
+	// Respond with PONG
+	shm.sendHeartbeatPong(reply, msg.ReplyTo, corrID, deviceID, clientIP)
+
+	log.Printf("[server-heartbeat] PING received from %s (device: %s, total pings: %d)",
+		clientIP, deviceID, pingCount)
+}
+
+// recordPing updates the connection info of the client that sent a PING and
+// returns the number of PINGs received from it
+func (shm *ServerHeartbeatManager) recordPing(clientID, clientIP string) int {
 	shm.mutex.Lock()
-	client, exists := shm.clients[clientIP]
-	if !exists {
-		client = &ClientHeartbeatInfo{
-			DeviceID: deviceID,
+	defer shm.mutex.Unlock()
+
+	client := shm.clients.touch(clientIdentity(clientID, clientIP), func() *ClientHeartbeatInfo {
+		return &ClientHeartbeatInfo{
+			ClientID: clientID,
+			DeviceID: shm.deviceID,
 			ClientIP: clientIP,
 		}
-		shm.clients[clientIP] = client
-	}
+	})
 
-	client.LastPing = time.Now()
+	now := shm.clock.Now()
+	client.LastPing = now
+	client.LastPong = now
+	client.LastSeen = now
 	client.IsActive = true
 	client.PingCount++
-	shm.mutex.Unlock()
-
-	// Respond with PONG
-	shm.sendHeartbeatPong(ch, msg.ReplyTo, corrID, deviceID, clientIP)
-
-	log.Printf("[server-heartbeat] PING received from %s (device: %s, total pings: %d)",
-		clientIP, deviceID, client.PingCount)
+	shm.totalPings++
+	return client.PingCount
 }
 
 // sendHeartbeatPong sends a heartbeat PONG response to the client
-func (shm *ServerHeartbeatManager) sendHeartbeatPong(ch *amqp.Channel, replyTo, corrID, deviceID, clientIP string) {
+func (shm *ServerHeartbeatManager) sendHeartbeatPong(reply func(replyTo string, publishing amqp.Publishing), replyTo, corrID, deviceID, clientIP string) {
 	// Build heartbeat response (PONG)
+	now := shm.clock.Now()
 	pong := map[string]interface{}{
-		"type":      "heartbeat_pong",
-		"deviceID":  deviceID,
-		"clientIP":  clientIP,
-		"timestamp": time.Now().Unix(),
-		"corrID":    corrID,
-		"serverID":  shm.deviceID, // Server identifier
+		"type":        "heartbeat_pong",
+		"deviceID":    deviceID,
+		"clientIP":    clientIP,
+		"timestamp":   now.Unix(),
+		"timestampMs": now.UnixMilli(), // Lets clients measure clock skew
+		"corrID":      corrID,
+		"serverID":    shm.deviceID, // Server identifier
 	}
 
 	body, _ := json.Marshal(pong)
 
 	// Send PONG response
-	err := ch.PublishWithContext(context.Background(), "", replyTo, false, false, amqp.Publishing{
+	reply(replyTo, amqp.Publishing{
 		ContentType:   "application/json",
 		CorrelationId: corrID,
 		Body:          body,
 	})
+	log.Printf("[server-heartbeat] PONG sent to %s", clientIP)
+}
 
-	if err != nil {
-		log.Printf("[server-heartbeat] Failed to send PONG to %s: %v", clientIP, err)
-	} else {
-		log.Printf("[server-heartbeat] PONG sent to %s", clientIP)
-	}
+// handleHeartbeatPing answers a heartbeat PING through the response path of
+// the transport in use; ch is nil with transports other than RabbitMQ
+func (h *Handler) handleHeartbeatPing(ch *amqp.Channel, msg amqp.Delivery) {
+	h.heartbeatManager.HandleHeartbeatPing(msg, func(replyTo string, publishing amqp.Publishing) {
+		h.publishResponse(ch, replyTo, publishing)
+	})
 }
 
 // cleanupLoop periodically cleans up stale client connections
@@ -176,42 +233,43 @@ func (shm *ServerHeartbeatManager) cleanupStaleConnections() {
 	shm.mutex.Lock()
 	defer shm.mutex.Unlock()
 
-	now := time.Now()
-	removed := 0
-
-	for clientIP, client := range shm.clients {
-		if now.Sub(client.LastPing) > shm.config.MaxClientAge {
-			client.IsActive = false
-			removed++
-			log.Printf("[server-heartbeat] Client %s marked as inactive (no PING for %v)",
-				clientIP, now.Sub(client.LastPing))
-		}
-	}
-
+	removed := shm.clients.expire(shm.clock.Now(), shm.config.MaxClientAge)
 	if removed > 0 {
-		log.Printf("[server-heartbeat] Cleaned up %d inactive clients", removed)
+		log.Printf("[server-heartbeat] Cleaned up %d inactive clients (no PING for %v)",
+			removed, shm.config.MaxClientAge)
 	}
 }
 
+// isActive reports whether a client has sent a PING or answered a server
+// ping within the max client age.
+func (shm *ServerHeartbeatManager) isActive(client *ClientHeartbeatInfo, now time.Time) bool {
+	return now.Sub(client.LastSeen) <= shm.config.MaxClientAge
+}
+
+// IsClientActive reports whether the client tracked under identity has
+// sent a PING or answered a server ping within the max client age
+func (shm *ServerHeartbeatManager) IsClientActive(identity string) bool {
+	shm.mutex.RLock()
+	defer shm.mutex.RUnlock()
+
+	client := shm.clients.get(identity)
+	return client != nil && shm.isActive(client, shm.clock.Now())
+}
+
 // GetActiveClients returns information about active client connections
 func (shm *ServerHeartbeatManager) GetActiveClients() map[string]*ClientHeartbeatInfo {
 	shm.mutex.RLock()
 	defer shm.mutex.RUnlock()
 
+	now := shm.clock.Now()
 	result := make(map[string]*ClientHeartbeatInfo)
-	for clientIP, client := range shm.clients {
-		if client.IsActive {
-			result[clientIP] = &ClientHeartbeatInfo{
-				DeviceID:  client.DeviceID,
-				ClientIP:  client.ClientIP,
-				LastPing:  client.LastPing,
-				LastPong:  client.LastPong,
-				IsActive:  client.IsActive,
-				PingCount: client.PingCount,
-				RPCActive: client.RPCActive,
-			}
+	shm.clients.each(func(client *ClientHeartbeatInfo) {
+		if shm.isActive(client, now) {
+			snapshot := *client
+			snapshot.IsActive = true
+			result[client.identity()] = &snapshot
 		}
-	}
+	})
 
 	return result
 }
@@ -221,22 +279,29 @@ func (shm *ServerHeartbeatManager) GetStats() ServerHeartbeatStats {
 	shm.mutex.RLock()
 	defer shm.mutex.RUnlock()
 
-	activeClients := 0
-	totalPings := 0
-
-	for _, client := range shm.clients {
-		if client.IsActive {
+	now := shm.clock.Now()
+	activeClients, pingedClients := 0, 0
+	shm.clients.each(func(client *ClientHeartbeatInfo) {
+		if shm.isActive(client, now) {
 			activeClients++
 		}
-		totalPings += client.PingCount
-	}
+		if client.PingQueue != "" {
+			pingedClients++
+		}
+	})
 
 	return ServerHeartbeatStats{
 		DeviceID:      shm.deviceID,
 		ActiveClients: activeClients,
-		TotalClients:  len(shm.clients),
-		TotalPings:    totalPings,
+		TotalClients:  shm.clients.len(),
+		TotalPings:    int(shm.totalPings),
 		IsEnabled:     shm.config.Enabled,
+		MaxClients:    shm.config.MaxClients,
+		Evictions:     shm.clients.evictions,
+		Expirations:   shm.clients.expirations,
+		ServerPings:   shm.config.Enabled && shm.config.ServerPings,
+		PingedClients: pingedClients,
+		TotalPongs:    int(shm.totalPongs),
 	}
 }
 
@@ -247,4 +312,10 @@ type ServerHeartbeatStats struct {
 	TotalClients  int    // Total number of clients tracked
 	TotalPings    int    // Total number of PINGs received
 	IsEnabled     bool   // Whether heartbeat is enabled
+	MaxClients    int    // Capacity of the client record store (0 = unbounded)
+	Evictions     int64  // Records evicted because the store was full
+	Expirations   int64  // Records removed for exceeding the max client age
+	ServerPings   bool   // Whether the server pings registered clients
+	PingedClients int    // Clients the server pings
+	TotalPongs    int    // Answers to server pings received
 }
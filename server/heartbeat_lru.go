@@ -0,0 +1,89 @@
+package server
+
+import (
+	"container/list"
+	"time"
+)
+
+// clientRecordLRU is a bounded, least-recently-used store of heartbeat client
+// records keyed by client identity. It is not safe for concurrent use; the
+// ServerHeartbeatManager mutex guards it.
+type clientRecordLRU struct {
+	capacity int
+	order    *list.List               // Front = most recently seen
+	records  map[string]*list.Element // identity -> element holding *ClientHeartbeatInfo
+
+	evictions   int64 // Records dropped because the store was full
+	expirations int64 // Records dropped because they exceeded the max client age
+}
+
+// newClientRecordLRU creates a store that holds at most capacity records.
+// A capacity <= 0 disables the bound.
+func newClientRecordLRU(capacity int) *clientRecordLRU {
+	return &clientRecordLRU{
+		capacity: capacity,
+		order:    list.New(),
+		records:  make(map[string]*list.Element),
+	}
+}
+
+// touch returns the record for identity, creating it if needed, and marks it
+// as most recently used. Creating a record may evict the least recently used one.
+func (l *clientRecordLRU) touch(identity string, create func() *ClientHeartbeatInfo) *ClientHeartbeatInfo {
+	if elem, ok := l.records[identity]; ok {
+		l.order.MoveToFront(elem)
+		return elem.Value.(*ClientHeartbeatInfo)
+	}
+
+	if l.capacity > 0 && l.order.Len() >= l.capacity {
+		l.removeElement(l.order.Back())
+		l.evictions++
+	}
+
+	record := create()
+	l.records[identity] = l.order.PushFront(record)
+	return record
+}
+
+// get returns the record for identity without changing its recency, or nil
+func (l *clientRecordLRU) get(identity string) *ClientHeartbeatInfo {
+	if elem, ok := l.records[identity]; ok {
+		return elem.Value.(*ClientHeartbeatInfo)
+	}
+	return nil
+}
+
+// expire removes every record last seen longer than maxAge ago and returns
+// the number of removed records. Records are ordered by recency, so the scan
+// stops at the first record that is still fresh.
+func (l *clientRecordLRU) expire(now time.Time, maxAge time.Duration) int {
+	removed := 0
+	for elem := l.order.Back(); elem != nil; elem = l.order.Back() {
+		if now.Sub(elem.Value.(*ClientHeartbeatInfo).LastSeen) <= maxAge {
+			break
+		}
+		l.removeElement(elem)
+		removed++
+	}
+	l.expirations += int64(removed)
+	return removed
+}
+
+// removeElement drops an element from both the list and the index.
+func (l *clientRecordLRU) removeElement(elem *list.Element) {
+	record := elem.Value.(*ClientHeartbeatInfo)
+	delete(l.records, record.identity())
+	l.order.Remove(elem)
+}
+
+// each calls fn for every record, most recently used first.
+func (l *clientRecordLRU) each(fn func(*ClientHeartbeatInfo)) {
+	for elem := l.order.Front(); elem != nil; elem = elem.Next() {
+		fn(elem.Value.(*ClientHeartbeatInfo))
+	}
+}
+
+// len returns the number of tracked records.
+func (l *clientRecordLRU) len() int {
+	return l.order.Len()
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+)
+
+// TestHeartbeatPingOverTransport checks that PINGs sent through a transport
+// other than RabbitMQ, which has no AMQP channel, are answered with a PONG
+func TestHeartbeatPingOverTransport(t *testing.T) {
+	h := NewHandler("ping-device", "mem://heartbeat-ping-test", "", "open", nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Start(ctx)
+
+	topology, err := client.NewTopology("", "ping-device")
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, err := client.OpenTransport("mem://heartbeat-ping-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer transport.Close()
+
+	ping, _ := json.Marshal(map[string]interface{}{
+		"type":     "heartbeat_ping",
+		"deviceID": "ping-device",
+		"clientIP": "10.0.0.1",
+		"clientID": "client-1",
+		"corrID":   "ping-1",
+	})
+	rctx, rcancel := context.WithTimeout(ctx, 5*time.Second)
+	defer rcancel()
+	reply, err := transport.Request(rctx, topology.RPCQueue, client.Message{CorrelationID: "ping-1", Body: ping})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var pong map[string]interface{}
+	if err := json.Unmarshal(reply.Body, &pong); err != nil {
+		t.Fatal(err)
+	}
+	if pong["type"] != "heartbeat_pong" || pong["corrID"] != "ping-1" {
+		t.Fatalf("expected a PONG, got %s", reply.Body)
+	}
+	if !h.heartbeatManager.IsClientActive("client-1") {
+		t.Fatal("PING was not recorded")
+	}
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path"
+)
+
+// ErrImpersonationDenied is the RPCResponse.ErrorCode of requests whose
+// on_behalf_of is rejected by the impersonation policy
+const ErrImpersonationDenied = "IMPERSONATION_DENIED"
+
+// ImpersonationRole allows a set of authenticated service principals to run
+// requests on behalf of the end users matching AllowedUsers.
+type ImpersonationRole struct {
+	Name         string   `json:"name"`                   // Role name recorded in logs
+	Principals   []string `json:"principals"`             // AMQP users (validated user_id) holding the role
+	AllowedUsers []string `json:"allowed_users"`          // Glob patterns of end users they may act for ("*" for any)
+	DeniedUsers  []string `json:"denied_users,omitempty"` // Glob patterns that are never allowed, even if matched above
+}
+
+// ImpersonationConfig holds the on-behalf-of policy. The principal is the
+// user_id property of the AMQP message, which RabbitMQ guarantees matches the
+// user the client authenticated as, so it cannot be forged by the client.
+type ImpersonationConfig struct {
+	Enabled bool                `json:"enabled"` // Accept on_behalf_of at all
+	Roles   []ImpersonationRole `json:"roles"`   // Roles granting impersonation rights
+}
+
+// DefaultImpersonationConfig returns a disabled impersonation configuration
+func DefaultImpersonationConfig() ImpersonationConfig {
+	return ImpersonationConfig{Enabled: false}
+}
+
+// LoadImpersonationConfig reads an impersonation policy from a JSON file.
+//
+// Example:
+//
+//	{
+//	  "enabled": true,
+//	  "roles": [
+//	    {"name": "admin-portal", "principals": ["portal-svc"], "allowed_users": ["*"], "denied_users": ["root"]},
+//	    {"name": "support", "principals": ["support-svc"], "allowed_users": ["customer-*"]}
+//	  ]
+//	}
+func LoadImpersonationConfig(filename string) (ImpersonationConfig, error) {
+	config := DefaultImpersonationConfig()
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return config, fmt.Errorf("failed to read impersonation config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse impersonation config %s: %w", filename, err)
+	}
+	return config, config.Validate()
+}
+
+// Validate checks every role and pattern
+func (ic ImpersonationConfig) Validate() error {
+	for i, role := range ic.Roles {
+		if role.Name == "" {
+			return fmt.Errorf("impersonation role %d: name is required", i)
+		}
+		if len(role.Principals) == 0 {
+			return fmt.Errorf("impersonation role %s: at least one principal is required", role.Name)
+		}
+		for _, pattern := range append(append([]string{}, role.AllowedUsers...), role.DeniedUsers...) {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("impersonation role %s: invalid pattern %q", role.Name, pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether value matches one of the glob patterns
+func matchAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize checks whether principal may act on behalf of user and returns
+// the role that grants it.
+func (ic ImpersonationConfig) Authorize(principal, user string) (string, error) {
+	if !ic.Enabled {
+		return "", fmt.Errorf("on_behalf_of is not accepted by this server")
+	}
+	if principal == "" {
+		return "", fmt.Errorf("on_behalf_of requires an authenticated principal (publish with the AMQP user_id property)")
+	}
+
+	for _, role := range ic.Roles {
+		if !contains(role.Principals, principal) {
+			continue
+		}
+		if matchAny(role.DeniedUsers, user) {
+			continue
+		}
+		if matchAny(role.AllowedUsers, user) {
+			return role.Name, nil
+		}
+	}
+	return "", fmt.Errorf("principal '%s' may not act on behalf of '%s'", principal, user)
+}
+
+// contains reports whether values contains value
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// SetImpersonationConfig installs the on-behalf-of policy
+func (h *Handler) SetImpersonationConfig(config ImpersonationConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	h.impersonation = config
+	log.Printf("[server] Impersonation configured: %d roles, enabled=%v", len(config.Roles), config.Enabled)
+	return nil
+}
+
+// authorizeOnBehalfOf verifies the on_behalf_of field of a request against
+// the impersonation policy. Requests without on_behalf_of are always allowed.
+func (h *Handler) authorizeOnBehalfOf(principal string, req RPCRequest) error {
+	if req.OnBehalfOf == "" {
+		return nil
+	}
+
+	role, err := h.impersonation.Authorize(principal, req.OnBehalfOf)
+	if err != nil {
+		log.Printf("[server] Impersonation denied: principal=%q on_behalf_of=%q ip=%s: %v",
+			principal, req.OnBehalfOf, req.ClientIP, err)
+		return err
+	}
+	log.Printf("[server] %s acting on behalf of %s (role %s)", principal, req.OnBehalfOf, role)
+	return nil
+}
@@ -0,0 +1,541 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// IndexAdvisorConfig holds configuration for index suggestions
+type IndexAdvisorConfig struct {
+	Enabled         bool          // Whether slow queries are sampled and analyzed
+	Interval        time.Duration // How often the samples are analyzed
+	MaxFingerprints int           // Distinct slow query fingerprints sampled
+	MinRows         int64         // Smallest estimated full scan worth an index
+}
+
+// DefaultIndexAdvisorConfig returns a disabled index advisor configuration
+func DefaultIndexAdvisorConfig() IndexAdvisorConfig {
+	return IndexAdvisorConfig{
+		Enabled:         false,
+		Interval:        time.Hour,
+		MaxFingerprints: 100,
+		MinRows:         1000,
+	}
+}
+
+// IndexSuggestion is an index that would let a slow query avoid a full scan
+type IndexSuggestion struct {
+	Table         string   `json:"table"`
+	Columns       []string `json:"columns"`
+	Statement     string   `json:"statement"`      // CREATE INDEX statement to review and apply
+	Reason        string   `json:"reason"`         // What the plan showed
+	EstimatedRows int64    `json:"estimated_rows"` // Rows the optimizer expected to scan
+	Fingerprints  []string `json:"fingerprints"`   // Slow query shapes the index helps
+	Occurrences   int64    `json:"occurrences"`    // Slow executions of those queries
+	TotalDuration string   `json:"total_duration"` // Time spent in those executions
+}
+
+// IndexReport is the result of an analysis
+type IndexReport struct {
+	GeneratedAt time.Time         `json:"generated_at"`
+	Analyzed    int               `json:"analyzed"` // Fingerprints explained
+	Suggestions []IndexSuggestion `json:"suggestions"`
+	Errors      []string          `json:"errors,omitempty"` // Fingerprints that could not be analyzed
+}
+
+// indexSample is the latest slow execution of a query fingerprint
+type indexSample struct {
+	fingerprint string
+	query       string
+	params      []interface{}
+	count       int64
+	total       time.Duration
+}
+
+// indexAdvisorNamespace is the Storage namespace of the last report
+const indexAdvisorNamespace = "index_advisor"
+
+// IndexAdvisor samples slow queries by fingerprint and periodically runs
+// EXPLAIN on them, suggesting indexes for large full table scans. The
+// suggestions come from the columns the query filters, joins and sorts on;
+// they are a starting point for review, not applied automatically.
+type IndexAdvisor struct {
+	handler *Handler
+	config  IndexAdvisorConfig
+
+	mutex   sync.Mutex
+	samples map[string]*indexSample
+	report  IndexReport
+	running bool
+}
+
+// NewIndexAdvisor creates an index advisor
+func NewIndexAdvisor(handler *Handler, config IndexAdvisorConfig) *IndexAdvisor {
+	defaults := DefaultIndexAdvisorConfig()
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.MaxFingerprints <= 0 {
+		config.MaxFingerprints = defaults.MaxFingerprints
+	}
+	if config.MinRows <= 0 {
+		config.MinRows = defaults.MinRows
+	}
+
+	return &IndexAdvisor{
+		handler: handler,
+		config:  config,
+		samples: make(map[string]*indexSample),
+	}
+}
+
+var (
+	// Literals replaced by "?" in fingerprints
+	stringLiteralPattern = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.)*"`)
+	numberLiteralPattern = regexp.MustCompile(`\b\d+(?:\.\d+)?\b`)
+	inListPattern        = regexp.MustCompile(`\bin\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+)
+
+// queryFingerprint returns the shape of a query: normalized, with literals
+// replaced by "?" so executions that differ only in values group together
+func queryFingerprint(query string) string {
+	fingerprint := stringLiteralPattern.ReplaceAllString(query, "?")
+	fingerprint = numberLiteralPattern.ReplaceAllString(normalizeQuery(fingerprint), "?")
+	return inListPattern.ReplaceAllString(fingerprint, "in (?)")
+}
+
+// sample records a slow execution of query
+func (ia *IndexAdvisor) sample(query string, params []interface{}, duration time.Duration) {
+	if !explainable(query) {
+		return
+	}
+	fingerprint := queryFingerprint(query)
+
+	ia.mutex.Lock()
+	defer ia.mutex.Unlock()
+
+	s, ok := ia.samples[fingerprint]
+	if !ok {
+		if len(ia.samples) >= ia.config.MaxFingerprints {
+			return
+		}
+		s = &indexSample{fingerprint: fingerprint}
+		ia.samples[fingerprint] = s
+	}
+	s.query, s.params = query, params
+	s.count++
+	s.total += duration
+}
+
+// run loads the last report and analyzes the samples every interval
+func (ia *IndexAdvisor) run(ctx context.Context) {
+	if storage := ia.handler.storage; storage != nil {
+		if value, found, err := storage.Get(ctx, indexAdvisorNamespace, "report"); err == nil && found {
+			var report IndexReport
+			if json.Unmarshal(value, &report) == nil {
+				ia.mutex.Lock()
+				ia.report = report
+				ia.mutex.Unlock()
+			}
+		}
+	}
+
+	ticker := time.NewTicker(ia.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := ia.Analyze(ctx); err != nil {
+				log.Printf("[server] Index analysis failed: %v", err)
+			}
+		}
+	}
+}
+
+// Report returns the last analysis report
+func (ia *IndexAdvisor) Report() IndexReport {
+	ia.mutex.Lock()
+	defer ia.mutex.Unlock()
+	return ia.report
+}
+
+// Analyze explains every sampled fingerprint and replaces the report
+func (ia *IndexAdvisor) Analyze(ctx context.Context) (IndexReport, error) {
+	ia.mutex.Lock()
+	if ia.running {
+		ia.mutex.Unlock()
+		return IndexReport{}, fmt.Errorf("an index analysis is already running")
+	}
+	ia.running = true
+	samples := make([]indexSample, 0, len(ia.samples))
+	for _, s := range ia.samples {
+		samples = append(samples, *s)
+	}
+	ia.mutex.Unlock()
+
+	defer func() {
+		ia.mutex.Lock()
+		ia.running = false
+		ia.mutex.Unlock()
+	}()
+
+	db, release, err := ia.handler.acquireDB()
+	if err != nil {
+		return IndexReport{}, err
+	}
+	defer release()
+
+	// Most expensive first, so merged suggestions list the main culprit first
+	sort.Slice(samples, func(i, j int) bool { return samples[i].total > samples[j].total })
+
+	report := IndexReport{GeneratedAt: time.Now(), Suggestions: []IndexSuggestion{}}
+	merged := make(map[string]*IndexSuggestion)
+	var order []string
+	for _, s := range samples {
+		suggestions, err := ia.analyzeSample(ctx, db, s)
+		if err != nil {
+			report.Errors = append(report.Errors, fmt.Sprintf("%s: %v", truncateQuery(s.fingerprint, 200), err))
+			continue
+		}
+		report.Analyzed++
+
+		for _, suggestion := range suggestions {
+			key := suggestion.Table + "(" + strings.Join(suggestion.Columns, ",") + ")"
+			existing, ok := merged[key]
+			if !ok {
+				merged[key] = &suggestion
+				order = append(order, key)
+				continue
+			}
+			existing.Fingerprints = append(existing.Fingerprints, suggestion.Fingerprints...)
+			existing.Occurrences += suggestion.Occurrences
+			total, _ := time.ParseDuration(existing.TotalDuration)
+			extra, _ := time.ParseDuration(suggestion.TotalDuration)
+			existing.TotalDuration = (total + extra).String()
+			if suggestion.EstimatedRows > existing.EstimatedRows {
+				existing.EstimatedRows = suggestion.EstimatedRows
+			}
+		}
+	}
+	for _, key := range order {
+		report.Suggestions = append(report.Suggestions, *merged[key])
+	}
+
+	ia.mutex.Lock()
+	ia.report = report
+	ia.mutex.Unlock()
+
+	if storage := ia.handler.storage; storage != nil {
+		if value, err := json.Marshal(report); err == nil {
+			if err := storage.Put(ctx, indexAdvisorNamespace, "report", value, 0); err != nil {
+				log.Printf("[server] Failed to store index report: %v", err)
+			}
+		}
+	}
+	log.Printf("[server] Index analysis: %d fingerprints analyzed, %d suggestions", report.Analyzed, len(report.Suggestions))
+	return report, nil
+}
+
+// analyzeSample explains a sample and suggests indexes for its full scans
+func (ia *IndexAdvisor) analyzeSample(ctx context.Context, db *sql.DB, s indexSample) ([]IndexSuggestion, error) {
+	explainCtx, cancel := context.WithTimeout(ctx, ia.handler.slowQueryLog.Config().ExplainTimeout)
+	plan, err := explainQuery(explainCtx, db, s.query, s.params)
+	cancel()
+	if err != nil {
+		return nil, err
+	}
+
+	aliases := tableAliases(s.fingerprint)
+	tables := make(map[string]bool)
+	for _, table := range aliases {
+		tables[table] = true
+	}
+
+	var suggestions []IndexSuggestion
+	for _, row := range plan {
+		alias := planString(row["table"])
+		rows := planInt(row["rows"])
+		if planString(row["type"]) != "ALL" || rows < ia.config.MinRows || alias == "" || strings.HasPrefix(alias, "<") {
+			continue
+		}
+		table, ok := aliases[alias]
+		if !ok {
+			table = alias
+		}
+
+		columns := predicateColumns(s.fingerprint, alias, len(tables) == 1)
+		columns, err := ia.usableColumns(ctx, db, table, columns)
+		if err != nil {
+			return nil, err
+		}
+		if len(columns) == 0 {
+			continue
+		}
+
+		suggestions = append(suggestions, IndexSuggestion{
+			Table:         table,
+			Columns:       columns,
+			Statement:     createIndexStatement(table, columns),
+			Reason:        fmt.Sprintf("full table scan of ~%d rows", rows),
+			EstimatedRows: rows,
+			Fingerprints:  []string{s.fingerprint},
+			Occurrences:   s.count,
+			TotalDuration: s.total.String(),
+		})
+	}
+	return suggestions, nil
+}
+
+// usableColumns keeps the columns that exist in table and returns nil when
+// an existing index already starts with them
+func (ia *IndexAdvisor) usableColumns(ctx context.Context, db *sql.DB, table string, columns []string) ([]string, error) {
+	if len(columns) == 0 || !identifierPattern.MatchString(table) {
+		return nil, nil
+	}
+
+	rows, err := db.QueryContext(ctx, "SELECT LOWER(column_name) FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ?", table)
+	if err != nil {
+		return nil, err
+	}
+	existing := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		existing[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var usable []string
+	for _, column := range columns {
+		if existing[column] {
+			usable = append(usable, column)
+		}
+	}
+	if len(usable) == 0 {
+		return nil, nil
+	}
+
+	indexes, err := tableIndexes(ctx, db, table)
+	if err != nil {
+		return nil, err
+	}
+	for _, index := range indexes {
+		if len(index) >= len(usable) && strings.Join(index[:len(usable)], ",") == strings.Join(usable, ",") {
+			return nil, nil
+		}
+	}
+	return usable, nil
+}
+
+// tableIndexes returns the columns of every index of table, in index order
+func tableIndexes(ctx context.Context, db *sql.DB, table string) ([][]string, error) {
+	rows, err := db.QueryContext(ctx, `SELECT index_name, LOWER(column_name) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = ? ORDER BY index_name, seq_in_index`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var (
+		indexes [][]string
+		current string
+	)
+	for rows.Next() {
+		var name, column string
+		if err := rows.Scan(&name, &column); err != nil {
+			return nil, err
+		}
+		if name != current || len(indexes) == 0 {
+			indexes = append(indexes, nil)
+			current = name
+		}
+		indexes[len(indexes)-1] = append(indexes[len(indexes)-1], column)
+	}
+	return indexes, rows.Err()
+}
+
+// createIndexStatement builds the CREATE INDEX statement of a suggestion
+func createIndexStatement(table string, columns []string) string {
+	name := "idx_" + table + "_" + strings.Join(columns, "_")
+	if len(name) > 64 {
+		name = name[:64]
+	}
+	quoted := make([]string, len(columns))
+	for i, column := range columns {
+		quoted[i] = quoteIdentifier(column)
+	}
+	return fmt.Sprintf("CREATE INDEX %s ON %s (%s)", quoteIdentifier(name), quoteIdentifier(table), strings.Join(quoted, ", "))
+}
+
+var (
+	// tableReferencePattern matches "from t", "join t a" and "join t as a"
+	tableReferencePattern = regexp.MustCompile("\\b(?:from|join)\\s+`?(\\w+)`?(?:\\s+(?:as\\s+)?`?(\\w+)`?)?")
+
+	// predicatePattern matches a (qualified) column compared to something
+	predicatePattern = regexp.MustCompile("(?:`?(\\w+)`?\\.)?`?(\\w+)`?\\s*(<=>|>=|<=|<>|!=|=|>|<|\\bin\\b|\\blike\\b|\\bbetween\\b|\\bis\\b)")
+
+	// joinRightPattern matches the qualified column on the right of an equality
+	joinRightPattern = regexp.MustCompile("=\\s*`?(\\w+)`?\\.`?(\\w+)`?")
+
+	// clausePattern splits WHERE and ON conditions from the rest of the query
+	clausePattern = regexp.MustCompile(`\b(?:where|on)\b(.*?)(?:\b(?:group by|order by|having|limit|join|inner|left|right|cross|union|for update)\b|$)`)
+
+	// orderByPattern matches the ORDER BY list
+	orderByPattern = regexp.MustCompile(`\border by\b(.*?)(?:\blimit\b|\bfor update\b|$)`)
+)
+
+// sqlKeywords are words the patterns may mistake for table aliases or columns
+var sqlKeywords = map[string]bool{
+	"where": true, "join": true, "on": true, "inner": true, "left": true, "right": true, "cross": true,
+	"group": true, "order": true, "limit": true, "having": true, "union": true, "set": true, "using": true,
+	"and": true, "or": true, "not": true, "null": true, "is": true, "in": true, "like": true, "between": true,
+	"exists": true, "select": true, "case": true, "when": true, "then": true, "else": true, "end": true,
+	"true": true, "false": true, "interval": true, "as": true, "straight_join": true, "natural": true,
+}
+
+// tableAliases maps the aliases (and names) of the tables in a fingerprint
+// to table names
+func tableAliases(fingerprint string) map[string]string {
+	aliases := make(map[string]string)
+	for _, match := range tableReferencePattern.FindAllStringSubmatch(fingerprint, -1) {
+		table, alias := match[1], match[2]
+		if sqlKeywords[table] {
+			continue
+		}
+		aliases[table] = table
+		if alias != "" && !sqlKeywords[alias] {
+			aliases[alias] = table
+		}
+	}
+	return aliases
+}
+
+// predicateColumns returns candidate index columns of the table known as
+// alias: columns compared for equality, then one range column, or the ORDER
+// BY columns when there is no range. Unqualified columns count only when
+// the query reads a single table.
+func predicateColumns(fingerprint, alias string, singleTable bool) []string {
+	belongs := func(qualifier, column string) bool {
+		if sqlKeywords[column] || column == "" {
+			return false
+		}
+		if qualifier == "" {
+			return singleTable
+		}
+		return qualifier == alias
+	}
+
+	var equality, ranges []string
+	seen := make(map[string]bool)
+	for _, clause := range clausePattern.FindAllStringSubmatch(fingerprint, -1) {
+		for _, match := range predicatePattern.FindAllStringSubmatch(clause[1], -1) {
+			qualifier, column, operator := match[1], match[2], match[3]
+			if !belongs(qualifier, column) || seen[column] || operator == "<>" || operator == "!=" {
+				continue
+			}
+			seen[column] = true
+			switch operator {
+			case "=", "<=>", "in", "is":
+				equality = append(equality, column)
+			default:
+				ranges = append(ranges, column)
+			}
+		}
+		for _, match := range joinRightPattern.FindAllStringSubmatch(clause[1], -1) {
+			if belongs(match[1], match[2]) && !seen[match[2]] {
+				seen[match[2]] = true
+				equality = append(equality, match[2])
+			}
+		}
+	}
+
+	columns := equality
+	if len(ranges) > 0 {
+		columns = append(columns, ranges[0])
+	} else if match := orderByPattern.FindStringSubmatch(fingerprint); match != nil {
+		for _, term := range strings.Split(match[1], ",") {
+			fields := strings.Fields(strings.ReplaceAll(term, "`", ""))
+			if len(fields) == 0 {
+				continue
+			}
+			qualifier, column := "", fields[0]
+			if i := strings.IndexByte(column, '.'); i >= 0 {
+				qualifier, column = column[:i], column[i+1:]
+			}
+			if belongs(qualifier, column) && !seen[column] {
+				seen[column] = true
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	if len(columns) > 4 {
+		columns = columns[:4]
+	}
+	return columns
+}
+
+// planString reads a text value of an EXPLAIN row
+func planString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	}
+	return ""
+}
+
+// planInt reads a numeric value of an EXPLAIN row
+func planInt(value interface{}) int64 {
+	switch v := value.(type) {
+	case int64:
+		return v
+	case float64:
+		return int64(v)
+	case string:
+		n, _ := strconv.ParseInt(v, 10, 64)
+		return n
+	}
+	return 0
+}
+
+// SetIndexAdvisorConfig enables slow query sampling for index suggestions
+// and registers the getIndexSuggestions and analyzeIndexes functions.
+// Queries are only sampled when the slow query log considers them slow.
+func (h *Handler) SetIndexAdvisorConfig(config IndexAdvisorConfig) {
+	if !config.Enabled {
+		h.indexAdvisor = nil
+		return
+	}
+
+	h.indexAdvisor = NewIndexAdvisor(h, config)
+
+	h.RegisterFunctionWithMetadata("getIndexSuggestions", func() IndexReport {
+		return h.indexAdvisor.Report()
+	}, FunctionMetadata{Description: "Returns the last index suggestion report"})
+	h.RegisterFunctionWithMetadata("analyzeIndexes", func() (IndexReport, error) {
+		return h.indexAdvisor.Analyze(context.Background())
+	}, FunctionMetadata{Description: "Analyzes the sampled slow queries now and returns the index suggestion report"})
+
+	log.Printf("[server] Index advisor enabled: analysis every %v, full scans over %d rows",
+		h.indexAdvisor.config.Interval, h.indexAdvisor.config.MinRows)
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"strings"
+)
+
+// ErrIPDenied is the RPCResponse.ErrorCode of requests from client IPs the
+// allow and deny lists reject
+const ErrIPDenied = "IP_DENIED"
+
+// IPFilterConfig lists the client IPs requests are accepted from. Entries
+// are CIDR ranges ("10.0.0.0/8") or single addresses. A request is rejected
+// when its IP is in Deny, or when Allow is not empty and its IP is not in
+// it.
+//
+// The IP is the clientIP field the client reports, not the address of a
+// connection (clients talk to the broker, not to the server), so the lists
+// keep out misconfigured and obviously foreign clients but not a client
+// that lies about its address.
+type IPFilterConfig struct {
+	Allow []string // Accepted ranges (empty: any address not denied)
+	Deny  []string // Rejected ranges, which take precedence over Allow
+}
+
+// IPFilter checks client IPs against allow and deny lists
+type IPFilter struct {
+	allow []netip.Prefix
+	deny  []netip.Prefix
+}
+
+// NewIPFilter parses the ranges of config
+func NewIPFilter(config IPFilterConfig) (*IPFilter, error) {
+	allow, err := parsePrefixes(config.Allow)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP allowlist: %w", err)
+	}
+	deny, err := parsePrefixes(config.Deny)
+	if err != nil {
+		return nil, fmt.Errorf("invalid IP denylist: %w", err)
+	}
+	return &IPFilter{allow: allow, deny: deny}, nil
+}
+
+// parsePrefixes parses CIDR ranges and single addresses
+func parsePrefixes(entries []string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		if strings.Contains(entry, "/") {
+			prefix, err := netip.ParsePrefix(entry)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(entry)
+		if err != nil {
+			return nil, err
+		}
+		addr = addr.Unmap()
+		prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Check returns why requests from ip are rejected, or nil if they are
+// accepted. An IP that cannot be parsed is only accepted without allowlist.
+func (f *IPFilter) Check(ip string) error {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		if len(f.allow) > 0 {
+			return fmt.Errorf("client IP %q is not a valid address", ip)
+		}
+		return nil
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range f.deny {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("client IP %s is denied (%s)", addr, prefix)
+		}
+	}
+	if len(f.allow) == 0 {
+		return nil
+	}
+	for _, prefix := range f.allow {
+		if prefix.Contains(addr) {
+			return nil
+		}
+	}
+	return fmt.Errorf("client IP %s is not in the allowlist", addr)
+}
+
+// SetIPFilterConfig installs client IP allow and deny lists; empty lists
+// remove the filter
+func (h *Handler) SetIPFilterConfig(config IPFilterConfig) error {
+	filter, err := NewIPFilter(config)
+	if err != nil {
+		return err
+	}
+	if len(filter.allow) == 0 && len(filter.deny) == 0 {
+		h.ipFilter = nil
+		return nil
+	}
+	h.ipFilter = filter
+	log.Printf("[server] Client IP filter: %d allowed ranges, %d denied ranges", len(filter.allow), len(filter.deny))
+	return nil
+}
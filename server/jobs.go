@@ -0,0 +1,365 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os/exec"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Job states reported by getJobStatus
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCancelled = "cancelled"
+	JobUnknown   = "unknown" // Returned for IDs the server does not know (never existed or already purged)
+)
+
+// JobConfig holds configuration for asynchronous job execution
+type JobConfig struct {
+	Workers   int           // Jobs executed concurrently
+	QueueSize int           // Jobs waiting to run before submissions are rejected
+	Timeout   time.Duration // Maximum runtime of a single job
+	Retention time.Duration // How long finished jobs stay queryable
+	MaxJobs   int           // Maximum jobs kept in memory (queued, running and finished)
+}
+
+// DefaultJobConfig returns the default job configuration
+func DefaultJobConfig() JobConfig {
+	return JobConfig{
+		Workers:   2,
+		QueueSize: 100,
+		Timeout:   1 * time.Hour,
+		Retention: 24 * time.Hour,
+		MaxJobs:   1000,
+	}
+}
+
+// JobRequest is the body of a "job" request
+type JobRequest struct {
+	Kind    string          `json:"kind"`              // "function" or "command"
+	Name    string          `json:"name,omitempty"`    // Function name (kind "function")
+	Params  []FunctionParam `json:"params,omitempty"`  // Function parameters (kind "function")
+	Command string          `json:"command,omitempty"` // Command line (kind "command")
+}
+
+// JobStatus is the status of a job as returned by getJobStatus
+type JobStatus struct {
+	ID         string      `json:"id"`
+	Kind       string      `json:"kind,omitempty"`
+	Name       string      `json:"name,omitempty"`
+	State      string      `json:"state"`
+	Progress   float64     `json:"progress"`
+	Message    string      `json:"message,omitempty"`
+	Result     interface{} `json:"result,omitempty"`
+	Error      string      `json:"error,omitempty"`
+	CreatedAt  time.Time   `json:"created_at"`
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+}
+
+// job is a submitted unit of work
+type job struct {
+	status JobStatus
+	run    func(ctx context.Context) (interface{}, error)
+	cancel context.CancelFunc // Set while running
+}
+
+// JobManager runs long-running functions and commands outside the RPC
+// timeout. Submissions return a job ID immediately; clients poll
+// getJobStatus until the job reaches a terminal state.
+type JobManager struct {
+	config JobConfig
+
+	mutex sync.Mutex
+	jobs  map[string]*job
+	queue chan *job
+}
+
+// NewJobManager creates a new job manager
+func NewJobManager(config JobConfig) *JobManager {
+	defaults := DefaultJobConfig()
+	if config.Workers <= 0 {
+		config.Workers = defaults.Workers
+	}
+	if config.QueueSize <= 0 {
+		config.QueueSize = defaults.QueueSize
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.Retention <= 0 {
+		config.Retention = defaults.Retention
+	}
+	if config.MaxJobs <= 0 {
+		config.MaxJobs = defaults.MaxJobs
+	}
+
+	return &JobManager{
+		config: config,
+		jobs:   make(map[string]*job),
+		queue:  make(chan *job, config.QueueSize),
+	}
+}
+
+// newJobID returns a random job identifier
+func newJobID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("job_%d", time.Now().UnixNano())
+	}
+	return "job_" + hex.EncodeToString(buf)
+}
+
+// Submit queues run and returns the new job's ID
+func (jm *JobManager) Submit(kind, name string, run func(ctx context.Context) (interface{}, error)) (string, error) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	if len(jm.jobs) >= jm.config.MaxJobs {
+		jm.purgeFinished(time.Now(), true)
+	}
+	if len(jm.jobs) >= jm.config.MaxJobs {
+		return "", fmt.Errorf("too many jobs (max %d)", jm.config.MaxJobs)
+	}
+
+	j := &job{
+		status: JobStatus{ID: newJobID(), Kind: kind, Name: name, State: JobQueued, CreatedAt: time.Now()},
+		run:    run,
+	}
+	select {
+	case jm.queue <- j:
+	default:
+		return "", fmt.Errorf("job queue is full (%d jobs waiting)", jm.config.QueueSize)
+	}
+	jm.jobs[j.status.ID] = j
+
+	log.Printf("[jobs] Queued %s %s as %s", kind, name, j.status.ID)
+	return j.status.ID, nil
+}
+
+// Status returns the status of a job
+func (jm *JobManager) Status(id string) (JobStatus, bool) {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	j, ok := jm.jobs[id]
+	if !ok {
+		return JobStatus{ID: id, State: JobUnknown}, false
+	}
+	return j.status, true
+}
+
+// Cancel stops a queued or running job. Running functions cannot be
+// interrupted and keep running in the background, but their result is discarded.
+func (jm *JobManager) Cancel(id string) error {
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	j, ok := jm.jobs[id]
+	if !ok {
+		return fmt.Errorf("job %s not found", id)
+	}
+	switch j.status.State {
+	case JobQueued:
+		j.status.State = JobCancelled
+		j.status.FinishedAt = time.Now()
+	case JobRunning:
+		j.cancel()
+	default:
+		return fmt.Errorf("job %s already %s", id, j.status.State)
+	}
+	log.Printf("[jobs] Cancellation requested for %s", id)
+	return nil
+}
+
+// run starts the workers and the cleanup loop until ctx is cancelled
+func (jm *JobManager) run(ctx context.Context) {
+	for i := 0; i < jm.config.Workers; i++ {
+		go jm.worker(ctx)
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			jm.mutex.Lock()
+			jm.purgeFinished(now, false)
+			jm.mutex.Unlock()
+		}
+	}
+}
+
+// worker executes queued jobs one at a time
+func (jm *JobManager) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-jm.queue:
+			jm.execute(ctx, j)
+		}
+	}
+}
+
+// execute runs a job and records its outcome
+func (jm *JobManager) execute(ctx context.Context, j *job) {
+	jobCtx, cancel := context.WithTimeout(ctx, jm.config.Timeout)
+	defer cancel()
+
+	jm.mutex.Lock()
+	if j.status.State != JobQueued {
+		jm.mutex.Unlock()
+		return
+	}
+	j.status.State = JobRunning
+	j.status.StartedAt = time.Now()
+	j.cancel = cancel
+	jm.mutex.Unlock()
+
+	result, err := j.run(jobCtx)
+
+	jm.mutex.Lock()
+	defer jm.mutex.Unlock()
+
+	j.status.FinishedAt = time.Now()
+	switch {
+	case errors.Is(jobCtx.Err(), context.Canceled):
+		j.status.State = JobCancelled
+	case err != nil:
+		j.status.State = JobFailed
+		j.status.Error = err.Error()
+	default:
+		j.status.State = JobSucceeded
+		j.status.Progress = 1
+		j.status.Result = result
+	}
+	log.Printf("[jobs] %s %s after %v", j.status.ID, j.status.State, j.status.FinishedAt.Sub(j.status.StartedAt))
+}
+
+// purgeFinished drops finished jobs past the retention period, or every
+// finished job when force is set. The caller must hold the mutex.
+func (jm *JobManager) purgeFinished(now time.Time, force bool) {
+	for id, j := range jm.jobs {
+		if j.status.FinishedAt.IsZero() {
+			continue
+		}
+		if force || now.Sub(j.status.FinishedAt) > jm.config.Retention {
+			delete(jm.jobs, id)
+		}
+	}
+}
+
+// SetJobConfig replaces the job manager. Call it before Start.
+func (h *Handler) SetJobConfig(config JobConfig) {
+	h.jobs = NewJobManager(config)
+	log.Printf("[server] Jobs configured: workers=%d queue=%d timeout=%v retention=%v",
+		h.jobs.config.Workers, h.jobs.config.QueueSize, h.jobs.config.Timeout, h.jobs.config.Retention)
+}
+
+// errorType is the reflect.Type of the error interface
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// jobResult turns the return values of a function of type fnType into a job
+// result. A non-nil error return fails the job; the other values become the
+// result (a single value as-is, several as a list).
+func jobResult(fnType reflect.Type, values []interface{}) (interface{}, error) {
+	var results []interface{}
+	for i, value := range values {
+		if fnType.Out(i) == errorType {
+			if value != nil {
+				return nil, value.(error)
+			}
+			continue
+		}
+		results = append(results, value)
+	}
+
+	switch len(results) {
+	case 0:
+		return nil, nil
+	case 1:
+		return results[0], nil
+	default:
+		return results, nil
+	}
+}
+
+// runJobCommand executes a command line and returns its output lines
+func runJobCommand(ctx context.Context, commandLine string) (interface{}, error) {
+	parts := strings.Fields(commandLine)
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("empty command")
+	}
+
+	output, err := exec.CommandContext(ctx, parts[0], parts[1:]...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("command failed: %v\nOutput: %s", err, string(output))
+	}
+	return strings.Split(strings.TrimRight(string(output), "\n"), "\n"), nil
+}
+
+// handleJob processes "job" requests: the function or command is queued and
+// the job ID is returned immediately.
+func (h *Handler) handleJob(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	var jobReq JobRequest
+	if err := json.Unmarshal([]byte(req.Query), &jobReq); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error: fmt.Sprintf("invalid job request: %v", err),
+		})
+		return
+	}
+
+	var (
+		id  string
+		err error
+	)
+	switch jobReq.Kind {
+	case "function":
+		funcValue := h.getFunctionByName(jobReq.Name)
+		if !funcValue.IsValid() {
+			err = fmt.Errorf("function '%s' not found", jobReq.Name)
+			break
+		}
+		funcReq := FunctionRequest{Name: jobReq.Name, Params: jobReq.Params}
+		id, err = h.jobs.Submit("function", jobReq.Name, func(ctx context.Context) (interface{}, error) {
+			values, err := h.executeFunction(ctx, funcReq)
+			if err != nil {
+				return nil, err
+			}
+			return jobResult(funcValue.Type(), values)
+		})
+	case "command":
+		command := jobReq.Command
+		id, err = h.jobs.Submit("command", command, func(ctx context.Context) (interface{}, error) {
+			return runJobCommand(ctx, command)
+		})
+	default:
+		err = fmt.Errorf("unsupported job kind: %s", jobReq.Kind)
+	}
+
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("job submission failed: %v", err)})
+		return
+	}
+
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"job_id"},
+		Rows:    [][]interface{}{{id}},
+	})
+}
@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReloadKeepsState(t *testing.T) {
+	h := newReloadTestHandler(t)
+
+	t.Run("rate limit buckets", func(t *testing.T) {
+		h.SetRateLimiterConfig(&RateLimiterConfig{RequestsPerSecond: 1, BurstSize: 5, CleanupInterval: time.Minute})
+		for i := 0; i < 3; i++ {
+			if !h.rateLimiter.Reserve("10.0.0.1").Allowed {
+				t.Fatalf("request %d rejected within the burst", i+1)
+			}
+		}
+
+		h.SetRateLimiterConfig(&RateLimiterConfig{RequestsPerSecond: 1, BurstSize: 10, CleanupInterval: time.Minute})
+		stats := h.GetRateLimiterStats()
+		if len(stats.Clients) != 1 || stats.Clients[0].Allowed != 3 {
+			t.Fatalf("client bucket was not kept across the reload: %+v", stats.Clients)
+		}
+		if tokens := stats.Clients[0].Tokens; tokens < 2 || tokens >= 3 {
+			t.Fatalf("client has %.2f tokens after the reload, expected the 2 it had left", tokens)
+		}
+		if stats.BurstSize != 10 {
+			t.Fatalf("burst size is %d after the reload, expected 10", stats.BurstSize)
+		}
+
+		// Lowering the burst caps what the client has left
+		h.SetRateLimiterConfig(&RateLimiterConfig{RequestsPerSecond: 1, BurstSize: 1, CleanupInterval: time.Minute})
+		if tokens := h.GetRateLimiterStats().Clients[0].Tokens; tokens > 1 {
+			t.Fatalf("client has %.2f tokens, more than the new burst size", tokens)
+		}
+	})
+
+	t.Run("cache contents", func(t *testing.T) {
+		config := DefaultQueryCacheConfig()
+		config.Enabled = true
+		h.SetCacheConfig(config)
+		h.queryCache.Set("SELECT 1", nil, RPCResponse{Columns: []string{"1"}})
+
+		config.TTL = time.Hour
+		h.SetCacheConfig(config)
+		if _, found := h.queryCache.Get("SELECT 1", nil); !found {
+			t.Fatal("cached result was dropped by the reload")
+		}
+
+		config.Enabled = false
+		h.SetCacheConfig(config)
+		config.Enabled = true
+		h.SetCacheConfig(config)
+		if _, found := h.queryCache.Get("SELECT 1", nil); found {
+			t.Fatal("disabling the cache did not clear it")
+		}
+	})
+
+	t.Run("query limiter slots", func(t *testing.T) {
+		h.SetQueryLimiterConfig(QueryLimiterConfig{MaxConcurrent: 2, MaxWait: 10 * time.Millisecond})
+		first, err := h.queryLimiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		second, err := h.queryLimiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		h.SetQueryLimiterConfig(QueryLimiterConfig{MaxConcurrent: 2, MaxWait: 10 * time.Millisecond})
+		if _, err := h.queryLimiter.Acquire(context.Background()); err == nil {
+			t.Fatal("the reload handed out slots that were already taken")
+		}
+
+		// A slot given back after the reload is available again
+		first()
+		third, err := h.queryLimiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatalf("slot given back after the reload is not reusable: %v", err)
+		}
+		second()
+		third()
+		if running := h.queryLimiter.GetStats().Running; running != 0 {
+			t.Fatalf("%d statements still counted as running", running)
+		}
+	})
+
+	t.Run("raised limit wakes waiters", func(t *testing.T) {
+		h.SetQueryLimiterConfig(QueryLimiterConfig{MaxConcurrent: 1, MaxWait: time.Minute})
+		release, err := h.queryLimiter.Acquire(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer release()
+
+		acquired := make(chan error, 1)
+		go func() {
+			release, err := h.queryLimiter.Acquire(context.Background())
+			if err == nil {
+				release()
+			}
+			acquired <- err
+		}()
+		for h.queryLimiter.GetStats().Waiting == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		h.SetQueryLimiterConfig(QueryLimiterConfig{MaxConcurrent: 2, MaxWait: time.Minute})
+		select {
+		case err := <-acquired:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("waiting statement did not get the slot added by the reload")
+		}
+	})
+}
+
+// TestConcurrentReload reloads every live setting while requests use them;
+// run with -race to catch unsynchronized access
+func TestConcurrentReload(t *testing.T) {
+	h := newReloadTestHandler(t)
+	h.SetQueryLimiterConfig(QueryLimiterConfig{MaxConcurrent: 4, MaxWait: time.Second})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := RPCRequest{Type: "sql", Query: "SELECT id FROM items WHERE id = ?", Params: []interface{}{1}}
+			for ctx.Err() == nil {
+				h.rateLimiter.Reserve("10.0.0.1")
+				h.sqlValidator.ValidateQuery(req.Query, req.Params)
+				h.queryCache.Lookup(req.Query, req.Params)
+				h.queryCache.Set(req.Query, req.Params, RPCResponse{})
+				if release, err := h.queryLimiter.Acquire(ctx); err == nil {
+					release()
+				}
+				h.slowQueryLog.IsSlow(time.Second)
+				h.prioritizeQuery(ctx, req)
+				h.progressEnabled()
+			}
+		}()
+	}
+
+	for i := 0; ctx.Err() == nil; i++ {
+		cacheConfig := DefaultQueryCacheConfig()
+		cacheConfig.Enabled = i%2 == 0
+		cacheConfig.MaxSize = 1 + i%3
+		h.SetCacheConfig(cacheConfig)
+
+		validation := DefaultSQLValidationConfig()
+		validation.StrictMode = i%2 == 0
+		h.SetSQLValidationConfig(validation)
+
+		h.SetRateLimiterConfig(&RateLimiterConfig{RequestsPerSecond: 1 + i%5, BurstSize: 1 + i%7, CleanupInterval: time.Minute})
+		h.SetQueryLimiterConfig(QueryLimiterConfig{MaxConcurrent: 1 + i%4, MaxWait: time.Second})
+
+		slow := DefaultSlowQueryConfig()
+		slow.MaxEntries = 1 + i%10
+		h.SetSlowQueryConfig(slow)
+
+		priority := DefaultPriorityConfig()
+		priority.Enabled = false // Enabled priorities look up the database dialect
+		priority.LowMaxExecutionTime = time.Duration(i) * time.Millisecond
+		h.SetPriorityConfig(priority)
+
+		h.SetProgressConfig(ProgressConfig{Enabled: i%2 == 0, Interval: time.Second})
+	}
+	wg.Wait()
+}
+
+// newReloadTestHandler returns a handler that is never connected
+func newReloadTestHandler(t *testing.T) *Handler {
+	t.Helper()
+
+	h := NewHandler("reload-test", "", "", "open", nil)
+	t.Cleanup(func() { h.rateLimiter.Stop() })
+	return h
+}
@@ -0,0 +1,246 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrOverloaded is the error code of requests shed while the server is
+// above its memory or CPU thresholds
+const ErrOverloaded = "OVERLOADED"
+
+// LoadSheddingConfig holds configuration for the memory and CPU guardrails
+type LoadSheddingConfig struct {
+	MaxMemoryMB    int           // Process RSS above which low-priority requests are shed (0 = no limit)
+	MaxCPUPercent  float64       // Process CPU use, in percent of all cores, above which they are shed (0 = no limit)
+	SampleInterval time.Duration // Time between resource samples
+}
+
+// DefaultLoadSheddingConfig returns the default guardrail configuration (no
+// thresholds, nothing is shed)
+func DefaultLoadSheddingConfig() LoadSheddingConfig {
+	return LoadSheddingConfig{
+		MaxMemoryMB:    0,
+		MaxCPUPercent:  0,
+		SampleInterval: 5 * time.Second,
+	}
+}
+
+// enabled reports whether any threshold is set
+func (lc LoadSheddingConfig) enabled() bool {
+	return lc.MaxMemoryMB > 0 || lc.MaxCPUPercent > 0
+}
+
+// OverloadInfo describes why a request was shed, in RPCResponse
+type OverloadInfo struct {
+	Reason       string  `json:"reason"`       // Threshold exceeded: "memory" or "cpu"
+	MemoryMB     float64 `json:"memoryMB"`     // Process RSS at the last sample
+	CPUPercent   float64 `json:"cpuPercent"`   // Process CPU use at the last sample
+	RetryAfterMs int64   `json:"retryAfterMs"` // Time until the next sample
+}
+
+// ResourceStats contains the latest resource sample and shedding counters
+type ResourceStats struct {
+	MemoryMB   float64   `json:"memory_mb"`   // Process RSS
+	CPUPercent float64   `json:"cpu_percent"` // Process CPU use, in percent of all cores
+	Overloaded bool      `json:"overloaded"`  // Low-priority requests are being shed
+	Reason     string    `json:"reason"`      // Threshold exceeded while overloaded
+	Since      time.Time `json:"since"`       // When the current overload started
+	Shed       int64     `json:"shed"`        // Requests shed since the server started
+	SampledAt  time.Time `json:"sampled_at"`  // Time of the latest sample
+}
+
+// ResourceMonitor samples the process's memory and CPU use and tells
+// whether the server is overloaded
+type ResourceMonitor struct {
+	mutex  sync.RWMutex
+	config LoadSheddingConfig
+	stats  ResourceStats
+
+	lastCPU    time.Duration // Process CPU time at the previous sample
+	lastSample time.Time
+	shed       int64 // atomic
+}
+
+// NewResourceMonitor creates a resource monitor
+func NewResourceMonitor(config LoadSheddingConfig) *ResourceMonitor {
+	rm := &ResourceMonitor{}
+	rm.SetConfig(config)
+	return rm
+}
+
+// SetConfig replaces the thresholds; they apply from the next sample
+func (rm *ResourceMonitor) SetConfig(config LoadSheddingConfig) {
+	if config.SampleInterval <= 0 {
+		config.SampleInterval = DefaultLoadSheddingConfig().SampleInterval
+	}
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+	rm.config = config
+	if !config.enabled() {
+		rm.stats.Overloaded = false
+		rm.stats.Reason = ""
+	}
+}
+
+// run samples resources until ctx is done
+func (rm *ResourceMonitor) run(ctx context.Context) {
+	for {
+		rm.mutex.RLock()
+		interval := rm.config.SampleInterval
+		rm.mutex.RUnlock()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(interval):
+			rm.sample()
+		}
+	}
+}
+
+// sample reads the process's memory and CPU use and updates the overload
+// state
+func (rm *ResourceMonitor) sample() {
+	now := time.Now()
+	memoryMB := float64(processRSS()) / (1024 * 1024)
+	cpuTime, cpuKnown := processCPUTime()
+
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	cpuPercent := 0.0
+	if cpuKnown && !rm.lastSample.IsZero() {
+		if wall := now.Sub(rm.lastSample); wall > 0 {
+			cpuPercent = float64(cpuTime-rm.lastCPU) / float64(wall) / float64(runtime.NumCPU()) * 100
+		}
+	}
+	rm.lastCPU = cpuTime
+	rm.lastSample = now
+
+	reason := ""
+	if rm.config.MaxMemoryMB > 0 && memoryMB > float64(rm.config.MaxMemoryMB) {
+		reason = "memory"
+	} else if rm.config.MaxCPUPercent > 0 && cpuPercent > rm.config.MaxCPUPercent {
+		reason = "cpu"
+	}
+
+	switch {
+	case reason != "" && !rm.stats.Overloaded:
+		log.Printf("[server] Overloaded (%s): memory %.0f MB, CPU %.0f%%; shedding low-priority requests", reason, memoryMB, cpuPercent)
+		rm.stats.Since = now
+	case reason == "" && rm.stats.Overloaded:
+		log.Printf("[server] Load back under thresholds after %v (memory %.0f MB, CPU %.0f%%)",
+			now.Sub(rm.stats.Since).Round(time.Second), memoryMB, cpuPercent)
+		rm.stats.Since = time.Time{}
+	}
+	rm.stats.MemoryMB = memoryMB
+	rm.stats.CPUPercent = cpuPercent
+	rm.stats.Overloaded = reason != ""
+	rm.stats.Reason = reason
+	rm.stats.SampledAt = now
+}
+
+// overload returns why the server is overloaded, or nil
+func (rm *ResourceMonitor) overload() *OverloadInfo {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+	if !rm.stats.Overloaded {
+		return nil
+	}
+	retryAfter := rm.config.SampleInterval - time.Since(rm.stats.SampledAt)
+	if retryAfter < 0 {
+		retryAfter = 0
+	}
+	return &OverloadInfo{
+		Reason:       rm.stats.Reason,
+		MemoryMB:     rm.stats.MemoryMB,
+		CPUPercent:   rm.stats.CPUPercent,
+		RetryAfterMs: retryAfter.Milliseconds(),
+	}
+}
+
+// GetStats returns the latest sample and shedding counters
+func (rm *ResourceMonitor) GetStats() ResourceStats {
+	rm.mutex.RLock()
+	defer rm.mutex.RUnlock()
+	stats := rm.stats
+	stats.Shed = atomic.LoadInt64(&rm.shed)
+	return stats
+}
+
+// processRSS returns the resident set size of the process. Outside Linux
+// it falls back to the memory the Go runtime obtained from the system.
+func processRSS() uint64 {
+	if data, err := os.ReadFile("/proc/self/statm"); err == nil {
+		if fields := strings.Fields(string(data)); len(fields) > 1 {
+			if pages, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+				return pages * uint64(os.Getpagesize())
+			}
+		}
+	}
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	return mem.Sys
+}
+
+// sheddable reports whether a request may be shed under load: low priority
+// requests, batches and bulk transfers. High priority requests, heartbeats
+// and interactive requests are always processed.
+func sheddable(req RPCRequest) bool {
+	if req.Priority == PriorityHigh || req.Type == "heartbeat_ping" {
+		return false
+	}
+	if req.Priority == PriorityLow || len(req.Batch) > 0 {
+		return true
+	}
+	switch req.Type {
+	case "bulk", "export", "script", "migrate", "job":
+		return true
+	}
+	return false
+}
+
+// shedLoad answers a sheddable request with an "overloaded" error while the
+// server is above its thresholds, and reports whether it did
+func (h *Handler) shedLoad(req RPCRequest) (RPCResponse, bool) {
+	if !sheddable(req) {
+		return RPCResponse{}, false
+	}
+	info := h.resources.overload()
+	if info == nil {
+		return RPCResponse{}, false
+	}
+	atomic.AddInt64(&h.resources.shed, 1)
+	return RPCResponse{
+		Error:     fmt.Sprintf("server overloaded (%s); low-priority requests are rejected until load drops", info.Reason),
+		ErrorCode: ErrOverloaded,
+		Overload:  info,
+	}, true
+}
+
+// SetLoadSheddingConfig configures the memory and CPU guardrails
+func (h *Handler) SetLoadSheddingConfig(config LoadSheddingConfig) {
+	h.resources.SetConfig(config)
+	if config.SampleInterval <= 0 {
+		config.SampleInterval = DefaultLoadSheddingConfig().SampleInterval
+	}
+	if config.enabled() {
+		log.Printf("[server] Load shedding configured: max_memory=%d MB max_cpu=%.0f%% sample_interval=%v",
+			config.MaxMemoryMB, config.MaxCPUPercent, config.SampleInterval)
+	}
+}
+
+// GetResourceStats returns the latest memory and CPU sample and whether
+// low-priority requests are being shed
+func (h *Handler) GetResourceStats() ResourceStats {
+	return h.resources.GetStats()
+}
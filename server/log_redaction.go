@@ -0,0 +1,56 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/lordbasex/burrowctl/client"
+)
+
+// EnableLogRedaction masks credentials, such as the passwords of AMQP URLs
+// and MySQL DSNs, in everything written through the standard logger from
+// now on (see client.Redact)
+func EnableLogRedaction() {
+	log.SetOutput(client.NewRedactingWriter(log.Writer()))
+}
+
+// SetLogRedaction sets whether logged queries, commands and function calls
+// have their literal values masked, so logs show what ran but not the data
+// it carried
+func (h *Handler) SetLogRedaction(queries bool) {
+	h.redactQueryLogs = queries
+	if queries {
+		log.Printf("[server] Query log redaction enabled")
+	}
+}
+
+// loggedQuery returns a query as logs show it: with its literal values
+// masked when query log redaction is enabled, and truncated to maxLength
+// (0: not truncated)
+func (h *Handler) loggedQuery(query string, maxLength int) string {
+	if h.redactQueryLogs {
+		query = client.RedactQuery(query)
+	}
+	if maxLength > 0 {
+		query = truncateQuery(query, maxLength)
+	}
+	return query
+}
+
+// loggedRequest returns the query of a request as logs show it; function
+// calls keep their name and parameter types and lose the values
+func (h *Handler) loggedRequest(req RPCRequest) string {
+	if !h.redactQueryLogs || req.Type != "function" {
+		return h.loggedQuery(req.Query, 0)
+	}
+
+	var funcReq FunctionRequest
+	if err := json.Unmarshal([]byte(req.Query), &funcReq); err != nil {
+		return client.RedactQuery(req.Query)
+	}
+	for i := range funcReq.Params {
+		funcReq.Params[i].Value = redactedValue
+	}
+	redacted, _ := json.Marshal(funcReq)
+	return string(redacted)
+}
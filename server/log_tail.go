@@ -0,0 +1,580 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// LogTailConfig holds configuration for the log.tail request type
+type LogTailConfig struct {
+	Enabled         bool     `json:"enabled"`           // Whether log tails are accepted
+	Paths           []string `json:"paths"`             // Directories or glob patterns of files clients may tail
+	Units           []string `json:"units"`             // journald units (or patterns such as "myapp-*") clients may tail
+	MaxTails        int      `json:"max_tails"`         // Tails running at the same time
+	MaxInitialLines int      `json:"max_initial_lines"` // Most lines of history sent when a tail starts
+	Lease           Duration `json:"lease"`             // A tail stops when the client does not renew it for this long
+	PollInterval    Duration `json:"poll_interval"`     // How often files are checked and lines published
+}
+
+// DefaultLogTailConfig returns a disabled log tail configuration
+func DefaultLogTailConfig() LogTailConfig {
+	return LogTailConfig{
+		Enabled:         false,
+		MaxTails:        5,
+		MaxInitialLines: 1000,
+		Lease:           Duration(30 * time.Second),
+		PollInterval:    Duration(250 * time.Millisecond),
+	}
+}
+
+// LoadLogTailConfig reads a log tail configuration from a JSON file.
+//
+// Example:
+//
+//	{
+//	  "enabled": true,
+//	  "paths": ["/var/log/myapp", "/var/log/nginx/*.log"],
+//	  "units": ["myapp.service", "nginx.service"]
+//	}
+func LoadLogTailConfig(path string) (LogTailConfig, error) {
+	config := DefaultLogTailConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read log tail config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse log tail config %s: %w", path, err)
+	}
+	return config, config.Validate()
+}
+
+// Validate checks the allowlists and limits
+func (lc LogTailConfig) Validate() error {
+	for _, p := range lc.Paths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("log tail path %q must be absolute", p)
+		}
+		if _, err := filepath.Match(p, ""); err != nil {
+			return fmt.Errorf("log tail path %q: %w", p, err)
+		}
+	}
+	for _, unit := range lc.Units {
+		if _, err := path.Match(unit, ""); err != nil {
+			return fmt.Errorf("log tail unit %q: %w", unit, err)
+		}
+	}
+	if lc.MaxTails < 0 || lc.MaxInitialLines < 0 || lc.Lease < 0 || lc.PollInterval < 0 {
+		return fmt.Errorf("log tail limits must not be negative")
+	}
+	return nil
+}
+
+// LogTailRequest is the body of a log.tail request.
+//
+// The client picks the tail ID and subscribes to the event channel
+// "logtail:<id>" before starting the tail with Path or Unit, so no line is
+// missed. Lines are published on that channel as LogTailEvent until the
+// tail is stopped or its lease runs out; sending the ID alone renews the
+// lease, and Stop ends the tail.
+type LogTailRequest struct {
+	TailID string `json:"tailID"`          // Client-chosen ID, 8-64 letters, digits, '_' or '-'
+	Path   string `json:"path,omitempty"`  // Absolute path of the file to tail
+	Unit   string `json:"unit,omitempty"`  // journald unit to tail
+	Lines  int    `json:"lines,omitempty"` // Lines of history to send first
+	Stop   bool   `json:"stop,omitempty"`  // End the tail
+}
+
+// LogTailEvent is published on a tail's event channel. The last event of a
+// tail has Done set, with Error explaining why it ended unless it was stopped
+// by the client.
+type LogTailEvent struct {
+	Seq   int64    `json:"seq"`             // Sequence number of the first line, counting from 1
+	Lines []string `json:"lines,omitempty"` // Lines without their line terminator
+	Done  bool     `json:"done,omitempty"`
+	Error string   `json:"error,omitempty"`
+}
+
+var (
+	// tailIDPattern restricts tail IDs to characters allowed in event channels
+	tailIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{8,64}$`)
+
+	// unitPattern matches systemd unit names; the leading character cannot
+	// start a journalctl flag
+	unitPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9@._:-]*$`)
+
+	errTailStopped = errors.New("stopped")
+)
+
+const (
+	// maxLogLineLength truncates longer lines
+	maxLogLineLength = 64 << 10
+	// logTailBatchSize is the most lines published in one event
+	logTailBatchSize = 200
+	// logTailHistoryWindow is how far from the end of a file history lines are looked for
+	logTailHistoryWindow = 1 << 20
+)
+
+// logTail is a running tail
+type logTail struct {
+	id      string
+	source  string
+	cancel  context.CancelCauseFunc
+	expires time.Time
+}
+
+// LogTailManager streams lines of allowlisted log files and journald units
+// to clients over the events exchange.
+type LogTailManager struct {
+	handler *Handler
+	config  LogTailConfig
+	paths   []string
+
+	ctx    context.Context // Parent of every tail, cancelled on shutdown
+	cancel context.CancelFunc
+
+	mutex sync.Mutex
+	tails map[string]*logTail
+}
+
+// NewLogTailManager creates a log tail manager; config must be valid
+func NewLogTailManager(handler *Handler, config LogTailConfig) *LogTailManager {
+	defaults := DefaultLogTailConfig()
+	if config.MaxTails <= 0 {
+		config.MaxTails = defaults.MaxTails
+	}
+	if config.MaxInitialLines <= 0 {
+		config.MaxInitialLines = defaults.MaxInitialLines
+	}
+	if config.Lease <= 0 {
+		config.Lease = defaults.Lease
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = defaults.PollInterval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LogTailManager{
+		handler: handler,
+		config:  config,
+		paths:   resolveAllowedPaths(config.Paths),
+		ctx:     ctx,
+		cancel:  cancel,
+		tails:   make(map[string]*logTail),
+	}
+}
+
+// run stops tails whose lease ran out, and every tail when ctx is cancelled
+func (lm *LogTailManager) run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			lm.cancel()
+			return
+		case now := <-ticker.C:
+			lm.mutex.Lock()
+			for _, tail := range lm.tails {
+				if now.After(tail.expires) {
+					tail.cancel(errors.New("lease expired"))
+				}
+			}
+			lm.mutex.Unlock()
+		}
+	}
+}
+
+// Handle starts, renews or stops a tail
+func (lm *LogTailManager) Handle(req LogTailRequest) (RPCResponse, error) {
+	if !tailIDPattern.MatchString(req.TailID) {
+		return RPCResponse{}, fmt.Errorf("invalid tail ID %q", req.TailID)
+	}
+
+	lm.mutex.Lock()
+	defer lm.mutex.Unlock()
+
+	tail, exists := lm.tails[req.TailID]
+	switch {
+	case req.Stop:
+		if exists {
+			tail.cancel(errTailStopped)
+		}
+		return RPCResponse{Columns: []string{"tail_id", "stopped"}, Rows: [][]interface{}{{req.TailID, exists}}}, nil
+	case req.Path == "" && req.Unit == "":
+		if !exists {
+			return RPCResponse{}, fmt.Errorf("unknown tail %s", req.TailID)
+		}
+		tail.expires = time.Now().Add(time.Duration(lm.config.Lease))
+	case exists:
+		return RPCResponse{}, fmt.Errorf("tail %s is already running", req.TailID)
+	default:
+		if err := lm.start(req); err != nil {
+			return RPCResponse{}, err
+		}
+	}
+
+	return RPCResponse{
+		Columns: []string{"tail_id", "channel", "lease_ms"},
+		Rows:    [][]interface{}{{req.TailID, logTailChannel(req.TailID), time.Duration(lm.config.Lease).Milliseconds()}},
+	}, nil
+}
+
+// logTailChannel returns the event channel of a tail
+func logTailChannel(id string) string {
+	return "logtail:" + id
+}
+
+// start validates the source and starts a tail; the caller holds lm.mutex
+func (lm *LogTailManager) start(req LogTailRequest) error {
+	if len(lm.tails) >= lm.config.MaxTails {
+		return fmt.Errorf("too many log tails running (max %d)", lm.config.MaxTails)
+	}
+	lines := req.Lines
+	if lines < 0 || lines > lm.config.MaxInitialLines {
+		lines = lm.config.MaxInitialLines
+	}
+
+	var (
+		source string
+		reader func(ctx context.Context, out chan<- string) error
+	)
+	if req.Path != "" {
+		resolved, err := resolvePath(req.Path)
+		if err != nil {
+			return err
+		}
+		if !pathAllowed(resolved, lm.paths) {
+			return fmt.Errorf("path %s is not allowed", req.Path)
+		}
+		source = resolved
+		reader = func(ctx context.Context, out chan<- string) error {
+			return lm.tailFile(ctx, resolved, lines, out)
+		}
+	} else {
+		if !unitPattern.MatchString(req.Unit) || !unitAllowed(req.Unit, lm.config.Units) {
+			return fmt.Errorf("unit %s is not allowed", req.Unit)
+		}
+		source = "journald:" + req.Unit
+		reader = func(ctx context.Context, out chan<- string) error {
+			return tailJournal(ctx, req.Unit, lines, out)
+		}
+	}
+
+	ctx, cancel := context.WithCancelCause(lm.ctx)
+	tail := &logTail{
+		id:      req.TailID,
+		source:  source,
+		cancel:  cancel,
+		expires: time.Now().Add(time.Duration(lm.config.Lease)),
+	}
+	lm.tails[tail.id] = tail
+
+	out := make(chan string, logTailBatchSize)
+	readErr := make(chan error, 1)
+	go func() {
+		readErr <- reader(ctx, out)
+		close(out)
+	}()
+	go lm.publish(ctx, tail, out, readErr)
+
+	log.Printf("[server] Log tail %s started on %s", tail.id, source)
+	return nil
+}
+
+// unitAllowed reports whether unit matches an allowed unit or pattern
+func unitAllowed(unit string, allowed []string) bool {
+	for _, entry := range allowed {
+		if ok, _ := path.Match(entry, unit); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// publish sends the lines read by a tail in batches until the reader ends,
+// then publishes the final event and forgets the tail
+func (lm *LogTailManager) publish(ctx context.Context, tail *logTail, out <-chan string, readErr <-chan error) {
+	channel := logTailChannel(tail.id)
+	ticker := time.NewTicker(time.Duration(lm.config.PollInterval))
+	defer ticker.Stop()
+
+	seq := int64(1)
+	var batch []string
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := lm.handler.PublishEvent(channel, LogTailEvent{Seq: seq, Lines: batch}); err != nil {
+			log.Printf("[server] Log tail %s: failed to publish lines: %v", tail.id, err)
+		}
+		seq += int64(len(batch))
+		batch = nil
+	}
+
+	for {
+		select {
+		case line, ok := <-out:
+			if !ok {
+				flush()
+				lm.finish(ctx, tail, channel, seq, <-readErr)
+				return
+			}
+			batch = append(batch, line)
+			if len(batch) >= logTailBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// finish publishes the final event of a tail and removes it
+func (lm *LogTailManager) finish(ctx context.Context, tail *logTail, channel string, seq int64, err error) {
+	if ctx.Err() != nil {
+		err = context.Cause(ctx)
+	}
+	tail.cancel(errTailStopped)
+
+	event := LogTailEvent{Seq: seq, Done: true}
+	if err != nil && !errors.Is(err, errTailStopped) {
+		event.Error = err.Error()
+	}
+	if err := lm.handler.PublishEvent(channel, event); err != nil {
+		log.Printf("[server] Log tail %s: failed to publish end: %v", tail.id, err)
+	}
+
+	lm.mutex.Lock()
+	delete(lm.tails, tail.id)
+	lm.mutex.Unlock()
+
+	if event.Error != "" {
+		log.Printf("[server] Log tail %s on %s ended: %s", tail.id, tail.source, event.Error)
+	} else {
+		log.Printf("[server] Log tail %s on %s stopped", tail.id, tail.source)
+	}
+}
+
+// tailFile sends the last lines of a file, then every line appended to it.
+// A file that is replaced (log rotation) or truncated is followed from its
+// beginning.
+func (lm *LogTailManager) tailFile(ctx context.Context, filePath string, history int, out chan<- string) error {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer func() { file.Close() }()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", filePath)
+	}
+
+	// Follow from the end of the last complete line, so an unfinished line
+	// is delivered whole once it is completed
+	offset, err := sendHistory(ctx, file, info.Size(), history, out)
+	if err != nil {
+		return err
+	}
+
+	var partial []byte
+	buffer := make([]byte, 32<<10)
+	ticker := time.NewTicker(time.Duration(lm.config.PollInterval))
+	defer ticker.Stop()
+
+	for {
+		// Read everything appended since the last poll
+		for {
+			n, readErr := file.ReadAt(buffer, offset)
+			offset += int64(n)
+			partial = append(partial, buffer[:n]...)
+			for {
+				i := bytes.IndexByte(partial, '\n')
+				if i < 0 {
+					break
+				}
+				if !sendLine(ctx, out, partial[:i]) {
+					return ctx.Err()
+				}
+				partial = partial[i+1:]
+			}
+			if len(partial) > maxLogLineLength {
+				if !sendLine(ctx, out, partial) {
+					return ctx.Err()
+				}
+				partial = nil
+			}
+			if readErr == io.EOF || n == 0 {
+				break
+			}
+			if readErr != nil {
+				return readErr
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		// Follow rotation and truncation; a missing file may be about to be recreated
+		current, err := os.Stat(filePath)
+		if err != nil {
+			continue
+		}
+		if !os.SameFile(info, current) {
+			reopened, err := os.Open(filePath)
+			if err != nil {
+				continue
+			}
+			file.Close()
+			file, info, offset, partial = reopened, current, 0, nil
+		} else if current.Size() < offset {
+			offset, partial = 0, nil
+		}
+	}
+}
+
+// sendHistory sends up to lines complete lines preceding size and returns
+// the offset following the last complete line
+func sendHistory(ctx context.Context, file *os.File, size int64, lines int, out chan<- string) (int64, error) {
+	start := size - logTailHistoryWindow
+	if start < 0 {
+		start = 0
+	}
+	data := make([]byte, size-start)
+	if _, err := file.ReadAt(data, start); err != nil && err != io.EOF {
+		return 0, err
+	}
+
+	end := bytes.LastIndexByte(data, '\n')
+	if end < 0 {
+		if start == 0 {
+			return 0, nil
+		}
+		return size, nil // A single line longer than the window
+	}
+	offset := start + int64(end) + 1
+	if lines <= 0 || end == 0 {
+		return offset, nil
+	}
+	all := strings.Split(string(data[:end]), "\n")
+	if start > 0 {
+		all = all[1:] // The first line is cut by the window
+	}
+	if len(all) > lines {
+		all = all[len(all)-lines:]
+	}
+	for _, line := range all {
+		if !sendLine(ctx, out, []byte(line)) {
+			return 0, ctx.Err()
+		}
+	}
+	return offset, nil
+}
+
+// sendLine sends a line without its terminator, truncated to maxLogLineLength
+func sendLine(ctx context.Context, out chan<- string, line []byte) bool {
+	if len(line) > maxLogLineLength {
+		line = line[:maxLogLineLength]
+	}
+	select {
+	case out <- strings.TrimSuffix(string(line), "\r"):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// tailJournal follows a journald unit with journalctl
+func tailJournal(ctx context.Context, unit string, history int, out chan<- string) error {
+	cmd := exec.CommandContext(ctx, "journalctl", "--follow", "--output=cat", "--no-pager",
+		fmt.Sprintf("--lines=%d", history), "--unit="+unit)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to run journalctl: %w", err)
+	}
+
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64<<10), maxLogLineLength*2)
+	for scanner.Scan() {
+		if !sendLine(ctx, out, scanner.Bytes()) {
+			break
+		}
+	}
+	scanErr := scanner.Err()
+
+	waitErr := cmd.Wait()
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if scanErr != nil {
+		return scanErr
+	}
+	if waitErr != nil {
+		return fmt.Errorf("journalctl exited: %w", waitErr)
+	}
+	return errors.New("journalctl exited")
+}
+
+// SetLogTailConfig enables the log.tail request type
+func (h *Handler) SetLogTailConfig(config LogTailConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	if !config.Enabled {
+		h.logTail = nil
+		return nil
+	}
+
+	h.logTail = NewLogTailManager(h, config)
+	log.Printf("[server] Log tail enabled: %d paths, %d units, max %d tails",
+		len(config.Paths), len(config.Units), h.logTail.config.MaxTails)
+	return nil
+}
+
+// handleLogTail serves log.tail requests
+func (h *Handler) handleLogTail(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	if h.logTail == nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "log tail is not enabled on this device"})
+		return
+	}
+
+	var tailReq LogTailRequest
+	if err := json.Unmarshal([]byte(req.Query), &tailReq); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("invalid log tail request: %v", err)})
+		return
+	}
+
+	resp, err := h.logTail.Handle(tailReq)
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("log.tail failed: %v", err)})
+		return
+	}
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, resp)
+}
@@ -0,0 +1,425 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaintenanceTask is a named list of housekeeping statements such as
+// OPTIMIZE TABLE, ANALYZE TABLE or batched purges of old rows.
+type MaintenanceTask struct {
+	Name            string   `json:"name"`              // Unique task name used for remote triggering
+	Statements      []string `json:"statements"`        // Statements executed in order
+	RepeatUntilDone bool     `json:"repeat_until_done"` // Re-run each statement until it affects no rows (batched DELETE ... LIMIT n)
+	MaxRuntime      Duration `json:"max_runtime"`       // Runtime cap for the whole task (0 = MaintenanceConfig.MaxRuntime)
+	Pause           Duration `json:"pause"`             // Pause between repetitions to let other queries through
+}
+
+// MaintenanceWindow is a daily time range ("HH:MM", local time) in which
+// scheduled tasks may run. A window may span midnight (e.g. 23:00-02:00).
+type MaintenanceWindow struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// MaintenanceConfig holds configuration for the maintenance subsystem
+type MaintenanceConfig struct {
+	Enabled       bool                `json:"enabled"`        // Whether scheduled maintenance runs
+	Tasks         []MaintenanceTask   `json:"tasks"`          // Configured tasks
+	Windows       []MaintenanceWindow `json:"windows"`        // Windows for scheduled runs (empty = remote trigger only)
+	MaxRuntime    Duration            `json:"max_runtime"`    // Default runtime cap per task
+	CheckInterval Duration            `json:"check_interval"` // How often the scheduler checks the windows
+}
+
+// DefaultMaintenanceConfig returns a disabled maintenance configuration
+func DefaultMaintenanceConfig() MaintenanceConfig {
+	return MaintenanceConfig{
+		Enabled:       false,
+		MaxRuntime:    Duration(30 * time.Minute),
+		CheckInterval: Duration(1 * time.Minute),
+	}
+}
+
+// LoadMaintenanceConfig reads a maintenance configuration from a JSON file.
+//
+// Example:
+//
+//	{
+//	  "enabled": true,
+//	  "windows": [{"start": "02:00", "end": "04:00"}],
+//	  "max_runtime": "20m",
+//	  "tasks": [
+//	    {"name": "optimize", "statements": ["OPTIMIZE TABLE events", "ANALYZE TABLE events"]},
+//	    {"name": "purge", "statements": ["DELETE FROM events WHERE created_at < NOW() - INTERVAL 90 DAY LIMIT 5000"],
+//	     "repeat_until_done": true, "pause": "500ms"}
+//	  ]
+//	}
+func LoadMaintenanceConfig(path string) (MaintenanceConfig, error) {
+	config := DefaultMaintenanceConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read maintenance config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse maintenance config %s: %w", path, err)
+	}
+	return config, config.Validate()
+}
+
+// Validate checks task names, statements and windows
+func (mc MaintenanceConfig) Validate() error {
+	seen := make(map[string]bool)
+	for _, task := range mc.Tasks {
+		if task.Name == "" {
+			return fmt.Errorf("maintenance task without a name")
+		}
+		if seen[task.Name] {
+			return fmt.Errorf("duplicate maintenance task: %s", task.Name)
+		}
+		seen[task.Name] = true
+		if len(task.Statements) == 0 {
+			return fmt.Errorf("maintenance task %s has no statements", task.Name)
+		}
+	}
+	for _, window := range mc.Windows {
+		if _, err := parseClock(window.Start); err != nil {
+			return err
+		}
+		if _, err := parseClock(window.End); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseClock parses "HH:MM" into minutes after midnight
+func parseClock(value string) (int, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid time '%s': expected HH:MM", value)
+	}
+	hours, err1 := strconv.Atoi(parts[0])
+	minutes, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || hours < 0 || hours > 23 || minutes < 0 || minutes > 59 {
+		return 0, fmt.Errorf("invalid time '%s': expected HH:MM", value)
+	}
+	return hours*60 + minutes, nil
+}
+
+// windowStart returns the start of the window containing now, or false when
+// now is outside every window.
+func (mc MaintenanceConfig) windowStart(now time.Time) (time.Time, bool) {
+	current := now.Hour()*60 + now.Minute()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+
+	for _, window := range mc.Windows {
+		start, _ := parseClock(window.Start)
+		end, _ := parseClock(window.End)
+
+		switch {
+		case start <= end && current >= start && current < end:
+			return midnight.Add(time.Duration(start) * time.Minute), true
+		case start > end && current >= start:
+			return midnight.Add(time.Duration(start) * time.Minute), true
+		case start > end && current < end:
+			return midnight.AddDate(0, 0, -1).Add(time.Duration(start) * time.Minute), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// MaintenanceProgress reports the state of a maintenance run
+type MaintenanceProgress struct {
+	Task             string    `json:"task"`
+	Trigger          string    `json:"trigger"` // "schedule" or "remote"
+	Status           string    `json:"status"`  // "running", "completed", "failed" or "timed_out"
+	StartedAt        time.Time `json:"started_at"`
+	FinishedAt       time.Time `json:"finished_at,omitempty"`
+	StatementsTotal  int       `json:"statements_total"`
+	StatementsDone   int       `json:"statements_done"`
+	CurrentStatement string    `json:"current_statement,omitempty"`
+	RowsAffected     int64     `json:"rows_affected"`
+	Error            string    `json:"error,omitempty"`
+}
+
+// MaintenanceManager runs maintenance tasks on schedule or on demand.
+// Only one task runs at a time.
+type MaintenanceManager struct {
+	handler *Handler
+	config  MaintenanceConfig
+
+	mutex   sync.Mutex
+	current *MaintenanceProgress            // Task currently running (nil when idle)
+	last    map[string]*MaintenanceProgress // Last run per task
+}
+
+// NewMaintenanceManager creates a new maintenance manager
+func NewMaintenanceManager(handler *Handler, config MaintenanceConfig) *MaintenanceManager {
+	if config.CheckInterval <= 0 {
+		config.CheckInterval = DefaultMaintenanceConfig().CheckInterval
+	}
+	if config.MaxRuntime <= 0 {
+		config.MaxRuntime = DefaultMaintenanceConfig().MaxRuntime
+	}
+	return &MaintenanceManager{
+		handler: handler,
+		config:  config,
+		last:    make(map[string]*MaintenanceProgress),
+	}
+}
+
+// run is the scheduling loop; it stops when ctx is cancelled
+func (mm *MaintenanceManager) run(ctx context.Context) {
+	if !mm.config.Enabled || len(mm.config.Windows) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(mm.config.CheckInterval))
+	defer ticker.Stop()
+
+	log.Printf("[maintenance] Scheduler started with %d tasks and %d windows", len(mm.config.Tasks), len(mm.config.Windows))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			mm.runDueTasks(ctx, now)
+		}
+	}
+}
+
+// runDueTasks runs, one after another, every task that has not run yet in the current window
+func (mm *MaintenanceManager) runDueTasks(ctx context.Context, now time.Time) {
+	windowStart, ok := mm.config.windowStart(now)
+	if !ok {
+		return
+	}
+
+	for _, task := range mm.config.Tasks {
+		mm.mutex.Lock()
+		last := mm.last[task.Name]
+		busy := mm.current != nil
+		mm.mutex.Unlock()
+
+		if busy || (last != nil && !last.StartedAt.Before(windowStart)) {
+			continue
+		}
+		if _, stillOpen := mm.config.windowStart(time.Now()); !stillOpen {
+			return
+		}
+		mm.runTask(ctx, task, "schedule")
+	}
+}
+
+// Trigger starts a task in the background regardless of the windows
+func (mm *MaintenanceManager) Trigger(name string) error {
+	task, ok := mm.task(name)
+	if !ok {
+		return fmt.Errorf("unknown maintenance task: %s", name)
+	}
+
+	mm.mutex.Lock()
+	if mm.current != nil {
+		running := mm.current.Task
+		mm.mutex.Unlock()
+		return fmt.Errorf("maintenance task %s is already running", running)
+	}
+	mm.mutex.Unlock()
+
+	go mm.runTask(context.Background(), task, "remote")
+	return nil
+}
+
+// task looks up a task by name
+func (mm *MaintenanceManager) task(name string) (MaintenanceTask, bool) {
+	for _, task := range mm.config.Tasks {
+		if task.Name == name {
+			return task, true
+		}
+	}
+	return MaintenanceTask{}, false
+}
+
+// runTask executes a task within its runtime cap and records progress
+func (mm *MaintenanceManager) runTask(ctx context.Context, task MaintenanceTask, trigger string) {
+	progress := &MaintenanceProgress{
+		Task:            task.Name,
+		Trigger:         trigger,
+		Status:          "running",
+		StartedAt:       time.Now(),
+		StatementsTotal: len(task.Statements),
+	}
+
+	mm.mutex.Lock()
+	if mm.current != nil {
+		mm.mutex.Unlock()
+		return
+	}
+	mm.current = progress
+	mm.mutex.Unlock()
+
+	maxRuntime := time.Duration(task.MaxRuntime)
+	if maxRuntime <= 0 {
+		maxRuntime = time.Duration(mm.config.MaxRuntime)
+	}
+	ctx, cancel := context.WithTimeout(ctx, maxRuntime)
+	defer cancel()
+
+	log.Printf("[maintenance] Starting task %s (%s, cap %v)", task.Name, trigger, maxRuntime)
+
+	err := mm.execute(ctx, task, progress)
+
+	mm.mutex.Lock()
+	progress.FinishedAt = time.Now()
+	progress.CurrentStatement = ""
+	switch {
+	case err == nil:
+		progress.Status = "completed"
+	case ctx.Err() == context.DeadlineExceeded:
+		progress.Status = "timed_out"
+		progress.Error = fmt.Sprintf("runtime cap of %v reached", maxRuntime)
+	default:
+		progress.Status = "failed"
+		progress.Error = err.Error()
+	}
+	mm.last[task.Name] = progress
+	mm.current = nil
+	mm.mutex.Unlock()
+
+	log.Printf("[maintenance] Task %s %s after %v (%d/%d statements, %d rows affected)",
+		task.Name, progress.Status, progress.FinishedAt.Sub(progress.StartedAt).Round(time.Millisecond),
+		progress.StatementsDone, progress.StatementsTotal, progress.RowsAffected)
+}
+
+// execute runs the statements of a task, updating progress as it goes
+func (mm *MaintenanceManager) execute(ctx context.Context, task MaintenanceTask, progress *MaintenanceProgress) error {
+	db, release, err := mm.handler.acquireDB()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	for _, statement := range task.Statements {
+		mm.mutex.Lock()
+		progress.CurrentStatement = statement
+		mm.mutex.Unlock()
+
+		for {
+			affected, err := execMaintenanceStatement(ctx, db, statement)
+			if err != nil {
+				return err
+			}
+
+			mm.mutex.Lock()
+			progress.RowsAffected += affected
+			mm.mutex.Unlock()
+
+			if !task.RepeatUntilDone || affected == 0 {
+				break
+			}
+			if task.Pause > 0 {
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				case <-time.After(time.Duration(task.Pause)):
+				}
+			}
+		}
+
+		mm.mutex.Lock()
+		progress.StatementsDone++
+		mm.mutex.Unlock()
+	}
+	return nil
+}
+
+// execMaintenanceStatement runs a statement and returns the affected rows.
+// OPTIMIZE/ANALYZE return a result set, so they are drained with a query.
+func execMaintenanceStatement(ctx context.Context, db *sql.DB, statement string) (int64, error) {
+	upper := strings.ToUpper(strings.TrimSpace(statement))
+	if strings.HasPrefix(upper, "OPTIMIZE") || strings.HasPrefix(upper, "ANALYZE") ||
+		strings.HasPrefix(upper, "CHECK") || strings.HasPrefix(upper, "REPAIR") {
+		rows, err := db.QueryContext(ctx, statement)
+		if err != nil {
+			return 0, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+		}
+		return 0, rows.Err()
+	}
+
+	result, err := db.ExecContext(ctx, statement)
+	if err != nil {
+		return 0, err
+	}
+	affected, _ := result.RowsAffected()
+	return affected, nil
+}
+
+// Status returns the running task and the last run of every task
+func (mm *MaintenanceManager) Status() map[string]interface{} {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	var current interface{}
+	if mm.current != nil {
+		snapshot := *mm.current
+		current = snapshot
+	}
+
+	last := make(map[string]MaintenanceProgress, len(mm.last))
+	for name, progress := range mm.last {
+		last[name] = *progress
+	}
+
+	tasks := make([]string, 0, len(mm.config.Tasks))
+	for _, task := range mm.config.Tasks {
+		tasks = append(tasks, task.Name)
+	}
+
+	return map[string]interface{}{
+		"enabled": mm.config.Enabled,
+		"tasks":   tasks,
+		"windows": mm.config.Windows,
+		"running": current,
+		"last":    last,
+	}
+}
+
+// SetMaintenanceConfig configures the maintenance subsystem and registers the
+// runMaintenanceTask and getMaintenanceStatus functions for remote control.
+func (h *Handler) SetMaintenanceConfig(config MaintenanceConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	h.maintenance = NewMaintenanceManager(h, config)
+
+	h.RegisterFunctionWithMetadata("runMaintenanceTask", func(name string) (string, error) {
+		if err := h.maintenance.Trigger(name); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("maintenance task %s started", name), nil
+	}, FunctionMetadata{
+		Description: "Starts a configured maintenance task outside its window",
+		Params:      []FunctionParamInfo{{Name: "name", Description: "Task name from the maintenance config"}},
+	})
+	h.RegisterFunctionWithMetadata("getMaintenanceStatus", func() map[string]interface{} {
+		return h.maintenance.Status()
+	}, FunctionMetadata{Description: "Returns the progress of every maintenance task"})
+
+	log.Printf("[server] Maintenance configured: %d tasks, %d windows, enabled=%v",
+		len(config.Tasks), len(config.Windows), config.Enabled)
+	return nil
+}
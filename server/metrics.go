@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+)
+
+// metricsWriter writes metrics in the Prometheus text exposition format
+type metricsWriter struct {
+	w        *bufio.Writer
+	deviceID string
+}
+
+// metric writes one sample with its HELP and TYPE lines. Every sample is
+// labelled with the device ID, so a Prometheus scraping several devices
+// through one exporter can tell them apart.
+func (mw *metricsWriter) metric(name, kind, help string, value float64) {
+	fmt.Fprintf(mw.w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(mw.w, "# TYPE %s %s\n", name, kind)
+	fmt.Fprintf(mw.w, "%s{device=%s} %s\n", name, strconv.Quote(mw.deviceID),
+		strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+// writeWorkerPoolMetrics writes the worker pool statistics
+func (mw *metricsWriter) writeWorkerPoolMetrics(stats WorkerPoolStats) {
+	mw.metric("burrowctl_worker_pool_workers", "gauge", "Worker goroutines in the pool.", float64(stats.WorkerCount))
+	mw.metric("burrowctl_worker_pool_active", "gauge", "Tasks being processed by workers.", float64(stats.ActiveTasks))
+	mw.metric("burrowctl_worker_pool_queue_capacity", "gauge", "Capacity of the worker pool queue.", float64(stats.QueueSize))
+	mw.metric("burrowctl_worker_pool_queue_depth", "gauge", "Tasks waiting in the worker pool queue.", float64(stats.QueuedTasks))
+	mw.metric("burrowctl_worker_pool_delayed", "gauge", "Requests waiting out a rate limit delay before they are queued again.", float64(stats.DelayedTasks))
+	mw.metric("burrowctl_worker_pool_processed_total", "counter", "Tasks processed by the worker pool.", float64(stats.Processed))
+	mw.metric("burrowctl_worker_pool_failed_total", "counter", "Tasks answered with an error or that panicked.", float64(stats.Failed))
+	mw.metric("burrowctl_worker_pool_rejected_total", "counter", "Tasks refused because the queue was full or the pool stopping.", float64(stats.Rejected))
+	mw.metric("burrowctl_worker_pool_panics_total", "counter", "Panics recovered while processing tasks.", float64(stats.Panics))
+	mw.metric("burrowctl_worker_pool_task_latency_seconds", "gauge", "Mean time a worker spent on a task.", stats.AvgLatency.Seconds())
+	mw.metric("burrowctl_worker_pool_queue_wait_seconds", "gauge", "Mean time a task waited in the queue.", stats.AvgQueueWait.Seconds())
+}
+
+// writeRateLimiterMetrics writes the rate limiter counters
+func (mw *metricsWriter) writeRateLimiterMetrics(stats RateLimiterStats) {
+	mw.metric("burrowctl_rate_limiter_clients", "gauge", "Clients with a rate limit bucket.", float64(stats.ActiveClients))
+	mw.metric("burrowctl_rate_limiter_allowed_total", "counter", "Requests allowed by the rate limiter.", float64(stats.Allowed))
+	mw.metric("burrowctl_rate_limiter_rejected_total", "counter", "Requests rejected by the rate limiter.", float64(stats.Rejected))
+}
+
+// writeQueryLimiterMetrics writes the concurrent SQL statement counters
+func (mw *metricsWriter) writeQueryLimiterMetrics(stats QueryLimiterStats) {
+	mw.metric("burrowctl_queries_running", "gauge", "SQL statements running against the database.", float64(stats.Running))
+	mw.metric("burrowctl_queries_waiting", "gauge", "SQL statements waiting for a concurrency slot.", float64(stats.Waiting))
+	mw.metric("burrowctl_queries_delayed_total", "counter", "SQL statements that had to wait for a concurrency slot.", float64(stats.Delayed))
+	mw.metric("burrowctl_queries_rejected_total", "counter", "SQL statements rejected after waiting for a concurrency slot.", float64(stats.Rejected))
+}
+
+// writeResourceMetrics writes the latest resource sample and shedding counters
+func (mw *metricsWriter) writeResourceMetrics(stats ResourceStats) {
+	overloaded := 0.0
+	if stats.Overloaded {
+		overloaded = 1
+	}
+	mw.metric("burrowctl_process_resident_memory_bytes", "gauge", "Process RSS at the latest load shedding sample.", stats.MemoryMB*1024*1024)
+	mw.metric("burrowctl_process_cpu_percent", "gauge", "Process CPU use in percent of all cores at the latest load shedding sample.", stats.CPUPercent)
+	mw.metric("burrowctl_overloaded", "gauge", "Whether low-priority requests are being shed (1) or not (0).", overloaded)
+	mw.metric("burrowctl_requests_shed_total", "counter", "Requests shed because the server was overloaded.", float64(stats.Shed))
+}
+
+// serveMetrics writes the server metrics for Prometheus to scrape
+func (h *Handler) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	mw := &metricsWriter{w: bufio.NewWriter(w), deviceID: h.deviceID}
+	mw.writeWorkerPoolMetrics(h.GetWorkerPoolStats())
+	mw.writeRateLimiterMetrics(h.GetRateLimiterStats())
+	mw.writeQueryLimiterMetrics(h.GetQueryLimiterStats())
+	mw.writeResourceMetrics(h.GetResourceStats())
+	if err := mw.w.Flush(); err != nil {
+		log.Printf("[debug] Failed to write metrics: %v", err)
+	}
+}
@@ -0,0 +1,387 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// MigrationRequest is the query of a "migrate" request
+type MigrationRequest struct {
+	Action     string          `json:"action"`     // "apply", "rollback" or "status"
+	Migrations []MigrationFile `json:"migrations"` // Migrations known to the client, in any order
+	DryRun     bool            `json:"dryRun"`     // Report what would run and validate it, without changing anything
+	Steps      int             `json:"steps"`      // rollback: applied migrations to roll back, newest first (default 1)
+	Target     string          `json:"target"`     // apply: last version to apply; rollback: roll back every version after it
+}
+
+// MigrationFile is one migration pushed by the client
+type MigrationFile struct {
+	Version string `json:"version"` // Orders migrations; compared as strings, so use fixed-width numbers or timestamps
+	Name    string `json:"name"`
+	Up      string `json:"up"`   // SQL script applying the migration
+	Down    string `json:"down"` // SQL script undoing it (optional, needed to roll back)
+}
+
+// Status of a migration in the response of a "migrate" request
+const (
+	MigrationApplied       = "applied"         // Applied, by this request or earlier
+	MigrationPending       = "pending"         // Not applied yet
+	MigrationModified      = "modified"        // Applied, but its up script changed since
+	MigrationWouldApply    = "would_apply"     // Dry run: would be applied
+	MigrationRolledBack    = "rolled_back"     // Rolled back by this request
+	MigrationWouldRollBack = "would_roll_back" // Dry run: would be rolled back
+	MigrationFailed        = "failed"          // Failed; later migrations were not run
+)
+
+// Migration bookkeeping
+const (
+	migrationsTable   = "schema_migrations"
+	migrationsLock    = "burrowctl_schema_migrations"
+	migrationTimeout  = 30 * time.Minute
+	migrationLockWait = 10 // Seconds to wait for another migration run to finish
+)
+
+// appliedMigration is a row of the migrations table
+type appliedMigration struct {
+	version   string
+	name      string
+	checksum  string
+	down      string
+	appliedAt time.Time
+}
+
+// migrationChecksum returns the SHA-256 of a migration's up script
+func migrationChecksum(up string) string {
+	sum := sha256.Sum256([]byte(up))
+	return hex.EncodeToString(sum[:])
+}
+
+// handleMigrate applies, rolls back or lists schema migrations. The server
+// records applied migrations, with the checksum and down script of each, in
+// the schema_migrations table of the device database, which it creates on
+// first use. Every migration runs in a transaction of its own together with
+// its bookkeeping row; runs stop at the first failure. A database lock keeps
+// concurrent runs, e.g. from two operators, from interleaving.
+func (h *Handler) handleMigrate(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	var migrate MigrationRequest
+	if err := json.Unmarshal([]byte(req.Query), &migrate); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("invalid migrate request: %v", err)})
+		return
+	}
+	if req.TransactionID != "" {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "migrations cannot run inside a transaction"})
+		return
+	}
+
+	seen := make(map[string]bool, len(migrate.Migrations))
+	for _, migration := range migrate.Migrations {
+		if migration.Version == "" {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "migration without version"})
+			return
+		}
+		if seen[migration.Version] {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("duplicate migration version %s", migration.Version)})
+			return
+		}
+		seen[migration.Version] = true
+	}
+	sort.Slice(migrate.Migrations, func(i, j int) bool {
+		return migrate.Migrations[i].Version < migrate.Migrations[j].Version
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), migrationTimeout)
+	defer cancel()
+
+	db, release, err := h.acquireDB()
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+		return
+	}
+	defer release()
+
+	// The lock belongs to a connection, so the whole run uses one
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+		return
+	}
+	defer conn.Close()
+
+	var locked sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", migrationsLock, migrationLockWait).Scan(&locked); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("failed to lock migrations: %v", err)})
+		return
+	}
+	if locked.Int64 != 1 {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "another migration run is in progress"})
+		return
+	}
+	defer conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", migrationsLock)
+
+	// Status and dry runs leave the database untouched, table included
+	readOnly := migrate.DryRun || migrate.Action == "status"
+	if !readOnly {
+		if _, err := conn.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS `+migrationsTable+` (
+			version VARCHAR(255) NOT NULL PRIMARY KEY,
+			name VARCHAR(255) NOT NULL DEFAULT '',
+			checksum CHAR(64) NOT NULL,
+			down_sql LONGTEXT,
+			applied_at DATETIME NOT NULL
+		)`); err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("failed to create %s: %v", migrationsTable, err)})
+			return
+		}
+	}
+
+	applied, err := loadAppliedMigrations(ctx, conn)
+	var mysqlErr *mysql.MySQLError
+	if readOnly && errors.As(err, &mysqlErr) && mysqlErr.Number == 1146 { // ER_NO_SUCH_TABLE: nothing applied yet
+		applied, err = map[string]appliedMigration{}, nil
+	}
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+		return
+	}
+
+	var rows [][]interface{}
+	switch migrate.Action {
+	case "status":
+		rows = migrationStatus(migrate.Migrations, applied)
+	case "apply", "":
+		rows, err = h.applyMigrations(ctx, conn, migrate, applied, req.ClientIP)
+	case "rollback":
+		rows, err = h.rollbackMigrations(ctx, conn, migrate, applied, req.ClientIP)
+	default:
+		err = fmt.Errorf("unknown migrate action: %s", migrate.Action)
+	}
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+		return
+	}
+
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"version", "name", "status", "applied_at", "duration_ms", "error"},
+		Rows:    rows,
+	})
+}
+
+// loadAppliedMigrations reads the migrations table by version
+func loadAppliedMigrations(ctx context.Context, conn *sql.Conn) (map[string]appliedMigration, error) {
+	rows, err := conn.QueryContext(ctx, "SELECT version, name, checksum, down_sql, applied_at FROM "+migrationsTable)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", migrationsTable, err)
+	}
+	defer rows.Close()
+
+	applied := make(map[string]appliedMigration)
+	for rows.Next() {
+		var migration appliedMigration
+		var down sql.NullString
+		var appliedAt string // DATETIME arrives as text or, with parseTime, as RFC 3339
+		if err := rows.Scan(&migration.version, &migration.name, &migration.checksum, &down, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", migrationsTable, err)
+		}
+		migration.down = down.String
+		if migration.appliedAt, err = time.Parse("2006-01-02 15:04:05", appliedAt); err != nil {
+			migration.appliedAt, _ = time.Parse(time.RFC3339Nano, appliedAt)
+		}
+		applied[migration.version] = migration
+	}
+	return applied, rows.Err()
+}
+
+// migrationRow is a row of the "migrate" response
+func migrationRow(version, name, status string, appliedAt time.Time, duration time.Duration, err string) []interface{} {
+	at := ""
+	if !appliedAt.IsZero() {
+		at = appliedAt.Format(time.RFC3339)
+	}
+	return []interface{}{version, name, status, at, duration.Milliseconds(), err}
+}
+
+// migrationStatus lists the client's migrations and those only the
+// database knows, oldest first
+func migrationStatus(migrations []MigrationFile, applied map[string]appliedMigration) [][]interface{} {
+	known := make(map[string]bool, len(migrations))
+	for _, migration := range migrations {
+		known[migration.Version] = true
+	}
+	versions := make([]string, 0, len(migrations)+len(applied))
+	for _, migration := range migrations {
+		versions = append(versions, migration.Version)
+	}
+	for version := range applied {
+		if !known[version] {
+			versions = append(versions, version)
+		}
+	}
+	sort.Strings(versions)
+
+	var rows [][]interface{}
+	files := make(map[string]MigrationFile, len(migrations))
+	for _, migration := range migrations {
+		files[migration.Version] = migration
+	}
+	for _, version := range versions {
+		file, inFiles := files[version]
+		record, isApplied := applied[version]
+		switch {
+		case !isApplied:
+			rows = append(rows, migrationRow(version, file.Name, MigrationPending, time.Time{}, 0, ""))
+		case inFiles && record.checksum != migrationChecksum(file.Up):
+			rows = append(rows, migrationRow(version, record.name, MigrationModified, record.appliedAt, 0, "up script changed after it was applied"))
+		default:
+			rows = append(rows, migrationRow(version, record.name, MigrationApplied, record.appliedAt, 0, ""))
+		}
+	}
+	return rows
+}
+
+// applyMigrations applies the pending migrations up to the target, oldest
+// first, each in a transaction with its bookkeeping row
+func (h *Handler) applyMigrations(ctx context.Context, conn *sql.Conn, migrate MigrationRequest, applied map[string]appliedMigration, clientIP string) ([][]interface{}, error) {
+	// Refuse to build on migrations that were edited after they ran
+	for _, migration := range migrate.Migrations {
+		if record, ok := applied[migration.Version]; ok && record.checksum != migrationChecksum(migration.Up) {
+			return nil, fmt.Errorf("migration %s was modified after it was applied", migration.Version)
+		}
+	}
+
+	var rows [][]interface{}
+	for _, migration := range migrate.Migrations {
+		if migrate.Target != "" && migration.Version > migrate.Target {
+			break
+		}
+		if _, ok := applied[migration.Version]; ok {
+			continue
+		}
+
+		statements := splitScript(migration.Up)
+		if len(statements) == 0 {
+			rows = append(rows, migrationRow(migration.Version, migration.Name, MigrationFailed, time.Time{}, 0, "up script has no statements"))
+			break
+		}
+		if response := h.validateScript(statements, clientIP); response != nil {
+			rows = append(rows, migrationRow(migration.Version, migration.Name, MigrationFailed, time.Time{}, 0, response.Error))
+			break
+		}
+		if migrate.DryRun {
+			rows = append(rows, migrationRow(migration.Version, migration.Name, MigrationWouldApply, time.Time{}, 0, ""))
+			continue
+		}
+
+		start := time.Now()
+		appliedAt := start.UTC().Truncate(time.Second)
+		err := runMigrationScript(ctx, conn, statements,
+			"INSERT INTO "+migrationsTable+" (version, name, checksum, down_sql, applied_at) VALUES (?, ?, ?, ?, ?)",
+			migration.Version, migration.Name, migrationChecksum(migration.Up), migration.Down, appliedAt)
+		if err != nil {
+			log.Printf("[server] Migration %s from %s failed: %v", migration.Version, clientIP, err)
+			rows = append(rows, migrationRow(migration.Version, migration.Name, MigrationFailed, time.Time{}, time.Since(start), err.Error()))
+			break
+		}
+		log.Printf("[server] Migration %s (%s) applied from %s in %v", migration.Version, migration.Name, clientIP, time.Since(start))
+		rows = append(rows, migrationRow(migration.Version, migration.Name, MigrationApplied, appliedAt, time.Since(start), ""))
+	}
+	return rows, nil
+}
+
+// rollbackMigrations runs the down scripts of the newest applied migrations,
+// newest first: every one after the target, or the given number of steps
+func (h *Handler) rollbackMigrations(ctx context.Context, conn *sql.Conn, migrate MigrationRequest, applied map[string]appliedMigration, clientIP string) ([][]interface{}, error) {
+	versions := make([]string, 0, len(applied))
+	for version := range applied {
+		versions = append(versions, version)
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(versions)))
+
+	if migrate.Target == "" {
+		steps := migrate.Steps
+		if steps <= 0 {
+			steps = 1
+		}
+		if steps < len(versions) {
+			versions = versions[:steps]
+		}
+	} else {
+		if _, ok := applied[migrate.Target]; !ok && migrate.Target != "0" {
+			return nil, fmt.Errorf("target migration %s is not applied", migrate.Target)
+		}
+		n := 0
+		for n < len(versions) && versions[n] > migrate.Target {
+			n++
+		}
+		versions = versions[:n]
+	}
+
+	files := make(map[string]MigrationFile, len(migrate.Migrations))
+	for _, migration := range migrate.Migrations {
+		files[migration.Version] = migration
+	}
+
+	var rows [][]interface{}
+	for _, version := range versions {
+		record := applied[version]
+		down := record.down
+		if strings.TrimSpace(down) == "" {
+			down = files[version].Down
+		}
+
+		statements := splitScript(down)
+		if len(statements) == 0 {
+			rows = append(rows, migrationRow(version, record.name, MigrationFailed, record.appliedAt, 0, "migration has no down script"))
+			break
+		}
+		if response := h.validateScript(statements, clientIP); response != nil {
+			rows = append(rows, migrationRow(version, record.name, MigrationFailed, record.appliedAt, 0, response.Error))
+			break
+		}
+		if migrate.DryRun {
+			rows = append(rows, migrationRow(version, record.name, MigrationWouldRollBack, record.appliedAt, 0, ""))
+			continue
+		}
+
+		start := time.Now()
+		err := runMigrationScript(ctx, conn, statements, "DELETE FROM "+migrationsTable+" WHERE version = ?", version)
+		if err != nil {
+			log.Printf("[server] Rollback of migration %s from %s failed: %v", version, clientIP, err)
+			rows = append(rows, migrationRow(version, record.name, MigrationFailed, record.appliedAt, time.Since(start), err.Error()))
+			break
+		}
+		log.Printf("[server] Migration %s (%s) rolled back from %s in %v", version, record.name, clientIP, time.Since(start))
+		rows = append(rows, migrationRow(version, record.name, MigrationRolledBack, time.Time{}, time.Since(start), ""))
+	}
+	return rows, nil
+}
+
+// runMigrationScript runs the statements of a migration and its bookkeeping
+// statement in one transaction
+func runMigrationScript(ctx context.Context, conn *sql.Conn, statements []string, bookkeeping string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return fmt.Errorf("failed to record migration: %w", err)
+	}
+	return tx.Commit()
+}
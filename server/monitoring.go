@@ -1,10 +1,15 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"log"
+	"os"
 	"strings"
 	"time"
+
+	"github.com/lordbasex/burrowctl/client"
 )
 
 // MonitoringManager handles comprehensive server monitoring and reporting
@@ -13,6 +18,14 @@ type MonitoringManager struct {
 	config    *ServerConfig
 	startTime time.Time
 	stopChan  chan struct{}
+
+	// Alerting
+	alerts         *AlertNotifier
+	lastValidation [3]int64 // Total, blocked and injection counters at the previous check, to measure rates per interval
+	lastRejected   int64    // Worker pool rejections at the previous check
+
+	// JSON reports
+	output io.Writer // Where JSON reports are written (MonitoringOutput, or stdout)
 }
 
 // NewMonitoringManager creates a new monitoring manager
@@ -22,6 +35,15 @@ func NewMonitoringManager(handler *Handler, config *ServerConfig) *MonitoringMan
 		config:    config,
 		startTime: time.Now(),
 		stopChan:  make(chan struct{}),
+		alerts:    NewAlertNotifier(config.DeviceID, DefaultAlertConfig()),
+	}
+}
+
+// SetAlertConfig sets the webhooks alerts are POSTed to
+func (mm *MonitoringManager) SetAlertConfig(config AlertConfig) {
+	mm.alerts = NewAlertNotifier(mm.config.DeviceID, config)
+	if len(config.WebhookURLs) > 0 {
+		log.Printf("[monitoring] Alerts are posted to %d webhooks", len(config.WebhookURLs))
 	}
 }
 
@@ -31,8 +53,24 @@ func (mm *MonitoringManager) Start() {
 		return
 	}
 
+	mm.output = os.Stdout
+	if mm.jsonReports() && mm.config.MonitoringOutput != "" && mm.config.MonitoringOutput != "-" {
+		file, err := os.OpenFile(mm.config.MonitoringOutput, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Printf("[monitoring] Failed to open %s, writing reports to stdout: %v", mm.config.MonitoringOutput, err)
+		} else {
+			mm.output = file
+		}
+	}
+
 	go mm.monitoringLoop()
-	log.Printf("[monitoring] Started comprehensive monitoring with interval: %v", mm.config.MonitoringInterval)
+	log.Printf("[monitoring] Started comprehensive monitoring with interval: %v (format: %s)",
+		mm.config.MonitoringInterval, mm.config.MonitoringFormat)
+}
+
+// jsonReports reports whether monitoring reports are written as JSON
+func (mm *MonitoringManager) jsonReports() bool {
+	return mm.config.MonitoringFormat == MonitoringFormatJSON
 }
 
 // Stop stops the monitoring manager
@@ -45,13 +83,21 @@ func (mm *MonitoringManager) Stop() {
 func (mm *MonitoringManager) monitoringLoop() {
 	ticker := time.NewTicker(mm.config.MonitoringInterval)
 	defer ticker.Stop()
+	if file, ok := mm.output.(*os.File); ok && file != os.Stdout {
+		defer file.Close()
+	}
 
 	for {
 		select {
 		case <-mm.stopChan:
 			return
 		case <-ticker.C:
-			mm.printComprehensiveStats()
+			mm.checkAlerts()
+			if mm.jsonReports() {
+				mm.writeJSONReport()
+			} else {
+				mm.printComprehensiveStats()
+			}
 		}
 	}
 }
@@ -77,6 +123,48 @@ func (mm *MonitoringManager) printComprehensiveStats() {
 	fmt.Printf("🏢 System Overview:\n")
 	fmt.Printf("  Uptime: %v\n", time.Since(mm.startTime).Round(time.Second))
 
+	// Traffic still arriving under the old device IDs of a rename
+	if mm.handler.deviceAliases != nil {
+		report := mm.handler.deviceAliases.Report()
+		fmt.Printf("\n🏷️ Device Aliases:\n")
+		fmt.Printf("  %s (current): %d requests\n", report.Primary.DeviceID, report.Primary.Requests)
+		for _, alias := range report.Aliases {
+			lastRequest := "never"
+			if !alias.LastRequest.IsZero() {
+				lastRequest = time.Since(alias.LastRequest).Round(time.Second).String() + " ago"
+			}
+			fmt.Printf("  %s (alias): %d requests, last %s\n", alias.DeviceID, alias.Requests, lastRequest)
+		}
+	}
+
+	// Worker pool load; rejections mean the queue is too small for the bursts
+	workerStats := mm.handler.GetWorkerPoolStats()
+	fmt.Printf("\n👷 Worker Pool:\n")
+	fmt.Printf("  Active: %d/%d, Queued: %d/%d\n", workerStats.ActiveTasks, workerStats.WorkerCount,
+		workerStats.QueuedTasks, workerStats.QueueSize)
+	fmt.Printf("  Processed: %d, Failed: %d, Rejected: %d\n", workerStats.Processed, workerStats.Failed, workerStats.Rejected)
+	fmt.Printf("  Avg Task Latency: %v, Avg Queue Wait: %v\n",
+		workerStats.AvgLatency.Round(time.Microsecond), workerStats.AvgQueueWait.Round(time.Microsecond))
+
+	// Clients being throttled, most rejected first
+	rateStats := mm.handler.GetRateLimiterStats()
+	if rateStats.Rejected > 0 {
+		fmt.Printf("\n🚦 Rate Limiter:\n")
+		fmt.Printf("  Allowed: %d, Rejected: %d\n", rateStats.Allowed, rateStats.Rejected)
+		for _, client := range rateStats.TopOffenders(3) {
+			fmt.Printf("  %s: %d rejected, %.1f tokens left\n", client.ClientIP, client.Rejected, client.Tokens)
+		}
+	}
+
+	// Open transactions; an old or long idle one is usually leaked by its client
+	if transactions := mm.handler.GetActiveTransactions(); len(transactions) > 0 {
+		oldest := transactions[0]
+		fmt.Printf("\n🔒 Transactions:\n")
+		fmt.Printf("  Open: %d\n", len(transactions))
+		fmt.Printf("  Oldest: %s from %s (age %s, idle %s, %d statements)\n",
+			oldest.ID, oldest.ClientIP, oldest.Age, oldest.Idle, oldest.Statements)
+	}
+
 	// Cache Statistics
 	fmt.Printf("\n📈 Cache Performance:\n")
 	fmt.Printf("  Total Requests: %d\n", cacheStats.TotalRequests)
@@ -87,6 +175,9 @@ func (mm *MonitoringManager) printComprehensiveStats() {
 		fmt.Printf("  Hit Ratio: %.2f%%\n", hitRatio)
 	}
 	fmt.Printf("  Current Size: %d entries\n", cacheStats.CurrentSize)
+	if cacheStats.Skipped > 0 {
+		fmt.Printf("  Not Worth Caching: %d results\n", cacheStats.Skipped)
+	}
 	fmt.Printf("  Evictions: %d\n", cacheStats.Evictions)
 	fmt.Printf("  Expirations: %d\n", cacheStats.Expirations)
 
@@ -98,6 +189,10 @@ func (mm *MonitoringManager) printComprehensiveStats() {
 	fmt.Printf("  Injection Attempts: %d\n", validationStats.InjectionAttempts)
 	fmt.Printf("  Command Violations: %d\n", validationStats.CommandViolations)
 	fmt.Printf("  Structure Violations: %d\n", validationStats.StructureViolations)
+	if validationStats.RiskBlocked > 0 || validationStats.ApprovalsRequired > 0 {
+		fmt.Printf("  Blocked by Risk Level: %d\n", validationStats.RiskBlocked)
+		fmt.Printf("  Held for Approval: %d (%d pending)\n", validationStats.ApprovalsRequired, len(mm.handler.approvals.List()))
+	}
 
 	if validationStats.TotalQueries > 0 {
 		blockRate := float64(validationStats.BlockedQueries) / float64(validationStats.TotalQueries) * 100
@@ -105,13 +200,13 @@ func (mm *MonitoringManager) printComprehensiveStats() {
 
 		fmt.Printf("  Block Rate: %.2f%%\n", blockRate)
 		fmt.Printf("  Injection Rate: %.2f%%\n", injectionRate)
-		fmt.Printf("  Security Level: %s\n", mm.getSecurityLevel(blockRate/100, injectionRate/100))
+		fmt.Printf("  Security Level: %s\n", securityLevel(blockRate/100, injectionRate/100))
 
 		// Security alerts
-		if injectionRate > 5 {
+		if level := mm.alerts.config.InjectionRate.Critical; level > 0 && injectionRate >= level {
 			fmt.Printf("  🚨 HIGH INJECTION RATE DETECTED!\n")
 		}
-		if blockRate > 30 {
+		if level := mm.alerts.config.BlockRate.Warning; level > 0 && blockRate >= level {
 			fmt.Printf("  ⚠️  High block rate - review policies\n")
 		}
 	}
@@ -137,8 +232,63 @@ func (mm *MonitoringManager) printComprehensiveStats() {
 	fmt.Printf(strings.Repeat("=", 60) + "\n")
 }
 
-// getSecurityLevel determines the current security threat level
-func (mm *MonitoringManager) getSecurityLevel(blockRate, injectionRate float64) string {
+// checkAlerts compares the metrics of the last interval with the alert
+// thresholds and notifies the webhooks of the alerts that fired or resolved.
+// Injection and block rates are measured over the queries validated since
+// the previous check, so an old burst does not keep an alert firing.
+func (mm *MonitoringManager) checkAlerts() {
+	validationStats := mm.handler.GetSQLValidationStats()
+	total := validationStats.TotalQueries - mm.lastValidation[0]
+	blocked := validationStats.BlockedQueries - mm.lastValidation[1]
+	injections := validationStats.InjectionAttempts - mm.lastValidation[2]
+	mm.lastValidation = [3]int64{validationStats.TotalQueries, validationStats.BlockedQueries, validationStats.InjectionAttempts}
+
+	injectionRate, blockRate := 0.0, 0.0
+	if total > 0 {
+		injectionRate = float64(injections) / float64(total) * 100
+		blockRate = float64(blocked) / float64(total) * 100
+	}
+	mm.alerts.observe("injection_rate", injectionRate, mm.alerts.config.InjectionRate,
+		fmt.Sprintf("%.1f%% of %d queries were SQL injection attempts", injectionRate, total))
+	mm.alerts.observe("block_rate", blockRate, mm.alerts.config.BlockRate,
+		fmt.Sprintf("%.1f%% of %d queries were blocked by validation", blockRate, total))
+
+	// A queue that refused tasks counts as full
+	workerStats := mm.handler.GetWorkerPoolStats()
+	rejected := workerStats.Rejected - mm.lastRejected
+	mm.lastRejected = workerStats.Rejected
+	queueUse := 0.0
+	if workerStats.QueueSize > 0 {
+		queueUse = float64(workerStats.QueuedTasks) / float64(workerStats.QueueSize) * 100
+	}
+	if rejected > 0 {
+		queueUse = 100
+	}
+	mm.alerts.observe("queue_saturation", queueUse, mm.alerts.config.QueueSaturation,
+		fmt.Sprintf("worker queue %d/%d full, %d requests rejected", workerStats.QueuedTasks, workerStats.QueueSize, rejected))
+
+	down, message := 0.0, "database is reachable"
+	if err := mm.pingDatabase(); err != nil {
+		down, message = 1, fmt.Sprintf("database is unreachable: %v", err)
+	}
+	mm.alerts.observe("db_down", down, AlertThreshold{Critical: 1}, message)
+}
+
+// pingDatabase checks that the database answers
+func (mm *MonitoringManager) pingDatabase() error {
+	db, release, err := mm.handler.acquireDB()
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// securityLevel determines the current security threat level
+func securityLevel(blockRate, injectionRate float64) string {
 	if injectionRate > 0.1 {
 		return "HIGH"
 	} else if blockRate > 0.2 {
@@ -150,19 +300,30 @@ func (mm *MonitoringManager) getSecurityLevel(blockRate, injectionRate float64)
 	}
 }
 
-// DisplayConfiguration shows the complete server configuration
+// DisplayConfiguration shows the complete server configuration. It prints
+// nothing when monitoring reports are JSON, so stdout only carries JSON
+// documents.
 func (mm *MonitoringManager) DisplayConfiguration() {
+	if mm.jsonReports() {
+		return
+	}
+
 	fmt.Printf("🏢 Full-Featured Enterprise Server Configuration\n")
 	fmt.Printf("===============================================\n")
 	fmt.Printf("Device ID: %s\n", mm.config.DeviceID)
-	fmt.Printf("AMQP URL: %s\n", mm.config.AMQPURL)
-	fmt.Printf("MySQL DSN: %s\n", mm.config.MySQLDSN)
+	fmt.Printf("AMQP URL: %s\n", client.RedactURL(mm.config.AMQPURL))
+	fmt.Printf("MySQL DSN: %s\n", client.Redact(mm.config.MySQLDSN))
+	fmt.Printf("Namespace: %s\n", mm.config.Namespace)
+	fmt.Printf("VHost: %s\n", client.VHostOf(mm.handler.amqpURL))
 
 	fmt.Printf("\n📊 Cache Configuration:\n")
 	fmt.Printf("  Enabled: %v\n", mm.config.CacheEnabled)
 	fmt.Printf("  Max Size: %d queries\n", mm.config.CacheSize)
 	fmt.Printf("  TTL: %v\n", mm.config.CacheTTL)
 	fmt.Printf("  Cleanup Interval: %v\n", mm.config.CacheCleanup)
+	if mm.config.CacheAdaptive {
+		fmt.Printf("  Adaptive: after %d executions averaging %v\n", mm.config.CacheMinExecutions, mm.config.CacheMinLatency)
+	}
 
 	fmt.Printf("\n🔒 SQL Validation Configuration:\n")
 	fmt.Printf("  Enabled: %v\n", mm.config.ValidationEnabled)
@@ -177,17 +338,43 @@ func (mm *MonitoringManager) DisplayConfiguration() {
 	fmt.Printf("  Queue Size: %d\n", mm.config.QueueSize)
 	fmt.Printf("  Rate Limit: %d req/s\n", mm.config.RateLimit)
 	fmt.Printf("  Burst Size: %d\n", mm.config.BurstSize)
+	fmt.Printf("  Rate Limit Mode: %s\n", mm.config.RateLimitMode)
+	fmt.Printf("  Max Concurrent Queries: %d\n", mm.config.MaxConcurrentQueries)
 
 	fmt.Printf("\n🗄️ Database Configuration:\n")
 	fmt.Printf("  Max Idle Connections: %d\n", mm.config.PoolIdle)
 	fmt.Printf("  Max Open Connections: %d\n", mm.config.PoolOpen)
 	fmt.Printf("  Connection Lifetime: %v\n", mm.config.ConnLifetime)
 
+	fmt.Printf("\n🐢 Slow Query Configuration:\n")
+	fmt.Printf("  Threshold: %v\n", mm.config.SlowQueryThreshold)
+	fmt.Printf("  EXPLAIN Capture: %v\n", mm.config.SlowQueryExplain)
+
+	fmt.Printf("\n📝 Audit Configuration:\n")
+	fmt.Printf("  Enabled: %v\n", mm.config.AuditEnabled)
+	fmt.Printf("  Backend: %s\n", mm.config.AuditBackend)
+	fmt.Printf("  Redact Parameters: %v\n", mm.config.AuditRedactParams)
+
+	fmt.Printf("\n🔑 Token Authentication:\n")
+	fmt.Printf("  HMAC Secret: %v\n", mm.config.JWTSecret != "")
+	fmt.Printf("  JWKS URL: %s\n", mm.config.JWKSURL)
+	fmt.Printf("  Required: %v\n", mm.config.JWTRequired)
+
+	fmt.Printf("\n🙈 Log Redaction:\n")
+	fmt.Printf("  Credentials: %v\n", mm.config.RedactLogs)
+	fmt.Printf("  Query Values: %v\n", mm.config.RedactQueryLogs)
+
 	fmt.Printf("\n🔄 Starting comprehensive monitoring...\n")
 }
 
 // RegisterMonitoringFunctions registers comprehensive monitoring functions
+// in addition to the ones every handler provides (getHeartbeatStats,
+// getActiveClients, getWorkerStats, getSystemStatus)
 func (mm *MonitoringManager) RegisterMonitoringFunctions() {
+	if !mm.config.MonitoringFunctions {
+		return
+	}
+
 	// Cache statistics
 	mm.handler.RegisterFunction("getCacheStats", func() map[string]interface{} {
 		stats := mm.handler.GetCacheStats()
@@ -203,6 +390,7 @@ func (mm *MonitoringManager) RegisterMonitoringFunctions() {
 			"current_size":   stats.CurrentSize,
 			"evictions":      stats.Evictions,
 			"expirations":    stats.Expirations,
+			"skipped":        stats.Skipped,
 			"last_cleanup":   stats.LastCleanup.Format(time.RFC3339),
 		}
 	})
@@ -225,38 +413,37 @@ func (mm *MonitoringManager) RegisterMonitoringFunctions() {
 			"structure_violations": stats.StructureViolations,
 			"block_rate":           blockRate,
 			"injection_rate":       injectionRate,
-			"security_level":       mm.getSecurityLevel(blockRate, injectionRate),
+			"security_level":       securityLevel(blockRate, injectionRate),
 		}
 	})
 
-	// Overall system status
-	mm.handler.RegisterFunction("getSystemStatus", func() map[string]interface{} {
-		cacheStats := mm.handler.GetCacheStats()
-		validationStats := mm.handler.GetSQLValidationStats()
-
-		cacheHitRatio := float64(0)
-		if cacheStats.TotalRequests > 0 {
-			cacheHitRatio = float64(cacheStats.Hits) / float64(cacheStats.TotalRequests)
-		}
-
-		blockRate := float64(0)
-		if validationStats.TotalQueries > 0 {
-			blockRate = float64(validationStats.BlockedQueries) / float64(validationStats.TotalQueries)
+	// Open transactions, oldest first
+	mm.handler.RegisterFunction("getActiveTransactions", func() map[string]interface{} {
+		transactions := mm.handler.GetActiveTransactions()
+		return map[string]interface{}{
+			"active_transactions": len(transactions),
+			"transactions":        transactions,
 		}
+	})
 
+	// Recent slow queries with captured plans
+	mm.handler.RegisterFunction("getSlowQueries", func() map[string]interface{} {
 		return map[string]interface{}{
-			"status":             "healthy",
-			"uptime":             time.Since(mm.startTime).String(),
-			"cache_hit_ratio":    cacheHitRatio,
-			"cache_size":         cacheStats.CurrentSize,
-			"validation_enabled": validationStats.TotalQueries > 0,
-			"security_level":     mm.getSecurityLevel(blockRate, 0),
-			"total_queries":      validationStats.TotalQueries,
-			"blocked_queries":    validationStats.BlockedQueries,
-			"injection_attempts": validationStats.InjectionAttempts,
+			"total":   mm.handler.slowQueryLog.Total(),
+			"entries": mm.handler.GetSlowQueries(),
 		}
 	})
 
+	// Function call, panic and timeout counters
+	mm.handler.RegisterFunction("getFunctionStats", func() map[string]FunctionStats {
+		return mm.handler.GetFunctionStats()
+	})
+
+	// Requests per client wire protocol version
+	mm.handler.RegisterFunction("getProtocolStats", func() map[string]interface{} {
+		return mm.handler.protocolStats.snapshot()
+	})
+
 	// Performance metrics
 	mm.handler.RegisterFunction("getPerformanceMetrics", func() map[string]interface{} {
 		cacheStats := mm.handler.GetCacheStats()
@@ -276,6 +463,11 @@ func (mm *MonitoringManager) RegisterMonitoringFunctions() {
 		}
 	})
 
+	// Firing alerts and webhook delivery counters
+	mm.handler.RegisterFunction("getAlerts", func() AlertStats {
+		return mm.alerts.GetStats()
+	})
+
 	// Clear all caches and stats
 	mm.handler.RegisterFunction("clearAllCaches", func() string {
 		mm.handler.ClearCache()
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"log"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// monitoringFunctionNames lists the functions registered by
+// registerMonitoringFunctions
+var monitoringFunctionNames = []string{"getHeartbeatStats", "getActiveClients", "getWorkerStats", "getSystemStatus", "getQueryStats", "getRateLimiterStats"}
+
+// registerMonitoringFunctions registers the built-in monitoring functions,
+// so every handler can be inspected remotely without a MonitoringManager
+func (h *Handler) registerMonitoringFunctions() {
+	h.RegisterFunctionWithMetadata("getHeartbeatStats", func() map[string]interface{} {
+		stats := h.GetHeartbeatStats()
+		return map[string]interface{}{
+			"enabled":        stats.IsEnabled,
+			"active_clients": stats.ActiveClients,
+			"total_clients":  stats.TotalClients,
+			"max_clients":    stats.MaxClients,
+			"total_pings":    stats.TotalPings,
+			"evictions":      stats.Evictions,
+			"expirations":    stats.Expirations,
+			"server_pings":   stats.ServerPings,
+			"pinged_clients": stats.PingedClients,
+			"total_pongs":    stats.TotalPongs,
+		}
+	}, FunctionMetadata{Description: "Returns heartbeat client tracking statistics"})
+
+	h.RegisterFunctionWithMetadata("getActiveClients", func() map[string]interface{} {
+		active := h.GetActiveClients()
+		clients := make([]map[string]interface{}, 0, len(active))
+		for identity, info := range active {
+			clients = append(clients, map[string]interface{}{
+				"id":                identity,
+				"client_ip":         info.ClientIP,
+				"last_ping":         info.LastPing.Format(time.RFC3339),
+				"last_seen":         info.LastSeen.Format(time.RFC3339),
+				"ping_count":        info.PingCount,
+				"rpc_active":        info.RPCActive,
+				"server_pinged":     info.PingQueue != "",
+				"missed_pings":      info.MissedPings,
+				"open_transactions": info.OpenTransactions,
+			})
+		}
+		sort.Slice(clients, func(i, j int) bool {
+			return clients[i]["id"].(string) < clients[j]["id"].(string)
+		})
+		return map[string]interface{}{
+			"active_clients": len(clients),
+			"clients":        clients,
+		}
+	}, FunctionMetadata{Description: "Lists the clients whose heartbeats are current"})
+
+	h.RegisterFunctionWithMetadata("getWorkerStats", func() map[string]interface{} {
+		stats := h.GetWorkerPoolStats()
+		utilization := float64(0)
+		if stats.QueueSize > 0 {
+			utilization = float64(stats.QueuedTasks) / float64(stats.QueueSize)
+		}
+		return map[string]interface{}{
+			"worker_count":      stats.WorkerCount,
+			"queue_size":        stats.QueueSize,
+			"queued_tasks":      stats.QueuedTasks,
+			"active_tasks":      stats.ActiveTasks,
+			"delayed_tasks":     stats.DelayedTasks,
+			"queue_utilization": utilization,
+			"running":           stats.IsRunning,
+			"panics":            stats.Panics,
+			"processed":         stats.Processed,
+			"failed":            stats.Failed,
+			"rejected":          stats.Rejected,
+			"avg_latency_ms":    float64(stats.AvgLatency) / float64(time.Millisecond),
+			"avg_queue_wait_ms": float64(stats.AvgQueueWait) / float64(time.Millisecond),
+		}
+	}, FunctionMetadata{Description: "Returns worker pool queue and activity statistics"})
+
+	h.RegisterFunctionWithMetadata("getSystemStatus", func() map[string]interface{} {
+		cacheStats := h.GetCacheStats()
+		validationStats := h.GetSQLValidationStats()
+		workerStats := h.workerPool.GetStats()
+
+		cacheHitRatio := float64(0)
+		if cacheStats.TotalRequests > 0 {
+			cacheHitRatio = float64(cacheStats.Hits) / float64(cacheStats.TotalRequests)
+		}
+
+		blockRate := float64(0)
+		if validationStats.TotalQueries > 0 {
+			blockRate = float64(validationStats.BlockedQueries) / float64(validationStats.TotalQueries)
+		}
+
+		status := "healthy"
+		if h.GetResourceStats().Overloaded {
+			status = "overloaded"
+		}
+
+		return map[string]interface{}{
+			"status":              status,
+			"device_id":           h.deviceID,
+			"mode":                h.mode,
+			"uptime":              time.Since(h.startTime).Round(time.Second).String(),
+			"goroutines":          runtime.NumGoroutine(),
+			"active_clients":      h.GetHeartbeatStats().ActiveClients,
+			"active_transactions": len(h.GetActiveTransactions()),
+			"queued_tasks":        workerStats.QueuedTasks,
+			"active_tasks":        workerStats.ActiveTasks,
+			"cache_hit_ratio":     cacheHitRatio,
+			"cache_size":          cacheStats.CurrentSize,
+			"validation_enabled":  validationStats.TotalQueries > 0,
+			"security_level":      securityLevel(blockRate, 0),
+			"total_queries":       validationStats.TotalQueries,
+			"blocked_queries":     validationStats.BlockedQueries,
+			"injection_attempts":  validationStats.InjectionAttempts,
+		}
+	}, FunctionMetadata{Description: "Returns an overview of the server's health and load"})
+
+	h.RegisterFunctionWithMetadata("getQueryStats", func(limit int) []StatementStats {
+		return h.GetQueryStats(limit)
+	}, FunctionMetadata{
+		Description: "Returns execution statistics per query fingerprint, most total time first",
+		Params:      []FunctionParamInfo{{Name: "limit", Description: "Only return this many fingerprints (0 for all)"}},
+	})
+
+	h.RegisterFunctionWithMetadata("getRateLimiterStats", func() map[string]interface{} {
+		stats := h.GetRateLimiterStats()
+		return map[string]interface{}{
+			"requests_per_second": stats.RequestsPerSecond,
+			"burst_size":          stats.BurstSize,
+			"active_clients":      stats.ActiveClients,
+			"allowed":             stats.Allowed,
+			"rejected":            stats.Rejected,
+			"clients":             stats.Clients,
+			"top_offenders":       stats.TopOffenders(5),
+		}
+	}, FunctionMetadata{Description: "Returns the rate limit budget and rejections of every client, most throttled first"})
+}
+
+// SetMonitoringFunctions enables or disables the built-in monitoring
+// functions (getHeartbeatStats, getActiveClients, getWorkerStats,
+// getSystemStatus, getQueryStats, getRateLimiterStats), which every handler
+// registers by default. Call it before registering functions of your own
+// under the same names.
+func (h *Handler) SetMonitoringFunctions(enabled bool) {
+	if enabled {
+		h.registerMonitoringFunctions()
+		return
+	}
+	for _, name := range monitoringFunctionNames {
+		delete(h.functionRegistry, name)
+		delete(h.functionMetadata, name)
+	}
+	log.Printf("[server] Built-in monitoring functions disabled")
+}
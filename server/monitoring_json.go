@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime"
+	"time"
+)
+
+// Monitoring report formats
+const (
+	MonitoringFormatText = "text" // Tables for people reading the console
+	MonitoringFormatJSON = "json" // One JSON document per line for log pipelines
+)
+
+// ValidateMonitoringFormat checks a monitoring report format ("" is
+// MonitoringFormatText)
+func ValidateMonitoringFormat(format string) error {
+	switch format {
+	case "", MonitoringFormatText, MonitoringFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid monitoring format '%s': must be %s or %s", format, MonitoringFormatText, MonitoringFormatJSON)
+}
+
+// writeJSONReport writes the monitoring report as a single line of JSON.
+// Unlike the text report it is written at every interval, idle or not, so
+// pipelines get evenly spaced samples.
+func (mm *MonitoringManager) writeJSONReport() {
+	data, err := json.Marshal(mm.report())
+	if err != nil {
+		log.Printf("[monitoring] Failed to marshal report: %v", err)
+		return
+	}
+	if _, err := mm.output.Write(append(data, '\n')); err != nil {
+		log.Printf("[monitoring] Failed to write report: %v", err)
+	}
+}
+
+// report collects the figures of the text report into one document
+func (mm *MonitoringManager) report() map[string]interface{} {
+	h := mm.handler
+	now := time.Now()
+	cacheStats := h.GetCacheStats()
+	validationStats := h.GetSQLValidationStats()
+	workerStats := h.GetWorkerPoolStats()
+	rateStats := h.GetRateLimiterStats()
+	transactions := h.GetActiveTransactions()
+
+	hitRatio := float64(0)
+	if cacheStats.TotalRequests > 0 {
+		hitRatio = float64(cacheStats.Hits) / float64(cacheStats.TotalRequests)
+	}
+	blockRate, injectionRate := float64(0), float64(0)
+	if validationStats.TotalQueries > 0 {
+		blockRate = float64(validationStats.BlockedQueries) / float64(validationStats.TotalQueries)
+		injectionRate = float64(validationStats.InjectionAttempts) / float64(validationStats.TotalQueries)
+	}
+	utilization := float64(0)
+	if workerStats.QueueSize > 0 {
+		utilization = float64(workerStats.QueuedTasks) / float64(workerStats.QueueSize)
+	}
+
+	report := map[string]interface{}{
+		"timestamp":      now.Format(time.RFC3339Nano),
+		"device_id":      h.deviceID,
+		"uptime_seconds": now.Sub(mm.startTime).Seconds(),
+		"idle":           cacheStats.TotalRequests+validationStats.TotalQueries == 0,
+		"goroutines":     runtime.NumGoroutine(),
+		"worker_pool": map[string]interface{}{
+			"worker_count":      workerStats.WorkerCount,
+			"queue_size":        workerStats.QueueSize,
+			"queued_tasks":      workerStats.QueuedTasks,
+			"active_tasks":      workerStats.ActiveTasks,
+			"queue_utilization": utilization,
+			"processed":         workerStats.Processed,
+			"failed":            workerStats.Failed,
+			"rejected":          workerStats.Rejected,
+			"avg_latency_ms":    float64(workerStats.AvgLatency) / float64(time.Millisecond),
+			"avg_queue_wait_ms": float64(workerStats.AvgQueueWait) / float64(time.Millisecond),
+		},
+		"rate_limiter": map[string]interface{}{
+			"allowed":       rateStats.Allowed,
+			"rejected":      rateStats.Rejected,
+			"top_offenders": rateStats.TopOffenders(3),
+		},
+		"cache": map[string]interface{}{
+			"total_requests": cacheStats.TotalRequests,
+			"hits":           cacheStats.Hits,
+			"misses":         cacheStats.Misses,
+			"hit_ratio":      hitRatio,
+			"current_size":   cacheStats.CurrentSize,
+			"skipped":        cacheStats.Skipped,
+			"evictions":      cacheStats.Evictions,
+			"expirations":    cacheStats.Expirations,
+		},
+		"validation": map[string]interface{}{
+			"total_queries":        validationStats.TotalQueries,
+			"valid_queries":        validationStats.ValidQueries,
+			"blocked_queries":      validationStats.BlockedQueries,
+			"injection_attempts":   validationStats.InjectionAttempts,
+			"command_violations":   validationStats.CommandViolations,
+			"structure_violations": validationStats.StructureViolations,
+			"risk_blocked":         validationStats.RiskBlocked,
+			"approvals_required":   validationStats.ApprovalsRequired,
+			"block_rate":           blockRate,
+			"injection_rate":       injectionRate,
+			"security_level":       securityLevel(blockRate, injectionRate),
+		},
+		"alerts": mm.alerts.GetStats().Firing,
+	}
+
+	openTransactions := map[string]interface{}{"open": len(transactions)}
+	if len(transactions) > 0 {
+		openTransactions["oldest"] = transactions[0]
+	}
+	report["transactions"] = openTransactions
+
+	if h.deviceAliases != nil {
+		report["device_aliases"] = h.deviceAliases.Report()
+	}
+	return report
+}
@@ -0,0 +1,88 @@
+package server
+
+import "strings"
+
+// whereClauseEnds are the keywords that end a WHERE clause at its nesting
+// level
+var whereClauseEnds = map[string]bool{
+	"GROUP": true, "HAVING": true, "ORDER": true, "LIMIT": true, "WINDOW": true,
+	"UNION": true, "INTERSECT": true, "EXCEPT": true, "FOR": true, "LOCK": true,
+	"INTO": true, "RETURNING": true, "SELECT": true,
+}
+
+// inlineLiterals counts the string and numeric literals written inline in
+// the WHERE clauses of query, subqueries and parenthesized conditions
+// included. Placeholders, NULL, TRUE and FALSE are not literals.
+func inlineLiterals(query string) (strs, numbers int) {
+	// inWhere[d] tells whether the tokens at parenthesis depth d are in a
+	// WHERE clause; a parenthesized expression inherits it
+	inWhere := []bool{false}
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		depth := len(inWhere) - 1
+		switch {
+		case c == '\'' || c == '"':
+			// In MySQL double quotes delimit strings unless ANSI_QUOTES is set
+			for i++; i < len(query) && query[i] != c; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+			if inWhere[depth] {
+				strs++
+			}
+		case c == '`':
+			for i++; i < len(query) && query[i] != '`'; i++ {
+			}
+		case c == '-' && i+1 < len(query) && query[i+1] == '-', c == '#':
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(query)
+			}
+		case c == '(':
+			inWhere = append(inWhere, inWhere[depth])
+		case c == ')':
+			if depth > 0 {
+				inWhere = inWhere[:depth]
+			}
+		case c == ';':
+			inWhere = []bool{false}
+		case c >= '0' && c <= '9':
+			// Identifiers such as t1 are read whole below, so a digit here
+			// starts a number: 42, 1.5, 1e3 or 0x1F
+			for i+1 < len(query) && (isWordByte(query[i+1]) || query[i+1] == '.') {
+				i++
+			}
+			if inWhere[depth] {
+				numbers++
+			}
+		case isWordByte(c):
+			start := i
+			for i+1 < len(query) && isWordByte(query[i+1]) {
+				i++
+			}
+			word := strings.ToUpper(query[start : i+1])
+			// X'4142', B'01' and N'text' are literals too
+			if i+1 < len(query) && query[i+1] == '\'' && (word == "X" || word == "B" || word == "N" || strings.HasPrefix(word, "_")) {
+				continue
+			}
+			if word == "WHERE" {
+				inWhere[depth] = true
+			} else if whereClauseEnds[word] {
+				inWhere[depth] = false
+			}
+		}
+	}
+	return strs, numbers
+}
+
+// isWordByte reports whether c can be part of an unquoted identifier or
+// keyword
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= 0x80
+}
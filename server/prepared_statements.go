@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Error codes of prepared statement requests
+const (
+	ErrStmtNotFound    = "STMT_NOT_FOUND"   // Unknown handle (never prepared, closed, expired or server restarted)
+	ErrStmtUnsupported = "STMT_UNSUPPORTED" // Statements cannot be kept in "close" mode or in cluster mode
+)
+
+// PreparedStatementConfig holds configuration for server-side prepared statements
+type PreparedStatementConfig struct {
+	IdleTimeout   time.Duration // Idle time after which a statement is closed
+	MaxStatements int           // Maximum number of statements kept at once
+}
+
+// DefaultPreparedStatementConfig returns the default prepared statement configuration
+func DefaultPreparedStatementConfig() PreparedStatementConfig {
+	return PreparedStatementConfig{
+		IdleTimeout:   10 * time.Minute,
+		MaxStatements: 1000,
+	}
+}
+
+// preparedStatement is a statement prepared on the connection pool
+type preparedStatement struct {
+	query    string    // SQL text the statement was prepared from
+	stmt     *sql.Stmt // Statement prepared on the pool
+	owner    string    // Authenticated principal that prepared it
+	lastUsed time.Time // Last PREPARE or execution
+}
+
+// PreparedStatementRegistry keeps statements prepared by clients so later
+// executions only send a handle and the parameters. Handles are scoped to
+// the principal that prepared them and expire once idle.
+type PreparedStatementRegistry struct {
+	config     PreparedStatementConfig
+	mutex      sync.Mutex
+	statements map[string]*preparedStatement // handle -> statement
+}
+
+// NewPreparedStatementRegistry creates a new prepared statement registry
+func NewPreparedStatementRegistry(config PreparedStatementConfig) *PreparedStatementRegistry {
+	defaults := DefaultPreparedStatementConfig()
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+	if config.MaxStatements <= 0 {
+		config.MaxStatements = defaults.MaxStatements
+	}
+	return &PreparedStatementRegistry{
+		config:     config,
+		statements: make(map[string]*preparedStatement),
+	}
+}
+
+// newStatementID returns a random statement handle
+func newStatementID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("stmt_%d", time.Now().UnixNano())
+	}
+	return "stmt_" + hex.EncodeToString(buf)
+}
+
+// Prepare prepares query on db and returns the handle of the statement
+func (r *PreparedStatementRegistry) Prepare(ctx context.Context, db *sql.DB, owner, query string) (string, error) {
+	r.mutex.Lock()
+	if len(r.statements) >= r.config.MaxStatements {
+		r.removeExpired(time.Now())
+	}
+	full := len(r.statements) >= r.config.MaxStatements
+	r.mutex.Unlock()
+	if full {
+		return "", fmt.Errorf("too many prepared statements (max %d)", r.config.MaxStatements)
+	}
+
+	stmt, err := db.PrepareContext(ctx, query)
+	if err != nil {
+		return "", err
+	}
+
+	id := newStatementID()
+	r.mutex.Lock()
+	r.statements[id] = &preparedStatement{query: query, stmt: stmt, owner: owner, lastUsed: time.Now()}
+	r.mutex.Unlock()
+	return id, nil
+}
+
+// lookup returns the live statement id of owner, closing it if expired.
+// The caller must hold the mutex.
+func (r *PreparedStatementRegistry) lookup(owner, id string, now time.Time) *preparedStatement {
+	prepared, ok := r.statements[id]
+	if !ok || prepared.owner != owner {
+		return nil
+	}
+	if now.Sub(prepared.lastUsed) > r.config.IdleTimeout {
+		delete(r.statements, id)
+		prepared.stmt.Close()
+		return nil
+	}
+	prepared.lastUsed = now
+	return prepared
+}
+
+// Lookup returns the statement and its SQL text, and refreshes its expiry
+func (r *PreparedStatementRegistry) Lookup(owner, id string) (*sql.Stmt, string, bool) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	prepared := r.lookup(owner, id, time.Now())
+	if prepared == nil {
+		return nil, "", false
+	}
+	return prepared.stmt, prepared.query, true
+}
+
+// Close closes the statement id of owner; unknown handles are ignored
+func (r *PreparedStatementRegistry) Close(owner, id string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if prepared, ok := r.statements[id]; ok && prepared.owner == owner {
+		delete(r.statements, id)
+		prepared.stmt.Close()
+	}
+}
+
+// removeExpired closes idle statements; the caller must hold the mutex
+func (r *PreparedStatementRegistry) removeExpired(now time.Time) int {
+	removed := 0
+	for id, prepared := range r.statements {
+		if now.Sub(prepared.lastUsed) > r.config.IdleTimeout {
+			delete(r.statements, id)
+			prepared.stmt.Close()
+			removed++
+		}
+	}
+	return removed
+}
+
+// Cleanup closes idle statements and returns how many were removed
+func (r *PreparedStatementRegistry) Cleanup() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.removeExpired(time.Now())
+}
+
+// Len returns the number of prepared statements
+func (r *PreparedStatementRegistry) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.statements)
+}
+
+// handlePrepare registers the SQL of a "prepare" request as a statement on
+// the connection pool and answers with its handle. The statement is validated
+// like any query; executions by handle are validated again.
+func (h *Handler) handlePrepare(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	// Statements live on the shared pool of this instance
+	if h.mode != "open" || h.cluster != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error:     "server-side prepared statements require 'open' mode without clustering",
+			ErrorCode: ErrStmtUnsupported,
+		})
+		return
+	}
+
+	validationResult := h.sqlValidator.ValidateQuery(req.Query, req.Params)
+	if !validationResult.Valid {
+		log.Printf("[server] SQL validation blocked statement from %s: %s (risk: %s)",
+			req.ClientIP, h.loggedQuery(req.Query, 50), validationResult.Risk)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, validationFailedResponse(validationResult))
+		return
+	}
+
+	// Prepare SELECTs without LIMIT with the default one added
+	if validationResult.RewrittenQuery != "" {
+		req.Query = validationResult.RewrittenQuery
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := h.preparedStatements.Prepare(ctx, h.db, msg.UserId, req.Query)
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+		return
+	}
+
+	h.trackSession(msg.UserId, req, "", id, false)
+
+	log.Printf("[server] Prepared statement %s: %s", id, h.loggedQuery(req.Query, 50))
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"statementID"},
+		Rows:    [][]interface{}{{id}},
+	})
+}
+
+// handleDeallocate closes the statement named by a "deallocate" request
+func (h *Handler) handleDeallocate(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	h.preparedStatements.Close(msg.UserId, req.StatementID)
+	h.trackSession(msg.UserId, req, "", req.StatementID, true)
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"status"},
+		Rows:    [][]interface{}{{"DEALLOCATE"}},
+	})
+}
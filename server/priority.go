@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Request priorities sent by clients in RPCRequest.Priority
+const (
+	PriorityHigh   = "high"
+	PriorityNormal = "normal"
+	PriorityLow    = "low"
+)
+
+// PriorityConfig maps request priorities onto database-level controls
+type PriorityConfig struct {
+	Enabled                bool          // Whether priorities are applied to SQL statements
+	HighMaxExecutionTime   time.Duration // Statement time limit for high priority reads (0 = none)
+	NormalMaxExecutionTime time.Duration // Statement time limit for normal priority reads (0 = none)
+	LowMaxExecutionTime    time.Duration // Statement time limit for low priority reads (0 = none)
+	LowPriorityWrites      bool          // Add LOW_PRIORITY to low priority INSERT/UPDATE/DELETE/REPLACE
+}
+
+// DefaultPriorityConfig returns sensible default priority configuration
+func DefaultPriorityConfig() PriorityConfig {
+	return PriorityConfig{
+		Enabled:                true,
+		HighMaxExecutionTime:   0,
+		NormalMaxExecutionTime: 0,
+		LowMaxExecutionTime:    5 * time.Second,
+		LowPriorityWrites:      true,
+	}
+}
+
+// maxExecutionTime returns the statement time limit for a priority
+func (pc PriorityConfig) maxExecutionTime(priority string) time.Duration {
+	switch priority {
+	case PriorityHigh:
+		return pc.HighMaxExecutionTime
+	case PriorityLow:
+		return pc.LowMaxExecutionTime
+	default:
+		return pc.NormalMaxExecutionTime
+	}
+}
+
+// validPriority reports whether priority is empty or a known priority
+func validPriority(priority string) bool {
+	switch priority {
+	case "", PriorityHigh, PriorityNormal, PriorityLow:
+		return true
+	}
+	return false
+}
+
+// sqlDialect identifies the database flavour, which decides how time limits are expressed
+type sqlDialect int
+
+const (
+	dialectUnknown sqlDialect = iota
+	dialectMySQL              // SELECT /*+ MAX_EXECUTION_TIME(ms) */ ...
+	dialectMariaDB            // SET STATEMENT max_statement_time=s FOR SELECT ...
+)
+
+// dialectDetector lazily detects the database flavour from VERSION()
+type dialectDetector struct {
+	once    sync.Once
+	dialect sqlDialect
+}
+
+// detect returns the dialect of db, querying it only once
+func (d *dialectDetector) detect(ctx context.Context, db *sql.DB) sqlDialect {
+	d.once.Do(func() {
+		d.dialect = dialectMySQL
+		if db == nil {
+			return
+		}
+
+		var version string
+		if err := db.QueryRowContext(ctx, "SELECT VERSION()").Scan(&version); err != nil {
+			log.Printf("[server] Could not detect database version, assuming MySQL: %v", err)
+			return
+		}
+		if strings.Contains(strings.ToLower(version), "mariadb") {
+			d.dialect = dialectMariaDB
+		}
+	})
+	return d.dialect
+}
+
+// applyPriority rewrites query so the database enforces the limits of priority.
+// Reads get a statement time limit; writes get LOW_PRIORITY for low priority
+// requests. Statements of any other kind are returned unchanged.
+//
+// Parameters:
+//   - query: The validated SQL statement
+//   - priority: Request priority (empty means normal)
+//   - dialect: Database flavour
+//
+// Returns:
+//   - string: The statement to execute
+func (pc PriorityConfig) applyPriority(query, priority string, dialect sqlDialect) string {
+	if !pc.Enabled {
+		return query
+	}
+
+	trimmed := strings.TrimSpace(query)
+	verbEnd := strings.IndexFunc(trimmed, func(r rune) bool {
+		return r == ' ' || r == '\t' || r == '\n' || r == '\r' || r == '('
+	})
+	if verbEnd <= 0 {
+		return query
+	}
+	verb := strings.ToUpper(trimmed[:verbEnd])
+	rest := trimmed[verbEnd:]
+
+	switch verb {
+	case "SELECT":
+		limit := pc.maxExecutionTime(priority)
+		if limit <= 0 {
+			return query
+		}
+		if dialect == dialectMariaDB {
+			return fmt.Sprintf("SET STATEMENT max_statement_time=%g FOR %s", limit.Seconds(), trimmed)
+		}
+		return fmt.Sprintf("%s /*+ MAX_EXECUTION_TIME(%d) */%s", trimmed[:verbEnd], limit.Milliseconds(), rest)
+
+	case "INSERT", "UPDATE", "DELETE", "REPLACE":
+		if priority != PriorityLow || !pc.LowPriorityWrites {
+			return query
+		}
+		if strings.Contains(strings.ToUpper(rest), "LOW_PRIORITY") {
+			return query
+		}
+		return trimmed[:verbEnd] + " LOW_PRIORITY" + rest
+	}
+
+	return query
+}
+
+// SetPriorityConfig updates how request priorities map onto database controls
+func (h *Handler) SetPriorityConfig(config PriorityConfig) {
+	h.liveConfigMutex.Lock()
+	h.priorityConfig = config
+	h.liveConfigMutex.Unlock()
+	log.Printf("[server] Priority configuration updated: enabled=%v low_max_execution_time=%v low_priority_writes=%v",
+		config.Enabled, config.LowMaxExecutionTime, config.LowPriorityWrites)
+}
+
+// prioritizeQuery returns the statement to execute for req
+func (h *Handler) prioritizeQuery(ctx context.Context, req RPCRequest) string {
+	h.liveConfigMutex.RLock()
+	config := h.priorityConfig
+	h.liveConfigMutex.RUnlock()
+
+	if !config.Enabled {
+		return req.Query
+	}
+	return config.applyPriority(req.Query, req.Priority, h.dialect.detect(ctx, h.db))
+}
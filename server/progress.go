@@ -0,0 +1,125 @@
+package server
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ProgressConfig holds configuration for the interim notifications sent to
+// clients that ask for them while their request waits or runs
+type ProgressConfig struct {
+	Enabled  bool          // Send notifications to clients that ask for them
+	Interval time.Duration // Time between "running" notifications of a request being processed (0 = none)
+}
+
+// DefaultProgressConfig returns the default progress notification
+// configuration
+func DefaultProgressConfig() ProgressConfig {
+	return ProgressConfig{
+		Enabled:  true,
+		Interval: 5 * time.Second,
+	}
+}
+
+// progressMessageType marks interim notifications in the AMQP Type property,
+// so clients tell them from the response that follows
+const progressMessageType = "progress"
+
+// Progress notification states
+const (
+	ProgressQueued  = "queued"  // Waiting in the worker pool queue
+	ProgressRunning = "running" // Being processed
+)
+
+// ProgressNotice is the body of an interim notification, published to the
+// reply queue with the correlation ID of the request
+type ProgressNotice struct {
+	State     string `json:"state"`              // ProgressQueued or ProgressRunning
+	Position  int    `json:"position,omitempty"` // Place in the worker pool queue (1 = next)
+	ElapsedMs int64  `json:"elapsedMs"`          // Time since a worker started processing the request
+}
+
+// SetProgressConfig configures interim notifications
+func (h *Handler) SetProgressConfig(config ProgressConfig) {
+	h.liveConfigMutex.Lock()
+	h.progressConfig = config
+	h.liveConfigMutex.Unlock()
+	log.Printf("[server] Progress notifications configured: enabled=%v interval=%v", config.Enabled, config.Interval)
+}
+
+// progressEnabled reports whether notifications can reach clients. Transports
+// other than RabbitMQ deliver a single reply per request.
+func (h *Handler) progressEnabled() bool {
+	return h.currentProgressConfig().Enabled && h.transport == nil
+}
+
+// currentProgressConfig returns the progress notification settings in use
+func (h *Handler) currentProgressConfig() ProgressConfig {
+	h.liveConfigMutex.RLock()
+	defer h.liveConfigMutex.RUnlock()
+	return h.progressConfig
+}
+
+// wantsProgress reports whether the request in a message body asks for
+// interim notifications
+func wantsProgress(body []byte) bool {
+	var req struct {
+		Progress bool `json:"progress"`
+	}
+	return json.Unmarshal(body, &req) == nil && req.Progress
+}
+
+// notifyProgress publishes an interim notification for a request
+func (h *Handler) notifyProgress(ch *amqp.Channel, msg amqp.Delivery, notice ProgressNotice) {
+	body, err := json.Marshal(notice)
+	if err != nil {
+		return
+	}
+	h.publishResponse(ch, msg.ReplyTo, amqp.Publishing{
+		ContentType:   "application/json",
+		Type:          progressMessageType,
+		CorrelationId: msg.CorrelationId,
+		Body:          body,
+	})
+}
+
+// notifyQueued tells the client of a request that had to wait for a worker
+// its place in the queue
+func (h *Handler) notifyQueued(ch *amqp.Channel, msg amqp.Delivery, position int) {
+	if !h.progressEnabled() || !wantsProgress(msg.Body) {
+		return
+	}
+	go h.notifyProgress(ch, msg, ProgressNotice{State: ProgressQueued, Position: position})
+}
+
+// startProgress sends "running" notifications every interval while a
+// request is processed, so the client can tell a slow request from a stuck
+// one. The returned function stops them.
+func (h *Handler) startProgress(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) func() {
+	interval := h.currentProgressConfig().Interval
+	if !req.Progress || !h.progressEnabled() || interval <= 0 {
+		return func() {}
+	}
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				h.notifyProgress(ch, msg, ProgressNotice{
+					State:     ProgressRunning,
+					ElapsedMs: time.Since(start).Milliseconds(),
+				})
+			}
+		}
+	}()
+	return func() { close(done) }
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"log"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ProtocolVersion is the newest wire protocol version understood by this
+// server. Requests without a protocolVersion field come from version 1 clients
+// (or clients running with protocol_version=1 in compatibility mode).
+const ProtocolVersion = 2
+
+// protocolStats counts requests per wire protocol version so operators can
+// tell when every client of a mixed-version fleet has been upgraded.
+type protocolStats struct {
+	mutex    sync.Mutex
+	counts   map[int]int64
+	lastSeen map[int]time.Time
+}
+
+// newProtocolStats creates empty protocol statistics
+func newProtocolStats() *protocolStats {
+	return &protocolStats{
+		counts:   make(map[int]int64),
+		lastSeen: make(map[int]time.Time),
+	}
+}
+
+// record counts a request; version 0 (field absent) is recorded as version 1
+func (ps *protocolStats) record(version int, clientIP string) {
+	if version == 0 {
+		version = 1
+	}
+
+	ps.mutex.Lock()
+	first := ps.counts[version] == 0
+	ps.counts[version]++
+	ps.lastSeen[version] = time.Now()
+	ps.mutex.Unlock()
+
+	if first && version > ProtocolVersion {
+		log.Printf("[server] Client %s speaks protocol v%d, newer than this server (v%d); unknown options are ignored",
+			clientIP, version, ProtocolVersion)
+	}
+}
+
+// snapshot returns the per-version counters keyed by "v<N>"
+func (ps *protocolStats) snapshot() map[string]interface{} {
+	ps.mutex.Lock()
+	defer ps.mutex.Unlock()
+
+	versions := make([]int, 0, len(ps.counts))
+	for version := range ps.counts {
+		versions = append(versions, version)
+	}
+	sort.Ints(versions)
+
+	perVersion := make(map[string]interface{}, len(versions))
+	for _, version := range versions {
+		perVersion["v"+strconv.Itoa(version)] = map[string]interface{}{
+			"requests":  ps.counts[version],
+			"last_seen": ps.lastSeen[version].Format(time.RFC3339),
+		}
+	}
+	return map[string]interface{}{
+		"server_version": ProtocolVersion,
+		"versions":       perVersion,
+	}
+}
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/lordbasex/burrowctl/clock"
 )
 
 // QueryCache implements an LRU cache with TTL support for query results.
@@ -22,23 +24,25 @@ import (
 // - Cache statistics for monitoring
 // - Query normalization for consistent caching
 type QueryCache struct {
-	cache      map[string]*CacheEntry // Main cache storage
-	lruList    *LRUNode               // LRU linked list for eviction
-	config     QueryCacheConfig       // Cache configuration
-	mutex      sync.RWMutex           // Thread-safe access
-	stats      CacheStats             // Cache performance statistics
-	lastCleanup time.Time             // Last cleanup timestamp
+	cache       map[string]*CacheEntry // Main cache storage
+	lruList     *LRUNode               // LRU linked list for eviction
+	config      QueryCacheConfig       // Cache configuration
+	mutex       sync.RWMutex           // Thread-safe access
+	stats       CacheStats             // Cache performance statistics
+	lastCleanup time.Time              // Last cleanup timestamp
+	clock       clock.Clock            // Time source for expiry (clock.Real unless replaced)
 }
 
 // CacheEntry represents a single cached query result with metadata.
 type CacheEntry struct {
-	Key        string              // Cache key (query hash)
-	Response   RPCResponse         // Cached query response
-	CreatedAt  time.Time           // When the entry was cached
-	AccessedAt time.Time           // Last access time
-	AccessCount int64              // Number of times accessed
-	prev       *CacheEntry         // Previous entry in LRU list
-	next       *CacheEntry         // Next entry in LRU list
+	Key         string        // Cache key (query hash)
+	Response    RPCResponse   // Cached query response
+	CreatedAt   time.Time     // When the entry was cached
+	AccessedAt  time.Time     // Last access time
+	AccessCount int64         // Number of times accessed
+	TTL         time.Duration // Time to live of this entry
+	prev        *CacheEntry   // Previous entry in LRU list
+	next        *CacheEntry   // Next entry in LRU list
 }
 
 // LRUNode represents the head of the LRU doubly-linked list.
@@ -54,18 +58,29 @@ type QueryCacheConfig struct {
 	TTL            time.Duration // Time to live for cache entries
 	CleanupInterval time.Duration // How often to run cleanup (remove expired entries)
 	Enabled        bool          // Whether caching is enabled
+
+	// Adaptive caching stores only the read-only queries whose statement
+	// statistics show they are both frequent and slow enough to be worth it
+	Adaptive              bool
+	AdaptiveMinExecutions int64         // Executions of a fingerprint before its results are cached
+	AdaptiveMinLatency    time.Duration // Average latency of a fingerprint before its results are cached
+	// TTLOverrides sets the time to live per query fingerprint (see
+	// ParseCacheTTLOverrides); a fingerprint with 0 is never cached. Overridden
+	// fingerprints are cached regardless of adaptive caching.
+	TTLOverrides map[string]time.Duration
 }
 
 // CacheStats contains cache performance statistics.
 type CacheStats struct {
-	Hits           int64     // Number of cache hits
-	Misses         int64     // Number of cache misses
-	Evictions      int64     // Number of entries evicted
-	Expirations    int64     // Number of entries expired
-	TotalRequests  int64     // Total cache requests
-	LastCleanup    time.Time // Last cleanup time
-	CurrentSize    int       // Current number of cached entries
-	mutex          sync.RWMutex // Thread-safe stats access
+	Hits          int64        // Number of cache hits
+	Misses        int64        // Number of cache misses
+	Evictions     int64        // Number of entries evicted
+	Expirations   int64        // Number of entries expired
+	TotalRequests int64        // Total cache requests
+	Skipped       int64        // Results adaptive caching or a TTL override left uncached
+	LastCleanup   time.Time    // Last cleanup time
+	CurrentSize   int          // Current number of cached entries
+	mutex         sync.RWMutex // Thread-safe stats access
 }
 
 // DefaultQueryCacheConfig returns a default cache configuration optimized for typical workloads.
@@ -75,6 +90,8 @@ func DefaultQueryCacheConfig() QueryCacheConfig {
 		TTL:             15 * time.Minute,   // Entries expire after 15 minutes
 		CleanupInterval: 5 * time.Minute,    // Cleanup every 5 minutes
 		Enabled:         true,               // Enable caching by default
+		AdaptiveMinExecutions: 3,                     // Cache a query once it ran 3 times...
+		AdaptiveMinLatency:    20 * time.Millisecond, // ...taking 20ms on average
 	}
 }
 
@@ -86,15 +103,7 @@ func DefaultQueryCacheConfig() QueryCacheConfig {
 // Returns:
 //   - *QueryCache: Configured cache instance ready for use
 func NewQueryCache(config QueryCacheConfig) *QueryCache {
-	if config.MaxSize <= 0 {
-		config.MaxSize = 1000
-	}
-	if config.TTL <= 0 {
-		config.TTL = 15 * time.Minute
-	}
-	if config.CleanupInterval <= 0 {
-		config.CleanupInterval = 5 * time.Minute
-	}
+	config = config.withDefaults()
 
 	cache := &QueryCache{
 		cache:   make(map[string]*CacheEntry),
@@ -102,14 +111,61 @@ func NewQueryCache(config QueryCacheConfig) *QueryCache {
 		config:  config,
 		stats:   CacheStats{},
 		lastCleanup: time.Now(),
+		clock:       clock.Real,
 	}
 
 	log.Printf("[server] Query cache initialized: maxSize=%d, ttl=%v, cleanup=%v", 
 		config.MaxSize, config.TTL, config.CleanupInterval)
+	if config.Adaptive {
+		log.Printf("[server] Adaptive caching: queries cached after %d executions averaging %v or more",
+			config.AdaptiveMinExecutions, config.AdaptiveMinLatency)
+	}
 
 	return cache
 }
 
+// withDefaults fills in the size, TTL and cleanup interval left at zero
+func (config QueryCacheConfig) withDefaults() QueryCacheConfig {
+	if config.MaxSize <= 0 {
+		config.MaxSize = 1000
+	}
+	if config.TTL <= 0 {
+		config.TTL = 15 * time.Minute
+	}
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = 5 * time.Minute
+	}
+	return config
+}
+
+// SetConfig changes the configuration of a running cache. Cached entries are
+// kept with the TTL they were stored with; the least recently used ones are
+// evicted if the cache is now larger than MaxSize. Disabling the cache
+// clears it.
+func (qc *QueryCache) SetConfig(config QueryCacheConfig) {
+	config = config.withDefaults()
+
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+
+	qc.config = config
+	if !config.Enabled {
+		qc.cache = make(map[string]*CacheEntry)
+		qc.lruList = &LRUNode{}
+		return
+	}
+	for qc.lruList.size > config.MaxSize {
+		qc.evictLRU()
+	}
+}
+
+// currentConfig returns the configuration in use
+func (qc *QueryCache) currentConfig() QueryCacheConfig {
+	qc.mutex.RLock()
+	defer qc.mutex.RUnlock()
+	return qc.config
+}
+
 // Get retrieves a cached query result if it exists and is still valid.
 //
 // Parameters:
@@ -120,13 +176,13 @@ func NewQueryCache(config QueryCacheConfig) *QueryCache {
 //   - *RPCResponse: Cached response if found and valid
 //   - bool: Whether a valid cache entry was found
 func (qc *QueryCache) Get(query string, params []interface{}) (*RPCResponse, bool) {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+
 	if !qc.config.Enabled {
 		return nil, false
 	}
 
-	qc.mutex.Lock()
-	defer qc.mutex.Unlock()
-
 	// Generate cache key from normalized query and parameters
 	key := qc.generateCacheKey(query, params)
 
@@ -143,7 +199,7 @@ func (qc *QueryCache) Get(query string, params []interface{}) (*RPCResponse, boo
 	}
 
 	// Check if entry has expired
-	if time.Since(entry.CreatedAt) > qc.config.TTL {
+	if qc.clock.Since(entry.CreatedAt) > entry.TTL {
 		// Entry expired, remove it
 		qc.removeEntry(entry)
 		qc.recordExpiration()
@@ -151,7 +207,7 @@ func (qc *QueryCache) Get(query string, params []interface{}) (*RPCResponse, boo
 	}
 
 	// Entry is valid, update access info and move to front
-	entry.AccessedAt = time.Now()
+	entry.AccessedAt = qc.clock.Now()
 	entry.AccessCount++
 	qc.moveToFront(entry)
 	qc.recordHit()
@@ -160,6 +216,45 @@ func (qc *QueryCache) Get(query string, params []interface{}) (*RPCResponse, boo
 	return &entry.Response, true
 }
 
+// Lookup is like Get but also returns the cache metadata of the entry.
+func (qc *QueryCache) Lookup(query string, params []interface{}) (*RPCResponse, *CacheInfo, bool) {
+	response, found := qc.Get(query, params)
+	if !found {
+		return nil, nil, false
+	}
+
+	qc.mutex.RLock()
+	defer qc.mutex.RUnlock()
+
+	info := &CacheInfo{Hit: true}
+	if entry, exists := qc.cache[qc.generateCacheKey(query, params)]; exists {
+		age := qc.clock.Since(entry.CreatedAt)
+		info.AgeMs = age.Milliseconds()
+		if remaining := entry.TTL - age; remaining > 0 {
+			info.TTLMs = remaining.Milliseconds()
+		}
+	}
+	return response, info, true
+}
+
+// Enabled reports whether results are being cached
+func (qc *QueryCache) Enabled() bool {
+	return qc.currentConfig().Enabled
+}
+
+// TTL returns the time to live of cache entries
+func (qc *QueryCache) TTL() time.Duration {
+	return qc.currentConfig().TTL
+}
+
+// SetClock replaces the time source used for expiry (for tests)
+func (qc *QueryCache) SetClock(c clock.Clock) {
+	qc.mutex.Lock()
+	defer qc.mutex.Unlock()
+	qc.clock = clock.OrReal(c)
+	qc.lastCleanup = qc.clock.Now()
+}
+
 // Set stores a query result in the cache.
 //
 // Parameters:
@@ -167,13 +262,22 @@ func (qc *QueryCache) Get(query string, params []interface{}) (*RPCResponse, boo
 //   - params: Query parameters
 //   - response: Query response to cache
 func (qc *QueryCache) Set(query string, params []interface{}, response RPCResponse) {
-	if !qc.config.Enabled {
+	qc.SetWithTTL(query, params, response, qc.TTL())
+}
+
+// SetWithTTL stores a query result in the cache with a time to live of its own.
+func (qc *QueryCache) SetWithTTL(query string, params []interface{}, response RPCResponse, ttl time.Duration) {
+	if ttl <= 0 {
 		return
 	}
 
 	qc.mutex.Lock()
 	defer qc.mutex.Unlock()
 
+	if !qc.config.Enabled {
+		return
+	}
+
 	// Generate cache key
 	key := qc.generateCacheKey(query, params)
 
@@ -181,8 +285,9 @@ func (qc *QueryCache) Set(query string, params []interface{}, response RPCRespon
 	if existing, exists := qc.cache[key]; exists {
 		// Update existing entry
 		existing.Response = response
-		existing.CreatedAt = time.Now()
-		existing.AccessedAt = time.Now()
+		existing.TTL = ttl
+		existing.CreatedAt = qc.clock.Now()
+		existing.AccessedAt = qc.clock.Now()
 		existing.AccessCount++
 		qc.moveToFront(existing)
 		return
@@ -192,9 +297,10 @@ func (qc *QueryCache) Set(query string, params []interface{}, response RPCRespon
 	entry := &CacheEntry{
 		Key:         key,
 		Response:    response,
-		CreatedAt:   time.Now(),
-		AccessedAt:  time.Now(),
+		CreatedAt:   qc.clock.Now(),
+		AccessedAt:  qc.clock.Now(),
 		AccessCount: 1,
+		TTL:         ttl,
 	}
 
 	// Add to cache
@@ -207,7 +313,7 @@ func (qc *QueryCache) Set(query string, params []interface{}, response RPCRespon
 	}
 
 	// Periodic cleanup
-	if time.Since(qc.lastCleanup) > qc.config.CleanupInterval {
+	if qc.clock.Since(qc.lastCleanup) > qc.config.CleanupInterval {
 		go qc.cleanupExpired()
 	}
 }
@@ -239,6 +345,7 @@ func (qc *QueryCache) GetStats() CacheStats {
 		Evictions:     qc.stats.Evictions,
 		Expirations:   qc.stats.Expirations,
 		TotalRequests: qc.stats.TotalRequests,
+		Skipped:       qc.stats.Skipped,
 		LastCleanup:   qc.stats.LastCleanup,
 		CurrentSize:   currentSize,
 		// Don't copy the mutex
@@ -349,12 +456,12 @@ func (qc *QueryCache) cleanupExpired() {
 	qc.mutex.Lock()
 	defer qc.mutex.Unlock()
 
-	now := time.Now()
+	now := qc.clock.Now()
 	var expiredKeys []string
 
 	// Find expired entries
 	for key, entry := range qc.cache {
-		if now.Sub(entry.CreatedAt) > qc.config.TTL {
+		if now.Sub(entry.CreatedAt) > entry.TTL {
 			expiredKeys = append(expiredKeys, key)
 		}
 	}
@@ -397,4 +504,10 @@ func (qc *QueryCache) recordExpiration() {
 	qc.stats.mutex.Lock()
 	qc.stats.Expirations++
 	qc.stats.mutex.Unlock()
+}
+
+func (qc *QueryCache) recordSkip() {
+	qc.stats.mutex.Lock()
+	qc.stats.Skipped++
+	qc.stats.mutex.Unlock()
 }
\ No newline at end of file
@@ -0,0 +1,38 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lordbasex/burrowctl/clock/clocktest"
+)
+
+func TestQueryCacheTTL(t *testing.T) {
+	fake := clocktest.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	cache := NewQueryCache(QueryCacheConfig{Enabled: true, TTL: time.Minute})
+	cache.SetClock(fake)
+
+	cache.Set("SELECT 1", nil, RPCResponse{Columns: []string{"1"}})
+	cache.SetWithTTL("SELECT 2", nil, RPCResponse{Columns: []string{"2"}}, 5*time.Minute)
+
+	fake.Advance(time.Minute - time.Second)
+	if _, found := cache.Get("SELECT 1", nil); !found {
+		t.Fatal("entry expired before its TTL")
+	}
+
+	fake.Advance(2 * time.Second)
+	if _, found := cache.Get("SELECT 1", nil); found {
+		t.Fatal("entry still served after its TTL")
+	}
+	if _, found := cache.Get("SELECT 2", nil); !found {
+		t.Fatal("entry with its own TTL expired with the default TTL")
+	}
+	if stats := cache.GetStats(); stats.Expirations != 1 {
+		t.Fatalf("expirations = %d, want 1", stats.Expirations)
+	}
+
+	fake.Advance(5 * time.Minute)
+	if _, found := cache.Get("SELECT 2", nil); found {
+		t.Fatal("entry with its own TTL still served after it")
+	}
+}
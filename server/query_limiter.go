@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrTooManyQueries is the error code of SQL requests that waited too long
+// for one of the MaxConcurrentQueries slots
+const ErrTooManyQueries = "TOO_MANY_QUERIES"
+
+// QueryLimiterConfig holds configuration for the limit on SQL statements
+// running against the database at the same time
+type QueryLimiterConfig struct {
+	MaxConcurrent int           // Statements running at the same time (0 = no limit)
+	MaxWait       time.Duration // Longest a statement waits for a slot before it is rejected
+}
+
+// DefaultQueryLimiterConfig returns the default concurrency limit
+// configuration (no limit)
+func DefaultQueryLimiterConfig() QueryLimiterConfig {
+	return QueryLimiterConfig{
+		MaxConcurrent: 0,
+		MaxWait:       5 * time.Second,
+	}
+}
+
+// QueryLimiterStats contains statistics about the concurrency limit
+type QueryLimiterStats struct {
+	MaxConcurrent int   `json:"max_concurrent"` // Configured limit (0 = none)
+	Running       int64 `json:"running"`        // Statements holding a slot
+	Waiting       int64 `json:"waiting"`        // Statements waiting for a slot
+	Delayed       int64 `json:"delayed"`        // Statements that had to wait for a slot
+	Rejected      int64 `json:"rejected"`       // Statements that gave up waiting
+}
+
+// QueryLimiter bounds the SQL statements running against the database at
+// the same time, independently of the worker count, so a burst of heavy
+// queries on a small device cannot exhaust MySQL connections or CPU.
+type QueryLimiter struct {
+	mutex  sync.Mutex
+	config QueryLimiterConfig
+	held   int           // Slots handed out and not given back, counted even without a limit
+	freed  chan struct{} // Closed when a slot is given back or the limit changes
+
+	running  int64 // atomic
+	waiting  int64 // atomic
+	delayed  int64 // atomic
+	rejected int64 // atomic
+}
+
+// NewQueryLimiter creates a concurrency limiter
+func NewQueryLimiter(config QueryLimiterConfig) *QueryLimiter {
+	if config.MaxWait <= 0 {
+		config.MaxWait = DefaultQueryLimiterConfig().MaxWait
+	}
+	return &QueryLimiter{config: config, freed: make(chan struct{})}
+}
+
+// SetConfig changes the limit of a running limiter. Slots already handed out
+// count against the new limit: lowering it below the statements running
+// makes new ones wait until enough of them finish.
+func (ql *QueryLimiter) SetConfig(config QueryLimiterConfig) {
+	if config.MaxWait <= 0 {
+		config.MaxWait = DefaultQueryLimiterConfig().MaxWait
+	}
+
+	ql.mutex.Lock()
+	defer ql.mutex.Unlock()
+	ql.config = config
+	ql.wakeWaiters()
+}
+
+// Config returns the limit in use
+func (ql *QueryLimiter) Config() QueryLimiterConfig {
+	ql.mutex.Lock()
+	defer ql.mutex.Unlock()
+	return ql.config
+}
+
+// Acquire takes a slot for a statement, waiting up to MaxWait or until ctx
+// is done. The returned function gives the slot back.
+func (ql *QueryLimiter) Acquire(ctx context.Context) (func(), error) {
+	if err := ql.wait(ctx); err != nil {
+		return nil, err
+	}
+	atomic.AddInt64(&ql.running, 1)
+	return func() {
+		atomic.AddInt64(&ql.running, -1)
+		ql.release()
+	}, nil
+}
+
+// tryAcquire takes a slot if one is free (must be called with ql.mutex held)
+func (ql *QueryLimiter) tryAcquire() bool {
+	if ql.config.MaxConcurrent > 0 && ql.held >= ql.config.MaxConcurrent {
+		return false
+	}
+	ql.held++
+	return true
+}
+
+// release gives a slot back and wakes the statements waiting for one
+func (ql *QueryLimiter) release() {
+	ql.mutex.Lock()
+	defer ql.mutex.Unlock()
+	ql.held--
+	if ql.config.MaxConcurrent > 0 {
+		ql.wakeWaiters()
+	}
+}
+
+// wakeWaiters lets every waiting statement check for a free slot again
+// (must be called with ql.mutex held)
+func (ql *QueryLimiter) wakeWaiters() {
+	close(ql.freed)
+	ql.freed = make(chan struct{})
+}
+
+// wait takes a slot, waiting for one when all are in use
+func (ql *QueryLimiter) wait(ctx context.Context) error {
+	ql.mutex.Lock()
+	if ql.tryAcquire() {
+		ql.mutex.Unlock()
+		return nil
+	}
+	config := ql.config
+	ql.mutex.Unlock()
+
+	atomic.AddInt64(&ql.waiting, 1)
+	atomic.AddInt64(&ql.delayed, 1)
+	defer atomic.AddInt64(&ql.waiting, -1)
+
+	timer := time.NewTimer(config.MaxWait)
+	defer timer.Stop()
+	for {
+		ql.mutex.Lock()
+		if ql.tryAcquire() {
+			ql.mutex.Unlock()
+			return nil
+		}
+		config = ql.config
+		freed := ql.freed
+		ql.mutex.Unlock()
+
+		select {
+		case <-freed:
+			continue
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		break
+	}
+	atomic.AddInt64(&ql.rejected, 1)
+	return fmt.Errorf("too many queries running (max %d); no slot freed up within %v",
+		config.MaxConcurrent, config.MaxWait)
+}
+
+// GetStats returns current concurrency limit statistics
+func (ql *QueryLimiter) GetStats() QueryLimiterStats {
+	return QueryLimiterStats{
+		MaxConcurrent: ql.Config().MaxConcurrent,
+		Running:       atomic.LoadInt64(&ql.running),
+		Waiting:       atomic.LoadInt64(&ql.waiting),
+		Delayed:       atomic.LoadInt64(&ql.delayed),
+		Rejected:      atomic.LoadInt64(&ql.rejected),
+	}
+}
+
+// SetQueryLimiterConfig configures the limit on concurrent SQL statements.
+// Statements running under the previous limit keep their slots and count
+// against the new one.
+func (h *Handler) SetQueryLimiterConfig(config QueryLimiterConfig) {
+	h.queryLimiter.SetConfig(config)
+	if config.MaxConcurrent > 0 {
+		log.Printf("[server] Concurrent queries limited to %d (max wait %v)", config.MaxConcurrent, h.queryLimiter.Config().MaxWait)
+	}
+}
+
+// GetQueryLimiterStats returns current concurrency limit statistics
+func (h *Handler) GetQueryLimiterStats() QueryLimiterStats {
+	return h.queryLimiter.GetStats()
+}
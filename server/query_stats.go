@@ -0,0 +1,202 @@
+package server
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// latencySamples is the number of recent latencies kept per fingerprint to
+// estimate the 95th percentile
+const latencySamples = 128
+
+// QueryStatsConfig holds configuration for per-fingerprint statement
+// statistics
+type QueryStatsConfig struct {
+	Enabled         bool // Whether statements are counted
+	MaxFingerprints int  // Distinct fingerprints tracked; new ones beyond this are counted as "other"
+}
+
+// DefaultQueryStatsConfig returns the default statement statistics
+// configuration
+func DefaultQueryStatsConfig() QueryStatsConfig {
+	return QueryStatsConfig{
+		Enabled:         true,
+		MaxFingerprints: 500,
+	}
+}
+
+// otherFingerprint collects statements once MaxFingerprints is reached
+const otherFingerprint = "(other)"
+
+// StatementStats are the statistics of one query fingerprint: the query
+// with its literals replaced by "?"
+type StatementStats struct {
+	Fingerprint string        `json:"fingerprint"`
+	Count       int64         `json:"count"`      // Executions
+	Errors      int64         `json:"errors"`     // Executions that failed
+	Rows        int64         `json:"rows"`       // Rows returned or affected, summed
+	TotalTime   time.Duration `json:"total_ns"`   // Execution time, summed
+	AvgLatency  time.Duration `json:"avg_ns"`     // Mean execution time
+	P95Latency  time.Duration `json:"p95_ns"`     // 95th percentile of the most recent executions
+	MaxLatency  time.Duration `json:"max_ns"`     // Slowest execution
+	FirstSeen   time.Time     `json:"first_seen"` // First execution
+	LastSeen    time.Time     `json:"last_seen"`  // Latest execution
+}
+
+// statementEntry accumulates the statistics of a fingerprint
+type statementEntry struct {
+	stats     StatementStats
+	latencies []time.Duration // Ring of recent latencies
+	next      int             // Ring position of the next latency
+}
+
+// QueryStats keeps execution statistics per query fingerprint, a small
+// performance_schema for devices that cannot be inspected directly
+type QueryStats struct {
+	config  QueryStatsConfig
+	entries map[string]*statementEntry
+	mutex   sync.Mutex
+}
+
+// NewQueryStats creates an empty statement statistics registry
+func NewQueryStats(config QueryStatsConfig) *QueryStats {
+	if config.MaxFingerprints <= 0 {
+		config.MaxFingerprints = DefaultQueryStatsConfig().MaxFingerprints
+	}
+	return &QueryStats{config: config, entries: make(map[string]*statementEntry)}
+}
+
+// Record counts an execution of query
+func (qs *QueryStats) Record(query string, duration time.Duration, rows int64, failed bool) {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+
+	if !qs.config.Enabled {
+		return
+	}
+	fingerprint := queryFingerprint(query)
+	now := time.Now()
+
+	entry, ok := qs.entries[fingerprint]
+	if !ok {
+		if len(qs.entries) >= qs.config.MaxFingerprints {
+			fingerprint = otherFingerprint
+			entry = qs.entries[fingerprint]
+		}
+		if entry == nil {
+			entry = &statementEntry{stats: StatementStats{Fingerprint: fingerprint, FirstSeen: now}}
+			qs.entries[fingerprint] = entry
+		}
+	}
+
+	stats := &entry.stats
+	stats.Count++
+	if failed {
+		stats.Errors++
+	}
+	stats.Rows += rows
+	stats.TotalTime += duration
+	if duration > stats.MaxLatency {
+		stats.MaxLatency = duration
+	}
+	stats.LastSeen = now
+
+	if len(entry.latencies) < latencySamples {
+		entry.latencies = append(entry.latencies, duration)
+	} else {
+		entry.latencies[entry.next] = duration
+	}
+	entry.next = (entry.next + 1) % latencySamples
+}
+
+// Snapshot returns the statistics of every fingerprint, the ones with the
+// most total execution time first
+func (qs *QueryStats) Snapshot() []StatementStats {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+
+	snapshot := make([]StatementStats, 0, len(qs.entries))
+	for _, entry := range qs.entries {
+		stats := entry.stats
+		stats.AvgLatency = stats.TotalTime / time.Duration(stats.Count)
+		stats.P95Latency = percentile(entry.latencies, 0.95)
+		snapshot = append(snapshot, stats)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].TotalTime > snapshot[j].TotalTime })
+	return snapshot
+}
+
+// Lookup returns the statistics of a fingerprint, if it has any
+func (qs *QueryStats) Lookup(fingerprint string) (StatementStats, bool) {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+
+	entry, ok := qs.entries[fingerprint]
+	if !ok {
+		return StatementStats{}, false
+	}
+	stats := entry.stats
+	stats.AvgLatency = stats.TotalTime / time.Duration(stats.Count)
+	return stats, true
+}
+
+// SetConfig replaces the configuration; fingerprints already tracked keep
+// their statistics
+func (qs *QueryStats) SetConfig(config QueryStatsConfig) {
+	if config.MaxFingerprints <= 0 {
+		config.MaxFingerprints = DefaultQueryStatsConfig().MaxFingerprints
+	}
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+	qs.config = config
+}
+
+// Reset forgets every fingerprint
+func (qs *QueryStats) Reset() {
+	qs.mutex.Lock()
+	defer qs.mutex.Unlock()
+	qs.entries = make(map[string]*statementEntry)
+}
+
+// percentile returns the p-th percentile (0..1) of durations
+func percentile(durations []time.Duration, p float64) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration(nil), durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	index := int(float64(len(sorted))*p+0.5) - 1
+	if index < 0 {
+		index = 0
+	}
+	if index >= len(sorted) {
+		index = len(sorted) - 1
+	}
+	return sorted[index]
+}
+
+// SetQueryStatsConfig updates the statement statistics configuration
+func (h *Handler) SetQueryStatsConfig(config QueryStatsConfig) {
+	h.queryStats.SetConfig(config)
+	log.Printf("[server] Query statistics configuration updated: enabled=%v max_fingerprints=%d",
+		config.Enabled, config.MaxFingerprints)
+}
+
+// GetQueryStats returns the execution statistics of every query
+// fingerprint, the ones with the most total execution time first. limit
+// keeps only the first ones (0 = all).
+func (h *Handler) GetQueryStats(limit int) []StatementStats {
+	stats := h.queryStats.Snapshot()
+	if limit > 0 && len(stats) > limit {
+		stats = stats[:limit]
+	}
+	return stats
+}
+
+// recordStatement counts an execution of a SQL request in the statement
+// statistics
+func (h *Handler) recordStatement(req RPCRequest, duration time.Duration, rows int64, failed bool) {
+	h.queryStats.Record(req.Query, duration, rows, failed)
+}
@@ -0,0 +1,157 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Queue types accepted by QueueConfig.Type
+const (
+	QueueTypeClassic = "classic"
+	QueueTypeQuorum  = "quorum"
+)
+
+// QueueConfig holds the declaration options of the device RPC and heartbeat
+// queues. The defaults match earlier releases: classic, non-durable queues
+// that survive their consumers but not a broker restart.
+//
+// RabbitMQ refuses to redeclare an existing queue with different options, so
+// changing them requires deleting the queues first (rabbitmqctl delete_queue).
+type QueueConfig struct {
+	Durable    bool          // Queues survive a broker restart
+	AutoDelete bool          // Queues are deleted once the last consumer goes away
+	Type       string        // "classic" (default) or "quorum" (replicated, requires Durable)
+	MessageTTL time.Duration // Requests not consumed within this time are dropped (0 = no TTL)
+	MaxLength  int           // Maximum messages kept per queue; the oldest are dropped (0 = unlimited)
+	DeadLetter bool          // Route expired and dropped requests to the device's dead-letter queue
+}
+
+// DefaultQueueConfig returns the default queue configuration
+func DefaultQueueConfig() QueueConfig {
+	return QueueConfig{
+		Type: QueueTypeClassic,
+	}
+}
+
+// validate checks that the options can be combined
+func (qc QueueConfig) validate() error {
+	switch qc.Type {
+	case "", QueueTypeClassic:
+	case QueueTypeQuorum:
+		if !qc.Durable {
+			return fmt.Errorf("quorum queues must be durable")
+		}
+		if qc.AutoDelete {
+			return fmt.Errorf("quorum queues cannot be auto-delete")
+		}
+	default:
+		return fmt.Errorf("invalid queue type '%s': must be %s or %s", qc.Type, QueueTypeClassic, QueueTypeQuorum)
+	}
+	if qc.MessageTTL < 0 {
+		return fmt.Errorf("queue message TTL cannot be negative")
+	}
+	if qc.MaxLength < 0 {
+		return fmt.Errorf("queue max length cannot be negative")
+	}
+	return nil
+}
+
+// arguments returns the x-arguments of the queue declaration. Requests the
+// queue drops are routed to deadLetterExchange unless it is empty.
+func (qc QueueConfig) arguments(deadLetterExchange string) amqp.Table {
+	args := amqp.Table{}
+	if qc.Type == QueueTypeQuorum {
+		args["x-queue-type"] = QueueTypeQuorum
+	}
+	if deadLetterExchange != "" {
+		args["x-dead-letter-exchange"] = deadLetterExchange
+	}
+	if qc.MessageTTL > 0 {
+		args["x-message-ttl"] = qc.MessageTTL.Milliseconds()
+	}
+	if qc.MaxLength > 0 {
+		args["x-max-length"] = int64(qc.MaxLength)
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	return args
+}
+
+// SetQueueConfig sets the declaration options of the device queues. It must
+// be called before Start.
+func (h *Handler) SetQueueConfig(config QueueConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	if config.Type == "" {
+		config.Type = QueueTypeClassic
+	}
+	h.queueConfig = config
+	return nil
+}
+
+// declareDeviceQueues declares the RPC and heartbeat queues of topology with
+// the configured options. With dead-lettering enabled, requests that expire
+// in the RPC queue (per-request TTL or MessageTTL), or are dropped by
+// MaxLength, are routed to the dead-letter queue for inspection instead of
+// being discarded. Heartbeat PINGs are never dead-lettered.
+func (h *Handler) declareDeviceQueues(ch *amqp.Channel, topology client.Topology) (amqp.Queue, error) {
+	deadLetterExchange := ""
+	if h.queueConfig.DeadLetter {
+		if err := h.declareDeadLetterQueue(ch, topology); err != nil {
+			return amqp.Queue{}, err
+		}
+		deadLetterExchange = topology.DeadLetterExchange
+	}
+
+	rpcQueue, err := h.declareDeviceQueue(ch, topology.RPCQueue, h.queueConfig.arguments(deadLetterExchange))
+	if err != nil {
+		return amqp.Queue{}, fmt.Errorf("failed to declare RPC queue: %w", client.ExplainAMQPError(err, h.amqpURL))
+	}
+	if _, err := h.declareDeviceQueue(ch, topology.HeartbeatQueue, h.queueConfig.arguments("")); err != nil {
+		return amqp.Queue{}, fmt.Errorf("failed to declare heartbeat queue: %w", client.ExplainAMQPError(err, h.amqpURL))
+	}
+	return rpcQueue, nil
+}
+
+// declareDeviceQueue declares a device queue with the configured options
+func (h *Handler) declareDeviceQueue(ch *amqp.Channel, name string, args amqp.Table) (amqp.Queue, error) {
+	return ch.QueueDeclare(
+		name,
+		h.queueConfig.Durable,
+		h.queueConfig.AutoDelete,
+		false, // exclusive - allow multiple consumers
+		false, // no-wait - wait for server confirmation
+		args,
+	)
+}
+
+// declareDeadLetterQueue declares the dead-letter exchange of topology and
+// the queue bound to it. The queue has no consumer: dead-lettered requests
+// stay there (bounded by MaxLength) until an operator inspects or purges it.
+func (h *Handler) declareDeadLetterQueue(ch *amqp.Channel, topology client.Topology) error {
+	if err := ch.ExchangeDeclare(topology.DeadLetterExchange, "fanout", h.queueConfig.Durable, false, false, false, nil); err != nil {
+		return fmt.Errorf("failed to declare dead-letter exchange: %w", client.ExplainAMQPError(err, h.amqpURL))
+	}
+
+	args := amqp.Table{}
+	if h.queueConfig.Type == QueueTypeQuorum {
+		args["x-queue-type"] = QueueTypeQuorum
+	}
+	if h.queueConfig.MaxLength > 0 {
+		args["x-max-length"] = int64(h.queueConfig.MaxLength)
+	}
+	if _, err := ch.QueueDeclare(topology.DeadLetterQueue, h.queueConfig.Durable, false, false, false, args); err != nil {
+		return fmt.Errorf("failed to declare dead-letter queue: %w", client.ExplainAMQPError(err, h.amqpURL))
+	}
+	if err := ch.QueueBind(topology.DeadLetterQueue, "", topology.DeadLetterExchange, false, nil); err != nil {
+		return fmt.Errorf("failed to bind dead-letter queue: %w", client.ExplainAMQPError(err, h.amqpURL))
+	}
+	log.Printf("[server] Dead-letter queue '%s' declared", topology.DeadLetterQueue)
+	return nil
+}
@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"testing"
+	"time"
+
+	_ "github.com/lordbasex/burrowctl/client"
+)
+
+// TestRateLimitDelayFreesWorker checks that requests delayed by the rate
+// limiter wait without holding a worker: with a single worker, two of them
+// wait at the same time and all of them are answered
+func TestRateLimitDelayFreesWorker(t *testing.T) {
+	h := NewHandler("delay-device", "mem://rate-limit-delay-test", "", "open", nil)
+	h.SetWorkerPoolConfig(&WorkerPoolConfig{WorkerCount: 1})
+	h.SetRateLimiterConfig(&RateLimiterConfig{
+		RequestsPerSecond: 4,
+		BurstSize:         1,
+		CleanupInterval:   time.Minute,
+		Mode:              RateLimitDelay,
+		MaxDelay:          5 * time.Second,
+	})
+	h.RegisterFunction("hello", func() string { return "hi" })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Start(ctx)
+
+	db, err := sql.Open("rabbitsql", "deviceID=delay-device&amqp_uri=mem://rate-limit-delay-test&timeout=10s&heartbeat_enabled=false")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	const requests = 4
+	errs := make(chan error, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var greeting string
+			errs <- db.QueryRow(`FUNCTION:{"name":"hello","params":[]}`).Scan(&greeting)
+		}()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for h.workerPool.GetStats().DelayedTasks < 2 {
+		if time.Now().After(deadline) {
+			t.Fatal("delayed requests did not wait side by side")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatalf("delayed request failed: %v", err)
+		}
+	}
+	if stats := h.workerPool.GetStats(); stats.DelayedTasks != 0 {
+		t.Fatalf("%d requests still delayed", stats.DelayedTasks)
+	}
+}
+
+// TestRateLimitDelayRejectsWhenPoolStopped checks that a delayed request the
+// pool no longer accepts is answered instead of dropped
+func TestRateLimitDelayRejectsWhenPoolStopped(t *testing.T) {
+	wp := NewWorkerPool(newReloadTestHandler(t), nil)
+
+	rejected := make(chan RPCResponse, 1)
+	wp.delay(MessageTask{}, &delayedRequest{
+		delay:  time.Millisecond,
+		run:    func() { t.Error("request ran on a stopped pool") },
+		reject: func(resp RPCResponse) { rejected <- resp },
+	})
+
+	select {
+	case resp := <-rejected:
+		if resp.Error == "" {
+			t.Fatal("rejected request was answered without an error")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("delayed request was not answered")
+	}
+}
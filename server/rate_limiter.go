@@ -1,15 +1,42 @@
 package server
 
 import (
+	"fmt"
+	"math"
+	"sort"
 	"sync"
+	"sync/atomic"
 	"time"
+
+	"github.com/lordbasex/burrowctl/clock"
 )
 
+// ErrRateLimited is the error code of requests rejected by the rate limiter
+const ErrRateLimited = "RATE_LIMITED"
+
+// Rate limiter modes: what happens to a request when its client has no
+// tokens left
+const (
+	RateLimitReject = "reject" // Reject the request right away
+	RateLimitDelay  = "delay"  // Hold the request until a token is available, up to MaxDelay
+)
+
+// ValidateRateLimitMode checks a rate limiter mode ("" is RateLimitReject)
+func ValidateRateLimitMode(mode string) error {
+	switch mode {
+	case "", RateLimitReject, RateLimitDelay:
+		return nil
+	}
+	return fmt.Errorf("invalid rate limit mode '%s': must be %s or %s", mode, RateLimitReject, RateLimitDelay)
+}
+
 // RateLimiterConfig holds configuration for the rate limiter.
 type RateLimiterConfig struct {
 	RequestsPerSecond int           // Maximum requests per second per client
 	BurstSize         int           // Maximum burst size (tokens in bucket)
 	CleanupInterval   time.Duration // How often to clean up expired entries
+	Mode              string        // RateLimitReject (default) or RateLimitDelay
+	MaxDelay          time.Duration // Longest a request is held in RateLimitDelay mode
 }
 
 // DefaultRateLimiterConfig returns sensible defaults for rate limiting.
@@ -18,16 +45,22 @@ func DefaultRateLimiterConfig() *RateLimiterConfig {
 		RequestsPerSecond: 10,               // 10 requests per second per client
 		BurstSize:         20,               // Allow bursts up to 20 requests
 		CleanupInterval:   5 * time.Minute,  // Clean up every 5 minutes
+		Mode:              RateLimitReject,
+		MaxDelay:          500 * time.Millisecond,
 	}
 }
 
 // TokenBucket represents a token bucket for a single client.
 type TokenBucket struct {
-	tokens    float64   // Current number of tokens
-	capacity  float64   // Maximum capacity
-	refillRate float64  // Tokens per second
-	lastRefill time.Time // Last time bucket was refilled
-	mutex     sync.Mutex // Protects bucket state
+	tokens       float64     // Current number of tokens
+	capacity     float64     // Maximum capacity
+	refillRate   float64     // Tokens per second
+	lastRefill   time.Time   // Last time bucket was refilled
+	mutex        sync.Mutex  // Protects bucket state
+	clock        clock.Clock // Time source for refills
+	allowed      int64       // Requests allowed
+	rejected     int64       // Requests rejected for lack of tokens
+	lastRejected time.Time   // Last time a request was rejected
 }
 
 // NewTokenBucket creates a new token bucket with the specified parameters.
@@ -37,15 +70,23 @@ func NewTokenBucket(capacity float64, refillRate float64) *TokenBucket {
 		capacity:   capacity,
 		refillRate: refillRate,
 		lastRefill: time.Now(),
+		clock:      clock.Real,
 	}
 }
 
 // Allow checks if a request should be allowed and consumes a token if so.
 func (tb *TokenBucket) Allow() bool {
+	return tb.Reserve(0).Allowed
+}
+
+// Reserve consumes a token for a request. When none is left it borrows the
+// next one if it refills within maxWait, and the request must wait Delay
+// before it proceeds; otherwise the request is rejected.
+func (tb *TokenBucket) Reserve(maxWait time.Duration) RateLimitDecision {
 	tb.mutex.Lock()
 	defer tb.mutex.Unlock()
 
-	now := time.Now()
+	now := tb.clock.Now()
 	elapsed := now.Sub(tb.lastRefill).Seconds()
 	
 	// Refill tokens based on elapsed time
@@ -55,21 +96,94 @@ func (tb *TokenBucket) Allow() bool {
 	}
 	tb.lastRefill = now
 
+	decision := RateLimitDecision{}
+
 	// Check if we have tokens available
 	if tb.tokens >= 1.0 {
 		tb.tokens -= 1.0
-		return true
+		tb.allowed++
+		decision.Allowed = true
+	} else if wait := tb.untilTokens(1.0); maxWait > 0 && wait <= maxWait {
+		// Borrow the next token; the bucket stays in debt until it refills
+		tb.tokens -= 1.0
+		tb.allowed++
+		decision.Allowed = true
+		decision.Delay = wait
+	} else {
+		tb.rejected++
+		tb.lastRejected = now
+		decision.Info.RetryAfterMs = wait.Milliseconds()
 	}
 
-	return false
+	decision.Info.Limit = int(tb.capacity)
+	if tb.tokens > 0 {
+		decision.Info.Remaining = int(tb.tokens)
+	}
+	decision.Info.ResetMs = tb.untilTokens(tb.capacity).Milliseconds()
+	return decision
+}
+
+// resize changes the capacity and refill rate of the bucket, keeping the
+// tokens it has left (up to the new capacity)
+func (tb *TokenBucket) resize(capacity float64, refillRate float64) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	// Credit the time elapsed at the old rate before switching
+	now := tb.clock.Now()
+	tb.tokens += now.Sub(tb.lastRefill).Seconds() * tb.refillRate
+	tb.lastRefill = now
+
+	tb.capacity = capacity
+	tb.refillRate = refillRate
+	if tb.tokens > tb.capacity {
+		tb.tokens = tb.capacity
+	}
+}
+
+// untilTokens returns how long the bucket takes to refill to n tokens
+func (tb *TokenBucket) untilTokens(n float64) time.Duration {
+	if tb.tokens >= n {
+		return 0
+	}
+	if tb.refillRate <= 0 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration((n - tb.tokens) / tb.refillRate * float64(time.Second))
+}
+
+// stats returns the bucket's current budget and counters without consuming
+// a token
+func (tb *TokenBucket) stats(clientIP string) ClientRateStats {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	tokens := tb.tokens + tb.clock.Now().Sub(tb.lastRefill).Seconds()*tb.refillRate
+	if tokens > tb.capacity {
+		tokens = tb.capacity
+	}
+	if tokens < 0 {
+		tokens = 0 // Tokens borrowed by delayed requests
+	}
+	return ClientRateStats{
+		ClientIP:     clientIP,
+		Tokens:       tokens,
+		Allowed:      tb.allowed,
+		Rejected:     tb.rejected,
+		LastRejected: tb.lastRejected,
+	}
 }
 
 // RateLimiter manages rate limiting for multiple clients using token buckets.
 type RateLimiter struct {
-	config  *RateLimiterConfig
-	buckets map[string]*TokenBucket
-	mutex   sync.RWMutex
-	stopCh  chan struct{}
+	config   *RateLimiterConfig
+	buckets  map[string]*TokenBucket
+	mutex    sync.RWMutex
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	clock    clock.Clock // Time source for refills and cleanup
+	allowed  int64       // Requests allowed since the limiter was created (atomic)
+	rejected int64       // Requests rejected since the limiter was created (atomic)
 }
 
 // NewRateLimiter creates a new rate limiter with the specified configuration.
@@ -82,16 +196,56 @@ func NewRateLimiter(config *RateLimiterConfig) *RateLimiter {
 		config:  config,
 		buckets: make(map[string]*TokenBucket),
 		stopCh:  make(chan struct{}),
+		clock:   clock.Real,
 	}
 
 	// Start cleanup goroutine
-	go rl.cleanup()
+	go rl.cleanup(config.CleanupInterval)
 
 	return rl
 }
 
 // Allow checks if a request from the given client should be allowed.
 func (rl *RateLimiter) Allow(clientIP string) bool {
+	return rl.reserve(clientIP, 0).Allowed
+}
+
+// Reserve checks if a request from the given client should be allowed. In
+// RateLimitDelay mode a client out of tokens is allowed when a token
+// refills within MaxDelay, and the request must wait Delay first.
+func (rl *RateLimiter) Reserve(clientIP string) RateLimitDecision {
+	rl.mutex.RLock()
+	maxWait := time.Duration(0)
+	if rl.config.Mode == RateLimitDelay {
+		maxWait = rl.config.MaxDelay
+	}
+	rl.mutex.RUnlock()
+	return rl.reserve(clientIP, maxWait)
+}
+
+// SetConfig changes the limits of a running rate limiter. Known clients keep
+// their buckets, with the tokens they have left capped at the new burst
+// size, and their counters. The cleanup interval stays the one the limiter
+// was created with.
+func (rl *RateLimiter) SetConfig(config *RateLimiterConfig) {
+	if config == nil {
+		config = DefaultRateLimiterConfig()
+	}
+	updated := *config
+
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	updated.CleanupInterval = rl.config.CleanupInterval
+	rl.config = &updated
+	for _, bucket := range rl.buckets {
+		bucket.resize(float64(updated.BurstSize), float64(updated.RequestsPerSecond))
+	}
+}
+
+// reserve consumes a token from the client's bucket, waiting up to maxWait
+// for one
+func (rl *RateLimiter) reserve(clientIP string, maxWait time.Duration) RateLimitDecision {
 	if clientIP == "" {
 		clientIP = "unknown"
 	}
@@ -110,17 +264,34 @@ func (rl *RateLimiter) Allow(clientIP string) bool {
 				float64(rl.config.BurstSize),
 				float64(rl.config.RequestsPerSecond),
 			)
+			bucket.clock = rl.clock
+			bucket.lastRefill = rl.clock.Now()
 			rl.buckets[clientIP] = bucket
 		}
 		rl.mutex.Unlock()
 	}
 
-	return bucket.Allow()
+	decision := bucket.Reserve(maxWait)
+	if !decision.Allowed {
+		atomic.AddInt64(&rl.rejected, 1)
+	} else {
+		atomic.AddInt64(&rl.allowed, 1)
+	}
+	return decision
+}
+
+// SetClock replaces the time source used for refills and cleanup (for
+// tests). Buckets of known clients are dropped so every bucket uses it.
+func (rl *RateLimiter) SetClock(c clock.Clock) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+	rl.clock = clock.OrReal(c)
+	rl.buckets = make(map[string]*TokenBucket)
 }
 
 // cleanup periodically removes inactive buckets to prevent memory leaks.
-func (rl *RateLimiter) cleanup() {
-	ticker := time.NewTicker(rl.config.CleanupInterval)
+func (rl *RateLimiter) cleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
 	for {
@@ -138,7 +309,7 @@ func (rl *RateLimiter) performCleanup() {
 	rl.mutex.Lock()
 	defer rl.mutex.Unlock()
 
-	now := time.Now()
+	now := rl.clock.Now()
 	cutoff := 10 * time.Minute // Remove buckets inactive for 10+ minutes
 
 	for clientIP, bucket := range rl.buckets {
@@ -154,24 +325,83 @@ func (rl *RateLimiter) performCleanup() {
 
 // Stop shuts down the rate limiter and stops background cleanup.
 func (rl *RateLimiter) Stop() {
-	close(rl.stopCh)
+	rl.stopOnce.Do(func() {
+		close(rl.stopCh)
+	})
 }
 
-// GetStats returns current rate limiter statistics.
+// GetStats returns current rate limiter statistics, with the clients that
+// had the most requests rejected first.
 func (rl *RateLimiter) GetStats() RateLimiterStats {
 	rl.mutex.RLock()
 	defer rl.mutex.RUnlock()
 
+	clients := make([]ClientRateStats, 0, len(rl.buckets))
+	for clientIP, bucket := range rl.buckets {
+		clients = append(clients, bucket.stats(clientIP))
+	}
+	sort.Slice(clients, func(i, j int) bool {
+		if clients[i].Rejected != clients[j].Rejected {
+			return clients[i].Rejected > clients[j].Rejected
+		}
+		return clients[i].ClientIP < clients[j].ClientIP
+	})
+
 	return RateLimiterStats{
 		ActiveClients:     len(rl.buckets),
 		RequestsPerSecond: rl.config.RequestsPerSecond,
 		BurstSize:         rl.config.BurstSize,
+		Allowed:           atomic.LoadInt64(&rl.allowed),
+		Rejected:          atomic.LoadInt64(&rl.rejected),
+		Clients:           clients,
 	}
 }
 
+// TopOffenders returns up to n clients that had requests rejected, the ones
+// with the most rejections first.
+func (s RateLimiterStats) TopOffenders(n int) []ClientRateStats {
+	offenders := make([]ClientRateStats, 0, n)
+	for _, client := range s.Clients {
+		if client.Rejected == 0 || len(offenders) == n {
+			break
+		}
+		offenders = append(offenders, client)
+	}
+	return offenders
+}
+
+// RateLimitDecision is the outcome of a rate limit check
+type RateLimitDecision struct {
+	Allowed bool          // The request may proceed
+	Delay   time.Duration // Time the request must wait before it proceeds (RateLimitDelay mode)
+	Info    RateLimitInfo // Budget left, sent to the client with the response
+}
+
+// RateLimitInfo describes the client's rate limit budget in RPCResponse,
+// like the RateLimit-* headers of HTTP APIs
+type RateLimitInfo struct {
+	Limit        int   `json:"limit"`                  // Requests the client can make in a burst
+	Remaining    int   `json:"remaining"`              // Requests the client can make right away
+	ResetMs      int64 `json:"resetMs"`                // Time until the whole burst is available again
+	RetryAfterMs int64 `json:"retryAfterMs,omitempty"` // Time until the next request would be allowed (rejected requests only)
+}
+
 // RateLimiterStats contains statistics about the rate limiter.
 type RateLimiterStats struct {
-	ActiveClients     int // Number of clients with active buckets
-	RequestsPerSecond int // Configured requests per second limit
-	BurstSize         int // Configured burst size limit
+	ActiveClients     int               // Number of clients with active buckets
+	RequestsPerSecond int               // Configured requests per second limit
+	BurstSize         int               // Configured burst size limit
+	Allowed           int64             // Requests allowed since the limiter was configured
+	Rejected          int64             // Requests rejected since the limiter was configured
+	Clients           []ClientRateStats // Clients with active buckets, most rejected first
+}
+
+// ClientRateStats contains the rate limit budget of a client. Clients idle
+// for 10 minutes are forgotten with their counters.
+type ClientRateStats struct {
+	ClientIP     string    `json:"client_ip"`
+	Tokens       float64   `json:"tokens"`        // Requests the client can make right away
+	Allowed      int64     `json:"allowed"`       // Requests allowed
+	Rejected     int64     `json:"rejected"`      // Requests rejected for lack of tokens
+	LastRejected time.Time `json:"last_rejected"` // Last rejection (zero if none)
 }
\ No newline at end of file
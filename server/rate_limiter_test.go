@@ -0,0 +1,54 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lordbasex/burrowctl/clock/clocktest"
+)
+
+func TestRateLimiterRefill(t *testing.T) {
+	fake := clocktest.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	limiter := NewRateLimiter(&RateLimiterConfig{
+		RequestsPerSecond: 2,
+		BurstSize:         3,
+		CleanupInterval:   time.Minute,
+	})
+	defer limiter.Stop()
+	limiter.SetClock(fake)
+
+	allowed := func(n int) int {
+		count := 0
+		for i := 0; i < n; i++ {
+			if limiter.Allow("10.0.0.1") {
+				count++
+			}
+		}
+		return count
+	}
+
+	if got := allowed(5); got != 3 {
+		t.Fatalf("%d requests allowed from a full bucket, want the burst of 3", got)
+	}
+
+	// Two tokens per second: one refills every 500ms
+	fake.Advance(499 * time.Millisecond)
+	if got := allowed(1); got != 0 {
+		t.Fatal("token refilled early")
+	}
+	fake.Advance(time.Millisecond)
+	if got := allowed(2); got != 1 {
+		t.Fatalf("%d requests allowed after 500ms, want 1", got)
+	}
+
+	// Refills stop at the burst size
+	fake.Advance(time.Hour)
+	if got := allowed(5); got != 3 {
+		t.Fatalf("%d requests allowed after an hour idle, want the burst of 3", got)
+	}
+
+	stats := limiter.GetStats()
+	if stats.Allowed != 7 || stats.Rejected != 6 {
+		t.Fatalf("allowed=%d rejected=%d, want 7 and 6", stats.Allowed, stats.Rejected)
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ErrReplayRejected is the RPCResponse.ErrorCode of requests rejected by
+// replay protection: a nonce seen before, a timestamp outside the window,
+// no nonce at all, a missing or invalid signature, or a nonce that could not
+// be checked against the storage
+const ErrReplayRejected = "REPLAY_REJECTED"
+
+// noncesNamespace is the Storage namespace of the nonces seen
+const noncesNamespace = "nonces"
+
+// Request scopes accepted by ReplayProtectionConfig.Scope
+const (
+	ReplayScopeWrites = "writes" // Commands, functions, jobs and writes
+	ReplayScopeAll    = "all"    // Every request but heartbeats
+)
+
+// ReplayProtectionConfig rejects requests captured and published again.
+// Clients stamp every request with a random nonce and the time it was
+// sent, and sign the request, nonce and timestamp included, with a key
+// shared with the server; the server accepts a request only if its
+// signature is valid, its timestamp is within Window of the server clock
+// and its nonce was not seen in the last 2×Window. Nonces are kept in the
+// storage, so a shared MySQL storage extends the protection across the
+// instances of a cluster.
+type ReplayProtectionConfig struct {
+	Enabled    bool          // Check the signatures, nonces and timestamps of requests
+	Window     time.Duration // Accepted age and clock skew of request timestamps
+	Scope      string        // Requests checked: "writes" (default) or "all"
+	SigningKey string        // Key of the HMAC-SHA256 request signatures (required when enabled)
+}
+
+// DefaultReplayProtectionConfig returns a disabled replay protection
+// configuration
+func DefaultReplayProtectionConfig() ReplayProtectionConfig {
+	return ReplayProtectionConfig{
+		Enabled: false,
+		Window:  5 * time.Minute,
+		Scope:   ReplayScopeWrites,
+	}
+}
+
+// SetReplayProtectionConfig configures the checking of request nonces
+func (h *Handler) SetReplayProtectionConfig(config ReplayProtectionConfig) error {
+	switch config.Scope {
+	case "":
+		config.Scope = ReplayScopeWrites
+	case ReplayScopeWrites, ReplayScopeAll:
+	default:
+		return fmt.Errorf("invalid replay protection scope '%s': must be %s or %s", config.Scope, ReplayScopeWrites, ReplayScopeAll)
+	}
+	if config.Window <= 0 {
+		config.Window = DefaultReplayProtectionConfig().Window
+	}
+	if config.Enabled && config.SigningKey == "" {
+		return fmt.Errorf("replay protection needs a signing key shared with the clients: an unsigned nonce can be replaced in a replayed request")
+	}
+
+	h.replayProtection = config
+	log.Printf("[server] Replay protection: enabled=%v window=%s scope=%s", config.Enabled, config.Window, config.Scope)
+	return nil
+}
+
+// checkReplay rejects a request that is not signed with the signing key,
+// whose nonce was already used or whose timestamp is outside the window.
+// A message the broker redelivered keeps its nonce; it is let through to
+// the redelivery handling when the nonce was recorded for the same
+// delivery. Requests whose nonce cannot be looked up or recorded are
+// rejected too.
+func (h *Handler) checkReplay(msg amqp.Delivery, req RPCRequest) error {
+	config := h.replayProtection
+	if !config.Enabled || req.Type == "heartbeat_ping" {
+		return nil
+	}
+	if config.Scope == ReplayScopeWrites && !isWriteRequest(req) {
+		return nil
+	}
+
+	if req.Nonce == "" || req.Timestamp == 0 {
+		return fmt.Errorf("request has no nonce and timestamp (upgrade the client or use protocol version 2)")
+	}
+	if err := verifyRequestSignature([]byte(config.SigningKey), msg.Body, req.Signature); err != nil {
+		return err
+	}
+	sent := time.UnixMilli(req.Timestamp)
+	if skew := time.Since(sent); skew > config.Window || skew < -config.Window {
+		return fmt.Errorf("request timestamp %s is outside the %s window", sent.UTC().Format(time.RFC3339), config.Window)
+	}
+
+	// Serialize lookups so two copies of a request cannot both pass
+	h.nonceMutex.Lock()
+	defer h.nonceMutex.Unlock()
+
+	ctx := context.Background()
+	storage := h.deliveryStorage()
+	key := deliveryKey(msg)
+	value, found, err := storage.Get(ctx, noncesNamespace, req.Nonce)
+	if err != nil {
+		log.Printf("[server] Failed to look up nonce of request %s: %v", msg.CorrelationId, err)
+		return fmt.Errorf("request nonce could not be checked")
+	}
+	if found {
+		if msg.Redelivered && string(value) == key {
+			return nil
+		}
+		return fmt.Errorf("request nonce was already used")
+	}
+	if err := storage.Put(ctx, noncesNamespace, req.Nonce, []byte(key), 2*config.Window); err != nil {
+		log.Printf("[server] Failed to record nonce of request %s: %v", msg.CorrelationId, err)
+		return fmt.Errorf("request nonce could not be recorded")
+	}
+	return nil
+}
+
+// verifyRequestSignature checks the signature of a request body: the hex
+// HMAC-SHA256, keyed with key, of the body without its signature field,
+// serialized as a JSON object with sorted keys and no insignificant
+// whitespace (what encoding/json produces for a map)
+func verifyRequestSignature(key, body []byte, signature string) error {
+	if signature == "" {
+		return fmt.Errorf("request is not signed (set the signing_key of the client DSN)")
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return fmt.Errorf("request body is not a JSON object")
+	}
+	delete(fields, "signature")
+	signed, err := json.Marshal(fields)
+	if err != nil {
+		return fmt.Errorf("request body could not be serialized: %v", err)
+	}
+
+	mac := hmac.New(sha256.New, key)
+	mac.Write(signed)
+	received, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(received, mac.Sum(nil)) {
+		return fmt.Errorf("request signature is invalid")
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package server
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	_ "github.com/lordbasex/burrowctl/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+const testSigningKey = "replay-test-key"
+
+func TestCheckReplay(t *testing.T) {
+	newHandler := func(t *testing.T, storage Storage) *Handler {
+		h := newReloadTestHandler(t)
+		h.SetStorage(storage)
+		err := h.SetReplayProtectionConfig(ReplayProtectionConfig{
+			Enabled:    true,
+			Window:     time.Minute,
+			Scope:      ReplayScopeAll,
+			SigningKey: testSigningKey,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+	now := time.Now().UnixMilli()
+
+	tests := []struct {
+		name     string
+		fields   map[string]interface{}
+		key      string
+		tamper   func(fields map[string]interface{})
+		storage  *failingStorage
+		contains string // "" when the request is accepted
+	}{
+		{
+			name:   "signed",
+			fields: map[string]interface{}{"nonce": "n1", "timestamp": now},
+			key:    testSigningKey,
+		},
+		{
+			name:     "unsigned",
+			fields:   map[string]interface{}{"nonce": "n1", "timestamp": now},
+			contains: "not signed",
+		},
+		{
+			name:     "other key",
+			fields:   map[string]interface{}{"nonce": "n1", "timestamp": now},
+			key:      "another-key",
+			contains: "signature is invalid",
+		},
+		{
+			name:     "nonce replaced after signing",
+			fields:   map[string]interface{}{"nonce": "n1", "timestamp": now},
+			key:      testSigningKey,
+			tamper:   func(fields map[string]interface{}) { fields["nonce"] = "n2" },
+			contains: "signature is invalid",
+		},
+		{
+			name:     "timestamp replaced after signing",
+			fields:   map[string]interface{}{"nonce": "n1", "timestamp": now - 10*time.Minute.Milliseconds()},
+			key:      testSigningKey,
+			tamper:   func(fields map[string]interface{}) { fields["timestamp"] = now },
+			contains: "signature is invalid",
+		},
+		{
+			name:     "query replaced after signing",
+			fields:   map[string]interface{}{"nonce": "n1", "timestamp": now, "query": "SELECT 1"},
+			key:      testSigningKey,
+			tamper:   func(fields map[string]interface{}) { fields["query"] = "DELETE FROM items" },
+			contains: "signature is invalid",
+		},
+		{
+			name:     "timestamp outside the window",
+			fields:   map[string]interface{}{"nonce": "n1", "timestamp": now - 2*time.Minute.Milliseconds()},
+			key:      testSigningKey,
+			contains: "outside the 1m0s window",
+		},
+		{
+			name:     "nonce lookup fails",
+			fields:   map[string]interface{}{"nonce": "n1", "timestamp": now},
+			key:      testSigningKey,
+			storage:  &failingStorage{getErr: errors.New("connection refused")},
+			contains: "could not be checked",
+		},
+		{
+			name:     "nonce cannot be recorded",
+			fields:   map[string]interface{}{"nonce": "n1", "timestamp": now},
+			key:      testSigningKey,
+			storage:  &failingStorage{putErr: errors.New("read-only")},
+			contains: "could not be recorded",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &failingStorage{}
+			if tt.storage != nil {
+				storage = tt.storage
+			}
+			storage.MemoryStorage = NewMemoryStorage()
+			h := newHandler(t, storage)
+
+			msg, req := signedDelivery(t, tt.fields, tt.key, tt.tamper)
+			err := h.checkReplay(msg, req)
+			if tt.contains == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.contains)
+			}
+		})
+	}
+}
+
+func TestCheckReplayNonceReuse(t *testing.T) {
+	h := newReloadTestHandler(t)
+	err := h.SetReplayProtectionConfig(ReplayProtectionConfig{Enabled: true, Scope: ReplayScopeAll, SigningKey: testSigningKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fields := map[string]interface{}{"nonce": "n1", "timestamp": time.Now().UnixMilli()}
+	msg, req := signedDelivery(t, fields, testSigningKey, nil)
+	if err := h.checkReplay(msg, req); err != nil {
+		t.Fatalf("first delivery rejected: %v", err)
+	}
+
+	// The broker redelivering the same message is not a replay
+	redelivered := msg
+	redelivered.Redelivered = true
+	if err := h.checkReplay(redelivered, req); err != nil {
+		t.Fatalf("redelivery rejected: %v", err)
+	}
+
+	// The same signed request published again is
+	copied := msg
+	copied.CorrelationId = "q-other"
+	if err := h.checkReplay(copied, req); err == nil || !strings.Contains(err.Error(), "already used") {
+		t.Fatalf("replayed request got %v", err)
+	}
+}
+
+func TestReplayProtectionNeedsSigningKey(t *testing.T) {
+	h := newReloadTestHandler(t)
+	if err := h.SetReplayProtectionConfig(ReplayProtectionConfig{Enabled: true}); err == nil {
+		t.Fatal("replay protection enabled without a signing key")
+	}
+	if err := h.SetReplayProtectionConfig(ReplayProtectionConfig{Enabled: false}); err != nil {
+		t.Fatalf("disabled replay protection needs no key: %v", err)
+	}
+}
+
+// TestReplayProtectionClientSignatures checks that requests signed by the
+// client driver pass the server checks, over the in-memory transport
+func TestReplayProtectionClientSignatures(t *testing.T) {
+	h := NewHandler("replay-device", "mem://replay-protection-test", "", "open", nil)
+	h.RegisterFunction("hello", func(name string) string { return "hi " + name })
+	err := h.SetReplayProtectionConfig(ReplayProtectionConfig{Enabled: true, Scope: ReplayScopeAll, SigningKey: testSigningKey})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go h.Start(ctx)
+
+	call := func(t *testing.T, options string) error {
+		t.Helper()
+
+		db, err := sql.Open("rabbitsql", "deviceID=replay-device&amqp_uri=mem://replay-protection-test&timeout=5s&heartbeat_enabled=false"+options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer db.Close()
+
+		var greeting string
+		err = db.QueryRow(`FUNCTION:{"name":"hello","params":[{"type":"string","value":"there"}]}`).Scan(&greeting)
+		if err == nil && greeting != "hi there" {
+			t.Fatalf("unexpected result %q", greeting)
+		}
+		return err
+	}
+
+	if err := call(t, "&signing_key="+testSigningKey); err != nil {
+		t.Fatalf("signed request rejected: %v", err)
+	}
+	if err := call(t, ""); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Fatalf("unsigned request got %v", err)
+	}
+	if err := call(t, "&signing_key=another-key"); err == nil || !strings.Contains(err.Error(), "signature is invalid") {
+		t.Fatalf("request signed with another key got %v", err)
+	}
+}
+
+// signedDelivery returns a delivery of a request with fields, signed with
+// key unless it is empty, and changed by tamper after signing
+func signedDelivery(t *testing.T, fields map[string]interface{}, key string, tamper func(map[string]interface{})) (amqp.Delivery, RPCRequest) {
+	t.Helper()
+
+	fields["type"] = "function"
+	if key != "" {
+		unsigned, err := json.Marshal(fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(unsigned)
+		fields["signature"] = hex.EncodeToString(mac.Sum(nil))
+	}
+	if tamper != nil {
+		tamper(fields)
+	}
+
+	body, err := json.Marshal(fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req RPCRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	return amqp.Delivery{Body: body, CorrelationId: "q-1", ReplyTo: "reply"}, req
+}
+
+// failingStorage is a MemoryStorage whose Get and Put fail with the
+// configured errors
+type failingStorage struct {
+	*MemoryStorage
+	getErr error
+	putErr error
+}
+
+func (s *failingStorage) Get(ctx context.Context, namespace, key string) ([]byte, bool, error) {
+	if s.getErr != nil {
+		return nil, false, s.getErr
+	}
+	return s.MemoryStorage.Get(ctx, namespace, key)
+}
+
+func (s *failingStorage) Put(ctx context.Context, namespace, key string, value []byte, ttl time.Duration) error {
+	if s.putErr != nil {
+		return s.putErr
+	}
+	return s.MemoryStorage.Put(ctx, namespace, key, value, ttl)
+}
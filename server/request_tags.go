@@ -0,0 +1,30 @@
+package server
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxRequestTagLength is the longest request tag kept, in bytes
+const maxRequestTagLength = 128
+
+// sanitizeRequestTag makes a client-supplied tag safe to write into
+// key=value log lines: whitespace and control characters become '_' and
+// long tags are cut, so a tag cannot forge or break log entries.
+func sanitizeRequestTag(tag string) string {
+	if tag == "" {
+		return ""
+	}
+
+	var b strings.Builder
+	for _, r := range tag {
+		if unicode.IsSpace(r) || unicode.IsControl(r) || r == unicode.ReplacementChar {
+			r = '_'
+		}
+		if b.Len()+len(string(r)) > maxRequestTagLength {
+			break
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,164 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// maxPooledResponseBuffer is the largest buffer returned to the pool, so a
+// single huge result does not stay allocated
+const maxPooledResponseBuffer = 1 << 20
+
+// responseBuffers holds the buffers responses are encoded into
+var responseBuffers = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, 4096)
+		return &buf
+	},
+}
+
+// getResponseBuffer returns an empty buffer from the pool
+func getResponseBuffer() *[]byte {
+	return responseBuffers.Get().(*[]byte)
+}
+
+// putResponseBuffer returns a buffer to the pool once its contents were
+// published
+func putResponseBuffer(buf *[]byte) {
+	if cap(*buf) > maxPooledResponseBuffer {
+		return
+	}
+	*buf = (*buf)[:0]
+	responseBuffers.Put(buf)
+}
+
+// emptyResponsePrefix is how encoding/json starts a response without
+// columns and rows
+var emptyResponsePrefix = []byte(`{"columns":null,"rows":null,`)
+
+// appendResponse appends the JSON encoding of resp to buf. Columns and rows,
+// most of a SQL response, are written directly instead of through
+// reflection; the other fields are encoded by encoding/json. The result
+// decodes the same as json.Marshal(resp).
+func appendResponse(buf []byte, resp RPCResponse) ([]byte, error) {
+	columns, rows := resp.Columns, resp.Rows
+	resp.Columns, resp.Rows = nil, nil
+	rest, err := json.Marshal(resp)
+	if err != nil {
+		return buf, err
+	}
+	if !bytes.HasPrefix(rest, emptyResponsePrefix) {
+		resp.Columns, resp.Rows = columns, rows
+		rest, err = json.Marshal(resp)
+		return append(buf, rest...), err
+	}
+
+	buf = append(buf, `{"columns":`...)
+	if columns == nil {
+		buf = append(buf, "null"...)
+	} else {
+		buf = append(buf, '[')
+		for i, column := range columns {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			buf = appendJSONString(buf, column)
+		}
+		buf = append(buf, ']')
+	}
+
+	buf = append(buf, `,"rows":`...)
+	if rows == nil {
+		buf = append(buf, "null"...)
+	} else {
+		buf = append(buf, '[')
+		for i, row := range rows {
+			if i > 0 {
+				buf = append(buf, ',')
+			}
+			if row == nil {
+				buf = append(buf, "null"...)
+				continue
+			}
+			buf = append(buf, '[')
+			for j, value := range row {
+				if j > 0 {
+					buf = append(buf, ',')
+				}
+				if buf, err = appendJSONValue(buf, value); err != nil {
+					return buf, err
+				}
+			}
+			buf = append(buf, ']')
+		}
+		buf = append(buf, ']')
+	}
+
+	buf = append(buf, ',')
+	return append(buf, rest[len(emptyResponsePrefix):]...), nil
+}
+
+// appendJSONValue appends the JSON encoding of a result cell. The types SQL
+// results are converted to are written directly; others go through
+// encoding/json.
+func appendJSONValue(buf []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(buf, "null"...), nil
+	case string:
+		return appendJSONString(buf, v), nil
+	case int64:
+		return strconv.AppendInt(buf, v, 10), nil
+	case int:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case int32:
+		return strconv.AppendInt(buf, int64(v), 10), nil
+	case uint64:
+		return strconv.AppendUint(buf, v, 10), nil
+	case bool:
+		return strconv.AppendBool(buf, v), nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return buf, err
+	}
+	return append(buf, encoded...), nil
+}
+
+// appendJSONString appends s as a JSON string. Strings that need escaping
+// are encoded by encoding/json, so the escaping matches json.Marshal.
+func appendJSONString(buf []byte, s string) []byte {
+	nonASCII := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == '"' || c == '\\' || c == '<' || c == '>' || c == '&' {
+			return appendMarshaledString(buf, s)
+		}
+		if c >= utf8.RuneSelf {
+			nonASCII = true
+		}
+	}
+	if nonASCII && (!utf8.ValidString(s) || strings.ContainsAny(s, "\u2028\u2029")) {
+		return appendMarshaledString(buf, s)
+	}
+	buf = append(buf, '"')
+	buf = append(buf, s...)
+	return append(buf, '"')
+}
+
+// appendMarshaledString appends s encoded by encoding/json
+func appendMarshaledString(buf []byte, s string) []byte {
+	encoded, _ := json.Marshal(s)
+	return append(buf, encoded...)
+}
+
+// EncodeResponse encodes resp as the handler publishes it in answer to req,
+// adapted to the column types and layout req asked for. Tools and
+// benchmarks use it to exercise the response path without a broker.
+func EncodeResponse(resp RPCResponse, req RPCRequest) ([]byte, error) {
+	return appendResponse(nil, responseFor(resp, req))
+}
@@ -0,0 +1,137 @@
+package server
+
+import (
+	"log"
+)
+
+// ResponseLimitConfig caps the size of SQL, function and command results.
+//
+// A SELECT without a WHERE clause on a large table would otherwise be read
+// into memory and marshaled whole. When a limit is reached the remaining
+// rows are counted but not kept, and the response is marked Truncated with
+// the total row count, so the client can tell a partial result from a
+// complete one.
+type ResponseLimitConfig struct {
+	MaxRows  int // Rows returned per response (0 = unlimited)
+	MaxBytes int // Approximate JSON size of the rows per response (0 = unlimited)
+}
+
+// DefaultResponseLimitConfig returns the default response limits (none)
+func DefaultResponseLimitConfig() ResponseLimitConfig {
+	return ResponseLimitConfig{}
+}
+
+// enabled reports whether any limit is set
+func (rl ResponseLimitConfig) enabled() bool {
+	return rl.MaxRows > 0 || rl.MaxBytes > 0
+}
+
+// SetResponseLimits sets the maximum size of results. Negative limits are
+// treated as unlimited.
+func (h *Handler) SetResponseLimits(config ResponseLimitConfig) {
+	if config.MaxRows < 0 {
+		config.MaxRows = 0
+	}
+	if config.MaxBytes < 0 {
+		config.MaxBytes = 0
+	}
+	h.responseLimits = config
+	if config.enabled() {
+		log.Printf("[server] Response limits: max rows=%d max bytes=%d", config.MaxRows, config.MaxBytes)
+	}
+}
+
+// rowBudget admits rows into a response until a limit is reached and
+// counts the rest
+type rowBudget struct {
+	limits    ResponseLimitConfig
+	rows      int   // Rows admitted
+	bytes     int   // Approximate size of the rows admitted
+	total     int64 // Rows seen, admitted or not
+	truncated bool  // A limit was reached
+}
+
+// budget returns a fresh budget for one response
+func (rl ResponseLimitConfig) budget() *rowBudget {
+	return &rowBudget{limits: rl}
+}
+
+// full reports whether further rows will only be counted
+func (b *rowBudget) full() bool {
+	return b.truncated
+}
+
+// skip counts a row that is not read because the response is full
+func (b *rowBudget) skip() {
+	b.total++
+}
+
+// admit counts row and reports whether it fits in the response
+func (b *rowBudget) admit(row []interface{}) bool {
+	b.total++
+	if b.truncated {
+		return false
+	}
+
+	size := rowSize(row)
+	if (b.limits.MaxRows > 0 && b.rows >= b.limits.MaxRows) ||
+		(b.limits.MaxBytes > 0 && b.bytes+size > b.limits.MaxBytes) {
+		b.truncated = true
+		return false
+	}
+	b.rows++
+	b.bytes += size
+	return true
+}
+
+// mark sets the truncation metadata of resp
+func (b *rowBudget) mark(resp *RPCResponse) {
+	if b.truncated {
+		resp.Truncated = true
+		resp.TotalRows = b.total
+	}
+}
+
+// limitResponse truncates a result that was built without a budget
+// (function results, command output, cached SQL results)
+func (h *Handler) limitResponse(resp RPCResponse) RPCResponse {
+	if !h.responseLimits.enabled() || resp.Truncated {
+		return resp
+	}
+
+	budget := h.responseLimits.budget()
+	for i, row := range resp.Rows {
+		if !budget.admit(row) {
+			resp.Truncated = true
+			resp.TotalRows = int64(len(resp.Rows))
+			resp.Rows = resp.Rows[:i]
+			break
+		}
+	}
+	return resp
+}
+
+// rowSize approximates the JSON size of row without encoding it
+func rowSize(row []interface{}) int {
+	size := len(row) + 1 // Brackets and separators
+	for _, value := range row {
+		size += valueSize(value)
+	}
+	return size
+}
+
+// valueSize approximates the JSON size of a result value
+func valueSize(value interface{}) int {
+	switch v := value.(type) {
+	case nil:
+		return 4
+	case string:
+		return len(v) + 2
+	case []byte:
+		return (len(v)+2)/3*4 + 2 // Base64 in quotes
+	case bool:
+		return 5
+	default:
+		return 20
+	}
+}
@@ -0,0 +1,175 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// ResponseConfirmConfig controls publisher confirms for RPC responses.
+//
+// Without confirms a response the broker fails to take is lost and the
+// client waits for its timeout. With confirms every response is published
+// as mandatory and waited for; publishes the broker does not confirm are
+// retried, on a fresh channel if the response channel was closed, and
+// responses whose reply queue no longer exists (the client gave up or
+// disconnected) are logged.
+type ResponseConfirmConfig struct {
+	Enabled    bool          // Wait for the broker to confirm every response
+	Timeout    time.Duration // How long to wait for a confirm before retrying
+	Retries    int           // Publish attempts after the first one
+	RetryDelay time.Duration // Pause between attempts
+}
+
+// DefaultResponseConfirmConfig returns the default response confirm configuration
+func DefaultResponseConfirmConfig() ResponseConfirmConfig {
+	return ResponseConfirmConfig{
+		Enabled:    true,
+		Timeout:    5 * time.Second,
+		Retries:    3,
+		RetryDelay: 200 * time.Millisecond,
+	}
+}
+
+// ResponseStats counts the outcome of published responses
+type ResponseStats struct {
+	Confirmed     int64 `json:"confirmed"`     // Responses the broker confirmed
+	Retried       int64 `json:"retried"`       // Publish attempts repeated after a failure
+	Failed        int64 `json:"failed"`        // Responses given up on after every attempt
+	Undeliverable int64 `json:"undeliverable"` // Responses returned because the reply queue is gone
+}
+
+// responseStats holds the counters behind ResponseStats
+type responseStats struct {
+	confirmed     int64
+	retried       int64
+	failed        int64
+	undeliverable int64
+}
+
+// SetResponseConfirmConfig sets how responses are confirmed. It must be
+// called before Start.
+func (h *Handler) SetResponseConfirmConfig(config ResponseConfirmConfig) {
+	defaults := DefaultResponseConfirmConfig()
+	if config.Timeout <= 0 {
+		config.Timeout = defaults.Timeout
+	}
+	if config.Retries < 0 {
+		config.Retries = 0
+	}
+	if config.RetryDelay < 0 {
+		config.RetryDelay = 0
+	}
+	h.responseConfirms = config
+}
+
+// GetResponseStats returns the response publishing counters
+func (h *Handler) GetResponseStats() ResponseStats {
+	return ResponseStats{
+		Confirmed:     atomic.LoadInt64(&h.responseStats.confirmed),
+		Retried:       atomic.LoadInt64(&h.responseStats.retried),
+		Failed:        atomic.LoadInt64(&h.responseStats.failed),
+		Undeliverable: atomic.LoadInt64(&h.responseStats.undeliverable),
+	}
+}
+
+// enableResponseConfirms puts ch in confirm mode and logs the responses the
+// broker returns as unroutable
+func (h *Handler) enableResponseConfirms(ch *amqp.Channel) error {
+	if !h.responseConfirms.Enabled {
+		return nil
+	}
+	if err := ch.Confirm(false); err != nil {
+		return fmt.Errorf("failed to enable publisher confirms: %w", err)
+	}
+	go h.logUndeliverableResponses(ch.NotifyReturn(make(chan amqp.Return, 16)))
+	return nil
+}
+
+// logUndeliverableResponses logs responses whose reply queue is gone until
+// the channel closes
+func (h *Handler) logUndeliverableResponses(returns <-chan amqp.Return) {
+	for ret := range returns {
+		atomic.AddInt64(&h.responseStats.undeliverable, 1)
+		log.Printf("[server] Response %s undeliverable: %d %s (reply queue '%s' is gone)",
+			ret.CorrelationId, ret.ReplyCode, ret.ReplyText, ret.RoutingKey)
+	}
+}
+
+// publishResponse publishes a response to replyTo. With confirms enabled it
+// waits for the broker to take it, retrying when it does not.
+func (h *Handler) publishResponse(ch *amqp.Channel, replyTo string, publishing amqp.Publishing) {
+	if h.transport != nil {
+		h.replyTransport(replyTo, publishing)
+		return
+	}
+
+	config := h.responseConfirms
+	if !config.Enabled {
+		ch.PublishWithContext(context.Background(), "", replyTo, false, false, publishing)
+		return
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := h.publishAttempt(ch, replyTo, publishing, config.Timeout)
+		if err == nil {
+			atomic.AddInt64(&h.responseStats.confirmed, 1)
+			return
+		}
+		if attempt >= config.Retries {
+			atomic.AddInt64(&h.responseStats.failed, 1)
+			log.Printf("[server] Response %s to '%s' lost after %d attempts: %v",
+				publishing.CorrelationId, replyTo, attempt+1, err)
+			return
+		}
+
+		atomic.AddInt64(&h.responseStats.retried, 1)
+		log.Printf("[server] Response %s not confirmed, retrying: %v", publishing.CorrelationId, err)
+		time.Sleep(config.RetryDelay)
+	}
+}
+
+// publishAttempt publishes a response and waits for its confirm. The broker
+// closes the channel on some failures; the attempt then runs on a channel
+// of its own, closed when the attempt is over.
+func (h *Handler) publishAttempt(ch *amqp.Channel, replyTo string, publishing amqp.Publishing, timeout time.Duration) error {
+	if ch.IsClosed() {
+		fresh, err := h.conn.Channel()
+		if err != nil {
+			return err
+		}
+		defer fresh.Close()
+		if err := fresh.Confirm(false); err != nil {
+			return err
+		}
+		ch = fresh
+	}
+	return confirmPublish(ch, replyTo, publishing, timeout)
+}
+
+// confirmPublish publishes a mandatory message and waits for its confirm
+func confirmPublish(ch *amqp.Channel, replyTo string, publishing amqp.Publishing, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	confirm, err := ch.PublishWithDeferredConfirmWithContext(ctx, "", replyTo, true, false, publishing)
+	if err != nil {
+		return err
+	}
+	if confirm == nil {
+		// The channel is not in confirm mode
+		return nil
+	}
+	acked, err := confirm.WaitContext(ctx)
+	if err != nil {
+		return fmt.Errorf("no confirm within %s", timeout)
+	}
+	if !acked {
+		return fmt.Errorf("broker rejected the response")
+	}
+	return nil
+}
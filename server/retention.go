@@ -0,0 +1,312 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RetentionRule declares how long rows of a table are kept
+type RetentionRule struct {
+	Table           string   `json:"table"`            // Table to prune (optionally schema.table)
+	TimestampColumn string   `json:"timestamp_column"` // DATETIME/TIMESTAMP column compared against the cutoff
+	MaxAge          Duration `json:"max_age"`          // Rows older than this are deleted
+	BatchSize       int      `json:"batch_size"`       // Rows deleted per statement (default 1000)
+}
+
+// RetentionConfig holds configuration for on-device data retention
+type RetentionConfig struct {
+	Enabled    bool            `json:"enabled"`     // Whether the retention loop runs
+	Interval   Duration        `json:"interval"`    // Time between retention passes
+	MaxRuntime Duration        `json:"max_runtime"` // Runtime cap per pass; pruning resumes on the next pass
+	Pause      Duration        `json:"pause"`       // Pause between batches to let other queries through
+	Rules      []RetentionRule `json:"rules"`       // Retention rules
+}
+
+// DefaultRetentionConfig returns a disabled retention configuration
+func DefaultRetentionConfig() RetentionConfig {
+	return RetentionConfig{
+		Enabled:    false,
+		Interval:   Duration(1 * time.Hour),
+		MaxRuntime: Duration(5 * time.Minute),
+		Pause:      Duration(100 * time.Millisecond),
+	}
+}
+
+// LoadRetentionConfig reads a retention configuration from a JSON file.
+//
+// Example:
+//
+//	{
+//	  "enabled": true,
+//	  "interval": "30m",
+//	  "rules": [
+//	    {"table": "telemetry", "timestamp_column": "created_at", "max_age": "720h", "batch_size": 5000}
+//	  ]
+//	}
+func LoadRetentionConfig(path string) (RetentionConfig, error) {
+	config := DefaultRetentionConfig()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return config, fmt.Errorf("failed to read retention config: %w", err)
+	}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, fmt.Errorf("failed to parse retention config %s: %w", path, err)
+	}
+	return config, config.Validate()
+}
+
+// identifierPattern matches a plain or schema-qualified SQL identifier
+var identifierPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$]*(\.[A-Za-z_][A-Za-z0-9_$]*)?$`)
+
+// quoteIdentifier backtick-quotes a validated (optionally schema-qualified) identifier
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, ".", "`.`") + "`"
+}
+
+// Validate checks every rule
+func (rc RetentionConfig) Validate() error {
+	for i, rule := range rc.Rules {
+		if !identifierPattern.MatchString(rule.Table) {
+			return fmt.Errorf("retention rule %d: invalid table name %q", i, rule.Table)
+		}
+		if !identifierPattern.MatchString(rule.TimestampColumn) || strings.Contains(rule.TimestampColumn, ".") {
+			return fmt.Errorf("retention rule %d: invalid timestamp column %q", i, rule.TimestampColumn)
+		}
+		if rule.MaxAge <= 0 {
+			return fmt.Errorf("retention rule %d (%s): max_age must be positive", i, rule.Table)
+		}
+		if rule.BatchSize < 0 {
+			return fmt.Errorf("retention rule %d (%s): batch_size must not be negative", i, rule.Table)
+		}
+	}
+	return nil
+}
+
+// RetentionRuleStats holds progress and metrics for a retention rule
+type RetentionRuleStats struct {
+	Table        string        `json:"table"`
+	RowsDeleted  int64         `json:"rows_deleted"`     // Rows deleted since start
+	Batches      int64         `json:"batches"`          // DELETE statements executed since start
+	Runs         int64         `json:"runs"`             // Passes that processed this rule
+	LastRun      time.Time     `json:"last_run"`         // Start of the last pass
+	LastDuration time.Duration `json:"last_duration_ns"` // Time spent on the rule in the last pass
+	LastDeleted  int64         `json:"last_deleted"`     // Rows deleted in the last pass
+	LastCutoff   time.Time     `json:"last_cutoff"`      // Cutoff used in the last pass
+	CaughtUp     bool          `json:"caught_up"`        // Whether the last pass deleted everything past the cutoff
+	LastError    string        `json:"last_error,omitempty"`
+	LastErrorAt  time.Time     `json:"last_error_at,omitempty"`
+}
+
+// RetentionManager prunes old rows incrementally according to retention rules
+type RetentionManager struct {
+	handler *Handler
+	config  RetentionConfig
+
+	mutex   sync.Mutex
+	running bool
+	stats   map[string]*RetentionRuleStats // table -> stats
+	trigger chan struct{}
+}
+
+// NewRetentionManager creates a new retention manager
+func NewRetentionManager(handler *Handler, config RetentionConfig) *RetentionManager {
+	defaults := DefaultRetentionConfig()
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.MaxRuntime <= 0 {
+		config.MaxRuntime = defaults.MaxRuntime
+	}
+
+	stats := make(map[string]*RetentionRuleStats, len(config.Rules))
+	for i := range config.Rules {
+		if config.Rules[i].BatchSize == 0 {
+			config.Rules[i].BatchSize = 1000
+		}
+		stats[config.Rules[i].Table] = &RetentionRuleStats{Table: config.Rules[i].Table}
+	}
+
+	return &RetentionManager{
+		handler: handler,
+		config:  config,
+		stats:   stats,
+		trigger: make(chan struct{}, 1),
+	}
+}
+
+// run executes retention passes until ctx is cancelled
+func (rm *RetentionManager) run(ctx context.Context) {
+	if !rm.config.Enabled || len(rm.config.Rules) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(time.Duration(rm.config.Interval))
+	defer ticker.Stop()
+
+	log.Printf("[retention] Started with %d rules (interval %v)", len(rm.config.Rules), time.Duration(rm.config.Interval))
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			rm.runPass(ctx)
+		case <-rm.trigger:
+			rm.runPass(ctx)
+		}
+	}
+}
+
+// TriggerPass requests an immediate retention pass
+func (rm *RetentionManager) TriggerPass() error {
+	if !rm.config.Enabled {
+		return fmt.Errorf("retention is disabled")
+	}
+	select {
+	case rm.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// runPass processes every rule once within the runtime cap
+func (rm *RetentionManager) runPass(ctx context.Context) {
+	rm.mutex.Lock()
+	if rm.running {
+		rm.mutex.Unlock()
+		return
+	}
+	rm.running = true
+	rm.mutex.Unlock()
+
+	defer func() {
+		rm.mutex.Lock()
+		rm.running = false
+		rm.mutex.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, time.Duration(rm.config.MaxRuntime))
+	defer cancel()
+
+	for _, rule := range rm.config.Rules {
+		if ctx.Err() != nil {
+			log.Printf("[retention] Runtime cap reached, remaining rules continue next pass")
+			return
+		}
+		rm.pruneRule(ctx, rule)
+	}
+}
+
+// pruneRule deletes expired rows of one table in batches
+func (rm *RetentionManager) pruneRule(ctx context.Context, rule RetentionRule) {
+	start := time.Now()
+	cutoff := start.Add(-time.Duration(rule.MaxAge))
+	statement := fmt.Sprintf("DELETE FROM %s WHERE `%s` < ? ORDER BY `%s` LIMIT %d",
+		quoteIdentifier(rule.Table), rule.TimestampColumn, rule.TimestampColumn, rule.BatchSize)
+
+	var deleted, batches int64
+	caughtUp := false
+	var runErr error
+
+	db, release, err := rm.handler.acquireDB()
+	if err != nil {
+		runErr = err
+	} else {
+		defer release()
+		for ctx.Err() == nil {
+			result, err := db.ExecContext(ctx, statement, cutoff)
+			if err != nil {
+				if ctx.Err() == nil {
+					runErr = err
+				}
+				break
+			}
+			affected, _ := result.RowsAffected()
+			deleted += affected
+			batches++
+
+			if affected < int64(rule.BatchSize) {
+				caughtUp = true
+				break
+			}
+
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Duration(rm.config.Pause)):
+			}
+		}
+	}
+
+	rm.mutex.Lock()
+	stats := rm.stats[rule.Table]
+	stats.Runs++
+	stats.RowsDeleted += deleted
+	stats.Batches += batches
+	stats.LastRun = start
+	stats.LastDuration = time.Since(start)
+	stats.LastDeleted = deleted
+	stats.LastCutoff = cutoff
+	stats.CaughtUp = caughtUp
+	if runErr != nil {
+		stats.LastError = runErr.Error()
+		stats.LastErrorAt = time.Now()
+	}
+	rm.mutex.Unlock()
+
+	if runErr != nil {
+		log.Printf("[retention] %s: error after deleting %d rows: %v", rule.Table, deleted, runErr)
+	} else if deleted > 0 || !caughtUp {
+		log.Printf("[retention] %s: deleted %d rows older than %s in %d batches (caught up: %v)",
+			rule.Table, deleted, cutoff.Format(time.RFC3339), batches, caughtUp)
+	}
+}
+
+// Stats returns a snapshot of the per-rule metrics
+func (rm *RetentionManager) Stats() []RetentionRuleStats {
+	rm.mutex.Lock()
+	defer rm.mutex.Unlock()
+
+	result := make([]RetentionRuleStats, 0, len(rm.config.Rules))
+	for _, rule := range rm.config.Rules {
+		result = append(result, *rm.stats[rule.Table])
+	}
+	return result
+}
+
+// SetRetentionConfig configures on-device data retention and registers the
+// runRetention and getRetentionStats functions for remote control.
+func (h *Handler) SetRetentionConfig(config RetentionConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	h.retention = NewRetentionManager(h, config)
+
+	h.RegisterFunctionWithMetadata("runRetention", func() (string, error) {
+		if err := h.retention.TriggerPass(); err != nil {
+			return "", err
+		}
+		return "retention pass scheduled", nil
+	}, FunctionMetadata{Description: "Schedules an immediate retention pass"})
+	h.RegisterFunctionWithMetadata("getRetentionStats", func() map[string]interface{} {
+		h.retention.mutex.Lock()
+		running := h.retention.running
+		h.retention.mutex.Unlock()
+		return map[string]interface{}{
+			"enabled": h.retention.config.Enabled,
+			"running": running,
+			"rules":   h.retention.Stats(),
+		}
+	}, FunctionMetadata{Description: "Returns per-rule retention progress and metrics"})
+
+	log.Printf("[server] Retention configured: %d rules, enabled=%v", len(config.Rules), config.Enabled)
+	return nil
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// RiskAction is what happens to a validated query of a given risk level
+type RiskAction string
+
+const (
+	RiskAllow   RiskAction = "allow"   // Run queries that pass validation, block the others (default)
+	RiskWarn    RiskAction = "warn"    // Like allow, adding a warning that is logged when the query runs
+	RiskApprove RiskAction = "approve" // Hold queries until an operator approves or rejects them
+	RiskBlock   RiskAction = "block"   // Block queries even if they pass validation
+)
+
+// riskLevels maps the names used in configurations to risk levels
+var riskLevels = map[string]RiskLevel{
+	"low":      RiskLow,
+	"medium":   RiskMedium,
+	"high":     RiskHigh,
+	"critical": RiskCritical,
+}
+
+// ParseRiskActions parses comma-separated level=action pairs, such as
+// "medium=warn,high=approve,critical=block". Levels left out keep the
+// allow action.
+func ParseRiskActions(spec string) (map[RiskLevel]RiskAction, error) {
+	actions := make(map[RiskLevel]RiskAction)
+	for _, pair := range strings.Split(spec, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid risk action %q: expected level=action", pair)
+		}
+		level, ok := riskLevels[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			return nil, fmt.Errorf("unknown risk level %q (low, medium, high or critical)", name)
+		}
+		action := RiskAction(strings.ToLower(strings.TrimSpace(value)))
+		switch action {
+		case RiskAllow, RiskWarn, RiskApprove, RiskBlock:
+		default:
+			return nil, fmt.Errorf("unknown risk action %q (allow, warn, approve or block)", value)
+		}
+		actions[level] = action
+	}
+	return actions, nil
+}
+
+// formatRiskActions returns the level=action pairs of actions, for logs
+func formatRiskActions(actions map[RiskLevel]RiskAction) string {
+	levels := make([]RiskLevel, 0, len(actions))
+	for level := range actions {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+
+	pairs := make([]string, len(levels))
+	for i, level := range levels {
+		pairs[i] = fmt.Sprintf("%s=%s", level, actions[level])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// riskAction applies the action configured for the risk level of a
+// validation result. It returns the action when it changed the outcome:
+// RiskBlock for a valid query it blocked, RiskApprove for a query it held.
+func (v *SQLValidator) riskAction(result *ValidationResult) RiskAction {
+	switch v.config.RiskActions[result.Risk] {
+	case RiskWarn:
+		if result.Valid {
+			result.Warnings = append(result.Warnings, fmt.Sprintf("Risk level %s allowed with a warning", result.Risk))
+		}
+	case RiskApprove:
+		result.Valid = false
+		result.RequiresApproval = true
+		result.Errors = append(result.Errors, fmt.Sprintf("Risk level %s requires an operator's approval", result.Risk))
+		return RiskApprove
+	case RiskBlock:
+		if result.Valid {
+			result.Valid = false
+			result.Errors = append(result.Errors, fmt.Sprintf("Risk level %s is blocked by policy", result.Risk))
+			return RiskBlock
+		}
+	}
+	return RiskAllow
+}
@@ -0,0 +1,68 @@
+package server
+
+import "database/sql"
+
+// rowArenaRows is the number of rows whose cells are allocated together
+const rowArenaRows = 64
+
+// cellScanner converts a column value while it is scanned. The driver's
+// buffer is read in place, instead of database/sql copying it into a new
+// interface{} first.
+type cellScanner struct {
+	handler *Handler
+	colType *sql.ColumnType
+	binary  bool
+	value   interface{}
+}
+
+// Scan implements sql.Scanner
+func (c *cellScanner) Scan(src interface{}) error {
+	if c.binary {
+		c.value = encodeBinaryValue(src)
+	} else {
+		c.value = c.handler.convertDatabaseValue(src, c.colType)
+	}
+	return nil
+}
+
+// rowScanner reads the rows of a result set into response rows. Its scan
+// destinations are reused from row to row, and the cells of rowArenaRows
+// rows are allocated at once.
+type rowScanner struct {
+	cells []cellScanner
+	dest  []interface{}
+	arena []interface{}
+}
+
+// newRowScanner creates a scanner for a result set with the given columns;
+// binary marks the columns whose values are sent base64-encoded
+func newRowScanner(h *Handler, colTypes []*sql.ColumnType, binary []bool) *rowScanner {
+	rs := &rowScanner{
+		cells: make([]cellScanner, len(colTypes)),
+		dest:  make([]interface{}, len(colTypes)),
+	}
+	for i := range rs.cells {
+		rs.cells[i] = cellScanner{handler: h, colType: colTypes[i], binary: binary[i]}
+		rs.dest[i] = &rs.cells[i]
+	}
+	return rs
+}
+
+// scan reads the current row of rows
+func (rs *rowScanner) scan(rows *sql.Rows) ([]interface{}, error) {
+	if err := rows.Scan(rs.dest...); err != nil {
+		return nil, err
+	}
+
+	n := len(rs.cells)
+	if len(rs.arena) < n {
+		rs.arena = make([]interface{}, n*rowArenaRows)
+	}
+	row := rs.arena[:n:n]
+	rs.arena = rs.arena[n:]
+	for i := range rs.cells {
+		row[i] = rs.cells[i].value
+		rs.cells[i].value = nil
+	}
+	return row, nil
+}
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lordbasex/burrowctl/clock"
+)
+
+// ScheduledTask is a recurring SQL statement or function call
+type ScheduledTask struct {
+	Name     string          `json:"name"`               // Unique task name
+	Schedule string          `json:"schedule"`           // Cron expression, see ParseCron
+	SQL      string          `json:"sql,omitempty"`      // Statement to execute
+	Function string          `json:"function,omitempty"` // Registered function to call instead of SQL
+	Params   []FunctionParam `json:"params,omitempty"`   // Function parameters
+	Timeout  Duration        `json:"timeout,omitempty"`  // Runtime cap (0 = SchedulerConfig.DefaultTimeout)
+}
+
+// SchedulerConfig holds configuration for recurring tasks
+type SchedulerConfig struct {
+	Tasks          []ScheduledTask
+	HistorySize    int           // Runs kept per task
+	DefaultTimeout time.Duration // Runtime cap for tasks without their own
+}
+
+// DefaultSchedulerConfig returns a scheduler configuration without tasks
+func DefaultSchedulerConfig() SchedulerConfig {
+	return SchedulerConfig{
+		HistorySize:    20,
+		DefaultTimeout: 10 * time.Minute,
+	}
+}
+
+// Validate checks task names, schedules and targets
+func (sc SchedulerConfig) Validate() error {
+	seen := make(map[string]bool)
+	for _, task := range sc.Tasks {
+		if task.Name == "" {
+			return fmt.Errorf("scheduled task without a name")
+		}
+		if seen[task.Name] {
+			return fmt.Errorf("duplicate scheduled task: %s", task.Name)
+		}
+		seen[task.Name] = true
+		schedule, err := ParseCron(task.Schedule)
+		if err != nil {
+			return fmt.Errorf("scheduled task %s: %w", task.Name, err)
+		}
+		if schedule.Next(time.Now()).IsZero() {
+			return fmt.Errorf("scheduled task %s: schedule '%s' never matches", task.Name, task.Schedule)
+		}
+		if (task.SQL == "") == (task.Function == "") {
+			return fmt.Errorf("scheduled task %s needs exactly one of sql or function", task.Name)
+		}
+	}
+	return nil
+}
+
+// ScheduledRun records one execution of a scheduled task
+type ScheduledRun struct {
+	Trigger      string      `json:"trigger"` // "schedule" or "remote"
+	Status       string      `json:"status"`  // "succeeded", "failed", "timed_out" or "skipped"
+	StartedAt    time.Time   `json:"started_at"`
+	FinishedAt   time.Time   `json:"finished_at,omitempty"`
+	RowsAffected int64       `json:"rows_affected,omitempty"`
+	Result       interface{} `json:"result,omitempty"`
+	Error        string      `json:"error,omitempty"`
+}
+
+// ScheduledTaskStatus is the schedule and run history of a task
+type ScheduledTaskStatus struct {
+	Name     string         `json:"name"`
+	Schedule string         `json:"schedule"`
+	Kind     string         `json:"kind"` // "sql" or "function"
+	NextRun  time.Time      `json:"next_run"`
+	Running  bool           `json:"running"`
+	History  []ScheduledRun `json:"history"` // Most recent first
+}
+
+// ScheduleStatus is returned by the getScheduleStatus function
+type ScheduleStatus struct {
+	DeviceID string                `json:"device_id"`
+	Tasks    []ScheduledTaskStatus `json:"tasks"`
+}
+
+// scheduledEntry is a task with its parsed schedule and state
+type scheduledEntry struct {
+	task     ScheduledTask
+	schedule *CronSchedule
+	next     time.Time
+	running  bool
+	history  []ScheduledRun // Most recent first
+}
+
+// Scheduler runs tasks on cron schedules so devices can do recurring work
+// without an external scheduler. A task still running when it is due again
+// is skipped for that occurrence.
+type Scheduler struct {
+	handler *Handler
+	config  SchedulerConfig
+	clock   clock.Clock // The handler's clock when the scheduler was created
+
+	mutex   sync.Mutex
+	entries []*scheduledEntry
+}
+
+// NewScheduler creates a scheduler; config must be valid
+func NewScheduler(handler *Handler, config SchedulerConfig) *Scheduler {
+	defaults := DefaultSchedulerConfig()
+	if config.HistorySize <= 0 {
+		config.HistorySize = defaults.HistorySize
+	}
+	if config.DefaultTimeout <= 0 {
+		config.DefaultTimeout = defaults.DefaultTimeout
+	}
+
+	scheduler := &Scheduler{handler: handler, config: config, clock: clock.OrReal(handler.clock)}
+	now := scheduler.clock.Now()
+	for _, task := range config.Tasks {
+		schedule, _ := ParseCron(task.Schedule)
+		scheduler.entries = append(scheduler.entries, &scheduledEntry{
+			task:     task,
+			schedule: schedule,
+			next:     schedule.Next(now),
+			history:  scheduler.loadHistory(task.Name),
+		})
+	}
+	return scheduler
+}
+
+// run wakes up every minute and starts the tasks that are due
+func (s *Scheduler) run(ctx context.Context) {
+	log.Printf("[scheduler] Started with %d tasks", len(s.entries))
+
+	for {
+		now := s.clock.Now()
+		wait := now.Truncate(time.Minute).Add(time.Minute).Sub(now)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+
+		s.startDue(ctx, s.clock.Now())
+	}
+}
+
+// startDue starts the tasks due at now and schedules their next run
+func (s *Scheduler) startDue(ctx context.Context, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.next.IsZero() || now.Before(entry.next) {
+			continue
+		}
+		entry.next = entry.schedule.Next(now)
+		if entry.running {
+			s.record(entry, ScheduledRun{Trigger: "schedule", Status: "skipped", StartedAt: now, FinishedAt: now,
+				Error: "previous run still in progress"})
+			continue
+		}
+		entry.running = true
+		go s.runTask(ctx, entry, "schedule")
+	}
+}
+
+// Trigger runs a task now in the background, outside its schedule
+func (s *Scheduler) Trigger(name string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, entry := range s.entries {
+		if entry.task.Name != name {
+			continue
+		}
+		if entry.running {
+			return fmt.Errorf("scheduled task %s is already running", name)
+		}
+		entry.running = true
+		go s.runTask(context.Background(), entry, "remote")
+		return nil
+	}
+	return fmt.Errorf("unknown scheduled task: %s", name)
+}
+
+// runTask executes a task within its timeout and records the run
+func (s *Scheduler) runTask(ctx context.Context, entry *scheduledEntry, trigger string) {
+	task := entry.task
+	timeout := time.Duration(task.Timeout)
+	if timeout <= 0 {
+		timeout = s.config.DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	run := ScheduledRun{Trigger: trigger, StartedAt: s.clock.Now()}
+	var err error
+	if task.SQL != "" {
+		run.RowsAffected, err = s.execSQL(ctx, task.SQL)
+	} else {
+		run.Result, err = s.callFunction(ctx, task)
+	}
+	run.FinishedAt = s.clock.Now()
+
+	switch {
+	case err == nil:
+		run.Status = "succeeded"
+	case ctx.Err() == context.DeadlineExceeded:
+		run.Status = "timed_out"
+		run.Error = fmt.Sprintf("timeout of %v reached", timeout)
+	default:
+		run.Status = "failed"
+		run.Error = err.Error()
+	}
+
+	s.mutex.Lock()
+	entry.running = false
+	s.record(entry, run)
+	s.mutex.Unlock()
+
+	log.Printf("[scheduler] Task %s %s after %v", task.Name, run.Status, run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond))
+}
+
+// execSQL runs a scheduled statement on the handler's database
+func (s *Scheduler) execSQL(ctx context.Context, statement string) (int64, error) {
+	db, release, err := s.handler.acquireDB()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+	return execMaintenanceStatement(ctx, db, statement)
+}
+
+// callFunction runs a scheduled function call
+func (s *Scheduler) callFunction(ctx context.Context, task ScheduledTask) (interface{}, error) {
+	funcValue := s.handler.getFunctionByName(task.Function)
+	if !funcValue.IsValid() {
+		return nil, fmt.Errorf("function '%s' not found", task.Function)
+	}
+	values, err := s.handler.executeFunction(ctx, FunctionRequest{Name: task.Function, Params: task.Params})
+	if err != nil {
+		return nil, err
+	}
+	return jobResult(funcValue.Type(), values)
+}
+
+// record prepends a run to the task history and persists it when a storage
+// is configured; the caller must hold the mutex
+func (s *Scheduler) record(entry *scheduledEntry, run ScheduledRun) {
+	entry.history = append([]ScheduledRun{run}, entry.history...)
+	if len(entry.history) > s.config.HistorySize {
+		entry.history = entry.history[:s.config.HistorySize]
+	}
+
+	storage := s.handler.Storage()
+	if storage == nil {
+		return
+	}
+	value, err := json.Marshal(entry.history)
+	if err == nil {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err = storage.Put(ctx, schedulerStorageNamespace, entry.task.Name, value, 0)
+		cancel()
+	}
+	if err != nil {
+		log.Printf("[scheduler] Failed to persist history of %s: %v", entry.task.Name, err)
+	}
+}
+
+// schedulerStorageNamespace is the Storage namespace of task run histories
+const schedulerStorageNamespace = "scheduler"
+
+// loadHistory returns the persisted run history of a task, if any
+func (s *Scheduler) loadHistory(name string) []ScheduledRun {
+	storage := s.handler.Storage()
+	if storage == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	value, found, err := storage.Get(ctx, schedulerStorageNamespace, name)
+	if err != nil {
+		log.Printf("[scheduler] Failed to load history of %s: %v", name, err)
+		return nil
+	}
+	if !found {
+		return nil
+	}
+
+	var history []ScheduledRun
+	if err := json.Unmarshal(value, &history); err != nil {
+		log.Printf("[scheduler] Ignoring unreadable history of %s: %v", name, err)
+		return nil
+	}
+	if len(history) > s.config.HistorySize {
+		history = history[:s.config.HistorySize]
+	}
+	return history
+}
+
+// Status returns the schedule and history of every task, or of the named one
+func (s *Scheduler) Status(name string) []ScheduledTaskStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var tasks []ScheduledTaskStatus
+	for _, entry := range s.entries {
+		if name != "" && entry.task.Name != name {
+			continue
+		}
+		kind := "sql"
+		if entry.task.Function != "" {
+			kind = "function"
+		}
+		tasks = append(tasks, ScheduledTaskStatus{
+			Name:     entry.task.Name,
+			Schedule: entry.task.Schedule,
+			Kind:     kind,
+			NextRun:  entry.next,
+			Running:  entry.running,
+			History:  append([]ScheduledRun(nil), entry.history...),
+		})
+	}
+	return tasks
+}
+
+// SetSchedulerConfig configures recurring tasks and registers the
+// getScheduleStatus and runScheduledTask functions.
+func (h *Handler) SetSchedulerConfig(config SchedulerConfig) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	h.scheduler = NewScheduler(h, config)
+
+	h.RegisterFunctionWithMetadata("getScheduleStatus", func(name string) ScheduleStatus {
+		return ScheduleStatus{DeviceID: h.deviceID, Tasks: h.scheduler.Status(name)}
+	}, FunctionMetadata{
+		Description: "Returns the next run and run history of scheduled tasks",
+		Params:      []FunctionParamInfo{{Name: "name", Description: "Only this task (empty for all)"}},
+	})
+	h.RegisterFunctionWithMetadata("runScheduledTask", func(name string) (string, error) {
+		if err := h.scheduler.Trigger(name); err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("scheduled task %s started", name), nil
+	}, FunctionMetadata{
+		Description: "Runs a scheduled task now, outside its schedule",
+		Params:      []FunctionParamInfo{{Name: "name", Description: "Task name from the server configuration"}},
+	})
+
+	log.Printf("[server] Scheduler configured: %d tasks", len(config.Tasks))
+	return nil
+}
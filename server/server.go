@@ -21,6 +21,7 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"os/exec"
@@ -30,6 +31,8 @@ import (
 	"time"
 
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/lordbasex/burrowctl/client"
+	"github.com/lordbasex/burrowctl/clock"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -77,17 +80,53 @@ func NewHandler(deviceID, amqpURL, mysqlDSN, mode string, poolConf *PoolConfig)
 		mysqlDSN:           mysqlDSN,
 		mode:               mode,
 		poolConf:           *poolConf,
+		startTime:          time.Now(),
 		functionRegistry:   make(map[string]interface{}),                  // Initialize empty function registry
 		transactionManager: NewTransactionManager(),                       // Initialize transaction manager
 		queryCache:         NewQueryCache(DefaultQueryCacheConfig()),      // Initialize query cache
 		sqlValidator:       NewSQLValidator(DefaultSQLValidationConfig()), // Initialize SQL validator
+		approvals:          NewApprovalQueue(DefaultApprovalConfig()),     // No requests held until a risk level requires approval
+		slowQueryLog:       NewSlowQueryLog(DefaultSlowQueryConfig()),     // Initialize slow query log
+		queryStats:         NewQueryStats(DefaultQueryStatsConfig()),      // Initialize statement statistics
+		priorityConfig:     DefaultPriorityConfig(),                       // Initialize priority mapping
+		progressConfig:     DefaultProgressConfig(),                       // Notify clients that ask for progress
+		impersonation:      DefaultImpersonationConfig(),                  // Reject on_behalf_of until a policy is configured
+		accessControl:      DefaultAccessControlConfig(),                  // Allow every request type until a policy is configured
+		replayProtection:   DefaultReplayProtectionConfig(),               // Accept requests without nonce until enabled
+		queueConfig:        DefaultQueueConfig(),                          // Non-durable classic queues
+		ackConfig:          DefaultAckConfig(),                            // Acknowledge requests on delivery
+		deliveryFallback:   NewMemoryStorage(),                            // Processed deliveries when no storage is configured
+		responseConfirms:   DefaultResponseConfirmConfig(),                // Confirm every response
+		responseLimits:     DefaultResponseLimitConfig(),                  // No limit on result size
 
 		// Initialize heartbeat manager
 		heartbeatManager: NewServerHeartbeatManager(deviceID, DefaultServerHeartbeatConfig()),
 
-		// Initialize queue names
+		// Initialize per-client session settings
+		sessionSettings:    NewSessionSettingsStore(DefaultSessionSettingsConfig()),
+		sessions:           NewSessionRegistry(),
+		preparedStatements: NewPreparedStatementRegistry(DefaultPreparedStatementConfig()),
+		protocolStats:      newProtocolStats(),
+		functionStats:      newFunctionStatsRegistry(),
+		jobs:               NewJobManager(DefaultJobConfig()),
+		exports:            NewExportManager(DefaultExportConfig()),
+		cursors:            NewCursorManager(DefaultCursorConfig()),
+
+		// Audit logging is disabled until a logger is configured
+		auditRedactParams: true,
+
+		// Hand the queues over to a newer instance on rolling upgrades
+		handover: DefaultHandoverConfig(),
+
+		// Debug endpoints are disabled until an address is configured
+		debugConfig: DefaultDebugConfig(),
+
+		// Initialize queue names (no namespace until SetNamespace is called)
 		rpcQueueName:       fmt.Sprintf("device_%s_rpc", deviceID),
 		heartbeatQueueName: fmt.Sprintf("device_%s_heartbeat", deviceID),
+		eventsExchangeName: fmt.Sprintf("device_%s_events", deviceID),
+
+		telemetryExchangeName: "burrowctl_telemetry",
 	}
 
 	// Initialize worker pool with default configuration
@@ -100,6 +139,16 @@ func NewHandler(deviceID, amqpURL, mysqlDSN, mode string, poolConf *PoolConfig)
 	// Initialize rate limiter with default configuration
 	handler.rateLimiter = NewRateLimiter(DefaultRateLimiterConfig())
 
+	// No limit on concurrent SQL statements until one is configured
+	handler.queryLimiter = NewQueryLimiter(DefaultQueryLimiterConfig())
+
+	// Nothing is shed until memory or CPU thresholds are configured
+	handler.resources = NewResourceMonitor(DefaultLoadSheddingConfig())
+
+	// Register built-in functions such as listFunctions
+	handler.registerBuiltinFunctions()
+	handler.registerMonitoringFunctions()
+
 	return handler
 }
 
@@ -107,16 +156,23 @@ func NewHandler(deviceID, amqpURL, mysqlDSN, mode string, poolConf *PoolConfig)
 // This enables dynamic function registration from examples or external code.
 //
 // Parameters:
-//   - name: The name by which the function will be called
+//   - name: The name by which the function will be called, optionally
+//     namespaced with dots (e.g. "system.df", "app.reindex")
 //   - function: The actual function to register (must be a valid Go function)
 //
 // The function uses reflection to inspect the function signature at runtime,
-// allowing for type-safe parameter conversion and execution.
+// allowing for type-safe parameter conversion and execution. Invalid names and
+// non-function values are logged and ignored.
 func (h *Handler) RegisterFunction(name string, function interface{}) {
+	if err := validateFunction(name, function); err != nil {
+		log.Printf("[server] Function not registered: %v", err)
+		return
+	}
 	if h.functionRegistry == nil {
 		h.functionRegistry = make(map[string]interface{})
 	}
 	h.functionRegistry[name] = function
+	delete(h.functionMetadata, name)
 	log.Printf("[server] Function '%s' registered", name)
 }
 
@@ -132,10 +188,17 @@ func (h *Handler) RegisterFunctions(functions map[string]interface{}) {
 	if h.functionRegistry == nil {
 		h.functionRegistry = make(map[string]interface{})
 	}
+	registered := 0
 	for name, function := range functions {
+		if err := validateFunction(name, function); err != nil {
+			log.Printf("[server] Function not registered: %v", err)
+			continue
+		}
 		h.functionRegistry[name] = function
+		delete(h.functionMetadata, name)
+		registered++
 	}
-	log.Printf("[server] %d functions registered", len(functions))
+	log.Printf("[server] %d functions registered", registered)
 }
 
 // GetRegisteredFunctions returns a list of all registered function names.
@@ -166,34 +229,26 @@ func (h *Handler) GetRegisteredFunctions() []string {
 // - "open": Maintains a persistent database connection pool
 // - "close": Opens/closes database connections per query
 func (h *Handler) Start(ctx context.Context) error {
+	// Brokers other than RabbitMQ are served through a client.Transport
+	if !client.IsAMQPURL(h.amqpURL) {
+		return h.startTransport(ctx)
+	}
+
 	var err error
 
 	// Establish RabbitMQ connection
 	h.conn, err = amqp.Dial(h.amqpURL)
 	if err != nil {
-		return fmt.Errorf("failed to connect to RabbitMQ: %w", err)
+		return fmt.Errorf("failed to connect to RabbitMQ: %w", client.ExplainAMQPError(err, h.amqpURL))
 	}
 	defer h.conn.Close()
 
 	// Initialize database connection based on mode
-	if h.mode == "open" {
-		// Open persistent database connection with pooling
-		h.db, err = sql.Open("mysql", h.mysqlDSN)
-		if err != nil {
-			return fmt.Errorf("failed to connect to MySQL: %w", err)
-		}
-
-		// Configure connection pool for optimal performance
-		h.db.SetMaxIdleConns(h.poolConf.MaxIdleConns)
-		h.db.SetMaxOpenConns(h.poolConf.MaxOpenConns)
-		h.db.SetConnMaxLifetime(h.poolConf.ConnMaxLifetime)
-		defer h.db.Close()
-
-		log.Printf("[server] Database pool initialized: idle=%d open=%d lifetime=%s",
-			h.poolConf.MaxIdleConns, h.poolConf.MaxOpenConns, h.poolConf.ConnMaxLifetime)
-	} else {
-		log.Println("[server] Using 'close' mode: opening/closing DB connection per query")
+	closeDB, err := h.openDatabase()
+	if err != nil {
+		return err
 	}
+	defer closeDB()
 
 	// Create RabbitMQ channel for message operations
 	ch, err := h.conn.Channel()
@@ -202,96 +257,361 @@ func (h *Handler) Start(ctx context.Context) error {
 	}
 	defer ch.Close()
 
-	// Declare RPC queue for this device
-	_, err = ch.QueueDeclare(
-		h.rpcQueueName, // name - RPC queue name using device ID for uniqueness
-		false,          // durable - non-persistent (lost if RabbitMQ restarts)
-		false,          // delete when unused - keep queue active
-		false,          // exclusive - allow multiple consumers
-		false,          // no-wait - wait for server confirmation
-		nil,            // arguments - no additional arguments
-	)
-	if err != nil {
-		return fmt.Errorf("failed to declare RPC queue: %w", err)
+	// Have the broker confirm the responses published on it
+	if err := h.enableResponseConfirms(ch); err != nil {
+		return err
 	}
 
-	// Declare heartbeat queue for this device
-	_, err = ch.QueueDeclare(
-		h.heartbeatQueueName, // name - heartbeat queue name using device ID for uniqueness
-		false,                // durable - non-persistent (lost if RabbitMQ restarts)
-		false,                // delete when unused - keep queue active
-		false,                // exclusive - allow multiple consumers
-		false,                // no-wait - wait for server confirmation
-		nil,                  // arguments - no additional arguments
-	)
+	// Declare the RPC and heartbeat queues for this device
+	deviceTopology, err := client.NewTopology(h.namespace, h.deviceID)
 	if err != nil {
-		return fmt.Errorf("failed to declare heartbeat queue: %w", err)
+		return err
+	}
+	rpcQueue, err := h.declareDeviceQueues(ch, deviceTopology)
+	if err != nil {
+		return err
 	}
 
 	log.Printf("[server] Queues '%s' and '%s' declared successfully", h.rpcQueueName, h.heartbeatQueueName)
 
+	// Declare the events exchange for server-push subscriptions
+	if err := h.setupEvents(); err != nil {
+		return err
+	}
+	defer h.closeEvents()
+
+	// Ping the clients that registered a ping queue; it stops with the connection
+	if h.heartbeatManager.config.Enabled && h.heartbeatManager.config.ServerPings {
+		go func() {
+			if err := h.heartbeatManager.runPings(ctx, h.conn); err != nil {
+				log.Printf("[server-heartbeat] Server pings stopped: %v", err)
+			}
+		}()
+	}
+
+	// In cluster mode other instances consume the same queues, and RPC
+	// deliveries are acknowledged by the worker that takes them so the
+	// prefetch limit applies. In manual ack mode they are acknowledged once
+	// processed.
+	clustered := h.cluster != nil
+	manualAck := clustered || h.ackConfig.manual()
+
+	// Take the queues over from an instance that is still running (rolling
+	// upgrade), then listen for the next instance asking the same
+	var controlMsgs <-chan amqp.Delivery
+	if h.handover.Enabled && !clustered {
+		topology, err := client.NewTopology(h.namespace, h.deviceID)
+		if err != nil {
+			return err
+		}
+		if _, err := ch.QueueDeclare(topology.ControlQueue, false, false, false, false, nil); err != nil {
+			return fmt.Errorf("failed to declare control queue: %w", client.ExplainAMQPError(err, h.amqpURL))
+		}
+		if rpcQueue.Consumers > 0 {
+			if err := h.requestHandover(ctx, topology.ControlQueue); err != nil {
+				log.Printf("[server] Handover failed: %v", err)
+			}
+		}
+		if controlMsgs, err = ch.Consume(topology.ControlQueue, controlConsumerTag, true, true, false, false, nil); err != nil {
+			return err
+		}
+	}
+
 	// Start consuming messages from the RPC queue
-	rpcMsgs, err := ch.Consume(h.rpcQueueName, "", true, true, false, false, nil)
+	rpcMsgs, err := ch.Consume(h.rpcQueueName, rpcConsumerTag, !manualAck, !clustered, false, false, nil)
 	if err != nil {
 		return err
 	}
 
 	// Start consuming messages from the heartbeat queue
-	heartbeatMsgs, err := ch.Consume(h.heartbeatQueueName, "", true, true, false, false, nil)
+	heartbeatMsgs, err := ch.Consume(h.heartbeatQueueName, heartbeatConsumerTag, true, !clustered, false, false, nil)
 	if err != nil {
 		return err
 	}
 
 	log.Printf("[server] Listening on RPC queue %s and heartbeat queue %s", h.rpcQueueName, h.heartbeatQueueName)
 
-	// Start the worker pool for concurrent message processing
-	if err := h.workerPool.Start(); err != nil {
-		return fmt.Errorf("failed to start worker pool: %w", err)
+	// Also answer under the old device IDs of a rename
+	var aliasMsgs, aliasHeartbeats <-chan aliasDelivery
+	if h.deviceAliases != nil {
+		if aliasMsgs, aliasHeartbeats, err = h.deviceAliases.setup(ch, clustered, manualAck); err != nil {
+			return err
+		}
 	}
-	defer h.workerPool.Stop(10 * time.Second) // 10 second shutdown timeout
-	defer h.rateLimiter.Stop()                // Stop rate limiter cleanup goroutine
 
-	// Start heartbeat manager
-	h.heartbeatManager.Start()
-	defer h.heartbeatManager.Stop()
+	// Join the other instances and consume this instance's own queue
+	var instanceMsgs <-chan amqp.Delivery
+	if clustered {
+		topology, err := client.NewTopology(h.namespace, h.deviceID)
+		if err != nil {
+			return err
+		}
+		if instanceMsgs, err = h.cluster.setup(h.conn, ch, topology); err != nil {
+			return err
+		}
+		defer h.cluster.close()
+	}
 
-	// Start transaction cleanup goroutine
-	go h.transactionCleanupLoop(ctx)
+	// Start the worker pool and background tasks
+	stop, err := h.startBackground(ctx)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	// Start cluster health reporting
+	if h.cluster != nil {
+		go h.cluster.run(ctx)
+	}
 
 	// Main message processing loop
+	var (
+		handoverRequest *amqp.Delivery // Accepted handover request, answered once drained
+		drained         chan struct{}  // Closed when the handover is answered
+	)
 	for {
 		select {
 		case <-ctx.Done():
 			// Context cancelled, shut down gracefully
 			log.Printf("[server] Shutting down server...")
 			return nil
-		case msg := <-rpcMsgs:
-			// Submit RPC message to worker pool
-			task := MessageTask{
-				Channel:   ch,
-				Message:   msg,
-				Timestamp: time.Now(),
+		case msg, ok := <-rpcMsgs:
+			if !ok {
+				// Consumer cancelled for a handover: once the alias consumers
+				// are closed too, every delivery has been submitted and the
+				// remaining work can be drained
+				rpcMsgs = nil
+				if handoverRequest != nil {
+					if aliasMsgs == nil {
+						drained = make(chan struct{})
+						go h.drainForHandover(ch, *handoverRequest, drained)
+					}
+					continue
+				}
+				return fmt.Errorf("RPC queue consumer closed")
 			}
-
-			if err := h.workerPool.SubmitTask(task); err != nil {
-				log.Printf("[server] Failed to submit RPC task to worker pool: %v", err)
-				// Send error response directly if worker pool fails
-				errorResp := RPCResponse{Error: "Server overloaded, please try again"}
-				if body, marshalErr := json.Marshal(errorResp); marshalErr == nil {
-					ch.PublishWithContext(ctx, "", msg.ReplyTo, false, false, amqp.Publishing{
-						ContentType:   "application/json",
-						CorrelationId: msg.CorrelationId,
-						Body:          body,
-					})
+			if h.deviceAliases != nil {
+				h.deviceAliases.record(h.deviceID, false)
+			}
+			h.dispatch(ctx, ch, msg, manualAck)
+		case delivery, ok := <-aliasMsgs:
+			if !ok {
+				aliasMsgs = nil
+				if handoverRequest != nil {
+					if rpcMsgs == nil {
+						drained = make(chan struct{})
+						go h.drainForHandover(ch, *handoverRequest, drained)
+					}
+					continue
 				}
+				return fmt.Errorf("alias RPC queue consumer closed")
+			}
+			// Requests sent to an old device ID are served like any other
+			h.deviceAliases.record(delivery.alias, false)
+			h.dispatch(ctx, ch, delivery.msg, manualAck)
+		case msg, ok := <-instanceMsgs:
+			if !ok {
+				instanceMsgs = nil
+				continue
+			}
+			// Requests routed to this instance (transactions it holds)
+			h.dispatch(ctx, ch, msg, false)
+		case msg, ok := <-heartbeatMsgs:
+			if !ok {
+				heartbeatMsgs = nil
+				continue
 			}
-		case msg := <-heartbeatMsgs:
 			// Process heartbeat message directly (high priority)
-			h.heartbeatManager.HandleHeartbeatPing(ch, msg)
+			if h.deviceAliases != nil {
+				h.deviceAliases.record(h.deviceID, true)
+			}
+			h.handleHeartbeatPing(ch, msg)
+		case delivery, ok := <-aliasHeartbeats:
+			if !ok {
+				aliasHeartbeats = nil
+				continue
+			}
+			h.deviceAliases.record(delivery.alias, true)
+			h.handleHeartbeatPing(ch, delivery.msg)
+		case msg, ok := <-controlMsgs:
+			if !ok {
+				controlMsgs = nil
+				continue
+			}
+			if handoverRequest == nil && h.acceptHandover(ch, msg) {
+				handoverRequest = &msg
+			}
+		case <-drained:
+			log.Printf("[server] Handed over to the new instance, shutting down")
+			return nil
+		}
+	}
+}
+
+// openDatabase opens the database pool in "open" mode. The returned
+// function closes it.
+func (h *Handler) openDatabase() (func(), error) {
+	if h.mode != "open" {
+		log.Println("[server] Using 'close' mode: opening/closing DB connection per query")
+		return func() {}, nil
+	}
+
+	// Open persistent database connection with pooling
+	db, err := sql.Open("mysql", h.mysqlDSN)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to MySQL: %w", err)
+	}
+	h.db = db
+
+	// Configure connection pool for optimal performance
+	h.db.SetMaxIdleConns(h.poolConf.MaxIdleConns)
+	h.db.SetMaxOpenConns(h.poolConf.MaxOpenConns)
+	h.db.SetConnMaxLifetime(h.poolConf.ConnMaxLifetime)
+
+	log.Printf("[server] Database pool initialized: idle=%d open=%d lifetime=%s",
+		h.poolConf.MaxIdleConns, h.poolConf.MaxOpenConns, h.poolConf.ConnMaxLifetime)
+	return func() { db.Close() }, nil
+}
+
+// startBackground starts the worker pool and the background tasks that run
+// until ctx is cancelled. The returned function stops the worker pool and
+// closes what the tasks use.
+func (h *Handler) startBackground(ctx context.Context) (func(), error) {
+	var stops []func()
+	stop := func() {
+		for i := len(stops) - 1; i >= 0; i-- {
+			stops[i]()
+		}
+	}
+
+	// Start the worker pool for concurrent message processing
+	if err := h.workerPool.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start worker pool: %w", err)
+	}
+	stops = append(stops,
+		func() { h.workerPool.Stop(10 * time.Second) }, // 10 second shutdown timeout
+		func() { h.rateLimiter.Stop() },                // Stop the current rate limiter cleanup goroutine
+	)
+
+	// Start heartbeat manager
+	h.heartbeatManager.Start()
+	stops = append(stops, h.heartbeatManager.Stop)
+
+	// Serve the debug endpoints
+	if h.debugConfig.Addr != "" {
+		stopDebug, err := h.startDebugServer()
+		if err != nil {
+			stop()
+			return nil, err
+		}
+		stops = append(stops, stopDebug)
+	}
+
+	// Flush and close the audit log on shutdown
+	if h.auditLogger != nil {
+		stops = append(stops, func() { h.auditLogger.Close() })
+	}
+
+	// Purge expired storage items and close the storage on shutdown
+	if h.storage != nil {
+		stops = append(stops, func() { h.storage.Close() })
+		go h.purgeStorageLoop(ctx)
+	}
+
+	// Start transaction cleanup goroutine
+	go h.transactionCleanupLoop(ctx)
+
+	// Start asynchronous job workers
+	go h.jobs.run(ctx)
+
+	// Close idle exports and cursors
+	go h.exports.run(ctx)
+	go h.cursors.run(ctx)
+
+	// Sample memory and CPU use for load shedding
+	go h.resources.run(ctx)
+
+	// Start maintenance scheduler
+	if h.maintenance != nil {
+		go h.maintenance.run(ctx)
+	}
+
+	// Start data retention loop
+	if h.retention != nil {
+		go h.retention.run(ctx)
+	}
+
+	// Start cron scheduler
+	if h.scheduler != nil {
+		go h.scheduler.run(ctx)
+	}
+
+	// Start change data capture
+	if h.cdc != nil {
+		go h.cdc.run(ctx)
+	}
+
+	// Start index suggestion analysis
+	if h.indexAdvisor != nil {
+		go h.indexAdvisor.run(ctx)
+	}
+
+	// Start table statistics collection
+	if h.tableStats != nil {
+		go h.tableStats.run(ctx)
+	}
+
+	// Expire log tail leases
+	if h.logTail != nil {
+		go h.logTail.run(ctx)
+	}
+
+	// Publish host telemetry
+	if h.telemetry != nil {
+		go h.telemetry.run(ctx)
+	}
+
+	return stop, nil
+}
+
+// dispatch submits an RPC message to the worker pool. ack is set for
+// deliveries that must be acknowledged manually (cluster or manual ack
+// mode).
+func (h *Handler) dispatch(ctx context.Context, ch *amqp.Channel, msg amqp.Delivery, ack bool) {
+	task := MessageTask{
+		Channel:   ch,
+		Message:   msg,
+		Timestamp: time.Now(),
+		Ack:       ack && !h.ackConfig.manual(),
+		Settle:    ack && h.ackConfig.manual(),
+		Requeue:   h.ackConfig.Requeue,
+	}
+
+	if err := h.workerPool.SubmitTask(task); err != nil {
+		log.Printf("[server] Failed to submit RPC task to worker pool: %v", err)
+		if ack {
+			msg.Ack(false)
+		}
+		// Send error response directly if worker pool fails
+		errorResp := RPCResponse{Error: "Server overloaded, please try again"}
+		if body, marshalErr := json.Marshal(errorResp); marshalErr == nil {
+			h.publishResponse(ch, msg.ReplyTo, amqp.Publishing{
+				ContentType:   "application/json",
+				CorrelationId: msg.CorrelationId,
+				Body:          body,
+			})
 		}
 	}
 }
 
+// delayedRequest is the rest of a request the rate limiter delayed in
+// RateLimitDelay mode, run by a new worker task once the delay is over
+type delayedRequest struct {
+	delay  time.Duration
+	run    func()                 // Executes the request
+	reject func(resp RPCResponse) // Answers the client without executing it
+}
+
 // handleMessage processes incoming messages from the RabbitMQ queue.
 // It deserializes the request, logs the operation, and routes to the appropriate handler
 // based on the request type (sql, function, or command).
@@ -300,24 +620,181 @@ func (h *Handler) Start(ctx context.Context) error {
 //   - ch: RabbitMQ channel for sending responses
 //   - msg: The incoming message delivery containing the request
 //
-// This method runs in a separate goroutine for each message to enable concurrent processing.
-func (h *Handler) handleMessage(ch *amqp.Channel, msg amqp.Delivery) {
+// It returns the rest of the request when the rate limiter delayed it, and
+// nil once the request is answered.
+func (h *Handler) handleMessage(ch *amqp.Channel, msg amqp.Delivery) (delayed *delayedRequest) {
+	// Work left once the request is answered; a delayed request takes it along
+	var finish []func()
+	defer func() {
+		if delayed == nil {
+			runFinish(finish)
+		}
+	}()
+
 	var req RPCRequest
 	if err := json.Unmarshal(msg.Body, &req); err != nil {
 		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
 		return
 	}
+	req.Tag = sanitizeRequestTag(req.Tag)
+
+	// Reject clients outside the IP allow and deny lists before anything else
+	if h.ipFilter != nil {
+		if err := h.ipFilter.Check(req.ClientIP); err != nil {
+			log.Printf("[server] Request rejected: principal=%q type=%s: %v", msg.UserId, req.Type, err)
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+				Error:     fmt.Sprintf("access denied: %v", err),
+				ErrorCode: ErrIPDenied,
+			})
+			return
+		}
+	}
+
+	// Fill in options the client left empty from its session settings
+	if req.Type != "heartbeat_ping" {
+		h.protocolStats.record(req.ProtocolVersion, req.ClientIP)
+		if req.Type != "session" {
+			req = h.applySessionSettings(msg.UserId, req)
+		}
+
+		// Requests keep the client's session alive
+		h.trackSession(msg.UserId, req, "", "", false)
+	}
+
+	// Executions of prepared statements only carry the handle; restore the
+	// SQL text for the audit log, validation and the query cache
+	if req.StatementID != "" && req.Type == "sql" {
+		if _, query, found := h.preparedStatements.Lookup(msg.UserId, req.StatementID); found {
+			req.Query = query
+		}
+	}
+
+	// Track the request for the audit log (heartbeats are not audited)
+	if req.Type != "heartbeat_ping" {
+		record := h.beginAudit(msg.CorrelationId, msg.UserId, req, time.Now())
+		finish = append(finish, func() { h.finishAudit(msg.CorrelationId, record) })
+	}
+
+	// Verify the end user the request claims to run on behalf of
+	if err := h.authorizeOnBehalfOf(msg.UserId, req); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error:     fmt.Sprintf("impersonation denied: %v", err),
+			ErrorCode: ErrImpersonationDenied,
+		})
+		return
+	}
+
+	// Authenticate the client's token
+	claims, err := h.authenticateToken(req)
+	if err != nil {
+		log.Printf("[server] Token rejected: principal=%q type=%s ip=%s: %v", msg.UserId, req.Type, req.ClientIP, err)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error:     fmt.Sprintf("authentication failed: %v", err),
+			ErrorCode: tokenErrorCode(err),
+		})
+		return
+	}
+
+	// Reject requests captured and published again. Only authenticated
+	// requests record their nonce, so unauthenticated traffic cannot fill
+	// the nonce storage or burn the nonces of legitimate requests.
+	if err := h.checkReplay(msg, req); err != nil {
+		log.Printf("[server] Replay rejected: principal=%q type=%s ip=%s: %v", msg.UserId, req.Type, req.ClientIP, err)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error:     fmt.Sprintf("replay protection: %v", err),
+			ErrorCode: ErrReplayRejected,
+		})
+		return
+	}
+
+	// Answer statements the broker redelivered without running them twice
+	if req.TransactionID != "" && req.Sequence > 0 && req.Type != "transaction" {
+		if reply, duplicate := h.claimTxStatement(req, msg.CorrelationId); duplicate {
+			h.replayTxStatement(ch, msg, req, reply)
+			return
+		}
+		finish = append(finish, func() { h.finishTxStatement(msg.CorrelationId) })
+	}
+
+	// Answer writes the broker redelivered after an interrupted attempt
+	// without running them twice
+	if h.ackConfig.manual() && req.TransactionID == "" && isWriteRequest(req) {
+		if h.claimDelivery(ch, msg, req) {
+			return
+		}
+		finish = append(finish, func() { h.finishDelivery(msg.CorrelationId) })
+	}
+
+	// Verify the client's roles allow the request type
+	if err := h.authorizeRequestType(msg.UserId, claims, req); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error:     fmt.Sprintf("access denied: %v", err),
+			ErrorCode: ErrAccessDenied,
+		})
+		return
+	}
+
+	// Shed low-priority requests while memory or CPU use is above thresholds
+	if response, shed := h.shedLoad(req); shed {
+		log.Printf("[server] Shedding %s request from %s: %s", req.Type, req.ClientIP, response.Error)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, response)
+		return
+	}
 
 	// Check rate limit before processing request
-	if !h.rateLimiter.Allow(req.ClientIP) {
+	decision := h.rateLimiter.Reserve(req.ClientIP)
+	h.rateLimitInFlight.Store(msg.CorrelationId, decision.Info)
+	finish = append(finish, func() { h.rateLimitInFlight.Delete(msg.CorrelationId) })
+	if !decision.Allowed {
 		log.Printf("[server] rate limit exceeded for client %s", req.ClientIP)
 		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
-			Error: "Rate limit exceeded. Please slow down your requests.",
+			Error:     "Rate limit exceeded. Please slow down your requests.",
+			ErrorCode: ErrRateLimited,
 		})
 		return
 	}
+	if decision.Delay > 0 {
+		// Queue-and-delay mode: run the request once its token refills,
+		// without holding a worker while it waits
+		log.Printf("[server] rate limit delaying request from client %s by %v", req.ClientIP, decision.Delay)
+		return &delayedRequest{
+			delay: decision.Delay,
+			run: func() {
+				defer runFinish(finish)
+				h.routeRequest(ch, msg, req)
+			},
+			reject: func(resp RPCResponse) {
+				defer runFinish(finish)
+				h.respond(ch, msg.ReplyTo, msg.CorrelationId, resp)
+			},
+		}
+	}
+
+	h.routeRequest(ch, msg, req)
+	return nil
+}
+
+// runFinish runs the work left once a request is answered, last added first
+func runFinish(finish []func()) {
+	for i := len(finish) - 1; i >= 0; i-- {
+		finish[i]()
+	}
+}
+
+// routeRequest logs an admitted request and routes it to the handler of its
+// type
+func (h *Handler) routeRequest(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	details := ""
+	if req.OnBehalfOf != "" {
+		details += " on_behalf_of=" + req.OnBehalfOf
+	}
+	if req.Tag != "" {
+		details += " tag=" + req.Tag
+	}
+	log.Printf("[server] received ip=%s type=%s%s query=%s", req.ClientIP, req.Type, details, h.loggedRequest(req))
 
-	log.Printf("[server] received ip=%s type=%s query=%s", req.ClientIP, req.Type, req.Query)
+	// Keep clients that asked for it informed while the request runs
+	defer h.startProgress(ch, msg, req)()
 
 	// Route to appropriate handler based on request type
 	switch req.Type {
@@ -333,9 +810,51 @@ func (h *Handler) handleMessage(ch *amqp.Channel, msg amqp.Delivery) {
 	case "transaction":
 		h.handleTransaction(ch, msg, req)
 
+	case "session":
+		h.handleSession(ch, msg, req)
+
+	case "prepare":
+		h.handlePrepare(ch, msg, req)
+
+	case "deallocate":
+		h.handleDeallocate(ch, msg, req)
+
+	case "job":
+		h.handleJob(ch, msg, req)
+
+	case "file.get", "file.put":
+		h.handleFileTransfer(ch, msg, req)
+
+	case "log.tail":
+		h.handleLogTail(ch, msg, req)
+
+	case "bulk":
+		h.handleBulkInsert(ch, msg, req)
+
+	case "script":
+		h.handleScript(ch, msg, req)
+
+	case "migrate":
+		h.handleMigrate(ch, msg, req)
+
+	case "explain":
+		h.handleExplain(ch, msg, req)
+
+	case "validate":
+		h.handleValidate(ch, msg, req)
+
+	case "approval":
+		h.handleApproval(ch, msg, req)
+
+	case "export":
+		h.handleExport(ch, msg, req)
+
+	case "cursor":
+		h.handleCursor(ch, msg, req)
+
 	case "heartbeat_ping":
 		// Handle heartbeat ping (should be processed by heartbeat manager)
-		h.heartbeatManager.HandleHeartbeatPing(ch, msg)
+		h.handleHeartbeatPing(ch, msg)
 
 	default:
 		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
@@ -360,18 +879,36 @@ func (h *Handler) handleMessage(ch *amqp.Channel, msg amqp.Delivery) {
 // - Proper connection management based on mode
 // - Transaction support for ACID operations
 func (h *Handler) handleSQL(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
-	// Create context with timeout to prevent long-running queries
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	// Resolve the handle of a prepared statement; the client prepares it
+	// again when the server no longer has it
+	var prepared *sql.Stmt
+	if req.StatementID != "" {
+		stmt, _, found := h.preparedStatements.Lookup(msg.UserId, req.StatementID)
+		if !found {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+				Error:     fmt.Sprintf("prepared statement %s not found", req.StatementID),
+				ErrorCode: ErrStmtNotFound,
+			})
+			return
+		}
+		prepared = stmt
+	}
 
 	// Validate SQL query for security and policy compliance
 	validationResult := h.sqlValidator.ValidateQuery(req.Query, req.Params)
+	if validationResult.RequiresApproval {
+		// Run the query as sent once an operator approves it; its prepared
+		// statement may be gone by then
+		h.holdForApproval(ch, msg, req, validationResult, func() {
+			h.runSQL(ch, msg, req, nil)
+		})
+		return
+	}
 	if !validationResult.Valid {
-		// Query failed validation, return error
-		errorMsg := fmt.Sprintf("SQL validation failed: %s", strings.Join(validationResult.Errors, "; "))
+		// Query failed validation, return the violated rules
 		log.Printf("[server] SQL validation blocked query from %s: %s (risk: %s)",
-			req.ClientIP, truncateQuery(req.Query, 50), validationResult.Risk)
-		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: errorMsg})
+			req.ClientIP, h.loggedQuery(req.Query, 50), validationResult.Risk)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, validationFailedResponse(validationResult))
 		return
 	}
 
@@ -380,35 +917,124 @@ func (h *Handler) handleSQL(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest)
 		log.Printf("[server] SQL validation warnings for query: %s", strings.Join(validationResult.Warnings, "; "))
 	}
 
-	// Skip cache for transactions and write operations
-	useCache := req.TransactionID == "" && isReadOnlyQuery(req.Query)
+	// Run SELECTs without LIMIT with the default one added
+	if validationResult.RewrittenQuery != "" {
+		req.Query = validationResult.RewrittenQuery
+		prepared = nil
+	}
+
+	h.runSQL(ch, msg, req, prepared)
+}
+
+// runSQL executes a SQL request that passed validation or was approved,
+// using the prepared statement when there is one
+func (h *Handler) runSQL(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest, prepared *sql.Stmt) {
+	// Create context with timeout to prevent long-running queries
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Reject unknown priorities instead of silently running them unrestricted
+	if !validPriority(req.Priority) {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error: fmt.Sprintf("invalid priority: %s", req.Priority),
+		})
+		return
+	}
+
+	// Statements of a session that sent SET or USE run on its pinned connection
+	var pinned *pinnedConn
+	if req.TransactionID == "" {
+		var pinErr error
+		pinned, pinErr = h.sessionConn(ctx, msg.UserId, req)
+		if pinErr != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: pinErr.Error()})
+			return
+		}
+		if pinned != nil {
+			defer pinned.mutex.Unlock()
+			prepared = nil // Statements are prepared on the pool, not on the pinned connection
+		}
+	}
+
+	// Skip cache for transactions, write operations and session state
+	exec := req.Exec || len(req.Batch) > 0
+	useCache := req.TransactionID == "" && pinned == nil && !exec && isReadOnlyQuery(req.Query)
 
 	// Try to get result from cache first (only for read-only queries outside transactions)
+	var cacheTTL time.Duration
 	if useCache {
-		if cachedResponse, found := h.queryCache.Get(req.Query, req.Params); found {
-			log.Printf("[server] Cache HIT for query: %s", truncateQuery(req.Query, 50))
-			h.respond(ch, msg.ReplyTo, msg.CorrelationId, *cachedResponse)
+		if cachedResponse, info, found := h.queryCache.Lookup(req.Query, req.Params); found {
+			log.Printf("[server] Cache HIT for query: %s", h.loggedQuery(req.Query, 50))
+			response := h.limitResponse(*cachedResponse)
+			response.Cache = info
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, responseFor(limitRows(response, req.RowLimit), req))
 			return
 		}
-		log.Printf("[server] Cache MISS for query: %s", truncateQuery(req.Query, 50))
+		log.Printf("[server] Cache MISS for query: %s", h.loggedQuery(req.Query, 50))
+
+		// Only store the results worth caching
+		cacheTTL, useCache = h.cachePolicy(req.Query)
 	}
 
 	var rows *sql.Rows
 	var err error
 
+	// Apply database-level limits for the request priority
+	query := h.prioritizeQuery(ctx, req)
+
+	// A priority that rewrites the SQL cannot reuse the prepared statement
+	if prepared != nil && query != req.Query {
+		prepared = nil
+	}
+
+	// Wait for a slot when the database already runs as many statements as allowed
+	releaseSlot, err := h.queryLimiter.Acquire(ctx)
+	if err != nil {
+		log.Printf("[server] Query from %s rejected: %v", req.ClientIP, err)
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error(), ErrorCode: ErrTooManyQueries})
+		return
+	}
+	defer releaseSlot()
+
+	// Statements run with Exec semantics report affected rows, not a result set
+	if exec {
+		h.handleExec(ctx, ch, msg, req, query, prepared, pinned)
+		return
+	}
+
+	// Measure execution time for the slow query log and statement statistics
+	queryStart := time.Now()
+	var rowCount int64
+	failed := true
+	defer func() {
+		h.recordStatement(req, time.Since(queryStart), rowCount, failed)
+	}()
+
 	// Check if this query should run within a transaction
 	if req.TransactionID != "" {
 		// Use transaction for query execution
-		transaction, exists := h.transactionManager.GetTransaction(req.TransactionID)
-		if !exists {
-			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
-				Error: fmt.Sprintf("transaction %s not found", req.TransactionID),
-			})
+		transaction, lookupErr := h.transactionManager.LookupTransaction(req.TransactionID)
+		if lookupErr != nil {
+			h.respondError(ch, msg, lookupErr)
 			return
 		}
 
 		// Execute query within transaction
-		rows, err = transaction.Tx.QueryContext(ctx, req.Query, req.Params...)
+		if prepared != nil {
+			txStmt := transaction.Tx.StmtContext(ctx, prepared)
+			defer txStmt.Close()
+			rows, err = txStmt.QueryContext(ctx, req.Params...)
+		} else {
+			rows, err = transaction.Tx.QueryContext(ctx, query, req.Params...)
+		}
+		if err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+			return
+		}
+		defer rows.Close()
+	} else if pinned != nil {
+		// Execute query on the session's connection
+		rows, err = pinned.conn.QueryContext(ctx, query, req.Params...)
 		if err != nil {
 			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
 			return
@@ -433,7 +1059,11 @@ func (h *Handler) handleSQL(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest)
 		}
 
 		// Execute query with parameter binding for security
-		rows, err = db.QueryContext(ctx, req.Query, req.Params...)
+		if prepared != nil {
+			rows, err = prepared.QueryContext(ctx, req.Params...)
+		} else {
+			rows, err = db.QueryContext(ctx, query, req.Params...)
+		}
 		if err != nil {
 			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
 			return
@@ -454,46 +1084,71 @@ func (h *Handler) handleSQL(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest)
 		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
 		return
 	}
+	columnTypes := describeColumns(colTypes)
+	binary := make([]bool, len(columnTypes))
+	for i, column := range columnTypes {
+		binary[i] = isBinaryType(column.DatabaseType)
+	}
 
 	var data [][]interface{}
+	budget := h.responseLimits.budget()
+	scanner := newRowScanner(h, colTypes, binary)
 	for rows.Next() {
-		// Create scan destinations for all columns
-		scanDest := make([]interface{}, len(cols))
-		for i := range scanDest {
-			scanDest[i] = new(interface{})
+		// Stop at the row limit unless the full result is needed for the cache
+		if req.RowLimit > 0 && len(data) >= req.RowLimit && !useCache {
+			break
 		}
 
-		// Scan row data into destinations
-		if err := rows.Scan(scanDest...); err != nil {
+		// Past the response limits, rows are only counted
+		if budget.full() {
+			budget.skip()
+			continue
+		}
+
+		// Scan the row, converting values for JSON serialization
+		row, err := scanner.scan(rows)
+		if err != nil {
 			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
 			return
 		}
-
-		// Convert and clean data types for JSON serialization
-		row := make([]interface{}, len(cols))
-		for i, val := range scanDest {
-			v := *(val.(*interface{}))
-			row[i] = h.convertDatabaseValue(v, colTypes[i])
+		if !budget.admit(row) {
+			continue
 		}
 		data = append(data, row)
 	}
 
+	// Log the query if it exceeded the slow query threshold
+	h.recordSlowQuery(req, time.Since(queryStart), len(data))
+	rowCount, failed = int64(len(data)), false
+
 	// Prepare response
 	response := RPCResponse{
-		Columns: cols,
-		Rows:    data,
+		Columns:     cols,
+		ColumnTypes: columnTypes,
+		Rows:        data,
+	}
+	budget.mark(&response)
+	if response.Truncated {
+		log.Printf("[server] Result of %s truncated to %d of %d rows", h.loggedQuery(req.Query, 50), len(data), response.TotalRows)
 	}
 
 	// Cache the result if applicable (only for read-only queries outside transactions)
 	if useCache {
-		h.queryCache.Set(req.Query, req.Params, response)
-		log.Printf("[server] Query result cached: %s", truncateQuery(req.Query, 50))
+		h.queryCache.SetWithTTL(req.Query, req.Params, response, cacheTTL)
+		log.Printf("[server] Query result cached for %v: %s", cacheTTL, h.loggedQuery(req.Query, 50))
+		response.Cache = &CacheInfo{TTLMs: cacheTTL.Milliseconds()}
 	}
 
 	// Send successful response with query results
-	h.respond(ch, msg.ReplyTo, msg.CorrelationId, response)
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, responseFor(limitRows(response, req.RowLimit), req))
 }
 
+// Text formats of MySQL DATE and DATETIME/TIMESTAMP values
+const (
+	mysqlDateFormat     = "2006-01-02"
+	mysqlDateTimeFormat = "2006-01-02 15:04:05.999999"
+)
+
 // convertDatabaseValue converts database values to appropriate JSON-serializable types.
 // This method handles the complexity of MySQL's type system and ensures consistent
 // data representation across different column types.
@@ -509,6 +1164,7 @@ func (h *Handler) handleSQL(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest)
 // - Numeric types: Convert to strings to preserve precision and avoid float precision issues
 // - Text types: Convert byte arrays to strings
 // - Native types: Pass through directly (int, float, bool, string)
+// - time.Time: Format as MySQL date or datetime text
 // - Unknown types: Convert to string representation
 func (h *Handler) convertDatabaseValue(val interface{}, colType *sql.ColumnType) interface{} {
 	if val == nil {
@@ -548,6 +1204,13 @@ func (h *Handler) convertDatabaseValue(val interface{}, colType *sql.ColumnType)
 		return v
 	case bool:
 		return v
+	case time.Time:
+		// Servers whose DSN has parseTime=true get dates as time.Time; send
+		// them in MySQL's own text format, as servers without it do
+		if colType.DatabaseTypeName() == "DATE" {
+			return v.Format(mysqlDateFormat)
+		}
+		return v.Format(mysqlDateTimeFormat)
 	default:
 		// Convert unknown types to string representation
 		return fmt.Sprintf("%v", v)
@@ -574,7 +1237,7 @@ func (h *Handler) handleCommand(ch *amqp.Channel, msg amqp.Delivery, req RPCRequ
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	log.Printf("[server] executing command: %s", req.Query)
+	log.Printf("[server] executing command: %s", h.loggedQuery(req.Query, 0))
 
 	// Parse command and arguments from request
 	// The command comes in req.Query and needs to be split into command and arguments
@@ -627,10 +1290,10 @@ func (h *Handler) handleCommand(ch *amqp.Channel, msg amqp.Delivery, req RPCRequ
 	}
 
 	// Send response with command output in tabular format
-	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, h.limitResponse(RPCResponse{
 		Columns: []string{"output"},
 		Rows:    rows,
-	})
+	}))
 
 	log.Printf("[server] command executed successfully, returned %d lines", len(rows))
 }
@@ -655,7 +1318,7 @@ func (h *Handler) handleFunction(ch *amqp.Channel, msg amqp.Delivery, req RPCReq
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	log.Printf("[server] executing function: %s", req.Query)
+	log.Printf("[server] executing function: %s", h.loggedRequest(req))
 
 	// Parse function request from JSON in req.Query
 	var funcReq FunctionRequest
@@ -669,9 +1332,14 @@ func (h *Handler) handleFunction(ch *amqp.Channel, msg amqp.Delivery, req RPCReq
 	// Execute the requested function with parameter conversion
 	result, err := h.executeFunction(ctx, funcReq)
 	if err != nil {
-		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
-			Error: fmt.Sprintf("function execution failed: %v", err),
-		})
+		resp := RPCResponse{Error: fmt.Sprintf("function execution failed: %v", err)}
+		var panicErr *FunctionPanicError
+		if errors.As(err, &panicErr) {
+			resp.ErrorCode = ErrFunctionPanic
+		} else if errors.Is(err, context.DeadlineExceeded) {
+			resp.ErrorCode = ErrFunctionTimeout
+		}
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, resp)
 		return
 	}
 
@@ -679,10 +1347,10 @@ func (h *Handler) handleFunction(ch *amqp.Channel, msg amqp.Delivery, req RPCReq
 	columns, rows := h.convertFunctionResult(result)
 
 	// Send successful response with function results
-	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, h.limitResponse(RPCResponse{
 		Columns: columns,
 		Rows:    rows,
-	})
+	}))
 
 	log.Printf("[server] function executed successfully")
 }
@@ -724,8 +1392,11 @@ func (h *Handler) executeFunction(ctx context.Context, funcReq FunctionRequest)
 		return nil, fmt.Errorf("error preparing parameters: %v", err)
 	}
 
-	// Execute function using reflection
-	results := funcValue.Call(params)
+	// Execute function using reflection, isolated from panics and hangs
+	results, err := h.callFunction(ctx, funcReq.Name, funcValue, params)
+	if err != nil {
+		return nil, err
+	}
 
 	// Convert all return values to interface{} slice
 	var output []interface{}
@@ -1000,22 +1671,90 @@ func (h *Handler) formatResult(result interface{}) interface{} {
 // responses are properly matched to their originating requests.
 // Content-Type is set to "application/json" for proper client deserialization.
 func (h *Handler) respond(ch *amqp.Channel, replyTo, corrID string, resp RPCResponse) {
-	// Serialize response to JSON
-	body, _ := json.Marshal(resp)
+	// Attach the outcome to the audit record of this request, if any
+	h.recordAuditResponse(corrID, &resp)
+
+	// Tell the client how much of its rate limit budget is left
+	if info, ok := h.rateLimitInFlight.Load(corrID); ok {
+		budget := info.(RateLimitInfo)
+		resp.RateLimit = &budget
+	}
+
+	// Name the instance so clients can route the rest of a transaction to it
+	if h.cluster != nil {
+		resp.Instance = h.cluster.config.InstanceID
+	}
+
+	// Keep the response to a numbered transaction statement for redeliveries
+	h.recordTxReply(corrID, resp)
+
+	// Keep the response to a tracked write for redeliveries
+	h.recordDeliveryReply(corrID, resp)
+
+	if resp.Error != "" {
+		h.workerPool.recordFailure()
+	}
+
+	// Serialize response to JSON into a pooled buffer. RabbitMQ has written
+	// the body out when publishResponse returns; other transports may keep
+	// it, so their buffer is not reused.
+	buf := getResponseBuffer()
+	body, err := appendResponse(*buf, resp)
+	if err != nil {
+		log.Printf("[server] Failed to encode response %s: %v", corrID, err)
+		body, _ = json.Marshal(RPCResponse{Error: fmt.Sprintf("failed to encode response: %v", err)})
+	}
+	if h.transport == nil {
+		*buf = body
+		defer putResponseBuffer(buf)
+	}
 
 	// Publish response to client's reply queue
-	ch.PublishWithContext(context.Background(), "", replyTo, false, false, amqp.Publishing{
+	h.publishResponse(ch, replyTo, amqp.Publishing{
 		ContentType:   "application/json", // Indicate JSON content for client parsing
 		CorrelationId: corrID,             // Match response to original request
 		Body:          body,               // Serialized response data
 	})
 }
 
+// respondError sends an error response, attaching a machine-readable error code
+// when the error carries one (see TxError).
+//
+// Parameters:
+//   - ch: RabbitMQ channel for publishing
+//   - msg: The original message for reply routing
+//   - err: The error to report to the client
+func (h *Handler) respondError(ch *amqp.Channel, msg amqp.Delivery, err error) {
+	resp := RPCResponse{Error: err.Error()}
+
+	var txErr *TxError
+	if errors.As(err, &txErr) {
+		resp.ErrorCode = txErr.Code
+	}
+
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, resp)
+}
+
+// acquireDB returns a database handle for background work. In "open" mode it
+// is the shared pool; in "close" mode a dedicated connection is opened and
+// must be released with the returned function.
+func (h *Handler) acquireDB() (*sql.DB, func(), error) {
+	if h.mode == "open" && h.db != nil {
+		return h.db, func() {}, nil
+	}
+
+	db, err := sql.Open("mysql", h.mysqlDSN)
+	if err != nil {
+		return nil, nil, err
+	}
+	return db, func() { db.Close() }, nil
+}
+
 // transactionCleanupLoop runs a periodic cleanup of expired transactions.
 // It prevents memory leaks and database connection exhaustion by rolling back
-// transactions that have been inactive for too long.
+// transactions that have been inactive or open for too long.
 func (h *Handler) transactionCleanupLoop(ctx context.Context) {
-	ticker := time.NewTicker(5 * time.Minute) // Cleanup every 5 minutes
+	ticker := time.NewTicker(h.transactionManager.Config().CleanupInterval)
 	defer ticker.Stop()
 
 	for {
@@ -1024,8 +1763,26 @@ func (h *Handler) transactionCleanupLoop(ctx context.Context) {
 			log.Printf("[server] Transaction cleanup loop shutting down...")
 			return
 		case <-ticker.C:
-			// Clean up transactions older than 30 minutes
-			h.transactionManager.CleanupExpiredTransactions(30 * time.Minute)
+			// Roll back transactions past their idle timeout or lifetime
+			h.transactionManager.ExpireTransactions()
+
+			// Release the state of sessions whose client is gone
+			h.expireSessions()
+
+			// Drop session settings of idle clients
+			if removed := h.sessionSettings.Cleanup(); removed > 0 {
+				log.Printf("[server] Removed settings of %d idle sessions", removed)
+			}
+
+			// Close prepared statements no client executed for a while
+			if removed := h.preparedStatements.Cleanup(); removed > 0 {
+				log.Printf("[server] Closed %d idle prepared statements", removed)
+			}
+
+			// Forget processed deliveries past the dedupe window
+			if h.storage == nil {
+				h.deliveryFallback.PurgeExpired(ctx)
+			}
 		}
 	}
 }
@@ -1067,15 +1824,72 @@ func (h *Handler) GetCacheStats() CacheStats {
 }
 
 // ClearCache clears all cached query results.
+// In cluster mode the other instances clear theirs too.
 func (h *Handler) ClearCache() {
 	h.queryCache.Clear()
+	if h.cluster != nil {
+		h.cluster.broadcast(clusterMessage{Type: "cache_clear"})
+	}
 }
 
-// SetCacheConfig updates the cache configuration.
-// Note: This creates a new cache instance, clearing all existing cached data.
+// SetCacheConfig updates the cache configuration. The running cache is
+// reconfigured in place and keeps its entries unless it is disabled.
 func (h *Handler) SetCacheConfig(config QueryCacheConfig) {
-	h.queryCache = NewQueryCache(config)
-	log.Printf("[server] Cache configuration updated")
+	h.queryCache.SetConfig(config)
+	config = h.queryCache.currentConfig()
+	log.Printf("[server] Cache configuration updated: enabled=%v maxSize=%d ttl=%v",
+		config.Enabled, config.MaxSize, config.TTL)
+	if config.Adaptive {
+		log.Printf("[server] Adaptive caching: queries cached after %d executions averaging %v or more",
+			config.AdaptiveMinExecutions, config.AdaptiveMinLatency)
+	}
+}
+
+// SetClock replaces the time source of the query cache, rate limiter,
+// transaction expiry and heartbeat tracking, so their timing can be driven by
+// a fake clock (see clock/clocktest) in tests. Subsystems created later by
+// the Set*Config methods, such as the task scheduler, use it too.
+func (h *Handler) SetClock(c clock.Clock) {
+	h.clock = clock.OrReal(c)
+	h.queryCache.SetClock(h.clock)
+	h.rateLimiter.SetClock(h.clock)
+	h.transactionManager.SetClock(h.clock)
+	if h.heartbeatManager != nil {
+		h.heartbeatManager.SetClock(h.clock)
+	}
+}
+
+// SetNamespace applies a name prefix (e.g. "prod.siteA.") to every queue and
+// exchange used by this device, so several environments can share one
+// RabbitMQ cluster. Call before starting the server; clients must use the
+// same namespace in their DSN.
+func (h *Handler) SetNamespace(namespace string) error {
+	topology, err := client.NewTopology(namespace, h.deviceID)
+	if err != nil {
+		return err
+	}
+
+	h.namespace = topology.Namespace
+	h.rpcQueueName = topology.RPCQueue
+	h.heartbeatQueueName = topology.HeartbeatQueue
+	h.eventsExchangeName = topology.EventsExchange
+	h.telemetryExchangeName = topology.TelemetryExchange
+	log.Printf("[server] Namespace configured: '%s' (rpc=%s heartbeat=%s)", namespace, h.rpcQueueName, h.heartbeatQueueName)
+	return nil
+}
+
+// SetVHost points the server at a RabbitMQ virtual host, overriding the vhost
+// in the AMQP URL. Use it to isolate tenants by vhost; clients must pass the
+// same vhost in their DSN. Call before starting the server.
+func (h *Handler) SetVHost(vhost string) error {
+	amqpURL, err := client.ApplyVHost(h.amqpURL, vhost)
+	if err != nil {
+		return err
+	}
+
+	h.amqpURL = amqpURL
+	log.Printf("[server] RabbitMQ vhost configured: '%s'", vhost)
+	return nil
 }
 
 // SetWorkerPoolConfig updates the worker pool configuration.
@@ -1086,12 +1900,29 @@ func (h *Handler) SetWorkerPoolConfig(config *WorkerPoolConfig) {
 		config.WorkerCount, config.QueueSize)
 }
 
-// SetRateLimiterConfig updates the rate limiter configuration.
-// Note: This creates a new rate limiter instance. Call before starting the server.
+// GetWorkerPoolStats returns current worker pool statistics: queue depth,
+// active workers, tasks processed, failed and rejected, and mean latencies.
+func (h *Handler) GetWorkerPoolStats() WorkerPoolStats {
+	return h.workerPool.GetStats()
+}
+
+// SetRateLimiterConfig updates the rate limiter configuration. The running
+// rate limiter is reconfigured in place, so it is safe to call on a running
+// server: clients keep their buckets and the tokens left in them.
 func (h *Handler) SetRateLimiterConfig(config *RateLimiterConfig) {
-	h.rateLimiter = NewRateLimiter(config)
+	h.rateLimiter.SetConfig(config)
 	log.Printf("[server] Rate limiter configuration updated: %d req/s, burst %d",
 		config.RequestsPerSecond, config.BurstSize)
+	if config.Mode == RateLimitDelay {
+		log.Printf("[server] Rate limiter delays requests up to %v for a token", config.MaxDelay)
+	}
+}
+
+// GetRateLimiterStats returns current rate limiter statistics: the
+// configured limits, requests allowed and rejected, and the tokens left and
+// rejections of every client, most rejected first.
+func (h *Handler) GetRateLimiterStats() RateLimiterStats {
+	return h.rateLimiter.GetStats()
 }
 
 // GetSQLValidationStats returns current SQL validation statistics.
@@ -1104,6 +1935,9 @@ func (h *Handler) SetSQLValidationConfig(config SQLValidationConfig) {
 	h.sqlValidator.UpdateConfig(config)
 	log.Printf("[server] SQL validation configuration updated: enabled=%v, strict=%v",
 		config.Enabled, config.StrictMode)
+	if len(config.RiskActions) > 0 {
+		log.Printf("[server] SQL validation risk actions: %s", formatRiskActions(config.RiskActions))
+	}
 }
 
 // GetHeartbeatStats returns heartbeat statistics
@@ -1111,7 +1945,22 @@ func (h *Handler) GetHeartbeatStats() ServerHeartbeatStats {
 	return h.heartbeatManager.GetStats()
 }
 
-// GetActiveClients returns information about active client connections
+// GetActiveClients returns information about active client connections,
+// with the open transactions of the sessions each one is bound to
 func (h *Handler) GetActiveClients() map[string]*ClientHeartbeatInfo {
-	return h.heartbeatManager.GetActiveClients()
+	active := h.heartbeatManager.GetActiveClients()
+	if h.sessions != nil {
+		for identity, count := range h.sessions.openTransactionsByClient() {
+			if info := active[identity]; info != nil {
+				info.OpenTransactions = count
+			}
+		}
+	}
+	return active
+}
+
+// GetActiveTransactions returns the transactions open on this server, oldest
+// first, to spot leaked or long-running ones
+func (h *Handler) GetActiveTransactions() []TransactionInfo {
+	return h.transactionManager.ActiveTransactions()
 }
@@ -2,6 +2,7 @@ package server
 
 import (
 	"context"
+	"fmt"
 	"log"
 )
 
@@ -19,34 +20,284 @@ func NewServerFactory(config *ServerConfig) *ServerFactory {
 
 // CreateServer creates a fully configured server with all components
 func (sf *ServerFactory) CreateServer() (*Handler, *MonitoringManager, error) {
+	// Keep credentials out of the logs from the first line on
+	if sf.config.RedactLogs {
+		EnableLogRedaction()
+	}
+
+	// Resolve secret references of the connection settings
+	amqpURL, err := sf.config.ToAMQPURL()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve AMQP URL: %w", err)
+	}
+	mysqlDSN, err := sf.config.ToMySQLDSN()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to resolve MySQL DSN: %w", err)
+	}
+
 	// Create handler with advanced configuration
 	handler := NewHandler(
 		sf.config.DeviceID,
-		sf.config.AMQPURL,
-		sf.config.MySQLDSN,
+		amqpURL,
+		mysqlDSN,
 		"open",
 		sf.config.ToPoolConfig(),
 	)
 
+	// Configure tenant vhost
+	if sf.config.VHost != "" {
+		if err := handler.SetVHost(sf.config.VHost); err != nil {
+			return nil, nil, fmt.Errorf("failed to configure vhost: %w", err)
+		}
+	}
+
+	// Configure queue and exchange namespace
+	if err := handler.SetNamespace(sf.config.Namespace); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure namespace: %w", err)
+	}
+
+	// Configure old device IDs answered during a rename
+	if err := handler.SetDeviceAliases(sf.config.ToDeviceAliases()); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure device aliases: %w", err)
+	}
+
+	// Configure durability and arguments of the device queues
+	if err := handler.SetQueueConfig(sf.config.ToQueueConfig()); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure queues: %w", err)
+	}
+
+	// Configure request acknowledgement
+	if err := handler.SetAckConfig(sf.config.ToAckConfig()); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure acknowledgements: %w", err)
+	}
+
+	// Configure replay protection
+	replayConfig, err := sf.config.ToReplayProtectionConfig()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to configure replay protection: %w", err)
+	}
+	if err := handler.SetReplayProtectionConfig(replayConfig); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure replay protection: %w", err)
+	}
+
+	// Configure publisher confirms for responses
+	handler.SetResponseConfirmConfig(sf.config.ToResponseConfirmConfig())
+
+	// Configure the maximum size of results
+	handler.SetResponseLimits(sf.config.ToResponseLimitConfig())
+
 	// Configure query cache
+	if _, err := ParseCacheTTLOverrides(sf.config.CacheTTLOverrides); err != nil {
+		return nil, nil, err
+	}
+	if sf.config.CacheAdaptive && !sf.config.QueryStats {
+		log.Printf("[server] Warning: adaptive caching needs query statistics; only queries with TTL overrides will be cached")
+	}
 	handler.SetCacheConfig(sf.config.ToQueryCacheConfig())
 
 	// Configure SQL validation
+	if err := ValidateValidationPatterns(sf.config.ValidationRules); err != nil {
+		return nil, nil, err
+	}
+	if _, err := ParseRiskActions(sf.config.RiskActions); err != nil {
+		return nil, nil, err
+	}
 	handler.SetSQLValidationConfig(sf.config.ToSQLValidationConfig())
+	handler.SetApprovalConfig(sf.config.ToApprovalConfig())
+
+	// Configure slow query log
+	handler.SetSlowQueryConfig(sf.config.ToSlowQueryConfig())
+	handler.SetQueryStatsConfig(sf.config.ToQueryStatsConfig())
+
+	// Configure index suggestions for slow queries
+	handler.SetIndexAdvisorConfig(sf.config.ToIndexAdvisorConfig())
+
+	// Configure table statistics collection
+	handler.SetTableStatsConfig(sf.config.ToTableStatsConfig())
+
+	// Configure host telemetry reporting
+	handler.SetTelemetryConfig(sf.config.ToTelemetryConfig())
+
+	// Configure request priority mapping
+	handler.SetPriorityConfig(sf.config.ToPriorityConfig())
+	handler.SetProgressConfig(sf.config.ToProgressConfig())
+
+	// Configure per-client session settings
+	handler.SetSessionSettingsConfig(sf.config.ToSessionSettingsConfig())
+
+	// Configure asynchronous jobs
+	handler.SetJobConfig(sf.config.ToJobConfig())
+
+	// Configure CSV/NDJSON exports
+	handler.SetExportConfig(sf.config.ToExportConfig())
+
+	// Configure paginated result sets
+	handler.SetCursorConfig(sf.config.ToCursorConfig())
 
 	// Configure worker pool
 	handler.SetWorkerPoolConfig(sf.config.ToWorkerPoolConfig())
 
 	// Configure rate limiter
+	if err := ValidateRateLimitMode(sf.config.RateLimitMode); err != nil {
+		return nil, nil, err
+	}
 	handler.SetRateLimiterConfig(sf.config.ToRateLimiterConfig())
 
+	// Configure the limit on concurrent SQL statements
+	handler.SetQueryLimiterConfig(sf.config.ToQueryLimiterConfig())
+
+	// Configure memory and CPU guardrails
+	handler.SetLoadSheddingConfig(sf.config.ToLoadSheddingConfig())
+
+	// Configure client IP allow and deny lists
+	if err := handler.SetIPFilterConfig(sf.config.ToIPFilterConfig()); err != nil {
+		return nil, nil, err
+	}
+
+	// Configure shared storage before the subsystems that persist into it
+	if err := handler.SetStorageConfig(sf.config.ToStorageConfig()); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure storage: %w", err)
+	}
+
+	// Configure audit log
+	if err := handler.SetAuditConfig(sf.config.ToAuditConfig()); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure audit log: %w", err)
+	}
+
+	// Configure masking of logged query values
+	handler.SetLogRedaction(sf.config.RedactQueryLogs)
+
+	// Configure maintenance tasks
+	if sf.config.MaintenanceConfigFile != "" {
+		maintenanceConfig, err := LoadMaintenanceConfig(sf.config.MaintenanceConfigFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := handler.SetMaintenanceConfig(maintenanceConfig); err != nil {
+			return nil, nil, fmt.Errorf("failed to configure maintenance: %w", err)
+		}
+	}
+
+	// Configure data retention rules
+	if sf.config.RetentionConfigFile != "" {
+		retentionConfig, err := LoadRetentionConfig(sf.config.RetentionConfigFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := handler.SetRetentionConfig(retentionConfig); err != nil {
+			return nil, nil, fmt.Errorf("failed to configure retention: %w", err)
+		}
+	}
+
+	// Configure change data capture
+	if sf.config.CDCConfigFile != "" {
+		cdcConfig, err := LoadCDCConfig(sf.config.CDCConfigFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := handler.SetCDCConfig(cdcConfig); err != nil {
+			return nil, nil, fmt.Errorf("failed to configure CDC: %w", err)
+		}
+	}
+
+	// Configure recurring tasks
+	if len(sf.config.ScheduledTasks) > 0 {
+		if err := handler.SetSchedulerConfig(sf.config.ToSchedulerConfig()); err != nil {
+			return nil, nil, fmt.Errorf("failed to configure scheduled tasks: %w", err)
+		}
+	}
+
+	// Configure the on_behalf_of impersonation policy
+	if sf.config.ImpersonationConfigFile != "" {
+		impersonationConfig, err := LoadImpersonationConfig(sf.config.ImpersonationConfigFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := handler.SetImpersonationConfig(impersonationConfig); err != nil {
+			return nil, nil, fmt.Errorf("failed to configure impersonation: %w", err)
+		}
+	}
+
+	// Configure role-based access to request types
+	if sf.config.AccessControlConfigFile != "" {
+		accessControlConfig, err := LoadAccessControlConfig(sf.config.AccessControlConfigFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := handler.SetAccessControlConfig(accessControlConfig); err != nil {
+			return nil, nil, fmt.Errorf("failed to configure access control: %w", err)
+		}
+	}
+
+	// Configure validation of client tokens
+	tokenAuthConfig, err := sf.config.ToTokenAuthConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	if tokenAuthConfig.Enabled() {
+		if err := handler.SetTokenAuthConfig(tokenAuthConfig); err != nil {
+			return nil, nil, fmt.Errorf("failed to configure token authentication: %w", err)
+		}
+	}
+
+	// Configure file transfers
+	if sf.config.FileTransferConfigFile != "" {
+		fileTransferConfig, err := LoadFileTransferConfig(sf.config.FileTransferConfigFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := handler.SetFileTransferConfig(fileTransferConfig); err != nil {
+			return nil, nil, fmt.Errorf("failed to configure file transfer: %w", err)
+		}
+	}
+
+	// Configure log tailing
+	if sf.config.LogTailConfigFile != "" {
+		logTailConfig, err := LoadLogTailConfig(sf.config.LogTailConfigFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		if err := handler.SetLogTailConfig(logTailConfig); err != nil {
+			return nil, nil, fmt.Errorf("failed to configure log tail: %w", err)
+		}
+	}
+
+	// Configure active/active operation
+	if err := handler.SetClusterConfig(sf.config.ToClusterConfig()); err != nil {
+		return nil, nil, fmt.Errorf("failed to configure cluster: %w", err)
+	}
+
+	// Configure transaction expiry
+	handler.SetTransactionConfig(sf.config.ToTransactionConfig())
+
+	// Configure rolling upgrade handovers
+	handler.SetHandoverConfig(sf.config.ToHandoverConfig())
+
+	// Remove the built-in monitoring functions when not wanted
+	if !sf.config.MonitoringFunctions {
+		handler.SetMonitoringFunctions(false)
+	}
+
+	// Configure the debug endpoints
+	handler.SetDebugConfig(sf.config.ToDebugConfig())
+
 	// Configure heartbeat manager with custom configuration
 	heartbeatConfig := sf.config.ToHeartbeatConfig()
 	handler.heartbeatManager = NewServerHeartbeatManager(sf.config.DeviceID, heartbeatConfig)
 
 	// Create monitoring manager
+	if err := ValidateMonitoringFormat(sf.config.MonitoringFormat); err != nil {
+		return nil, nil, err
+	}
 	monitoringManager := NewMonitoringManager(handler, sf.config)
 
+	// Post monitoring alerts to the configured webhooks
+	alertConfig, err := sf.config.ToAlertConfig()
+	if err != nil {
+		return nil, nil, err
+	}
+	monitoringManager.SetAlertConfig(alertConfig)
+
 	// Register comprehensive monitoring functions
 	monitoringManager.RegisterMonitoringFunctions()
 
@@ -67,6 +318,12 @@ func (sf *ServerFactory) StartServer(ctx context.Context) error {
 	// Start monitoring
 	monitoringManager.Start()
 
+	// Watch the configuration file for live changes
+	if sf.config.ConfigFile != "" {
+		reloader := NewConfigReloader(handler, sf.config, sf.config.ConfigFile, sf.config.ConfigReloadInterval)
+		go reloader.Start(ctx)
+	}
+
 	// Start server
 	log.Printf("🚀 Starting Full-Featured Enterprise Server...")
 	return handler.Start(ctx)
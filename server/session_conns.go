@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+// pinnedConn is a database connection dedicated to one client session.
+// Session-scoped statements (SET, USE) change the state of the connection
+// they run on, so once a session sends one, every later statement of the
+// session outside a transaction runs on the same connection.
+type pinnedConn struct {
+	mutex   sync.Mutex // Held while a statement of the session runs and its rows are read
+	conn    *sql.Conn
+	release func() // Releases the database handle the connection came from
+}
+
+// discard closes the connection without returning it to the pool, where
+// its session state would leak to other clients
+func (p *pinnedConn) discard() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	p.conn.Close()
+	p.release()
+}
+
+// isSessionStatement reports whether query changes the state of the
+// connection it runs on: USE, and SET of session or user variables (not
+// SET GLOBAL or SET PERSIST, which change the server)
+func isSessionStatement(query string) bool {
+	words := strings.Fields(strings.ToUpper(strings.TrimSpace(query)))
+	if len(words) < 2 {
+		return false
+	}
+	switch words[0] {
+	case "USE":
+		return true
+	case "SET":
+		switch {
+		case words[1] == "GLOBAL", words[1] == "PERSIST", words[1] == "PERSIST_ONLY",
+			strings.HasPrefix(words[1], "@@GLOBAL."), strings.HasPrefix(words[1], "@@PERSIST"):
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// sessionConn returns the connection pinned to the request's session,
+// pinning one when the request is a session-scoped statement. It returns
+// nil when statements of the session may use any pooled connection. The
+// returned connection is locked; unlock it when the statement's rows have
+// been read.
+func (h *Handler) sessionConn(ctx context.Context, principal string, req RPCRequest) (*pinnedConn, error) {
+	pin := isSessionStatement(req.Query)
+	if req.SessionID == "" {
+		if pin {
+			return nil, fmt.Errorf("SET and USE statements require a client session (protocol version 2); outside one they would run on an arbitrary pooled connection")
+		}
+		return nil, nil
+	}
+
+	identity := sessionIdentity(principal, req.SessionID)
+	var pinned *pinnedConn
+	var open bool
+	h.sessions.update(identity, func(session *clientSession) {
+		open = true
+		pinned = session.pinned
+	})
+	if pinned == nil && pin {
+		if !open {
+			return nil, fmt.Errorf("SET and USE statements require an open session; reconnect to open one")
+		}
+		if h.cluster != nil {
+			return nil, fmt.Errorf("SET and USE statements are not supported in cluster mode")
+		}
+
+		var err error
+		pinned, err = h.pinSessionConn(ctx, identity)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if pinned == nil {
+		return nil, nil
+	}
+
+	pinned.mutex.Lock()
+	return pinned, nil
+}
+
+// pinSessionConn dedicates a database connection to the session of identity
+func (h *Handler) pinSessionConn(ctx context.Context, identity string) (*pinnedConn, error) {
+	db, release, err := h.acquireDB()
+	if err != nil {
+		return nil, err
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("failed to reserve a connection for the session: %w", err)
+	}
+	pinned := &pinnedConn{conn: conn, release: release}
+
+	// Another request of the session may have pinned one meanwhile
+	var existing *pinnedConn
+	var open bool
+	h.sessions.update(identity, func(session *clientSession) {
+		open = true
+		if session.pinned == nil {
+			session.pinned = pinned
+		}
+		existing = session.pinned
+	})
+	if !open || existing != pinned {
+		pinned.discard()
+		if !open {
+			return nil, fmt.Errorf("session closed while reserving its connection")
+		}
+		return existing, nil
+	}
+
+	log.Printf("[server] Connection pinned to session %s", identity)
+	return pinned, nil
+}
@@ -0,0 +1,344 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Session setting keys understood by the server. Other keys matching
+// sessionKeyPattern are stored as-is and returned by GET.
+const (
+	SessionRowLimit = "row_limit" // Maximum rows returned per SQL query
+	SessionPriority = "priority"  // Default request priority (high, normal, low)
+	SessionLocale   = "locale"    // Client locale, e.g. "es_AR" (informational)
+)
+
+// sessionKeyPattern matches custom session setting keys
+var sessionKeyPattern = regexp.MustCompile(`^[a-z][a-z0-9_.-]{0,63}$`)
+
+// localePattern matches locale identifiers like "en", "pt_BR" or "es-419"
+var localePattern = regexp.MustCompile(`^[A-Za-z]{2,3}([_-][A-Za-z0-9]{2,8})*$`)
+
+// maxSessionValueLength bounds a single setting value
+const maxSessionValueLength = 1024
+
+// SessionSettingsConfig holds configuration for per-client session settings
+type SessionSettingsConfig struct {
+	TTL         time.Duration // Idle time after which a session's settings are dropped
+	MaxSessions int           // Maximum number of sessions kept at once
+	MaxKeys     int           // Maximum settings per session
+}
+
+// DefaultSessionSettingsConfig returns the default session settings configuration
+func DefaultSessionSettingsConfig() SessionSettingsConfig {
+	return SessionSettingsConfig{
+		TTL:         30 * time.Minute,
+		MaxSessions: 1000,
+		MaxKeys:     32,
+	}
+}
+
+// SessionRequest is the body of a "session" request
+type SessionRequest struct {
+	Action   string `json:"action"`   // "open", "set", "get", "clear" or "close"
+	Key      string `json:"key"`      // Setting to change (set only)
+	Value    string `json:"value"`    // New value; empty removes the setting (set only)
+	ClientID string `json:"clientID"` // Heartbeat client ID of the connection opening the session (open only)
+
+	ClientIP  string `json:"clientIP,omitempty"`  // Address of the connection opening the session (open only)
+	PingQueue string `json:"pingQueue,omitempty"` // Queue the connection answers server pings on (open only)
+}
+
+// sessionSettings holds the settings of one session
+type sessionSettings struct {
+	values   map[string]string
+	lastUsed time.Time
+}
+
+// SessionSettingsStore keeps per-client settings that apply to every request
+// of the session until it has been idle for longer than the TTL.
+type SessionSettingsStore struct {
+	config   SessionSettingsConfig
+	mutex    sync.Mutex
+	sessions map[string]*sessionSettings // identity -> settings
+}
+
+// NewSessionSettingsStore creates a new session settings store
+func NewSessionSettingsStore(config SessionSettingsConfig) *SessionSettingsStore {
+	defaults := DefaultSessionSettingsConfig()
+	if config.TTL <= 0 {
+		config.TTL = defaults.TTL
+	}
+	if config.MaxSessions <= 0 {
+		config.MaxSessions = defaults.MaxSessions
+	}
+	if config.MaxKeys <= 0 {
+		config.MaxKeys = defaults.MaxKeys
+	}
+	return &SessionSettingsStore{
+		config:   config,
+		sessions: make(map[string]*sessionSettings),
+	}
+}
+
+// sessionIdentity scopes a client session ID to the authenticated principal,
+// so a session ID leaked to another AMQP user is useless to it.
+func sessionIdentity(principal, sessionID string) string {
+	return principal + "|" + sessionID
+}
+
+// lookup returns the live settings of identity, dropping them if expired
+func (s *SessionSettingsStore) lookup(identity string, now time.Time) *sessionSettings {
+	session, ok := s.sessions[identity]
+	if !ok {
+		return nil
+	}
+	if now.Sub(session.lastUsed) > s.config.TTL {
+		delete(s.sessions, identity)
+		return nil
+	}
+	session.lastUsed = now
+	return session
+}
+
+// Get returns a copy of the settings of identity and refreshes its expiry
+func (s *SessionSettingsStore) Get(identity string) map[string]string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	session := s.lookup(identity, time.Now())
+	if session == nil {
+		return nil
+	}
+	values := make(map[string]string, len(session.values))
+	for k, v := range session.values {
+		values[k] = v
+	}
+	return values
+}
+
+// Set validates and stores a setting; an empty value removes it
+func (s *SessionSettingsStore) Set(identity, key, value string) error {
+	if err := validateSessionSetting(key, value); err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	session := s.lookup(identity, now)
+	if session == nil {
+		if value == "" {
+			return nil
+		}
+		if len(s.sessions) >= s.config.MaxSessions {
+			s.removeExpired(now)
+		}
+		if len(s.sessions) >= s.config.MaxSessions {
+			return fmt.Errorf("too many active sessions (max %d)", s.config.MaxSessions)
+		}
+		session = &sessionSettings{values: make(map[string]string), lastUsed: now}
+		s.sessions[identity] = session
+	}
+
+	if value == "" {
+		delete(session.values, key)
+		return nil
+	}
+	if _, exists := session.values[key]; !exists && len(session.values) >= s.config.MaxKeys {
+		return fmt.Errorf("too many session settings (max %d)", s.config.MaxKeys)
+	}
+	session.values[key] = value
+	return nil
+}
+
+// Clear removes every setting of identity
+func (s *SessionSettingsStore) Clear(identity string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.sessions, identity)
+}
+
+// removeExpired drops idle sessions; the caller must hold the mutex
+func (s *SessionSettingsStore) removeExpired(now time.Time) int {
+	removed := 0
+	for identity, session := range s.sessions {
+		if now.Sub(session.lastUsed) > s.config.TTL {
+			delete(s.sessions, identity)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Cleanup drops idle sessions and returns how many were removed
+func (s *SessionSettingsStore) Cleanup() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.removeExpired(time.Now())
+}
+
+// Len returns the number of stored sessions
+func (s *SessionSettingsStore) Len() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.sessions)
+}
+
+// validateSessionSetting checks the key and, for known keys, the value
+func validateSessionSetting(key, value string) error {
+	if !sessionKeyPattern.MatchString(key) {
+		return fmt.Errorf("invalid session setting name '%s'", key)
+	}
+	if len(value) > maxSessionValueLength {
+		return fmt.Errorf("session setting '%s' exceeds %d bytes", key, maxSessionValueLength)
+	}
+	if value == "" {
+		return nil
+	}
+
+	switch key {
+	case SessionRowLimit:
+		if limit, err := strconv.Atoi(value); err != nil || limit <= 0 {
+			return fmt.Errorf("%s must be a positive integer", SessionRowLimit)
+		}
+	case SessionPriority:
+		if !validPriority(value) {
+			return fmt.Errorf("%s must be 'high', 'normal' or 'low'", SessionPriority)
+		}
+	case SessionLocale:
+		if !localePattern.MatchString(value) {
+			return fmt.Errorf("invalid %s '%s'", SessionLocale, value)
+		}
+	}
+	return nil
+}
+
+// SetSessionSettingsConfig replaces the session settings store
+func (h *Handler) SetSessionSettingsConfig(config SessionSettingsConfig) {
+	h.sessionSettings = NewSessionSettingsStore(config)
+	log.Printf("[server] Session settings configured: TTL=%v, MaxSessions=%d, MaxKeys=%d",
+		h.sessionSettings.config.TTL, h.sessionSettings.config.MaxSessions, h.sessionSettings.config.MaxKeys)
+}
+
+// applySessionSettings fills request options the client left empty from
+// the settings of its session.
+func (h *Handler) applySessionSettings(principal string, req RPCRequest) RPCRequest {
+	if req.SessionID == "" {
+		return req
+	}
+
+	values := h.sessionSettings.Get(sessionIdentity(principal, req.SessionID))
+	if req.Priority == "" {
+		req.Priority = values[SessionPriority]
+	}
+	if req.RowLimit == 0 && values[SessionRowLimit] != "" {
+		req.RowLimit, _ = strconv.Atoi(values[SessionRowLimit])
+	}
+	return req
+}
+
+// handleSession processes "session" requests that open or close the
+// client's session, or read or change its settings.
+func (h *Handler) handleSession(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	var sessionReq SessionRequest
+	if err := json.Unmarshal([]byte(req.Query), &sessionReq); err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error: fmt.Sprintf("invalid session request: %v", err),
+		})
+		return
+	}
+
+	// Opening a session without an ID issues one
+	if sessionReq.Action == "open" {
+		h.openSession(ch, msg, req, sessionReq)
+		return
+	}
+
+	if req.SessionID == "" {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "session requests require a session ID"})
+		return
+	}
+
+	identity := sessionIdentity(msg.UserId, req.SessionID)
+	switch sessionReq.Action {
+	case "set":
+		if err := h.sessionSettings.Set(identity, sessionReq.Key, sessionReq.Value); err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+			return
+		}
+	case "get":
+	case "clear":
+		h.sessionSettings.Clear(identity)
+	case "close":
+		if session := h.sessions.remove(identity); session != nil {
+			h.releaseSession(identity, session, "closed by client")
+		} else {
+			h.sessionSettings.Clear(identity)
+		}
+	default:
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error: fmt.Sprintf("unsupported session action: %s", sessionReq.Action),
+		})
+		return
+	}
+
+	// Every action answers with the resulting settings
+	values := h.sessionSettings.Get(identity)
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	rows := make([][]interface{}, 0, len(keys))
+	for _, key := range keys {
+		rows = append(rows, []interface{}{key, values[key]})
+	}
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"key", "value"},
+		Rows:    rows,
+	})
+}
+
+// openSession registers the client's session, issuing its ID when the
+// client has none, and binds the heartbeats of the opening connection to it.
+// A connection that names a ping queue is registered for server pings. The
+// response tells the client whether its heartbeats keep the session and
+// whether the server pings it, so it need not send PINGs between queries.
+func (h *Handler) openSession(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest, sessionReq SessionRequest) {
+	sessionID := req.SessionID
+	if sessionID == "" {
+		sessionID = newSessionID()
+	}
+
+	// Without heartbeats the session ends when it has been idle for the TTL
+	client := ""
+	if h.heartbeatManager.config.Enabled {
+		client = sessionReq.ClientID
+	}
+	h.sessions.open(sessionIdentity(msg.UserId, sessionID), msg.UserId, sessionID, client)
+	pinged := client != "" && h.heartbeatManager.RegisterPingQueue(client, sessionReq.ClientIP, sessionReq.PingQueue)
+
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"sessionID", "heartbeats", "serverPings"},
+		Rows:    [][]interface{}{{sessionID, client != "", pinged}},
+	})
+}
+
+// limitRows returns resp with at most limit rows (0 means no limit)
+func limitRows(resp RPCResponse, limit int) RPCResponse {
+	if limit > 0 && len(resp.Rows) > limit {
+		resp.Rows = resp.Rows[:limit]
+	}
+	return resp
+}
@@ -0,0 +1,210 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// clientSession is the server-side state of one client session
+type clientSession struct {
+	principal    string          // Authenticated user the session belongs to
+	id           string          // Session ID chosen by the client or issued at open
+	clients      map[string]bool // Heartbeat identities of the connections bound at open
+	transactions map[string]bool // Transactions begun in the session and not finished
+	statements   map[string]bool // Handles of statements prepared in the session
+	pinned       *pinnedConn     // Connection holding the session's SET and USE state (nil until one is sent)
+	lastUsed     time.Time       // Last request of the session
+}
+
+// SessionRegistry groups the state clients leave on the server — open
+// transactions, prepared statements, session settings and the connection
+// pinned by SET and USE statements — by session, so
+// all of it is released together once the client is gone: when no
+// connection bound to the session sends heartbeats any more, or, for
+// sessions without heartbeats, when the session has been idle for the
+// session settings TTL. Transactions, statements and settings keep their
+// own idle limits as well.
+type SessionRegistry struct {
+	mutex    sync.Mutex
+	sessions map[string]*clientSession // identity -> session
+}
+
+// NewSessionRegistry creates an empty session registry
+func NewSessionRegistry() *SessionRegistry {
+	return &SessionRegistry{sessions: make(map[string]*clientSession)}
+}
+
+// newSessionID returns a random session ID for clients that do not choose one
+func newSessionID() string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("sess_%d", time.Now().UnixNano())
+	}
+	return "sess_" + hex.EncodeToString(buf)
+}
+
+// open registers the session of identity, or refreshes it, and binds the
+// heartbeat identity of the connection that opened it (empty: none)
+func (r *SessionRegistry) open(identity, principal, id, client string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	session := r.sessions[identity]
+	if session == nil {
+		session = &clientSession{
+			principal:    principal,
+			id:           id,
+			clients:      make(map[string]bool),
+			transactions: make(map[string]bool),
+			statements:   make(map[string]bool),
+		}
+		r.sessions[identity] = session
+	}
+	if client != "" {
+		session.clients[client] = true
+	}
+	session.lastUsed = time.Now()
+}
+
+// update applies fn to the session of identity, if it is open, and marks
+// it used
+func (r *SessionRegistry) update(identity string, fn func(*clientSession)) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	if session := r.sessions[identity]; session != nil {
+		session.lastUsed = time.Now()
+		if fn != nil {
+			fn(session)
+		}
+	}
+}
+
+// remove unregisters the session of identity and returns it (nil if not open)
+func (r *SessionRegistry) remove(identity string) *clientSession {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	session := r.sessions[identity]
+	delete(r.sessions, identity)
+	return session
+}
+
+// removeAbandoned unregisters and returns the sessions whose client is gone.
+// A session with bound connections is gone when it has been idle for
+// heartbeatAge and none of them is active; one without is gone after ttl.
+func (r *SessionRegistry) removeAbandoned(now time.Time, heartbeatAge, ttl time.Duration, active func(client string) bool) map[string]*clientSession {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	abandoned := make(map[string]*clientSession)
+	for identity, session := range r.sessions {
+		idle := now.Sub(session.lastUsed)
+		if len(session.clients) == 0 {
+			if idle <= ttl {
+				continue
+			}
+		} else {
+			if idle <= heartbeatAge || session.hasActiveClient(active) {
+				continue
+			}
+		}
+		abandoned[identity] = session
+		delete(r.sessions, identity)
+	}
+	return abandoned
+}
+
+// hasActiveClient reports whether a connection bound to the session still
+// sends heartbeats
+func (s *clientSession) hasActiveClient(active func(client string) bool) bool {
+	for client := range s.clients {
+		if active(client) {
+			return true
+		}
+	}
+	return false
+}
+
+// openTransactionsByClient returns, for every heartbeat identity bound to a
+// session, the number of open transactions of its sessions
+func (r *SessionRegistry) openTransactionsByClient() map[string]int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	counts := make(map[string]int)
+	for _, session := range r.sessions {
+		for client := range session.clients {
+			counts[client] += len(session.transactions)
+		}
+	}
+	return counts
+}
+
+// Len returns the number of open sessions
+func (r *SessionRegistry) Len() int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return len(r.sessions)
+}
+
+// trackSession records a transaction or prepared statement of the request's
+// session, or forgets it when finished is set
+func (h *Handler) trackSession(principal string, req RPCRequest, transactionID, statementID string, finished bool) {
+	if req.SessionID == "" {
+		return
+	}
+	h.sessions.update(sessionIdentity(principal, req.SessionID), func(session *clientSession) {
+		if transactionID != "" {
+			if finished {
+				delete(session.transactions, transactionID)
+			} else {
+				session.transactions[transactionID] = true
+			}
+		}
+		if statementID != "" {
+			if finished {
+				delete(session.statements, statementID)
+			} else {
+				session.statements[statementID] = true
+			}
+		}
+	})
+}
+
+// releaseSession rolls back the open transactions of a session, closes its
+// prepared statements and pinned connection and drops its settings
+func (h *Handler) releaseSession(identity string, session *clientSession, reason string) {
+	for transactionID := range session.transactions {
+		// Transactions that already expired are gone; nothing to roll back
+		h.transactionManager.RollbackTransaction(transactionID)
+	}
+	for statementID := range session.statements {
+		h.preparedStatements.Close(session.principal, statementID)
+	}
+	if session.pinned != nil {
+		session.pinned.discard()
+	}
+	h.sessionSettings.Clear(identity)
+
+	log.Printf("[server] Session %s of '%s' released (%s): %d transactions rolled back, %d statements closed",
+		session.id, session.principal, reason, len(session.transactions), len(session.statements))
+}
+
+// expireSessions releases the sessions whose client is gone
+func (h *Handler) expireSessions() {
+	heartbeat := h.heartbeatManager
+	abandoned := h.sessions.removeAbandoned(time.Now(), heartbeat.config.MaxClientAge,
+		h.sessionSettings.config.TTL, heartbeat.IsClientActive)
+	for identity, session := range abandoned {
+		reason := "idle"
+		if len(session.clients) > 0 {
+			reason = "heartbeats expired"
+		}
+		h.releaseSession(identity, session, reason)
+	}
+}
@@ -0,0 +1,266 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SlowQueryConfig holds configuration for slow query logging
+type SlowQueryConfig struct {
+	Enabled        bool          // Whether slow queries are logged
+	Threshold      time.Duration // Queries slower than this are considered slow
+	ExplainEnabled bool          // Run EXPLAIN on slow queries and attach the plan
+	ExplainTimeout time.Duration // Maximum time allowed for the EXPLAIN statement
+	MaxEntries     int           // Number of recent slow queries kept in memory
+}
+
+// DefaultSlowQueryConfig returns sensible default slow query configuration
+func DefaultSlowQueryConfig() SlowQueryConfig {
+	return SlowQueryConfig{
+		Enabled:        true,
+		Threshold:      1 * time.Second,
+		ExplainEnabled: false,
+		ExplainTimeout: 2 * time.Second,
+		MaxEntries:     100,
+	}
+}
+
+// SlowQueryEntry is a single slow query log entry
+type SlowQueryEntry struct {
+	Timestamp     time.Time                `json:"timestamp"`                // When the query finished
+	ClientIP      string                   `json:"client_ip"`                // Client that sent the query
+	Query         string                   `json:"query"`                    // Normalized query text
+	TransactionID string                   `json:"transaction_id,omitempty"` // Transaction the query ran in
+	Tag           string                   `json:"tag,omitempty"`            // Client label for cross-system correlation
+	Duration      time.Duration            `json:"duration_ns"`              // Execution time including row fetching
+	RowCount      int                      `json:"row_count"`                // Rows returned
+	Plan          []map[string]interface{} `json:"plan,omitempty"`           // EXPLAIN output, one map per plan row
+	ExplainError  string                   `json:"explain_error,omitempty"`  // Why the plan could not be captured
+}
+
+// SlowQueryLog keeps the most recent slow queries in a fixed-size ring
+type SlowQueryLog struct {
+	config  SlowQueryConfig
+	mutex   sync.RWMutex
+	entries []SlowQueryEntry
+	next    int   // Ring position of the next write
+	total   int64 // Slow queries seen since start
+}
+
+// NewSlowQueryLog creates a new slow query log
+func NewSlowQueryLog(config SlowQueryConfig) *SlowQueryLog {
+	config = config.withDefaults()
+	return &SlowQueryLog{
+		config:  config,
+		entries: make([]SlowQueryEntry, 0, config.MaxEntries),
+	}
+}
+
+// withDefaults fills in the ring size and EXPLAIN timeout left at zero
+func (config SlowQueryConfig) withDefaults() SlowQueryConfig {
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultSlowQueryConfig().MaxEntries
+	}
+	if config.ExplainTimeout <= 0 {
+		config.ExplainTimeout = DefaultSlowQueryConfig().ExplainTimeout
+	}
+	return config
+}
+
+// SetConfig changes the configuration of a running slow query log. Recorded
+// entries are kept; when the ring shrinks only the most recent ones remain.
+func (sl *SlowQueryLog) SetConfig(config SlowQueryConfig) {
+	config = config.withDefaults()
+
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	if config.MaxEntries != sl.config.MaxEntries {
+		ordered := append(append([]SlowQueryEntry(nil), sl.entries[sl.next:]...), sl.entries[:sl.next]...)
+		if len(ordered) > config.MaxEntries {
+			ordered = ordered[len(ordered)-config.MaxEntries:]
+		}
+		sl.entries = append(make([]SlowQueryEntry, 0, config.MaxEntries), ordered...)
+		sl.next = 0
+	}
+	sl.config = config
+}
+
+// Config returns the configuration in use
+func (sl *SlowQueryLog) Config() SlowQueryConfig {
+	sl.mutex.RLock()
+	defer sl.mutex.RUnlock()
+	return sl.config
+}
+
+// IsSlow reports whether a query that took duration must be logged
+func (sl *SlowQueryLog) IsSlow(duration time.Duration) bool {
+	config := sl.Config()
+	return config.Enabled && config.Threshold > 0 && duration >= config.Threshold
+}
+
+// Record stores an entry, overwriting the oldest one when the ring is full
+func (sl *SlowQueryLog) Record(entry SlowQueryEntry) {
+	sl.mutex.Lock()
+	defer sl.mutex.Unlock()
+
+	sl.total++
+	if len(sl.entries) < sl.config.MaxEntries {
+		sl.entries = append(sl.entries, entry)
+		return
+	}
+	sl.entries[sl.next] = entry
+	sl.next = (sl.next + 1) % sl.config.MaxEntries
+}
+
+// Entries returns the stored entries, oldest first
+func (sl *SlowQueryLog) Entries() []SlowQueryEntry {
+	sl.mutex.RLock()
+	defer sl.mutex.RUnlock()
+
+	result := make([]SlowQueryEntry, 0, len(sl.entries))
+	result = append(result, sl.entries[sl.next:]...)
+	result = append(result, sl.entries[:sl.next]...)
+	return result
+}
+
+// Total returns the number of slow queries seen since start
+func (sl *SlowQueryLog) Total() int64 {
+	sl.mutex.RLock()
+	defer sl.mutex.RUnlock()
+	return sl.total
+}
+
+// explainable reports whether MySQL accepts EXPLAIN for the statement
+func explainable(query string) bool {
+	fields := strings.Fields(query)
+	if len(fields) == 0 {
+		return false
+	}
+	switch strings.ToUpper(fields[0]) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "REPLACE", "TABLE", "WITH":
+		return true
+	}
+	return false
+}
+
+// explainQuery runs EXPLAIN for query and returns one map per plan row
+func explainQuery(ctx context.Context, db *sql.DB, query string, params []interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.QueryContext(ctx, "EXPLAIN "+query, params...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(cols))
+		scanDest := make([]interface{}, len(cols))
+		for i := range values {
+			scanDest[i] = &values[i]
+		}
+		if err := rows.Scan(scanDest...); err != nil {
+			return nil, err
+		}
+
+		row := make(map[string]interface{}, len(cols))
+		for i, col := range cols {
+			if b, ok := values[i].([]byte); ok {
+				row[col] = string(b)
+			} else {
+				row[col] = values[i]
+			}
+		}
+		plan = append(plan, row)
+	}
+	return plan, rows.Err()
+}
+
+// SetSlowQueryConfig updates the slow query configuration. Recorded entries
+// are kept.
+func (h *Handler) SetSlowQueryConfig(config SlowQueryConfig) {
+	h.slowQueryLog.SetConfig(config)
+	log.Printf("[server] Slow query configuration updated: threshold=%v explain=%v", config.Threshold, config.ExplainEnabled)
+}
+
+// GetSlowQueries returns the most recent slow queries, oldest first
+func (h *Handler) GetSlowQueries() []SlowQueryEntry {
+	return h.slowQueryLog.Entries()
+}
+
+// recordSlowQuery logs a slow query. The EXPLAIN plan, when enabled, is
+// captured in the background so the client response is not delayed.
+func (h *Handler) recordSlowQuery(req RPCRequest, duration time.Duration, rowCount int) {
+	if !h.slowQueryLog.IsSlow(duration) {
+		return
+	}
+
+	if h.indexAdvisor != nil {
+		h.indexAdvisor.sample(req.Query, req.Params, duration)
+	}
+
+	entry := SlowQueryEntry{
+		Timestamp:     time.Now(),
+		ClientIP:      req.ClientIP,
+		Query:         normalizeQuery(req.Query),
+		TransactionID: req.TransactionID,
+		Tag:           req.Tag,
+		Duration:      duration,
+		RowCount:      rowCount,
+	}
+
+	if !h.slowQueryLog.Config().ExplainEnabled || !explainable(req.Query) {
+		h.logSlowQuery(entry)
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), h.slowQueryLog.Config().ExplainTimeout)
+		defer cancel()
+
+		db, release, err := h.acquireDB()
+		if err != nil {
+			entry.ExplainError = err.Error()
+			h.logSlowQuery(entry)
+			return
+		}
+		defer release()
+
+		plan, err := explainQuery(ctx, db, req.Query, req.Params)
+		if err != nil {
+			entry.ExplainError = err.Error()
+		}
+		entry.Plan = plan
+		h.logSlowQuery(entry)
+	}()
+}
+
+// logSlowQuery writes a slow query entry to the log and stores it
+func (h *Handler) logSlowQuery(entry SlowQueryEntry) {
+	h.slowQueryLog.Record(entry)
+
+	message := ""
+	if entry.Tag != "" {
+		message = " tag=" + entry.Tag
+	}
+	if entry.Plan != nil {
+		if plan, err := json.Marshal(entry.Plan); err == nil {
+			message += " plan=" + string(plan)
+		}
+	} else if entry.ExplainError != "" {
+		message += " explain_error=" + entry.ExplainError
+	}
+
+	log.Printf("[server] Slow query (%v, %d rows) from %s: %s%s",
+		entry.Duration, entry.RowCount, entry.ClientIP, h.loggedQuery(entry.Query, 200), message)
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// maxBatchParamSets bounds the parameter sets of a single batch request
+const maxBatchParamSets = 10000
+
+// ExecResult is the outcome of a statement that does not return rows
+type ExecResult struct {
+	RowsAffected int64 `json:"rowsAffected"` // Rows changed, summed over every parameter set of a batch
+	LastInsertID int64 `json:"lastInsertId"` // Last auto-increment value generated (0 if none)
+	Executions   int   `json:"executions"`   // Parameter sets executed
+}
+
+// execFunc executes a statement with one parameter set
+type execFunc func(ctx context.Context, args ...interface{}) (sql.Result, error)
+
+// handleExec runs a SQL request that asked for Exec semantics: the statement
+// is executed with ExecContext and the response carries the affected rows
+// and last insert ID instead of a result set. A batch runs the statement
+// once per parameter set in one round trip; outside a client transaction
+// the whole batch runs in its own database transaction, so either every
+// parameter set is applied or none is.
+func (h *Handler) handleExec(ctx context.Context, ch *amqp.Channel, msg amqp.Delivery, req RPCRequest, query string, prepared *sql.Stmt, pinned *pinnedConn) {
+	paramSets := req.Batch
+	if len(paramSets) == 0 {
+		paramSets = [][]interface{}{req.Params}
+	} else {
+		if len(paramSets) > maxBatchParamSets {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+				Error: fmt.Sprintf("batch has %d parameter sets (max %d)", len(paramSets), maxBatchParamSets),
+			})
+			return
+		}
+		// The query itself was validated with req.Params; check every set
+		for i, params := range paramSets {
+			validationResult := h.sqlValidator.ValidateQuery(req.Query, params)
+			if !validationResult.Valid {
+				log.Printf("[server] SQL validation blocked parameter set %d of batch from %s", i+1, req.ClientIP)
+				h.respond(ch, msg.ReplyTo, msg.CorrelationId, validationFailedResponse(validationResult))
+				return
+			}
+		}
+	}
+
+	queryStart := time.Now()
+	var result *ExecResult
+	var err error
+	defer func() {
+		var affected int64
+		if result != nil {
+			affected = result.RowsAffected
+		}
+		h.recordStatement(req, time.Since(queryStart), affected, err != nil || result == nil)
+	}()
+
+	if req.TransactionID != "" {
+		transaction, lookupErr := h.transactionManager.LookupTransaction(req.TransactionID)
+		if lookupErr != nil {
+			h.respondError(ch, msg, lookupErr)
+			return
+		}
+		result, err = execInTx(ctx, transaction.Tx, query, prepared, paramSets)
+	} else if pinned != nil {
+		if len(paramSets) == 1 {
+			result, err = execParamSets(ctx, func(ctx context.Context, args ...interface{}) (sql.Result, error) {
+				return pinned.conn.ExecContext(ctx, query, args...)
+			}, paramSets)
+		} else {
+			result, err = execBatch(ctx, pinned.conn, query, nil, paramSets)
+		}
+	} else {
+		db, release, dbErr := h.acquireDB()
+		if dbErr != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: dbErr.Error()})
+			return
+		}
+		defer release()
+
+		if len(paramSets) == 1 {
+			var exec execFunc = func(ctx context.Context, args ...interface{}) (sql.Result, error) {
+				return db.ExecContext(ctx, query, args...)
+			}
+			if prepared != nil {
+				exec = prepared.ExecContext
+			}
+			result, err = execParamSets(ctx, exec, paramSets)
+		} else {
+			result, err = execBatch(ctx, db, query, prepared, paramSets)
+		}
+	}
+	if err != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+		return
+	}
+
+	// Log the statement if it exceeded the slow query threshold
+	h.recordSlowQuery(req, time.Since(queryStart), 0)
+
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Result: result})
+}
+
+// txBeginner is a connection pool or a single connection batches run on
+type txBeginner interface {
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// execBatch runs every parameter set in a database transaction of its own
+func execBatch(ctx context.Context, db txBeginner, query string, prepared *sql.Stmt, paramSets [][]interface{}) (*ExecResult, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin batch transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := execInTx(ctx, tx, query, prepared, paramSets)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit batch: %w", err)
+	}
+	return result, nil
+}
+
+// execInTx runs the parameter sets within tx, preparing the statement once
+// when several sets share it
+func execInTx(ctx context.Context, tx *sql.Tx, query string, prepared *sql.Stmt, paramSets [][]interface{}) (*ExecResult, error) {
+	switch {
+	case prepared != nil:
+		stmt := tx.StmtContext(ctx, prepared)
+		defer stmt.Close()
+		return execParamSets(ctx, stmt.ExecContext, paramSets)
+	case len(paramSets) > 1:
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		defer stmt.Close()
+		return execParamSets(ctx, stmt.ExecContext, paramSets)
+	default:
+		return execParamSets(ctx, func(ctx context.Context, args ...interface{}) (sql.Result, error) {
+			return tx.ExecContext(ctx, query, args...)
+		}, paramSets)
+	}
+}
+
+// execParamSets executes once per parameter set and adds up the results
+func execParamSets(ctx context.Context, exec execFunc, paramSets [][]interface{}) (*ExecResult, error) {
+	result := &ExecResult{}
+	for i, params := range paramSets {
+		res, err := exec(ctx, params...)
+		if err != nil {
+			if len(paramSets) > 1 {
+				return nil, fmt.Errorf("parameter set %d: %w", i+1, err)
+			}
+			return nil, err
+		}
+		if affected, err := res.RowsAffected(); err == nil {
+			result.RowsAffected += affected
+		}
+		if id, err := res.LastInsertId(); err == nil && id != 0 {
+			result.LastInsertID = id
+		}
+		result.Executions++
+	}
+	return result, nil
+}
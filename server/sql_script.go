@@ -0,0 +1,311 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// Limits of a "script" request
+const (
+	maxScriptStatements = 1000
+	scriptTimeout       = 5 * time.Minute
+)
+
+// Status of a statement in the response of a "script" request
+const (
+	ScriptApplied    = "applied"     // Ran successfully and is part of the result
+	ScriptFailed     = "failed"      // Returned an error; the script stopped here
+	ScriptRolledBack = "rolled_back" // Ran successfully but was undone because a later statement failed
+	ScriptSkipped    = "skipped"     // Not run because an earlier statement failed
+)
+
+// splitScript splits a SQL script into its statements. Statements end with
+// the delimiter (";" by default) outside quotes and comments; a DELIMITER
+// line changes it, as in the mysql command line client, so scripts can
+// define triggers and stored routines. Comments are dropped, so they do not
+// trip SQL validation, except MySQL's executable /*! ... */ comments.
+func splitScript(script string) []string {
+	var (
+		statements []string
+		current    strings.Builder
+		delimiter  = ";"
+		quote      byte // Quote character of the string being read (0: none)
+		hasCode    bool // The current statement holds more than comments
+	)
+	flush := func() {
+		if hasCode {
+			statements = append(statements, strings.TrimSpace(current.String()))
+		}
+		current.Reset()
+		hasCode = false
+	}
+
+	for i := 0; i < len(script); {
+		c := script[i]
+
+		if quote != 0 {
+			current.WriteByte(c)
+			i++
+			switch {
+			case c == '\\' && quote != '`' && i < len(script):
+				current.WriteByte(script[i])
+				i++
+			case c == quote:
+				quote = 0
+			}
+			continue
+		}
+
+		// A DELIMITER command at the start of a line changes the delimiter
+		if !hasCode && atLineStart(script, i) && hasWordPrefix(script[i:], "DELIMITER") {
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			if fields := strings.Fields(script[i : i+end]); len(fields) > 1 {
+				delimiter = fields[1]
+			}
+			current.Reset()
+			i += end
+			continue
+		}
+
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			quote = c
+		case c == '#' || strings.HasPrefix(script[i:], "-- ") || strings.HasPrefix(script[i:], "--\n"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				end = len(script) - i
+			}
+			i += end
+			continue
+		case strings.HasPrefix(script[i:], "/*") && !strings.HasPrefix(script[i:], "/*!"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				end = len(script) - i - 2
+			} else {
+				end += 2
+			}
+			current.WriteByte(' ')
+			i += 2 + end
+			continue
+		case strings.HasPrefix(script[i:], delimiter):
+			flush()
+			i += len(delimiter)
+			continue
+		}
+		if c != ' ' && c != '\t' && c != '\r' && c != '\n' {
+			hasCode = true
+		}
+		current.WriteByte(c)
+		i++
+	}
+	flush()
+	return statements
+}
+
+// atLineStart reports whether only blanks precede position i on its line
+func atLineStart(s string, i int) bool {
+	for j := i - 1; j >= 0 && s[j] != '\n'; j-- {
+		if s[j] != ' ' && s[j] != '\t' && s[j] != '\r' {
+			return false
+		}
+	}
+	return true
+}
+
+// hasWordPrefix reports whether s starts with word, case-insensitively,
+// followed by a blank
+func hasWordPrefix(s, word string) bool {
+	return len(s) > len(word) && strings.EqualFold(s[:len(word)], word) && (s[len(word)] == ' ' || s[len(word)] == '\t')
+}
+
+// causesImplicitCommit reports whether MySQL commits the open transaction
+// around statement, which leaves the rest of the transaction in autocommit
+func causesImplicitCommit(statement string) bool {
+	words := strings.Fields(strings.ToUpper(statement))
+	if len(words) == 0 {
+		return false
+	}
+	switch words[0] {
+	case "CREATE", "ALTER", "DROP", "RENAME", "TRUNCATE", "GRANT", "REVOKE",
+		"LOCK", "UNLOCK", "ANALYZE", "OPTIMIZE", "REPAIR":
+		return true
+	}
+	return false
+}
+
+// validateScript checks every statement of a script; it returns the error
+// response for the first one that may not run, or nil
+func (h *Handler) validateScript(statements []string, clientIP string) *RPCResponse {
+	for i, statement := range statements {
+		if isSessionStatement(statement) {
+			return &RPCResponse{Error: fmt.Sprintf("statement %d: SET and USE statements are not allowed in scripts", i+1)}
+		}
+		validationResult := h.sqlValidator.ValidateQuery(statement, nil)
+		if !validationResult.Valid {
+			log.Printf("[server] SQL validation blocked statement %d of script from %s (risk: %s)",
+				i+1, clientIP, validationResult.Risk)
+			response := validationFailedResponse(validationResult)
+			response.Error = fmt.Sprintf("statement %d: %s", i+1, response.Error)
+			return &response
+		}
+	}
+	return nil
+}
+
+// scriptStatus is the outcome of one statement of a script
+type scriptStatus struct {
+	status   string
+	affected int64
+	duration time.Duration
+	err      string
+}
+
+// scriptRun is the outcome of the statements of a script
+type scriptRun struct {
+	results     []scriptStatus
+	failed      int // Index of the statement that failed, -1 if every one was applied
+	uncommitted int // Index of the first statement after the last implicit commit
+}
+
+// runScript runs statements in order in tx until one fails; the statements
+// after it are skipped
+func runScript(ctx context.Context, tx *sql.Tx, statements []string) *scriptRun {
+	run := &scriptRun{results: make([]scriptStatus, len(statements)), failed: -1}
+	for i, statement := range statements {
+		if run.failed >= 0 {
+			run.results[i].status = ScriptSkipped
+			continue
+		}
+		statementStart := time.Now()
+		result, err := tx.ExecContext(ctx, statement)
+		run.results[i].duration = time.Since(statementStart)
+		if err != nil {
+			run.results[i].status = ScriptFailed
+			run.results[i].err = err.Error()
+			run.failed = i
+			continue
+		}
+		run.results[i].status = ScriptApplied
+		run.results[i].affected, _ = result.RowsAffected()
+		if causesImplicitCommit(statement) {
+			run.uncommitted = i + 1
+		}
+	}
+	return run
+}
+
+// markRolledBack marks the applied statements a rollback of the failed
+// script undid: those after the last implicit commit
+func (run *scriptRun) markRolledBack() {
+	for i := run.uncommitted; i < run.failed; i++ {
+		run.results[i].status = ScriptRolledBack
+	}
+}
+
+// handleScript runs the statements of a "script" request sequentially in
+// one transaction — the request's, or one of its own that is committed only
+// if every statement succeeds — and responds with one row per statement.
+// A failing statement does not make the request fail: the response reports
+// which statement failed and why, and the statuses of the others.
+//
+// MySQL commits implicitly before and after DDL statements (CREATE, ALTER,
+// DROP, ...), so a rollback only undoes the statements after the last one.
+func (h *Handler) handleScript(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	statements := splitScript(req.Query)
+	if len(statements) == 0 {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "script has no statements"})
+		return
+	}
+	if len(statements) > maxScriptStatements {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+			Error: fmt.Sprintf("script has %d statements (max %d)", len(statements), maxScriptStatements),
+		})
+		return
+	}
+	if len(req.Params) > 0 {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "scripts do not take parameters"})
+		return
+	}
+
+	// Validate the whole script before running any of it
+	if response := h.validateScript(statements, req.ClientIP); response != nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, *response)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), scriptTimeout)
+	defer cancel()
+
+	var tx *sql.Tx
+	if req.TransactionID != "" {
+		transaction, lookupErr := h.transactionManager.LookupTransaction(req.TransactionID)
+		if lookupErr != nil {
+			h.respondError(ch, msg, lookupErr)
+			return
+		}
+		tx = transaction.Tx
+	} else {
+		db, release, err := h.acquireDB()
+		if err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+			return
+		}
+		defer release()
+
+		if tx, err = db.BeginTx(ctx, nil); err != nil {
+			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: err.Error()})
+			return
+		}
+		defer tx.Rollback()
+	}
+
+	start := time.Now()
+	run := runScript(ctx, tx, statements)
+	results, failed := run.results, run.failed
+
+	// Outside a client transaction the script is all or nothing; inside one
+	// the client decides whether to roll back
+	if req.TransactionID == "" {
+		if failed < 0 {
+			if err := tx.Commit(); err != nil {
+				h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: fmt.Sprintf("script commit failed: %v", err)})
+				return
+			}
+		} else {
+			tx.Rollback()
+			run.markRolledBack()
+		}
+	}
+
+	if failed >= 0 {
+		log.Printf("[server] Script from %s failed at statement %d of %d (%v): %s",
+			req.ClientIP, failed+1, len(statements), time.Since(start), results[failed].err)
+	} else {
+		log.Printf("[server] Script from %s applied %d statements (%v)", req.ClientIP, len(statements), time.Since(start))
+	}
+
+	rows := make([][]interface{}, len(statements))
+	for i, statement := range statements {
+		rows[i] = []interface{}{
+			i + 1,
+			truncateQuery(statement, 200),
+			results[i].status,
+			results[i].affected,
+			results[i].duration.Milliseconds(),
+			results[i].err,
+		}
+	}
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"statement", "sql", "status", "rows_affected", "duration_ms", "error"},
+		Rows:    rows,
+	})
+}
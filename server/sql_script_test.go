@@ -0,0 +1,67 @@
+package server
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScriptRollbackAfterImplicitCommit(t *testing.T) {
+	tests := []struct {
+		name       string
+		statements []string
+		expected   []string
+	}{
+		{
+			name: "no DDL",
+			statements: []string{
+				"INSERT INTO a VALUES (1)",
+				"UPDATE a SET v = 2",
+				"INSERT INTO fail VALUES (1)",
+				"DELETE FROM a",
+			},
+			expected: []string{ScriptRolledBack, ScriptRolledBack, ScriptFailed, ScriptSkipped},
+		},
+		{
+			name: "DDL in the middle",
+			statements: []string{
+				"INSERT INTO a VALUES (1)",
+				"CREATE TABLE b (id INT)",
+				"INSERT INTO b VALUES (1)",
+				"UPDATE a SET v = 2",
+				"INSERT INTO fail VALUES (1)",
+				"DELETE FROM a",
+			},
+			expected: []string{ScriptApplied, ScriptApplied, ScriptRolledBack, ScriptRolledBack, ScriptFailed, ScriptSkipped},
+		},
+		{
+			name: "DDL right before the failure",
+			statements: []string{
+				"INSERT INTO a VALUES (1)",
+				"ALTER TABLE a ADD COLUMN w INT",
+				"INSERT INTO fail VALUES (1)",
+			},
+			expected: []string{ScriptApplied, ScriptApplied, ScriptFailed},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, db, drv := newTestTransactionManager(t)
+			drv.failExec = "fail"
+
+			tx, err := db.BeginTx(context.Background(), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			run := runScript(context.Background(), tx, tt.statements)
+			tx.Rollback()
+			run.markRolledBack()
+
+			for i, expected := range tt.expected {
+				if status := run.results[i].status; status != expected {
+					t.Errorf("statement %d (%s): status %s, expected %s", i+1, tt.statements[i], status, expected)
+				}
+			}
+		})
+	}
+}
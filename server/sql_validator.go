@@ -22,22 +22,30 @@ import (
 type SQLValidator struct {
 	config           SQLValidationConfig // Validation configuration
 	injectionRegexes []*regexp.Regexp    // Compiled injection detection patterns
+	patterns         []compiledPattern   // Compiled custom patterns of the configuration
+	rules            []namedRule         // Custom rules registered in Go
 	mutex            sync.RWMutex        // Thread-safe access to validator state
 	stats            ValidationStats     // Validation statistics
 }
 
 // SQLValidationConfig defines the validation rules and policies.
 type SQLValidationConfig struct {
-	Enabled              bool     // Whether validation is enabled
-	AllowedCommands      []string // Whitelist of allowed SQL commands (e.g., SELECT, INSERT)
-	BlockedCommands      []string // Blacklist of forbidden SQL commands (e.g., DROP, ALTER)
-	AllowDDL             bool     // Allow Data Definition Language (CREATE, ALTER, DROP)
-	AllowDML             bool     // Allow Data Manipulation Language (INSERT, UPDATE, DELETE)
-	AllowDQL             bool     // Allow Data Query Language (SELECT)
-	AllowStoredProcedures bool    // Allow stored procedure calls
-	MaxQueryLength       int      // Maximum allowed query length
-	StrictMode           bool     // Enable strict validation (more restrictive)
-	LogViolations        bool     // Log validation violations
+	Enabled                bool                     // Whether validation is enabled
+	AllowedCommands        []string                 // Whitelist of allowed SQL commands (e.g., SELECT, INSERT)
+	BlockedCommands        []string                 // Blacklist of forbidden SQL commands (e.g., DROP, ALTER)
+	AllowDDL               bool                     // Allow Data Definition Language (CREATE, ALTER, DROP)
+	AllowDML               bool                     // Allow Data Manipulation Language (INSERT, UPDATE, DELETE)
+	AllowDQL               bool                     // Allow Data Query Language (SELECT)
+	AllowStoredProcedures  bool                     // Allow stored procedure calls
+	MaxQueryLength         int                      // Maximum allowed query length
+	StrictMode             bool                     // Enable strict validation (more restrictive)
+	LogViolations          bool                     // Log validation violations
+	DefaultLimit           int                      // LIMIT added to SELECTs without one; strict mode rejects them instead (0 = off)
+	Patterns               []ValidationPattern      // Site-specific regular expression rules
+	RequireParameters      bool                     // Reject string and numeric literals in WHERE clauses, forcing ? placeholders
+	RiskActions            map[RiskLevel]RiskAction // What happens to queries of each risk level (missing levels: allow)
+	ApproveDDL             bool                     // Hold CREATE, ALTER, DROP, TRUNCATE and RENAME for an operator's approval
+	ApproveUnboundedWrites bool                     // Hold DELETE and UPDATE without WHERE for an operator's approval
 }
 
 // ValidationStats tracks validation performance and security metrics.
@@ -48,17 +56,24 @@ type ValidationStats struct {
 	InjectionAttempts   int64 // Detected SQL injection attempts
 	CommandViolations   int64 // Command policy violations
 	StructureViolations int64 // Structure policy violations
+	LimitsInjected      int64 // SELECTs run with the default LIMIT added
+	CustomViolations    int64 // Custom rule and pattern violations
+	LiteralViolations   int64 // Queries rejected for inline literals in WHERE clauses
+	RiskBlocked         int64 // Valid queries blocked by the action of their risk level
+	ApprovalsRequired   int64 // Queries held for an operator's approval
 	mutex               sync.RWMutex
 }
 
 // ValidationResult contains the result of SQL validation.
 type ValidationResult struct {
-	Valid        bool     // Whether the query is valid
-	Errors       []string // List of validation errors
-	Warnings     []string // List of validation warnings
-	NormalizedQuery string // Normalized version of the query
-	DetectedCommand string // Primary SQL command detected
-	Risk         RiskLevel // Assessed risk level
+	Valid            bool      // Whether the query is valid
+	Errors           []string  // List of validation errors
+	Warnings         []string  // List of validation warnings
+	NormalizedQuery  string    // Normalized version of the query
+	DetectedCommand  string    // Primary SQL command detected
+	Risk             RiskLevel // Assessed risk level
+	RewrittenQuery   string    // Query to run instead, with the default LIMIT added (empty if unchanged)
+	RequiresApproval bool      // The risk level holds the query until an operator approves it
 }
 
 // RiskLevel represents the security risk level of a query.
@@ -110,8 +125,9 @@ func NewSQLValidator(config SQLValidationConfig) *SQLValidator {
 		stats:  ValidationStats{},
 	}
 
-	// Compile injection detection patterns
+	// Compile injection detection and custom patterns
 	validator.compileInjectionPatterns()
+	validator.patterns = compilePatterns(config.Patterns)
 
 	log.Printf("[server] SQL validator initialized: enabled=%v, strict=%v", 
 		config.Enabled, config.StrictMode)
@@ -170,7 +186,36 @@ func (v *SQLValidator) compileInjectionPatterns() {
 
 // ValidateQuery performs comprehensive validation of a SQL query.
 func (v *SQLValidator) ValidateQuery(query string, params []interface{}) ValidationResult {
-	v.incrementTotalQueries()
+	return v.validate(query, params, true, true)
+}
+
+// ValidateStreamingQuery validates a query whose result is streamed in
+// chunks (exports), so a SELECT without LIMIT is neither limited nor
+// rejected.
+func (v *SQLValidator) ValidateStreamingQuery(query string, params []interface{}) ValidationResult {
+	return v.validate(query, params, false, true)
+}
+
+// LintQuery validates a query without running it, for "validate" requests:
+// the result is the one ValidateQuery would return, but the statistics are
+// left alone and violations are not logged.
+func (v *SQLValidator) LintQuery(query string, params []interface{}) ValidationResult {
+	return v.validate(query, params, true, false)
+}
+
+// validate runs the validation rules; bounded applies DefaultLimit and
+// record updates the statistics and logs violations. The configuration is
+// read-locked for the whole check, so a reload never applies half of it.
+func (v *SQLValidator) validate(query string, params []interface{}, bounded, record bool) ValidationResult {
+	v.mutex.RLock()
+	defer v.mutex.RUnlock()
+
+	count := func(increment func()) {
+		if record {
+			increment()
+		}
+	}
+	count(v.incrementTotalQueries)
 
 	// Skip validation if disabled
 	if !v.config.Enabled {
@@ -209,7 +254,7 @@ func (v *SQLValidator) ValidateQuery(query string, params []interface{}) Validat
 	if !v.validateCommand(result.DetectedCommand) {
 		result.Valid = false
 		result.Errors = append(result.Errors, fmt.Sprintf("Command '%s' is not allowed by current policy", result.DetectedCommand))
-		v.incrementCommandViolations()
+		count(v.incrementCommandViolations)
 		result.Risk = RiskHigh
 	}
 
@@ -217,7 +262,7 @@ func (v *SQLValidator) ValidateQuery(query string, params []interface{}) Validat
 	if injectionDetected, injectionType := v.detectSQLInjection(query); injectionDetected {
 		result.Valid = false
 		result.Errors = append(result.Errors, fmt.Sprintf("Potential SQL injection detected: %s", injectionType))
-		v.incrementInjectionAttempts()
+		count(v.incrementInjectionAttempts)
 		result.Risk = RiskCritical
 	}
 
@@ -229,7 +274,7 @@ func (v *SQLValidator) ValidateQuery(query string, params []interface{}) Validat
 		} else {
 			result.Warnings = append(result.Warnings, structureErrors...)
 		}
-		v.incrementStructureViolations()
+		count(v.incrementStructureViolations)
 		if result.Risk < RiskMedium {
 			result.Risk = RiskMedium
 		}
@@ -240,14 +285,70 @@ func (v *SQLValidator) ValidateQuery(query string, params []interface{}) Validat
 		result.Warnings = append(result.Warnings, paramErrors...)
 	}
 
+	// 7. Unbounded SELECT protection
+	if bounded && v.config.DefaultLimit > 0 && result.DetectedCommand == "SELECT" && isUnboundedSelect(query) {
+		if v.config.StrictMode {
+			result.Valid = false
+			result.Errors = append(result.Errors, "SELECT without LIMIT not allowed in strict mode")
+			count(v.incrementStructureViolations)
+			if result.Risk < RiskMedium {
+				result.Risk = RiskMedium
+			}
+		} else if result.Valid {
+			result.RewrittenQuery = withLimit(query, v.config.DefaultLimit)
+			result.Warnings = append(result.Warnings, fmt.Sprintf("LIMIT %d added to SELECT without LIMIT", v.config.DefaultLimit))
+			count(v.incrementLimitsInjected)
+		}
+	}
+
+	// 8. Parameterization enforcement
+	if v.config.RequireParameters {
+		if strs, numbers := inlineLiterals(query); strs+numbers > 0 {
+			result.Valid = false
+			result.Errors = append(result.Errors, fmt.Sprintf("Inline literals in WHERE clause not allowed (%d string, %d numeric); use ? placeholders", strs, numbers))
+			count(v.incrementLiteralViolations)
+			if result.Risk < RiskHigh {
+				result.Risk = RiskHigh
+			}
+		}
+	}
+
+	// 9. Custom rules and patterns
+	if violations := v.customViolations(query, result.DetectedCommand, params); len(violations) > 0 {
+		result.Valid = false
+		result.Errors = append(result.Errors, violations...)
+		count(v.incrementCustomViolations)
+		if result.Risk < RiskHigh {
+			result.Risk = RiskHigh
+		}
+	}
+
+	// 10. Action for the risk level
+	switch v.riskAction(&result) {
+	case RiskBlock:
+		count(v.incrementRiskBlocked)
+	case RiskApprove:
+		count(v.incrementApprovalsRequired)
+	}
+
+	// 11. Dangerous operations, unless their risk level blocks them
+	if !result.RequiresApproval && v.config.RiskActions[result.Risk] != RiskBlock {
+		if reason := v.approvalReason(query, result.DetectedCommand); reason != "" {
+			result.Valid = false
+			result.RequiresApproval = true
+			result.Errors = append(result.Errors, reason)
+			count(v.incrementApprovalsRequired)
+		}
+	}
+
 	// Update statistics
 	if result.Valid {
-		v.incrementValidQueries()
+		count(v.incrementValidQueries)
 	} else {
-		v.incrementBlockedQueries()
+		count(v.incrementBlockedQueries)
 		
 		// Log violations if enabled
-		if v.config.LogViolations {
+		if record && v.config.LogViolations {
 			log.Printf("[server] SQL validation violation: query=%s, errors=%v, risk=%s", 
 				v.truncateForLog(query), result.Errors, result.Risk)
 		}
@@ -406,6 +507,92 @@ func (v *SQLValidator) containsSQLKeywords(str string) bool {
 	return false
 }
 
+// isUnboundedSelect reports whether a SELECT reads from a table without a
+// LIMIT of its own. Only the outer statement counts: a LIMIT inside a
+// subquery does not bound the result. Locking reads and SELECT ... INTO
+// are left alone, since a LIMIT cannot simply be appended to them.
+func isUnboundedSelect(query string) bool {
+	words := topLevelWords(query)
+	hasFrom := false
+	for i, word := range words {
+		switch word {
+		case "LIMIT", "INTO":
+			return false
+		case "FROM":
+			hasFrom = true
+		case "FOR":
+			if i+1 < len(words) && (words[i+1] == "UPDATE" || words[i+1] == "SHARE") {
+				return false
+			}
+		case "LOCK":
+			return false
+		}
+	}
+	return hasFrom
+}
+
+// topLevelWords returns the upper-cased words of query outside parentheses,
+// quotes and comments
+func topLevelWords(query string) []string {
+	var words []string
+	var word strings.Builder
+	flush := func() {
+		if word.Len() > 0 {
+			words = append(words, strings.ToUpper(word.String()))
+			word.Reset()
+		}
+	}
+
+	depth := 0
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			flush()
+			// Skip the quoted text, honoring backslash escapes
+			for i++; i < len(query) && query[i] != c; i++ {
+				if query[i] == '\\' {
+					i++
+				}
+			}
+		case c == '-' && i+1 < len(query) && query[i+1] == '-', c == '#':
+			flush()
+			for i < len(query) && query[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(query) && query[i+1] == '*':
+			flush()
+			if end := strings.Index(query[i+2:], "*/"); end >= 0 {
+				i += end + 3
+			} else {
+				i = len(query)
+			}
+		case c == '(':
+			flush()
+			depth++
+		case c == ')':
+			flush()
+			depth--
+		case c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9':
+			if depth == 0 {
+				word.WriteByte(c)
+			}
+		default:
+			flush()
+		}
+	}
+	flush()
+	return words
+}
+
+// withLimit appends a LIMIT clause to query, before any trailing semicolon.
+// The clause goes on a line of its own so that a trailing -- or # comment
+// does not swallow it.
+func withLimit(query string, limit int) string {
+	trimmed := strings.TrimRight(strings.TrimSpace(query), "; \t\r\n")
+	return fmt.Sprintf("%s\nLIMIT %d", trimmed, limit)
+}
+
 func (v *SQLValidator) normalizeQuery(query string) string {
 	// Basic normalization: trim whitespace and normalize case for keywords
 	normalized := strings.TrimSpace(query)
@@ -457,6 +644,36 @@ func (v *SQLValidator) incrementStructureViolations() {
 	v.stats.mutex.Unlock()
 }
 
+func (v *SQLValidator) incrementLimitsInjected() {
+	v.stats.mutex.Lock()
+	v.stats.LimitsInjected++
+	v.stats.mutex.Unlock()
+}
+
+func (v *SQLValidator) incrementLiteralViolations() {
+	v.stats.mutex.Lock()
+	v.stats.LiteralViolations++
+	v.stats.mutex.Unlock()
+}
+
+func (v *SQLValidator) incrementCustomViolations() {
+	v.stats.mutex.Lock()
+	v.stats.CustomViolations++
+	v.stats.mutex.Unlock()
+}
+
+func (v *SQLValidator) incrementRiskBlocked() {
+	v.stats.mutex.Lock()
+	v.stats.RiskBlocked++
+	v.stats.mutex.Unlock()
+}
+
+func (v *SQLValidator) incrementApprovalsRequired() {
+	v.stats.mutex.Lock()
+	v.stats.ApprovalsRequired++
+	v.stats.mutex.Unlock()
+}
+
 // GetStats returns current validation statistics.
 func (v *SQLValidator) GetStats() ValidationStats {
 	v.stats.mutex.RLock()
@@ -470,6 +687,11 @@ func (v *SQLValidator) GetStats() ValidationStats {
 		InjectionAttempts:   v.stats.InjectionAttempts,
 		CommandViolations:   v.stats.CommandViolations,
 		StructureViolations: v.stats.StructureViolations,
+		LimitsInjected:      v.stats.LimitsInjected,
+		CustomViolations:    v.stats.CustomViolations,
+		LiteralViolations:   v.stats.LiteralViolations,
+		RiskBlocked:         v.stats.RiskBlocked,
+		ApprovalsRequired:   v.stats.ApprovalsRequired,
 		// Don't copy the mutex
 	}
 }
@@ -481,6 +703,33 @@ func (v *SQLValidator) UpdateConfig(config SQLValidationConfig) {
 	
 	v.config = config
 	v.compileInjectionPatterns() // Recompile patterns if needed
+	v.patterns = compilePatterns(config.Patterns)
 	
 	log.Printf("[server] SQL validator configuration updated")
-}
\ No newline at end of file
+}
+
+// ErrValidationFailed is the RPCResponse.ErrorCode of queries blocked by SQL validation.
+const ErrValidationFailed = "VALIDATION_FAILED"
+
+// ValidationDetails is the wire form of the ValidationResult of a blocked
+// query, so clients can show which rule fired.
+type ValidationDetails struct {
+	Errors          []string `json:"errors"`             // Rules the query violated
+	Warnings        []string `json:"warnings,omitempty"` // Non-blocking findings
+	DetectedCommand string   `json:"detectedCommand"`    // Primary SQL command detected
+	Risk            string   `json:"risk"`               // Assessed risk level (low, medium, high, critical)
+}
+
+// validationFailedResponse builds the response to a query blocked by SQL validation.
+func validationFailedResponse(result ValidationResult) RPCResponse {
+	return RPCResponse{
+		Error:     fmt.Sprintf("SQL validation failed: %s", strings.Join(result.Errors, "; ")),
+		ErrorCode: ErrValidationFailed,
+		Validation: &ValidationDetails{
+			Errors:          result.Errors,
+			Warnings:        result.Warnings,
+			DetectedCommand: result.DetectedCommand,
+			Risk:            result.Risk.String(),
+		},
+	}
+}
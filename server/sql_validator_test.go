@@ -0,0 +1,47 @@
+package server
+
+import "testing"
+
+func TestWithLimit(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    string
+		expected string
+	}{
+		{"plain", "SELECT * FROM items", "SELECT * FROM items\nLIMIT 100"},
+		{"trailing semicolon", "SELECT * FROM items ;\n", "SELECT * FROM items\nLIMIT 100"},
+		{"trailing -- comment", "SELECT * FROM items -- every item", "SELECT * FROM items -- every item\nLIMIT 100"},
+		{"trailing # comment", "SELECT * FROM items # every item;", "SELECT * FROM items # every item\nLIMIT 100"},
+		{"trailing block comment", "SELECT * FROM items /* every item */", "SELECT * FROM items /* every item */\nLIMIT 100"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rewritten := withLimit(tt.query, 100)
+			if rewritten != tt.expected {
+				t.Fatalf("rewritten to %q, expected %q", rewritten, tt.expected)
+			}
+			// The LIMIT must not end up inside the comment
+			if isUnboundedSelect(rewritten) {
+				t.Fatalf("rewritten query %q is still unbounded", rewritten)
+			}
+		})
+	}
+}
+
+func TestDefaultLimit(t *testing.T) {
+	config := DefaultSQLValidationConfig()
+	config.DefaultLimit = 100
+	config.LogViolations = false
+
+	result := NewSQLValidator(config).ValidateQuery("SELECT * FROM items;", nil)
+	if !result.Valid || result.RewrittenQuery != "SELECT * FROM items\nLIMIT 100" {
+		t.Fatalf("unexpected result: valid=%v rewritten=%q errors=%v", result.Valid, result.RewrittenQuery, result.Errors)
+	}
+
+	config.StrictMode = true
+	result = NewSQLValidator(config).ValidateQuery("SELECT * FROM items", nil)
+	if result.Valid {
+		t.Fatal("strict mode ran a SELECT without LIMIT")
+	}
+}
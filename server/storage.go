@@ -0,0 +1,355 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StorageItem is a stored value with its key and expiry
+type StorageItem struct {
+	Key       string
+	Value     []byte
+	ExpiresAt time.Time // Zero when the item never expires
+}
+
+// Storage is a small key-value store shared by the subsystems that need
+// persistence (audit records, scheduler history, ...), so a deployment
+// chooses one persistence mechanism for all of them. Keys live in
+// namespaces, one per subsystem. Implementations must be safe for
+// concurrent use.
+type Storage interface {
+	// Get returns the value of key; found is false when it is missing or expired
+	Get(ctx context.Context, namespace, key string) (value []byte, found bool, err error)
+	// Put stores value under key; a ttl of 0 keeps it until deleted
+	Put(ctx context.Context, namespace, key string, value []byte, ttl time.Duration) error
+	// Delete removes key; deleting a missing key is not an error
+	Delete(ctx context.Context, namespace, key string) error
+	// List returns the unexpired items whose key starts with prefix, sorted by key
+	List(ctx context.Context, namespace, prefix string) ([]StorageItem, error)
+	// PurgeExpired removes expired items and returns how many were removed
+	PurgeExpired(ctx context.Context) (int64, error)
+	Close() error
+}
+
+// StorageConfig selects the storage backend
+type StorageConfig struct {
+	Backend string // "memory", "mysql" or "sqlite"
+	Table   string // Table for the SQL backends
+	DSN     string // SQLite database file (the "mysql" backend uses the server's MySQL DSN)
+}
+
+// DefaultStorageConfig returns an in-memory storage configuration
+func DefaultStorageConfig() StorageConfig {
+	return StorageConfig{
+		Backend: "memory",
+		Table:   "burrowctl_storage",
+	}
+}
+
+// NewStorage creates the Storage selected by config.Backend.
+//
+// The "sqlite" backend needs a SQLite database/sql driver registered as
+// "sqlite3" or "sqlite", e.g. by blank-importing github.com/mattn/go-sqlite3
+// or modernc.org/sqlite in the program embedding the server.
+func NewStorage(config StorageConfig, mysqlDSN string) (Storage, error) {
+	switch config.Backend {
+	case "", "memory":
+		return NewMemoryStorage(), nil
+	case "mysql":
+		return NewSQLStorage("mysql", mysqlDSN, config.Table)
+	case "sqlite":
+		if config.DSN == "" {
+			return nil, fmt.Errorf("the sqlite storage backend needs a database file")
+		}
+		for _, driver := range sql.Drivers() {
+			if driver == "sqlite3" || driver == "sqlite" {
+				return NewSQLStorage(driver, config.DSN, config.Table)
+			}
+		}
+		return nil, fmt.Errorf("no SQLite driver registered: import one (e.g. github.com/mattn/go-sqlite3) to use the sqlite storage backend")
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", config.Backend)
+	}
+}
+
+// memoryItem is a value held by MemoryStorage
+type memoryItem struct {
+	value     []byte
+	expiresAt time.Time
+}
+
+// expired reports whether the item expired at now
+func (i memoryItem) expired(now time.Time) bool {
+	return !i.expiresAt.IsZero() && !now.Before(i.expiresAt)
+}
+
+// MemoryStorage keeps items in memory; they are lost when the server stops
+type MemoryStorage struct {
+	mutex sync.RWMutex
+	items map[string]map[string]memoryItem // namespace -> key -> item
+}
+
+// NewMemoryStorage creates an empty in-memory storage
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{items: make(map[string]map[string]memoryItem)}
+}
+
+// Get returns the value of key
+func (s *MemoryStorage) Get(ctx context.Context, namespace, key string) ([]byte, bool, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	item, ok := s.items[namespace][key]
+	if !ok || item.expired(time.Now()) {
+		return nil, false, nil
+	}
+	return append([]byte(nil), item.value...), true, nil
+}
+
+// Put stores value under key
+func (s *MemoryStorage) Put(ctx context.Context, namespace, key string, value []byte, ttl time.Duration) error {
+	item := memoryItem{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		item.expiresAt = time.Now().Add(ttl)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.items[namespace] == nil {
+		s.items[namespace] = make(map[string]memoryItem)
+	}
+	s.items[namespace][key] = item
+	return nil
+}
+
+// Delete removes key
+func (s *MemoryStorage) Delete(ctx context.Context, namespace, key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	delete(s.items[namespace], key)
+	return nil
+}
+
+// List returns the items whose key starts with prefix
+func (s *MemoryStorage) List(ctx context.Context, namespace, prefix string) ([]StorageItem, error) {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+
+	now := time.Now()
+	var items []StorageItem
+	for key, item := range s.items[namespace] {
+		if !strings.HasPrefix(key, prefix) || item.expired(now) {
+			continue
+		}
+		items = append(items, StorageItem{Key: key, Value: append([]byte(nil), item.value...), ExpiresAt: item.expiresAt})
+	}
+	sort.Slice(items, func(i, j int) bool { return items[i].Key < items[j].Key })
+	return items, nil
+}
+
+// PurgeExpired removes expired items
+func (s *MemoryStorage) PurgeExpired(ctx context.Context) (int64, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	now := time.Now()
+	var removed int64
+	for _, items := range s.items {
+		for key, item := range items {
+			if item.expired(now) {
+				delete(items, key)
+				removed++
+			}
+		}
+	}
+	return removed, nil
+}
+
+// Close is a no-op
+func (s *MemoryStorage) Close() error {
+	return nil
+}
+
+// SQLStorage keeps items in a MySQL or SQLite table on a dedicated
+// connection. Expiry times are stored as Unix milliseconds.
+type SQLStorage struct {
+	db     *sql.DB
+	table  string
+	upsert string
+}
+
+// NewSQLStorage opens the database and creates the storage table if needed.
+// driver is "mysql", or the name of a registered SQLite driver.
+func NewSQLStorage(driver, dsn, table string) (*SQLStorage, error) {
+	if !identifierPattern.MatchString(table) {
+		return nil, fmt.Errorf("invalid storage table name: %q", table)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open storage database: %w", err)
+	}
+	quoted := quoteIdentifier(table)
+
+	var create, upsert string
+	if driver == "mysql" {
+		db.SetMaxOpenConns(2)
+		create = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			ns VARCHAR(64) NOT NULL,
+			k VARCHAR(255) NOT NULL,
+			value LONGBLOB NOT NULL,
+			expires_at BIGINT NULL,
+			PRIMARY KEY (ns, k),
+			INDEX idx_expires_at (expires_at)
+		)`, quoted)
+		upsert = fmt.Sprintf(`INSERT INTO %s (ns, k, value, expires_at) VALUES (?, ?, ?, ?)
+			ON DUPLICATE KEY UPDATE value = VALUES(value), expires_at = VALUES(expires_at)`, quoted)
+	} else {
+		// SQLite allows a single writer
+		db.SetMaxOpenConns(1)
+		create = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			ns TEXT NOT NULL,
+			k TEXT NOT NULL,
+			value BLOB NOT NULL,
+			expires_at INTEGER NULL,
+			PRIMARY KEY (ns, k)
+		)`, quoted)
+		upsert = fmt.Sprintf(`INSERT INTO %s (ns, k, value, expires_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (ns, k) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at`, quoted)
+	}
+
+	if _, err := db.Exec(create); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create storage table %s: %w", table, err)
+	}
+	return &SQLStorage{db: db, table: quoted, upsert: upsert}, nil
+}
+
+// Get returns the value of key
+func (s *SQLStorage) Get(ctx context.Context, namespace, key string) ([]byte, bool, error) {
+	var value []byte
+	err := s.db.QueryRowContext(ctx, "SELECT value FROM "+s.table+
+		" WHERE ns = ? AND k = ? AND (expires_at IS NULL OR expires_at > ?)",
+		namespace, key, time.Now().UnixMilli()).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return value, true, nil
+}
+
+// Put stores value under key
+func (s *SQLStorage) Put(ctx context.Context, namespace, key string, value []byte, ttl time.Duration) error {
+	var expiresAt interface{}
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl).UnixMilli()
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	_, err := s.db.ExecContext(ctx, s.upsert, namespace, key, value, expiresAt)
+	return err
+}
+
+// Delete removes key
+func (s *SQLStorage) Delete(ctx context.Context, namespace, key string) error {
+	_, err := s.db.ExecContext(ctx, "DELETE FROM "+s.table+" WHERE ns = ? AND k = ?", namespace, key)
+	return err
+}
+
+// likeEscaper escapes LIKE wildcards with '!', which needs no quoting in
+// either MySQL or SQLite string literals
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// List returns the items whose key starts with prefix
+func (s *SQLStorage) List(ctx context.Context, namespace, prefix string) ([]StorageItem, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT k, value, expires_at FROM "+s.table+
+		" WHERE ns = ? AND k LIKE ? ESCAPE '!' AND (expires_at IS NULL OR expires_at > ?) ORDER BY k",
+		namespace, likeEscaper.Replace(prefix)+"%", time.Now().UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []StorageItem
+	for rows.Next() {
+		var item StorageItem
+		var expiresAt sql.NullInt64
+		if err := rows.Scan(&item.Key, &item.Value, &expiresAt); err != nil {
+			return nil, err
+		}
+		if expiresAt.Valid {
+			item.ExpiresAt = time.UnixMilli(expiresAt.Int64)
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// PurgeExpired removes expired items
+func (s *SQLStorage) PurgeExpired(ctx context.Context) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM "+s.table+" WHERE expires_at IS NOT NULL AND expires_at <= ?",
+		time.Now().UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Close closes the dedicated database connection
+func (s *SQLStorage) Close() error {
+	return s.db.Close()
+}
+
+// SetStorage installs the storage shared by audit, scheduler history and
+// other subsystems. Call it before configuring those subsystems.
+func (h *Handler) SetStorage(storage Storage) {
+	h.storage = storage
+	if storage != nil {
+		log.Printf("[server] Storage configured: %T", storage)
+	}
+}
+
+// SetStorageConfig creates and installs a Storage from configuration
+func (h *Handler) SetStorageConfig(config StorageConfig) error {
+	storage, err := NewStorage(config, h.mysqlDSN)
+	if err != nil {
+		return err
+	}
+	h.SetStorage(storage)
+	return nil
+}
+
+// Storage returns the configured storage, or nil. Custom functions can
+// use it to persist their own state under a namespace of their own.
+func (h *Handler) Storage() Storage {
+	return h.storage
+}
+
+// purgeStorageLoop periodically removes expired storage items
+func (h *Handler) purgeStorageLoop(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			removed, err := h.storage.PurgeExpired(ctx)
+			if err != nil {
+				log.Printf("[server] Failed to purge expired storage items: %v", err)
+			} else if removed > 0 {
+				log.Printf("[server] Purged %d expired storage items", removed)
+			}
+		}
+	}
+}
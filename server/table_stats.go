@@ -0,0 +1,233 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// TableStatsConfig holds configuration for table statistics collection
+type TableStatsConfig struct {
+	Enabled  bool          // Whether table statistics are collected
+	Interval time.Duration // Time between collections
+	History  int           // Snapshots kept to compute growth rates
+}
+
+// DefaultTableStatsConfig returns the default table statistics configuration:
+// hourly snapshots, growth measured over the last week
+func DefaultTableStatsConfig() TableStatsConfig {
+	return TableStatsConfig{
+		Enabled:  false,
+		Interval: time.Hour,
+		History:  168,
+	}
+}
+
+// TableStat describes a table of the device database
+type TableStat struct {
+	Schema      string  `json:"schema"`
+	Table       string  `json:"table"`
+	Engine      string  `json:"engine"`
+	Rows        int64   `json:"rows"`        // Estimated by the storage engine for InnoDB
+	DataBytes   int64   `json:"data_bytes"`  // Size of the rows
+	IndexBytes  int64   `json:"index_bytes"` // Size of the secondary indexes
+	FreeBytes   int64   `json:"free_bytes"`  // Allocated but unused space
+	RowsPerDay  float64 `json:"rows_per_day"`
+	BytesPerDay float64 `json:"bytes_per_day"` // Growth of data and index size
+}
+
+// TableStatsReport is the result of a collection
+type TableStatsReport struct {
+	CollectedAt     time.Time   `json:"collected_at"`
+	GrowthSince     time.Time   `json:"growth_since,omitempty"` // Snapshot the growth rates are measured from
+	TotalDataBytes  int64       `json:"total_data_bytes"`
+	TotalIndexBytes int64       `json:"total_index_bytes"`
+	Tables          []TableStat `json:"tables"` // Largest first
+}
+
+// tableSnapshot is the size of every table at one point in time
+type tableSnapshot struct {
+	Time   time.Time           `json:"time"`
+	Tables map[string][2]int64 `json:"tables"` // schema.table -> rows, data+index bytes
+}
+
+// tableStatsNamespace is the Storage namespace of the snapshot history
+const tableStatsNamespace = "table_stats"
+
+// TableStatsCollector periodically reads table sizes from
+// INFORMATION_SCHEMA and derives growth rates from earlier snapshots. The
+// snapshots are kept in the shared storage when one is configured, so
+// growth rates survive restarts.
+type TableStatsCollector struct {
+	handler *Handler
+	config  TableStatsConfig
+
+	mutex   sync.Mutex
+	history []tableSnapshot
+	report  TableStatsReport
+}
+
+// NewTableStatsCollector creates a table statistics collector
+func NewTableStatsCollector(handler *Handler, config TableStatsConfig) *TableStatsCollector {
+	defaults := DefaultTableStatsConfig()
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.History <= 0 {
+		config.History = defaults.History
+	}
+	return &TableStatsCollector{handler: handler, config: config}
+}
+
+// run loads the snapshot history and collects every interval
+func (tc *TableStatsCollector) run(ctx context.Context) {
+	if storage := tc.handler.storage; storage != nil {
+		if value, found, err := storage.Get(ctx, tableStatsNamespace, "history"); err == nil && found {
+			var history []tableSnapshot
+			if json.Unmarshal(value, &history) == nil {
+				tc.mutex.Lock()
+				tc.history = history
+				tc.mutex.Unlock()
+			}
+		}
+	}
+
+	if _, err := tc.Collect(ctx); err != nil {
+		log.Printf("[server] Table statistics collection failed: %v", err)
+	}
+
+	ticker := time.NewTicker(tc.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := tc.Collect(ctx); err != nil {
+				log.Printf("[server] Table statistics collection failed: %v", err)
+			}
+		}
+	}
+}
+
+// Report returns the last collected report
+func (tc *TableStatsCollector) Report() TableStatsReport {
+	tc.mutex.Lock()
+	defer tc.mutex.Unlock()
+	return tc.report
+}
+
+// Collect reads the current table sizes, records a snapshot and replaces
+// the report
+func (tc *TableStatsCollector) Collect(ctx context.Context) (TableStatsReport, error) {
+	db, release, err := tc.handler.acquireDB()
+	if err != nil {
+		return TableStatsReport{}, err
+	}
+	defer release()
+
+	queryCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	tables, err := readTableStats(queryCtx, db)
+	if err != nil {
+		return TableStatsReport{}, err
+	}
+
+	now := time.Now()
+	snapshot := tableSnapshot{Time: now, Tables: make(map[string][2]int64, len(tables))}
+	for _, table := range tables {
+		snapshot.Tables[table.Schema+"."+table.Table] = [2]int64{table.Rows, table.DataBytes + table.IndexBytes}
+	}
+
+	tc.mutex.Lock()
+	tc.history = append(tc.history, snapshot)
+	if len(tc.history) > tc.config.History {
+		tc.history = tc.history[len(tc.history)-tc.config.History:]
+	}
+	oldest := tc.history[0]
+
+	report := TableStatsReport{CollectedAt: now, Tables: tables}
+	if elapsed := now.Sub(oldest.Time); elapsed >= time.Minute {
+		report.GrowthSince = oldest.Time
+		days := elapsed.Hours() / 24
+		for i := range report.Tables {
+			table := &report.Tables[i]
+			if before, ok := oldest.Tables[table.Schema+"."+table.Table]; ok {
+				table.RowsPerDay = float64(table.Rows-before[0]) / days
+				table.BytesPerDay = float64(table.DataBytes+table.IndexBytes-before[1]) / days
+			}
+		}
+	}
+	for _, table := range report.Tables {
+		report.TotalDataBytes += table.DataBytes
+		report.TotalIndexBytes += table.IndexBytes
+	}
+	tc.report = report
+	history, _ := json.Marshal(tc.history)
+	tc.mutex.Unlock()
+
+	if storage := tc.handler.storage; storage != nil && history != nil {
+		if err := storage.Put(ctx, tableStatsNamespace, "history", history, 0); err != nil {
+			log.Printf("[server] Failed to store table statistics history: %v", err)
+		}
+	}
+	return report, nil
+}
+
+// readTableStats reads the size of every base table of the current schema
+func readTableStats(ctx context.Context, db *sql.DB) ([]TableStat, error) {
+	rows, err := db.QueryContext(ctx, `SELECT table_schema, table_name, COALESCE(engine, ''),
+		COALESCE(table_rows, 0), COALESCE(data_length, 0), COALESCE(index_length, 0), COALESCE(data_free, 0)
+		FROM information_schema.tables
+		WHERE table_schema = DATABASE() AND table_type = 'BASE TABLE'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read table statistics: %w", err)
+	}
+	defer rows.Close()
+
+	var tables []TableStat
+	for rows.Next() {
+		var table TableStat
+		if err := rows.Scan(&table.Schema, &table.Table, &table.Engine,
+			&table.Rows, &table.DataBytes, &table.IndexBytes, &table.FreeBytes); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(tables, func(i, j int) bool {
+		return tables[i].DataBytes+tables[i].IndexBytes > tables[j].DataBytes+tables[j].IndexBytes
+	})
+	return tables, nil
+}
+
+// SetTableStatsConfig enables table statistics collection and registers the
+// getTableStats and refreshTableStats functions
+func (h *Handler) SetTableStatsConfig(config TableStatsConfig) {
+	if !config.Enabled {
+		h.tableStats = nil
+		return
+	}
+
+	h.tableStats = NewTableStatsCollector(h, config)
+
+	h.RegisterFunctionWithMetadata("getTableStats", func() TableStatsReport {
+		return h.tableStats.Report()
+	}, FunctionMetadata{Description: "Returns table sizes, row counts, index sizes and growth rates from the last collection"})
+	h.RegisterFunctionWithMetadata("refreshTableStats", func() (TableStatsReport, error) {
+		return h.tableStats.Collect(context.Background())
+	}, FunctionMetadata{Description: "Collects table statistics now and returns them"})
+
+	log.Printf("[server] Table statistics enabled: collected every %v, growth over %d snapshots",
+		h.tableStats.config.Interval, h.tableStats.config.History)
+}
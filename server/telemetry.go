@@ -0,0 +1,341 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lordbasex/burrowctl/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// telemetryChannel is the event channel telemetry reports are published
+// under, in the Channel field of the Event
+const telemetryChannel = "telemetry"
+
+// TelemetryConfig holds configuration for device telemetry reporting
+type TelemetryConfig struct {
+	Enabled  bool          // Whether telemetry is published and getDeviceTelemetry is registered
+	Interval time.Duration // Time between published reports
+	DiskPath string        // Filesystem whose usage is reported
+}
+
+// DefaultTelemetryConfig returns the default telemetry configuration: a
+// report every minute on the root filesystem
+func DefaultTelemetryConfig() TelemetryConfig {
+	return TelemetryConfig{
+		Enabled:  false,
+		Interval: time.Minute,
+		DiskPath: "/",
+	}
+}
+
+// DeviceTelemetry is a snapshot of the resources of the host a device runs
+// on. Values the platform cannot provide are left zero; errors reading the
+// database or the queue are reported instead of failing the whole report.
+type DeviceTelemetry struct {
+	DeviceID    string    `json:"device_id"`
+	Hostname    string    `json:"hostname"`
+	CollectedAt time.Time `json:"collected_at"`
+	Uptime      float64   `json:"uptime_seconds"` // Time since the server started
+
+	// CPU
+	NumCPU      int       `json:"num_cpu"`
+	CPUPercent  float64   `json:"cpu_percent"`            // Process CPU use, in percent of all cores
+	LoadAverage []float64 `json:"load_average,omitempty"` // Host 1, 5 and 15 minute load (Linux)
+	Goroutines  int       `json:"goroutines"`
+
+	// Memory
+	MemoryMB          float64 `json:"memory_mb"`                      // Process RSS
+	HostMemoryTotalMB float64 `json:"host_memory_total_mb,omitempty"` // Linux
+	HostMemoryFreeMB  float64 `json:"host_memory_free_mb,omitempty"`  // Available for new processes (Linux)
+
+	// Disk
+	DiskPath        string  `json:"disk_path"`
+	DiskTotalBytes  uint64  `json:"disk_total_bytes"`
+	DiskFreeBytes   uint64  `json:"disk_free_bytes"` // Available to unprivileged users
+	DiskUsedPercent float64 `json:"disk_used_percent"`
+	DiskError       string  `json:"disk_error,omitempty"`
+
+	// Database
+	DBUp        bool   `json:"db_up"`
+	DBSizeBytes int64  `json:"db_size_bytes"` // Data and index size of the current schema
+	DBError     string `json:"db_error,omitempty"`
+
+	// Queues
+	QueueDepth      int    `json:"queue_depth"`     // Requests waiting in the RPC queue
+	QueueConsumers  int    `json:"queue_consumers"` // Server instances consuming it
+	QueueError      string `json:"queue_error,omitempty"`
+	WorkerQueued    int    `json:"worker_queued"` // Requests taken off the queue waiting for a worker
+	WorkerQueueSize int    `json:"worker_queue_size"`
+}
+
+// TelemetryReporter periodically collects DeviceTelemetry and publishes it
+// to the telemetry exchange, which every device of a namespace shares, so a
+// dashboard follows the whole fleet with a single subscription
+type TelemetryReporter struct {
+	handler *Handler
+	config  TelemetryConfig
+	started time.Time
+
+	mutex  sync.Mutex
+	report DeviceTelemetry
+	failed bool // The last publish failed; logged once until one succeeds
+}
+
+// NewTelemetryReporter creates a telemetry reporter
+func NewTelemetryReporter(handler *Handler, config TelemetryConfig) *TelemetryReporter {
+	defaults := DefaultTelemetryConfig()
+	if config.Interval <= 0 {
+		config.Interval = defaults.Interval
+	}
+	if config.DiskPath == "" {
+		config.DiskPath = defaults.DiskPath
+	}
+	return &TelemetryReporter{handler: handler, config: config, started: time.Now()}
+}
+
+// run collects and publishes a report every interval until ctx is done
+func (tr *TelemetryReporter) run(ctx context.Context) {
+	ticker := time.NewTicker(tr.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tr.publish(tr.Collect(ctx))
+		}
+	}
+}
+
+// Report returns the last collected report
+func (tr *TelemetryReporter) Report() DeviceTelemetry {
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	return tr.report
+}
+
+// Collect samples the host, the database and the queues and replaces the
+// report
+func (tr *TelemetryReporter) Collect(ctx context.Context) DeviceTelemetry {
+	h := tr.handler
+	now := time.Now()
+	resources := h.resources.GetStats()
+
+	report := DeviceTelemetry{
+		DeviceID:    h.deviceID,
+		CollectedAt: now,
+		Uptime:      now.Sub(tr.started).Seconds(),
+		NumCPU:      runtime.NumCPU(),
+		CPUPercent:  resources.CPUPercent,
+		LoadAverage: hostLoadAverage(),
+		Goroutines:  runtime.NumGoroutine(),
+		MemoryMB:    float64(processRSS()) / (1024 * 1024),
+		DiskPath:    tr.config.DiskPath,
+	}
+	report.Hostname, _ = os.Hostname()
+	report.HostMemoryTotalMB, report.HostMemoryFreeMB = hostMemory()
+
+	if total, free, err := diskUsage(tr.config.DiskPath); err != nil {
+		report.DiskError = err.Error()
+	} else {
+		report.DiskTotalBytes, report.DiskFreeBytes = total, free
+		if total > 0 {
+			report.DiskUsedPercent = float64(total-free) / float64(total) * 100
+		}
+	}
+
+	queryCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	if size, err := tr.databaseSize(queryCtx); err != nil {
+		report.DBError = err.Error()
+	} else {
+		report.DBUp = true
+		report.DBSizeBytes = size
+	}
+
+	if messages, consumers, err := tr.queueDepth(); err != nil {
+		report.QueueError = err.Error()
+	} else {
+		report.QueueDepth, report.QueueConsumers = messages, consumers
+	}
+	if h.workerPool != nil {
+		pool := h.workerPool.GetStats()
+		report.WorkerQueued, report.WorkerQueueSize = pool.QueuedTasks, pool.QueueSize
+	}
+
+	tr.mutex.Lock()
+	tr.report = report
+	tr.mutex.Unlock()
+	return report
+}
+
+// databaseSize returns the data and index size of the current schema
+func (tr *TelemetryReporter) databaseSize(ctx context.Context) (int64, error) {
+	db, release, err := tr.handler.acquireDB()
+	if err != nil {
+		return 0, err
+	}
+	defer release()
+
+	var size int64
+	err = db.QueryRowContext(ctx, `SELECT COALESCE(SUM(data_length + index_length), 0)
+		FROM information_schema.tables WHERE table_schema = DATABASE()`).Scan(&size)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read database size: %w", err)
+	}
+	return size, nil
+}
+
+// queueDepth returns the messages waiting in the RPC queue and its
+// consumers. It inspects the queue on a channel of its own: a failed passive
+// declare closes the channel it was made on.
+func (tr *TelemetryReporter) queueDepth() (int, int, error) {
+	h := tr.handler
+	if h.conn == nil || h.conn.IsClosed() {
+		return 0, 0, fmt.Errorf("not connected to RabbitMQ")
+	}
+	ch, err := h.conn.Channel()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer ch.Close()
+
+	queue, err := ch.QueueDeclarePassive(h.rpcQueueName, false, false, false, false, nil)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to inspect RPC queue: %w", err)
+	}
+	return queue.Messages, queue.Consumers, nil
+}
+
+// publish sends a report to the telemetry exchange, routed by device ID
+func (tr *TelemetryReporter) publish(report DeviceTelemetry) {
+	h := tr.handler
+	body, err := json.Marshal(Event{
+		Channel:   telemetryChannel,
+		DeviceID:  h.deviceID,
+		Timestamp: report.CollectedAt,
+		Data:      report,
+	})
+	if err != nil {
+		log.Printf("[server] Failed to marshal telemetry: %v", err)
+		return
+	}
+
+	h.eventsMutex.Lock()
+	if h.eventsChannel == nil {
+		err = fmt.Errorf("server is not running")
+	} else {
+		err = h.eventsChannel.Publish(h.telemetryExchangeName, h.deviceID, false, false, amqp.Publishing{
+			ContentType: "application/json",
+			Timestamp:   report.CollectedAt,
+			Expiration:  durationMillis(tr.config.Interval),
+			Body:        body,
+		})
+	}
+	h.eventsMutex.Unlock()
+
+	tr.mutex.Lock()
+	defer tr.mutex.Unlock()
+	if err != nil && !tr.failed {
+		log.Printf("[server] Failed to publish telemetry: %v", err)
+	} else if err == nil && tr.failed {
+		log.Printf("[server] Telemetry published again")
+	}
+	tr.failed = err != nil
+}
+
+// declareTelemetryExchange declares the exchange telemetry is published to
+// on the events channel
+func (h *Handler) declareTelemetryExchange(ch *amqp.Channel) error {
+	err := ch.ExchangeDeclare(
+		h.telemetryExchangeName, // name - shared by the devices of the namespace
+		"topic",                 // kind - route by device ID
+		false,                   // durable - non-persistent like the events exchange
+		false,                   // auto-deleted
+		false,                   // internal
+		false,                   // no-wait
+		nil,                     // arguments
+	)
+	if err != nil {
+		return fmt.Errorf("failed to declare telemetry exchange: %w", client.ExplainAMQPError(err, h.amqpURL))
+	}
+	return nil
+}
+
+// hostLoadAverage returns the 1, 5 and 15 minute load averages of the host,
+// or nil where /proc/loadavg does not exist
+func hostLoadAverage() []float64 {
+	data, err := os.ReadFile("/proc/loadavg")
+	if err != nil {
+		return nil
+	}
+	fields := strings.Fields(string(data))
+	if len(fields) < 3 {
+		return nil
+	}
+	load := make([]float64, 3)
+	for i := range load {
+		if load[i], err = strconv.ParseFloat(fields[i], 64); err != nil {
+			return nil
+		}
+	}
+	return load
+}
+
+// hostMemory returns the total and available memory of the host in MB, or
+// zeros where /proc/meminfo does not exist
+func hostMemory() (total, available float64) {
+	file, err := os.Open("/proc/meminfo")
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		kb, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			continue
+		}
+		switch fields[0] {
+		case "MemTotal:":
+			total = kb / 1024
+		case "MemAvailable:":
+			available = kb / 1024
+		}
+	}
+	return total, available
+}
+
+// SetTelemetryConfig enables telemetry reporting and registers the
+// getDeviceTelemetry function
+func (h *Handler) SetTelemetryConfig(config TelemetryConfig) {
+	if !config.Enabled {
+		h.telemetry = nil
+		return
+	}
+
+	h.telemetry = NewTelemetryReporter(h, config)
+
+	h.RegisterFunctionWithMetadata("getDeviceTelemetry", func() DeviceTelemetry {
+		return h.telemetry.Collect(context.Background())
+	}, FunctionMetadata{Description: "Returns CPU, memory, disk, database size and queue depth of the device host"})
+
+	log.Printf("[server] Telemetry enabled: published to %s every %v (disk %s)",
+		h.telemetryExchangeName, h.telemetry.config.Interval, h.telemetry.config.DiskPath)
+}
@@ -0,0 +1,495 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"log"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Error codes of requests rejected by token authentication
+const (
+	ErrTokenInvalid = "TOKEN_INVALID" // Missing, malformed, badly signed or not valid for the request
+	ErrTokenExpired = "TOKEN_EXPIRED" // Expired or not valid yet; fetch a new token and retry
+)
+
+// jwksRetryInterval bounds how often an unknown key ID refetches the JWKS
+const jwksRetryInterval = time.Minute
+
+// jwksTimeout bounds a JWKS download
+const jwksTimeout = 10 * time.Second
+
+// ecdsaCurves are the curves of the keys each ES algorithm signs with
+var ecdsaCurves = map[string]string{
+	"ES256": "P-256",
+	"ES384": "P-384",
+	"ES512": "P-521",
+}
+
+// TokenAuthConfig configures the validation of the JWTs clients present
+// with their requests. Tokens are signed with a shared secret (HS256,
+// HS384, HS512) or with keys published as a JWKS (RS*, PS*, ES*).
+type TokenAuthConfig struct {
+	Secret      string        // HMAC key of HS* tokens
+	JWKSURL     string        // URL of the JSON Web Key Set of RS*, PS* and ES* tokens
+	JWKSRefresh time.Duration // How often the JWKS is fetched again (default 1h)
+	Issuer      string        // Required iss claim (empty: any)
+	Audience    string        // Required aud claim (empty: any)
+	Leeway      time.Duration // Clock skew tolerated when checking exp and nbf
+	Required    bool          // Reject requests without token; when false only present tokens are checked
+}
+
+// Enabled reports whether tokens are validated at all
+func (tc TokenAuthConfig) Enabled() bool {
+	return tc.Secret != "" || tc.JWKSURL != ""
+}
+
+// TokenClaims are the claims of a validated token
+type TokenClaims struct {
+	Subject   string   // sub: who the token was issued to
+	Issuer    string   // iss
+	Audience  []string // aud
+	ExpiresAt time.Time
+	DeviceID  string   // deviceID: glob pattern of the devices the token is valid for (empty: any)
+	Role      string   // role: access control role of the client (empty: the principal's roles)
+	Commands  []string // commands: glob patterns of the programs command requests may run (nil: any)
+}
+
+// jwtHeader is the header of a JWT
+type jwtHeader struct {
+	Algorithm string `json:"alg"`
+	KeyID     string `json:"kid"`
+}
+
+// TokenAuthenticator validates JWTs
+type TokenAuthenticator struct {
+	config TokenAuthConfig
+	jwks   *jwksCache
+}
+
+// NewTokenAuthenticator returns an authenticator for config
+func NewTokenAuthenticator(config TokenAuthConfig) (*TokenAuthenticator, error) {
+	if !config.Enabled() {
+		return nil, fmt.Errorf("token authentication needs a secret or a JWKS URL")
+	}
+	if config.JWKSRefresh <= 0 {
+		config.JWKSRefresh = time.Hour
+	}
+
+	ta := &TokenAuthenticator{config: config}
+	if config.JWKSURL != "" {
+		ta.jwks = &jwksCache{
+			url:     config.JWKSURL,
+			refresh: config.JWKSRefresh,
+			client:  &http.Client{Timeout: jwksTimeout},
+		}
+		// Fetch the keys now so a wrong URL shows at startup
+		if err := ta.jwks.fetch(); err != nil {
+			log.Printf("[server] Warning: failed to fetch JWKS: %v", err)
+		}
+	}
+	return ta, nil
+}
+
+// tokenError is a token validation failure with its error code
+type tokenError struct {
+	code    string
+	message string
+}
+
+func (e *tokenError) Error() string { return e.message }
+
+// invalidToken returns a TOKEN_INVALID error
+func invalidToken(format string, args ...interface{}) error {
+	return &tokenError{code: ErrTokenInvalid, message: fmt.Sprintf(format, args...)}
+}
+
+// Validate checks the signature, expiry and standard claims of token and
+// returns its claims
+func (ta *TokenAuthenticator) Validate(token string, now time.Time) (*TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, invalidToken("token is not a JWT")
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, invalidToken("invalid token header: %v", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, invalidToken("invalid token signature encoding")
+	}
+	if err := ta.verify(header, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var raw map[string]interface{}
+	if err := decodeSegment(parts[1], &raw); err != nil {
+		return nil, invalidToken("invalid token claims: %v", err)
+	}
+	return ta.checkClaims(raw, now)
+}
+
+// verify checks the signature of a token with the key its algorithm uses
+func (ta *TokenAuthenticator) verify(header jwtHeader, signed string, signature []byte) error {
+	var newHash func() hash.Hash
+	var cryptoHash crypto.Hash
+	switch header.Algorithm[min(2, len(header.Algorithm)):] {
+	case "256":
+		newHash, cryptoHash = sha256.New, crypto.SHA256
+	case "384":
+		newHash, cryptoHash = sha512.New384, crypto.SHA384
+	case "512":
+		newHash, cryptoHash = sha512.New, crypto.SHA512
+	default:
+		return invalidToken("unsupported token algorithm %q", header.Algorithm)
+	}
+
+	if strings.HasPrefix(header.Algorithm, "HS") {
+		if ta.config.Secret == "" {
+			return invalidToken("HMAC tokens are not accepted by this server")
+		}
+		mac := hmac.New(newHash, []byte(ta.config.Secret))
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return invalidToken("invalid token signature")
+		}
+		return nil
+	}
+
+	if ta.jwks == nil {
+		return invalidToken("%s tokens are not accepted by this server", header.Algorithm)
+	}
+	key, err := ta.jwks.key(header.KeyID)
+	if err != nil {
+		return invalidToken("%v", err)
+	}
+	digest := newHash()
+	digest.Write([]byte(signed))
+	sum := digest.Sum(nil)
+
+	valid := false
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		switch header.Algorithm[:2] {
+		case "RS":
+			valid = rsa.VerifyPKCS1v15(pub, cryptoHash, sum, signature) == nil
+		case "PS":
+			valid = rsa.VerifyPSS(pub, cryptoHash, sum, signature, nil) == nil
+		default:
+			return invalidToken("key %q cannot verify %s tokens", header.KeyID, header.Algorithm)
+		}
+	case *ecdsa.PublicKey:
+		params := pub.Curve.Params()
+		if ecdsaCurves[header.Algorithm] != params.Name {
+			return invalidToken("key %q (curve %s) cannot verify %s tokens", header.KeyID, params.Name, header.Algorithm)
+		}
+		size := (params.BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return invalidToken("invalid token signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		valid = ecdsa.Verify(pub, sum, r, s)
+	}
+	if !valid {
+		return invalidToken("invalid token signature")
+	}
+	return nil
+}
+
+// checkClaims checks the time window, issuer and audience of a token and
+// reads its claims
+func (ta *TokenAuthenticator) checkClaims(raw map[string]interface{}, now time.Time) (*TokenClaims, error) {
+	claims := &TokenClaims{}
+
+	exp, ok := raw["exp"].(float64)
+	if !ok {
+		return nil, invalidToken("token has no expiry (exp)")
+	}
+	claims.ExpiresAt = time.Unix(int64(exp), 0)
+	if now.After(claims.ExpiresAt.Add(ta.config.Leeway)) {
+		return nil, &tokenError{code: ErrTokenExpired, message: fmt.Sprintf("token expired at %s", claims.ExpiresAt.UTC().Format(time.RFC3339))}
+	}
+	if nbf, ok := raw["nbf"].(float64); ok && now.Add(ta.config.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return nil, &tokenError{code: ErrTokenExpired, message: "token is not valid yet"}
+	}
+
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Issuer, _ = raw["iss"].(string)
+	if ta.config.Issuer != "" && claims.Issuer != ta.config.Issuer {
+		return nil, invalidToken("token issuer %q is not accepted", claims.Issuer)
+	}
+	claims.Audience = claimStrings(raw["aud"])
+	if ta.config.Audience != "" && !contains(claims.Audience, ta.config.Audience) {
+		return nil, invalidToken("token is not issued for audience %q", ta.config.Audience)
+	}
+
+	claims.DeviceID, _ = raw["deviceID"].(string)
+	claims.Role, _ = raw["role"].(string)
+	if commands, present := raw["commands"]; present {
+		claims.Commands = claimStrings(commands)
+		if claims.Commands == nil {
+			claims.Commands = []string{}
+		}
+	}
+	return claims, nil
+}
+
+// decodeSegment decodes a base64url JSON segment of a JWT
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// claimStrings reads a claim that is a string or an array of strings
+func claimStrings(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// jwksCache holds the public keys of a JWKS by key ID
+type jwksCache struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetched     time.Time // When keys were last fetched
+	lastAttempt time.Time // When a fetch was last tried
+}
+
+// key returns the key with the given ID, fetching the JWKS again when it is
+// due or the key is unknown (keys rotate). A token without key ID uses the
+// only key of the set.
+func (jc *jwksCache) key(kid string) (crypto.PublicKey, error) {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+
+	key, found := jc.lookup(kid)
+	stale := time.Since(jc.fetched) > jc.refresh
+	if (stale || !found) && time.Since(jc.lastAttempt) > jwksRetryInterval {
+		if err := jc.fetchLocked(); err != nil {
+			log.Printf("[server] Failed to fetch JWKS: %v", err)
+		}
+		key, found = jc.lookup(kid)
+	}
+	if !found {
+		return nil, fmt.Errorf("unknown token key %q", kid)
+	}
+	return key, nil
+}
+
+// lookup returns a cached key
+func (jc *jwksCache) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(jc.keys) == 1 {
+		for _, key := range jc.keys {
+			return key, true
+		}
+	}
+	key, found := jc.keys[kid]
+	return key, found
+}
+
+// fetch downloads the JWKS
+func (jc *jwksCache) fetch() error {
+	jc.mu.Lock()
+	defer jc.mu.Unlock()
+	return jc.fetchLocked()
+}
+
+// fetchLocked downloads the JWKS; jc.mu must be held
+func (jc *jwksCache) fetchLocked() error {
+	jc.lastAttempt = time.Now()
+	resp, err := jc.client.Get(jc.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", jc.url, resp.Status)
+	}
+
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return fmt.Errorf("invalid JWKS: %w", err)
+	}
+	keys := make(map[string]crypto.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("[server] Skipping JWKS key %q: %v", jwk.KeyID, err)
+			continue
+		}
+		keys[jwk.KeyID] = key
+	}
+	jc.keys, jc.fetched = keys, time.Now()
+	return nil
+}
+
+// jsonWebKey is an RSA or EC public key of a JWKS
+type jsonWebKey struct {
+	KeyType string `json:"kty"`
+	KeyID   string `json:"kid"`
+	Use     string `json:"use"`
+	N       string `json:"n"`   // RSA modulus
+	E       string `json:"e"`   // RSA exponent
+	Curve   string `json:"crv"` // EC curve
+	X       string `json:"x"`   // EC point
+	Y       string `json:"y"`
+}
+
+// publicKey decodes the key
+func (jwk jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	decode := func(value string) (*big.Int, error) {
+		data, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(data) == 0 {
+			return nil, fmt.Errorf("invalid key parameter")
+		}
+		return new(big.Int).SetBytes(data), nil
+	}
+
+	switch jwk.KeyType {
+	case "RSA":
+		n, err := decode(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Curve)
+		}
+		x, err := decode(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", jwk.KeyType)
+}
+
+// SetTokenAuthConfig makes the handler validate the tokens of requests
+func (h *Handler) SetTokenAuthConfig(config TokenAuthConfig) error {
+	authenticator, err := NewTokenAuthenticator(config)
+	if err != nil {
+		return err
+	}
+	h.tokenAuth = authenticator
+	log.Printf("[server] Token authentication configured: hmac=%v jwks=%v required=%v",
+		config.Secret != "", config.JWKSURL != "", config.Required)
+	return nil
+}
+
+// authenticateToken validates the token of a request and checks its claims
+// against the request: the device it targets and, for commands, the program
+// it runs. It returns nil claims when the request carries no token and
+// none is required. Heartbeats are not authenticated.
+func (h *Handler) authenticateToken(req RPCRequest) (*TokenClaims, error) {
+	if h.tokenAuth == nil || req.Type == "heartbeat_ping" {
+		return nil, nil
+	}
+	if req.Token == "" {
+		if h.tokenAuth.config.Required {
+			return nil, invalidToken("a token is required")
+		}
+		return nil, nil
+	}
+
+	claims, err := h.tokenAuth.Validate(req.Token, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if claims.DeviceID != "" && !matchAny([]string{claims.DeviceID}, h.deviceID) {
+		return nil, invalidToken("token is not valid for device %s", h.deviceID)
+	}
+	if claims.Commands != nil {
+		if command, ok := requestCommand(req); ok && !matchAny(claims.Commands, commandProgram(command)) {
+			return nil, invalidToken("token does not allow running %s", commandProgram(command))
+		}
+	}
+	return claims, nil
+}
+
+// requestCommand returns the command line a request runs, if it runs one
+func requestCommand(req RPCRequest) (string, bool) {
+	switch req.Type {
+	case "command":
+		return req.Query, true
+	case "job":
+		var jobReq JobRequest
+		if err := json.Unmarshal([]byte(req.Query), &jobReq); err == nil && jobReq.Kind == "command" {
+			return jobReq.Command, true
+		}
+	}
+	return "", false
+}
+
+// commandProgram returns the program of a command line
+func commandProgram(command string) string {
+	if fields := strings.Fields(command); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
+
+// tokenErrorCode returns the RPCResponse.ErrorCode of a token error
+func tokenErrorCode(err error) string {
+	if tokenErr, ok := err.(*tokenError); ok {
+		return tokenErr.code
+	}
+	return ErrTokenInvalid
+}
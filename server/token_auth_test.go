@@ -0,0 +1,102 @@
+package server
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// TestTokenECDSACurve checks that an ES token is only verified with a key on
+// the curve its algorithm names
+func TestTokenECDSACurve(t *testing.T) {
+	keys := map[string]*ecdsa.PrivateKey{}
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	for kid, curve := range map[string]elliptic.Curve{"p256": elliptic.P256(), "p384": elliptic.P384()} {
+		key, err := ecdsa.GenerateKey(curve, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[kid] = key
+		set.Keys = append(set.Keys, jsonWebKey{
+			KeyType: "EC",
+			KeyID:   kid,
+			Curve:   curve.Params().Name,
+			X:       base64.RawURLEncoding.EncodeToString(key.X.Bytes()),
+			Y:       base64.RawURLEncoding.EncodeToString(key.Y.Bytes()),
+		})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(set)
+	}))
+	defer server.Close()
+
+	ta, err := NewTokenAuthenticator(TokenAuthConfig{JWKSURL: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		alg      string
+		kid      string
+		hash     crypto.Hash
+		contains string // "" when the token is accepted
+	}{
+		{alg: "ES256", kid: "p256", hash: crypto.SHA256},
+		{alg: "ES384", kid: "p384", hash: crypto.SHA384},
+		{alg: "ES256", kid: "p384", hash: crypto.SHA256, contains: "cannot verify ES256 tokens"},
+		{alg: "ES384", kid: "p256", hash: crypto.SHA384, contains: "cannot verify ES384 tokens"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.alg+"/"+tt.kid, func(t *testing.T) {
+			token := signECDSAToken(t, tt.alg, tt.kid, tt.hash, keys[tt.kid])
+			_, err := ta.Validate(token, time.Now())
+			if tt.contains == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.contains) {
+				t.Fatalf("got %v, want an error containing %q", err, tt.contains)
+			}
+		})
+	}
+}
+
+// signECDSAToken returns a JWT with header alg and kid, signed by key over a
+// digest of hash
+func signECDSAToken(t *testing.T, alg, kid string, hash crypto.Hash, key *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(jwtHeader{Algorithm: alg, KeyID: kid}) + "." +
+		segment(map[string]interface{}{"sub": "tester", "exp": time.Now().Add(time.Hour).Unix()})
+
+	digest := hash.New()
+	digest.Write([]byte(signed))
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest.Sum(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := (key.Curve.Params().BitSize + 7) / 8
+	signature := make([]byte, 2*size)
+	r.FillBytes(signature[:size])
+	s.FillBytes(signature[size:])
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
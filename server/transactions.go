@@ -4,9 +4,11 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/lordbasex/burrowctl/clock"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -14,27 +16,114 @@ import (
 // It maintains a registry of active transactions and provides thread-safe
 // access to transaction instances.
 type TransactionManager struct {
-	transactions map[string]*Transaction // Active transactions indexed by transaction ID
-	mutex        sync.RWMutex            // Thread-safe access to transactions map
+	transactions map[string]*Transaction        // Active transactions indexed by transaction ID
+	finished     map[string]finishedTransaction // Recently finished transactions and their terminal state
+	mutex        sync.RWMutex                   // Thread-safe access to transactions map
+	clock        clock.Clock                    // Time source for expiry (clock.Real unless replaced)
+	config       TransactionConfig              // Lifetime and idle limits
+}
+
+// TransactionInfo describes an open transaction, as returned by
+// Handler.GetActiveTransactions.
+type TransactionInfo struct {
+	ID         string    `json:"id"`
+	ClientIP   string    `json:"client_ip"`
+	User       string    `json:"user,omitempty"`
+	StartTime  time.Time `json:"start_time"`
+	LastUsed   time.Time `json:"last_used"`
+	Age        string    `json:"age"`  // Time since BEGIN
+	Idle       string    `json:"idle"` // Time since the last statement
+	Statements int64     `json:"statements"`
+}
+
+// TransactionConfig holds the expiry limits of server-side transactions.
+type TransactionConfig struct {
+	MaxLifetime     time.Duration // Longest a transaction may stay open, even when in use (0 = unlimited)
+	IdleTimeout     time.Duration // Longest a transaction may go unused (default 30m)
+	CleanupInterval time.Duration // How often expired transactions are rolled back (default 5m)
+}
+
+// DefaultTransactionConfig returns the default transaction limits
+func DefaultTransactionConfig() TransactionConfig {
+	return TransactionConfig{
+		MaxLifetime:     0,
+		IdleTimeout:     30 * time.Minute,
+		CleanupInterval: 5 * time.Minute,
+	}
 }
 
 // Transaction represents an active database transaction.
 // It maintains the transaction state, database connection, and metadata.
 type Transaction struct {
-	ID        string         // Unique transaction identifier
-	Tx        *sql.Tx        // Database transaction instance
-	StartTime time.Time      // When the transaction was started
-	LastUsed  time.Time      // Last time the transaction was used
-	mutex     sync.RWMutex   // Thread-safe access to transaction state
+	ID         string       // Unique transaction identifier
+	Tx         *sql.Tx      // Database transaction instance
+	StartTime  time.Time    // When the transaction was started
+	LastUsed   time.Time    // Last time the transaction was used
+	Status     TxStatus     // Current state in the transaction state machine
+	ClientIP   string       // Client that began the transaction
+	User       string       // RabbitMQ user of the client that began the transaction
+	Statements int64        // Statements run in the transaction so far
+	mutex      sync.RWMutex // Thread-safe access to transaction state
+
+	lastSequence int64    // Highest statement sequence number received (replay protection)
+	lastReply    *txReply // Response to the statement numbered lastSequence
+}
+
+// transition moves the transaction to the next state if the state machine allows it.
+func (t *Transaction) transition(next TxStatus) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if !t.Status.CanTransition(next) {
+		if t.Status.IsTerminal() {
+			return terminalTxError(t.ID, t.Status)
+		}
+		return newTxError(TxErrInvalidTransition, t.ID, "transaction %s cannot move from %s to %s", t.ID, t.Status, next)
+	}
+	t.Status = next
+	return nil
 }
 
 // NewTransactionManager creates a new transaction manager instance.
 func NewTransactionManager() *TransactionManager {
 	return &TransactionManager{
 		transactions: make(map[string]*Transaction),
+		finished:     make(map[string]finishedTransaction),
+		clock:        clock.Real,
+		config:       DefaultTransactionConfig(),
 	}
 }
 
+// SetConfig replaces the transaction limits; zero durations keep their defaults
+// (MaxLifetime has none: zero leaves it unlimited).
+func (tm *TransactionManager) SetConfig(config TransactionConfig) {
+	defaults := DefaultTransactionConfig()
+	if config.IdleTimeout <= 0 {
+		config.IdleTimeout = defaults.IdleTimeout
+	}
+	if config.CleanupInterval <= 0 {
+		config.CleanupInterval = defaults.CleanupInterval
+	}
+
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.config = config
+}
+
+// Config returns the transaction limits in use.
+func (tm *TransactionManager) Config() TransactionConfig {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+	return tm.config
+}
+
+// SetClock replaces the time source used for expiry and durations (for tests).
+func (tm *TransactionManager) SetClock(c clock.Clock) {
+	tm.mutex.Lock()
+	defer tm.mutex.Unlock()
+	tm.clock = clock.OrReal(c)
+}
+
 // BeginTransaction starts a new database transaction.
 //
 // Parameters:
@@ -48,23 +137,31 @@ func (tm *TransactionManager) BeginTransaction(transactionID string, db *sql.DB)
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
 
-	// Check if transaction already exists
+	if transactionID == "" {
+		return nil, newTxError(TxErrMissingID, transactionID, "transaction ID is required")
+	}
+
+	// Check if transaction already exists, either active or recently finished
 	if _, exists := tm.transactions[transactionID]; exists {
-		return nil, fmt.Errorf("transaction %s already exists", transactionID)
+		return nil, newTxError(TxErrAlreadyExists, transactionID, "transaction %s already exists", transactionID)
+	}
+	if _, finished := tm.finished[transactionID]; finished {
+		return nil, newTxError(TxErrAlreadyExists, transactionID, "transaction %s already exists", transactionID)
 	}
 
 	// Start database transaction
 	tx, err := db.Begin()
 	if err != nil {
-		return nil, fmt.Errorf("failed to begin database transaction: %v", err)
+		return nil, newTxError(TxErrBeginFailed, transactionID, "failed to begin database transaction: %v", err)
 	}
 
 	// Create transaction instance
 	transaction := &Transaction{
 		ID:        transactionID,
 		Tx:        tx,
-		StartTime: time.Now(),
-		LastUsed:  time.Now(),
+		StartTime: tm.clock.Now(),
+		LastUsed:  tm.clock.Now(),
+		Status:    TxStatusActive,
 	}
 
 	// Register transaction
@@ -89,13 +186,102 @@ func (tm *TransactionManager) GetTransaction(transactionID string) (*Transaction
 	transaction, exists := tm.transactions[transactionID]
 	if exists {
 		transaction.mutex.Lock()
-		transaction.LastUsed = time.Now()
+		transaction.LastUsed = tm.clock.Now()
 		transaction.mutex.Unlock()
 	}
 
 	return transaction, exists
 }
 
+// LookupTransaction retrieves an active transaction by ID and explains why
+// it cannot be used otherwise. A transaction past its idle timeout or maximum
+// lifetime is expired right away instead of waiting for the cleanup loop.
+//
+// Parameters:
+//   - transactionID: Unique identifier for the transaction
+//
+// Returns:
+//   - *Transaction: The transaction instance if it is active
+//   - error: A *TxError describing the state of an unusable transaction
+func (tm *TransactionManager) LookupTransaction(transactionID string) (*Transaction, error) {
+	tm.mutex.Lock()
+	transaction, exists := tm.transactions[transactionID]
+	if exists {
+		now := tm.clock.Now()
+		if reason := tm.expiryReason(transaction, now, tm.config.IdleTimeout); reason != "" {
+			tm.expire(transaction, reason)
+			tm.mutex.Unlock()
+			return nil, tm.missingTransactionError(transactionID)
+		}
+		transaction.mutex.Lock()
+		transaction.LastUsed = now
+		transaction.Statements++
+		transaction.mutex.Unlock()
+	}
+	tm.mutex.Unlock()
+
+	if exists {
+		return transaction, nil
+	}
+	return nil, tm.missingTransactionError(transactionID)
+}
+
+// expiryReason returns why a transaction must expire, or "" while it may
+// still be used (must be called with tm.mutex held).
+func (tm *TransactionManager) expiryReason(transaction *Transaction, now time.Time, idleTimeout time.Duration) string {
+	transaction.mutex.RLock()
+	defer transaction.mutex.RUnlock()
+
+	if tm.config.MaxLifetime > 0 && now.Sub(transaction.StartTime) > tm.config.MaxLifetime {
+		return fmt.Sprintf("open longer than the maximum lifetime of %s", tm.config.MaxLifetime)
+	}
+	if idleTimeout > 0 && now.Sub(transaction.LastUsed) > idleTimeout {
+		return fmt.Sprintf("idle longer than %s", idleTimeout)
+	}
+	return ""
+}
+
+// expire rolls back a transaction and records why it expired (must be
+// called with tm.mutex held).
+func (tm *TransactionManager) expire(transaction *Transaction, reason string) {
+	// Force rollback the database transaction
+	if err := transaction.Tx.Rollback(); err != nil {
+		log.Printf("[server] Error rolling back expired transaction %s: %v", transaction.ID, err)
+	}
+
+	// Record the expiry and remove from registry
+	transaction.transition(TxStatusExpired)
+	tm.finish(transaction)
+	finished := tm.finished[transaction.ID]
+	finished.Reason = reason
+	tm.finished[transaction.ID] = finished
+
+	duration := tm.clock.Since(transaction.StartTime)
+	log.Printf("[server] Expired transaction cleaned up: %s (%s, duration: %v)", transaction.ID, reason, duration)
+}
+
+// missingTransactionError builds the error for a transaction that is not active.
+func (tm *TransactionManager) missingTransactionError(transactionID string) *TxError {
+	tm.mutex.RLock()
+	finished, ok := tm.finished[transactionID]
+	tm.mutex.RUnlock()
+
+	if ok {
+		return finished.txError(transactionID)
+	}
+	return newTxError(TxErrNotFound, transactionID, "transaction %s not found", transactionID)
+}
+
+// finish records the terminal state of a transaction and removes it from the
+// active registry (must be called with tm.mutex held).
+func (tm *TransactionManager) finish(transaction *Transaction) {
+	delete(tm.transactions, transaction.ID)
+	tm.finished[transaction.ID] = finishedTransaction{
+		Status:     transaction.Status,
+		FinishedAt: tm.clock.Now(),
+	}
+}
+
 // CommitTransaction commits a transaction and removes it from the registry.
 //
 // Parameters:
@@ -109,19 +295,32 @@ func (tm *TransactionManager) CommitTransaction(transactionID string) error {
 
 	transaction, exists := tm.transactions[transactionID]
 	if !exists {
-		return fmt.Errorf("transaction %s not found", transactionID)
+		if finished, ok := tm.finished[transactionID]; ok {
+			return finished.txError(transactionID)
+		}
+		return newTxError(TxErrNotFound, transactionID, "transaction %s not found", transactionID)
 	}
 
-	// Commit the database transaction
-	err := transaction.Tx.Commit()
-	if err != nil {
-		return fmt.Errorf("failed to commit transaction %s: %v", transactionID, err)
+	// A transaction past its limits is expired rather than committed
+	if reason := tm.expiryReason(transaction, tm.clock.Now(), tm.config.IdleTimeout); reason != "" {
+		tm.expire(transaction, reason)
+		return tm.finished[transactionID].txError(transactionID)
+	}
+
+	// Commit the database transaction. database/sql releases the transaction
+	// even when Commit fails, so a failed commit is terminal as well.
+	if err := transaction.Tx.Commit(); err != nil {
+		transaction.transition(TxStatusFailed)
+		tm.finish(transaction)
+		return newTxError(TxErrCommitFailed, transactionID, "failed to commit transaction %s: %v", transactionID, err)
 	}
 
-	// Remove from registry
-	delete(tm.transactions, transactionID)
+	if err := transaction.transition(TxStatusCommitted); err != nil {
+		return err
+	}
+	tm.finish(transaction)
 
-	duration := time.Since(transaction.StartTime)
+	duration := tm.clock.Since(transaction.StartTime)
 	log.Printf("[server] Transaction committed: %s (duration: %v)", transactionID, duration)
 	return nil
 }
@@ -139,25 +338,37 @@ func (tm *TransactionManager) RollbackTransaction(transactionID string) error {
 
 	transaction, exists := tm.transactions[transactionID]
 	if !exists {
-		return fmt.Errorf("transaction %s not found", transactionID)
+		if finished, ok := tm.finished[transactionID]; ok {
+			return finished.txError(transactionID)
+		}
+		return newTxError(TxErrNotFound, transactionID, "transaction %s not found", transactionID)
 	}
 
 	// Rollback the database transaction
-	err := transaction.Tx.Rollback()
-	if err != nil {
-		return fmt.Errorf("failed to rollback transaction %s: %v", transactionID, err)
+	if err := transaction.Tx.Rollback(); err != nil {
+		transaction.transition(TxStatusFailed)
+		tm.finish(transaction)
+		return newTxError(TxErrRollbackFailed, transactionID, "failed to rollback transaction %s: %v", transactionID, err)
 	}
 
-	// Remove from registry
-	delete(tm.transactions, transactionID)
+	if err := transaction.transition(TxStatusRolledBack); err != nil {
+		return err
+	}
+	tm.finish(transaction)
 
-	duration := time.Since(transaction.StartTime)
+	duration := tm.clock.Since(transaction.StartTime)
 	log.Printf("[server] Transaction rolled back: %s (duration: %v)", transactionID, duration)
 	return nil
 }
 
-// CleanupExpiredTransactions removes transactions that have been inactive for too long.
-// This prevents memory leaks and database connection exhaustion.
+// ExpireTransactions rolls back the transactions past the configured idle
+// timeout or maximum lifetime.
+func (tm *TransactionManager) ExpireTransactions() {
+	tm.CleanupExpiredTransactions(tm.Config().IdleTimeout)
+}
+
+// CleanupExpiredTransactions removes transactions that have been inactive for too long
+// or exceeded the maximum lifetime. This prevents memory leaks and database connection exhaustion.
 //
 // Parameters:
 //   - maxAge: Maximum age for inactive transactions
@@ -165,35 +376,61 @@ func (tm *TransactionManager) CleanupExpiredTransactions(maxAge time.Duration) {
 	tm.mutex.Lock()
 	defer tm.mutex.Unlock()
 
-	now := time.Now()
-	var expiredIDs []string
+	now := tm.clock.Now()
 
-	// Find expired transactions
-	for id, transaction := range tm.transactions {
-		transaction.mutex.RLock()
-		if now.Sub(transaction.LastUsed) > maxAge {
-			expiredIDs = append(expiredIDs, id)
+	// Find and clean up expired transactions
+	for _, transaction := range tm.transactions {
+		if reason := tm.expiryReason(transaction, now, maxAge); reason != "" {
+			tm.expire(transaction, reason)
 		}
-		transaction.mutex.RUnlock()
 	}
 
-	// Clean up expired transactions
-	for _, id := range expiredIDs {
-		transaction := tm.transactions[id]
-		
-		// Force rollback the database transaction
-		if err := transaction.Tx.Rollback(); err != nil {
-			log.Printf("[server] Error rolling back expired transaction %s: %v", id, err)
+	// Forget terminal states once they are old enough that no client can still be using them
+	for id, finished := range tm.finished {
+		if now.Sub(finished.FinishedAt) > finishedTransactionRetention {
+			delete(tm.finished, id)
 		}
-		
-		// Remove from registry
-		delete(tm.transactions, id)
-		
-		duration := time.Since(transaction.StartTime)
-		log.Printf("[server] Expired transaction cleaned up: %s (duration: %v)", id, duration)
 	}
 }
 
+// ActiveTransactionIDs returns the IDs of the transactions still open.
+func (tm *TransactionManager) ActiveTransactionIDs() []string {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	ids := make([]string, 0, len(tm.transactions))
+	for id := range tm.transactions {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// ActiveTransactions describes the transactions still open, oldest first.
+func (tm *TransactionManager) ActiveTransactions() []TransactionInfo {
+	tm.mutex.RLock()
+	defer tm.mutex.RUnlock()
+
+	now := tm.clock.Now()
+	infos := make([]TransactionInfo, 0, len(tm.transactions))
+	for _, transaction := range tm.transactions {
+		transaction.mutex.RLock()
+		infos = append(infos, TransactionInfo{
+			ID:         transaction.ID,
+			ClientIP:   transaction.ClientIP,
+			User:       transaction.User,
+			StartTime:  transaction.StartTime,
+			LastUsed:   transaction.LastUsed,
+			Age:        now.Sub(transaction.StartTime).Round(time.Second).String(),
+			Idle:       now.Sub(transaction.LastUsed).Round(time.Second).String(),
+			Statements: transaction.Statements,
+		})
+		transaction.mutex.RUnlock()
+	}
+
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StartTime.Before(infos[j].StartTime) })
+	return infos
+}
+
 // GetStats returns statistics about active transactions.
 func (tm *TransactionManager) GetStats() map[string]interface{} {
 	tm.mutex.RLock()
@@ -208,7 +445,8 @@ func (tm *TransactionManager) GetStats() map[string]interface{} {
 		transaction.mutex.RLock()
 		txStats := map[string]interface{}{
 			"id":        id,
-			"duration":  time.Since(transaction.StartTime).String(),
+			"status":    transaction.Status.String(),
+			"duration":  tm.clock.Since(transaction.StartTime).String(),
 			"last_used": transaction.LastUsed.Format(time.RFC3339),
 		}
 		transaction.mutex.RUnlock()
@@ -219,6 +457,16 @@ func (tm *TransactionManager) GetStats() map[string]interface{} {
 	return stats
 }
 
+// SetTransactionConfig sets the idle timeout and maximum lifetime of
+// transactions and how often they are checked. Statements sent to an expired
+// transaction fail with TX_EXPIRED. Call before starting the server.
+func (h *Handler) SetTransactionConfig(config TransactionConfig) {
+	h.transactionManager.SetConfig(config)
+	config = h.transactionManager.Config()
+	log.Printf("[server] Transaction limits: idle=%s lifetime=%s cleanup=%s",
+		config.IdleTimeout, config.MaxLifetime, config.CleanupInterval)
+}
+
 // handleTransaction processes transaction control commands (BEGIN, COMMIT, ROLLBACK).
 //
 // Parameters:
@@ -234,9 +482,8 @@ func (h *Handler) handleTransaction(ch *amqp.Channel, msg amqp.Delivery, req RPC
 	case "ROLLBACK":
 		h.handleRollbackTransaction(ch, msg, req)
 	default:
-		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
-			Error: fmt.Sprintf("unsupported transaction command: %s", req.Command),
-		})
+		h.respondError(ch, msg, newTxError(TxErrInvalidCommand, req.TransactionID,
+			"unsupported transaction command: %s", req.Command))
 	}
 }
 
@@ -251,23 +498,29 @@ func (h *Handler) handleBeginTransaction(ch *amqp.Channel, msg amqp.Delivery, re
 	} else {
 		db, err = sql.Open("mysql", h.mysqlDSN)
 		if err != nil {
-			h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
-				Error: fmt.Sprintf("failed to open database connection: %v", err),
-			})
+			h.respondError(ch, msg, newTxError(TxErrBeginFailed, req.TransactionID,
+				"failed to open database connection: %v", err))
 			return
 		}
 		// Note: We don't close the connection here as it's needed for the transaction
 	}
 
 	// Start transaction
-	_, err = h.transactionManager.BeginTransaction(req.TransactionID, db)
+	transaction, err := h.transactionManager.BeginTransaction(req.TransactionID, db)
 	if err != nil {
-		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
-			Error: err.Error(),
-		})
+		h.respondError(ch, msg, err)
 		return
 	}
 
+	// Remember who began it, for GetActiveTransactions
+	transaction.mutex.Lock()
+	transaction.ClientIP = req.ClientIP
+	transaction.User = msg.UserId
+	transaction.mutex.Unlock()
+
+	// Roll it back if the client's session ends first
+	h.trackSession(msg.UserId, req, req.TransactionID, "", false)
+
 	// Send success response
 	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
 		Columns: []string{"status"},
@@ -278,10 +531,9 @@ func (h *Handler) handleBeginTransaction(ch *amqp.Channel, msg amqp.Delivery, re
 // handleCommitTransaction commits an existing transaction.
 func (h *Handler) handleCommitTransaction(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
 	err := h.transactionManager.CommitTransaction(req.TransactionID)
+	h.trackSession(msg.UserId, req, req.TransactionID, "", true)
 	if err != nil {
-		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
-			Error: err.Error(),
-		})
+		h.respondError(ch, msg, err)
 		return
 	}
 
@@ -295,10 +547,9 @@ func (h *Handler) handleCommitTransaction(ch *amqp.Channel, msg amqp.Delivery, r
 // handleRollbackTransaction rolls back an existing transaction.
 func (h *Handler) handleRollbackTransaction(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
 	err := h.transactionManager.RollbackTransaction(req.TransactionID)
+	h.trackSession(msg.UserId, req, req.TransactionID, "", true)
 	if err != nil {
-		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
-			Error: err.Error(),
-		})
+		h.respondError(ch, msg, err)
 		return
 	}
 
@@ -0,0 +1,79 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/lordbasex/burrowctl/client"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// startTransport serves the device through the client.Transport registered
+// for the scheme of the broker URL (e.g. nats://). Requests go through the
+// same worker pool and handlers as with RabbitMQ. Features built on
+// RabbitMQ objects are not available: cluster mode, device aliases,
+// handover, device events, manual ack, dead-lettering and response
+// confirms; the transport keeps its connection alive, so the heartbeat
+// queue is not consumed either.
+func (h *Handler) startTransport(ctx context.Context) error {
+	if h.cluster != nil || h.deviceAliases != nil {
+		return fmt.Errorf("cluster mode and device aliases require a RabbitMQ (amqp://) broker")
+	}
+
+	transport, err := client.OpenTransport(h.amqpURL)
+	if err != nil {
+		return err
+	}
+	h.transport = transport
+	defer transport.Close()
+
+	// Initialize database connection based on mode
+	closeDB, err := h.openDatabase()
+	if err != nil {
+		return err
+	}
+	defer closeDB()
+
+	msgs, err := transport.Consume(ctx, h.rpcQueueName)
+	if err != nil {
+		return err
+	}
+	log.Printf("[server] Listening on %s through %T", h.rpcQueueName, transport)
+
+	// Start the worker pool and background tasks
+	stop, err := h.startBackground(ctx)
+	if err != nil {
+		return err
+	}
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("[server] Shutting down server...")
+			return nil
+		case msg, ok := <-msgs:
+			if !ok {
+				return fmt.Errorf("transport consumer closed")
+			}
+			// Handlers address the requester through the delivery fields
+			h.dispatch(ctx, nil, amqp.Delivery{
+				CorrelationId: msg.CorrelationID,
+				ReplyTo:       msg.ReplyTo,
+				UserId:        msg.UserID,
+				Body:          msg.Body,
+			}, false)
+		}
+	}
+}
+
+// replyTransport sends a response through the transport
+func (h *Handler) replyTransport(replyTo string, publishing amqp.Publishing) {
+	request := client.Message{CorrelationID: publishing.CorrelationId, ReplyTo: replyTo}
+	if err := h.transport.Reply(context.Background(), request, publishing.Body); err != nil {
+		atomic.AddInt64(&h.responseStats.failed, 1)
+		log.Printf("[server] Response %s to '%s' lost: %v", publishing.CorrelationId, replyTo, err)
+	}
+}
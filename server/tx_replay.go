@@ -0,0 +1,76 @@
+package server
+
+import (
+	"log"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// txReply is the response to a numbered statement of a transaction, kept so
+// that a redelivered copy of the statement is answered without running it
+// again.
+type txReply struct {
+	sequence int64         // Sequence number of the statement
+	done     chan struct{} // Closed once resp is set
+	resp     RPCResponse   // Response sent for the first delivery
+}
+
+// claimTxStatement registers a numbered statement of a transaction before it
+// runs. Clients number the statements of a transaction 1, 2, 3...; a number
+// that is not higher than the last one seen means the broker redelivered a
+// statement that was already received. In that case duplicate is true and
+// reply is the response to that statement, or nil when the client has
+// already moved past it.
+func (h *Handler) claimTxStatement(req RPCRequest, corrID string) (reply *txReply, duplicate bool) {
+	transaction, exists := h.transactionManager.GetTransaction(req.TransactionID)
+	if !exists {
+		// The statement handler reports the missing transaction
+		return nil, false
+	}
+
+	transaction.mutex.Lock()
+	defer transaction.mutex.Unlock()
+
+	if req.Sequence <= transaction.lastSequence {
+		if transaction.lastReply != nil && transaction.lastReply.sequence == req.Sequence {
+			return transaction.lastReply, true
+		}
+		return nil, true
+	}
+
+	reply = &txReply{sequence: req.Sequence, done: make(chan struct{})}
+	transaction.lastSequence = req.Sequence
+	transaction.lastReply = reply
+	h.txReplies.Store(corrID, reply)
+	return nil, false
+}
+
+// recordTxReply keeps the response to a numbered transaction statement
+func (h *Handler) recordTxReply(corrID string, resp RPCResponse) {
+	if value, ok := h.txReplies.LoadAndDelete(corrID); ok {
+		reply := value.(*txReply)
+		reply.resp = resp
+		close(reply.done)
+	}
+}
+
+// finishTxStatement releases redeliveries waiting for a statement that ended
+// without a response
+func (h *Handler) finishTxStatement(corrID string) {
+	h.recordTxReply(corrID, RPCResponse{})
+}
+
+// replayTxStatement answers a redelivered transaction statement with the
+// response to its first delivery, waiting for it when the statement is still
+// running. Statements the client has moved past are acknowledged with an
+// empty response.
+func (h *Handler) replayTxStatement(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest, reply *txReply) {
+	log.Printf("[server] Redelivered statement %d of transaction %s not executed again", req.Sequence, req.TransactionID)
+	if reply == nil {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{})
+		return
+	}
+
+	<-reply.done
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, reply.resp)
+}
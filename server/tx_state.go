@@ -0,0 +1,150 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// TxStatus represents the lifecycle state of a server-side transaction.
+//
+// The transaction protocol is modelled as an explicit state machine:
+//
+//	            COMMIT ok            +-----------+
+//	        +--------------------->  | committed |
+//	        |                        +-----------+
+//	+--------+  ROLLBACK ok          +-------------+
+//	| active | --------------------> | rolled_back |
+//	+--------+                       +-------------+
+//	        |  idle/lifetime exceeded +---------+
+//	        +----------------------->| expired |
+//	        |                        +---------+
+//	        |  COMMIT/ROLLBACK error  +--------+
+//	        +----------------------->| failed |
+//	                                 +--------+
+//
+// Every state other than active is terminal. Any command addressed to a
+// transaction in a terminal state is rejected with a TxError whose code
+// identifies the state the transaction ended in.
+type TxStatus int
+
+const (
+	TxStatusActive TxStatus = iota
+	TxStatusCommitted
+	TxStatusRolledBack
+	TxStatusExpired
+	TxStatusFailed
+)
+
+// String returns the string representation of a transaction status.
+func (s TxStatus) String() string {
+	switch s {
+	case TxStatusActive:
+		return "active"
+	case TxStatusCommitted:
+		return "committed"
+	case TxStatusRolledBack:
+		return "rolled_back"
+	case TxStatusExpired:
+		return "expired"
+	case TxStatusFailed:
+		return "failed"
+	default:
+		return "unknown"
+	}
+}
+
+// txTransitions lists every legal state transition. Transitions that are not
+// listed here are illegal and are reported with TxErrInvalidTransition.
+var txTransitions = map[TxStatus]map[TxStatus]bool{
+	TxStatusActive: {
+		TxStatusCommitted:  true,
+		TxStatusRolledBack: true,
+		TxStatusExpired:    true,
+		TxStatusFailed:     true,
+	},
+}
+
+// CanTransition reports whether a transaction may move from s to next.
+func (s TxStatus) CanTransition(next TxStatus) bool {
+	return txTransitions[s][next]
+}
+
+// IsTerminal reports whether no further transitions are possible from s.
+func (s TxStatus) IsTerminal() bool {
+	return len(txTransitions[s]) == 0
+}
+
+// Transaction error codes. They are sent to clients in RPCResponse.ErrorCode
+// so that every illegal transition can be told apart without parsing messages.
+const (
+	TxErrNotFound          = "TX_NOT_FOUND"           // Unknown ID (never started, or server restarted mid-transaction)
+	TxErrAlreadyExists     = "TX_ALREADY_EXISTS"      // BEGIN with an ID that is already in use
+	TxErrAlreadyCommitted  = "TX_ALREADY_COMMITTED"   // Command sent after a successful COMMIT
+	TxErrAlreadyRolledBack = "TX_ALREADY_ROLLED_BACK" // Command sent after a successful ROLLBACK
+	TxErrExpired           = "TX_EXPIRED"             // Transaction was rolled back by the expiry loop
+	TxErrFailed            = "TX_FAILED"              // A previous COMMIT/ROLLBACK failed at the database
+	TxErrBeginFailed       = "TX_BEGIN_FAILED"        // The database refused to start the transaction
+	TxErrCommitFailed      = "TX_COMMIT_FAILED"       // The database returned an error on COMMIT
+	TxErrRollbackFailed    = "TX_ROLLBACK_FAILED"     // The database returned an error on ROLLBACK
+	TxErrMissingID         = "TX_MISSING_ID"          // Transaction command without a transaction ID
+	TxErrInvalidCommand    = "TX_INVALID_COMMAND"     // Unknown transaction command
+	TxErrInvalidTransition = "TX_INVALID_TRANSITION"  // Transition not allowed by the state machine
+)
+
+// TxError describes a rejected transaction operation.
+type TxError struct {
+	Code          string // One of the TxErr* codes
+	TransactionID string // Transaction the operation was addressed to
+	Message       string // Human readable description
+}
+
+// Error implements the error interface.
+func (e *TxError) Error() string {
+	return e.Message
+}
+
+// newTxError creates a TxError with a formatted message.
+func newTxError(code, transactionID, format string, args ...interface{}) *TxError {
+	return &TxError{
+		Code:          code,
+		TransactionID: transactionID,
+		Message:       fmt.Sprintf(format, args...),
+	}
+}
+
+// terminalTxError returns the error reported when a command is addressed to
+// a transaction that already reached the given terminal state.
+func terminalTxError(transactionID string, status TxStatus) *TxError {
+	switch status {
+	case TxStatusCommitted:
+		return newTxError(TxErrAlreadyCommitted, transactionID, "transaction %s already committed", transactionID)
+	case TxStatusRolledBack:
+		return newTxError(TxErrAlreadyRolledBack, transactionID, "transaction %s already rolled back", transactionID)
+	case TxStatusExpired:
+		return newTxError(TxErrExpired, transactionID, "transaction %s expired and was rolled back", transactionID)
+	case TxStatusFailed:
+		return newTxError(TxErrFailed, transactionID, "transaction %s failed and can no longer be used", transactionID)
+	default:
+		return newTxError(TxErrInvalidTransition, transactionID, "transaction %s is %s", transactionID, status)
+	}
+}
+
+// finishedTransaction remembers how a transaction ended so that late commands
+// can be answered with a precise error instead of a generic "not found".
+type finishedTransaction struct {
+	Status     TxStatus  // Terminal state the transaction ended in
+	FinishedAt time.Time // When the transaction reached that state
+	Reason     string    // Why the transaction expired (expired transactions only)
+}
+
+// txError returns the error reported for commands sent after the transaction
+// ended; expired transactions name the limit they exceeded.
+func (f finishedTransaction) txError(transactionID string) *TxError {
+	if f.Status == TxStatusExpired && f.Reason != "" {
+		return newTxError(TxErrExpired, transactionID, "transaction %s expired (%s) and was rolled back", transactionID, f.Reason)
+	}
+	return terminalTxError(transactionID, f.Status)
+}
+
+// finishedTransactionRetention is how long terminal states are remembered.
+const finishedTransactionRetention = 30 * time.Minute
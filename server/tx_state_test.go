@@ -0,0 +1,435 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lordbasex/burrowctl/clock/clocktest"
+)
+
+var allTxStatuses = []TxStatus{
+	TxStatusActive,
+	TxStatusCommitted,
+	TxStatusRolledBack,
+	TxStatusExpired,
+	TxStatusFailed,
+}
+
+func TestTxStatusTransitions(t *testing.T) {
+	valid := map[TxStatus]map[TxStatus]bool{
+		TxStatusActive: {
+			TxStatusCommitted:  true,
+			TxStatusRolledBack: true,
+			TxStatusExpired:    true,
+			TxStatusFailed:     true,
+		},
+	}
+
+	for _, from := range allTxStatuses {
+		for _, to := range allTxStatuses {
+			want := valid[from][to]
+			if got := from.CanTransition(to); got != want {
+				t.Errorf("%s -> %s: CanTransition = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestTxStatusIsTerminal(t *testing.T) {
+	tests := []struct {
+		status   TxStatus
+		name     string
+		terminal bool
+	}{
+		{TxStatusActive, "active", false},
+		{TxStatusCommitted, "committed", true},
+		{TxStatusRolledBack, "rolled_back", true},
+		{TxStatusExpired, "expired", true},
+		{TxStatusFailed, "failed", true},
+		{TxStatus(99), "unknown", true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.status.String(); got != tt.name {
+			t.Errorf("String() = %q, want %q", got, tt.name)
+		}
+		if got := tt.status.IsTerminal(); got != tt.terminal {
+			t.Errorf("%s: IsTerminal = %v, want %v", tt.name, got, tt.terminal)
+		}
+	}
+}
+
+func TestTransactionTransition(t *testing.T) {
+	tests := []struct {
+		from     TxStatus
+		to       TxStatus
+		wantCode string // "" when the transition is allowed
+	}{
+		{TxStatusActive, TxStatusCommitted, ""},
+		{TxStatusActive, TxStatusRolledBack, ""},
+		{TxStatusActive, TxStatusExpired, ""},
+		{TxStatusActive, TxStatusFailed, ""},
+		{TxStatusActive, TxStatusActive, TxErrInvalidTransition},
+		{TxStatusCommitted, TxStatusRolledBack, TxErrAlreadyCommitted},
+		{TxStatusCommitted, TxStatusCommitted, TxErrAlreadyCommitted},
+		{TxStatusRolledBack, TxStatusCommitted, TxErrAlreadyRolledBack},
+		{TxStatusRolledBack, TxStatusRolledBack, TxErrAlreadyRolledBack},
+		{TxStatusExpired, TxStatusCommitted, TxErrExpired},
+		{TxStatusExpired, TxStatusRolledBack, TxErrExpired},
+		{TxStatusFailed, TxStatusCommitted, TxErrFailed},
+		{TxStatusFailed, TxStatusActive, TxErrFailed},
+	}
+
+	for _, tt := range tests {
+		tx := &Transaction{ID: "tx1", Status: tt.from}
+		err := tx.transition(tt.to)
+
+		if tt.wantCode == "" {
+			if err != nil {
+				t.Errorf("%s -> %s: unexpected error %v", tt.from, tt.to, err)
+			}
+			if tx.Status != tt.to {
+				t.Errorf("%s -> %s: status is %s", tt.from, tt.to, tx.Status)
+			}
+			continue
+		}
+
+		assertTxErrorCode(t, err, tt.wantCode)
+		if tx.Status != tt.from {
+			t.Errorf("%s -> %s: rejected transition changed status to %s", tt.from, tt.to, tx.Status)
+		}
+	}
+}
+
+func TestTerminalTxError(t *testing.T) {
+	tests := []struct {
+		status TxStatus
+		code   string
+	}{
+		{TxStatusCommitted, TxErrAlreadyCommitted},
+		{TxStatusRolledBack, TxErrAlreadyRolledBack},
+		{TxStatusExpired, TxErrExpired},
+		{TxStatusFailed, TxErrFailed},
+		{TxStatusActive, TxErrInvalidTransition},
+	}
+
+	for _, tt := range tests {
+		err := terminalTxError("tx1", tt.status)
+		if err.Code != tt.code {
+			t.Errorf("%s: code = %s, want %s", tt.status, err.Code, tt.code)
+		}
+		if err.TransactionID != "tx1" {
+			t.Errorf("%s: transaction ID = %q", tt.status, err.TransactionID)
+		}
+	}
+}
+
+func TestFinishedTransactionTxError(t *testing.T) {
+	tests := []struct {
+		name     string
+		finished finishedTransaction
+		code     string
+		contains string
+	}{
+		{"committed", finishedTransaction{Status: TxStatusCommitted}, TxErrAlreadyCommitted, "already committed"},
+		{"rolled back", finishedTransaction{Status: TxStatusRolledBack}, TxErrAlreadyRolledBack, "already rolled back"},
+		{"failed", finishedTransaction{Status: TxStatusFailed}, TxErrFailed, "can no longer be used"},
+		{"expired", finishedTransaction{Status: TxStatusExpired}, TxErrExpired, "expired and was rolled back"},
+		{"expired with reason", finishedTransaction{Status: TxStatusExpired, Reason: "idle longer than 1m0s"}, TxErrExpired, "expired (idle longer than 1m0s)"},
+	}
+
+	for _, tt := range tests {
+		err := tt.finished.txError("tx1")
+		if err.Code != tt.code {
+			t.Errorf("%s: code = %s, want %s", tt.name, err.Code, tt.code)
+		}
+		if !strings.Contains(err.Message, tt.contains) {
+			t.Errorf("%s: message %q does not contain %q", tt.name, err.Message, tt.contains)
+		}
+	}
+}
+
+func TestTransactionManagerErrors(t *testing.T) {
+	commit := func(tm *TransactionManager, id string) error { return tm.CommitTransaction(id) }
+	rollback := func(tm *TransactionManager, id string) error { return tm.RollbackTransaction(id) }
+	lookup := func(tm *TransactionManager, id string) error {
+		_, err := tm.LookupTransaction(id)
+		return err
+	}
+
+	tests := []struct {
+		name  string
+		setup func(tm *TransactionManager, clock *clocktest.Fake, db *sql.DB, drv *fakeTxDriver)
+		op    func(tm *TransactionManager, id string) error
+		code  string // "" when the operation succeeds
+	}{
+		{
+			name: "commit unknown",
+			op:   commit,
+			code: TxErrNotFound,
+		},
+		{
+			name: "rollback unknown",
+			op:   rollback,
+			code: TxErrNotFound,
+		},
+		{
+			name: "lookup unknown",
+			op:   lookup,
+			code: TxErrNotFound,
+		},
+		{
+			name:  "commit active",
+			setup: begin,
+			op:    commit,
+		},
+		{
+			name:  "rollback active",
+			setup: begin,
+			op:    rollback,
+		},
+		{
+			name:  "lookup active",
+			setup: begin,
+			op:    lookup,
+		},
+		{
+			name:  "commit after commit",
+			setup: then(begin, finishWith(commit)),
+			op:    commit,
+			code:  TxErrAlreadyCommitted,
+		},
+		{
+			name:  "rollback after commit",
+			setup: then(begin, finishWith(commit)),
+			op:    rollback,
+			code:  TxErrAlreadyCommitted,
+		},
+		{
+			name:  "lookup after rollback",
+			setup: then(begin, finishWith(rollback)),
+			op:    lookup,
+			code:  TxErrAlreadyRolledBack,
+		},
+		{
+			name:  "commit after rollback",
+			setup: then(begin, finishWith(rollback)),
+			op:    commit,
+			code:  TxErrAlreadyRolledBack,
+		},
+		{
+			name: "commit fails at the database",
+			setup: then(begin, func(_ *TransactionManager, _ *clocktest.Fake, _ *sql.DB, drv *fakeTxDriver) {
+				drv.setCommitErr(errors.New("deadlock"))
+			}),
+			op:   commit,
+			code: TxErrCommitFailed,
+		},
+		{
+			name: "commit after failed commit",
+			setup: then(begin, func(tm *TransactionManager, _ *clocktest.Fake, _ *sql.DB, drv *fakeTxDriver) {
+				drv.setCommitErr(errors.New("deadlock"))
+				tm.CommitTransaction("tx1")
+			}),
+			op:   commit,
+			code: TxErrFailed,
+		},
+		{
+			name: "rollback fails at the database",
+			setup: then(begin, func(_ *TransactionManager, _ *clocktest.Fake, _ *sql.DB, drv *fakeTxDriver) {
+				drv.setRollbackErr(errors.New("connection lost"))
+			}),
+			op:   rollback,
+			code: TxErrRollbackFailed,
+		},
+		{
+			name: "commit past idle timeout",
+			setup: then(begin, func(_ *TransactionManager, clock *clocktest.Fake, _ *sql.DB, _ *fakeTxDriver) {
+				clock.Advance(DefaultTransactionConfig().IdleTimeout + time.Second)
+			}),
+			op:   commit,
+			code: TxErrExpired,
+		},
+		{
+			name: "lookup after expiry loop",
+			setup: then(begin, func(tm *TransactionManager, clock *clocktest.Fake, _ *sql.DB, _ *fakeTxDriver) {
+				clock.Advance(DefaultTransactionConfig().IdleTimeout + time.Second)
+				tm.ExpireTransactions()
+			}),
+			op:   lookup,
+			code: TxErrExpired,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tm, clock, db, drv := newTestTransactionManager(t)
+			if tt.setup != nil {
+				tt.setup(tm, clock, db, drv)
+			}
+
+			err := tt.op(tm, "tx1")
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("unexpected error %v", err)
+				}
+				return
+			}
+			assertTxErrorCode(t, err, tt.code)
+		})
+	}
+}
+
+func TestBeginTransactionErrors(t *testing.T) {
+	tm, _, db, drv := newTestTransactionManager(t)
+
+	_, err := tm.BeginTransaction("", db)
+	assertTxErrorCode(t, err, TxErrMissingID)
+
+	if _, err := tm.BeginTransaction("tx1", db); err != nil {
+		t.Fatalf("BEGIN failed: %v", err)
+	}
+	_, err = tm.BeginTransaction("tx1", db)
+	assertTxErrorCode(t, err, TxErrAlreadyExists)
+
+	// An ID stays reserved after its transaction finished
+	if err := tm.CommitTransaction("tx1"); err != nil {
+		t.Fatalf("COMMIT failed: %v", err)
+	}
+	_, err = tm.BeginTransaction("tx1", db)
+	assertTxErrorCode(t, err, TxErrAlreadyExists)
+
+	drv.setBeginErr(errors.New("too many connections"))
+	_, err = tm.BeginTransaction("tx2", db)
+	assertTxErrorCode(t, err, TxErrBeginFailed)
+}
+
+func begin(tm *TransactionManager, _ *clocktest.Fake, db *sql.DB, _ *fakeTxDriver) {
+	if _, err := tm.BeginTransaction("tx1", db); err != nil {
+		panic(err)
+	}
+}
+
+func finishWith(op func(tm *TransactionManager, id string) error) func(*TransactionManager, *clocktest.Fake, *sql.DB, *fakeTxDriver) {
+	return func(tm *TransactionManager, _ *clocktest.Fake, _ *sql.DB, _ *fakeTxDriver) {
+		if err := op(tm, "tx1"); err != nil {
+			panic(err)
+		}
+	}
+}
+
+func then(steps ...func(*TransactionManager, *clocktest.Fake, *sql.DB, *fakeTxDriver)) func(*TransactionManager, *clocktest.Fake, *sql.DB, *fakeTxDriver) {
+	return func(tm *TransactionManager, clock *clocktest.Fake, db *sql.DB, drv *fakeTxDriver) {
+		for _, step := range steps {
+			step(tm, clock, db, drv)
+		}
+	}
+}
+
+func assertTxErrorCode(t *testing.T, err error, code string) {
+	t.Helper()
+
+	var txErr *TxError
+	if !errors.As(err, &txErr) {
+		t.Fatalf("expected a *TxError with code %s, got %v", code, err)
+	}
+	if txErr.Code != code {
+		t.Fatalf("code = %s, want %s (%s)", txErr.Code, code, txErr.Message)
+	}
+}
+
+// newTestTransactionManager returns a transaction manager on a fake clock and
+// a database whose transactions are handled by a fakeTxDriver
+func newTestTransactionManager(t *testing.T) (*TransactionManager, *clocktest.Fake, *sql.DB, *fakeTxDriver) {
+	t.Helper()
+
+	clock := clocktest.NewFake(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	tm := NewTransactionManager()
+	tm.SetClock(clock)
+
+	drv := &fakeTxDriver{}
+	db := sql.OpenDB(drv)
+	t.Cleanup(func() { db.Close() })
+	return tm, clock, db, drv
+}
+
+// fakeTxDriver is a database/sql driver whose connections only begin, commit
+// and roll back transactions and execute statements, failing with the
+// configured errors
+type fakeTxDriver struct {
+	mutex       sync.Mutex
+	beginErr    error
+	commitErr   error
+	rollbackErr error
+	failExec    string // Statements containing this text fail
+}
+
+func (d *fakeTxDriver) setBeginErr(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.beginErr = err
+}
+
+func (d *fakeTxDriver) setCommitErr(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.commitErr = err
+}
+
+func (d *fakeTxDriver) setRollbackErr(err error) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.rollbackErr = err
+}
+
+func (d *fakeTxDriver) Open(string) (driver.Conn, error) { return &fakeTxConn{driver: d}, nil }
+
+// Connect and Driver make the driver its own driver.Connector for sql.OpenDB
+func (d *fakeTxDriver) Connect(context.Context) (driver.Conn, error) { return d.Open("") }
+func (d *fakeTxDriver) Driver() driver.Driver                        { return d }
+
+type fakeTxConn struct{ driver *fakeTxDriver }
+
+func (c *fakeTxConn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("fake driver: statements are not supported")
+}
+
+func (c *fakeTxConn) Close() error { return nil }
+
+func (c *fakeTxConn) ExecContext(_ context.Context, query string, _ []driver.NamedValue) (driver.Result, error) {
+	c.driver.mutex.Lock()
+	defer c.driver.mutex.Unlock()
+	if c.driver.failExec != "" && strings.Contains(query, c.driver.failExec) {
+		return nil, errors.New("fake driver: statement failed")
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *fakeTxConn) Begin() (driver.Tx, error) {
+	c.driver.mutex.Lock()
+	defer c.driver.mutex.Unlock()
+	if c.driver.beginErr != nil {
+		return nil, c.driver.beginErr
+	}
+	return &fakeTx{driver: c.driver}, nil
+}
+
+type fakeTx struct{ driver *fakeTxDriver }
+
+func (tx *fakeTx) Commit() error {
+	tx.driver.mutex.Lock()
+	defer tx.driver.mutex.Unlock()
+	return tx.driver.commitErr
+}
+
+func (tx *fakeTx) Rollback() error {
+	tx.driver.mutex.Lock()
+	defer tx.driver.mutex.Unlock()
+	return tx.driver.rollbackErr
+}
@@ -4,8 +4,11 @@ package server
 
 import (
 	"database/sql"
+	"sync"
 	"time"
 
+	"github.com/lordbasex/burrowctl/client"
+	"github.com/lordbasex/burrowctl/clock"
 	amqp "github.com/rabbitmq/amqp091-go"
 )
 
@@ -38,16 +41,124 @@ type Handler struct {
 	functionRegistry   map[string]interface{} // Registry of custom functions available for execution
 	workerPool         *WorkerPool            // Worker pool for concurrent message processing
 	rateLimiter        *RateLimiter           // Rate limiter for controlling request frequency per client
+	queryLimiter       *QueryLimiter          // Bounds the SQL statements running at the same time
+	resources          *ResourceMonitor       // Samples memory and CPU use to shed load above thresholds
 	transactionManager *TransactionManager    // Transaction manager for handling database transactions
 	queryCache         *QueryCache            // Query cache for improving performance of repeated queries
 	sqlValidator       *SQLValidator          // SQL validator for security and policy enforcement
+	approvals          *ApprovalQueue         // Requests held until an operator approves them
+	slowQueryLog       *SlowQueryLog          // Slow query log with optional EXPLAIN capture
+	queryStats         *QueryStats            // Execution statistics per query fingerprint
+	priorityConfig     PriorityConfig         // Mapping of request priorities onto database controls (guarded by liveConfigMutex)
+	progressConfig     ProgressConfig         // Interim queue position and progress notifications (guarded by liveConfigMutex)
+	liveConfigMutex    sync.RWMutex           // Guards the plain config fields a config file reload replaces
+	impersonation      ImpersonationConfig    // Policy for requests run on behalf of end users
+	accessControl      AccessControlConfig    // Roles granting request types to client identities
+	tokenAuth          *TokenAuthenticator    // Validation of client JWTs (nil when not configured)
+	ipFilter           *IPFilter              // Client IP allow and deny lists (nil when not configured)
+	sessionSettings    *SessionSettingsStore  // Per-client settings applied to every request of a session
+	sessions           *SessionRegistry       // Transactions and statements of client sessions, released when the client is gone
+	protocolStats      *protocolStats         // Requests per client wire protocol version
+	dialect            dialectDetector        // Lazily detected database flavour (MySQL or MariaDB)
+	maintenance        *MaintenanceManager    // Scheduled and remotely triggered housekeeping (nil when not configured)
+	retention          *RetentionManager      // Incremental pruning of old rows (nil when not configured)
+	scheduler          *Scheduler             // Recurring cron tasks (nil when not configured)
+	cdc                *CDCManager            // Row-change capture published as events (nil when not configured)
+
+	// Uptime reported by getSystemStatus
+	startTime time.Time // When the handler was created
+
+	// Function discovery and execution statistics
+	functionMetadata map[string]FunctionMetadata // Descriptions and parameter docs by function name
+	functionStats    *functionStatsRegistry      // Call, panic and timeout counters by function name
+	jobs             *JobManager                 // Asynchronous functions and commands submitted as jobs
+	exports          *ExportManager              // Cursors of CSV/NDJSON exports in progress
+	cursors          *CursorManager              // Result sets of paginated queries
+
+	// File transfer
+	fileTransfer *FileTransferManager // Serves file.get and file.put requests (nil when disabled)
+
+	// Table statistics
+	tableStats *TableStatsCollector // Periodic table sizes and growth rates (nil when disabled)
+
+	// Bulk inserts
+	allowedPacket int64 // Cached max_allowed_packet of the database (atomic)
+
+	// Index suggestions
+	indexAdvisor *IndexAdvisor // Samples slow queries and suggests indexes (nil when disabled)
+
+	// Log tailing
+	logTail *LogTailManager // Serves log.tail requests (nil when disabled)
 
 	// Heartbeat management
 	heartbeatManager *ServerHeartbeatManager // Heartbeat manager for connection monitoring
 
+	// Audit logging
+	auditLogger       AuditLogger // Receives a record for every processed request (nil when disabled)
+	auditRedactParams bool        // Replace parameter values in audit records
+	auditInFlight     sync.Map    // Correlation ID -> *AuditRecord for requests being processed
+
+	// Rate limit budgets of requests being processed, sent with their responses
+	rateLimitInFlight sync.Map // Correlation ID -> RateLimitInfo
+
+	// Log redaction
+	redactQueryLogs bool // Mask the literal values of logged queries
+
+	// Shared persistence
+	storage Storage // Key-value store used by audit, scheduler and custom functions (nil when not configured)
+
+	// Active/active operation
+	cluster *ClusterManager // Coordinates with other instances on the same device queue (nil when disabled)
+
+	// Time source
+	clock clock.Clock // Replaces the system clock in timing logic (nil: clock.Real)
+
+	// Prepared statements
+	preparedStatements *PreparedStatementRegistry // Statements clients prepared on the pool, by handle
+
+	// Transaction replay protection
+	txReplies sync.Map // Correlation ID -> *txReply for numbered transaction statements being processed
+
+	// Request acknowledgement
+	ackConfig        AckConfig      // When requests are acknowledged and how redeliveries are handled
+	deliveries       sync.Map       // Correlation ID -> storage key of a write request being processed
+	deliveryFallback *MemoryStorage // Keeps processed deliveries when no storage is configured
+
+	// Replay protection
+	replayProtection ReplayProtectionConfig // Nonce and timestamp checks of requests
+	nonceMutex       sync.Mutex             // Serializes nonce lookups
+
+	// Non-RabbitMQ brokers
+	transport client.Transport // Transport requests arrive on when the broker URL is not amqp:// (nil otherwise)
+
+	// Response delivery
+	responseConfirms ResponseConfirmConfig // Publisher confirms and retries for responses
+	responseStats    responseStats         // Outcome counters of published responses
+	responseLimits   ResponseLimitConfig   // Caps the rows and bytes of SQL, function and command results
+
+	// Device renames
+	deviceAliases *DeviceAliases // Old device IDs still answered during a rename (nil when none)
+
+	// Rolling upgrades
+	handover HandoverConfig // Queue handover between an old and a new instance
+
+	// Live troubleshooting
+	debugConfig DebugConfig // HTTP listener serving /debug/state and /debug/pprof (disabled without an address)
+
 	// Queue management
-	rpcQueueName       string // RPC queue name for this device
-	heartbeatQueueName string // Heartbeat queue name for this device
+	queueConfig        QueueConfig // Durability and arguments of the device queues
+	namespace          string      // Prefix applied to every queue and exchange name
+	rpcQueueName       string      // RPC queue name for this device
+	heartbeatQueueName string      // Heartbeat queue name for this device
+	eventsExchangeName string      // Exchange for device events
+
+	// Telemetry
+	telemetry             *TelemetryReporter // Periodic host telemetry (nil when disabled)
+	telemetryExchangeName string             // Exchange shared by the namespace's devices for telemetry
+
+	// Event publishing
+	eventsChannel *amqp.Channel // Channel events are published on (nil while stopped)
+	eventsMutex   sync.Mutex    // Serializes publishes on eventsChannel
 }
 
 // FunctionParam represents a single parameter for function execution.
@@ -67,19 +178,63 @@ type FunctionRequest struct {
 // RPCRequest represents an incoming request from a client.
 // It contains all necessary information to process SQL queries, function calls, or system commands.
 type RPCRequest struct {
-	Type          string        `json:"type"`          // Request type: "sql", "function", "command", or "transaction"
-	DeviceID      string        `json:"deviceID"`      // Target device ID for request routing
-	Query         string        `json:"query"`         // SQL query, function JSON, or system command
-	Params        []interface{} `json:"params"`        // Parameters for SQL queries (empty for functions/commands)
-	ClientIP      string        `json:"clientIP"`      // Client IP address for logging and security
-	TransactionID string        `json:"transactionID"` // Transaction ID for transaction-aware operations
-	Command       string        `json:"command"`       // Transaction command (BEGIN, COMMIT, ROLLBACK)
+	Type            string          `json:"type"`            // Request type: "sql", "function", "command", "transaction" or "session"
+	DeviceID        string          `json:"deviceID"`        // Target device ID for request routing
+	Query           string          `json:"query"`           // SQL query, function JSON, or system command
+	Params          []interface{}   `json:"params"`          // Parameters for SQL queries (empty for functions/commands)
+	ClientIP        string          `json:"clientIP"`        // Client IP address for logging and security
+	TransactionID   string          `json:"transactionID"`   // Transaction ID for transaction-aware operations
+	Sequence        int64           `json:"sequence"`        // Number of the statement within its transaction (0 = unnumbered)
+	StatementID     string          `json:"statementID"`     // Handle of a prepared statement to execute instead of Query
+	Exec            bool            `json:"exec"`            // Run the SQL with Exec semantics and return affected rows
+	Batch           [][]interface{} `json:"batch"`           // Parameter sets run in one round trip (implies Exec)
+	Command         string          `json:"command"`         // Transaction command (BEGIN, COMMIT, ROLLBACK)
+	Priority        string          `json:"priority"`        // Request priority: "high", "normal" (default) or "low"
+	OnBehalfOf      string          `json:"onBehalfOf"`      // End user the request runs for (checked against the impersonation policy)
+	Token           string          `json:"token,omitempty"` // JWT authenticating the client (checked when token authentication is configured)
+	Nonce           string          `json:"nonce"`           // Random single-use request ID (replay protection)
+	Timestamp       int64           `json:"timestamp"`       // When the client sent the request, in Unix milliseconds (replay protection)
+	Signature       string          `json:"signature"`       // HMAC-SHA256 of the request with the shared signing key (replay protection)
+	SessionID       string          `json:"sessionID"`       // Client session whose settings apply to the request
+	RowLimit        int             `json:"rowLimit"`        // Maximum rows returned for SQL queries (0 = unlimited)
+	ProtocolVersion int             `json:"protocolVersion"` // Wire protocol version of the client (0 = version 1)
+	Tag             string          `json:"tag"`             // Free-form client label (job or trace ID) repeated in logs and audit records
+	ColumnTypes     bool            `json:"columnTypes"`     // Describe the columns of SQL results and send binary values base64-encoded
+	Progress        bool            `json:"progress"`        // Send queue position and progress notifications before the response
+	Capabilities    []string        `json:"capabilities"`    // Optional response features the client understands (e.g. "columnar")
 }
 
 // RPCResponse represents the response sent back to clients.
 // It follows a consistent format regardless of the request type.
 type RPCResponse struct {
-	Columns []string        `json:"columns"` // Column names for tabular data
-	Rows    [][]interface{} `json:"rows"`    // Data rows (each row is an array of values)
-	Error   string          `json:"error"`   // Error message if operation failed (empty on success)
+	Columns   []string        `json:"columns"`             // Column names for tabular data
+	Rows      [][]interface{} `json:"rows"`                // Data rows (each row is an array of values)
+	Error     string          `json:"error"`               // Error message if operation failed (empty on success)
+	ErrorCode string          `json:"errorCode,omitempty"` // Machine-readable error code (e.g. TX_NOT_FOUND)
+	Cache     *CacheInfo      `json:"cache,omitempty"`     // Query cache metadata for cacheable SQL results
+	Instance  string          `json:"instance,omitempty"`  // Server instance that handled the request (cluster mode)
+
+	Validation *ValidationDetails `json:"validation,omitempty"` // Why SQL validation blocked the query (ErrorCode VALIDATION_FAILED)
+	Result     *ExecResult        `json:"result,omitempty"`     // Affected rows and last insert ID of Exec requests
+
+	Truncated bool  `json:"truncated,omitempty"` // Rows were cut to the server's response limits
+	TotalRows int64 `json:"totalRows,omitempty"` // Rows the result had before truncation (a lower bound if counting hit the query timeout)
+
+	ColumnTypes []ColumnType `json:"columnTypes,omitempty"` // Column descriptors of SQL results (requests with ColumnTypes only)
+
+	Cursor *CursorInfo `json:"cursor,omitempty"` // Page of a paginated result ("cursor" requests)
+
+	RateLimit *RateLimitInfo `json:"rateLimit,omitempty"` // Client's rate limit budget after the request
+
+	Overload *OverloadInfo `json:"overload,omitempty"` // Why the request was shed (ErrorCode OVERLOADED)
+
+	Columnar *ColumnarRows `json:"columnar,omitempty"` // Rows in column-major layout, replacing Rows (capability "columnar")
+}
+
+// CacheInfo describes how a SQL result relates to the server's query cache,
+// so HTTP gateways and other intermediaries can derive their own caching.
+type CacheInfo struct {
+	Hit   bool  `json:"hit"`   // Served from the cache
+	AgeMs int64 `json:"ageMs"` // Time since the result was produced
+	TTLMs int64 `json:"ttlMs"` // Time until the cached result expires
 }
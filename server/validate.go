@@ -0,0 +1,54 @@
+package server
+
+import (
+	"encoding/json"
+
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+// handleValidate runs the statements of a "validate" request through SQL
+// validation without executing them, so query sets can be linted against
+// the device's policy. The query is split like a script; params apply to a
+// single statement only. Each statement gets a row with its validation
+// result, errors and warnings encoded as JSON arrays; the statistics are not
+// updated.
+func (h *Handler) handleValidate(ch *amqp.Channel, msg amqp.Delivery, req RPCRequest) {
+	statements := splitScript(req.Query)
+	if len(statements) == 0 {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "no statements to validate"})
+		return
+	}
+	if len(statements) > 1 && len(req.Params) > 0 {
+		h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{Error: "parameters can only be validated with a single statement"})
+		return
+	}
+
+	rows := make([][]interface{}, 0, len(statements))
+	for _, statement := range statements {
+		result := h.sqlValidator.LintQuery(statement, req.Params)
+		errors, _ := json.Marshal(nonNil(result.Errors))
+		warnings, _ := json.Marshal(nonNil(result.Warnings))
+		rows = append(rows, []interface{}{
+			statement,
+			result.Valid,
+			result.DetectedCommand,
+			result.Risk.String(),
+			string(errors),
+			string(warnings),
+			result.RewrittenQuery,
+		})
+	}
+
+	h.respond(ch, msg.ReplyTo, msg.CorrelationId, RPCResponse{
+		Columns: []string{"statement", "valid", "detected_command", "risk", "errors", "warnings", "rewritten_query"},
+		Rows:    rows,
+	})
+}
+
+// nonNil returns s, or an empty slice if it is nil, so it encodes as []
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
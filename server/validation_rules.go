@@ -0,0 +1,172 @@
+package server
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+)
+
+// ValidationRule is a site-specific SQL validation rule registered in Go. A
+// non-nil error blocks the query, with the error as the violated rule.
+type ValidationRule func(query string, params []interface{}) error
+
+// Actions of a ValidationPattern
+const (
+	PatternDeny    = "deny"    // Block queries matching the pattern
+	PatternRequire = "require" // Block queries not matching the pattern
+)
+
+// ValidationPattern is a regular expression rule set in the configuration.
+//
+// Example, for queries that must be scoped to a tenant:
+//
+//	{"name": "tenant-scope", "pattern": "(?i)\\btenant_id\\s*(=|IN\\b)", "action": "require",
+//	 "commands": ["SELECT", "UPDATE", "DELETE"], "message": "queries must filter on tenant_id"}
+type ValidationPattern struct {
+	Name     string   `json:"name"`               // Rule name reported in validation errors
+	Pattern  string   `json:"pattern"`            // Regular expression (RE2 syntax) matched against the query
+	Action   string   `json:"action,omitempty"`   // "deny" (default) or "require"
+	Commands []string `json:"commands,omitempty"` // SQL commands the rule applies to (empty: all)
+	Message  string   `json:"message,omitempty"`  // Error reported when the rule blocks a query
+}
+
+// namedRule is a registered ValidationRule
+type namedRule struct {
+	name string
+	rule ValidationRule
+}
+
+// compiledPattern is a ValidationPattern ready to match
+type compiledPattern struct {
+	ValidationPattern
+	regex *regexp.Regexp
+}
+
+// ValidateValidationPatterns checks the patterns of a configuration
+func ValidateValidationPatterns(patterns []ValidationPattern) error {
+	for i, pattern := range patterns {
+		if pattern.Name == "" {
+			return fmt.Errorf("validation rule %d: name is required", i)
+		}
+		if _, err := regexp.Compile(pattern.Pattern); err != nil {
+			return fmt.Errorf("validation rule %s: invalid pattern: %w", pattern.Name, err)
+		}
+		switch pattern.Action {
+		case "", PatternDeny, PatternRequire:
+		default:
+			return fmt.Errorf("validation rule %s: invalid action '%s': must be %s or %s", pattern.Name, pattern.Action, PatternDeny, PatternRequire)
+		}
+	}
+	return nil
+}
+
+// compilePatterns compiles the configured validation patterns; invalid
+// ones are logged and skipped
+func compilePatterns(patterns []ValidationPattern) []compiledPattern {
+	var compiled []compiledPattern
+	for _, pattern := range patterns {
+		regex, err := regexp.Compile(pattern.Pattern)
+		if err != nil {
+			log.Printf("[server] Validation rule %s skipped: invalid pattern: %v", pattern.Name, err)
+			continue
+		}
+		compiled = append(compiled, compiledPattern{ValidationPattern: pattern, regex: regex})
+	}
+	return compiled
+}
+
+// violation returns the error of a pattern for query, or "" if the query
+// passes it
+func (p compiledPattern) violation(query, command string) string {
+	if len(p.Commands) > 0 && !containsFold(p.Commands, command) {
+		return ""
+	}
+	matched := p.regex.MatchString(query)
+	if p.Action == PatternRequire {
+		if matched {
+			return ""
+		}
+	} else if !matched {
+		return ""
+	}
+
+	if p.Message != "" {
+		return fmt.Sprintf("Rule '%s': %s", p.Name, p.Message)
+	}
+	if p.Action == PatternRequire {
+		return fmt.Sprintf("Rule '%s': query does not match the required pattern", p.Name)
+	}
+	return fmt.Sprintf("Rule '%s': query matches a denied pattern", p.Name)
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// RegisterRule adds a custom validation rule, run on every query after the
+// built-in checks. Registering a name again replaces the rule.
+func (v *SQLValidator) RegisterRule(name string, rule ValidationRule) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	for i, registered := range v.rules {
+		if registered.name == name {
+			v.rules[i].rule = rule
+			return
+		}
+	}
+	v.rules = append(v.rules, namedRule{name: name, rule: rule})
+	log.Printf("[server] SQL validation rule registered: %s", name)
+}
+
+// customViolations runs the configured patterns and the registered rules
+// against a query (must be called with v.mutex held)
+func (v *SQLValidator) customViolations(query, command string, params []interface{}) []string {
+	var violations []string
+	for _, pattern := range v.patterns {
+		if violation := pattern.violation(query, command); violation != "" {
+			violations = append(violations, violation)
+		}
+	}
+	for _, registered := range v.rules {
+		if err := runRule(registered, query, params); err != nil {
+			violations = append(violations, fmt.Sprintf("Rule '%s': %v", registered.name, err))
+		}
+	}
+	return violations
+}
+
+// runRule runs a registered rule, turning a panic into a violation so a
+// faulty rule blocks the query instead of crashing the server
+func runRule(registered namedRule, query string, params []interface{}) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("[server] SQL validation rule %s panicked: %v", registered.name, r)
+			err = fmt.Errorf("rule failed")
+		}
+	}()
+	return registered.rule(query, params)
+}
+
+// RegisterValidationRule adds a custom SQL validation rule, for site
+// policies the configuration cannot express. Rules run on every validated
+// query, after the built-in checks, and survive configuration reloads.
+//
+// Example:
+//
+//	handler.RegisterValidationRule("no-select-star", func(query string, params []interface{}) error {
+//		if strings.Contains(strings.ToUpper(query), "SELECT *") {
+//			return errors.New("list the columns instead of SELECT *")
+//		}
+//		return nil
+//	})
+func (h *Handler) RegisterValidationRule(name string, rule ValidationRule) {
+	h.sqlValidator.RegisterRule(name, rule)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	amqp "github.com/rabbitmq/amqp091-go"
@@ -22,23 +23,37 @@ import (
 // - Worker lifecycle management and monitoring
 // - Backpressure handling when queue is full
 type WorkerPool struct {
-	workerCount int                      // Number of worker goroutines
-	queue       chan MessageTask         // Channel for queuing incoming messages
-	handler     *Handler                 // Reference to the main handler
-	ctx         context.Context          // Context for shutdown coordination
-	cancel      context.CancelFunc       // Cancel function for shutdown
-	wg          sync.WaitGroup           // WaitGroup for graceful shutdown
-	started     bool                     // Whether the pool has been started
-	mutex       sync.RWMutex             // Mutex for thread-safe operations
+	workerCount int                // Number of worker goroutines
+	queue       chan MessageTask   // Channel for queuing incoming messages
+	handler     *Handler           // Reference to the main handler
+	ctx         context.Context    // Context for shutdown coordination
+	cancel      context.CancelFunc // Cancel function for shutdown
+	wg          sync.WaitGroup     // WaitGroup for graceful shutdown
+	started     bool               // Whether the pool has been started
+	mutex       sync.RWMutex       // Mutex for thread-safe operations
+	panics      int64              // Panics recovered while processing messages (atomic)
+	active      int64              // Tasks being processed (atomic)
+	submitted   int64              // Tasks queued since the pool was created (atomic)
+	taken       int64              // Tasks workers took from the queue (atomic)
+	processed   int64              // Tasks workers finished, failed or not (atomic)
+	failed      int64              // Tasks answered with an error or that panicked (atomic)
+	rejected    int64              // Tasks refused because the queue was full or the pool stopping (atomic)
+	busyNanos   int64              // Time spent processing tasks, summed (atomic)
+	waitNanos   int64              // Time tasks spent queued, summed (atomic)
+	delayed     int64              // Requests waiting out a rate limit delay outside the queue (atomic)
 }
 
 // MessageTask represents a message processing task for the worker pool.
 // It contains all necessary information for a worker to process a message
 // and send the response back to the client.
 type MessageTask struct {
-	Channel   *amqp.Channel   // RabbitMQ channel for responding
-	Message   amqp.Delivery   // The incoming message to process
-	Timestamp time.Time       // When the task was created (for monitoring)
+	Channel   *amqp.Channel // RabbitMQ channel for responding
+	Message   amqp.Delivery // The incoming message to process
+	Timestamp time.Time     // When the task was created (for monitoring)
+	Ack       bool          // Acknowledge the message when a worker takes it (cluster mode)
+	Settle    bool          // Acknowledge the message once processed, reject it on a panic (manual ack mode)
+	Requeue   bool          // Requeue a message rejected after a panic
+	Run       func()        // Executes the rest of a request the rate limiter delayed, instead of handling Message
 }
 
 // WorkerPoolConfig holds configuration options for the worker pool.
@@ -171,13 +186,24 @@ func (wp *WorkerPool) SubmitTask(task MessageTask) error {
 		return fmt.Errorf("worker pool not started")
 	}
 
+	// Tasks ahead of this one that the idle workers cannot take right away
+	ahead := atomic.AddInt64(&wp.submitted, 1) - atomic.LoadInt64(&wp.taken) - 1
+	idle := int64(wp.workerCount) - atomic.LoadInt64(&wp.active)
+
 	select {
 	case wp.queue <- task:
+		if ahead >= idle {
+			wp.handler.notifyQueued(task.Channel, task.Message, int(ahead-idle)+1)
+		}
 		return nil
 	case <-wp.ctx.Done():
+		atomic.AddInt64(&wp.submitted, -1)
+		atomic.AddInt64(&wp.rejected, 1)
 		return fmt.Errorf("worker pool is shutting down")
 	default:
 		// Queue is full, this could implement backpressure logic
+		atomic.AddInt64(&wp.submitted, -1)
+		atomic.AddInt64(&wp.rejected, 1)
 		log.Printf("[server] Worker pool queue is full, dropping message")
 		return fmt.Errorf("worker pool queue is full")
 	}
@@ -200,6 +226,7 @@ func (wp *WorkerPool) worker(id int) {
 			return
 
 		case task := <-wp.queue:
+			atomic.AddInt64(&wp.taken, 1)
 			wp.processTask(id, task)
 		}
 	}
@@ -213,22 +240,35 @@ func (wp *WorkerPool) worker(id int) {
 //   - task: The message task to process
 func (wp *WorkerPool) processTask(workerID int, task MessageTask) {
 	start := time.Now()
-	
-	// Create timeout context for this specific task
-	ctx, cancel := context.WithTimeout(wp.ctx, 30*time.Second)
-	defer cancel()
+	atomic.AddInt64(&wp.active, 1)
+	defer atomic.AddInt64(&wp.active, -1)
+	atomic.AddInt64(&wp.waitNanos, int64(start.Sub(task.Timestamp)))
+	defer func() {
+		atomic.AddInt64(&wp.busyNanos, int64(time.Since(start)))
+		atomic.AddInt64(&wp.processed, 1)
+	}()
 
+	// Free a prefetch slot so the broker can deliver the next message
+	if task.Ack {
+		task.Message.Ack(false)
+	}
+	
 	// Recovery from panics in message processing
 	defer func() {
 		if r := recover(); r != nil {
+			atomic.AddInt64(&wp.panics, 1)
+			atomic.AddInt64(&wp.failed, 1)
 			log.Printf("[server] Worker %d panic recovered: %v", workerID, r)
+			if task.Settle {
+				settle(task.Message, true, task.Requeue)
+			}
 			
 			// Send error response if possible
 			errorResp := RPCResponse{
 				Error: fmt.Sprintf("Internal server error: %v", r),
 			}
 			if body, err := json.Marshal(errorResp); err == nil {
-				task.Channel.PublishWithContext(ctx, "", task.Message.ReplyTo, false, false, amqp.Publishing{
+				wp.handler.publishResponse(task.Channel, task.Message.ReplyTo, amqp.Publishing{
 					ContentType:   "application/json",
 					CorrelationId: task.Message.CorrelationId,
 					Body:          body,
@@ -242,13 +282,44 @@ func (wp *WorkerPool) processTask(workerID int, task MessageTask) {
 	log.Printf("[server] Worker %d processing message (queue time: %v)", workerID, queueTime)
 
 	// Process the message using the existing handler logic
-	wp.handler.handleMessage(task.Channel, task.Message)
+	if task.Run != nil {
+		task.Run()
+	} else if delayed := wp.handler.handleMessage(task.Channel, task.Message); delayed != nil {
+		// Free the worker while the request waits for its rate limit token
+		wp.delay(task, delayed)
+		log.Printf("[server] Worker %d delayed message by %v", workerID, delayed.delay)
+		return
+	}
+	if task.Settle {
+		settle(task.Message, false, false)
+	}
 
 	// Log completion
 	processingTime := time.Since(start)
 	log.Printf("[server] Worker %d completed message (processing time: %v)", workerID, processingTime)
 }
 
+// delay submits the rest of a request the rate limiter delayed as a new task
+// once the delay is over. A request that cannot be submitted then is answered
+// without being executed.
+func (wp *WorkerPool) delay(task MessageTask, delayed *delayedRequest) {
+	atomic.AddInt64(&wp.delayed, 1)
+	time.AfterFunc(delayed.delay, func() {
+		defer atomic.AddInt64(&wp.delayed, -1)
+
+		task.Timestamp = time.Now()
+		task.Ack = false // Acknowledged when the task was first taken
+		task.Run = delayed.run
+		if err := wp.SubmitTask(task); err != nil {
+			log.Printf("[server] Failed to resume delayed RPC task: %v", err)
+			delayed.reject(RPCResponse{Error: "Server overloaded, please try again"})
+			if task.Settle {
+				settle(task.Message, false, false)
+			}
+		}
+	})
+}
+
 // GetStats returns current statistics about the worker pool.
 // This is useful for monitoring and debugging.
 //
@@ -258,18 +329,42 @@ func (wp *WorkerPool) GetStats() WorkerPoolStats {
 	wp.mutex.RLock()
 	defer wp.mutex.RUnlock()
 
-	return WorkerPoolStats{
-		WorkerCount:    wp.workerCount,
-		QueueSize:      cap(wp.queue),
-		QueuedTasks:    len(wp.queue),
-		IsRunning:      wp.started && wp.ctx.Err() == nil,
+	stats := WorkerPoolStats{
+		WorkerCount:  wp.workerCount,
+		QueueSize:    cap(wp.queue),
+		QueuedTasks:  len(wp.queue),
+		ActiveTasks:  int(atomic.LoadInt64(&wp.active)),
+		DelayedTasks: int(atomic.LoadInt64(&wp.delayed)),
+		IsRunning:    wp.started && wp.ctx.Err() == nil,
+		Panics:       atomic.LoadInt64(&wp.panics),
+		Processed:    atomic.LoadInt64(&wp.processed),
+		Failed:       atomic.LoadInt64(&wp.failed),
+		Rejected:     atomic.LoadInt64(&wp.rejected),
+	}
+	if stats.Processed > 0 {
+		stats.AvgLatency = time.Duration(atomic.LoadInt64(&wp.busyNanos) / stats.Processed)
+		stats.AvgQueueWait = time.Duration(atomic.LoadInt64(&wp.waitNanos) / stats.Processed)
 	}
+	return stats
+}
+
+// recordFailure counts a task answered with an error
+func (wp *WorkerPool) recordFailure() {
+	atomic.AddInt64(&wp.failed, 1)
 }
 
 // WorkerPoolStats contains statistics about the worker pool state.
 type WorkerPoolStats struct {
-	WorkerCount int  // Number of worker goroutines
-	QueueSize   int  // Maximum queue capacity
-	QueuedTasks int  // Current number of queued tasks
-	IsRunning   bool // Whether the pool is currently running
+	WorkerCount  int           // Number of worker goroutines
+	QueueSize    int           // Maximum queue capacity
+	QueuedTasks  int           // Current number of queued tasks
+	ActiveTasks  int           // Tasks being processed by workers
+	DelayedTasks int           // Requests waiting out a rate limit delay before they are queued again
+	IsRunning    bool          // Whether the pool is currently running
+	Panics       int64         // Panics recovered while processing messages
+	Processed    int64         // Tasks finished since the pool was created
+	Failed       int64         // Tasks answered with an error or that panicked
+	Rejected     int64         // Tasks refused because the queue was full or the pool stopping
+	AvgLatency   time.Duration // Mean time a worker spent on a task
+	AvgQueueWait time.Duration // Mean time a task waited in the queue
 }
\ No newline at end of file